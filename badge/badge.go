@@ -0,0 +1,363 @@
+package badge
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/problem"
+	"go.uber.org/zap"
+	"gopkg.in/go-playground/validator.v9"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats the catalogue can be imported and exported in.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// yamlContentType is the content type of catalogues in YAML.
+const yamlContentType = "application/yaml"
+
+// BadgeRequest creates or edits a badge. Badges are edited by key so the key
+// of an edit must match the badge being edited.
+type BadgeRequest struct {
+	Key         string `json:"key" yaml:"key" validate:"required,max=64"`
+	Kind        string `json:"kind" yaml:"kind" validate:"oneof=sia oas peak milestone"`
+	Name        string `json:"name" yaml:"name" validate:"required,max=256"`
+	Stage       int    `json:"stage,omitempty" yaml:"stage,omitempty" validate:"min=0,max=9"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty" validate:"max=4096"`
+	// Sections are the kinds of section that can work towards the badge.
+	Sections     []string      `json:"sections" yaml:"sections" validate:"min=1,max=5,dive,oneof=joeys cubs scouts venturers rovers"`
+	Requirements []Requirement `json:"requirements" yaml:"requirements" validate:"min=1,max=32,dive"`
+	// Retired retires the badge, or brings it back when false.
+	Retired bool `json:"retired,omitempty" yaml:"retired,omitempty"`
+}
+
+// badge converts the request to a version of a badge.
+func (b BadgeRequest) badge() Badge {
+	return Badge{
+		Key:          b.Key,
+		Kind:         b.Kind,
+		Name:         b.Name,
+		Stage:        b.Stage,
+		Description:  b.Description,
+		Sections:     b.Sections,
+		Requirements: b.Requirements,
+		Retired:      b.Retired,
+	}
+}
+
+// request converts a version of a badge back to the request that would
+// create it.
+func request(b Badge) BadgeRequest {
+	return BadgeRequest{
+		Key:          b.Key,
+		Kind:         b.Kind,
+		Name:         b.Name,
+		Stage:        b.Stage,
+		Description:  b.Description,
+		Sections:     b.Sections,
+		Requirements: b.Requirements,
+		Retired:      b.Retired,
+	}
+}
+
+// Catalogue is the format the catalogue is imported and exported in, as JSON
+// or YAML. It has the latest version of each badge.
+type Catalogue struct {
+	Badges []BadgeRequest `json:"badges" yaml:"badges" validate:"dive"`
+}
+
+// ParseCatalogue parses a catalogue in the given format. Unknown fields are
+// rejected so typos in hand written catalogues aren't silently dropped.
+func ParseCatalogue(data []byte, format string, validate *validator.Validate) (Catalogue, *problem.Problem) {
+	var catalogue Catalogue
+	switch format {
+	case FormatYAML:
+		if err := yaml.UnmarshalStrict(data, &catalogue); err != nil {
+			return Catalogue{}, problem.Validation("Catalogue is invalid YAML", err)
+		}
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&catalogue); err != nil {
+			return Catalogue{}, problem.Validation("Catalogue is invalid JSON", err)
+		}
+	}
+	if err := validate.Struct(catalogue); err != nil {
+		return Catalogue{}, problem.Validation("Invalid catalogue", err)
+	}
+	return catalogue, nil
+}
+
+// Encode encodes the catalogue in the given format.
+func (c Catalogue) Encode(format string) ([]byte, error) {
+	if format == FormatYAML {
+		return yaml.Marshal(c)
+	}
+	return json.MarshalIndent(c, "", "  ")
+}
+
+type BadgeResponse Badge
+
+func (b BadgeResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// NewBadgeRouter creates a router for the badge catalogue. The catalogue is
+// shared by every group so it's read by anyone signed in but only edited by
+// those allowed by the editors middleware.
+//
+// GET /: List the latest version of each badge, optionally filtered by the
+// kind and section query parameters. Retired badges are listed if retired
+// is true.
+// POST /: Add a badge.
+// GET /catalogue: Export the catalogue, as YAML if format is yaml.
+// POST /catalogue: Import a catalogue in JSON or YAML, by content type.
+// GET /{key}: Get the latest version of a badge.
+// PUT /{key}: Edit a badge, adding a version if anything changed.
+// DELETE /{key}: Retire a badge.
+// GET /{key}/versions: List the versions of a badge.
+// GET /{key}/versions/{version}: Get a version of a badge.
+func NewBadgeRouter(logger *zap.Logger, service BadgeService, editors func(http.Handler) http.Handler) func(chi.Router) {
+	validate := problem.NewValidator()
+	return func(r chi.Router) {
+		r.Get("/", listBadges(logger, service))
+		r.Get("/catalogue", exportCatalogue(logger, service))
+		r.Get("/{key}", getBadge(logger, service))
+		r.Get("/{key}/versions", listVersions(logger, service))
+		r.Get("/{key}/versions/{version}", getVersion(logger, service))
+		r.Group(func(r chi.Router) {
+			r.Use(editors)
+			r.Post("/", newBadge(logger, validate, service))
+			r.Post("/catalogue", importCatalogue(logger, validate, service))
+			r.Put("/{key}", updateBadge(logger, validate, service))
+			r.Delete("/{key}", retireBadge(logger, service))
+		})
+	}
+}
+
+func listBadges(logger *zap.Logger, service BadgeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		filter := Filter{
+			Kind:    r.URL.Query().Get("kind"),
+			Section: r.URL.Query().Get("section"),
+			Retired: r.URL.Query().Get("retired") == "true",
+		}
+		badges, err := service.ListBadges(r.Context(), filter)
+		if err != nil {
+			logger.Error("Failed to list badges", zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, badges)
+	}
+}
+
+func newBadge(logger *zap.Logger, validate *validator.Validate, service BadgeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		request, ok := decodeRequest(logger, w, r, validate)
+		if !ok {
+			return
+		}
+		badge, err := service.NewBadge(r.Context(), request.badge())
+		if err != nil {
+			logger.Info("Failed to add badge", zap.String("key", request.Key), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Added badge", zap.String("key", badge.Key))
+		render.Status(r, http.StatusCreated)
+		render.Render(w, r, BadgeResponse(badge))
+	}
+}
+
+func getBadge(logger *zap.Logger, service BadgeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		key := chi.URLParam(r, "key")
+		badge, err := service.GetBadge(r.Context(), key)
+		if err != nil {
+			logger.Info("Failed to get badge", zap.String("key", key), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, BadgeResponse(badge))
+	}
+}
+
+func updateBadge(logger *zap.Logger, validate *validator.Validate, service BadgeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		key := chi.URLParam(r, "key")
+		request, ok := decodeRequest(logger, w, r, validate)
+		if !ok {
+			return
+		}
+		if request.Key != key {
+			problem.Write(w, r, problem.New(problem.CodeValidationFailed, "Key of the badge can't be changed"))
+			return
+		}
+		badge, err := service.UpdateBadge(r.Context(), request.badge())
+		if err != nil {
+			logger.Info("Failed to edit badge", zap.String("key", key), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Edited badge", zap.String("key", key), zap.Int("version", badge.Version))
+		render.Render(w, r, BadgeResponse(badge))
+	}
+}
+
+func retireBadge(logger *zap.Logger, service BadgeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		key := chi.URLParam(r, "key")
+		if _, err := service.RetireBadge(r.Context(), key); err != nil {
+			logger.Info("Failed to retire badge", zap.String("key", key), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Retired badge", zap.String("key", key))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func listVersions(logger *zap.Logger, service BadgeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		key := chi.URLParam(r, "key")
+		badges, err := service.ListVersions(r.Context(), key)
+		if err != nil {
+			logger.Info("Failed to list badge versions", zap.String("key", key), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, badges)
+	}
+}
+
+func getVersion(logger *zap.Logger, service BadgeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		key := chi.URLParam(r, "key")
+		// Anything that isn't a version can't be one so it's not found.
+		version, err := strconv.Atoi(chi.URLParam(r, "version"))
+		if err != nil {
+			problem.Write(w, r, problem.New(problem.CodeNotFound, "Badge version does not exist"))
+			return
+		}
+		badge, clientErr := service.GetVersion(r.Context(), key, version)
+		if clientErr != nil {
+			logger.Info("Failed to get badge version", zap.String("key", key), zap.Int("version", version), zap.Error(clientErr))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, clientErr))
+			return
+		}
+		render.Render(w, r, BadgeResponse(badge))
+	}
+}
+
+func exportCatalogue(logger *zap.Logger, service BadgeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		format := r.URL.Query().Get("format")
+		if format != "" && format != FormatJSON && format != FormatYAML {
+			problem.Write(w, r, problem.New(problem.CodeValidationFailed, "Format must be json or yaml"))
+			return
+		}
+		catalogue, clientErr := service.Export(r.Context())
+		if clientErr != nil {
+			logger.Error("Failed to export catalogue", zap.Error(clientErr))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, clientErr))
+			return
+		}
+		body, err := catalogue.Encode(format)
+		if err != nil {
+			logger.Error("Failed to encode catalogue", zap.Error(err))
+			problem.Write(w, r, problem.Internal(err))
+			return
+		}
+		if format == FormatYAML {
+			w.Header().Set("Content-Type", yamlContentType)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Write(body)
+	}
+}
+
+func importCatalogue(logger *zap.Logger, validate *validator.Validate, service BadgeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.Info("Failed to read request body", zap.Error(err))
+			problem.Write(w, r, problem.Internal(err))
+			return
+		}
+		defer r.Body.Close()
+
+		catalogue, invalid := ParseCatalogue(body, contentFormat(r), validate)
+		if invalid != nil {
+			logger.Info("Invalid catalogue", zap.Error(invalid))
+			problem.Write(w, r, invalid)
+			return
+		}
+		result, clientErr := service.Import(r.Context(), catalogue)
+		if clientErr != nil {
+			logger.Info("Failed to import catalogue", zap.Error(clientErr))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, clientErr))
+			return
+		}
+		logger.Info("Imported catalogue",
+			zap.Int("created", len(result.Created)),
+			zap.Int("updated", len(result.Updated)),
+			zap.Int("unchanged", len(result.Unchanged)),
+		)
+		render.JSON(w, r, result)
+	}
+}
+
+// contentFormat returns the catalogue format of the request's content type.
+func contentFormat(r *http.Request) string {
+	switch strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0]) {
+	case yamlContentType, "application/x-yaml", "text/yaml":
+		return FormatYAML
+	}
+	return FormatJSON
+}
+
+// decodeRequest decodes and validates a badge request. A problem is written
+// if the request is invalid.
+func decodeRequest(logger *zap.Logger, w http.ResponseWriter, r *http.Request, validate *validator.Validate) (BadgeRequest, bool) {
+	var request BadgeRequest
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Info("Failed to read request body", zap.Error(err))
+		problem.Write(w, r, problem.Internal(err))
+		return request, false
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		logger.Info("Failed to unmarshal badge request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Badge request body is invalid JSON", err))
+		return request, false
+	}
+	if err := validate.Struct(request); err != nil {
+		logger.Info("Invalid badge request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Invalid request body", err))
+		return request, false
+	}
+	return request, true
+}
@@ -0,0 +1,301 @@
+package badge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/security"
+	"github.com/nick96/cubapi/tracing"
+)
+
+// Problem codes of badge errors.
+const (
+	// CodeBadgeAlreadyExists is the problem code of adding a badge with the
+	// key of another badge.
+	CodeBadgeAlreadyExists problem.Code = "badge_already_exists"
+	// CodeVersionConflict is the problem code of editing a badge while
+	// someone else is.
+	CodeVersionConflict problem.Code = "badge_version_conflict"
+)
+
+func init() {
+	problem.Register(CodeBadgeAlreadyExists, http.StatusConflict, "Badge already exists")
+	problem.Register(CodeVersionConflict, http.StatusConflict, "Badge was edited concurrently")
+}
+
+// maxDepth is how deeply requirements can be nested. The program never goes
+// beyond a choice within a requirement, so anything deeper is a mistake.
+const maxDepth = 4
+
+// keyPattern matches valid badge keys: lower case words separated by single
+// hyphens.
+var keyPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// reservedKeys can't be used as keys as they'd clash with the routes of
+// NewBadgeRouter.
+var reservedKeys = map[string]bool{"catalogue": true}
+
+// stages are the stages badges of each kind have, badges of kinds that
+// aren't listed have none.
+var stages = map[string]int{KindOAS: 9, KindMilestone: 3}
+
+type BadgeService struct {
+	store BadgeStorer
+}
+
+// NewBadgeService creates a BadgeService that stores the catalogue in the
+// store.
+func NewBadgeService(store BadgeStorer) BadgeService {
+	return BadgeService{store: store}
+}
+
+// notFound creates an error for a badge that doesn't exist.
+func notFound(key string) problem.Error {
+	return problem.NewError(problem.CodeNotFound, fmt.Sprintf("badge %s does not exist", key), ErrNoSuchBadge)
+}
+
+// GetBadge gets the latest version of the badge with the given key.
+func (s BadgeService) GetBadge(ctx context.Context, key string) (Badge, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "BadgeService.GetBadge")
+	defer span.End()
+
+	badge, found, err := s.store.GetBadge(ctx, key)
+	if err != nil {
+		span.RecordError(err)
+		return Badge{}, security.NewClientError(fmt.Sprintf("failed to get badge %s", key), err)
+	} else if !found {
+		return Badge{}, notFound(key)
+	}
+	return badge, nil
+}
+
+// GetVersion gets the version of the badge with the given key.
+func (s BadgeService) GetVersion(ctx context.Context, key string, version int) (Badge, security.ClientError) {
+	badge, found, err := s.store.GetVersion(ctx, key, version)
+	if err != nil {
+		return Badge{}, security.NewClientError(fmt.Sprintf("failed to get version %d of badge %s", version, key), err)
+	} else if !found {
+		return Badge{}, problem.NewError(problem.CodeNotFound, fmt.Sprintf("version %d of badge %s does not exist", version, key), ErrNoSuchBadge)
+	}
+	return badge, nil
+}
+
+// GetVersionByID gets the version of a badge with the given ID.
+func (s BadgeService) GetVersionByID(ctx context.Context, id int64) (Badge, security.ClientError) {
+	badge, found, err := s.store.GetVersionByID(ctx, id)
+	if err != nil {
+		return Badge{}, security.NewClientError(fmt.Sprintf("failed to get badge version %d", id), err)
+	} else if !found {
+		return Badge{}, problem.NewError(problem.CodeNotFound, fmt.Sprintf("badge version %d does not exist", id), ErrNoSuchBadge)
+	}
+	return badge, nil
+}
+
+// ListBadges lists the latest version of each badge matching the filter.
+func (s BadgeService) ListBadges(ctx context.Context, filter Filter) ([]Badge, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "BadgeService.ListBadges")
+	defer span.End()
+
+	badges, err := s.store.ListBadges(ctx, filter)
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError("failed to list badges", err)
+	}
+	return badges, nil
+}
+
+// ListVersions lists every version of the badge with the given key, oldest
+// first.
+func (s BadgeService) ListVersions(ctx context.Context, key string) ([]Badge, security.ClientError) {
+	badges, err := s.store.ListVersions(ctx, key)
+	if err != nil {
+		return nil, security.NewClientError(fmt.Sprintf("failed to list versions of badge %s", key), err)
+	} else if len(badges) == 0 {
+		return nil, notFound(key)
+	}
+	return badges, nil
+}
+
+// NewBadge adds the first version of a badge.
+func (s BadgeService) NewBadge(ctx context.Context, badge Badge) (Badge, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "BadgeService.NewBadge")
+	defer span.End()
+
+	if err := check(badge); err != nil {
+		return Badge{}, err
+	}
+	badge.Version = 1
+	added, err := s.store.AddVersion(ctx, badge)
+	if errors.Is(err, ErrVersionConflict) {
+		return Badge{}, problem.NewError(CodeBadgeAlreadyExists, fmt.Sprintf("badge %s already exists", badge.Key), err)
+	} else if err != nil {
+		span.RecordError(err)
+		return Badge{}, security.NewClientError(fmt.Sprintf("failed to add badge %s", badge.Key), err)
+	}
+	versionsAdded.Inc()
+	return added, nil
+}
+
+// UpdateBadge edits the badge with the badge's key by adding a version. If
+// nothing has changed the latest version is returned instead so edits can
+// be repeated, e.g. by importing the same catalogue twice.
+func (s BadgeService) UpdateBadge(ctx context.Context, badge Badge) (Badge, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "BadgeService.UpdateBadge")
+	defer span.End()
+	// The next version follows the latest, so it must be read from the
+	// primary.
+	ctx = db.WithPrimary(ctx)
+
+	if err := check(badge); err != nil {
+		return Badge{}, err
+	}
+	latest, clientErr := s.GetBadge(ctx, badge.Key)
+	if clientErr != nil {
+		return Badge{}, clientErr
+	}
+	if Same(latest, badge) {
+		return latest, nil
+	}
+	badge.Version = latest.Version + 1
+	added, err := s.store.AddVersion(ctx, badge)
+	if errors.Is(err, ErrVersionConflict) {
+		return Badge{}, problem.NewError(CodeVersionConflict, fmt.Sprintf("badge %s was edited by someone else, try again", badge.Key), err)
+	} else if err != nil {
+		span.RecordError(err)
+		return Badge{}, security.NewClientError(fmt.Sprintf("failed to edit badge %s", badge.Key), err)
+	}
+	versionsAdded.Inc()
+	return added, nil
+}
+
+// RetireBadge retires the badge with the given key by adding a retired
+// version. Progress towards it is kept.
+func (s BadgeService) RetireBadge(ctx context.Context, key string) (Badge, security.ClientError) {
+	ctx = db.WithPrimary(ctx)
+	latest, err := s.GetBadge(ctx, key)
+	if err != nil {
+		return Badge{}, err
+	}
+	latest.Retired = true
+	return s.UpdateBadge(ctx, latest)
+}
+
+// ImportResult is the keys of the badges an import added, edited and left as
+// they were.
+type ImportResult struct {
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Unchanged []string `json:"unchanged"`
+}
+
+// Import adds or edits every badge in the catalogue. Badges that aren't in it
+// are left as they are. The whole catalogue is checked before anything is
+// changed, but badges are added one at a time so a failed import may be
+// partially applied. Imports are repeatable, so it can be run again.
+func (s BadgeService) Import(ctx context.Context, catalogue Catalogue) (ImportResult, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "BadgeService.Import")
+	defer span.End()
+	ctx = db.WithPrimary(ctx)
+
+	result := ImportResult{Created: []string{}, Updated: []string{}, Unchanged: []string{}}
+	keys := make(map[string]bool)
+	for _, request := range catalogue.Badges {
+		if keys[request.Key] {
+			return result, problem.Invalid("badge %s is in the catalogue more than once", request.Key)
+		}
+		keys[request.Key] = true
+		if err := check(request.badge()); err != nil {
+			return result, err
+		}
+	}
+
+	for _, request := range catalogue.Badges {
+		badge := request.badge()
+		latest, found, err := s.store.GetBadge(ctx, badge.Key)
+		if err != nil {
+			span.RecordError(err)
+			return result, security.NewClientError(fmt.Sprintf("failed to get badge %s", badge.Key), err)
+		}
+		switch {
+		case !found:
+			if _, err := s.NewBadge(ctx, badge); err != nil {
+				return result, err
+			}
+			result.Created = append(result.Created, badge.Key)
+		case Same(latest, badge):
+			result.Unchanged = append(result.Unchanged, badge.Key)
+		default:
+			if _, err := s.UpdateBadge(ctx, badge); err != nil {
+				return result, err
+			}
+			result.Updated = append(result.Updated, badge.Key)
+		}
+	}
+	return result, nil
+}
+
+// Export returns the latest version of every badge, including retired ones,
+// as a catalogue that can be imported.
+func (s BadgeService) Export(ctx context.Context) (Catalogue, security.ClientError) {
+	badges, err := s.ListBadges(ctx, Filter{Retired: true})
+	if err != nil {
+		return Catalogue{}, err
+	}
+	catalogue := Catalogue{Badges: []BadgeRequest{}}
+	for _, badge := range badges {
+		catalogue.Badges = append(catalogue.Badges, request(badge))
+	}
+	return catalogue, nil
+}
+
+// Same reports whether two versions of a badge have the same content, i.e.
+// everything but their IDs, versions and when they were added.
+func Same(a, b Badge) bool {
+	aJSON, aErr := json.Marshal(request(a))
+	bJSON, bErr := json.Marshal(request(b))
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// check checks the parts of a badge that request validation can't.
+func check(badge Badge) security.ClientError {
+	if !keyPattern.MatchString(badge.Key) || reservedKeys[badge.Key] {
+		return problem.Invalid("badge key %q must be lower case letters and digits separated by hyphens", badge.Key)
+	}
+	if max := stages[badge.Kind]; max == 0 && badge.Stage != 0 {
+		return problem.Invalid("badge %s: %s badges don't have stages", badge.Key, badge.Kind)
+	} else if max != 0 && (badge.Stage < 1 || badge.Stage > max) {
+		return problem.Invalid("badge %s: %s badges must have a stage from 1 to %d", badge.Key, badge.Kind, max)
+	}
+	if len(badge.Requirements) == 0 {
+		return problem.Invalid("badge %s has no requirements", badge.Key)
+	}
+	return checkRequirements(badge.Key, badge.Requirements, 1, make(map[string]bool))
+}
+
+// checkRequirements checks requirements at the given depth have unique IDs
+// and can be met.
+func checkRequirements(key string, requirements []Requirement, depth int, ids map[string]bool) security.ClientError {
+	if depth > maxDepth {
+		return problem.Invalid("badge %s: requirements can't be nested more than %d deep", key, maxDepth)
+	}
+	for _, requirement := range requirements {
+		if ids[requirement.Id] {
+			return problem.Invalid("badge %s: requirement %s is in the badge more than once", key, requirement.Id)
+		}
+		ids[requirement.Id] = true
+		if requirement.Choose > len(requirement.Requirements) {
+			return problem.Invalid("badge %s: requirement %s chooses %d of %d requirements", key, requirement.Id, requirement.Choose, len(requirement.Requirements))
+		}
+		if err := checkRequirements(key, requirement.Requirements, depth+1, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package badge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/nick96/cubapi/openapi/openapitest"
+	"github.com/nick96/cubapi/problem"
+	"go.uber.org/zap"
+)
+
+const validBadge = `{
+	"key": "oas-bushcraft-1",
+	"kind": "oas",
+	"name": "Bushcraft",
+	"stage": 1,
+	"sections": ["joeys", "cubs"],
+	"requirements": [
+		{"id": "1", "description": "Help prepare for an activity"},
+		{"id": "2", "description": "Complete 2 of the following", "choose": 2, "requirements": [
+			{"id": "2.1", "description": "Tie a reef knot"},
+			{"id": "2.2", "description": "Tie a sheet bend"},
+			{"id": "2.3", "description": "Tie a clove hitch"}
+		]}
+	]
+}`
+
+const validCatalogue = `badges:
+- key: oas-bushcraft-1
+  kind: oas
+  name: Bushcraft
+  stage: 1
+  sections: [joeys, cubs]
+  requirements:
+  - id: "1"
+    description: Help prepare for an activity
+- key: sia-art-literature
+  kind: sia
+  name: Art and Literature
+  sections: [cubs, scouts]
+  requirements:
+  - id: plan
+    description: Plan your project
+`
+
+// Headers of requests made by an editor, with a JSON or YAML body.
+var (
+	editor     = http.Header{editorHeader: {"yes"}}
+	editorYAML = http.Header{editorHeader: {"yes"}, "Content-Type": {"application/yaml"}}
+)
+
+func newTestRouter(store BadgeStorer) chi.Router {
+	router := chi.NewRouter()
+	router.Route("/badge", NewBadgeRouter(zap.NewNop(), NewBadgeService(store), editorsOnly))
+	return router
+}
+
+func TestBadgeVersions(t *testing.T) {
+	router := newTestRouter(newMockBadgeStore())
+
+	var created Badge
+	if w := openapitest.Do(t, router, "POST", "/badge", validBadge, &created, editor); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if created.Version != 1 || len(created.Requirements) != 2 || created.Requirements[1].Choose != 2 {
+		t.Errorf("Expected the first version with its requirements, got %+v", created)
+	}
+	var resp problem.Problem
+	if w := openapitest.Do(t, router, "POST", "/badge", validBadge, &resp, editor); w.Code != http.StatusConflict || resp.Code != CodeBadgeAlreadyExists {
+		t.Errorf("Expected adding the badge twice to conflict, got %d: %+v", w.Code, resp)
+	}
+
+	// Editing without changes doesn't add a version.
+	var unchanged Badge
+	openapitest.Do(t, router, "PUT", "/badge/oas-bushcraft-1", validBadge, &unchanged, editor)
+	if unchanged.Version != 1 {
+		t.Errorf("Expected an unchanged badge to keep its version, got %d", unchanged.Version)
+	}
+
+	edited := strings.Replace(validBadge, "Tie a reef knot", "Tie a bowline", 1)
+	var updated Badge
+	if w := openapitest.Do(t, router, "PUT", "/badge/oas-bushcraft-1", edited, &updated, editor); w.Code != http.StatusOK || updated.Version != 2 {
+		t.Fatalf("Expected a second version, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The first version still has the requirements progress was recorded
+	// against.
+	var first Badge
+	openapitest.Do(t, router, "GET", "/badge/oas-bushcraft-1/versions/1", "", &first, editor)
+	if requirement, ok := first.Requirements.Find("2.1"); !ok || requirement.Description != "Tie a reef knot" {
+		t.Errorf("Expected the first version to be unchanged, got %+v", first.Requirements)
+	}
+	var versions []Badge
+	openapitest.Do(t, router, "GET", "/badge/oas-bushcraft-1/versions", "", &versions, editor)
+	if len(versions) != 2 || versions[0].Version != 1 || versions[1].Version != 2 {
+		t.Errorf("Expected both versions oldest first, got %+v", versions)
+	}
+
+	if w := openapitest.Do(t, router, "DELETE", "/badge/oas-bushcraft-1", "", nil, editor); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	var listed []Badge
+	openapitest.Do(t, router, "GET", "/badge", "", &listed, editor)
+	if len(listed) != 0 {
+		t.Errorf("Expected retired badges not to be listed, got %+v", listed)
+	}
+	openapitest.Do(t, router, "GET", "/badge?retired=true", "", &listed, editor)
+	if len(listed) != 1 || !listed[0].Retired || listed[0].Version != 3 {
+		t.Errorf("Expected the retired version to be listed, got %+v", listed)
+	}
+}
+
+func TestOnlyEditorsChangeCatalogue(t *testing.T) {
+	router := newTestRouter(newMockBadgeStore())
+	for _, tt := range []struct{ method, path, body string }{
+		{"POST", "/badge", validBadge},
+		{"POST", "/badge/catalogue", `{"badges": []}`},
+		{"PUT", "/badge/oas-bushcraft-1", validBadge},
+		{"DELETE", "/badge/oas-bushcraft-1", ""},
+	} {
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected %s %s to be forbidden, got %d", tt.method, tt.path, w.Code)
+		}
+	}
+	r := httptest.NewRequest("GET", "/badge", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected anyone to list badges, got %d", w.Code)
+	}
+}
+
+func TestInvalidBadges(t *testing.T) {
+	testCases := []struct {
+		name string
+		body string
+	}{
+		{"unknown-kind", strings.Replace(validBadge, `"oas"`, `"award"`, 1)},
+		{"no-sections", strings.Replace(validBadge, `["joeys", "cubs"]`, `[]`, 1)},
+		{"unknown-section", strings.Replace(validBadge, `"joeys"`, `"wolves"`, 1)},
+		{"no-requirements", strings.Replace(validBadge, `"requirements": [`, `"requirements": [], "x": [`, 1)},
+		{"bad-key", strings.Replace(validBadge, `"oas-bushcraft-1"`, `"OAS Bushcraft"`, 1)},
+		{"reserved-key", strings.Replace(validBadge, `"oas-bushcraft-1"`, `"catalogue"`, 1)},
+		{"no-stage", strings.Replace(validBadge, `"stage": 1,`, "", 1)},
+		{"stage-of-sia", strings.Replace(validBadge, `"oas"`, `"sia"`, 1)},
+		{"duplicate-requirement", strings.Replace(validBadge, `"2.3"`, `"1"`, 1)},
+		{"choose-too-many", strings.Replace(validBadge, `"choose": 2`, `"choose": 4`, 1)},
+		{"requirement-without-id", strings.Replace(validBadge, `"id": "2.1", `, "", 1)},
+	}
+	router := newTestRouter(newMockBadgeStore())
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp problem.Problem
+			w := openapitest.Do(t, router, "POST", "/badge", tt.body, &resp, editor)
+			if w.Code != http.StatusBadRequest || resp.Code != problem.CodeValidationFailed {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestEditCantChangeKey(t *testing.T) {
+	router := newTestRouter(newMockBadgeStore())
+	openapitest.Do(t, router, "POST", "/badge", validBadge, nil, editor)
+	if w := openapitest.Do(t, router, "PUT", "/badge/oas-bushcraft-2", validBadge, nil, editor); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected editing with another key to fail, got %d: %s", w.Code, w.Body.String())
+	}
+	edited := strings.Replace(validBadge, `"oas-bushcraft-1"`, `"oas-bushcraft-2"`, 1)
+	if w := openapitest.Do(t, router, "PUT", "/badge/oas-bushcraft-2", edited, nil, editor); w.Code != http.StatusNotFound {
+		t.Errorf("Expected editing a missing badge not to be found, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	store := newMockBadgeStore()
+	router := newTestRouter(store)
+
+	var result ImportResult
+	if w := openapitest.Do(t, router, "POST", "/badge/catalogue", validCatalogue, &result, editorYAML); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(result.Created) != 2 || len(result.Updated) != 0 {
+		t.Errorf("Expected both badges to be added, got %+v", result)
+	}
+
+	// Exporting and importing again changes nothing.
+	w := openapitest.Do(t, router, "GET", "/badge/catalogue?format=yaml", "", nil, editor)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != yamlContentType {
+		t.Fatalf("Expected a YAML catalogue, got %d %s: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	openapitest.Do(t, router, "POST", "/badge/catalogue", w.Body.String(), &result, editorYAML)
+	if len(result.Unchanged) != 2 || len(result.Created)+len(result.Updated) != 0 {
+		t.Errorf("Expected re-importing the export to change nothing, got %+v", result)
+	}
+	if len(store.versions) != 2 {
+		t.Errorf("Expected no versions to be added, got %d", len(store.versions))
+	}
+
+	edited := strings.Replace(validCatalogue, "Plan your project", "Plan your art project", 1)
+	openapitest.Do(t, router, "POST", "/badge/catalogue", edited, &result, editorYAML)
+	if len(result.Updated) != 1 || result.Updated[0] != "sia-art-literature" {
+		t.Errorf("Expected the edited badge to be updated, got %+v", result)
+	}
+
+	var catalogue Catalogue
+	openapitest.Do(t, router, "GET", "/badge/catalogue", "", &catalogue, editor)
+	if len(catalogue.Badges) != 2 || catalogue.Badges[1].Requirements[0].Description != "Plan your art project" {
+		t.Errorf("Expected the latest versions to be exported, got %+v", catalogue)
+	}
+}
+
+func TestInvalidImportChangesNothing(t *testing.T) {
+	store := newMockBadgeStore()
+	router := newTestRouter(store)
+	testCases := []struct {
+		name string
+		body string
+	}{
+		{"unknown-field", strings.Replace(validCatalogue, "  stage: 1\n", "  stage: 1\n  level: 1\n", 1)},
+		{"invalid-badge", strings.Replace(validCatalogue, "kind: sia", "kind: award", 1)},
+		{"duplicate-key", strings.Replace(validCatalogue, "sia-art-literature", "oas-bushcraft-1", 1)},
+		{"malformed", "badges: ["},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp problem.Problem
+			if w := openapitest.Do(t, router, "POST", "/badge/catalogue", tt.body, &resp, editorYAML); w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+			if len(store.versions) != 0 {
+				t.Fatalf("Expected nothing to be imported, got %+v", store.versions)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package badge
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var versionsAdded = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "autocrat_badge_versions_added_total",
+	Help: "Number of badge versions added to the catalogue, including new badges.",
+})
@@ -0,0 +1,110 @@
+package badge
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of badge.
+const (
+	// KindSIA are Special Interest Area badges.
+	KindSIA = "sia"
+	// KindOAS are stages of the Outdoor Adventure Skills.
+	KindOAS = "oas"
+	// KindPeak are the Peak awards at the end of each section.
+	KindPeak = "peak"
+	// KindMilestone are the milestones of personal progression.
+	KindMilestone = "milestone"
+)
+
+// Kinds are the kinds of badge.
+var Kinds = []string{KindSIA, KindOAS, KindPeak, KindMilestone}
+
+// Badge is a version of a badge in the catalogue. The catalogue is the
+// national program so it's shared by every group.
+//
+// Versions are never changed once added. Editing a badge adds a version so
+// progress recorded against an earlier version still refers to the
+// requirements it was recorded against.
+type Badge struct {
+	// Id identifies the version of the badge.
+	Id int64 `json:"id" db:"id"`
+	// Key identifies the badge across its versions, e.g. "oas-bushcraft-3".
+	Key     string `json:"key" db:"key"`
+	Version int    `json:"version" db:"version"`
+	Kind    string `json:"kind" db:"kind"`
+	Name    string `json:"name" db:"name"`
+	// Stage is the stage of Outdoor Adventure Skills and milestones, zero
+	// for other badges.
+	Stage       int    `json:"stage" db:"stage"`
+	Description string `json:"description" db:"description"`
+	// Sections are the kinds of section that can work towards the badge.
+	Sections     pq.StringArray `json:"sections" db:"sections"`
+	Requirements Requirements   `json:"requirements" db:"requirements"`
+	// Retired badges can no longer be started but progress towards them is
+	// kept.
+	Retired   bool      `json:"retired" db:"retired"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// Requirement is something that has to be done to earn a badge. A
+// requirement with requirements of its own is met when Choose of them are,
+// or all of them if Choose is zero, e.g. "complete 3 of the following 5".
+type Requirement struct {
+	// Id identifies the requirement within the badge, e.g. "2.1". It should
+	// be kept when the requirement is unchanged in a new version.
+	Id           string        `json:"id" yaml:"id" validate:"required,max=64"`
+	Description  string        `json:"description" yaml:"description" validate:"required,max=1024"`
+	Choose       int           `json:"choose,omitempty" yaml:"choose,omitempty" validate:"min=0"`
+	Requirements []Requirement `json:"requirements,omitempty" yaml:"requirements,omitempty" validate:"max=32,dive"`
+}
+
+// Requirements are the requirements of a badge, all of which must be met.
+// They are stored as a JSONB column.
+type Requirements []Requirement
+
+// Scan scans a JSONB column.
+func (r *Requirements) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		*r = Requirements{}
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into requirements", src)
+	}
+	return json.Unmarshal(data, r)
+}
+
+// Value stores the requirements in a JSONB column.
+func (r Requirements) Value() (driver.Value, error) {
+	if r == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Find finds the requirement with the given ID at any depth.
+func (r Requirements) Find(id string) (Requirement, bool) {
+	for _, requirement := range r {
+		if requirement.Id == id {
+			return requirement, true
+		}
+		if found, ok := Requirements(requirement.Requirements).Find(id); ok {
+			return found, true
+		}
+	}
+	return Requirement{}, false
+}
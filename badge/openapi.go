@@ -0,0 +1,145 @@
+package badge
+
+import (
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/user"
+)
+
+// DescribeBadgeRouter describes the operations of NewBadgeRouter.
+func DescribeBadgeRouter(r *openapi.Router) {
+	key := openapi.PathParam("key", "The key of the badge.", openapi.String())
+	denied := map[string]*openapi.Response{
+		"403": r.Problem("The request isn't authenticated, the user can't edit the catalogue, or the CSRF token is missing."),
+		"429": r.Problem("The client has made too many requests."),
+		"500": r.Problem("The request couldn't be completed."),
+	}
+	responses := func(responses map[string]*openapi.Response) map[string]*openapi.Response {
+		for status, response := range denied {
+			responses[status] = response
+		}
+		return responses
+	}
+	// The catalogue is the same in either format.
+	catalogueBody := r.JSONBody(Catalogue{})
+	catalogueBody.Content[yamlContentType] = catalogueBody.Content[openapi.JSONContentType]
+	catalogue := r.JSON("The catalogue.", Catalogue{})
+	catalogue.Content[yamlContentType] = catalogue.Content[openapi.JSONContentType]
+
+	r.Get("/", &openapi.Operation{
+		OperationID: "listBadges",
+		Summary:     "List badges",
+		Description: "The latest version of each badge.",
+		Tags:        []string{"badge"},
+		Security:    user.Authenticated,
+		Parameters: []openapi.Parameter{
+			{Name: "kind", In: "query", Description: "Only list badges of the kind.", Schema: openapi.Enum(Kinds)},
+			{Name: "section", In: "query", Description: "Only list badges the section can work towards.", Schema: openapi.Enum(group.Sections)},
+			{Name: "retired", In: "query", Description: "List retired badges too if true.", Schema: &openapi.Schema{Type: "boolean"}},
+		},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The badges ordered by kind, name and stage.", []Badge{}),
+		}),
+	})
+	r.Post("/", &openapi.Operation{
+		OperationID: "createBadge",
+		Summary:     "Add a badge",
+		Description: "Only users with the program role can edit the catalogue.",
+		Tags:        []string{"badge"},
+		Security:    user.Authenticated,
+		RequestBody: r.JSONBody(BadgeRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"201": r.JSON("The first version of the badge.", BadgeResponse{}),
+			"400": r.Problem("The request body is invalid."),
+			"409": r.Problem("A badge with the key already exists."),
+		}),
+	})
+	r.Get("/catalogue", &openapi.Operation{
+		OperationID: "exportCatalogue",
+		Summary:     "Export the catalogue",
+		Description: "The latest version of every badge, including retired badges, in the format accepted by importCatalogue.",
+		Tags:        []string{"badge"},
+		Security:    user.Authenticated,
+		Parameters: []openapi.Parameter{
+			{Name: "format", In: "query", Description: "Format of the catalogue, JSON by default.", Schema: openapi.Enum([]string{FormatJSON, FormatYAML})},
+		},
+		Responses: responses(map[string]*openapi.Response{
+			"200": catalogue,
+			"400": r.Problem("The format is unknown."),
+		}),
+	})
+	r.Post("/catalogue", &openapi.Operation{
+		OperationID: "importCatalogue",
+		Summary:     "Import a catalogue",
+		Description: "Adds the badges that don't exist and edits those that have changed. Badges that aren't in the catalogue are left as they are. Only users with the program role can edit the catalogue.",
+		Tags:        []string{"badge"},
+		Security:    user.Authenticated,
+		RequestBody: catalogueBody,
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The keys of the badges added, edited and left as they were.", ImportResult{}),
+			"400": r.Problem("The catalogue is invalid. Nothing has been imported."),
+			"409": r.Problem("A badge was edited during the import. Importing again completes it."),
+		}),
+	})
+	r.Get("/{key}", &openapi.Operation{
+		OperationID: "getBadge",
+		Summary:     "Get the latest version of a badge",
+		Tags:        []string{"badge"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{key},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The badge.", BadgeResponse{}),
+			"404": r.Problem("The badge doesn't exist."),
+		}),
+	})
+	r.Put("/{key}", &openapi.Operation{
+		OperationID: "updateBadge",
+		Summary:     "Edit a badge",
+		Description: "Adds a version of the badge, unless nothing has changed. Earlier versions are kept for the progress recorded against them. Only users with the program role can edit the catalogue.",
+		Tags:        []string{"badge"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{key},
+		RequestBody: r.JSONBody(BadgeRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The latest version of the badge.", BadgeResponse{}),
+			"400": r.Problem("The request body is invalid or its key isn't the badge's."),
+			"404": r.Problem("The badge doesn't exist."),
+			"409": r.Problem("The badge was edited by someone else at the same time."),
+		}),
+	})
+	r.Delete("/{key}", &openapi.Operation{
+		OperationID: "retireBadge",
+		Summary:     "Retire a badge",
+		Description: "Adds a retired version of the badge. Progress towards it is kept. Only users with the program role can edit the catalogue.",
+		Tags:        []string{"badge"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{key},
+		Responses: responses(map[string]*openapi.Response{
+			"204": openapi.Empty("The badge is retired."),
+			"404": r.Problem("The badge doesn't exist."),
+			"409": r.Problem("The badge was edited by someone else at the same time."),
+		}),
+	})
+	r.Get("/{key}/versions", &openapi.Operation{
+		OperationID: "listBadgeVersions",
+		Summary:     "List the versions of a badge",
+		Tags:        []string{"badge"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{key},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The versions of the badge, oldest first.", []Badge{}),
+			"404": r.Problem("The badge doesn't exist."),
+		}),
+	})
+	r.Get("/{key}/versions/{version}", &openapi.Operation{
+		OperationID: "getBadgeVersion",
+		Summary:     "Get a version of a badge",
+		Tags:        []string{"badge"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{key, openapi.PathParam("version", "The version of the badge.", openapi.Integer())},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The version of the badge.", BadgeResponse{}),
+			"404": r.Problem("The badge or version doesn't exist."),
+		}),
+	})
+}
@@ -0,0 +1,46 @@
+package badge
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/openapi/openapitest"
+)
+
+// TestOpenAPIContract checks that the handlers behave as the OpenAPI document
+// says they do. If this fails either the handlers or DescribeBadgeRouter need
+// updating.
+func TestOpenAPIContract(t *testing.T) {
+	router := newTestRouter(newMockBadgeStore())
+
+	doc := openapi.New("autocrat", "test")
+	doc.Route("/badge", DescribeBadgeRouter)
+	if err := doc.CheckRoutes(router); err != nil {
+		t.Fatal(err)
+	}
+
+	edited := strings.Replace(validBadge, "Bushcraft", "Bush craft", 1)
+	catalogue := `{"badges": [` + strings.Replace(validBadge, "oas-bushcraft-1", "oas-bushcraft-2", 1) + `]}`
+	openapitest.Run(t, doc, router, []openapitest.Case{
+		{Name: "create", Method: "POST", Pattern: "/badge", Body: validBadge, Header: editor, Status: http.StatusCreated},
+		{Name: "create-invalid", Method: "POST", Pattern: "/badge", Body: `{"key":""}`, Invalid: true, Header: editor, Status: http.StatusBadRequest},
+		{Name: "create-existing", Method: "POST", Pattern: "/badge", Body: validBadge, Header: editor, Status: http.StatusConflict},
+		{Name: "list", Method: "GET", Pattern: "/badge", Path: "/badge?kind=oas&section=cubs", Header: editor, Status: http.StatusOK},
+		{Name: "get", Method: "GET", Pattern: "/badge/{key}", Path: "/badge/oas-bushcraft-1", Header: editor, Status: http.StatusOK},
+		{Name: "get-missing", Method: "GET", Pattern: "/badge/{key}", Path: "/badge/oas-missing", Header: editor, Status: http.StatusNotFound},
+		{Name: "update", Method: "PUT", Pattern: "/badge/{key}", Path: "/badge/oas-bushcraft-1", Body: edited, Header: editor, Status: http.StatusOK},
+		{Name: "update-missing", Method: "PUT", Pattern: "/badge/{key}", Path: "/badge/oas-bushcraft-2", Body: strings.Replace(validBadge, "oas-bushcraft-1", "oas-bushcraft-2", 1), Header: editor, Status: http.StatusNotFound},
+		{Name: "versions", Method: "GET", Pattern: "/badge/{key}/versions", Path: "/badge/oas-bushcraft-1/versions", Header: editor, Status: http.StatusOK},
+		{Name: "versions-missing", Method: "GET", Pattern: "/badge/{key}/versions", Path: "/badge/oas-missing/versions", Header: editor, Status: http.StatusNotFound},
+		{Name: "version", Method: "GET", Pattern: "/badge/{key}/versions/{version}", Path: "/badge/oas-bushcraft-1/versions/1", Header: editor, Status: http.StatusOK},
+		{Name: "version-missing", Method: "GET", Pattern: "/badge/{key}/versions/{version}", Path: "/badge/oas-bushcraft-1/versions/9", Header: editor, Status: http.StatusNotFound},
+		{Name: "import", Method: "POST", Pattern: "/badge/catalogue", Body: catalogue, Header: editor, Status: http.StatusOK},
+		{Name: "import-invalid", Method: "POST", Pattern: "/badge/catalogue", Body: `{"badges": [{}]}`, Invalid: true, Header: editor, Status: http.StatusBadRequest},
+		{Name: "export", Method: "GET", Pattern: "/badge/catalogue", Header: editor, Status: http.StatusOK},
+		{Name: "export-unknown-format", Method: "GET", Pattern: "/badge/catalogue", Path: "/badge/catalogue?format=xml", Header: editor, Status: http.StatusBadRequest},
+		{Name: "retire", Method: "DELETE", Pattern: "/badge/{key}", Path: "/badge/oas-bushcraft-1", Header: editor, Status: http.StatusNoContent},
+		{Name: "retire-missing", Method: "DELETE", Pattern: "/badge/{key}", Path: "/badge/oas-missing", Header: editor, Status: http.StatusNotFound},
+	})
+}
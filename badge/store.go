@@ -0,0 +1,143 @@
+package badge
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/nick96/cubapi/db"
+)
+
+var (
+	// ErrNoSuchBadge is returned when a badge or a version of it doesn't
+	// exist.
+	ErrNoSuchBadge = errors.New("badge does not exist")
+	// ErrVersionConflict is returned when adding a version that already
+	// exists, either because the badge already exists or because another
+	// version was added concurrently.
+	ErrVersionConflict = errors.New("badge version already exists")
+)
+
+// uniqueViolation is the Postgres error code of unique constraint violations,
+// see https://www.postgresql.org/docs/current/errcodes-appendix.html.
+const uniqueViolation = "23505"
+
+// Filter restricts the badges listed. Empty fields match every badge.
+type Filter struct {
+	Kind    string
+	Section string
+	// Retired includes retired badges.
+	Retired bool
+}
+
+// BadgeStorer is an interface that must be implemented by things that store
+// the badge catalogue. Badges are found by their latest version unless a
+// version is asked for.
+type BadgeStorer interface {
+	GetBadge(ctx context.Context, key string) (Badge, bool, error)
+	GetVersion(ctx context.Context, key string, version int) (Badge, bool, error)
+	GetVersionByID(ctx context.Context, id int64) (Badge, bool, error)
+	ListBadges(ctx context.Context, filter Filter) ([]Badge, error)
+	ListVersions(ctx context.Context, key string) ([]Badge, error)
+	AddVersion(ctx context.Context, badge Badge) (Badge, error)
+}
+
+// BadgeStore is a store for the badge catalogue. It implements the
+// BadgeStorer interface.
+type BadgeStore struct {
+	cluster *db.Cluster
+}
+
+// NewStore creates a new store from the given cluster. Reads go to a replica
+// unless the primary is forced with db.WithPrimary.
+func NewStore(cluster *db.Cluster) BadgeStorer {
+	return BadgeStore{cluster}
+}
+
+// GetBadge gets the latest version of the badge with the given key.
+func (s BadgeStore) GetBadge(ctx context.Context, key string) (Badge, bool, error) {
+	query := `SELECT * FROM autocrat.badges WHERE key = $1 ORDER BY version DESC LIMIT 1;`
+	return s.get(ctx, "badge.get_badge", key, query, key)
+}
+
+// GetVersion gets the version of the badge with the given key.
+func (s BadgeStore) GetVersion(ctx context.Context, key string, version int) (Badge, bool, error) {
+	query := `SELECT * FROM autocrat.badges WHERE key = $1 AND version = $2;`
+	return s.get(ctx, "badge.get_version", key, query, key, version)
+}
+
+// GetVersionByID gets the version of a badge with the given ID.
+func (s BadgeStore) GetVersionByID(ctx context.Context, id int64) (Badge, bool, error) {
+	query := `SELECT * FROM autocrat.badges WHERE id = $1;`
+	return s.get(ctx, "badge.get_version_by_id", fmt.Sprint(id), query, id)
+}
+
+// get gets a single badge with the query, described by key in errors.
+func (s BadgeStore) get(ctx context.Context, name, key, query string, args ...interface{}) (Badge, bool, error) {
+	var badge Badge
+	err := s.cluster.Reader(ctx).Named(name).QueryRowx(ctx, query, args...).StructScan(&badge)
+	if err == sql.ErrNoRows {
+		return Badge{}, false, nil
+	} else if err != nil {
+		return Badge{}, false, fmt.Errorf("could not get badge %s: %w", key, err)
+	}
+	return badge, true, nil
+}
+
+// ListBadges lists the latest version of each badge matching the filter
+// ordered by kind, name and stage.
+func (s BadgeStore) ListBadges(ctx context.Context, filter Filter) ([]Badge, error) {
+	badges := []Badge{}
+	query := `
+	SELECT * FROM (
+		SELECT DISTINCT ON (key) * FROM autocrat.badges ORDER BY key, version DESC
+	) latest
+	WHERE ($1 = '' OR kind = $1) AND ($2 = '' OR $2 = ANY(sections)) AND ($3 OR NOT retired)
+	ORDER BY array_position($4::TEXT[], kind), name, stage, key;
+	`
+	err := s.cluster.Reader(ctx).Named("badge.list_badges").
+		Select(ctx, &badges, query, filter.Kind, filter.Section, filter.Retired, pq.Array(Kinds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list badges: %w", err)
+	}
+	return badges, nil
+}
+
+// ListVersions lists every version of the badge with the given key, oldest
+// first.
+func (s BadgeStore) ListVersions(ctx context.Context, key string) ([]Badge, error) {
+	badges := []Badge{}
+	query := `SELECT * FROM autocrat.badges WHERE key = $1 ORDER BY version;`
+	if err := s.cluster.Reader(ctx).Named("badge.list_versions").Select(ctx, &badges, query, key); err != nil {
+		return nil, fmt.Errorf("failed to list versions of badge %s: %w", key, err)
+	}
+	return badges, nil
+}
+
+// AddVersion adds the version of the badge and returns it as it was stored.
+// The version must be one after the latest, or one for a new badge, so
+// concurrent edits can't both be added.
+func (s BadgeStore) AddVersion(ctx context.Context, badge Badge) (Badge, error) {
+	var added Badge
+	query := `
+	INSERT INTO autocrat.badges (key, version, kind, name, stage, description, sections, requirements, retired)
+	SELECT $1::TEXT, $2::INTEGER, $3::TEXT, $4::TEXT, $5::INTEGER, $6::TEXT, $7::TEXT[], $8::JSONB, $9::BOOLEAN
+	WHERE $2::INTEGER = 1 + COALESCE((SELECT max(version) FROM autocrat.badges WHERE key = $1::TEXT), 0)
+	RETURNING *;
+	`
+	err := s.cluster.Primary().Named("badge.add_version").
+		QueryRowx(ctx, query,
+			badge.Key, badge.Version, badge.Kind, badge.Name, badge.Stage, badge.Description,
+			badge.Sections, badge.Requirements, badge.Retired,
+		).
+		StructScan(&added)
+	var pqErr *pq.Error
+	if err == sql.ErrNoRows || (errors.As(err, &pqErr) && pqErr.Code == uniqueViolation) {
+		return Badge{}, fmt.Errorf("failed to add version %d of badge %s: %w", badge.Version, badge.Key, ErrVersionConflict)
+	} else if err != nil {
+		return Badge{}, fmt.Errorf("failed to add version %d of badge %s: %w", badge.Version, badge.Key, err)
+	}
+	return added, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nick96/cubapi/badge"
+	"github.com/nick96/cubapi/problem"
+)
+
+var badgeCommands = []command{
+	{"import", "Import a badge catalogue.", runBadgeImport},
+	{"export", "Export the badge catalogue.", runBadgeExport},
+}
+
+// runBadge runs a badge subcommand.
+func runBadge(args []string) error {
+	return dispatch("autocrat badge", badgeCommands, args)
+}
+
+// catalogueFormat returns the format of a catalogue file by its extension.
+func catalogueFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return badge.FormatYAML, nil
+	case ".json":
+		return badge.FormatJSON, nil
+	}
+	return "", usageError{fmt.Errorf("catalogue file %s must have a .json, .yaml or .yml extension", path)}
+}
+
+func runBadgeImport(args []string) error {
+	flags, loader := newFlagSet("badge import", "Import a badge catalogue. Badges that don't exist are added, changed badges get a new version and badges that aren't in the catalogue are left as they are.")
+	out := addOutputFlags(flags)
+	file := flags.String("file", "", "Catalogue to import, as JSON or YAML by its extension.")
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "file", *file); err != nil {
+		return err
+	}
+	format, err := catalogueFormat(*file)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return usageError{fmt.Errorf("failed to read catalogue: %w", err)}
+	}
+	catalogue, invalid := badge.ParseCatalogue(data, format, problem.NewValidator())
+	if invalid != nil {
+		return usageError{fmt.Errorf("invalid catalogue %s: %s", *file, problemText(invalid))}
+	}
+
+	svc, err := openServices(cfg, logger.Named("badge"))
+	if err != nil {
+		return err
+	}
+	defer svc.db.Close()
+
+	result, clientErr := svc.badges.Import(context.Background(), catalogue)
+	if clientErr != nil {
+		return clientErr
+	}
+	return out.print(result, fmt.Sprintf("Imported %s: %d added, %d updated, %d unchanged",
+		*file, len(result.Created), len(result.Updated), len(result.Unchanged)))
+}
+
+func runBadgeExport(args []string) error {
+	flags, loader := newFlagSet("badge export", "Export the latest version of every badge, including retired badges, in the format accepted by `autocrat badge import`.")
+	file := flags.String("file", "", "File to write the catalogue to, as JSON or YAML by its extension. Written to stdout as JSON if not given.")
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+	format := badge.FormatJSON
+	if *file != "" {
+		if format, err = catalogueFormat(*file); err != nil {
+			return err
+		}
+	}
+
+	svc, err := openServices(cfg, logger.Named("badge"))
+	if err != nil {
+		return err
+	}
+	defer svc.db.Close()
+
+	catalogue, clientErr := svc.badges.Export(context.Background())
+	if clientErr != nil {
+		return clientErr
+	}
+	data, err := catalogue.Encode(format)
+	if err != nil {
+		return fmt.Errorf("failed to encode catalogue: %w", err)
+	}
+	if *file == "" {
+		_, err := fmt.Fprintln(os.Stdout, string(data))
+		return err
+	}
+	if err := ioutil.WriteFile(*file, data, 0644); err != nil {
+		return fmt.Errorf("failed to write catalogue: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d badges to %s\n", len(catalogue.Badges), *file)
+	return nil
+}
+
+// problemText describes what was wrong with each invalid field of a
+// problem, or the problem itself if it isn't about fields.
+func problemText(p *problem.Problem) string {
+	if len(p.Errors) == 0 {
+		return p.Error()
+	}
+	reasons := make([]string, 0, len(p.Errors))
+	for _, field := range p.Errors {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", field.Field, field.Message))
+	}
+	return strings.Join(reasons, "; ")
+}
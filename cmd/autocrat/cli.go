@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nick96/cubapi/config"
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/db/migrate"
+	"github.com/nick96/cubapi/migrations"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// newFlagSet creates the flag set of a command with the configuration flags
+// registered on it. The command's own flags should be added before parsing.
+func newFlagSet(name, description string) (*flag.FlagSet, *config.Loader) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: autocrat %s\n\n%s\n\nFlags:\n", name+" [flags]", description)
+		flags.PrintDefaults()
+	}
+	return flags, config.NewLoader(flags)
+}
+
+// load parses the command's arguments, then loads the configuration and
+// creates a logger from it.
+func load(flags *flag.FlagSet, loader *config.Loader, args []string) (config.Config, *zap.Logger, error) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return config.Config{}, nil, err
+		}
+		return config.Config{}, nil, usageError{err}
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return config.Config{}, nil, usageError{fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))}
+	}
+	cfg, err := loader.Load(os.LookupEnv)
+	if err != nil {
+		return cfg, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	logger, err := cfg.Log.NewLogger()
+	if err != nil {
+		return cfg, nil, fmt.Errorf("failed to create logger: %w", err)
+	}
+	return cfg, logger, nil
+}
+
+// connect connects to the database on the given host with the configured
+// credentials.
+func connect(cfg config.DB, host string, logger *zap.Logger) (*db.DB, error) {
+	handle, err := db.NewConn(logger, cfg.User, cfg.Password, cfg.Name, host, cfg.SSLMode)
+	if err != nil {
+		return nil, err
+	}
+	handle.SlowQueryThreshold = cfg.SlowQueryThreshold
+	return handle, nil
+}
+
+// applyMigrations brings the database schema up to date.
+func applyMigrations(handle *db.DB, logger *zap.Logger) error {
+	migrator := migrate.NewMigrator(handle.DB.DB, logger)
+	return migrator.Apply(migrations.All...)
+}
+
+// requireFlag returns a usage error if the flag wasn't given a value.
+func requireFlag(flags *flag.FlagSet, name, value string) error {
+	if strings.TrimSpace(value) == "" {
+		flags.Usage()
+		return usageError{fmt.Errorf("-%s is required", name)}
+	}
+	return nil
+}
+
+// output writes the results of commands, either as indented JSON for scripts
+// or as text for people.
+type output struct {
+	w    io.Writer
+	json bool
+}
+
+// addOutputFlags registers the -json flag on the flag set.
+func addOutputFlags(flags *flag.FlagSet) *output {
+	out := &output{w: os.Stdout}
+	flags.BoolVar(&out.json, "json", false, "Write the result as JSON.")
+	return out
+}
+
+// print writes value as JSON or the text, depending on the output format.
+func (o *output) print(value interface{}, text string) error {
+	if o.json {
+		encoder := json.NewEncoder(o.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	_, err := fmt.Fprintln(o.w, text)
+	return err
+}
+
+// readPassword reads a password from the first line of stdin if fromStdin is
+// set, otherwise it prompts for it if stdin is a terminal. Passwords are never
+// accepted as flags as they'd end up in the shell history and process list.
+func readPassword(stdin *os.File, fromStdin bool) (string, error) {
+	if fromStdin {
+		return readPasswordLine(stdin)
+	}
+	if !terminal.IsTerminal(int(stdin.Fd())) {
+		return "", usageError{errors.New("stdin is not a terminal, use -password-stdin to read the password from it")}
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := terminal.ReadPassword(int(stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return string(password), nil
+}
+
+// readPasswordLine reads the first line of r as a password.
+func readPasswordLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("no password was given on stdin")
+	}
+	return password, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nick96/cubapi/group"
+)
+
+var groupCommands = []command{
+	{"create", "Create a scout group.", runGroupCreate},
+	{"list", "List all groups.", runGroupList},
+	{"sign-up", "Open or close a group to sign up.", runGroupSignUp},
+}
+
+// runGroup runs a group subcommand.
+func runGroup(args []string) error {
+	return dispatch("autocrat group", groupCommands, args)
+}
+
+// addGroupFlag registers the -group flag of commands that act in a group.
+func addGroupFlag(flags *flag.FlagSet) *string {
+	return flags.String("group", "", "Slug of the group, see `autocrat group list`.")
+}
+
+// groupID finds the ID of the group with the slug. A missing group is a usage
+// error.
+func (s services) groupID(ctx context.Context, slug string) (int64, error) {
+	g, err := s.groups.FindGroup(ctx, slug)
+	if errors.Is(err, group.ErrNoSuchGroup) {
+		return 0, usageError{err}
+	} else if err != nil {
+		return 0, err
+	}
+	return g.Id, nil
+}
+
+// groupsText formats groups as a table.
+func groupsText(groups []group.Group) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSLUG\tNAME\tSELF SIGN UP")
+	for _, g := range groups {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%t\n", g.Id, g.Slug, g.Name, g.SelfSignUp)
+	}
+	w.Flush()
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+func runGroupCreate(args []string) error {
+	flags, loader := newFlagSet("group create", "Create a scout group. Its users are created with `autocrat user create` unless anyone can sign up to it by its slug.")
+	out := addOutputFlags(flags)
+	name := flags.String("name", "", "Name of the group, e.g. 1st Springfield.")
+	slug := flags.String("slug", "", "Slug of the group, e.g. 1st-springfield.")
+	selfSignUp := flags.Bool("self-sign-up", false, "Let anyone sign up to the group by its slug.")
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "name", *name); err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "slug", *slug); err != nil {
+		return err
+	}
+
+	svc, err := openServices(cfg, logger.Named("group"))
+	if err != nil {
+		return err
+	}
+	defer svc.db.Close()
+
+	created, clientErr := svc.groups.NewGroup(context.Background(), group.Group{Name: *name, Slug: *slug, SelfSignUp: *selfSignUp})
+	if clientErr != nil {
+		return clientErr
+	}
+	return out.print(created, fmt.Sprintf("Created group %s with ID %d", created.Slug, created.Id))
+}
+
+func runGroupList(args []string) error {
+	flags, loader := newFlagSet("group list", "List all groups.")
+	out := addOutputFlags(flags)
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+
+	svc, err := openServices(cfg, logger.Named("group"))
+	if err != nil {
+		return err
+	}
+	defer svc.db.Close()
+
+	groups, clientErr := svc.groups.ListGroups(context.Background())
+	if clientErr != nil {
+		return clientErr
+	}
+	return out.print(groups, groupsText(groups))
+}
+
+func runGroupSignUp(args []string) error {
+	flags, loader := newFlagSet("group sign-up", "Open or close a group to sign up. Anyone can sign up to an open group by its slug, so only open groups that expect it.")
+	out := addOutputFlags(flags)
+	groupSlug := addGroupFlag(flags)
+	open := flags.Bool("open", false, "Open the group to sign up, otherwise close it.")
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "group", *groupSlug); err != nil {
+		return err
+	}
+
+	svc, err := openServices(cfg, logger.Named("group"))
+	if err != nil {
+		return err
+	}
+	defer svc.db.Close()
+
+	ctx := context.Background()
+	groupID, err := svc.groupID(ctx, *groupSlug)
+	if err != nil {
+		return err
+	}
+	if clientErr := svc.groups.SetSelfSignUp(ctx, groupID, *open); clientErr != nil {
+		return clientErr
+	}
+	state := "Closed"
+	if *open {
+		state = "Opened"
+	}
+	return out.print(
+		map[string]interface{}{"slug": *groupSlug, "selfSignUp": *open},
+		fmt.Sprintf("%s group %s to sign up", state, *groupSlug),
+	)
+}
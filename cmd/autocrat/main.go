@@ -1,55 +1,105 @@
+// Command autocrat runs the autocrat service and administers its groups,
+// users, members and badge catalogue.
+//
+// Usage:
+//
+//	autocrat [serve] [flags]
+//	autocrat migrate [flags]
+//	autocrat group create|list [flags]
+//	autocrat user create|list|disable|set-password|grant-role [flags]
+//	autocrat token issue [flags]
+//	autocrat badge import|export [flags]
+//	autocrat member import [flags]
+//
+// Every command accepts the configuration flags, see `autocrat serve -help`.
 package main
 
 import (
-	"net/http"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"strings"
+)
 
-	_ "github.com/lib/pq"
+// command is a subcommand of the autocrat binary.
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
 
-	"github.com/go-chi/chi"
-	chimiddleware "github.com/go-chi/chi/middleware"
-	"github.com/nick96/cubapi/db"
-	"github.com/nick96/cubapi/db/migrate"
-	"github.com/nick96/cubapi/middleware"
-	"github.com/nick96/cubapi/monitor"
-	"github.com/nick96/cubapi/user"
-	"go.uber.org/zap"
-)
+var commands = []command{
+	{"serve", "Serve the API (the default command).", runServe},
+	{"migrate", "Apply database migrations.", runMigrate},
+	{"group", "Administer scout groups.", runGroup},
+	{"user", "Administer users.", runUser},
+	{"token", "Issue authentication tokens.", runToken},
+	{"badge", "Import and export the badge catalogue.", runBadge},
+	{"member", "Import rosters of members.", runMember},
+}
 
 func main() {
-	logger, _ := zap.NewDevelopment()
-	logger = logger.Named("user-service")
-
-	dbHandle, err := db.NewConn(
-		logger,
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASS"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_SSL_MODE"),
-	)
-	if err != nil {
-		logger.Fatal("Failed to connect to database", zap.Error(err))
+	if err := run(os.Args[1:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(exitCode(err))
 	}
+}
 
-	migrator := migrate.NewMigrator(dbHandle.DB, logger)
-	if err := migrator.Apply(Migrations...); err != nil {
-		logger.Fatal("Failed to initialise database", zap.Error(err))
+// run runs the command named by the first argument. Serving is the default so
+// the binary can still be run without arguments.
+func run(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runServe(args)
 	}
+	return dispatch("autocrat", commands, args)
+}
 
-	store := user.NewStore(dbHandle)
+// dispatch runs the command named by the first argument with the remaining
+// arguments.
+func dispatch(name string, commands []command, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		printCommands(os.Stderr, name, commands)
+		return flag.ErrHelp
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+	printCommands(os.Stderr, name, commands)
+	return usageError{fmt.Errorf("unknown command %q", strings.Join([]string{name, args[0]}, " "))}
+}
 
-	router := chi.NewRouter()
-	router.Use(chimiddleware.RequestID)
-	router.Use(chimiddleware.RealIP)
-	router.Use(middleware.Logger(logger))
-	router.Use(middleware.DefaultContentType(logger, "application/json"))
-	router.Use(middleware.CORSPreflight(logger))
+func printCommands(w io.Writer, name string, commands []command) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", name)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-14s %s\n", cmd.name, cmd.description)
+	}
+}
+
+// usageError is an error caused by invalid arguments.
+type usageError struct {
+	err error
+}
 
-	router.Route("/user", user.NewUserRouter(logger, store))
-	router.Route("/auth", user.NewAuthRouter(logger, store))
-	router.Route("/healthz", monitor.NewHealthRouter(logger, monitor.DBComponent{dbHandle}))
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
 
-	logger.Info("Successfully started user service")
-	logger.Fatal("Service exited with error", zap.Error(http.ListenAndServe(":8081", router)))
+// exitCode returns the exit code for the error. Usage errors exit with 2, like
+// the flag package, so scripts can tell them apart from failures.
+func exitCode(err error) int {
+	var usageErr usageError
+	if errors.As(err, &usageErr) || errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+	return 1
 }
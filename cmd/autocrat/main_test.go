@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nick96/cubapi/openapi"
+)
+
+func TestDispatch(t *testing.T) {
+	var ran []string
+	commands := []command{
+		{"a", "Command a.", func(args []string) error {
+			ran = append(ran, "a "+strings.Join(args, " "))
+			return nil
+		}},
+	}
+
+	if err := dispatch("test", commands, []string{"a", "-json"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 1 || ran[0] != "a -json" {
+		t.Fatalf("Expected command a to run with the remaining arguments, got %v", ran)
+	}
+
+	err := dispatch("test", commands, []string{"b"})
+	if exitCode(err) != 2 {
+		t.Fatalf("Expected an unknown command to be a usage error, got %v", err)
+	}
+	if err := dispatch("test", commands, nil); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("Expected no command to print help, got %v", err)
+	}
+}
+
+func TestReadPasswordLine(t *testing.T) {
+	password, err := readPasswordLine(strings.NewReader("hunter22\r\nignored\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password != "hunter22" {
+		t.Fatalf("Expected the first line without its line ending, got %q", password)
+	}
+	if _, err := readPasswordLine(strings.NewReader("")); err == nil {
+		t.Fatal("Expected an empty password to be an error")
+	}
+}
+
+func TestOutput(t *testing.T) {
+	var buf bytes.Buffer
+	out := &output{w: &buf, json: true}
+	if err := out.print(tokenResult{Token: "token"}, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"token": "token"`) {
+		t.Fatalf("Expected JSON output, got %s", buf.String())
+	}
+
+	buf.Reset()
+	out.json = false
+	if err := out.print(tokenResult{Token: "token"}, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "text\n" {
+		t.Fatalf("Expected text output, got %q", buf.String())
+	}
+}
+
+func TestSpecIsServed(t *testing.T) {
+	w := httptest.NewRecorder()
+	newSpec().Handler().ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Info    struct{ Version string }   `json:"info"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if spec.OpenAPI != openapi.Version || spec.Info.Version != apiVersion {
+		t.Errorf("Expected OpenAPI %s for API version %s, got %s and %s", openapi.Version, apiVersion, spec.OpenAPI, spec.Info.Version)
+	}
+	for _, path := range []string{"/user", "/user/me", "/auth", "/member", "/member/{memberID}"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("Expected %s to be described, got %v", path, spec.Paths)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/nick96/cubapi/member"
+)
+
+var memberCommands = []command{
+	{"import", "Import a roster of members.", runMemberImport},
+}
+
+// runMember runs a member subcommand.
+func runMember(args []string) error {
+	return dispatch("autocrat member", memberCommands, args)
+}
+
+// stringsFlag is a flag that can be given more than once.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// rosterFormat returns the format of a roster file by its extension.
+func rosterFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return member.RosterCSV, nil
+	case ".xlsx":
+		return member.RosterXLSX, nil
+	}
+	return "", usageError{fmt.Errorf("roster file %s must have a .csv or .xlsx extension", path)}
+}
+
+// importText formats the result of an import for people, with the errors of
+// each skipped row.
+func importText(file string, result member.ImportResult) string {
+	var buf bytes.Buffer
+	verb := "Imported"
+	if result.DryRun {
+		verb = "Checked (dry run)"
+	}
+	fmt.Fprintf(&buf, "%s %s: %d created, %d updated, %d unchanged, %d skipped",
+		verb, file, result.Created, result.Updated, result.Unchanged, result.Skipped)
+	for _, row := range result.Rows {
+		for _, rowErr := range row.Errors {
+			if rowErr.Field == "" {
+				fmt.Fprintf(&buf, "\n  row %d: %s", row.Row, rowErr.Message)
+			} else {
+				fmt.Fprintf(&buf, "\n  row %d: %s: %s", row.Row, rowErr.Field, rowErr.Message)
+			}
+		}
+	}
+	return buf.String()
+}
+
+func runMemberImport(args []string) error {
+	flags, loader := newFlagSet("member import", "Import a roster of members, such as an export of the national membership system. "+
+		"Rows are matched to members by membership number, or by name and date of birth for members without one. "+
+		"Rows with errors are skipped and reported, so fix them and import the roster again.")
+	out := addOutputFlags(flags)
+	groupSlug := addGroupFlag(flags)
+	file := flags.String("file", "", "Roster to import, as CSV or XLSX by its extension.")
+	sheet := flags.String("sheet", "", "Sheet of an XLSX roster to import, the first if not given.")
+	dryRun := flags.Bool("dry-run", false, "Report what would be imported without importing it.")
+	var columns stringsFlag
+	flags.Var(&columns, "column", fmt.Sprintf("Map a field (%s) to the header of its column, e.g. membershipNumber='Reg No'. Can be repeated.", strings.Join(member.RosterFields, ", ")))
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "group", *groupSlug); err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "file", *file); err != nil {
+		return err
+	}
+	format, err := rosterFormat(*file)
+	if err != nil {
+		return err
+	}
+	mapping, err := member.ParseColumnMapping(columns)
+	if err != nil {
+		return usageError{err}
+	}
+	data, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return usageError{fmt.Errorf("failed to read roster: %w", err)}
+	}
+	roster, invalid := member.ParseRoster(data, format, *sheet, mapping)
+	if invalid != nil {
+		return usageError{fmt.Errorf("invalid roster %s: %s", *file, problemText(invalid))}
+	}
+
+	svc, err := openServices(cfg, logger.Named("member"))
+	if err != nil {
+		return err
+	}
+	defer svc.db.Close()
+
+	ctx := context.Background()
+	groupID, err := svc.groupID(ctx, *groupSlug)
+	if err != nil {
+		return err
+	}
+	result, clientErr := svc.members.ImportRoster(ctx, groupID, roster, *dryRun)
+	if clientErr != nil {
+		return clientErr
+	}
+	return out.print(result, importText(*file, result))
+}
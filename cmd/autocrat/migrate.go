@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nick96/cubapi/migrations"
+)
+
+// migrateResult is the result of the migrate command.
+type migrateResult struct {
+	Version int `json:"version"`
+}
+
+// runMigrate applies any migrations that haven't been applied yet.
+func runMigrate(args []string) error {
+	flags, loader := newFlagSet("migrate", "Apply any database migrations that haven't been applied yet.")
+	out := addOutputFlags(flags)
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+	logger = logger.Named("migrate")
+
+	handle, err := connect(cfg.DB, cfg.DB.Host, logger)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer handle.Close()
+
+	if err := applyMigrations(handle, logger); err != nil {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+	version := migrations.All[len(migrations.All)-1].Version
+	return out.print(migrateResult{Version: version}, fmt.Sprintf("Database is at version %d", version))
+}
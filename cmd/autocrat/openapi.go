@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/nick96/cubapi/badge"
+	"github.com/nick96/cubapi/event"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/guardian"
+	"github.com/nick96/cubapi/meeting"
+	"github.com/nick96/cubapi/member"
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/progress"
+	"github.com/nick96/cubapi/recommend"
+	"github.com/nick96/cubapi/user"
+)
+
+// apiVersion is the version of the API described by /openapi.json. Bump the
+// major version for changes that break existing clients.
+const apiVersion = "1.0.0"
+
+// newSpec describes the public API. It must mount the same routers as
+// runServe.
+func newSpec() *openapi.Document {
+	spec := openapi.New("autocrat", apiVersion)
+	spec.Info.Description = "Scout groups, users, authentication, youth members, meetings and attendance, camps and other events, parents and guardians, the badge catalogue, badge progress and recommendations for the cubapi services. Everything but signing up and in, and the badge catalogue shared by every group, is scoped to the group of the authenticated user. Errors are application/problem+json documents with a stable code."
+	user.DescribeSecuritySchemes(spec)
+	spec.Route("/user", user.DescribeUserRouter)
+	spec.Route("/auth", user.DescribeAuthRouter)
+	spec.Route("/group", group.DescribeGroupRouter(user.Authenticated))
+	spec.Route("/member", member.DescribeMemberRouter)
+	spec.Route("/badge", badge.DescribeBadgeRouter)
+	spec.Route("/progress", progress.DescribeProgressRouter)
+	spec.Route("/recommend", recommend.DescribeRecommendRouter)
+	spec.Route("/meeting", meeting.DescribeMeetingRouter)
+	spec.Route("/event", event.DescribeEventRouter)
+	spec.Route("/guardian", guardian.DescribeGuardianRouter)
+	return spec
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/go-chi/chi"
+	"github.com/nick96/cubapi/badge"
+	"github.com/nick96/cubapi/config"
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/event"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/guardian"
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/meeting"
+	"github.com/nick96/cubapi/member"
+	"github.com/nick96/cubapi/middleware"
+	"github.com/nick96/cubapi/monitor"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/progress"
+	"github.com/nick96/cubapi/recommend"
+	"github.com/nick96/cubapi/server"
+	"github.com/nick96/cubapi/session"
+	"github.com/nick96/cubapi/tracing"
+	"github.com/nick96/cubapi/user"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// runServe runs the API until it receives SIGINT or SIGTERM. Migrations are
+// applied before serving.
+func runServe(args []string) error {
+	flags, loader := newFlagSet("serve", "Serve the API.")
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+	logger = logger.Named("user-service")
+	logging.SetDefault(logger)
+	logger.Info("Loaded configuration", zap.Any("config", cfg.Redacted()))
+
+	traceTarget := cfg.Tracing.OTLPEndpoint
+	if cfg.Tracing.Exporter == tracing.ExporterFile {
+		traceTarget = cfg.Tracing.File
+	}
+	traceExporter, err := tracing.NewExporter(context.Background(), cfg.Tracing.Exporter, traceTarget)
+	if err != nil {
+		logger.Fatal("Failed to create trace exporter", zap.Error(err))
+	}
+	tracerProvider := tracing.NewProvider("autocrat", traceExporter)
+	tracing.SetDefault(tracerProvider)
+
+	dbHandle, err := connect(cfg.DB, cfg.DB.Host, logger)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+
+	// Replicas are optional and only ever used for reads. They share the
+	// credentials of the primary.
+	var replicas []*db.DB
+	for _, host := range cfg.DB.ReplicaHosts {
+		replica, err := connect(cfg.DB, host, logger)
+		if err != nil {
+			logger.Fatal("Failed to connect to database replica", zap.String("host", host), zap.Error(err))
+		}
+		replicas = append(replicas, replica)
+	}
+	cluster := db.NewCluster(logger, dbHandle, replicas...)
+	cluster.MaxLag = cfg.DB.MaxReplicaLag
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cluster.Monitor(ctx, db.DefaultReplicaCheckInterval)
+
+	if err := applyMigrations(dbHandle, logger); err != nil {
+		logger.Fatal("Failed to initialise database", zap.Error(err))
+	}
+
+	store := user.NewStore(cluster)
+	authService := user.NewAuthService(store, user.AuthConfig{
+		JWTSecret:     cfg.Auth.JWTSecret,
+		JWTIssuer:     cfg.Auth.JWTIssuer,
+		TokenLifetime: cfg.Auth.TokenLifetime,
+	})
+	groupStore := group.NewStore(cluster)
+	groupService := group.NewGroupService(groupStore)
+	userService := user.NewUserService(store, groupStore)
+	location, err := cfg.Group.Location()
+	if err != nil {
+		logger.Fatal("Invalid group time zone", zap.Error(err))
+	}
+	memberService := member.NewMemberService(member.NewStore(cluster), location)
+	badgeStore := badge.NewStore(cluster)
+	badgeService := badge.NewBadgeService(badgeStore)
+	progressService := progress.NewProgressService(progress.NewStore(cluster), badgeStore, location)
+	recommendService := recommend.NewRecommendService(recommend.NewStore(cluster), badgeStore)
+	meetingService := meeting.NewMeetingService(meeting.NewStore(cluster), progressService, location)
+	eventService := event.NewEventService(event.NewStore(cluster), location)
+	guardianService := guardian.NewGuardianService(guardian.NewStore(cluster), progressService, meetingService, location)
+
+	// The default registry already collects Go runtime and process metrics.
+	prometheus.MustRegister(collectors.NewDBStatsCollector(dbHandle.DB.DB, "primary"))
+	for i, replica := range replicas {
+		prometheus.MustRegister(collectors.NewDBStatsCollector(replica.DB.DB, fmt.Sprintf("replica-%d", i)))
+	}
+
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.HTTP.TrustedProxies)
+	if err != nil {
+		logger.Fatal("Invalid trusted proxies", zap.Error(err))
+	}
+
+	router := chi.NewRouter()
+	router.Use(middleware.RequestID(trustedProxies))
+	router.Use(middleware.RealIP(trustedProxies))
+	router.Use(middleware.Tracing())
+	router.Use(middleware.Logger(logger))
+	router.Use(middleware.Metrics)
+	router.Use(middleware.Recoverer(logger))
+	router.Use(middleware.DefaultContentType(logger, "application/json"))
+	router.NotFound(problem.NotFound)
+	router.MethodNotAllowed(problem.MethodNotAllowed)
+
+	corsPolicy := middleware.CORSPolicy{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Request-ID", session.DefaultCSRFHeaderName},
+		ExposedHeaders:   []string{"X-Request-ID", "RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           cfg.CORS.MaxAge,
+	}
+	if err := corsPolicy.Validate(); err != nil {
+		logger.Fatal("Invalid CORS policy", zap.Error(err))
+	}
+
+	sessionConfig, err := sessionConfig(cfg.Session)
+	if err != nil {
+		logger.Fatal("Invalid session configuration", zap.Error(err))
+	}
+	sessions := session.NewManager(logger, sessionConfig, cfg.Auth.JWTSecret)
+
+	var limitStore middleware.RateLimitStore = middleware.NewMemoryRateLimitStore()
+	if cfg.RateLimit.Backend == "postgres" {
+		postgresStore := middleware.NewPostgresRateLimitStore(dbHandle)
+		go purgeRateLimits(ctx, logger, postgresStore, cfg.RateLimit)
+		limitStore = postgresStore
+	}
+	// Sign in and sign up are only limited by address as the client is, by
+	// definition, not signed in.
+	defaultLimiter := middleware.RateLimiter(logger, limitStore, "default", rateLimit(cfg.RateLimit.Default), clientKey(sessions, authService))
+	signInLimiter := middleware.RateLimiter(logger, limitStore, "sign_in", rateLimit(cfg.RateLimit.SignIn), middleware.KeyByIP)
+	signUpLimiter := middleware.RateLimiter(logger, limitStore, "sign_up", rateLimit(cfg.RateLimit.SignUp), middleware.KeyByIP)
+
+	router.
+		With(middleware.CORS(logger, corsPolicy.WithMethods(http.MethodGet, http.MethodPost)), defaultLimiter).
+		Route("/user", user.NewUserRouter(logger, userService, authService, sessions, signUpLimiter))
+	router.
+		With(middleware.CORS(logger, corsPolicy.WithMethods(http.MethodPost, http.MethodDelete)), defaultLimiter).
+		Route("/auth", user.NewAuthRouter(logger, authService, sessions, signInLimiter))
+	// Everything behind authentication is scoped to the group of the
+	// authenticated user.
+	authenticate := user.Authenticate(logger, userService, authService, sessions)
+	router.
+		With(
+			middleware.CORS(logger, corsPolicy.WithMethods(http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)),
+			defaultLimiter,
+			sessions.CSRF,
+			authenticate,
+		).
+		Route("/group", group.NewGroupRouter(logger, groupService, user.RequireRole(user.RoleAdmin)))
+	router.
+		With(
+			middleware.CORS(logger, corsPolicy.WithMethods(http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)),
+			defaultLimiter,
+			sessions.CSRF,
+			authenticate,
+			user.RequireRole(user.RoleAdmin, user.RoleLeader),
+		).
+		Route("/member", member.NewMemberRouter(logger, memberService))
+	router.
+		With(
+			middleware.CORS(logger, corsPolicy.WithMethods(http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)),
+			defaultLimiter,
+			sessions.CSRF,
+			authenticate,
+		).
+		Route("/badge", badge.NewBadgeRouter(logger, badgeService, user.RequireRole(user.RoleProgram)))
+	router.
+		With(
+			middleware.CORS(logger, corsPolicy.WithMethods(http.MethodGet, http.MethodPost)),
+			defaultLimiter,
+			sessions.CSRF,
+			authenticate,
+			user.RequireRole(user.RoleAdmin, user.RoleLeader),
+		).
+		Route("/progress", progress.NewProgressRouter(logger, progressService))
+	router.
+		With(
+			middleware.CORS(logger, corsPolicy.WithMethods(http.MethodGet, http.MethodPost)),
+			defaultLimiter,
+			sessions.CSRF,
+			authenticate,
+			user.RequireRole(user.RoleAdmin, user.RoleLeader),
+		).
+		Route("/recommend", recommend.NewRecommendRouter(logger, recommendService))
+	router.
+		With(
+			middleware.CORS(logger, corsPolicy.WithMethods(http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)),
+			defaultLimiter,
+			sessions.CSRF,
+			authenticate,
+			user.RequireRole(user.RoleAdmin, user.RoleLeader),
+		).
+		Route("/meeting", meeting.NewMeetingRouter(logger, meetingService))
+	router.
+		With(
+			middleware.CORS(logger, corsPolicy.WithMethods(http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)),
+			defaultLimiter,
+			sessions.CSRF,
+			authenticate,
+			user.RequireRole(user.RoleAdmin, user.RoleLeader),
+		).
+		Route("/event", event.NewEventRouter(logger, eventService))
+	router.
+		With(
+			middleware.CORS(logger, corsPolicy.WithMethods(http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)),
+			defaultLimiter,
+			sessions.CSRF,
+			authenticate,
+		).
+		Route("/guardian", guardian.NewGuardianRouter(logger, guardianService, user.RequireRole(user.RoleAdmin, user.RoleLeader)))
+	router.
+		With(middleware.CORS(logger, corsPolicy.WithMethods(http.MethodGet))).
+		Method(http.MethodGet, "/openapi.json", newSpec().Handler())
+	checker := monitor.NewChecker(
+		logger,
+		monitor.DBComponent{DB: dbHandle.DB},
+		monitor.ReplicasComponent{Cluster: cluster},
+	)
+	router.Route("/healthz", checker.Router())
+
+	// The admin listener serves internal endpoints, like metrics, that
+	// shouldn't be publicly accessible. It never serves TLS as it should
+	// only be reachable from inside the cluster.
+	adminRouter := chi.NewRouter()
+	adminRouter.Method(http.MethodGet, "/metrics", promhttp.Handler())
+	adminConfig := serverConfig(cfg.HTTP)
+	adminConfig.Addr = cfg.HTTP.AdminAddr
+	adminConfig.TLSCertFile, adminConfig.TLSKeyFile = "", ""
+	adminServer, err := server.New(logger, "admin", adminConfig, adminRouter)
+	if err != nil {
+		logger.Fatal("Failed to create admin server", zap.Error(err))
+	}
+
+	publicServer, err := server.New(logger, "public", serverConfig(cfg.HTTP), router)
+	if err != nil {
+		logger.Fatal("Failed to create public server", zap.Error(err))
+	}
+
+	serveErrs := make(chan error, 2)
+	for _, srv := range []*server.Server{adminServer, publicServer} {
+		go func(srv *server.Server) {
+			serveErrs <- srv.ListenAndServe(ctx)
+		}(srv)
+	}
+	logger.Info("Successfully started user service", zap.String("addr", cfg.HTTP.Addr))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case sig := <-signals:
+		logger.Info("Received signal, shutting down", zap.String("signal", sig.String()))
+	case err := <-serveErrs:
+		logger.Error("Server exited with error, shutting down", zap.Error(err))
+	}
+
+	// Shut down in order: stop being ready so load balancers stop sending
+	// requests, drain the public API, then the admin listener so metrics can
+	// be scraped while draining, and finally release the database once
+	// nothing can use it.
+	checker.Drain()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer shutdownCancel()
+	publicServer.Shutdown(shutdownCtx)
+	adminServer.Shutdown(shutdownCtx)
+	cancel()
+	if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("Failed to flush traces", zap.Error(err))
+	}
+	if err := cluster.Close(); err != nil {
+		logger.Warn("Failed to close database connections", zap.Error(err))
+	}
+	logger.Info("Shut down user service")
+	return nil
+}
+
+// serverConfig builds the public server config from the service config.
+func serverConfig(cfg config.HTTP) server.Config {
+	return server.Config{
+		Addr:              cfg.Addr,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		TLSCertFile:       cfg.TLSCertFile,
+		TLSKeyFile:        cfg.TLSKeyFile,
+		TLSReloadInterval: cfg.TLSReloadInterval,
+	}
+}
+
+// clientKey identifies the clients the default rate limit applies to. Signed
+// in users are limited by who they are, so users behind a shared address
+// don't use each other's limit, and everyone else by their address. Only
+// authenticated identities are used, anything else the client sends could be
+// changed on each request to get a fresh limit.
+func clientKey(sessions *session.Manager, authService user.AuthService) middleware.KeyFunc {
+	return middleware.FirstKey(
+		middleware.KeyByUser(func(r *http.Request) (string, bool) {
+			token, _ := sessions.Token(r)
+			if token == "" {
+				return "", false
+			}
+			validated, err := authService.ValidateToken(token)
+			if err != nil {
+				return "", false
+			}
+			return validated.Email, true
+		}),
+		middleware.KeyByIP,
+	)
+}
+
+// rateLimit converts a configured rate to a rate limit.
+func rateLimit(rate config.Rate) middleware.RateLimit {
+	return middleware.RateLimit{Limit: rate.Limit, Period: rate.Period}
+}
+
+// rateLimitPurgeInterval is how often refilled buckets are removed from the
+// Postgres rate limit store.
+const rateLimitPurgeInterval = 10 * time.Minute
+
+// purgeRateLimits periodically removes buckets that have refilled from the
+// Postgres store until the context is cancelled. Buckets are kept for the
+// longest configured period as they may still be partially empty until then.
+func purgeRateLimits(ctx context.Context, logger *zap.Logger, store middleware.PostgresRateLimitStore, cfg config.RateLimit) {
+	olderThan := rateLimitPurgeInterval
+	for _, rate := range []config.Rate{cfg.Default, cfg.SignIn, cfg.SignUp} {
+		if rate.Period > olderThan {
+			olderThan = rate.Period
+		}
+	}
+	ticker := time.NewTicker(rateLimitPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := store.Purge(ctx, olderThan)
+			if err != nil {
+				logger.Warn("Failed to purge rate limits", zap.Error(err))
+				continue
+			}
+			logger.Debug("Purged rate limits", zap.Int64("purged", purged))
+		}
+	}
+}
+
+// sessionConfig builds the session cookie config from the service config,
+// using the secure defaults for anything that isn't configurable.
+func sessionConfig(cfg config.Session) (session.Config, error) {
+	sessionConfig := session.DefaultConfig()
+	sessionConfig.Domain = cfg.CookieDomain
+	sessionConfig.Secure = cfg.CookieSecure
+	sessionConfig.Lifetime = cfg.Lifetime
+	sameSite, err := session.ParseSameSite(cfg.CookieSameSite)
+	if err != nil {
+		return sessionConfig, err
+	}
+	sessionConfig.SameSite = sameSite
+	return sessionConfig, sessionConfig.Validate()
+}
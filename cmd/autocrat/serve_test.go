@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nick96/cubapi/middleware"
+	"github.com/nick96/cubapi/session"
+	"github.com/nick96/cubapi/user"
+	"go.uber.org/zap"
+)
+
+func TestDefaultRateLimitIgnoresUnauthenticatedKeys(t *testing.T) {
+	authService := user.NewAuthService(nil, user.AuthConfig{JWTSecret: "secret"})
+	sessions := session.NewManager(zap.NewNop(), session.DefaultConfig(), "secret")
+	limiter := middleware.RateLimiter(
+		zap.NewNop(), middleware.NewMemoryRateLimitStore(), "default",
+		middleware.RateLimit{Limit: 2, Period: time.Minute}, clientKey(sessions, authService),
+	)
+	handler := limiter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	do := func(header, value string) int {
+		r := httptest.NewRequest("GET", "/member", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := do("X-API-Key", fmt.Sprintf("random-%d", i)); code != http.StatusOK {
+			t.Fatalf("Expected request %d to be allowed, got %d", i, code)
+		}
+	}
+	if code := do("X-API-Key", "random-2"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected a new API key not to get a new limit, got %d", code)
+	}
+	if code := do("Authorization", "Bearer forged"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected an invalid token not to get a new limit, got %d", code)
+	}
+
+	token, err := authService.GetToken(context.Background(), user.User{Email: "akela@test.com", GroupId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := do("Authorization", "Bearer "+token); code != http.StatusOK {
+		t.Errorf("Expected a signed in user to have their own limit, got %d", code)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var tokenCommands = []command{
+	{"issue", "Issue a token for a user.", runTokenIssue},
+}
+
+// runToken runs a token subcommand.
+func runToken(args []string) error {
+	return dispatch("autocrat token", tokenCommands, args)
+}
+
+// tokenResult is the result of the token issue command.
+type tokenResult struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func runTokenIssue(args []string) error {
+	flags, loader := newFlagSet("token issue", "Issue a token for a user, e.g. for a script that calls the API on their behalf.")
+	out := addOutputFlags(flags)
+	groupSlug := addGroupFlag(flags)
+	email := flags.String("email", "", "Email of the user.")
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "email", *email); err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "group", *groupSlug); err != nil {
+		return err
+	}
+	svc, err := openServices(cfg, logger.Named("token"))
+	if err != nil {
+		return err
+	}
+	defer svc.db.Close()
+
+	ctx := context.Background()
+	groupID, err := svc.groupID(ctx, *groupSlug)
+	if err != nil {
+		return err
+	}
+	u, clientErr := svc.users.GetUser(ctx, groupID, *email)
+	if clientErr != nil {
+		return userError(clientErr)
+	}
+	if u.Disabled {
+		return usageError{fmt.Errorf("user %s is disabled", u.Email)}
+	}
+	token, clientErr := svc.auth.GetToken(ctx, u)
+	if clientErr != nil {
+		return clientErr
+	}
+	expiresAt := time.Now().Add(cfg.Auth.TokenLifetime).UTC().Truncate(time.Second)
+	return out.print(tokenResult{Token: token, ExpiresAt: expiresAt}, token)
+}
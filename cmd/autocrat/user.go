@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nick96/cubapi/badge"
+	"github.com/nick96/cubapi/config"
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/member"
+	"github.com/nick96/cubapi/user"
+	"go.uber.org/zap"
+)
+
+var userCommands = []command{
+	{"create", "Create a user.", runUserCreate},
+	{"list", "List the users of a group.", runUserList},
+	{"disable", "Stop a user from signing in.", runUserDisable},
+	{"set-password", "Replace a user's password.", runUserSetPassword},
+	{"grant-role", "Grant a role to a user.", runUserGrantRole},
+}
+
+// runUser runs a user subcommand.
+func runUser(args []string) error {
+	return dispatch("autocrat user", userCommands, args)
+}
+
+// services are the services administrative commands are run through, so they
+// apply the same rules as the API.
+type services struct {
+	db      *db.DB
+	groups  group.GroupService
+	users   user.UserService
+	auth    user.AuthService
+	badges  badge.BadgeService
+	members member.MemberService
+}
+
+// openServices connects to the database and creates the services backed by
+// it. Migrations are applied first so commands can be run against a fresh
+// database, e.g. to create the first admin.
+func openServices(cfg config.Config, logger *zap.Logger) (services, error) {
+	handle, err := connect(cfg.DB, cfg.DB.Host, logger)
+	if err != nil {
+		return services{}, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := applyMigrations(handle, logger); err != nil {
+		handle.Close()
+		return services{}, fmt.Errorf("failed to apply migrations: %w", err)
+	}
+	location, err := cfg.Group.Location()
+	if err != nil {
+		handle.Close()
+		return services{}, fmt.Errorf("invalid group time zone: %w", err)
+	}
+	// Commands only ever talk to the primary.
+	cluster := db.NewCluster(logger, handle)
+	store := user.NewStore(cluster)
+	groupStore := group.NewStore(cluster)
+	return services{
+		db:     handle,
+		groups: group.NewGroupService(groupStore),
+		users:  user.NewUserService(store, groupStore),
+		auth: user.NewAuthService(store, user.AuthConfig{
+			JWTSecret:     cfg.Auth.JWTSecret,
+			JWTIssuer:     cfg.Auth.JWTIssuer,
+			TokenLifetime: cfg.Auth.TokenLifetime,
+		}),
+		badges:  badge.NewBadgeService(badge.NewStore(cluster)),
+		members: member.NewMemberService(member.NewStore(cluster), location),
+	}, nil
+}
+
+// userText formats a user for people.
+func userText(u user.User) string {
+	roles := strings.Join(u.Roles, ",")
+	if roles == "" {
+		roles = "-"
+	}
+	return fmt.Sprintf("%d\t%s\t%s %s\t%s\t%t", u.Id, u.Email, u.FirstName, u.LastName, roles, u.Disabled)
+}
+
+// usersText formats users as a table.
+func usersText(users []user.User) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tNAME\tROLES\tDISABLED")
+	for _, u := range users {
+		fmt.Fprintln(w, userText(u))
+	}
+	w.Flush()
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+func runUserCreate(args []string) error {
+	flags, loader := newFlagSet("user create", "Create a user. The password is prompted for, or read from stdin with -password-stdin.")
+	out := addOutputFlags(flags)
+	groupSlug := addGroupFlag(flags)
+	email := flags.String("email", "", "Email of the user.")
+	firstName := flags.String("first-name", "", "First name of the user.")
+	lastName := flags.String("last-name", "", "Last name of the user.")
+	roles := flags.String("roles", "", "Comma separated roles to grant the user, e.g. admin.")
+	passwordStdin := flags.Bool("password-stdin", false, "Read the password from stdin.")
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+	for _, required := range []struct{ name, value string }{
+		{"email", *email},
+		{"first-name", *firstName},
+		{"last-name", *lastName},
+		{"group", *groupSlug},
+	} {
+		if err := requireFlag(flags, required.name, required.value); err != nil {
+			return err
+		}
+	}
+	var grantRoles []string
+	for _, role := range strings.Split(*roles, ",") {
+		if role = strings.TrimSpace(role); role == "" {
+			continue
+		}
+		if !user.IsRole(role) {
+			return usageError{fmt.Errorf("unknown role %s, expected one of %s", role, strings.Join(user.Roles, ", "))}
+		}
+		grantRoles = append(grantRoles, role)
+	}
+
+	password, err := readPassword(os.Stdin, *passwordStdin)
+	if err != nil {
+		return err
+	}
+	request := user.UserRequest{Email: *email, FirstName: *firstName, LastName: *lastName, Password: password, Group: *groupSlug}
+	if err := request.Validate(); err != nil {
+		return usageError{fmt.Errorf("invalid user: %w", err)}
+	}
+
+	svc, err := openServices(cfg, logger.Named("user"))
+	if err != nil {
+		return err
+	}
+	defer svc.db.Close()
+
+	ctx := context.Background()
+	groupID, err := svc.groupID(ctx, request.Group)
+	if err != nil {
+		return err
+	}
+	created, clientErr := svc.users.NewUser(ctx, user.User{
+		Email:     request.Email,
+		FirstName: request.FirstName,
+		LastName:  request.LastName,
+		Password:  request.Password,
+		GroupId:   groupID,
+	})
+	if clientErr != nil {
+		return clientErr
+	}
+	for _, role := range grantRoles {
+		if err := svc.users.GrantRole(ctx, groupID, created.Email, role); err != nil {
+			return err
+		}
+		created.Roles = append(created.Roles, role)
+	}
+	return out.print(created, fmt.Sprintf("Created user %s with ID %d", created.Email, created.Id))
+}
+
+func runUserList(args []string) error {
+	flags, loader := newFlagSet("user list", "List the users of a group.")
+	out := addOutputFlags(flags)
+	groupSlug := addGroupFlag(flags)
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "group", *groupSlug); err != nil {
+		return err
+	}
+
+	svc, err := openServices(cfg, logger.Named("user"))
+	if err != nil {
+		return err
+	}
+	defer svc.db.Close()
+
+	ctx := context.Background()
+	groupID, err := svc.groupID(ctx, *groupSlug)
+	if err != nil {
+		return err
+	}
+	users, clientErr := svc.users.ListUsers(ctx, groupID)
+	if clientErr != nil {
+		return clientErr
+	}
+	if users == nil {
+		users = []user.User{}
+	}
+	return out.print(users, usersText(users))
+}
+
+func runUserDisable(args []string) error {
+	flags, loader := newFlagSet("user disable", "Stop a user from signing in. Tokens they've already been issued stop working too.")
+	out := addOutputFlags(flags)
+	groupSlug := addGroupFlag(flags)
+	email := flags.String("email", "", "Email of the user.")
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "email", *email); err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "group", *groupSlug); err != nil {
+		return err
+	}
+
+	svc, err := openServices(cfg, logger.Named("user"))
+	if err != nil {
+		return err
+	}
+	defer svc.db.Close()
+
+	ctx := context.Background()
+	groupID, err := svc.groupID(ctx, *groupSlug)
+	if err != nil {
+		return err
+	}
+	if err := svc.users.DisableUser(ctx, groupID, *email); err != nil {
+		return userError(err)
+	}
+	return out.print(map[string]interface{}{"email": *email, "disabled": true}, fmt.Sprintf("Disabled user %s", *email))
+}
+
+func runUserSetPassword(args []string) error {
+	flags, loader := newFlagSet("user set-password", "Replace a user's password. The password is prompted for, or read from stdin with -password-stdin.")
+	out := addOutputFlags(flags)
+	groupSlug := addGroupFlag(flags)
+	email := flags.String("email", "", "Email of the user.")
+	passwordStdin := flags.Bool("password-stdin", false, "Read the password from stdin.")
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "email", *email); err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "group", *groupSlug); err != nil {
+		return err
+	}
+
+	password, err := readPassword(os.Stdin, *passwordStdin)
+	if err != nil {
+		return err
+	}
+	svc, err := openServices(cfg, logger.Named("user"))
+	if err != nil {
+		return err
+	}
+	defer svc.db.Close()
+
+	ctx := context.Background()
+	groupID, err := svc.groupID(ctx, *groupSlug)
+	if err != nil {
+		return err
+	}
+	if err := svc.users.SetPassword(ctx, groupID, *email, password); err != nil {
+		return userError(err)
+	}
+	return out.print(map[string]interface{}{"email": *email}, fmt.Sprintf("Set password of user %s", *email))
+}
+
+func runUserGrantRole(args []string) error {
+	flags, loader := newFlagSet("user grant-role", fmt.Sprintf("Grant a role (%s) to a user.", strings.Join(user.Roles, ", ")))
+	out := addOutputFlags(flags)
+	groupSlug := addGroupFlag(flags)
+	email := flags.String("email", "", "Email of the user.")
+	role := flags.String("role", "", "Role to grant.")
+	cfg, logger, err := load(flags, loader, args)
+	if err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "email", *email); err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "group", *groupSlug); err != nil {
+		return err
+	}
+	if err := requireFlag(flags, "role", *role); err != nil {
+		return err
+	}
+
+	svc, err := openServices(cfg, logger.Named("user"))
+	if err != nil {
+		return err
+	}
+	defer svc.db.Close()
+
+	ctx := context.Background()
+	groupID, err := svc.groupID(ctx, *groupSlug)
+	if err != nil {
+		return err
+	}
+	if err := svc.users.GrantRole(ctx, groupID, *email, *role); err != nil {
+		return userError(err)
+	}
+	return out.print(map[string]interface{}{"email": *email, "role": *role}, fmt.Sprintf("Granted role %s to user %s", *role, *email))
+}
+
+// userError reports a missing user as such rather than a generic failure.
+func userError(err error) error {
+	if errors.Is(err, user.ErrNoSuchUser) {
+		return usageError{err}
+	}
+	return err
+}
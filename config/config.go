@@ -0,0 +1,543 @@
+// Package config loads the configuration of the autocrat service.
+//
+// Settings are loaded from (in increasing order of precedence) their defaults,
+// an optional YAML or TOML config file, environment variables and command line
+// flags. Each setting is a field of Config tagged with its key in the config
+// file, e.g. `config:"host"` in the `config:"db"` section is `db.host`, and the
+// environment variable it's read from. Its flag is the key with dots replaced
+// by dashes, e.g. `-db-host`.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// FileEnv is the environment variable holding the path of the config
+	// file. The -config flag takes precedence over it.
+	FileEnv = "AUTOCRAT_CONFIG"
+
+	redacted = "********"
+)
+
+// Config is the configuration of the autocrat service.
+type Config struct {
+	Log       Log       `config:"log"`
+	HTTP      HTTP      `config:"http"`
+	DB        DB        `config:"db"`
+	Auth      Auth      `config:"auth"`
+	Session   Session   `config:"session"`
+	CORS      CORS      `config:"cors"`
+	Tracing   Tracing   `config:"tracing"`
+	RateLimit RateLimit `config:"rate_limit"`
+	Group     Group     `config:"group"`
+}
+
+// Log configures logging.
+type Log struct {
+	Level  string `config:"level" env:"LOG_LEVEL" usage:"Minimum log level (debug, info, warn or error)."`
+	Format string `config:"format" env:"LOG_FORMAT" usage:"Log format (json or console)."`
+}
+
+// HTTP configures the HTTP listeners.
+type HTTP struct {
+	Addr      string `config:"addr" env:"HTTP_ADDR" usage:"Address the public API listens on."`
+	AdminAddr string `config:"admin_addr" env:"ADMIN_ADDR" usage:"Address the admin listener (metrics) listens on."`
+
+	ReadTimeout       time.Duration `config:"read_timeout" env:"HTTP_READ_TIMEOUT" usage:"Maximum duration for reading an entire request."`
+	ReadHeaderTimeout time.Duration `config:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" usage:"Maximum duration for reading request headers."`
+	WriteTimeout      time.Duration `config:"write_timeout" env:"HTTP_WRITE_TIMEOUT" usage:"Maximum duration for writing a response."`
+	IdleTimeout       time.Duration `config:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" usage:"Maximum time to wait for the next request on a keep-alive connection."`
+	ShutdownTimeout   time.Duration `config:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT" usage:"Time in-flight requests have to complete on shutdown."`
+
+	TrustedProxies []string `config:"trusted_proxies" env:"HTTP_TRUSTED_PROXIES" usage:"Comma separated IPs or CIDR ranges of proxies whose X-Request-ID and X-Forwarded-For headers are believed."`
+
+	TLSCertFile       string        `config:"tls_cert_file" env:"TLS_CERT_FILE" usage:"PEM encoded certificate to serve the public API over TLS with."`
+	TLSKeyFile        string        `config:"tls_key_file" env:"TLS_KEY_FILE" usage:"PEM encoded private key of the TLS certificate."`
+	TLSReloadInterval time.Duration `config:"tls_reload_interval" env:"TLS_RELOAD_INTERVAL" usage:"How often the TLS certificate files are checked for changes."`
+}
+
+// DB configures the database connections.
+type DB struct {
+	User               string        `config:"user" env:"DB_USER" usage:"Database user."`
+	Password           string        `config:"password" env:"DB_PASS" secret:"true" usage:"Database password."`
+	Name               string        `config:"name" env:"DB_NAME" usage:"Database name."`
+	Host               string        `config:"host" env:"DB_HOST" usage:"Database primary host."`
+	SSLMode            string        `config:"ssl_mode" env:"DB_SSL_MODE" usage:"Database SSL mode."`
+	ReplicaHosts       []string      `config:"replica_hosts" env:"DB_REPLICA_HOSTS" usage:"Comma separated read replica hosts."`
+	MaxReplicaLag      time.Duration `config:"max_replica_lag" env:"DB_MAX_REPLICA_LAG" usage:"Replication lag above which a replica isn't read from."`
+	SlowQueryThreshold time.Duration `config:"slow_query_threshold" env:"DB_SLOW_QUERY_THRESHOLD" usage:"Duration after which a query is logged as slow."`
+}
+
+// Auth configures authentication.
+type Auth struct {
+	JWTSecret     string        `config:"jwt_secret" env:"JWT_SECRET" secret:"true" usage:"Secret used to sign JWTs."`
+	JWTIssuer     string        `config:"jwt_issuer" env:"JWT_ISSUER" usage:"Issuer of JWTs."`
+	TokenLifetime time.Duration `config:"token_lifetime" env:"JWT_LIFETIME" usage:"How long JWTs are valid for."`
+}
+
+// Session configures the session cookies.
+type Session struct {
+	CookieDomain   string        `config:"cookie_domain" env:"SESSION_COOKIE_DOMAIN" usage:"Domain the session cookies are set for."`
+	CookieSecure   bool          `config:"cookie_secure" env:"SESSION_COOKIE_SECURE" usage:"Restrict session cookies to HTTPS."`
+	CookieSameSite string        `config:"cookie_same_site" env:"SESSION_COOKIE_SAMESITE" usage:"SameSite attribute of the session cookies (lax, strict or none)."`
+	Lifetime       time.Duration `config:"lifetime" env:"SESSION_LIFETIME" usage:"How long session cookies last."`
+}
+
+// CORS configures cross-origin resource sharing.
+type CORS struct {
+	AllowedOrigins []string      `config:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" usage:"Comma separated origins allowed to make cross-origin requests."`
+	MaxAge         time.Duration `config:"max_age" env:"CORS_MAX_AGE" usage:"How long browsers can cache preflight responses."`
+}
+
+// Group configures the scout group the service is run for.
+type Group struct {
+	TimeZone string `config:"time_zone" env:"GROUP_TIME_ZONE" usage:"IANA time zone of the group, it decides which day it is for dates like when members join."`
+}
+
+// Location returns the group's time zone.
+func (g Group) Location() (*time.Location, error) {
+	return time.LoadLocation(g.TimeZone)
+}
+
+// Tracing configures distributed tracing.
+type Tracing struct {
+	Exporter     string `config:"exporter" env:"TRACING_EXPORTER" usage:"Trace exporter (none, stdout, file or otlp)."`
+	File         string `config:"file" env:"TRACING_FILE" usage:"File spans are written to by the file exporter."`
+	OTLPEndpoint string `config:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT" usage:"Collector traces endpoint used by the otlp exporter."`
+}
+
+// RateLimit configures rate limiting. Limits are given as the number of
+// requests allowed per period, e.g. "5/1m", or "off".
+type RateLimit struct {
+	Backend string `config:"backend" env:"RATE_LIMIT_BACKEND" usage:"Where rate limits are kept (memory or postgres). Use postgres with more than one replica."`
+	Default Rate   `config:"default" env:"RATE_LIMIT_DEFAULT" usage:"Rate limit of each client across the API."`
+	SignIn  Rate   `config:"sign_in" env:"RATE_LIMIT_SIGN_IN" usage:"Rate limit of sign in attempts by each client."`
+	SignUp  Rate   `config:"sign_up" env:"RATE_LIMIT_SIGN_UP" usage:"Rate limit of user creation by each client."`
+}
+
+// Rate is a number of requests allowed per period.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// ParseRate parses a rate given as "<limit>/<period>", e.g. "5/1m". The
+// period can omit its number, e.g. "5/m". "off" is the zero rate, which
+// doesn't limit anything.
+func ParseRate(value string) (Rate, error) {
+	value = strings.TrimSpace(value)
+	if value == "off" || value == "" {
+		return Rate{}, nil
+	}
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("rate %q must be <limit>/<period>, e.g. 5/1m", value)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit <= 0 {
+		return Rate{}, fmt.Errorf("rate %q must have a positive limit", value)
+	}
+	period := strings.TrimSpace(parts[1])
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	parsed, err := time.ParseDuration(period)
+	if err != nil || parsed <= 0 {
+		return Rate{}, fmt.Errorf("rate %q must have a positive period", value)
+	}
+	return Rate{Limit: limit, Period: parsed}, nil
+}
+
+// String formats the rate so it can be parsed by ParseRate.
+func (r Rate) String() string {
+	if r.Limit <= 0 || r.Period <= 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", r.Limit, r.Period)
+}
+
+// Default returns the default configuration. Secrets and connection details
+// have no defaults.
+func Default() Config {
+	return Config{
+		Log: Log{
+			Level:  "info",
+			Format: "json",
+		},
+		HTTP: HTTP{
+			Addr:              ":8081",
+			AdminAddr:         ":9091",
+			ReadTimeout:       10 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   20 * time.Second,
+			TLSReloadInterval: time.Minute,
+		},
+		DB: DB{
+			SSLMode:            "require",
+			MaxReplicaLag:      5 * time.Second,
+			SlowQueryThreshold: 200 * time.Millisecond,
+		},
+		Auth: Auth{
+			TokenLifetime: 24 * time.Hour,
+		},
+		Session: Session{
+			CookieSecure:   true,
+			CookieSameSite: "lax",
+			Lifetime:       24 * time.Hour,
+		},
+		CORS: CORS{
+			AllowedOrigins: []string{"http://localhost:8080", "http://localhost:3000"},
+			MaxAge:         10 * time.Minute,
+		},
+		Tracing: Tracing{
+			Exporter: "none",
+		},
+		RateLimit: RateLimit{
+			Backend: "memory",
+			Default: Rate{Limit: 300, Period: time.Minute},
+			SignIn:  Rate{Limit: 10, Period: time.Minute},
+			SignUp:  Rate{Limit: 5, Period: time.Hour},
+		},
+		Group: Group{
+			TimeZone: "Australia/Melbourne",
+		},
+	}
+}
+
+// setting is a single configurable value.
+type setting struct {
+	key    string
+	env    string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+func (s setting) flagName() string {
+	return strings.Replace(strings.Replace(s.key, ".", "-", -1), "_", "-", -1)
+}
+
+// set parses the string and sets the setting to it.
+func (s setting) set(raw string) error {
+	switch s.value.Interface().(type) {
+	case string:
+		s.value.SetString(raw)
+	case bool:
+		parsed, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%s must be a boolean: %w", s.key, err)
+		}
+		s.value.SetBool(parsed)
+	case time.Duration:
+		parsed, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%s must be a duration: %w", s.key, err)
+		}
+		s.value.SetInt(int64(parsed))
+	case int:
+		parsed, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%s must be an integer: %w", s.key, err)
+		}
+		s.value.SetInt(int64(parsed))
+	case Rate:
+		parsed, err := ParseRate(raw)
+		if err != nil {
+			return fmt.Errorf("%s is invalid: %w", s.key, err)
+		}
+		s.value.Set(reflect.ValueOf(parsed))
+	case []string:
+		var values []string
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		s.value.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("%s has unsupported type %s", s.key, s.value.Type())
+	}
+	return nil
+}
+
+// String formats the setting's current value, redacting secrets.
+func (s setting) String() string {
+	var formatted string
+	switch v := s.value.Interface().(type) {
+	case []string:
+		formatted = strings.Join(v, ",")
+	default:
+		formatted = fmt.Sprint(v)
+	}
+	if s.secret && formatted != "" {
+		return redacted
+	}
+	return formatted
+}
+
+// settings returns all the settings of the config, in the order they're
+// declared.
+func (c *Config) settings() []setting {
+	var settings []setting
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionKey := sections.Type().Field(i).Tag.Get("config")
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			settings = append(settings, setting{
+				key:    sectionKey + "." + field.Tag.Get("config"),
+				env:    field.Tag.Get("env"),
+				usage:  field.Tag.Get("usage"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  section.Field(j),
+			})
+		}
+	}
+	return settings
+}
+
+// Loader loads the configuration from the config file, environment and a
+// flag set. Registering the config flags on a caller's flag set lets commands
+// define their own flags alongside them.
+type Loader struct {
+	flags      *flag.FlagSet
+	configFile *string
+	flagValues map[string]*string
+}
+
+// NewLoader registers the config flags on the flag set. The configuration is
+// loaded by calling Load after the flag set has been parsed.
+func NewLoader(flags *flag.FlagSet) *Loader {
+	defaults := Default()
+	l := &Loader{
+		flags:      flags,
+		configFile: flags.String("config", "", fmt.Sprintf("Path to a YAML or TOML config file (env %s).", FileEnv)),
+		flagValues: make(map[string]*string),
+	}
+	for _, s := range defaults.settings() {
+		usage := fmt.Sprintf("%s (env %s, default %q)", s.usage, s.env, s.String())
+		l.flagValues[s.key] = flags.String(s.flagName(), "", usage)
+	}
+	return l
+}
+
+// Load loads the configuration, then validates it. The lookupEnv function is
+// usually os.LookupEnv.
+func (l *Loader) Load(lookupEnv func(string) (string, bool)) (Config, error) {
+	config := Default()
+	settings := config.settings()
+
+	setFlags := make(map[string]bool)
+	l.flags.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	path := *l.configFile
+	if path == "" {
+		path, _ = lookupEnv(FileEnv)
+	}
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return config, err
+		}
+		if err := applyFile(settings, values); err != nil {
+			return config, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := lookupEnv(s.env); ok {
+			if err := s.set(value); err != nil {
+				return config, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if setFlags[s.flagName()] {
+			if err := s.set(*l.flagValues[s.key]); err != nil {
+				return config, fmt.Errorf("invalid -%s: %w", s.flagName(), err)
+			}
+		}
+	}
+
+	return config, config.Validate()
+}
+
+// Load loads the configuration from the config file, environment and the
+// given command line arguments (excluding the program name), then validates
+// it. The lookupEnv function is usually os.LookupEnv.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	flags := flag.NewFlagSet("autocrat", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	loader := NewLoader(flags)
+	if err := flags.Parse(args); err != nil {
+		return Default(), fmt.Errorf("failed to parse flags: %w", err)
+	}
+	return loader.Load(lookupEnv)
+}
+
+// applyFile sets the settings to the values read from a config file. Unknown
+// keys are an error as they're almost certainly a typo.
+func applyFile(settings []setting, values map[string]string) error {
+	byKey := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byKey[s.key] = s
+	}
+	var unknown []string
+	for key, value := range values {
+		s, ok := byKey[key]
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+		if err := s.set(value); err != nil {
+			return err
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown settings: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// Validate checks the configuration is complete and consistent.
+func (c Config) Validate() error {
+	var problems []string
+	required := map[string]string{
+		"auth.jwt_secret (JWT_SECRET)": c.Auth.JWTSecret,
+		"db.user (DB_USER)":            c.DB.User,
+		"db.name (DB_NAME)":            c.DB.Name,
+		"db.host (DB_HOST)":            c.DB.Host,
+		"http.addr (HTTP_ADDR)":        c.HTTP.Addr,
+		"http.admin_addr (ADMIN_ADDR)": c.HTTP.AdminAddr,
+	}
+	for name, value := range required {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, fmt.Sprintf("%s is required", name))
+		}
+	}
+	if c.Auth.JWTSecret != "" && len(c.Auth.JWTSecret) < 32 {
+		problems = append(problems, "auth.jwt_secret must be at least 32 characters")
+	}
+	if c.HTTP.Addr != "" && c.HTTP.Addr == c.HTTP.AdminAddr {
+		problems = append(problems, "http.addr and http.admin_addr must be different")
+	}
+	if (c.HTTP.TLSCertFile == "") != (c.HTTP.TLSKeyFile == "") {
+		problems = append(problems, "http.tls_cert_file and http.tls_key_file must be set together")
+	}
+	for _, proxy := range c.HTTP.TrustedProxies {
+		if !validProxy(proxy) {
+			problems = append(problems, fmt.Sprintf("http.trusted_proxies must be IP addresses or CIDR ranges, got %q", proxy))
+		}
+	}
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("log.level must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+	switch c.Log.Format {
+	case "json", "console":
+	default:
+		problems = append(problems, fmt.Sprintf("log.format must be json or console, got %q", c.Log.Format))
+	}
+	switch strings.ToLower(c.Session.CookieSameSite) {
+	case "lax", "strict":
+	case "none":
+		if !c.Session.CookieSecure {
+			problems = append(problems, "session.cookie_secure must be true when session.cookie_same_site is none")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("session.cookie_same_site must be lax, strict or none, got %q", c.Session.CookieSameSite))
+	}
+	switch c.RateLimit.Backend {
+	case "memory", "postgres":
+	default:
+		problems = append(problems, fmt.Sprintf("rate_limit.backend must be memory or postgres, got %q", c.RateLimit.Backend))
+	}
+	if _, err := c.Group.Location(); err != nil {
+		problems = append(problems, fmt.Sprintf("group.time_zone must be an IANA time zone, got %q", c.Group.TimeZone))
+	}
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	case "file":
+		if c.Tracing.File == "" {
+			problems = append(problems, "tracing.file is required when tracing.exporter is file")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter must be none, stdout, file or otlp, got %q", c.Tracing.Exporter))
+	}
+	durations := map[string]time.Duration{
+		"auth.token_lifetime":      c.Auth.TokenLifetime,
+		"session.lifetime":         c.Session.Lifetime,
+		"db.max_replica_lag":       c.DB.MaxReplicaLag,
+		"db.slow_query_threshold":  c.DB.SlowQueryThreshold,
+		"http.read_timeout":        c.HTTP.ReadTimeout,
+		"http.read_header_timeout": c.HTTP.ReadHeaderTimeout,
+		"http.write_timeout":       c.HTTP.WriteTimeout,
+		"http.idle_timeout":        c.HTTP.IdleTimeout,
+		"http.shutdown_timeout":    c.HTTP.ShutdownTimeout,
+		"http.tls_reload_interval": c.HTTP.TLSReloadInterval,
+	}
+	for name, duration := range durations {
+		if duration <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be positive", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Redacted returns the effective configuration as a map of setting keys to
+// values with secrets redacted. It is safe to log.
+func (c Config) Redacted() map[string]string {
+	values := make(map[string]string)
+	for _, s := range c.settings() {
+		values[s.key] = s.String()
+	}
+	return values
+}
+
+// Print writes the effective configuration, one setting per line, with secrets
+// redacted.
+func (c Config) Print(w io.Writer) error {
+	values := c.Redacted()
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s = %s\n", key, values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validProxy reports whether the proxy is an IP address or CIDR range.
+func validProxy(proxy string) bool {
+	if _, _, err := net.ParseCIDR(proxy); err == nil {
+		return true
+	}
+	return net.ParseIP(proxy) != nil
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "thisisatestsecretthatisatleast32characterslong"
+
+func lookupEnv(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func requiredEnv() map[string]string {
+	return map[string]string{
+		"JWT_SECRET": testSecret,
+		"DB_USER":    "user",
+		"DB_NAME":    "name",
+		"DB_HOST":    "localhost",
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	config, err := Load(nil, lookupEnv(requiredEnv()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.HTTP.Addr != ":8081" {
+		t.Errorf("Expected default addr :8081, got %s", config.HTTP.Addr)
+	}
+	if config.Auth.TokenLifetime != 24*time.Hour {
+		t.Errorf("Expected default token lifetime of 24h, got %s", config.Auth.TokenLifetime)
+	}
+}
+
+func TestLoadFailsWithoutJWTSecret(t *testing.T) {
+	env := requiredEnv()
+	delete(env, "JWT_SECRET")
+	_, err := Load(nil, lookupEnv(env))
+	if err == nil || !strings.Contains(err.Error(), "JWT_SECRET") {
+		t.Fatalf("Expected missing JWT_SECRET to be an error, got %v", err)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFile(t, dir, "autocrat.yaml", `
+http:
+  addr: ":1000"
+  admin_addr: ":2000"
+db:
+  host: file-host
+  replica_hosts:
+    - replica-1
+    - replica-2
+session:
+  lifetime: 1h
+`)
+	env := requiredEnv()
+	env["DB_HOST"] = "env-host"
+	env["HTTP_ADDR"] = ":3000"
+
+	config, err := Load([]string{"-config", path, "-http-addr", ":4000"}, lookupEnv(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.HTTP.Addr != ":4000" {
+		t.Errorf("Expected flag to override env and file, got %s", config.HTTP.Addr)
+	}
+	if config.DB.Host != "env-host" {
+		t.Errorf("Expected env to override file, got %s", config.DB.Host)
+	}
+	if config.HTTP.AdminAddr != ":2000" {
+		t.Errorf("Expected file to override default, got %s", config.HTTP.AdminAddr)
+	}
+	if config.Session.Lifetime != time.Hour {
+		t.Errorf("Expected session lifetime from file, got %s", config.Session.Lifetime)
+	}
+	if strings.Join(config.DB.ReplicaHosts, ",") != "replica-1,replica-2" {
+		t.Errorf("Expected replica hosts from file, got %v", config.DB.ReplicaHosts)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFile(t, dir, "autocrat.toml", `
+[log]
+level = "debug"
+
+[cors]
+allowed_origins = ["https://example.com"]
+`)
+	env := requiredEnv()
+	env[FileEnv] = path
+	config, err := Load(nil, lookupEnv(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Log.Level != "debug" {
+		t.Errorf("Expected log level from file, got %s", config.Log.Level)
+	}
+	if len(config.CORS.AllowedOrigins) != 1 || config.CORS.AllowedOrigins[0] != "https://example.com" {
+		t.Errorf("Expected allowed origins from file, got %v", config.CORS.AllowedOrigins)
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	testCases := []struct {
+		name string
+		env  map[string]string
+		args []string
+	}{
+		{"bad-duration", map[string]string{"SESSION_LIFETIME": "forever"}, nil},
+		{"bad-bool", map[string]string{"SESSION_COOKIE_SECURE": "maybe"}, nil},
+		{"short-secret", map[string]string{"JWT_SECRET": "secret"}, nil},
+		{"insecure-same-site-none", map[string]string{"SESSION_COOKIE_SAMESITE": "none", "SESSION_COOKIE_SECURE": "false"}, nil},
+		{"bad-rate", map[string]string{"RATE_LIMIT_SIGN_IN": "lots"}, nil},
+		{"bad-rate-backend", map[string]string{"RATE_LIMIT_BACKEND": "redis"}, nil},
+		{"unknown-flag", nil, []string{"-no-such-flag"}},
+		{"unknown-file-key", nil, []string{"-config", writeFile(t, dir, "bad.yaml", "db:\n  hots: typo\n")}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			env := requiredEnv()
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			if _, err := Load(tt.args, lookupEnv(env)); err == nil {
+				t.Fatal("Expected an error")
+			}
+		})
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	testCases := []struct {
+		value string
+		want  Rate
+	}{
+		{"5/1m", Rate{5, time.Minute}},
+		{"5/m", Rate{5, time.Minute}},
+		{"100/30s", Rate{100, 30 * time.Second}},
+		{"off", Rate{}},
+	}
+	for _, tt := range testCases {
+		got, err := ParseRate(tt.value)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.value, err)
+		}
+		if got != tt.want {
+			t.Errorf("Expected %q to parse to %v, got %v", tt.value, tt.want, got)
+		}
+		if reparsed, _ := ParseRate(got.String()); reparsed != got {
+			t.Errorf("Expected %v to round trip, got %v", got, reparsed)
+		}
+	}
+	for _, value := range []string{"5", "0/m", "-1/m", "5/0s", "five/m"} {
+		if _, err := ParseRate(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestRedactedHidesSecrets(t *testing.T) {
+	env := requiredEnv()
+	env["DB_PASS"] = "hunter2"
+	config, err := Load(nil, lookupEnv(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := config.Redacted()
+	if values["auth.jwt_secret"] != redacted || values["db.password"] != redacted {
+		t.Fatalf("Expected secrets to be redacted, got %v", values)
+	}
+	if values["db.host"] != "localhost" {
+		t.Errorf("Expected non-secret values to be shown, got %s", values["db.host"])
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// readFile reads a YAML or TOML config file, determined by its extension, and
+// flattens it into a map of setting keys to their values.
+func readFile(path string) (map[string]string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var parsed map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var raw map[interface{}]interface{}
+		if err := yaml.Unmarshal(contents, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML config file %s: %w", path, err)
+		}
+		parsed = stringKeys(raw)
+	case ".toml":
+		if _, err := toml.Decode(string(contents), &parsed); err != nil {
+			return nil, fmt.Errorf("failed to parse TOML config file %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("config file %s must have a .yaml, .yml or .toml extension", path)
+	}
+
+	values := make(map[string]string)
+	flatten("", parsed, values)
+	return values, nil
+}
+
+// stringKeys converts the maps produced by the YAML decoder, which can have
+// keys of any type, to maps with string keys.
+func stringKeys(raw map[interface{}]interface{}) map[string]interface{} {
+	converted := make(map[string]interface{}, len(raw))
+	for key, value := range raw {
+		if nested, ok := value.(map[interface{}]interface{}); ok {
+			value = stringKeys(nested)
+		}
+		converted[fmt.Sprint(key)] = value
+	}
+	return converted
+}
+
+// flatten joins nested keys with dots and formats values the same way they'd
+// be given in the environment, so lists become comma separated.
+func flatten(prefix string, raw map[string]interface{}, values map[string]string) {
+	for key, value := range raw {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch value := value.(type) {
+		case map[string]interface{}:
+			flatten(key, value, values)
+		case []interface{}:
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewLogger builds a logger with the configured level and format. The console
+// format is meant for local development, production should use json.
+func (l Log) NewLogger() (*zap.Logger, error) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", l.Level, err)
+	}
+
+	zapConfig := zap.NewProductionConfig()
+	if l.Format == "console" {
+		zapConfig = zap.NewDevelopmentConfig()
+	}
+	zapConfig.Level = zap.NewAtomicLevelAt(level)
+	return zapConfig.Build()
+}
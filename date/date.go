@@ -0,0 +1,169 @@
+// Package date provides a calendar date without a time of day or time zone,
+// such as a date of birth. Dates are encoded as "2006-01-02" in JSON and are
+// stored in DATE columns.
+package date
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/nick96/cubapi/openapi"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// Layout is the layout dates are formatted and parsed with.
+const Layout = "2006-01-02"
+
+// Date is a calendar date. The zero value is not a valid date, use IsZero to
+// check for it.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// Of returns the date of the time in its location.
+func Of(t time.Time) Date {
+	year, month, day := t.Date()
+	return Date{Year: year, Month: month, Day: day}
+}
+
+// Today returns the current date in the location.
+func Today(loc *time.Location) Date {
+	return Of(time.Now().In(loc))
+}
+
+// Parse parses a date formatted as "2006-01-02".
+func Parse(value string) (Date, error) {
+	t, err := time.Parse(Layout, value)
+	if err != nil {
+		return Date{}, fmt.Errorf("date %q must be formatted as YYYY-MM-DD: %w", value, err)
+	}
+	return Of(t), nil
+}
+
+// String formats the date as "2006-01-02".
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// IsZero reports whether the date is the zero value.
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+// In returns the time at the start of the date in the location.
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// Before reports whether the date is before other.
+func (d Date) Before(other Date) bool {
+	if d.Year != other.Year {
+		return d.Year < other.Year
+	}
+	if d.Month != other.Month {
+		return d.Month < other.Month
+	}
+	return d.Day < other.Day
+}
+
+// After reports whether the date is after other.
+func (d Date) After(other Date) bool {
+	return other.Before(d)
+}
+
+// AddDays returns the date the given number of days after d.
+func (d Date) AddDays(days int) Date {
+	return Of(d.In(time.UTC).AddDate(0, 0, days))
+}
+
+// DaysUntil returns the number of days from d to other, which is negative if
+// other is before d. The days from the start to the end of a camp are the
+// nights camped.
+func (d Date) DaysUntil(other Date) int {
+	return int(other.In(time.UTC).Sub(d.In(time.UTC)).Hours() / 24)
+}
+
+// YearsOn returns the number of whole years from d to on, e.g. the age on that
+// day of someone born on d. People born on the 29th of February turn a year
+// older on the 1st of March in common years.
+func (d Date) YearsOn(on Date) int {
+	years := on.Year - d.Year
+	if on.Month < d.Month || (on.Month == d.Month && on.Day < d.Day) {
+		years--
+	}
+	return years
+}
+
+// MarshalJSON encodes the date as a "2006-01-02" string.
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON decodes a "2006-01-02" string. An empty string or null is the
+// zero date.
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var value *string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("date must be a string formatted as YYYY-MM-DD: %w", err)
+	}
+	if value == nil || *value == "" {
+		*d = Date{}
+		return nil
+	}
+	parsed, err := Parse(*value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Scan scans a DATE column.
+func (d *Date) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*d = Date{}
+	case time.Time:
+		*d = Of(src)
+	case []byte:
+		return d.Scan(string(src))
+	case string:
+		parsed, err := Parse(src)
+		if err != nil {
+			return err
+		}
+		*d = parsed
+	default:
+		return fmt.Errorf("cannot scan %T into a date", src)
+	}
+	return nil
+}
+
+// Value stores the date in a DATE column. The zero date is stored as NULL.
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.String(), nil
+}
+
+// RegisterValidation lets the validator check dates like strings, so the zero
+// date fails "required".
+func RegisterValidation(validate *validator.Validate) {
+	validate.RegisterCustomTypeFunc(func(v reflect.Value) interface{} {
+		if d := v.Interface().(Date); !d.IsZero() {
+			return d.String()
+		}
+		return ""
+	}, Date{})
+}
+
+// OpenAPISchema describes dates in OpenAPI documents.
+func (Date) OpenAPISchema() *openapi.Schema {
+	return &openapi.Schema{Type: "string", Format: "date"}
+}
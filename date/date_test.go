@@ -0,0 +1,75 @@
+package date
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	var d Date
+	if err := json.Unmarshal([]byte(`"2012-02-29"`), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d != (Date{2012, time.February, 29}) {
+		t.Fatalf("Expected 2012-02-29, got %v", d)
+	}
+	encoded, _ := json.Marshal(d)
+	if string(encoded) != `"2012-02-29"` {
+		t.Errorf("Expected the date to encode as a string, got %s", encoded)
+	}
+
+	for _, invalid := range []string{`"2012-02-30"`, `"29/02/2012"`, `20120229`} {
+		if err := json.Unmarshal([]byte(invalid), &d); err == nil {
+			t.Errorf("Expected %s to be rejected", invalid)
+		}
+	}
+	if err := json.Unmarshal([]byte(`null`), &d); err != nil || !d.IsZero() {
+		t.Errorf("Expected null to be the zero date, got %v (%v)", d, err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	var d Date
+	if err := d.Scan(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)); err != nil || d.String() != "2020-03-01" {
+		t.Errorf("Expected to scan a time, got %v (%v)", d, err)
+	}
+	if err := d.Scan([]byte("2020-03-02")); err != nil || d.String() != "2020-03-02" {
+		t.Errorf("Expected to scan bytes, got %v (%v)", d, err)
+	}
+	if value, _ := (Date{}).Value(); value != nil {
+		t.Errorf("Expected the zero date to be stored as NULL, got %v", value)
+	}
+}
+
+func TestYearsOn(t *testing.T) {
+	born := Date{2012, time.February, 29}
+	testCases := []struct {
+		on   Date
+		want int
+	}{
+		{Date{2020, time.February, 28}, 7},
+		{Date{2020, time.February, 29}, 8},
+		{Date{2021, time.February, 28}, 8},
+		{Date{2021, time.March, 1}, 9},
+	}
+	for _, tt := range testCases {
+		if got := born.YearsOn(tt.on); got != tt.want {
+			t.Errorf("Expected to be %d on %s, got %d", tt.want, tt.on, got)
+		}
+	}
+}
+
+func TestCompareAndAdd(t *testing.T) {
+	d := Date{2020, time.December, 31}
+	next := d.AddDays(1)
+	if next != (Date{2021, time.January, 1}) || !d.Before(next) || !next.After(d) || d.Before(d) {
+		t.Errorf("Expected %v to be the day after %v", next, d)
+	}
+	if days := d.DaysUntil(Date{2021, time.March, 1}); days != 60 {
+		t.Errorf("Expected 60 days until the 1st of March, got %d", days)
+	}
+	if days := next.DaysUntil(d); days != -1 {
+		t.Errorf("Expected the day before to be -1 days away, got %d", days)
+	}
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultMaxReplicaLag is the default amount of replication lag a
+	// replica can have before it is considered unhealthy.
+	DefaultMaxReplicaLag = 5 * time.Second
+	// DefaultReplicaCheckInterval is the default interval between replica
+	// health checks.
+	DefaultReplicaCheckInterval = 10 * time.Second
+)
+
+type primaryKey struct{}
+
+// WithPrimary returns a context that forces reads made with it to go to the
+// primary. This should be used when a read needs to see a write that was just
+// made (i.e. read-your-writes).
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// IsPrimaryForced reports whether the context has been marked by WithPrimary.
+func IsPrimaryForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(primaryKey{}).(bool)
+	return forced
+}
+
+// LagChecker returns the replication lag of the given replica.
+type LagChecker func(ctx context.Context, replica *DB) (time.Duration, error)
+
+// PostgresReplicaLag is a LagChecker for Postgres streaming replicas. It
+// compares the time of the last replayed transaction to now. An idle primary
+// therefore shows up as lag, which is fine as we only care about lag being
+// bounded.
+func PostgresReplicaLag(ctx context.Context, replica *DB) (time.Duration, error) {
+	query := `
+SELECT CASE
+    WHEN NOT pg_is_in_recovery() THEN 0
+    WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+    ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END;
+`
+	var seconds float64
+	if err := replica.Named("db.replica_lag").QueryRowx(ctx, query).Scan(&seconds); err != nil {
+		return 0, fmt.Errorf("failed to check replica lag: %w", err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// ReplicaStatus is the last known state of a replica.
+type ReplicaStatus struct {
+	Healthy   bool          `json:"healthy"`
+	Lag       time.Duration `json:"lag"`
+	Error     string        `json:"error,omitempty"`
+	CheckedAt time.Time     `json:"checkedAt"`
+}
+
+type replica struct {
+	db     *DB
+	mu     sync.RWMutex
+	status ReplicaStatus
+}
+
+func (r *replica) healthy() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.status.Healthy
+}
+
+// Cluster is a primary database with zero or more read replicas. Writes always
+// go to the primary. Reads go to a healthy replica (chosen round robin) unless
+// the primary is forced via WithPrimary or there are no healthy replicas.
+type Cluster struct {
+	primary  *DB
+	replicas []*replica
+	logger   *zap.Logger
+	next     uint64
+
+	// MaxLag is the replication lag above which a replica is considered
+	// unhealthy.
+	MaxLag time.Duration
+	// CheckLag is used to get the replication lag of a replica.
+	CheckLag LagChecker
+}
+
+// NewCluster creates a cluster from the given primary and replicas. Replicas
+// start out unhealthy and are only used for reads once CheckReplicas has found
+// them to be healthy.
+func NewCluster(logger *zap.Logger, primary *DB, replicas ...*DB) *Cluster {
+	c := &Cluster{
+		primary:  primary,
+		logger:   logger,
+		MaxLag:   DefaultMaxReplicaLag,
+		CheckLag: PostgresReplicaLag,
+	}
+	for _, db := range replicas {
+		c.replicas = append(c.replicas, &replica{db: db})
+	}
+	return c
+}
+
+// Primary returns the primary database handle. All writes should go through
+// it.
+func (c *Cluster) Primary() *DB {
+	return c.primary
+}
+
+// Reader returns the database handle that reads should go to. This is a
+// healthy replica unless the primary has been forced via WithPrimary or no
+// replica is healthy, in which case it is the primary.
+func (c *Cluster) Reader(ctx context.Context) *DB {
+	if IsPrimaryForced(ctx) || len(c.replicas) == 0 {
+		return c.primary
+	}
+
+	start := atomic.AddUint64(&c.next, 1)
+	for i := 0; i < len(c.replicas); i++ {
+		r := c.replicas[(start+uint64(i))%uint64(len(c.replicas))]
+		if r.healthy() {
+			return r.db
+		}
+	}
+	c.logger.Debug("No healthy replicas, falling back to primary")
+	return c.primary
+}
+
+// CheckReplicas checks the health and replication lag of each replica,
+// updating which replicas are used for reads.
+func (c *Cluster) CheckReplicas(ctx context.Context) {
+	for i, r := range c.replicas {
+		status := ReplicaStatus{CheckedAt: time.Now()}
+		lag, err := c.CheckLag(ctx, r.db)
+		if err != nil {
+			status.Error = err.Error()
+			c.logger.Error("Replica health check failed", zap.Int("replica", i), zap.Error(err))
+		} else {
+			status.Lag = lag
+			status.Healthy = lag <= c.MaxLag
+			if !status.Healthy {
+				c.logger.Warn("Replica is lagging too far behind primary",
+					zap.Int("replica", i), zap.Duration("lag", lag), zap.Duration("maxLag", c.MaxLag),
+				)
+			}
+		}
+
+		r.mu.Lock()
+		r.status = status
+		r.mu.Unlock()
+	}
+}
+
+// ReplicaStatuses returns the last known status of each replica.
+func (c *Cluster) ReplicaStatuses() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, 0, len(c.replicas))
+	for _, r := range c.replicas {
+		r.mu.RLock()
+		statuses = append(statuses, r.status)
+		r.mu.RUnlock()
+	}
+	return statuses
+}
+
+// Monitor checks the replicas every interval until the context is cancelled.
+// The replicas are checked once straight away so they can be used as soon as
+// possible.
+func (c *Cluster) Monitor(ctx context.Context, interval time.Duration) {
+	c.CheckReplicas(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.CheckReplicas(ctx)
+		}
+	}
+}
+
+// Close closes the primary and all the replicas.
+func (c *Cluster) Close() error {
+	var firstErr error
+	for _, r := range c.replicas {
+		if err := r.db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := c.primary.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
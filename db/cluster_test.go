@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// openLazy opens a database handle without connecting to it. sql.Open only
+// connects on first use so this gives us distinct handles to route between.
+func openLazy(t *testing.T) *DB {
+	db, err := sqlx.Open("postgres", "host=localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Instrument(zap.NewNop(), db)
+}
+
+func newTestCluster(t *testing.T, lags map[*DB]time.Duration, replicas ...*DB) *Cluster {
+	cluster := NewCluster(zap.NewNop(), openLazy(t), replicas...)
+	cluster.CheckLag = func(ctx context.Context, replica *DB) (time.Duration, error) {
+		lag, ok := lags[replica]
+		if !ok {
+			return 0, errors.New("replica is down")
+		}
+		return lag, nil
+	}
+	return cluster
+}
+
+func TestReaderNoReplicas(t *testing.T) {
+	cluster := newTestCluster(t, nil)
+	cluster.CheckReplicas(context.Background())
+	if cluster.Reader(context.Background()) != cluster.Primary() {
+		t.Fatal("Expected reads to go to the primary when there are no replicas")
+	}
+}
+
+func TestReaderUsesHealthyReplicas(t *testing.T) {
+	healthy := openLazy(t)
+	lagging := openLazy(t)
+	down := openLazy(t)
+	lags := map[*DB]time.Duration{
+		healthy: time.Second,
+		lagging: time.Minute,
+	}
+	cluster := newTestCluster(t, lags, healthy, lagging, down)
+
+	if cluster.Reader(context.Background()) != cluster.Primary() {
+		t.Fatal("Expected reads to go to the primary before replicas have been checked")
+	}
+
+	cluster.CheckReplicas(context.Background())
+	for i := 0; i < 10; i++ {
+		if reader := cluster.Reader(context.Background()); reader != healthy {
+			t.Fatalf("Expected read %d to go to the healthy replica", i)
+		}
+	}
+
+	statuses := cluster.ReplicaStatuses()
+	if !statuses[0].Healthy || statuses[1].Healthy || statuses[2].Healthy {
+		t.Fatalf("Unexpected replica statuses: %+v", statuses)
+	}
+	if statuses[2].Error == "" {
+		t.Fatal("Expected down replica to have an error")
+	}
+}
+
+func TestReaderRoundRobin(t *testing.T) {
+	first := openLazy(t)
+	second := openLazy(t)
+	lags := map[*DB]time.Duration{first: 0, second: 0}
+	cluster := newTestCluster(t, lags, first, second)
+	cluster.CheckReplicas(context.Background())
+
+	seen := make(map[*DB]int)
+	for i := 0; i < 10; i++ {
+		seen[cluster.Reader(context.Background())]++
+	}
+	if seen[first] != 5 || seen[second] != 5 {
+		t.Fatalf("Expected reads to be spread evenly across replicas, got %d and %d", seen[first], seen[second])
+	}
+}
+
+func TestReaderFallsBackToPrimary(t *testing.T) {
+	replica := openLazy(t)
+	lags := map[*DB]time.Duration{replica: 0}
+	cluster := newTestCluster(t, lags, replica)
+	cluster.CheckReplicas(context.Background())
+	if cluster.Reader(context.Background()) != replica {
+		t.Fatal("Expected read to go to the replica")
+	}
+
+	delete(lags, replica)
+	cluster.CheckReplicas(context.Background())
+	if cluster.Reader(context.Background()) != cluster.Primary() {
+		t.Fatal("Expected read to fall back to the primary once the replica is down")
+	}
+}
+
+func TestReaderWithPrimary(t *testing.T) {
+	replica := openLazy(t)
+	lags := map[*DB]time.Duration{replica: 0}
+	cluster := newTestCluster(t, lags, replica)
+	cluster.CheckReplicas(context.Background())
+
+	ctx := WithPrimary(context.Background())
+	if cluster.Reader(ctx) != cluster.Primary() {
+		t.Fatal("Expected forced read to go to the primary")
+	}
+}
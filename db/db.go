@@ -57,8 +57,9 @@ func (c ConnectionDetails) String() string {
 
 // DBConn returns a database connection (or error if it can't connect) based on
 // the given user, password and host. It will attempt to connect up to 20 times
-// with an exponential back off.
-func NewConn(logger *zap.Logger, user, password, dbName, host, sslmode string) (*sqlx.DB, error) {
+// with an exponential back off. The returned handle is instrumented (see
+// Instrument).
+func NewConn(logger *zap.Logger, user, password, dbName, host, sslmode string) (*DB, error) {
 	connDetails := NewConnectionDetails(user, password, dbName, host, sslmode)
 	connString := connDetails.String()
 
@@ -75,7 +76,7 @@ func NewConn(logger *zap.Logger, user, password, dbName, host, sslmode string) (
 		if err = db.Ping(); err == nil {
 			// If we can connect to the db okay then there is no point retrying
 			// anymore so just exit here.
-			return db, nil
+			return Instrument(logger, db), nil
 		}
 		logger.Info("Failed to connect to database",
 			zap.Int("attempt", retry), zap.String("dbName", dbName), zap.String("host", host), zap.String("user", user), zap.Error(err),
@@ -0,0 +1,152 @@
+// Package dbtest provides database handles for testing which queries go
+// where, without a database.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nick96/cubapi/db"
+	"go.uber.org/zap"
+)
+
+// DriverName is the name of the recording driver registered with database/sql.
+const DriverName = "dbtest"
+
+func init() {
+	sql.Register(DriverName, recordingDriver{})
+}
+
+var (
+	mu       sync.Mutex
+	recorded = make(map[string][]string)
+)
+
+// Recorder is a database handle that records the queries run against it,
+// along with BEGIN, COMMIT and ROLLBACK for transactions. No query returns any
+// rows and every statement succeeds.
+type Recorder struct {
+	*db.DB
+	name string
+}
+
+// NewRecorder opens a recording handle. Handles with the same name share
+// their recorded queries.
+func NewRecorder(name string) *Recorder {
+	handle := sqlx.MustOpen(DriverName, name)
+	return &Recorder{DB: db.Instrument(zap.NewNop(), handle), name: name}
+}
+
+// Queries returns the queries run against the handle so far.
+func (r *Recorder) Queries() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]string(nil), recorded[r.name]...)
+}
+
+// Reset forgets the queries recorded so far.
+func (r *Recorder) Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(recorded, r.name)
+}
+
+type recordingDriver struct{}
+
+func (recordingDriver) Open(name string) (driver.Conn, error) {
+	return conn{name}, nil
+}
+
+type conn struct {
+	name string
+}
+
+func (c conn) record(query string) {
+	mu.Lock()
+	defer mu.Unlock()
+	recorded[c.name] = append(recorded[c.name], query)
+}
+
+func (c conn) Prepare(query string) (driver.Stmt, error) {
+	return stmt{c, query}, nil
+}
+
+func (c conn) Close() error {
+	return nil
+}
+
+func (c conn) Begin() (driver.Tx, error) {
+	c.record("BEGIN")
+	return tx{c}, nil
+}
+
+// CheckNamedValue accepts every argument as is, so arguments such as arrays
+// don't need to be converted.
+func (c conn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.record(query)
+	return rows{}, nil
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.record(query)
+	return driver.RowsAffected(1), nil
+}
+
+type stmt struct {
+	conn  conn
+	query string
+}
+
+func (s stmt) Close() error {
+	return nil
+}
+
+func (s stmt) NumInput() int {
+	return -1
+}
+
+func (s stmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.conn.record(s.query)
+	return driver.RowsAffected(1), nil
+}
+
+func (s stmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.record(s.query)
+	return rows{}, nil
+}
+
+type tx struct {
+	conn conn
+}
+
+func (t tx) Commit() error {
+	t.conn.record("COMMIT")
+	return nil
+}
+
+func (t tx) Rollback() error {
+	t.conn.record("ROLLBACK")
+	return nil
+}
+
+type rows struct{}
+
+func (rows) Columns() []string {
+	return nil
+}
+
+func (rows) Close() error {
+	return nil
+}
+
+func (rows) Next(dest []driver.Value) error {
+	return io.EOF
+}
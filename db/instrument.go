@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// DefaultSlowQueryThreshold is the default duration after which a query is
+// logged as slow.
+const DefaultSlowQueryThreshold = 200 * time.Millisecond
+
+var (
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "db_query_duration_seconds",
+		Help: "Latency of database queries, by query name.",
+	}, []string{"query"})
+	queryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_query_errors_total",
+		Help: "Number of database queries that returned an error, by query name.",
+	}, []string{"query"})
+	slowQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_slow_queries_total",
+		Help: "Number of database queries slower than the slow query threshold, by query name.",
+	}, []string{"query"})
+)
+
+// DB is an instrumented database handle. Queries run through Named record
+// their latency and errors, and are logged if they're slower than
+// SlowQueryThreshold. The underlying sqlx handle is embedded so it can still be
+// used directly (e.g. for migrations) but those queries are not instrumented.
+type DB struct {
+	*sqlx.DB
+	logger *zap.Logger
+
+	// SlowQueryThreshold is the duration after which a query is logged as
+	// slow.
+	SlowQueryThreshold time.Duration
+}
+
+// Instrument wraps the given database handle so queries run against it are
+// instrumented.
+func Instrument(logger *zap.Logger, db *sqlx.DB) *DB {
+	return &DB{
+		DB:                 db,
+		logger:             logger,
+		SlowQueryThreshold: DefaultSlowQueryThreshold,
+	}
+}
+
+// Named returns a handle for running the query with the given name. The name
+// is used to label the query's metrics and logs so it should be stable and low
+// cardinality, e.g. "user.find_by_email".
+func (d *DB) Named(name string) Query {
+	return Query{db: d, ext: d.DB, name: name}
+}
+
+// Tx is a transaction on an instrumented database handle. Queries run through
+// Named are instrumented like those of the handle.
+type Tx struct {
+	*sqlx.Tx
+	db *DB
+}
+
+// Transact runs fn in a transaction, which is committed if fn returns nil and
+// rolled back otherwise.
+func (d *DB) Transact(ctx context.Context, fn func(tx *Tx) error) error {
+	tx, err := d.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(&Tx{Tx: tx, db: d}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Named returns a handle for running the query with the given name in the
+// transaction. See DB.Named.
+func (tx *Tx) Named(name string) Query {
+	return Query{db: tx.db, ext: tx.Tx, name: name}
+}
+
+// Query is an instrumented query. Its methods mirror those of sqlx.DB but
+// require a context, which is used to find the request the query was made as
+// part of.
+type Query struct {
+	db *DB
+	// ext runs the query, either the handle or a transaction on it.
+	ext  sqlx.ExtContext
+	name string
+}
+
+// QueryRowx runs a query that is expected to return at most one row.
+func (q Query) QueryRowx(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	ctx, span := q.startSpan(ctx, query)
+	start := time.Now()
+	row := q.ext.QueryRowxContext(ctx, query, args...)
+	err := row.Err()
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	q.observe(ctx, span, start, err, args)
+	return row
+}
+
+// Queryx runs a query that returns rows. Only the time until the first row is
+// available is measured.
+func (q Query) Queryx(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	ctx, span := q.startSpan(ctx, query)
+	start := time.Now()
+	rows, err := q.ext.QueryxContext(ctx, query, args...)
+	q.observe(ctx, span, start, err, args)
+	return rows, err
+}
+
+// Exec runs a query without returning any rows.
+func (q Query) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := q.startSpan(ctx, query)
+	start := time.Now()
+	result, err := q.ext.ExecContext(ctx, query, args...)
+	q.observe(ctx, span, start, err, args)
+	return result, err
+}
+
+// Get runs a query and scans the single resulting row into dest.
+func (q Query) Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, span := q.startSpan(ctx, query)
+	start := time.Now()
+	err := sqlx.GetContext(ctx, q.ext, dest, query, args...)
+	observed := err
+	if observed == sql.ErrNoRows {
+		observed = nil
+	}
+	q.observe(ctx, span, start, observed, args)
+	return err
+}
+
+// Select runs a query and scans all the resulting rows into dest, which must
+// be a pointer to a slice.
+func (q Query) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, span := q.startSpan(ctx, query)
+	start := time.Now()
+	err := sqlx.SelectContext(ctx, q.ext, dest, query, args...)
+	q.observe(ctx, span, start, err, args)
+	return err
+}
+
+func (q Query) startSpan(ctx context.Context, query string) (context.Context, tracing.Span) {
+	return tracing.Start(ctx, "db."+q.name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation", q.name),
+		attribute.String("db.statement", query),
+	))
+}
+
+func (q Query) observe(ctx context.Context, span tracing.Span, start time.Time, err error, args []interface{}) {
+	span.RecordError(err)
+	span.End()
+
+	duration := time.Since(start)
+	queryDuration.WithLabelValues(q.name).Observe(duration.Seconds())
+	if err != nil {
+		queryErrors.WithLabelValues(q.name).Inc()
+	}
+
+	if q.db.SlowQueryThreshold > 0 && duration >= q.db.SlowQueryThreshold {
+		slowQueries.WithLabelValues(q.name).Inc()
+		logging.Logger(ctx, q.db.logger).Warn("Slow query",
+			zap.String("query", q.name),
+			zap.Duration("duration", duration),
+			zap.Duration("threshold", q.db.SlowQueryThreshold),
+			zap.Strings("args", redactArgs(args)),
+			zap.Error(err),
+		)
+	}
+}
+
+// redactArgs describes query arguments without revealing their values. Query
+// arguments regularly contain personal information (emails, password hashes)
+// that should never end up in logs.
+func redactArgs(args []interface{}) []string {
+	redacted := make([]string, 0, len(args))
+	for i, arg := range args {
+		var description string
+		switch arg := arg.(type) {
+		case nil:
+			description = "NULL"
+		case string:
+			description = fmt.Sprintf("string(len=%d)", len(arg))
+		case []byte:
+			description = fmt.Sprintf("[]byte(len=%d)", len(arg))
+		default:
+			description = fmt.Sprintf("%T", arg)
+		}
+		redacted = append(redacted, fmt.Sprintf("$%d=%s", i+1, description))
+	}
+	return redacted
+}
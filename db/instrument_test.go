@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRedactArgs(t *testing.T) {
+	args := []interface{}{"test@test.com", int64(1), nil, []byte("hash")}
+	expected := []string{"$1=string(len=13)", "$2=int64", "$3=NULL", "$4=[]byte(len=4)"}
+	if redacted := redactArgs(args); !reflect.DeepEqual(expected, redacted) {
+		t.Fatalf("Expected %v, got %v", expected, redacted)
+	}
+}
+
+func TestQueryObserve(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	// Nothing listens on port 1 so every query fails straight away.
+	handle, err := sqlx.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+	db := Instrument(zap.New(core), handle)
+	db.SlowQueryThreshold = time.Nanosecond
+	// Metrics are global so only their changes are checked.
+	errorsBefore := testutil.ToFloat64(queryErrors.WithLabelValues("test.observe"))
+	countBefore := sampleCount(t, "test.observe")
+	slowBefore := testutil.ToFloat64(slowQueries.WithLabelValues("test.observe"))
+
+	if _, err := db.Named("test.observe").Exec(context.Background(), "SELECT $1;", "akela@example.com"); err == nil {
+		t.Fatal("Expected the query to fail")
+	}
+	if errors := testutil.ToFloat64(queryErrors.WithLabelValues("test.observe")) - errorsBefore; errors != 1 {
+		t.Errorf("Expected 1 query error, got %v", errors)
+	}
+	if count := sampleCount(t, "test.observe") - countBefore; count != 1 {
+		t.Errorf("Expected 1 query duration, got %d", count)
+	}
+	if slow := testutil.ToFloat64(slowQueries.WithLabelValues("test.observe")) - slowBefore; slow != 1 {
+		t.Errorf("Expected 1 slow query, got %v", slow)
+	}
+	slow := logs.FilterMessage("Slow query").All()
+	if len(slow) != 1 {
+		t.Fatalf("Expected the slow query to be logged once, got %d logs", logs.Len())
+	}
+	fields := slow[0].ContextMap()
+	if fields["query"] != "test.observe" || fmt.Sprint(fields["args"]) != "[$1=string(len=17)]" {
+		t.Errorf("Expected the query name and redacted args to be logged, got %v", fields)
+	}
+	if strings.Contains(fmt.Sprint(fields), "akela") {
+		t.Errorf("Expected the argument not to be logged, got %v", fields)
+	}
+
+	// Queries faster than the threshold aren't logged but are still counted.
+	db.SlowQueryThreshold = time.Hour
+	db.Named("test.observe").Exec(context.Background(), "SELECT 1;")
+	if logs.Len() != 1 || testutil.ToFloat64(slowQueries.WithLabelValues("test.observe"))-slowBefore != 1 {
+		t.Errorf("Expected the fast query not to be logged, got %d logs", logs.Len())
+	}
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	expected := fmt.Sprintf(`db_query_errors_total{query="test.observe"} %v`, errorsBefore+2)
+	if !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("Expected the registry to have %s, got:\n%s", expected, w.Body.String())
+	}
+}
+
+// sampleCount is the number of durations observed for queries with the name.
+func sampleCount(t *testing.T, name string) uint64 {
+	var m dto.Metric
+	if err := queryDuration.WithLabelValues(name).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
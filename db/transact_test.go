@@ -0,0 +1,39 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/db/dbtest"
+)
+
+func TestTransact(t *testing.T) {
+	handle := dbtest.NewRecorder(t.Name())
+	ctx := context.Background()
+
+	err := handle.Transact(ctx, func(tx *db.Tx) error {
+		_, err := tx.Named("test.first").Exec(ctx, "UPDATE first;")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.New("failed")
+	err = handle.Transact(ctx, func(tx *db.Tx) error {
+		if _, err := tx.Named("test.second").Exec(ctx, "UPDATE second;"); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("Expected the error of the function, got %v", err)
+	}
+
+	expected := []string{"BEGIN", "UPDATE first;", "COMMIT", "BEGIN", "UPDATE second;", "ROLLBACK"}
+	if queries := handle.Queries(); !reflect.DeepEqual(queries, expected) {
+		t.Fatalf("Expected %q, got %q", expected, queries)
+	}
+}
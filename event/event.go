@@ -0,0 +1,376 @@
+package event
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/problem"
+	"go.uber.org/zap"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// EventRequest creates or replaces an event.
+type EventRequest struct {
+	Kind     string    `json:"kind" validate:"oneof=camp hike paddle"`
+	Name     string    `json:"name" validate:"required,max=256"`
+	Location string    `json:"location,omitempty" validate:"max=256"`
+	StartsOn date.Date `json:"startsOn" validate:"required"`
+	// EndsOn defaults to the day the event starts.
+	EndsOn date.Date `json:"endsOn,omitempty"`
+	// Distance is how many kilometres participants hike or paddle.
+	Distance float64 `json:"distance,omitempty" validate:"min=0,max=10000"`
+	Notes    string  `json:"notes,omitempty" validate:"max=4096"`
+}
+
+// event converts the request to an event of the group.
+func (e EventRequest) event(groupID int64) Event {
+	event := Event{
+		GroupId:  groupID,
+		Kind:     e.Kind,
+		Name:     e.Name,
+		Location: e.Location,
+		StartsOn: e.StartsOn,
+		EndsOn:   e.EndsOn,
+		Distance: e.Distance,
+		Notes:    e.Notes,
+	}
+	if event.EndsOn.IsZero() {
+		event.EndsOn = event.StartsOn
+	}
+	return event
+}
+
+// ParticipantsRequest replaces the members taking part in an event.
+type ParticipantsRequest struct {
+	MemberIds []int64 `json:"memberIds" validate:"max=500,dive,required"`
+}
+
+// LeadersRequest replaces the users leading an event.
+type LeadersRequest struct {
+	UserIds []int64 `json:"userIds" validate:"max=50,dive,required"`
+}
+
+type EventResponse Event
+
+func (e EventResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type EventDetailResponse EventDetail
+
+func (e EventDetailResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type TotalsResponse Totals
+
+func (t TotalsResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type SectionTotalsResponse SectionTotals
+
+func (s SectionTotalsResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// NewEventRouter creates a router for the events of the caller's group, such
+// as camps, hikes and paddles, and what members did at them. It must be
+// behind authentication, which decides the group. Ranges of dates are given
+// by the from and to query parameters.
+//
+// GET /: List events running in a range of dates, the year up to today by
+// default, optionally of the kind query parameter.
+// POST /: Add an event.
+// GET /{eventID}: Get an event with its leaders and participants.
+// PUT /{eventID}: Replace the details of an event.
+// DELETE /{eventID}: Delete an event.
+// PUT /{eventID}/participants: Replace the members taking part in an event.
+// PUT /{eventID}/leaders: Replace the users leading an event.
+// GET /totals/member/{memberID}: Get the nights away and kilometres of a
+// member from events that ended in a range of dates, any time up to today by
+// default.
+// GET /totals/section/{section}: Get the totals of each member of a section.
+func NewEventRouter(logger *zap.Logger, service EventService) func(chi.Router) {
+	validate := problem.NewValidator()
+	date.RegisterValidation(validate)
+	return func(r chi.Router) {
+		r.Get("/", listEvents(logger, service))
+		r.Post("/", newEvent(logger, validate, service))
+		r.Get("/{eventID}", getEvent(logger, service))
+		r.Put("/{eventID}", updateEvent(logger, validate, service))
+		r.Delete("/{eventID}", deleteEvent(logger, service))
+		r.Put("/{eventID}/participants", setParticipants(logger, validate, service))
+		r.Put("/{eventID}/leaders", setLeaders(logger, validate, service))
+		r.Get("/totals/member/{memberID}", memberTotals(logger, service))
+		r.Get("/totals/section/{section}", sectionTotals(logger, service))
+	}
+}
+
+func listEvents(logger *zap.Logger, service EventService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := group.FromRequest(w, r)
+		if !ok {
+			return
+		}
+		filter, ok := dateRange(w, r)
+		if !ok {
+			return
+		}
+		filter.Kind = r.URL.Query().Get("kind")
+		events, err := service.ListEvents(r.Context(), groupID, filter)
+		if err != nil {
+			logger.Info("Failed to list events", zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, events)
+	}
+}
+
+func newEvent(logger *zap.Logger, validate *validator.Validate, service EventService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := group.FromRequest(w, r)
+		if !ok {
+			return
+		}
+		var request EventRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		event, err := service.NewEvent(r.Context(), request.event(groupID))
+		if err != nil {
+			logger.Info("Failed to add event", zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Debug("Added event", zap.Int64("eventID", event.Id))
+		render.Status(r, http.StatusCreated)
+		render.Render(w, r, EventResponse(event))
+	}
+}
+
+func getEvent(logger *zap.Logger, service EventService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "eventID", "Event")
+		if !ok {
+			return
+		}
+		event, err := service.GetEvent(r.Context(), groupID, id)
+		if err != nil {
+			logger.Info("Failed to get event", zap.Int64("eventID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, EventDetailResponse(event))
+	}
+}
+
+func updateEvent(logger *zap.Logger, validate *validator.Validate, service EventService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "eventID", "Event")
+		if !ok {
+			return
+		}
+		var request EventRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		event := request.event(groupID)
+		event.Id = id
+		updated, err := service.UpdateEvent(r.Context(), event)
+		if err != nil {
+			logger.Info("Failed to update event", zap.Int64("eventID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, EventResponse(updated))
+	}
+}
+
+func deleteEvent(logger *zap.Logger, service EventService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "eventID", "Event")
+		if !ok {
+			return
+		}
+		if err := service.DeleteEvent(r.Context(), groupID, id); err != nil {
+			logger.Info("Failed to delete event", zap.Int64("eventID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Deleted event", zap.Int64("eventID", id))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func setParticipants(logger *zap.Logger, validate *validator.Validate, service EventService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "eventID", "Event")
+		if !ok {
+			return
+		}
+		var request ParticipantsRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		participants, err := service.SetParticipants(r.Context(), groupID, id, request.MemberIds)
+		if err != nil {
+			logger.Info("Failed to set event participants", zap.Int64("eventID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, participants)
+	}
+}
+
+func setLeaders(logger *zap.Logger, validate *validator.Validate, service EventService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "eventID", "Event")
+		if !ok {
+			return
+		}
+		var request LeadersRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		leaders, err := service.SetLeaders(r.Context(), groupID, id, request.UserIds)
+		if err != nil {
+			logger.Info("Failed to set event leaders", zap.Int64("eventID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, leaders)
+	}
+}
+
+func memberTotals(logger *zap.Logger, service EventService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, memberID, ok := pathID(w, r, "memberID", "Member")
+		if !ok {
+			return
+		}
+		filter, ok := dateRange(w, r)
+		if !ok {
+			return
+		}
+		totals, err := service.MemberTotals(r.Context(), groupID, memberID, filter)
+		if err != nil {
+			logger.Info("Failed to get event totals", zap.Int64("memberID", memberID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, TotalsResponse(totals))
+	}
+}
+
+func sectionTotals(logger *zap.Logger, service EventService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := group.FromRequest(w, r)
+		if !ok {
+			return
+		}
+		filter, ok := dateRange(w, r)
+		if !ok {
+			return
+		}
+		filter.Section = chi.URLParam(r, "section")
+		if !contains(group.Sections, filter.Section) {
+			problem.Write(w, r, problem.New(problem.CodeNotFound, "Section does not exist"))
+			return
+		}
+		totals, err := service.SectionTotals(r.Context(), groupID, filter)
+		if err != nil {
+			logger.Info("Failed to get event totals", zap.String("section", filter.Section), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, SectionTotalsResponse(totals))
+	}
+}
+
+// dateRange parses the from and to query parameters into a filter. Either
+// can be left out. A problem is written if they aren't dates.
+func dateRange(w http.ResponseWriter, r *http.Request) (Filter, bool) {
+	var filter Filter
+	for _, param := range []struct {
+		name string
+		d    *date.Date
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := r.URL.Query().Get(param.name)
+		if value == "" {
+			continue
+		}
+		d, err := date.Parse(value)
+		if err != nil {
+			problem.Write(w, r, problem.New(problem.CodeValidationFailed, param.name+" must be a date formatted as YYYY-MM-DD"))
+			return Filter{}, false
+		}
+		*param.d = d
+	}
+	return filter, true
+}
+
+// pathID gets the caller's group and parses the ID in the path parameter.
+// Anything that isn't an ID can't exist so it's not found.
+func pathID(w http.ResponseWriter, r *http.Request, param, name string) (groupID, id int64, ok bool) {
+	groupID, ok = group.FromRequest(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, param), 10, 64)
+	if err != nil {
+		problem.Write(w, r, problem.New(problem.CodeNotFound, name+" does not exist"))
+		return 0, 0, false
+	}
+	return groupID, id, true
+}
+
+// decodeRequest decodes and validates a request into v. A problem is written
+// if the request is invalid.
+func decodeRequest(logger *zap.Logger, w http.ResponseWriter, r *http.Request, validate *validator.Validate, v interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Info("Failed to read request body", zap.Error(err))
+		problem.Write(w, r, problem.Internal(err))
+		return false
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, v); err != nil {
+		logger.Info("Failed to unmarshal request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Request body is invalid JSON", err))
+		return false
+	}
+	if err := validate.Struct(v); err != nil {
+		logger.Info("Invalid request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Invalid request body", err))
+		return false
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
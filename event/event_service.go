@@ -0,0 +1,272 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/security"
+	"github.com/nick96/cubapi/tracing"
+)
+
+// defaultRange is how many days before the end of a range of dates it starts
+// if it isn't given when listing events.
+const defaultRange = 365
+
+// maxNights is the most nights an event can stay away.
+const maxNights = 60
+
+type EventService struct {
+	store EventStorer
+	// location is the time zone dates are in, it decides when today is.
+	location *time.Location
+}
+
+// NewEventService creates an EventService that stores events in the store.
+// Dates, like when an event starts, are in the given location.
+func NewEventService(store EventStorer, location *time.Location) EventService {
+	return EventService{store: store, location: location}
+}
+
+// GetEvent gets the event of the group with the given ID with its leaders and
+// participants.
+func (s EventService) GetEvent(ctx context.Context, groupID, id int64) (EventDetail, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "EventService.GetEvent")
+	defer span.End()
+
+	event, found, err := s.store.GetEvent(ctx, groupID, id)
+	if err != nil {
+		span.RecordError(err)
+		return EventDetail{}, security.NewClientError(fmt.Sprintf("failed to get event %d", id), err)
+	} else if !found {
+		return EventDetail{}, problem.NewError(problem.CodeNotFound, fmt.Sprintf("event %d does not exist", id), ErrNoSuchEvent)
+	}
+	leaders, err := s.store.ListLeaders(ctx, groupID, id)
+	if err != nil {
+		span.RecordError(err)
+		return EventDetail{}, security.NewClientError(fmt.Sprintf("failed to list leaders of event %d", id), err)
+	}
+	participants, err := s.store.ListParticipants(ctx, groupID, id)
+	if err != nil {
+		span.RecordError(err)
+		return EventDetail{}, security.NewClientError(fmt.Sprintf("failed to list participants of event %d", id), err)
+	}
+	return EventDetail{Event: event.computed(), Leaders: leaders, Participants: participants}, nil
+}
+
+// ListEvents lists the events of the group matching the filter that run on
+// any day between its dates, which default to the year up to today.
+func (s EventService) ListEvents(ctx context.Context, groupID int64, filter Filter) ([]Event, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "EventService.ListEvents")
+	defer span.End()
+
+	filter, clientErr := s.dates(filter)
+	if clientErr != nil {
+		return nil, clientErr
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.AddDays(-defaultRange)
+	}
+	events, err := s.store.ListEvents(ctx, groupID, filter)
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError("failed to list events", err)
+	}
+	for i := range events {
+		events[i] = events[i].computed()
+	}
+	return events, nil
+}
+
+// NewEvent adds an event to the event's group.
+func (s EventService) NewEvent(ctx context.Context, event Event) (Event, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "EventService.NewEvent")
+	defer span.End()
+
+	if err := check(event); err != nil {
+		return Event{}, err
+	}
+	added, err := s.store.AddEvent(ctx, event)
+	if err != nil {
+		span.RecordError(err)
+		return Event{}, storeError("failed to add event", err)
+	}
+	eventsCreated.WithLabelValues(added.Kind).Inc()
+	return added.computed(), nil
+}
+
+// UpdateEvent replaces the details of the event with the event's ID in the
+// event's group. Its leaders and participants are kept.
+func (s EventService) UpdateEvent(ctx context.Context, event Event) (Event, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "EventService.UpdateEvent")
+	defer span.End()
+
+	if err := check(event); err != nil {
+		return Event{}, err
+	}
+	updated, err := s.store.UpdateEvent(ctx, event)
+	if err != nil {
+		span.RecordError(err)
+		return Event{}, storeError(fmt.Sprintf("failed to update event %d", event.Id), err)
+	}
+	return updated.computed(), nil
+}
+
+// DeleteEvent deletes the event of the group with the given ID. It no longer
+// counts towards the totals of the members who took part in it.
+func (s EventService) DeleteEvent(ctx context.Context, groupID, id int64) security.ClientError {
+	ctx, span := tracing.Start(ctx, "EventService.DeleteEvent")
+	defer span.End()
+
+	if err := s.store.DeleteEvent(ctx, groupID, id); err != nil {
+		span.RecordError(err)
+		return storeError(fmt.Sprintf("failed to delete event %d", id), err)
+	}
+	return nil
+}
+
+// SetParticipants replaces the members of the group taking part in the event
+// of the group and lists them.
+func (s EventService) SetParticipants(ctx context.Context, groupID, id int64, memberIDs []int64) ([]Participant, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "EventService.SetParticipants")
+	defer span.End()
+	ctx = db.WithPrimary(ctx)
+
+	if id, ok := duplicate(memberIDs); ok {
+		return nil, problem.Invalid("member %d is given more than once", id)
+	}
+	if err := s.store.SetParticipants(ctx, groupID, id, memberIDs); err != nil {
+		span.RecordError(err)
+		return nil, storeError(fmt.Sprintf("failed to set participants of event %d", id), err)
+	}
+	participants, err := s.store.ListParticipants(ctx, groupID, id)
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError(fmt.Sprintf("failed to list participants of event %d", id), err)
+	}
+	return participants, nil
+}
+
+// SetLeaders replaces the users leading the event of the group, who must be
+// leaders or admins of the group, and lists them.
+func (s EventService) SetLeaders(ctx context.Context, groupID, id int64, userIDs []int64) ([]Leader, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "EventService.SetLeaders")
+	defer span.End()
+	ctx = db.WithPrimary(ctx)
+
+	if id, ok := duplicate(userIDs); ok {
+		return nil, problem.Invalid("user %d is given more than once", id)
+	}
+	if err := s.store.SetLeaders(ctx, groupID, id, userIDs); err != nil {
+		span.RecordError(err)
+		return nil, storeError(fmt.Sprintf("failed to set leaders of event %d", id), err)
+	}
+	leaders, err := s.store.ListLeaders(ctx, groupID, id)
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError(fmt.Sprintf("failed to list leaders of event %d", id), err)
+	}
+	return leaders, nil
+}
+
+// MemberTotals totals what the member of the group did at the events they
+// took part in that ended between the dates of the filter. Events count
+// however long ago they ended if the filter has no from date, and only once
+// they have ended if it has no to date.
+func (s EventService) MemberTotals(ctx context.Context, groupID, memberID int64, filter Filter) (Totals, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "EventService.MemberTotals")
+	defer span.End()
+
+	filter, clientErr := s.dates(Filter{From: filter.From, To: filter.To})
+	if clientErr != nil {
+		return Totals{}, clientErr
+	}
+	totals, err := s.store.ListTotals(ctx, groupID, memberID, filter)
+	if err != nil {
+		span.RecordError(err)
+		return Totals{}, security.NewClientError(fmt.Sprintf("failed to total events of member %d", memberID), err)
+	} else if len(totals) == 0 {
+		return Totals{}, problem.NewError(problem.CodeNotFound, fmt.Sprintf("member %d does not exist", memberID), ErrNoSuchMember)
+	}
+	return totals[0], nil
+}
+
+// SectionTotals totals what each active member of the section of the group
+// did at events, like MemberTotals.
+func (s EventService) SectionTotals(ctx context.Context, groupID int64, filter Filter) (SectionTotals, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "EventService.SectionTotals")
+	defer span.End()
+
+	filter, clientErr := s.dates(Filter{Section: filter.Section, From: filter.From, To: filter.To})
+	if clientErr != nil {
+		return SectionTotals{}, clientErr
+	}
+	totals, err := s.store.ListTotals(ctx, groupID, 0, filter)
+	if err != nil {
+		span.RecordError(err)
+		return SectionTotals{}, security.NewClientError(fmt.Sprintf("failed to total events of %s", filter.Section), err)
+	}
+	section := SectionTotals{Section: filter.Section, To: filter.To, Members: totals}
+	if !filter.From.IsZero() {
+		section.From = &filter.From
+	}
+	return section, nil
+}
+
+// computed fills in the fields of the event computed from its dates.
+func (e Event) computed() Event {
+	e.Nights = e.StartsOn.DaysUntil(e.EndsOn)
+	return e
+}
+
+// check checks the parts of an event that request validation can't.
+func check(event Event) security.ClientError {
+	if event.EndsOn.Before(event.StartsOn) {
+		return problem.Invalid("event must not end on %s before it starts on %s", event.EndsOn, event.StartsOn)
+	}
+	if nights := event.StartsOn.DaysUntil(event.EndsOn); nights > maxNights {
+		return problem.Invalid("event must not be away for more than %d nights, got %d", maxNights, nights)
+	}
+	return nil
+}
+
+// dates fills in the default end of the filter's dates, today, and checks
+// they're in order. The start is left as it is.
+func (s EventService) dates(filter Filter) (Filter, security.ClientError) {
+	if filter.To.IsZero() {
+		filter.To = date.Today(s.location)
+	}
+	if filter.To.Before(filter.From) {
+		return Filter{}, problem.Invalid("from %s must not be after to %s", filter.From, filter.To)
+	}
+	return filter, nil
+}
+
+// duplicate finds an ID given more than once.
+func duplicate(ids []int64) (int64, bool) {
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return id, true
+		}
+		seen[id] = true
+	}
+	return 0, false
+}
+
+// storeError converts errors from the store to client errors.
+func storeError(message string, err error) security.ClientError {
+	switch {
+	case errors.Is(err, ErrNoSuchEvent):
+		return problem.NewError(problem.CodeNotFound, "event does not exist", err)
+	case errors.Is(err, ErrNoSuchMember):
+		return problem.NewError(problem.CodeValidationFailed, "a member does not exist in the group", err)
+	case errors.Is(err, ErrNoSuchLeader):
+		return problem.NewError(problem.CodeValidationFailed, "a user does not exist in the group or isn't a leader", err)
+	}
+	return security.NewClientError(message, err)
+}
@@ -0,0 +1,259 @@
+package event
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/openapi/openapitest"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/user"
+	"github.com/nick96/cubapi/user/usertest"
+	"go.uber.org/zap"
+)
+
+// Users requests are made as, and events are led by, in tests.
+var (
+	leader      = user.User{Id: 10, GroupId: testGroupID, FirstName: "Raksha", Roles: []string{user.RoleLeader}}
+	helper      = user.User{Id: 11, GroupId: testGroupID, FirstName: "Baloo", Roles: []string{user.RoleProgram}}
+	otherLeader = user.User{Id: 20, GroupId: otherGroupID, FirstName: "Shere Khan", Roles: []string{user.RoleLeader}}
+)
+
+// Members of the groups: mowgli, akela and the inactive hathi are cubs of the
+// test group, kaa a scout of it and otherCub a cub of the other group.
+const (
+	mowgli   = 1
+	akela    = 2
+	hathi    = 3
+	kaa      = 4
+	otherCub = 5
+)
+
+const camp = `{"kind": "camp", "name": "Winter camp", "location": "Gilwell Park", "startsOn": "2021-06-11", "endsOn": "2021-06-13"}`
+
+// newTestStore creates a store with the members and users of the test and
+// other groups.
+func newTestStore() *mockEventStore {
+	store := newMockEventStore()
+	store.members[mowgli] = mockMember{testGroupID, "Mowgli", group.SectionCubs, false}
+	store.members[akela] = mockMember{testGroupID, "Akela", group.SectionCubs, false}
+	store.members[hathi] = mockMember{testGroupID, "Hathi", group.SectionCubs, true}
+	store.members[kaa] = mockMember{testGroupID, "Kaa", group.SectionScouts, false}
+	store.members[otherCub] = mockMember{otherGroupID, "Tabaqui", group.SectionCubs, false}
+	for _, u := range []user.User{leader, helper, otherLeader} {
+		store.users[u.Id] = u
+	}
+	return store
+}
+
+// newTestRouter creates a router whose requests are made as the user.
+func newTestRouter(store EventStorer, u user.User) chi.Router {
+	router := chi.NewRouter()
+	router.Use(usertest.As(u))
+	router.Route("/event", NewEventRouter(zap.NewNop(), NewEventService(store, time.UTC)))
+	return router
+}
+
+func TestEventLifecycle(t *testing.T) {
+	router := newTestRouter(newTestStore(), leader)
+
+	var created Event
+	if w := openapitest.Do(t, router, "POST", "/event", camp, &created); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if created.Id == 0 || created.Kind != KindCamp || created.Nights != 2 || created.Location != "Gilwell Park" {
+		t.Errorf("Expected a two night camp to be created, got %+v", created)
+	}
+
+	var participants []Participant
+	if w := openapitest.Do(t, router, "PUT", "/event/1/participants", `{"memberIds": [1, 2]}`, &participants); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(participants) != 2 || participants[0].MemberId != mowgli || participants[0].FirstName != "Mowgli" {
+		t.Errorf("Expected Mowgli and Akela to take part, got %+v", participants)
+	}
+	var leaders []Leader
+	if w := openapitest.Do(t, router, "PUT", "/event/1/leaders", `{"userIds": [10]}`, &leaders); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(leaders) != 1 || leaders[0].UserId != leader.Id || leaders[0].FirstName != "Raksha" {
+		t.Errorf("Expected Raksha to lead, got %+v", leaders)
+	}
+
+	// Replacing the details keeps who takes part.
+	var updated Event
+	if w := openapitest.Do(t, router, "PUT", "/event/1", strings.Replace(camp, "2021-06-13", "2021-06-14", 1), &updated); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if updated.Nights != 3 {
+		t.Errorf("Expected the camp to be three nights, got %+v", updated)
+	}
+	var detail EventDetail
+	openapitest.Do(t, router, "GET", "/event/1", "", &detail)
+	if detail.Nights != 3 || len(detail.Participants) != 2 || len(detail.Leaders) != 1 {
+		t.Errorf("Expected the camp with its leader and participants, got %+v", detail)
+	}
+
+	// Replacing the participants drops those not given.
+	openapitest.Do(t, router, "PUT", "/event/1/participants", `{"memberIds": [2, 4]}`, &participants)
+	if len(participants) != 2 || participants[0].MemberId != akela || participants[1].MemberId != kaa {
+		t.Errorf("Expected Akela and Kaa to take part, got %+v", participants)
+	}
+
+	var listed []Event
+	openapitest.Do(t, router, "GET", "/event?from=2021-06-12&to=2021-06-12&kind=camp", "", &listed)
+	if len(listed) != 1 || listed[0].Id != 1 || listed[0].Nights != 3 {
+		t.Errorf("Expected the camp running in the range to be listed, got %+v", listed)
+	}
+	openapitest.Do(t, router, "GET", "/event?from=2021-06-12&to=2021-06-12&kind=hike", "", &listed)
+	if len(listed) != 0 {
+		t.Errorf("Expected other kinds of events not to be listed, got %+v", listed)
+	}
+
+	if w := openapitest.Do(t, router, "DELETE", "/event/1", "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := openapitest.Do(t, router, "GET", "/event/1", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted event not to be found, got %d", w.Code)
+	}
+}
+
+func TestTotals(t *testing.T) {
+	store := newTestStore()
+	router := newTestRouter(store, leader)
+	events := []string{
+		camp,
+		`{"kind": "hike", "name": "Day hike", "startsOn": "2021-07-03", "distance": 12.5}`,
+		`{"kind": "hike", "name": "Overnight hike", "startsOn": "2021-08-07", "endsOn": "2021-08-08", "distance": 20}`,
+		`{"kind": "paddle", "name": "River paddle", "startsOn": "2021-09-04", "distance": 8}`,
+		`{"kind": "camp", "name": "Camp last year", "startsOn": "2020-06-12", "endsOn": "2020-06-14"}`,
+	}
+	for i, body := range events {
+		openapitest.Do(t, router, "POST", "/event", body, nil)
+		openapitest.Do(t, router, "PUT", fmt.Sprintf("/event/%d/participants", i+1), `{"memberIds": [1]}`, nil)
+	}
+	openapitest.Do(t, router, "PUT", "/event/1/participants", `{"memberIds": [1, 2, 3]}`, nil)
+	// An event that hasn't ended yet doesn't count.
+	tomorrow := date.Today(time.UTC).AddDays(1).String()
+	openapitest.Do(t, router, "POST", "/event", strings.Replace(strings.Replace(camp, "2021-06-11", tomorrow, 1), "2021-06-13", tomorrow, 1), nil)
+	openapitest.Do(t, router, "PUT", "/event/6/participants", `{"memberIds": [1]}`, nil)
+
+	var totals Totals
+	if w := openapitest.Do(t, router, "GET", "/event/totals/member/1", "", &totals); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	want := Totals{MemberId: mowgli, FirstName: "Mowgli", Section: group.SectionCubs, Events: 5, Camps: 2, NightsCamped: 4, NightsAway: 5, KmHiked: 32.5, KmPaddled: 8}
+	if totals != want {
+		t.Errorf("Expected %+v, got %+v", want, totals)
+	}
+	openapitest.Do(t, router, "GET", "/event/totals/member/1?from=2021-01-01&to=2021-07-31", "", &totals)
+	if totals.Events != 2 || totals.NightsCamped != 2 || totals.KmHiked != 12.5 {
+		t.Errorf("Expected only events that ended in the range to count, got %+v", totals)
+	}
+
+	var section SectionTotals
+	if w := openapitest.Do(t, router, "GET", "/event/totals/section/cubs?from=2021-01-01", "", &section); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(section.Members) != 2 || section.From == nil || section.From.String() != "2021-01-01" {
+		t.Fatalf("Expected the active cubs from 2021, got %+v", section)
+	}
+	if a := section.Members[1]; a.MemberId != akela || a.Camps != 1 || a.NightsCamped != 2 || a.KmHiked != 0 {
+		t.Errorf("Expected Akela to have camped two nights, got %+v", a)
+	}
+	var allTime SectionTotals
+	openapitest.Do(t, router, "GET", "/event/totals/section/cubs", "", &allTime)
+	if allTime.From != nil || allTime.Members[0].Events != 5 {
+		t.Errorf("Expected every event to count without a from date, got %+v", allTime)
+	}
+
+	var resp problem.Problem
+	if w := openapitest.Do(t, router, "GET", "/event/totals/member/9", "", &resp); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a missing member not to be found, got %d: %+v", w.Code, resp)
+	}
+	if w := openapitest.Do(t, router, "GET", "/event/totals/section/wolves", "", &resp); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a missing section not to be found, got %d: %+v", w.Code, resp)
+	}
+}
+
+func TestInvalidEvents(t *testing.T) {
+	store := newTestStore()
+	router := newTestRouter(store, leader)
+	openapitest.Do(t, router, "POST", "/event", camp, nil)
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   problem.Code
+	}{
+		{"unknown-kind", "POST", "/event", `{"kind": "sail", "name": "Regatta", "startsOn": "2021-06-11"}`, problem.CodeValidationFailed},
+		{"ends-before-start", "POST", "/event", `{"kind": "camp", "name": "Camp", "startsOn": "2021-06-11", "endsOn": "2021-06-10"}`, problem.CodeValidationFailed},
+		{"too-long", "PUT", "/event/1", `{"kind": "camp", "name": "Camp", "startsOn": "2021-01-01", "endsOn": "2021-06-10"}`, problem.CodeValidationFailed},
+		{"negative-distance", "POST", "/event", `{"kind": "hike", "name": "Hike", "startsOn": "2021-06-11", "distance": -1}`, problem.CodeValidationFailed},
+		{"participant-twice", "PUT", "/event/1/participants", `{"memberIds": [1, 1]}`, problem.CodeValidationFailed},
+		{"missing-participant", "PUT", "/event/1/participants", `{"memberIds": [1, 9]}`, problem.CodeValidationFailed},
+		{"other-group-participant", "PUT", "/event/1/participants", `{"memberIds": [1, 5]}`, problem.CodeValidationFailed},
+		{"leader-not-a-leader", "PUT", "/event/1/leaders", `{"userIds": [11]}`, problem.CodeValidationFailed},
+		{"other-group-leader", "PUT", "/event/1/leaders", `{"userIds": [10, 20]}`, problem.CodeValidationFailed},
+		{"backwards-range", "GET", "/event/totals/member/1?from=2021-02-01&to=2021-01-01", "", problem.CodeValidationFailed},
+		{"missing-event", "PUT", "/event/9/participants", `{"memberIds": [1]}`, problem.CodeNotFound},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp problem.Problem
+			if w := openapitest.Do(t, router, tt.method, tt.path, tt.body, &resp); resp.Code != tt.code {
+				t.Errorf("Expected %s, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+		})
+	}
+	if len(store.events) != 1 || store.events[1].EndsOn.String() != "2021-06-13" {
+		t.Errorf("Expected invalid requests not to change events, got %+v", store.events)
+	}
+	if len(store.participants) != 0 || len(store.leaders) != 0 {
+		t.Errorf("Expected invalid requests not to change who takes part, got %+v and %+v", store.participants, store.leaders)
+	}
+}
+
+func TestEventsAreScopedToGroup(t *testing.T) {
+	store := newTestStore()
+	router, other := newTestRouter(store, leader), newTestRouter(store, otherLeader)
+	openapitest.Do(t, router, "POST", "/event", camp, nil)
+	openapitest.Do(t, router, "PUT", "/event/1/participants", `{"memberIds": [1]}`, nil)
+	openapitest.Do(t, router, "PUT", "/event/1/leaders", `{"userIds": [10]}`, nil)
+
+	var listed []Event
+	openapitest.Do(t, other, "GET", "/event?from=2021-01-01&to=2021-12-31", "", &listed)
+	if len(listed) != 0 {
+		t.Errorf("Expected another group not to list the event, got %+v", listed)
+	}
+	for _, tt := range []struct{ method, path, body string }{
+		{"GET", "/event/1", ""},
+		{"PUT", "/event/1", camp},
+		{"DELETE", "/event/1", ""},
+		{"PUT", "/event/1/participants", `{"memberIds": [5]}`},
+		{"PUT", "/event/1/leaders", `{"userIds": [20]}`},
+		{"GET", "/event/totals/member/1", ""},
+	} {
+		if w := openapitest.Do(t, other, tt.method, tt.path, tt.body, nil); w.Code != http.StatusNotFound {
+			t.Errorf("Expected %s %s from another group not to be found, got %d: %s", tt.method, tt.path, w.Code, w.Body.String())
+		}
+	}
+
+	var section SectionTotals
+	openapitest.Do(t, other, "GET", "/event/totals/section/cubs", "", &section)
+	if len(section.Members) != 1 || section.Members[0].MemberId != otherCub || section.Members[0].Events != 0 {
+		t.Errorf("Expected only the other group's cub without events, got %+v", section)
+	}
+	var detail EventDetail
+	openapitest.Do(t, router, "GET", "/event/1", "", &detail)
+	if len(detail.Participants) != 1 || len(detail.Leaders) != 1 || detail.Name != "Winter camp" {
+		t.Errorf("Expected the event to be unchanged by another group, got %+v", detail)
+	}
+}
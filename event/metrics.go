@@ -0,0 +1,11 @@
+package event
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var eventsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "autocrat_event_events_created_total",
+	Help: "Number of events created.",
+}, []string{"kind"})
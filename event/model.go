@@ -0,0 +1,95 @@
+package event
+
+import (
+	"time"
+
+	"github.com/nick96/cubapi/date"
+)
+
+// Kinds of events.
+const (
+	KindCamp = "camp"
+	KindHike = "hike"
+	// KindPaddle events are on the water, e.g. canoeing or kayaking.
+	KindPaddle = "paddle"
+)
+
+// Kinds are the kinds events can be.
+var Kinds = []string{KindCamp, KindHike, KindPaddle}
+
+// Event is an activity of a group that can run over many days, such as a
+// camp, hike or paddle.
+type Event struct {
+	Id int64 `json:"id" db:"id"`
+	// GroupId is the ID of the group of the event. It's implied by the
+	// caller's group so it isn't exposed.
+	GroupId int64 `json:"-" db:"group_id"`
+	// Kind is one of Kinds.
+	Kind     string    `json:"kind" db:"kind"`
+	Name     string    `json:"name" db:"name"`
+	Location string    `json:"location" db:"location"`
+	StartsOn date.Date `json:"startsOn" db:"starts_on"`
+	// EndsOn is the last day of the event, the day it starts for events
+	// that don't stay overnight.
+	EndsOn date.Date `json:"endsOn" db:"ends_on"`
+	// Nights is how many nights the event stays away, from the days between
+	// when it starts and ends.
+	Nights int `json:"nights" db:"-"`
+	// Distance is how many kilometres participants hike or paddle.
+	Distance  float64   `json:"distance" db:"distance"`
+	Notes     string    `json:"notes" db:"notes"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// Participant is a member who takes part in an event.
+type Participant struct {
+	EventId   int64  `json:"eventId" db:"event_id"`
+	MemberId  int64  `json:"memberId" db:"member_id"`
+	FirstName string `json:"firstName" db:"firstname"`
+	LastName  string `json:"lastName" db:"lastname"`
+	Section   string `json:"section" db:"section"`
+}
+
+// Leader is a user who leads an event.
+type Leader struct {
+	EventId   int64  `json:"eventId" db:"event_id"`
+	UserId    int64  `json:"userId" db:"user_id"`
+	FirstName string `json:"firstName" db:"firstname"`
+	LastName  string `json:"lastName" db:"lastname"`
+}
+
+// EventDetail is an event with its leaders and participants.
+type EventDetail struct {
+	Event
+	Leaders      []Leader      `json:"leaders"`
+	Participants []Participant `json:"participants"`
+}
+
+// Totals are what a member did at the events they took part in that ended
+// between two dates.
+type Totals struct {
+	MemberId  int64  `json:"memberId" db:"member_id"`
+	FirstName string `json:"firstName" db:"firstname"`
+	LastName  string `json:"lastName" db:"lastname"`
+	Section   string `json:"section" db:"section"`
+	Events    int    `json:"events" db:"events"`
+	Camps     int    `json:"camps" db:"camps"`
+	// NightsCamped are the nights of camps.
+	NightsCamped int `json:"nightsCamped" db:"nights_camped"`
+	// NightsAway are the nights of every kind of event, including overnight
+	// hikes and paddles.
+	NightsAway int     `json:"nightsAway" db:"nights_away"`
+	KmHiked    float64 `json:"kmHiked" db:"km_hiked"`
+	KmPaddled  float64 `json:"kmPaddled" db:"km_paddled"`
+}
+
+// SectionTotals are the totals of the active members of a section.
+type SectionTotals struct {
+	Section string `json:"section"`
+	// From is left out when events are counted however long ago they
+	// ended.
+	From    *date.Date `json:"from,omitempty"`
+	To      date.Date  `json:"to"`
+	Members []Totals   `json:"members"`
+}
@@ -0,0 +1,149 @@
+package event
+
+import (
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/user"
+)
+
+// DescribeEventRouter describes the operations of NewEventRouter.
+func DescribeEventRouter(r *openapi.Router) {
+	eventID := openapi.PathParam("eventID", "The ID of the event.", openapi.Integer())
+	memberID := openapi.PathParam("memberID", "The ID of the member.", openapi.Integer())
+	section := openapi.PathParam("section", "The kind of section.", openapi.Enum(group.Sections))
+	day := &openapi.Schema{Type: "string", Format: "date"}
+	denied := map[string]*openapi.Response{
+		"403": r.Problem("The request isn't authenticated, the user isn't a leader or admin, or the CSRF token is missing."),
+		"429": r.Problem("The client has made too many requests."),
+		"500": r.Problem("The request couldn't be completed."),
+	}
+	responses := func(responses map[string]*openapi.Response) map[string]*openapi.Response {
+		for status, response := range denied {
+			responses[status] = response
+		}
+		return responses
+	}
+	totalsRange := []openapi.Parameter{
+		{Name: "from", In: "query", Description: "Only count events that ended on or after the date, any time by default.", Schema: day},
+		{Name: "to", In: "query", Description: "Only count events that ended on or before the date, today by default.", Schema: day},
+	}
+
+	r.Get("/", &openapi.Operation{
+		OperationID: "listEvents",
+		Summary:     "List events",
+		Tags:        []string{"event"},
+		Security:    user.Authenticated,
+		Parameters: []openapi.Parameter{
+			{Name: "kind", In: "query", Description: "Only list events of the kind.", Schema: openapi.Enum(Kinds)},
+			{Name: "from", In: "query", Description: "The first date of the range, a year before the last by default.", Schema: day},
+			{Name: "to", In: "query", Description: "The last date of the range, today by default.", Schema: day},
+		},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The events running on any day of the range, earliest first.", []Event{}),
+			"400": r.Problem("The range of dates is invalid."),
+		}),
+	})
+	r.Post("/", &openapi.Operation{
+		OperationID: "createEvent",
+		Summary:     "Add an event",
+		Tags:        []string{"event"},
+		Security:    user.Authenticated,
+		RequestBody: r.JSONBody(EventRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"201": r.JSON("The added event.", EventResponse{}),
+			"400": r.Problem("The request body is invalid or the event ends before it starts."),
+		}),
+	})
+	r.Get("/{eventID}", &openapi.Operation{
+		OperationID: "getEvent",
+		Summary:     "Get an event",
+		Description: "The event with its leaders and participants.",
+		Tags:        []string{"event"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{eventID},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The event.", EventDetailResponse{}),
+			"404": r.Problem("The event doesn't exist in the group."),
+		}),
+	})
+	r.Put("/{eventID}", &openapi.Operation{
+		OperationID: "updateEvent",
+		Summary:     "Replace the details of an event",
+		Description: "Its leaders and participants are kept.",
+		Tags:        []string{"event"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{eventID},
+		RequestBody: r.JSONBody(EventRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The updated event.", EventResponse{}),
+			"400": r.Problem("The request body is invalid or the event ends before it starts."),
+			"404": r.Problem("The event doesn't exist in the group."),
+		}),
+	})
+	r.Delete("/{eventID}", &openapi.Operation{
+		OperationID: "deleteEvent",
+		Summary:     "Delete an event",
+		Description: "It no longer counts towards the totals of the members who took part in it.",
+		Tags:        []string{"event"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{eventID},
+		Responses: responses(map[string]*openapi.Response{
+			"204": openapi.Empty("The event has been deleted."),
+			"404": r.Problem("The event doesn't exist in the group."),
+		}),
+	})
+	r.Put("/{eventID}/participants", &openapi.Operation{
+		OperationID: "setEventParticipants",
+		Summary:     "Replace the members taking part in an event",
+		Description: "Either every member is set or, if any of them don't exist in the group, none are.",
+		Tags:        []string{"event"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{eventID},
+		RequestBody: r.JSONBody(ParticipantsRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The members taking part, ordered by name.", []Participant{}),
+			"400": r.Problem("The request body is invalid, or a member is given twice or doesn't exist in the group."),
+			"404": r.Problem("The event doesn't exist in the group."),
+		}),
+	})
+	r.Put("/{eventID}/leaders", &openapi.Operation{
+		OperationID: "setEventLeaders",
+		Summary:     "Replace the users leading an event",
+		Description: "Leaders must be leaders or admins of the group.",
+		Tags:        []string{"event"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{eventID},
+		RequestBody: r.JSONBody(LeadersRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The users leading the event, ordered by name.", []Leader{}),
+			"400": r.Problem("The request body is invalid, or a user is given twice, doesn't exist in the group or isn't a leader."),
+			"404": r.Problem("The event doesn't exist in the group."),
+		}),
+	})
+	r.Get("/totals/member/{memberID}", &openapi.Operation{
+		OperationID: "getMemberEventTotals",
+		Summary:     "Get a member's nights away and kilometres",
+		Description: "Totals of the events the member took part in that ended in the range. Nights camped are the nights of camps, nights away the nights of every kind of event.",
+		Tags:        []string{"event"},
+		Security:    user.Authenticated,
+		Parameters:  append([]openapi.Parameter{memberID}, totalsRange...),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The member's totals.", TotalsResponse{}),
+			"400": r.Problem("The range of dates is invalid."),
+			"404": r.Problem("The member doesn't exist in the group."),
+		}),
+	})
+	r.Get("/totals/section/{section}", &openapi.Operation{
+		OperationID: "getSectionEventTotals",
+		Summary:     "Get the nights away and kilometres of a section's members",
+		Description: "The totals of each active member of the section.",
+		Tags:        []string{"event"},
+		Security:    user.Authenticated,
+		Parameters:  append([]openapi.Parameter{section}, totalsRange...),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The section's totals with its members ordered by name.", SectionTotalsResponse{}),
+			"400": r.Problem("The range of dates is invalid."),
+			"404": r.Problem("The section doesn't exist."),
+		}),
+	})
+}
@@ -0,0 +1,43 @@
+package event
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/openapi/openapitest"
+)
+
+// TestOpenAPIContract checks that the handlers behave as the OpenAPI document
+// says they do. If this fails either the handlers or DescribeEventRouter
+// need updating.
+func TestOpenAPIContract(t *testing.T) {
+	router := newTestRouter(newTestStore(), leader)
+
+	doc := openapi.New("autocrat", "test")
+	doc.Route("/event", DescribeEventRouter)
+	if err := doc.CheckRoutes(router); err != nil {
+		t.Fatal(err)
+	}
+
+	openapitest.Run(t, doc, router, []openapitest.Case{
+		{Name: "create", Method: "POST", Pattern: "/event", Body: camp, Status: http.StatusCreated},
+		{Name: "create-invalid", Method: "POST", Pattern: "/event", Body: `{"kind": "sail"}`, Invalid: true, Status: http.StatusBadRequest},
+		{Name: "list", Method: "GET", Pattern: "/event", Path: "/event?kind=camp&from=2021-01-01", Status: http.StatusOK},
+		{Name: "list-invalid", Method: "GET", Pattern: "/event", Path: "/event?from=2021-01-01&to=2020-01-01", Status: http.StatusBadRequest},
+		{Name: "get", Method: "GET", Pattern: "/event/{eventID}", Path: "/event/1", Status: http.StatusOK},
+		{Name: "get-missing", Method: "GET", Pattern: "/event/{eventID}", Path: "/event/9", Status: http.StatusNotFound},
+		{Name: "update", Method: "PUT", Pattern: "/event/{eventID}", Path: "/event/1", Body: camp, Status: http.StatusOK},
+		{Name: "update-missing", Method: "PUT", Pattern: "/event/{eventID}", Path: "/event/9", Body: camp, Status: http.StatusNotFound},
+		{Name: "participants", Method: "PUT", Pattern: "/event/{eventID}/participants", Path: "/event/1/participants", Body: `{"memberIds": [1, 2]}`, Status: http.StatusOK},
+		{Name: "participants-missing-member", Method: "PUT", Pattern: "/event/{eventID}/participants", Path: "/event/1/participants", Body: `{"memberIds": [9]}`, Status: http.StatusBadRequest},
+		{Name: "leaders", Method: "PUT", Pattern: "/event/{eventID}/leaders", Path: "/event/1/leaders", Body: `{"userIds": [10]}`, Status: http.StatusOK},
+		{Name: "leaders-missing-event", Method: "PUT", Pattern: "/event/{eventID}/leaders", Path: "/event/9/leaders", Body: `{"userIds": [10]}`, Status: http.StatusNotFound},
+		{Name: "member-totals", Method: "GET", Pattern: "/event/totals/member/{memberID}", Path: "/event/totals/member/1?from=2021-01-01", Status: http.StatusOK},
+		{Name: "member-totals-missing", Method: "GET", Pattern: "/event/totals/member/{memberID}", Path: "/event/totals/member/9", Status: http.StatusNotFound},
+		{Name: "section-totals", Method: "GET", Pattern: "/event/totals/section/{section}", Path: "/event/totals/section/cubs", Status: http.StatusOK},
+		{Name: "section-totals-missing", Method: "GET", Pattern: "/event/totals/section/{section}", Path: "/event/totals/section/wolves", Status: http.StatusNotFound},
+		{Name: "delete", Method: "DELETE", Pattern: "/event/{eventID}", Path: "/event/1", Status: http.StatusNoContent},
+		{Name: "delete-missing", Method: "DELETE", Pattern: "/event/{eventID}", Path: "/event/1", Status: http.StatusNotFound},
+	})
+}
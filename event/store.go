@@ -0,0 +1,309 @@
+package event
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/user"
+)
+
+var (
+	// ErrNoSuchEvent is returned when an event doesn't exist.
+	ErrNoSuchEvent = errors.New("event does not exist")
+	// ErrNoSuchMember is returned when a member taking part in an event
+	// doesn't exist in the event's group.
+	ErrNoSuchMember = errors.New("member does not exist")
+	// ErrNoSuchLeader is returned when a user leading an event doesn't exist
+	// in the event's group or isn't a leader or admin.
+	ErrNoSuchLeader = errors.New("leader does not exist")
+)
+
+// leaderRoles are the roles users leading events must have one of.
+var leaderRoles = []string{user.RoleAdmin, user.RoleLeader}
+
+// Filter restricts the events listed and the totals counted. Empty fields
+// match every event.
+type Filter struct {
+	// Kind restricts the events listed.
+	Kind string
+	// Section restricts the totals counted to the active members of the
+	// section.
+	Section string
+	From    date.Date
+	To      date.Date
+}
+
+// EventStorer is an interface that must be implemented by things that store
+// events. Everything is scoped to a group.
+type EventStorer interface {
+	GetEvent(ctx context.Context, groupID, id int64) (Event, bool, error)
+	// ListEvents lists the events that run on any day between the dates of
+	// the filter.
+	ListEvents(ctx context.Context, groupID int64, filter Filter) ([]Event, error)
+	AddEvent(ctx context.Context, event Event) (Event, error)
+	UpdateEvent(ctx context.Context, event Event) (Event, error)
+	DeleteEvent(ctx context.Context, groupID, id int64) error
+	ListParticipants(ctx context.Context, groupID, eventID int64) ([]Participant, error)
+	// SetParticipants replaces the members taking part in the event of the
+	// group. Nothing changes unless every member is in the group.
+	SetParticipants(ctx context.Context, groupID, eventID int64, memberIDs []int64) error
+	ListLeaders(ctx context.Context, groupID, eventID int64) ([]Leader, error)
+	// SetLeaders replaces the users leading the event of the group. Nothing
+	// changes unless every user is a leader or admin of the group.
+	SetLeaders(ctx context.Context, groupID, eventID int64, userIDs []int64) error
+	// ListTotals totals what members of the group did at events that ended
+	// between the dates of the filter, from any time if it doesn't have a
+	// from date. Only active members of its section are counted if the
+	// filter has one; memberID restricts it to the member if it isn't zero.
+	ListTotals(ctx context.Context, groupID, memberID int64, filter Filter) ([]Totals, error)
+}
+
+// EventStore is a store for events. It implements the EventStorer interface.
+type EventStore struct {
+	cluster *db.Cluster
+}
+
+// NewStore creates a new store from the given cluster. Reads go to a replica
+// unless the primary is forced with db.WithPrimary.
+func NewStore(cluster *db.Cluster) EventStorer {
+	return EventStore{cluster}
+}
+
+// GetEvent gets the event of the group with the given ID.
+func (s EventStore) GetEvent(ctx context.Context, groupID, id int64) (event Event, found bool, err error) {
+	query := `SELECT * FROM autocrat.events WHERE group_id = $1 AND id = $2;`
+	err = s.cluster.Reader(ctx).Named("event.get_event").QueryRowx(ctx, query, groupID, id).StructScan(&event)
+	if err == sql.ErrNoRows {
+		return Event{}, false, nil
+	} else if err != nil {
+		return Event{}, false, fmt.Errorf("could not get event %d: %w", id, err)
+	}
+	return event, true, nil
+}
+
+// ListEvents lists the events of the group matching the filter, earliest
+// first.
+func (s EventStore) ListEvents(ctx context.Context, groupID int64, filter Filter) ([]Event, error) {
+	events := []Event{}
+	query := `
+	SELECT * FROM autocrat.events
+	WHERE group_id = $1 AND ($2 = '' OR kind = $2) AND ends_on >= $3 AND starts_on <= $4
+	ORDER BY starts_on, ends_on, id;
+	`
+	err := s.cluster.Reader(ctx).Named("event.list_events").Select(ctx, &events, query, groupID, filter.Kind, filter.From, filter.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	return events, nil
+}
+
+// AddEvent adds the event and returns it as it was stored.
+func (s EventStore) AddEvent(ctx context.Context, event Event) (Event, error) {
+	var added Event
+	query := `
+	INSERT INTO autocrat.events (group_id, kind, name, location, starts_on, ends_on, distance, notes)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING *;
+	`
+	err := s.cluster.Primary().Named("event.add_event").
+		QueryRowx(ctx, query, event.GroupId, event.Kind, event.Name, event.Location, event.StartsOn, event.EndsOn, event.Distance, event.Notes).
+		StructScan(&added)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to insert event into store: %w", err)
+	}
+	return added, nil
+}
+
+// UpdateEvent replaces the details of the event of the group with the
+// event's ID and returns it as it was stored.
+func (s EventStore) UpdateEvent(ctx context.Context, event Event) (Event, error) {
+	var updated Event
+	query := `
+	UPDATE autocrat.events
+	SET kind = $3, name = $4, location = $5, starts_on = $6, ends_on = $7, distance = $8, notes = $9, updated_at = now()
+	WHERE group_id = $1 AND id = $2
+	RETURNING *;
+	`
+	err := s.cluster.Primary().Named("event.update_event").
+		QueryRowx(ctx, query, event.GroupId, event.Id, event.Kind, event.Name, event.Location, event.StartsOn, event.EndsOn, event.Distance, event.Notes).
+		StructScan(&updated)
+	if err == sql.ErrNoRows {
+		return Event{}, fmt.Errorf("failed to update event %d: %w", event.Id, ErrNoSuchEvent)
+	} else if err != nil {
+		return Event{}, fmt.Errorf("failed to update event %d: %w", event.Id, err)
+	}
+	return updated, nil
+}
+
+// DeleteEvent deletes the event of the group with the given ID, along with
+// who took part in and led it.
+func (s EventStore) DeleteEvent(ctx context.Context, groupID, id int64) error {
+	query := `DELETE FROM autocrat.events WHERE group_id = $1 AND id = $2;`
+	result, err := s.cluster.Primary().Named("event.delete_event").Exec(ctx, query, groupID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete event %d: %w", id, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete event %d: %w", id, err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("failed to delete event %d: %w", id, ErrNoSuchEvent)
+	}
+	return nil
+}
+
+// ListParticipants lists the members taking part in the event of the group,
+// ordered by name.
+func (s EventStore) ListParticipants(ctx context.Context, groupID, eventID int64) ([]Participant, error) {
+	participants := []Participant{}
+	query := `
+	SELECT p.event_id, p.member_id, m.firstname, m.lastname, m.section
+	FROM autocrat.event_participants p
+	JOIN autocrat.events e ON e.id = p.event_id
+	JOIN autocrat.members m ON m.id = p.member_id
+	WHERE e.group_id = $1 AND p.event_id = $2
+	ORDER BY m.lastname, m.firstname, m.id;
+	`
+	if err := s.cluster.Reader(ctx).Named("event.list_participants").Select(ctx, &participants, query, groupID, eventID); err != nil {
+		return nil, fmt.Errorf("failed to list participants of event %d: %w", eventID, err)
+	}
+	return participants, nil
+}
+
+// SetParticipants replaces the members taking part in the event of the
+// group. The members are checked to be in the group in the same statement so
+// a member moving between groups can't slip through.
+func (s EventStore) SetParticipants(ctx context.Context, groupID, eventID int64, memberIDs []int64) error {
+	var eventFound, valid bool
+	query := `
+	WITH wanted AS (
+		SELECT DISTINCT unnest($3::INTEGER[]) AS member_id
+	), valid AS (
+		SELECT count(*) = (SELECT count(*) FROM wanted) AS ok
+		FROM wanted JOIN autocrat.members m ON m.id = wanted.member_id
+		WHERE m.group_id = $1::INTEGER
+	), event AS (
+		SELECT id FROM autocrat.events WHERE group_id = $1::INTEGER AND id = $2::INTEGER
+	), removed AS (
+		DELETE FROM autocrat.event_participants p
+		USING event, valid
+		WHERE p.event_id = event.id AND valid.ok AND p.member_id <> ALL($3::INTEGER[])
+	), added AS (
+		INSERT INTO autocrat.event_participants (event_id, member_id)
+		SELECT event.id, wanted.member_id FROM event, valid, wanted
+		WHERE valid.ok
+		ON CONFLICT DO NOTHING
+	)
+	SELECT EXISTS (SELECT 1 FROM event), (SELECT ok FROM valid);
+	`
+	err := s.cluster.Primary().Named("event.set_participants").
+		QueryRowx(ctx, query, groupID, eventID, pq.Array(memberIDs)).
+		Scan(&eventFound, &valid)
+	switch {
+	case err != nil:
+		return fmt.Errorf("failed to set participants of event %d: %w", eventID, err)
+	case !eventFound:
+		return fmt.Errorf("failed to set participants of event %d: %w", eventID, ErrNoSuchEvent)
+	case !valid:
+		return fmt.Errorf("failed to set participants of event %d: %w", eventID, ErrNoSuchMember)
+	}
+	return nil
+}
+
+// ListLeaders lists the users leading the event of the group, ordered by
+// name.
+func (s EventStore) ListLeaders(ctx context.Context, groupID, eventID int64) ([]Leader, error) {
+	leaders := []Leader{}
+	query := `
+	SELECT l.event_id, l.user_id, u.firstname, u.lastname
+	FROM autocrat.event_leaders l
+	JOIN autocrat.events e ON e.id = l.event_id
+	JOIN autocrat.users u ON u.id = l.user_id
+	WHERE e.group_id = $1 AND l.event_id = $2
+	ORDER BY u.lastname, u.firstname, u.id;
+	`
+	if err := s.cluster.Reader(ctx).Named("event.list_leaders").Select(ctx, &leaders, query, groupID, eventID); err != nil {
+		return nil, fmt.Errorf("failed to list leaders of event %d: %w", eventID, err)
+	}
+	return leaders, nil
+}
+
+// SetLeaders replaces the users leading the event of the group. The users
+// are checked to be leaders or admins of the group in the same statement.
+func (s EventStore) SetLeaders(ctx context.Context, groupID, eventID int64, userIDs []int64) error {
+	var eventFound, valid bool
+	query := `
+	WITH wanted AS (
+		SELECT DISTINCT unnest($3::INTEGER[]) AS user_id
+	), valid AS (
+		SELECT count(*) = (SELECT count(*) FROM wanted) AS ok
+		FROM wanted JOIN autocrat.users u ON u.id = wanted.user_id
+		WHERE u.group_id = $1::INTEGER AND u.roles && $4::TEXT[]
+	), event AS (
+		SELECT id FROM autocrat.events WHERE group_id = $1::INTEGER AND id = $2::INTEGER
+	), removed AS (
+		DELETE FROM autocrat.event_leaders l
+		USING event, valid
+		WHERE l.event_id = event.id AND valid.ok AND l.user_id <> ALL($3::INTEGER[])
+	), added AS (
+		INSERT INTO autocrat.event_leaders (event_id, user_id)
+		SELECT event.id, wanted.user_id FROM event, valid, wanted
+		WHERE valid.ok
+		ON CONFLICT DO NOTHING
+	)
+	SELECT EXISTS (SELECT 1 FROM event), (SELECT ok FROM valid);
+	`
+	err := s.cluster.Primary().Named("event.set_leaders").
+		QueryRowx(ctx, query, groupID, eventID, pq.Array(userIDs), pq.Array(leaderRoles)).
+		Scan(&eventFound, &valid)
+	switch {
+	case err != nil:
+		return fmt.Errorf("failed to set leaders of event %d: %w", eventID, err)
+	case !eventFound:
+		return fmt.Errorf("failed to set leaders of event %d: %w", eventID, ErrNoSuchEvent)
+	case !valid:
+		return fmt.Errorf("failed to set leaders of event %d: %w", eventID, ErrNoSuchLeader)
+	}
+	return nil
+}
+
+// ListTotals totals what members of the group did at events that ended
+// between the dates of the filter, ordered by name.
+func (s EventStore) ListTotals(ctx context.Context, groupID, memberID int64, filter Filter) ([]Totals, error) {
+	totals := []Totals{}
+	query := `
+	WITH ended AS (
+		SELECT id, kind, ends_on - starts_on AS nights, distance
+		FROM autocrat.events
+		WHERE group_id = $1 AND ($2::DATE IS NULL OR ends_on >= $2::DATE) AND ends_on <= $3
+	)
+	SELECT
+		m.id AS member_id, m.firstname, m.lastname, m.section,
+		count(e.id) AS events,
+		count(e.id) FILTER (WHERE e.kind = 'camp') AS camps,
+		COALESCE(sum(e.nights) FILTER (WHERE e.kind = 'camp'), 0) AS nights_camped,
+		COALESCE(sum(e.nights), 0) AS nights_away,
+		COALESCE(sum(e.distance) FILTER (WHERE e.kind = 'hike'), 0) AS km_hiked,
+		COALESCE(sum(e.distance) FILTER (WHERE e.kind = 'paddle'), 0) AS km_paddled
+	FROM autocrat.members m
+	LEFT JOIN autocrat.event_participants p ON p.member_id = m.id
+	LEFT JOIN ended e ON e.id = p.event_id
+	WHERE m.group_id = $1
+		AND ($4 = '' OR (m.section = $4 AND m.status = 'active'))
+		AND ($5 = 0 OR m.id = $5)
+	GROUP BY m.id
+	ORDER BY m.lastname, m.firstname, m.id;
+	`
+	err := s.cluster.Reader(ctx).Named("event.list_totals").
+		Select(ctx, &totals, query, groupID, filter.From, filter.To, filter.Section, memberID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to total events: %w", err)
+	}
+	return totals, nil
+}
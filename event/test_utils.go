@@ -0,0 +1,212 @@
+package event
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/nick96/cubapi/user"
+)
+
+// Groups events belong to in tests.
+const (
+	testGroupID  = 1
+	otherGroupID = 2
+)
+
+// mockMember is a member of a group in a section.
+type mockMember struct {
+	groupID  int64
+	name     string
+	section  string
+	inactive bool
+}
+
+// takingPart identifies a member or user taking part in or leading an event.
+type takingPart struct {
+	eventID, id int64
+}
+
+// mockEventStore stores events in memory.
+type mockEventStore struct {
+	events       map[int64]Event
+	members      map[int64]mockMember
+	users        map[int64]user.User
+	participants map[takingPart]bool
+	leaders      map[takingPart]bool
+}
+
+func newMockEventStore() *mockEventStore {
+	return &mockEventStore{
+		events:       make(map[int64]Event),
+		members:      make(map[int64]mockMember),
+		users:        make(map[int64]user.User),
+		participants: make(map[takingPart]bool),
+		leaders:      make(map[takingPart]bool),
+	}
+}
+
+func (s *mockEventStore) GetEvent(ctx context.Context, groupID, id int64) (Event, bool, error) {
+	event, ok := s.events[id]
+	if !ok || event.GroupId != groupID {
+		return Event{}, false, nil
+	}
+	return event, true, nil
+}
+
+func (s *mockEventStore) ListEvents(ctx context.Context, groupID int64, filter Filter) ([]Event, error) {
+	events := []Event{}
+	for _, event := range s.events {
+		if event.GroupId == groupID && (filter.Kind == "" || event.Kind == filter.Kind) &&
+			!event.EndsOn.Before(filter.From) && !event.StartsOn.After(filter.To) {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].StartsOn != events[j].StartsOn {
+			return events[i].StartsOn.Before(events[j].StartsOn)
+		}
+		return events[i].Id < events[j].Id
+	})
+	return events, nil
+}
+
+func (s *mockEventStore) AddEvent(ctx context.Context, event Event) (Event, error) {
+	event.Id = int64(len(s.events) + 1)
+	for s.events[event.Id].Id != 0 {
+		event.Id++
+	}
+	event.CreatedAt = time.Now()
+	event.UpdatedAt = event.CreatedAt
+	s.events[event.Id] = event
+	return event, nil
+}
+
+func (s *mockEventStore) UpdateEvent(ctx context.Context, event Event) (Event, error) {
+	existing, ok := s.events[event.Id]
+	if !ok || existing.GroupId != event.GroupId {
+		return Event{}, ErrNoSuchEvent
+	}
+	event.CreatedAt = existing.CreatedAt
+	event.UpdatedAt = time.Now()
+	s.events[event.Id] = event
+	return event, nil
+}
+
+func (s *mockEventStore) DeleteEvent(ctx context.Context, groupID, id int64) error {
+	if event, ok := s.events[id]; !ok || event.GroupId != groupID {
+		return ErrNoSuchEvent
+	}
+	delete(s.events, id)
+	for key := range s.participants {
+		if key.eventID == id {
+			delete(s.participants, key)
+		}
+	}
+	for key := range s.leaders {
+		if key.eventID == id {
+			delete(s.leaders, key)
+		}
+	}
+	return nil
+}
+
+func (s *mockEventStore) ListParticipants(ctx context.Context, groupID, eventID int64) ([]Participant, error) {
+	participants := []Participant{}
+	if event, ok := s.events[eventID]; !ok || event.GroupId != groupID {
+		return participants, nil
+	}
+	for key := range s.participants {
+		if key.eventID == eventID {
+			member := s.members[key.id]
+			participants = append(participants, Participant{EventId: eventID, MemberId: key.id, FirstName: member.name, Section: member.section})
+		}
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i].MemberId < participants[j].MemberId })
+	return participants, nil
+}
+
+func (s *mockEventStore) SetParticipants(ctx context.Context, groupID, eventID int64, memberIDs []int64) error {
+	if event, ok := s.events[eventID]; !ok || event.GroupId != groupID {
+		return ErrNoSuchEvent
+	}
+	for _, id := range memberIDs {
+		if member, ok := s.members[id]; !ok || member.groupID != groupID {
+			return ErrNoSuchMember
+		}
+	}
+	replace(s.participants, eventID, memberIDs)
+	return nil
+}
+
+func (s *mockEventStore) ListLeaders(ctx context.Context, groupID, eventID int64) ([]Leader, error) {
+	leaders := []Leader{}
+	if event, ok := s.events[eventID]; !ok || event.GroupId != groupID {
+		return leaders, nil
+	}
+	for key := range s.leaders {
+		if key.eventID == eventID {
+			u := s.users[key.id]
+			leaders = append(leaders, Leader{EventId: eventID, UserId: key.id, FirstName: u.FirstName, LastName: u.LastName})
+		}
+	}
+	sort.Slice(leaders, func(i, j int) bool { return leaders[i].UserId < leaders[j].UserId })
+	return leaders, nil
+}
+
+func (s *mockEventStore) SetLeaders(ctx context.Context, groupID, eventID int64, userIDs []int64) error {
+	if event, ok := s.events[eventID]; !ok || event.GroupId != groupID {
+		return ErrNoSuchEvent
+	}
+	for _, id := range userIDs {
+		if u, ok := s.users[id]; !ok || u.GroupId != groupID || !(u.HasRole(user.RoleAdmin) || u.HasRole(user.RoleLeader)) {
+			return ErrNoSuchLeader
+		}
+	}
+	replace(s.leaders, eventID, userIDs)
+	return nil
+}
+
+// replace replaces who takes part in the event.
+func replace(set map[takingPart]bool, eventID int64, ids []int64) {
+	for key := range set {
+		if key.eventID == eventID {
+			delete(set, key)
+		}
+	}
+	for _, id := range ids {
+		set[takingPart{eventID, id}] = true
+	}
+}
+
+func (s *mockEventStore) ListTotals(ctx context.Context, groupID, memberID int64, filter Filter) ([]Totals, error) {
+	totals := []Totals{}
+	for id, member := range s.members {
+		if member.groupID != groupID || (memberID != 0 && id != memberID) ||
+			(filter.Section != "" && (member.section != filter.Section || member.inactive)) {
+			continue
+		}
+		t := Totals{MemberId: id, FirstName: member.name, Section: member.section}
+		for _, event := range s.events {
+			if !s.participants[takingPart{event.Id, id}] || event.GroupId != groupID ||
+				(!filter.From.IsZero() && event.EndsOn.Before(filter.From)) || event.EndsOn.After(filter.To) {
+				continue
+			}
+			nights := event.StartsOn.DaysUntil(event.EndsOn)
+			t.Events++
+			t.NightsAway += nights
+			switch event.Kind {
+			case KindCamp:
+				t.Camps++
+				t.NightsCamped += nights
+			case KindHike:
+				t.KmHiked += event.Distance
+			case KindPaddle:
+				t.KmPaddled += event.Distance
+			}
+		}
+		totals = append(totals, t)
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].MemberId < totals[j].MemberId })
+	return totals, nil
+}
@@ -212,6 +212,7 @@ const SignUpDialog: FunctionComponent<SignUpDialogProps> = (props) => {
             firstName: "",
             lastName: "",
             password: "",
+            group: "",
         },
         onSubmit: values => {
             fetch(`${AUTOCRAT_SERVICE_URI}/user`, {
@@ -249,6 +250,7 @@ const SignUpDialog: FunctionComponent<SignUpDialogProps> = (props) => {
             firstName: Yup.string().required("Required"),
             lastName: Yup.string().required("Required"),
             password: Yup.string().min(6, "Must be at least 6 characterse").required("Required"),
+            group: Yup.string().required("Required"),
         }),
     });
     return (
@@ -269,6 +271,9 @@ const SignUpDialog: FunctionComponent<SignUpDialogProps> = (props) => {
                     <TextField fullWidth label="Password" id="password" name="password" type="password"
                         onChange={handleChange} value={values.password} error={!!errors.password}
                         helperText={errors.password || null} />
+                    <TextField fullWidth label="Group" id="group" name="group"
+                        onChange={handleChange} value={values.group} error={!!errors.group}
+                        helperText={errors.group || "The group's slug, e.g. 1st-springfield"} />
                 </DialogContent>
 
                 <DialogActions>
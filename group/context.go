@@ -0,0 +1,37 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/nick96/cubapi/problem"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of the context holding the ID of the caller's
+// group.
+func NewContext(ctx context.Context, groupID int64) context.Context {
+	return context.WithValue(ctx, contextKey{}, groupID)
+}
+
+// IDFromContext returns the ID of the caller's group in the context, if there
+// is one.
+func IDFromContext(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(contextKey{}).(int64)
+	return id, ok
+}
+
+// FromRequest returns the ID of the caller's group. Handlers that read or
+// write a group's data must only be mounted behind authentication, which
+// puts the group in the context, so a problem is written if it isn't there
+// rather than risk returning another group's data.
+func FromRequest(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, ok := IDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Internal(errors.New("request has no group, is the handler behind authentication?")))
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,161 @@
+package group
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/problem"
+	"go.uber.org/zap"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// SectionRequest adds a section to the caller's group.
+type SectionRequest struct {
+	Kind string `json:"kind" validate:"oneof=joeys cubs scouts venturers rovers"`
+	Name string `json:"name" validate:"required,max=256"`
+}
+
+type GroupResponse Group
+
+func (g GroupResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type SectionResponse Section
+
+func (s SectionResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// NewGroupRouter creates a router for the endpoints of the caller's group. The
+// group comes from the context so the router must only be mounted behind
+// authentication. Changes to the group are passed through adminOnly.
+//
+// GET /: Get the caller's group and its sections.
+// POST /section: Add a section.
+// PUT /section/{sectionID}/leader/{userID}: Make a user a leader of a section.
+// DELETE /section/{sectionID}/leader/{userID}: Stop a user leading a section.
+func NewGroupRouter(logger *zap.Logger, service GroupService, adminOnly func(http.Handler) http.Handler) func(chi.Router) {
+	validate := problem.NewValidator()
+	return func(r chi.Router) {
+		r.Get("/", getGroup(logger, service))
+		r.With(adminOnly).Post("/section", newSection(logger, validate, service))
+		r.With(adminOnly).Put("/section/{sectionID}/leader/{userID}", addLeader(logger, service))
+		r.With(adminOnly).Delete("/section/{sectionID}/leader/{userID}", removeLeader(logger, service))
+	}
+}
+
+func getGroup(logger *zap.Logger, service GroupService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := FromRequest(w, r)
+		if !ok {
+			return
+		}
+		group, err := service.GetGroup(r.Context(), groupID)
+		if err != nil {
+			logger.Error("Failed to get group", zap.Int64("groupID", groupID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, GroupResponse(group))
+	}
+}
+
+func newSection(logger *zap.Logger, validate *validator.Validate, service GroupService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := FromRequest(w, r)
+		if !ok {
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.Info("Failed to read request body", zap.Error(err))
+			problem.Write(w, r, problem.Internal(err))
+			return
+		}
+		defer r.Body.Close()
+
+		var request SectionRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			logger.Info("Failed to unmarshal section request", zap.Error(err))
+			problem.Write(w, r, problem.Validation("Section request body is invalid JSON", err))
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			logger.Info("Invalid section request", zap.Error(err))
+			problem.Write(w, r, problem.Validation("Invalid request body", err))
+			return
+		}
+
+		section, clientErr := service.NewSection(r.Context(), Section{GroupId: groupID, Kind: request.Kind, Name: request.Name})
+		if clientErr != nil {
+			logger.Info("Failed to add section", zap.Error(clientErr))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, clientErr))
+			return
+		}
+		logger.Info("Added section", zap.Int64("sectionID", section.Id), zap.String("kind", section.Kind))
+		render.Status(r, http.StatusCreated)
+		render.Render(w, r, SectionResponse(section))
+	}
+}
+
+func addLeader(logger *zap.Logger, service GroupService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, sectionID, userID, ok := leaderParams(w, r)
+		if !ok {
+			return
+		}
+		if err := service.AddLeader(r.Context(), groupID, sectionID, userID); err != nil {
+			logger.Info("Failed to add leader", zap.Int64("sectionID", sectionID), zap.Int64("leaderID", userID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Added leader", zap.Int64("sectionID", sectionID), zap.Int64("leaderID", userID))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func removeLeader(logger *zap.Logger, service GroupService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, sectionID, userID, ok := leaderParams(w, r)
+		if !ok {
+			return
+		}
+		if err := service.RemoveLeader(r.Context(), groupID, sectionID, userID); err != nil {
+			logger.Info("Failed to remove leader", zap.Int64("sectionID", sectionID), zap.Int64("leaderID", userID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Removed leader", zap.Int64("sectionID", sectionID), zap.Int64("leaderID", userID))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// leaderParams gets the caller's group and parses the section and user IDs in
+// the path. Anything that isn't an ID can't exist so it's not found.
+func leaderParams(w http.ResponseWriter, r *http.Request) (groupID, sectionID, userID int64, ok bool) {
+	groupID, ok = FromRequest(w, r)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	sectionID, err := strconv.ParseInt(chi.URLParam(r, "sectionID"), 10, 64)
+	if err != nil {
+		problem.Write(w, r, problem.New(problem.CodeNotFound, "Section does not exist"))
+		return 0, 0, 0, false
+	}
+	userID, err = strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		problem.Write(w, r, problem.New(problem.CodeNotFound, "User does not exist"))
+		return 0, 0, 0, false
+	}
+	return groupID, sectionID, userID, true
+}
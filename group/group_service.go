@@ -0,0 +1,164 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/security"
+	"github.com/nick96/cubapi/tracing"
+)
+
+// CodeSectionAlreadyExists is the problem code of adding a section of a kind
+// the group already has.
+const CodeSectionAlreadyExists problem.Code = "section_already_exists"
+
+func init() {
+	problem.Register(CodeSectionAlreadyExists, http.StatusConflict, "Section already exists")
+}
+
+// slugPattern matches valid group slugs: lower case words separated by single
+// hyphens.
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type GroupService struct {
+	store GroupStorer
+}
+
+// NewGroupService creates a GroupService that stores groups in the store.
+func NewGroupService(store GroupStorer) GroupService {
+	return GroupService{store: store}
+}
+
+// GetGroup gets the group with the given ID and its sections.
+func (s GroupService) GetGroup(ctx context.Context, id int64) (Group, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "GroupService.GetGroup")
+	defer span.End()
+
+	group, found, err := s.store.GetGroup(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return Group{}, security.NewClientError(fmt.Sprintf("failed to get group %d", id), err)
+	} else if !found {
+		return Group{}, problem.NewError(problem.CodeNotFound, fmt.Sprintf("group %d does not exist", id), ErrNoSuchGroup)
+	}
+	group.Sections, err = s.store.ListSections(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return Group{}, security.NewClientError(fmt.Sprintf("failed to get sections of group %d", id), err)
+	}
+	return group, nil
+}
+
+// FindGroup finds the group with the given slug.
+func (s GroupService) FindGroup(ctx context.Context, slug string) (Group, security.ClientError) {
+	group, found, err := s.store.FindBySlug(ctx, slug)
+	if err != nil {
+		return Group{}, security.NewClientError(fmt.Sprintf("failed to find group %s", slug), err)
+	} else if !found {
+		return Group{}, problem.NewError(problem.CodeNotFound, fmt.Sprintf("group %s does not exist", slug), ErrNoSuchGroup)
+	}
+	return group, nil
+}
+
+// ListGroups lists all groups. It isn't scoped to a group so it must only be
+// used by administrative commands.
+func (s GroupService) ListGroups(ctx context.Context) ([]Group, security.ClientError) {
+	groups, err := s.store.ListGroups(ctx)
+	if err != nil {
+		return nil, security.NewClientError("failed to list groups", err)
+	}
+	return groups, nil
+}
+
+// NewGroup adds a group. The slug must be lower case words separated by
+// hyphens.
+func (s GroupService) NewGroup(ctx context.Context, group Group) (Group, security.ClientError) {
+	if group.Name == "" {
+		return Group{}, problem.NewError(problem.CodeValidationFailed, "group name is required", errors.New("group has no name"))
+	}
+	if !slugPattern.MatchString(group.Slug) {
+		return Group{}, problem.NewError(
+			problem.CodeValidationFailed,
+			"group slug must be lower case letters and digits separated by hyphens",
+			fmt.Errorf("invalid group slug '%s'", group.Slug),
+		)
+	}
+	added, err := s.store.AddGroup(ctx, group)
+	if errors.Is(err, ErrGroupAlreadyExists) {
+		return Group{}, problem.NewError(problem.CodeValidationFailed, fmt.Sprintf("group %s already exists", group.Slug), err)
+	} else if err != nil {
+		return Group{}, security.NewClientError("failed to add group", err)
+	}
+	return added, nil
+}
+
+// SetSelfSignUp sets whether anyone can sign up to the group with the given
+// ID. It isn't scoped to a group so it must only be used by administrative
+// commands.
+func (s GroupService) SetSelfSignUp(ctx context.Context, id int64, enabled bool) security.ClientError {
+	if err := s.store.SetSelfSignUp(ctx, id, enabled); errors.Is(err, ErrNoSuchGroup) {
+		return problem.NewError(problem.CodeNotFound, fmt.Sprintf("group %d does not exist", id), err)
+	} else if err != nil {
+		return security.NewClientError(fmt.Sprintf("failed to set self sign up of group %d", id), err)
+	}
+	return nil
+}
+
+// NewSection adds a section to its group.
+func (s GroupService) NewSection(ctx context.Context, section Section) (Section, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "GroupService.NewSection")
+	defer span.End()
+
+	added, err := s.store.AddSection(ctx, section)
+	if err != nil {
+		span.RecordError(err)
+		return Section{}, storeError("failed to add section", err)
+	}
+	return added, nil
+}
+
+// AddLeader makes the user a leader of the section. The section and the user
+// must be in the group.
+func (s GroupService) AddLeader(ctx context.Context, groupID, sectionID, userID int64) security.ClientError {
+	ctx, span := tracing.Start(ctx, "GroupService.AddLeader")
+	defer span.End()
+
+	if err := s.store.AddLeader(ctx, groupID, sectionID, userID); err != nil {
+		span.RecordError(err)
+		return storeError(fmt.Sprintf("failed to add leader %d to section %d", userID, sectionID), err)
+	}
+	return nil
+}
+
+// RemoveLeader stops the user leading the section.
+func (s GroupService) RemoveLeader(ctx context.Context, groupID, sectionID, userID int64) security.ClientError {
+	ctx, span := tracing.Start(ctx, "GroupService.RemoveLeader")
+	defer span.End()
+
+	if err := s.store.RemoveLeader(ctx, groupID, sectionID, userID); err != nil {
+		span.RecordError(err)
+		return storeError(fmt.Sprintf("failed to remove leader %d from section %d", userID, sectionID), err)
+	}
+	return nil
+}
+
+// storeError converts errors from the store to client errors. Users and
+// sections in other groups are reported as not existing so the existence of
+// another group's data isn't revealed.
+func storeError(message string, err error) security.ClientError {
+	switch {
+	case errors.Is(err, ErrNoSuchSection):
+		return problem.NewError(problem.CodeNotFound, "section does not exist", err)
+	case errors.Is(err, ErrNoSuchUser):
+		return problem.NewError(problem.CodeNotFound, "user does not exist", err)
+	case errors.Is(err, ErrNoSuchLeader):
+		return problem.NewError(problem.CodeNotFound, "user is not a leader of the section", err)
+	case errors.Is(err, ErrSectionAlreadyExists):
+		return problem.NewError(CodeSectionAlreadyExists, "the group already has a section of that kind", err)
+	}
+	return security.NewClientError(message, err)
+}
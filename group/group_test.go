@@ -0,0 +1,202 @@
+package group
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/nick96/cubapi/openapi/openapitest"
+	"github.com/nick96/cubapi/problem"
+	"go.uber.org/zap"
+)
+
+// adminHeader marks test requests as made by an admin.
+const adminHeader = "X-Test-Admin"
+
+// admin is the header of requests made by an admin.
+var admin = http.Header{adminHeader: {"true"}}
+
+// newTestRouter creates a router whose requests are made in the group. Only
+// requests with the admin header pass adminOnly.
+func newTestRouter(store GroupStorer, groupID int64) chi.Router {
+	adminOnly := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(adminHeader) == "" {
+				problem.Write(w, r, problem.New(problem.CodeForbidden, "Requires the admin role"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), groupID)))
+		})
+	})
+	router.Route("/group", NewGroupRouter(zap.NewNop(), NewGroupService(store), adminOnly))
+	return router
+}
+
+// newTwoGroupStore creates a store with two groups, 1 and 2, that each have a
+// user: 10 in group 1 and 20 in group 2.
+func newTwoGroupStore(t *testing.T) *mockGroupStore {
+	store := newMockGroupStore()
+	service := NewGroupService(store)
+	for _, group := range []Group{{Name: "1st Seeonee", Slug: "1st-seeonee"}, {Name: "2nd Seeonee", Slug: "2nd-seeonee"}} {
+		if _, err := service.NewGroup(context.Background(), group); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.users[10] = 1
+	store.users[20] = 2
+	return store
+}
+
+func TestSectionsAreScopedToGroup(t *testing.T) {
+	store := newTwoGroupStore(t)
+	first, second := newTestRouter(store, 1), newTestRouter(store, 2)
+
+	var cubs Section
+	if w := openapitest.Do(t, first, "POST", "/group/section", `{"kind": "cubs", "name": "Seeonee Pack"}`, &cubs, admin); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if cubs.GroupId != 1 || cubs.Kind != SectionCubs {
+		t.Errorf("Expected a cub section in group 1, got %+v", cubs)
+	}
+	// Each group can have its own section of a kind, but only one.
+	if w := openapitest.Do(t, second, "POST", "/group/section", `{"kind": "cubs", "name": "Other Pack"}`, nil, admin); w.Code != http.StatusCreated {
+		t.Fatalf("Expected the other group to add cubs, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp problem.Problem
+	if w := openapitest.Do(t, first, "POST", "/group/section", `{"kind": "cubs", "name": "Second Pack"}`, &resp, admin); w.Code != http.StatusConflict || resp.Code != CodeSectionAlreadyExists {
+		t.Errorf("Expected a second cub section to conflict, got %d: %+v", w.Code, resp)
+	}
+
+	var group Group
+	openapitest.Do(t, first, "GET", "/group", "", &group, admin)
+	if group.Slug != "1st-seeonee" || len(group.Sections) != 1 || group.Sections[0].Id != cubs.Id {
+		t.Errorf("Expected group 1 with only its own section, got %+v", group)
+	}
+}
+
+func TestLeadersAreScopedToGroup(t *testing.T) {
+	store := newTwoGroupStore(t)
+	first, second := newTestRouter(store, 1), newTestRouter(store, 2)
+	var cubs, scouts Section
+	openapitest.Do(t, first, "POST", "/group/section", `{"kind": "cubs", "name": "Seeonee Pack"}`, &cubs, admin)
+	openapitest.Do(t, second, "POST", "/group/section", `{"kind": "scouts", "name": "Other Troop"}`, &scouts, admin)
+
+	path := func(section Section, user int64) string {
+		return "/group/section/" + itoa(section.Id) + "/leader/" + itoa(user)
+	}
+	if w := openapitest.Do(t, first, "PUT", path(cubs, 10), "", nil, admin); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	// Adding a leader twice is a no-op.
+	if w := openapitest.Do(t, first, "PUT", path(cubs, 10), "", nil, admin); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected adding a leader twice to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	testCases := []struct {
+		name   string
+		router http.Handler
+		method string
+		path   string
+	}{
+		{"user-in-other-group", first, "PUT", path(cubs, 20)},
+		{"section-in-other-group", first, "PUT", path(scouts, 10)},
+		{"remove-from-other-group", second, "DELETE", path(cubs, 10)},
+		{"not-a-leader", first, "DELETE", path(cubs, 20)},
+		{"not-an-id", first, "PUT", "/group/section/cubs/leader/10"},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp problem.Problem
+			if w := openapitest.Do(t, tt.router, tt.method, tt.path, "", &resp, admin); w.Code != http.StatusNotFound || resp.Code != problem.CodeNotFound {
+				t.Errorf("Expected not found, got %d: %+v", w.Code, resp)
+			}
+		})
+	}
+
+	var group Group
+	openapitest.Do(t, first, "GET", "/group", "", &group, admin)
+	if len(group.Sections) != 1 || len(group.Sections[0].Leaders) != 1 || group.Sections[0].Leaders[0] != 10 {
+		t.Fatalf("Expected user 10 to be the only leader, got %+v", group.Sections)
+	}
+	if w := openapitest.Do(t, first, "DELETE", path(cubs, 10), "", nil, admin); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+}
+
+func TestChangesRequireAdmin(t *testing.T) {
+	router := newTestRouter(newTwoGroupStore(t), 1)
+	for _, r := range []*http.Request{
+		httptest.NewRequest("POST", "/group/section", strings.NewReader(`{"kind": "cubs", "name": "Seeonee Pack"}`)),
+		httptest.NewRequest("PUT", "/group/section/1/leader/10", nil),
+		httptest.NewRequest("DELETE", "/group/section/1/leader/10", nil),
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected %s %s to be forbidden, got %d", r.Method, r.URL.Path, w.Code)
+		}
+	}
+}
+
+func TestRequestsWithoutGroupFail(t *testing.T) {
+	router := chi.NewRouter()
+	router.Route("/group", NewGroupRouter(zap.NewNop(), NewGroupService(newTwoGroupStore(t)), func(next http.Handler) http.Handler { return next }))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/group", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected a request without a group to fail, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestNewGroup(t *testing.T) {
+	service := NewGroupService(newMockGroupStore())
+	ctx := context.Background()
+	if _, err := service.NewGroup(ctx, Group{Name: "1st Seeonee", Slug: "1st-seeonee"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, group := range []Group{
+		{Name: "", Slug: "no-name"},
+		{Name: "Bad slug", Slug: "Bad Slug"},
+		{Name: "Trailing hyphen", Slug: "trailing-"},
+		{Name: "Duplicate", Slug: "1st-seeonee"},
+	} {
+		if _, err := service.NewGroup(ctx, group); err == nil {
+			t.Errorf("Expected %+v to be rejected", group)
+		}
+	}
+}
+
+func itoa(i int64) string {
+	return strconv.FormatInt(i, 10)
+}
+
+func TestSetSelfSignUp(t *testing.T) {
+	store := newTwoGroupStore(t)
+	service := NewGroupService(store)
+	ctx := context.Background()
+	if group, _ := service.FindGroup(ctx, "1st-seeonee"); group.SelfSignUp {
+		t.Fatal("Expected groups to be closed to sign up by default")
+	}
+	if err := service.SetSelfSignUp(ctx, 1, true); err != nil {
+		t.Fatal(err)
+	}
+	if group, _ := service.FindGroup(ctx, "1st-seeonee"); !group.SelfSignUp {
+		t.Error("Expected the group to be open to sign up")
+	}
+	if group, _ := service.FindGroup(ctx, "2nd-seeonee"); group.SelfSignUp {
+		t.Error("Expected other groups to stay closed to sign up")
+	}
+	if err := service.SetSelfSignUp(ctx, 3, true); err == nil {
+		t.Error("Expected a missing group to be an error")
+	}
+}
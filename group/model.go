@@ -0,0 +1,47 @@
+package group
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of section, youngest first.
+const (
+	SectionJoeys     = "joeys"
+	SectionCubs      = "cubs"
+	SectionScouts    = "scouts"
+	SectionVenturers = "venturers"
+	SectionRovers    = "rovers"
+)
+
+// Sections are the kinds of section a group can have, youngest first.
+var Sections = []string{SectionJoeys, SectionCubs, SectionScouts, SectionVenturers, SectionRovers}
+
+// Group is a scout group. Groups are the boundary between tenants: users,
+// members and everything recorded about them belong to exactly one group and
+// are never visible to another.
+type Group struct {
+	Id   int64  `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	// Slug identifies the group in URLs and when signing up, e.g.
+	// "1st-springfield".
+	Slug string `json:"slug" db:"slug"`
+	// SelfSignUp is whether anyone can sign up to the group by its slug.
+	// Otherwise its users are created by an admin.
+	SelfSignUp bool      `json:"selfSignUp" db:"self_sign_up"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	Sections   []Section `json:"sections" db:"-"`
+}
+
+// Section is a section of a group, e.g. its cubs. A group has at most one
+// section of each kind.
+type Section struct {
+	Id      int64  `json:"id" db:"id"`
+	GroupId int64  `json:"groupId" db:"group_id"`
+	Kind    string `json:"kind" db:"kind"`
+	Name    string `json:"name" db:"name"`
+	// Leaders are the IDs of the users that lead the section.
+	Leaders   pq.Int64Array `json:"leaders" db:"leaders"`
+	CreatedAt time.Time     `json:"createdAt" db:"created_at"`
+}
@@ -0,0 +1,74 @@
+package group
+
+import (
+	"github.com/nick96/cubapi/openapi"
+)
+
+// DescribeGroupRouter describes the operations of NewGroupRouter. The router
+// is mounted behind authentication, whose security requirement is given as
+// the group package can't depend on the user package.
+func DescribeGroupRouter(authenticated []map[string][]string) func(r *openapi.Router) {
+	return func(r *openapi.Router) {
+		sectionID := openapi.PathParam("sectionID", "The ID of the section.", openapi.Integer())
+		userID := openapi.PathParam("userID", "The ID of the user.", openapi.Integer())
+		denied := map[string]*openapi.Response{
+			"403": r.Problem("The request isn't authenticated, the user doesn't have the required role, or the CSRF token is missing."),
+			"429": r.Problem("The client has made too many requests."),
+			"500": r.Problem("The request couldn't be completed."),
+		}
+		responses := func(responses map[string]*openapi.Response) map[string]*openapi.Response {
+			for status, response := range denied {
+				responses[status] = response
+			}
+			return responses
+		}
+
+		r.Get("/", &openapi.Operation{
+			OperationID: "getGroup",
+			Summary:     "Get the caller's group",
+			Description: "The group of the authenticated user, with its sections youngest first.",
+			Tags:        []string{"group"},
+			Security:    authenticated,
+			Responses: responses(map[string]*openapi.Response{
+				"200": r.JSON("The group.", GroupResponse{}),
+			}),
+		})
+		r.Post("/section", &openapi.Operation{
+			OperationID: "createSection",
+			Summary:     "Add a section",
+			Description: "Only admins can add sections.",
+			Tags:        []string{"group"},
+			Security:    authenticated,
+			RequestBody: r.JSONBody(SectionRequest{}),
+			Responses: responses(map[string]*openapi.Response{
+				"201": r.JSON("The added section.", SectionResponse{}),
+				"400": r.Problem("The request body is invalid."),
+				"409": r.Problem("The group already has a section of the kind."),
+			}),
+		})
+		r.Put("/section/{sectionID}/leader/{userID}", &openapi.Operation{
+			OperationID: "addSectionLeader",
+			Summary:     "Make a user a leader of a section",
+			Description: "Only admins can change leaders. Making a leader of the section a leader again does nothing.",
+			Tags:        []string{"group"},
+			Security:    authenticated,
+			Parameters:  []openapi.Parameter{sectionID, userID},
+			Responses: responses(map[string]*openapi.Response{
+				"204": openapi.Empty("The user leads the section."),
+				"404": r.Problem("The section or user doesn't exist in the group."),
+			}),
+		})
+		r.Delete("/section/{sectionID}/leader/{userID}", &openapi.Operation{
+			OperationID: "removeSectionLeader",
+			Summary:     "Stop a user leading a section",
+			Description: "Only admins can change leaders.",
+			Tags:        []string{"group"},
+			Security:    authenticated,
+			Parameters:  []openapi.Parameter{sectionID, userID},
+			Responses: responses(map[string]*openapi.Response{
+				"204": openapi.Empty("The user no longer leads the section."),
+				"404": r.Problem("The user isn't a leader of the section."),
+			}),
+		})
+	}
+}
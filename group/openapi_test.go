@@ -0,0 +1,35 @@
+package group
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/openapi/openapitest"
+)
+
+// TestOpenAPIContract checks that the handlers behave as the OpenAPI document
+// says they do. If this fails either the handlers or DescribeGroupRouter need
+// updating.
+func TestOpenAPIContract(t *testing.T) {
+	router := newTestRouter(newTwoGroupStore(t), 1)
+
+	doc := openapi.New("autocrat", "test")
+	doc.Route("/group", DescribeGroupRouter(nil))
+	if err := doc.CheckRoutes(router); err != nil {
+		t.Fatal(err)
+	}
+
+	leader := "/group/section/{sectionID}/leader/{userID}"
+	openapitest.Run(t, doc, router, []openapitest.Case{
+		{Name: "create-section", Method: "POST", Pattern: "/group/section", Body: `{"kind":"cubs","name":"Seeonee Pack"}`, Header: admin, Status: http.StatusCreated},
+		{Name: "create-section-invalid", Method: "POST", Pattern: "/group/section", Body: `{"kind":"wolves"}`, Invalid: true, Header: admin, Status: http.StatusBadRequest},
+		{Name: "create-section-exists", Method: "POST", Pattern: "/group/section", Body: `{"kind":"cubs","name":"Seeonee Pack"}`, Header: admin, Status: http.StatusConflict},
+		{Name: "create-section-not-admin", Method: "POST", Pattern: "/group/section", Body: `{"kind":"scouts","name":"Troop"}`, Status: http.StatusForbidden},
+		{Name: "add-leader", Method: "PUT", Pattern: leader, Path: "/group/section/1/leader/10", Header: admin, Status: http.StatusNoContent},
+		{Name: "add-leader-other-group", Method: "PUT", Pattern: leader, Path: "/group/section/1/leader/20", Header: admin, Status: http.StatusNotFound},
+		{Name: "get", Method: "GET", Pattern: "/group", Status: http.StatusOK},
+		{Name: "remove-leader", Method: "DELETE", Pattern: leader, Path: "/group/section/1/leader/10", Header: admin, Status: http.StatusNoContent},
+		{Name: "remove-leader-missing", Method: "DELETE", Pattern: leader, Path: "/group/section/1/leader/10", Header: admin, Status: http.StatusNotFound},
+	})
+}
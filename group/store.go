@@ -0,0 +1,223 @@
+package group
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/nick96/cubapi/db"
+)
+
+var (
+	// ErrNoSuchGroup is returned when a group doesn't exist.
+	ErrNoSuchGroup = errors.New("group does not exist")
+	// ErrGroupAlreadyExists is returned when adding a group with the slug of
+	// another group.
+	ErrGroupAlreadyExists = errors.New("group already exists")
+	// ErrNoSuchSection is returned when a section doesn't exist in the group.
+	ErrNoSuchSection = errors.New("section does not exist")
+	// ErrSectionAlreadyExists is returned when adding a section of a kind the
+	// group already has.
+	ErrSectionAlreadyExists = errors.New("section already exists")
+	// ErrNoSuchUser is returned when making a user that doesn't exist in the
+	// group a leader.
+	ErrNoSuchUser = errors.New("user does not exist")
+	// ErrNoSuchLeader is returned when removing a user that doesn't lead the
+	// section.
+	ErrNoSuchLeader = errors.New("user is not a leader of the section")
+)
+
+// uniqueViolation is the Postgres error code of unique constraint violations,
+// see https://www.postgresql.org/docs/current/errcodes-appendix.html.
+const uniqueViolation = "23505"
+
+// GroupStorer is an interface that must be implemented by things that store
+// groups and their sections. Everything but finding and adding groups is
+// scoped to a group.
+type GroupStorer interface {
+	GetGroup(ctx context.Context, id int64) (Group, bool, error)
+	FindBySlug(ctx context.Context, slug string) (Group, bool, error)
+	ListGroups(ctx context.Context) ([]Group, error)
+	AddGroup(ctx context.Context, group Group) (Group, error)
+	SetSelfSignUp(ctx context.Context, id int64, enabled bool) error
+	ListSections(ctx context.Context, groupID int64) ([]Section, error)
+	AddSection(ctx context.Context, section Section) (Section, error)
+	AddLeader(ctx context.Context, groupID, sectionID, userID int64) error
+	RemoveLeader(ctx context.Context, groupID, sectionID, userID int64) error
+}
+
+// GroupStore is a store for groups. It implements the GroupStorer interface.
+type GroupStore struct {
+	cluster *db.Cluster
+}
+
+// NewStore creates a new store from the given cluster. Reads go to a replica
+// unless the primary is forced with db.WithPrimary.
+func NewStore(cluster *db.Cluster) GroupStorer {
+	return GroupStore{cluster}
+}
+
+// GetGroup gets the group with the given ID.
+func (s GroupStore) GetGroup(ctx context.Context, id int64) (group Group, found bool, err error) {
+	query := `SELECT * FROM autocrat.groups WHERE id = $1;`
+	err = s.cluster.Reader(ctx).Named("group.get_group").QueryRowx(ctx, query, id).StructScan(&group)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Group{}, false, nil
+		}
+		return Group{}, false, fmt.Errorf("could not get group %d: %w", id, err)
+	}
+	return group, true, nil
+}
+
+// FindBySlug finds the group with the given slug.
+func (s GroupStore) FindBySlug(ctx context.Context, slug string) (group Group, found bool, err error) {
+	query := `SELECT * FROM autocrat.groups WHERE slug = $1;`
+	err = s.cluster.Reader(ctx).Named("group.find_by_slug").QueryRowx(ctx, query, slug).StructScan(&group)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Group{}, false, nil
+		}
+		return Group{}, false, fmt.Errorf("could not find group with slug '%s': %w", slug, err)
+	}
+	return group, true, nil
+}
+
+// ListGroups lists all groups ordered by ID.
+func (s GroupStore) ListGroups(ctx context.Context) ([]Group, error) {
+	groups := []Group{}
+	query := `SELECT * FROM autocrat.groups ORDER BY id;`
+	if err := s.cluster.Reader(ctx).Named("group.list_groups").Select(ctx, &groups, query); err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	return groups, nil
+}
+
+// AddGroup adds the group to the database and returns it as it was stored.
+func (s GroupStore) AddGroup(ctx context.Context, group Group) (Group, error) {
+	var added Group
+	query := `INSERT INTO autocrat.groups (name, slug, self_sign_up) VALUES ($1, $2, $3) RETURNING *;`
+	err := s.cluster.Primary().Named("group.add_group").QueryRowx(ctx, query, group.Name, group.Slug, group.SelfSignUp).StructScan(&added)
+	if isUniqueViolation(err) {
+		return Group{}, fmt.Errorf("failed to insert group '%s': %w", group.Slug, ErrGroupAlreadyExists)
+	} else if err != nil {
+		return Group{}, fmt.Errorf("failed to insert group '%s': %w", group.Slug, err)
+	}
+	return added, nil
+}
+
+// SetSelfSignUp sets whether anyone can sign up to the group with the given
+// ID.
+func (s GroupStore) SetSelfSignUp(ctx context.Context, id int64, enabled bool) error {
+	query := `UPDATE autocrat.groups SET self_sign_up = $2 WHERE id = $1;`
+	result, err := s.cluster.Primary().Named("group.set_self_sign_up").Exec(ctx, query, id, enabled)
+	if err != nil {
+		return fmt.Errorf("failed to set self sign up of group %d: %w", id, err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set self sign up of group %d: %w", id, err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("failed to set self sign up of group %d: %w", id, ErrNoSuchGroup)
+	}
+	return nil
+}
+
+// ListSections lists the sections of the group, youngest first, with their
+// leaders.
+func (s GroupStore) ListSections(ctx context.Context, groupID int64) ([]Section, error) {
+	sections := []Section{}
+	query := `
+	SELECT s.*,
+		COALESCE(array_agg(l.user_id ORDER BY l.user_id) FILTER (WHERE l.user_id IS NOT NULL), '{}') AS leaders
+	FROM autocrat.sections s
+	LEFT JOIN autocrat.section_leaders l ON l.section_id = s.id
+	WHERE s.group_id = $1
+	GROUP BY s.id
+	ORDER BY array_position($2::TEXT[], s.kind), s.id;
+	`
+	if err := s.cluster.Reader(ctx).Named("group.list_sections").Select(ctx, &sections, query, groupID, pq.Array(Sections)); err != nil {
+		return nil, fmt.Errorf("failed to list sections of group %d: %w", groupID, err)
+	}
+	return sections, nil
+}
+
+// AddSection adds the section to its group and returns it as it was stored.
+func (s GroupStore) AddSection(ctx context.Context, section Section) (Section, error) {
+	added := Section{Leaders: pq.Int64Array{}}
+	query := `
+	INSERT INTO autocrat.sections (group_id, kind, name)
+	VALUES ($1, $2, $3)
+	RETURNING *;
+	`
+	err := s.cluster.Primary().Named("group.add_section").
+		QueryRowx(ctx, query, section.GroupId, section.Kind, section.Name).
+		StructScan(&added)
+	if isUniqueViolation(err) {
+		return Section{}, fmt.Errorf("failed to insert %s section: %w", section.Kind, ErrSectionAlreadyExists)
+	} else if err != nil {
+		return Section{}, fmt.Errorf("failed to insert %s section: %w", section.Kind, err)
+	}
+	return added, nil
+}
+
+// AddLeader makes the user a leader of the section. Both must be in the
+// group. Adding a user that already leads the section is a no-op.
+func (s GroupStore) AddLeader(ctx context.Context, groupID, sectionID, userID int64) error {
+	var sectionFound, userFound bool
+	query := `
+	WITH section AS (
+		SELECT id FROM autocrat.sections WHERE group_id = $1 AND id = $2
+	), leader AS (
+		SELECT id FROM autocrat.users WHERE group_id = $1 AND id = $3
+	), added AS (
+		INSERT INTO autocrat.section_leaders (section_id, user_id)
+		SELECT section.id, leader.id FROM section, leader
+		ON CONFLICT DO NOTHING
+	)
+	SELECT EXISTS (SELECT 1 FROM section), EXISTS (SELECT 1 FROM leader);
+	`
+	err := s.cluster.Primary().Named("group.add_leader").
+		QueryRowx(ctx, query, groupID, sectionID, userID).
+		Scan(&sectionFound, &userFound)
+	switch {
+	case err != nil:
+		return fmt.Errorf("failed to add leader %d to section %d: %w", userID, sectionID, err)
+	case !sectionFound:
+		return fmt.Errorf("failed to add leader %d to section %d: %w", userID, sectionID, ErrNoSuchSection)
+	case !userFound:
+		return fmt.Errorf("failed to add leader %d to section %d: %w", userID, sectionID, ErrNoSuchUser)
+	}
+	return nil
+}
+
+// RemoveLeader stops the user leading the section.
+func (s GroupStore) RemoveLeader(ctx context.Context, groupID, sectionID, userID int64) error {
+	query := `
+	DELETE FROM autocrat.section_leaders l
+	USING autocrat.sections s
+	WHERE l.section_id = s.id AND s.group_id = $1 AND s.id = $2 AND l.user_id = $3;
+	`
+	result, err := s.cluster.Primary().Named("group.remove_leader").Exec(ctx, query, groupID, sectionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove leader %d from section %d: %w", userID, sectionID, err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to remove leader %d from section %d: %w", userID, sectionID, err)
+	}
+	if removed == 0 {
+		return fmt.Errorf("failed to remove leader %d from section %d: %w", userID, sectionID, ErrNoSuchLeader)
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether the error is a violation of a unique
+// constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
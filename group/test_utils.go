@@ -0,0 +1,125 @@
+package group
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// mockGroupStore stores groups in memory. users maps the IDs of the users
+// that can lead sections to their group.
+type mockGroupStore struct {
+	groups   map[int64]Group
+	sections map[int64]Section
+	users    map[int64]int64
+}
+
+func newMockGroupStore() *mockGroupStore {
+	return &mockGroupStore{
+		groups:   make(map[int64]Group),
+		sections: make(map[int64]Section),
+		users:    make(map[int64]int64),
+	}
+}
+
+func (s *mockGroupStore) GetGroup(ctx context.Context, id int64) (Group, bool, error) {
+	group, ok := s.groups[id]
+	return group, ok, nil
+}
+
+func (s *mockGroupStore) FindBySlug(ctx context.Context, slug string) (Group, bool, error) {
+	for _, group := range s.groups {
+		if group.Slug == slug {
+			return group, true, nil
+		}
+	}
+	return Group{}, false, nil
+}
+
+func (s *mockGroupStore) ListGroups(ctx context.Context) ([]Group, error) {
+	groups := []Group{}
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Id < groups[j].Id })
+	return groups, nil
+}
+
+func (s *mockGroupStore) AddGroup(ctx context.Context, group Group) (Group, error) {
+	if _, found, _ := s.FindBySlug(ctx, group.Slug); found {
+		return Group{}, ErrGroupAlreadyExists
+	}
+	group.Id = int64(len(s.groups) + 1)
+	group.CreatedAt = time.Now()
+	s.groups[group.Id] = group
+	return group, nil
+}
+
+func (s *mockGroupStore) SetSelfSignUp(ctx context.Context, id int64, enabled bool) error {
+	group, ok := s.groups[id]
+	if !ok {
+		return ErrNoSuchGroup
+	}
+	group.SelfSignUp = enabled
+	s.groups[id] = group
+	return nil
+}
+
+func (s *mockGroupStore) ListSections(ctx context.Context, groupID int64) ([]Section, error) {
+	sections := []Section{}
+	for _, section := range s.sections {
+		if section.GroupId == groupID {
+			sections = append(sections, section)
+		}
+	}
+	sort.Slice(sections, func(i, j int) bool { return sections[i].Id < sections[j].Id })
+	return sections, nil
+}
+
+func (s *mockGroupStore) AddSection(ctx context.Context, section Section) (Section, error) {
+	for _, other := range s.sections {
+		if other.GroupId == section.GroupId && other.Kind == section.Kind {
+			return Section{}, ErrSectionAlreadyExists
+		}
+	}
+	section.Id = int64(len(s.sections) + 1)
+	section.Leaders = pq.Int64Array{}
+	section.CreatedAt = time.Now()
+	s.sections[section.Id] = section
+	return section, nil
+}
+
+func (s *mockGroupStore) AddLeader(ctx context.Context, groupID, sectionID, userID int64) error {
+	section, ok := s.sections[sectionID]
+	if !ok || section.GroupId != groupID {
+		return ErrNoSuchSection
+	}
+	if userGroup, ok := s.users[userID]; !ok || userGroup != groupID {
+		return ErrNoSuchUser
+	}
+	for _, leader := range section.Leaders {
+		if leader == userID {
+			return nil
+		}
+	}
+	section.Leaders = append(section.Leaders, userID)
+	s.sections[sectionID] = section
+	return nil
+}
+
+func (s *mockGroupStore) RemoveLeader(ctx context.Context, groupID, sectionID, userID int64) error {
+	section, ok := s.sections[sectionID]
+	if !ok || section.GroupId != groupID {
+		return ErrNoSuchLeader
+	}
+	for i, leader := range section.Leaders {
+		if leader == userID {
+			section.Leaders = append(section.Leaders[:i:i], section.Leaders[i+1:]...)
+			s.sections[sectionID] = section
+			return nil
+		}
+	}
+	return ErrNoSuchLeader
+}
@@ -0,0 +1,467 @@
+package guardian
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/meeting"
+	"github.com/nick96/cubapi/member"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/user"
+	"go.uber.org/zap"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// InvitationRequest invites someone to become the guardian of members.
+type InvitationRequest struct {
+	Email     string          `json:"email" validate:"required,email,max=256"`
+	MemberIds []int64         `json:"memberIds" validate:"min=1,max=10,dive,required"`
+	Consents  ConsentsRequest `json:"consents,omitempty"`
+}
+
+// AcceptRequest accepts an invitation.
+type AcceptRequest struct {
+	Token string `json:"token" validate:"required,max=64"`
+}
+
+// ConsentsRequest gives a guardian consent to change things about their
+// child. Anything left out isn't consented to.
+type ConsentsRequest struct {
+	EditContacts bool `json:"editContacts,omitempty"`
+	EditDetails  bool `json:"editDetails,omitempty"`
+}
+
+// ContactsRequest replaces the emergency contacts of a child.
+type ContactsRequest struct {
+	EmergencyContacts member.EmergencyContacts `json:"emergencyContacts" validate:"max=5,dive"`
+}
+
+// DetailsRequest corrects the details of a child.
+type DetailsRequest struct {
+	FirstName   string    `json:"firstName" validate:"required,max=256"`
+	LastName    string    `json:"lastName" validate:"required,max=256"`
+	DateOfBirth date.Date `json:"dateOfBirth" validate:"required"`
+}
+
+type InvitationResponse Invitation
+
+func (i InvitationResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type GuardianResponse Guardian
+
+func (g GuardianResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type ChildResponse Child
+
+func (c ChildResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// NewGuardianRouter creates a router for the parents and guardians of the
+// members of the caller's group. It must be behind authentication, which
+// decides the group and the guardian. Leaders invite guardians and decide
+// what they may change, guardians only ever see their own children.
+//
+// POST /invitation: Invite someone by email to become the guardian of
+// members. The response has the token that accepts the invitation.
+// GET /invitation: List the invitations that haven't been accepted.
+// DELETE /invitation/{invitationID}: Revoke an invitation.
+// POST /invitation/accept: Accept an invitation sent to the caller's email.
+// GET /member/{memberID}: List the guardians of a member.
+// PUT /member/{memberID}/guardian/{userID}: Replace what a guardian may
+// change about a member.
+// DELETE /member/{memberID}/guardian/{userID}: Stop a user being a guardian
+// of a member.
+// GET /children: List the caller's children.
+// GET /children/{memberID}: Get a child of the caller.
+// GET /children/{memberID}/progress: Get a child's badge progress.
+// GET /children/{memberID}/attendance: Get how often a child attended
+// meetings between the from and to query parameters, the year up to today by
+// default.
+// PUT /children/{memberID}/contacts: Replace a child's emergency contacts,
+// with consent.
+// PUT /children/{memberID}/details: Correct a child's name and date of birth,
+// with consent.
+func NewGuardianRouter(logger *zap.Logger, service GuardianService, leadersOnly func(http.Handler) http.Handler) func(chi.Router) {
+	validate := problem.NewValidator()
+	date.RegisterValidation(validate)
+	return func(r chi.Router) {
+		r.With(leadersOnly).Post("/invitation", invite(logger, validate, service))
+		r.With(leadersOnly).Get("/invitation", listInvitations(logger, service))
+		r.With(leadersOnly).Delete("/invitation/{invitationID}", revokeInvitation(logger, service))
+		r.Post("/invitation/accept", acceptInvitation(logger, validate, service))
+		r.With(leadersOnly).Get("/member/{memberID}", listGuardians(logger, service))
+		r.With(leadersOnly).Put("/member/{memberID}/guardian/{userID}", setConsents(logger, validate, service))
+		r.With(leadersOnly).Delete("/member/{memberID}/guardian/{userID}", removeGuardian(logger, service))
+		r.Get("/children", listChildren(logger, service))
+		r.Get("/children/{memberID}", getChild(logger, service))
+		r.Get("/children/{memberID}/progress", childProgress(logger, service))
+		r.Get("/children/{memberID}/attendance", childAttendance(logger, service))
+		r.Put("/children/{memberID}/contacts", updateContacts(logger, validate, service))
+		r.Put("/children/{memberID}/details", updateDetails(logger, validate, service))
+	}
+}
+
+func invite(logger *zap.Logger, validate *validator.Validate, service GuardianService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		current, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+		var request InvitationRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		invitation, err := service.Invite(r.Context(), current.GroupId, current.Id, request.Email, request.MemberIds, Consents(request.Consents))
+		if err != nil {
+			logger.Info("Failed to invite guardian", zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Invited guardian", zap.Int64("invitationID", invitation.Id))
+		render.Status(r, http.StatusCreated)
+		render.Render(w, r, InvitationResponse(invitation))
+	}
+}
+
+func listInvitations(logger *zap.Logger, service GuardianService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := group.FromRequest(w, r)
+		if !ok {
+			return
+		}
+		invitations, err := service.ListInvitations(r.Context(), groupID)
+		if err != nil {
+			logger.Info("Failed to list invitations", zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, invitations)
+	}
+}
+
+func revokeInvitation(logger *zap.Logger, service GuardianService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "invitationID", "Invitation")
+		if !ok {
+			return
+		}
+		if err := service.RevokeInvitation(r.Context(), groupID, id); err != nil {
+			logger.Info("Failed to revoke invitation", zap.Int64("invitationID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Revoked invitation", zap.Int64("invitationID", id))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func acceptInvitation(logger *zap.Logger, validate *validator.Validate, service GuardianService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		current, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+		var request AcceptRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		children, err := service.Accept(r.Context(), current, request.Token)
+		if err != nil {
+			logger.Info("Failed to accept invitation", zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Accepted invitation", zap.Int64("userID", current.Id))
+		render.JSON(w, r, children)
+	}
+}
+
+func listGuardians(logger *zap.Logger, service GuardianService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, memberID, ok := pathID(w, r, "memberID", "Member")
+		if !ok {
+			return
+		}
+		guardians, err := service.ListGuardians(r.Context(), groupID, memberID)
+		if err != nil {
+			logger.Info("Failed to list guardians", zap.Int64("memberID", memberID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, guardians)
+	}
+}
+
+func setConsents(logger *zap.Logger, validate *validator.Validate, service GuardianService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, memberID, userID, ok := guardianIDs(w, r)
+		if !ok {
+			return
+		}
+		var request ConsentsRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		guardian, err := service.SetConsents(r.Context(), groupID, memberID, userID, Consents(request))
+		if err != nil {
+			logger.Info("Failed to set guardian consents", zap.Int64("memberID", memberID), zap.Int64("userID", userID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, GuardianResponse(guardian))
+	}
+}
+
+func removeGuardian(logger *zap.Logger, service GuardianService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, memberID, userID, ok := guardianIDs(w, r)
+		if !ok {
+			return
+		}
+		if err := service.RemoveGuardian(r.Context(), groupID, memberID, userID); err != nil {
+			logger.Info("Failed to remove guardian", zap.Int64("memberID", memberID), zap.Int64("userID", userID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Removed guardian", zap.Int64("memberID", memberID), zap.Int64("userID", userID))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func listChildren(logger *zap.Logger, service GuardianService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		current, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+		children, err := service.Children(r.Context(), current.GroupId, current.Id)
+		if err != nil {
+			logger.Info("Failed to list children", zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, children)
+	}
+}
+
+func getChild(logger *zap.Logger, service GuardianService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		current, memberID, ok := childID(w, r)
+		if !ok {
+			return
+		}
+		child, err := service.Child(r.Context(), current.GroupId, current.Id, memberID)
+		if err != nil {
+			logger.Info("Failed to get child", zap.Int64("memberID", memberID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, ChildResponse(child))
+	}
+}
+
+func childProgress(logger *zap.Logger, service GuardianService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		current, memberID, ok := childID(w, r)
+		if !ok {
+			return
+		}
+		progress, err := service.ChildProgress(r.Context(), current.GroupId, current.Id, memberID)
+		if err != nil {
+			logger.Info("Failed to get child progress", zap.Int64("memberID", memberID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, progress)
+	}
+}
+
+func childAttendance(logger *zap.Logger, service GuardianService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		current, memberID, ok := childID(w, r)
+		if !ok {
+			return
+		}
+		filter, ok := dateRange(w, r)
+		if !ok {
+			return
+		}
+		rate, err := service.ChildAttendance(r.Context(), current.GroupId, current.Id, memberID, filter)
+		if err != nil {
+			logger.Info("Failed to get child attendance", zap.Int64("memberID", memberID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, meeting.RateResponse(rate))
+	}
+}
+
+func updateContacts(logger *zap.Logger, validate *validator.Validate, service GuardianService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		current, memberID, ok := childID(w, r)
+		if !ok {
+			return
+		}
+		var request ContactsRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		child, err := service.UpdateContacts(r.Context(), current.GroupId, current.Id, memberID, request.EmergencyContacts)
+		if err != nil {
+			logger.Info("Failed to update child contacts", zap.Int64("memberID", memberID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Guardian updated child contacts", zap.Int64("memberID", memberID), zap.Int64("userID", current.Id))
+		render.Render(w, r, ChildResponse(child))
+	}
+}
+
+func updateDetails(logger *zap.Logger, validate *validator.Validate, service GuardianService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		current, memberID, ok := childID(w, r)
+		if !ok {
+			return
+		}
+		var request DetailsRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		details := Details{FirstName: request.FirstName, LastName: request.LastName, DateOfBirth: request.DateOfBirth}
+		child, err := service.UpdateDetails(r.Context(), current.GroupId, current.Id, memberID, details)
+		if err != nil {
+			logger.Info("Failed to update child details", zap.Int64("memberID", memberID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Guardian updated child details", zap.Int64("memberID", memberID), zap.Int64("userID", current.Id))
+		render.Render(w, r, ChildResponse(child))
+	}
+}
+
+// dateRange parses the from and to query parameters into a filter. Either
+// can be left out. A problem is written if they aren't dates.
+func dateRange(w http.ResponseWriter, r *http.Request) (meeting.Filter, bool) {
+	var filter meeting.Filter
+	for _, param := range []struct {
+		name string
+		d    *date.Date
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := r.URL.Query().Get(param.name)
+		if value == "" {
+			continue
+		}
+		d, err := date.Parse(value)
+		if err != nil {
+			problem.Write(w, r, problem.New(problem.CodeValidationFailed, param.name+" must be a date formatted as YYYY-MM-DD"))
+			return meeting.Filter{}, false
+		}
+		*param.d = d
+	}
+	return filter, true
+}
+
+// childID gets the caller and parses the ID of their child in the path.
+func childID(w http.ResponseWriter, r *http.Request) (user.User, int64, bool) {
+	current, ok := currentUser(w, r)
+	if !ok {
+		return user.User{}, 0, false
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "memberID"), 10, 64)
+	if err != nil {
+		problem.Write(w, r, problem.New(problem.CodeNotFound, "Child does not exist"))
+		return user.User{}, 0, false
+	}
+	return current, id, true
+}
+
+// guardianIDs gets the caller's group and parses the IDs of the member and
+// their guardian in the path.
+func guardianIDs(w http.ResponseWriter, r *http.Request) (groupID, memberID, userID int64, ok bool) {
+	groupID, memberID, ok = pathID(w, r, "memberID", "Member")
+	if !ok {
+		return 0, 0, 0, false
+	}
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		problem.Write(w, r, problem.New(problem.CodeNotFound, "Guardian does not exist"))
+		return 0, 0, 0, false
+	}
+	return groupID, memberID, userID, true
+}
+
+// pathID gets the caller's group and parses the ID in the path parameter.
+// Anything that isn't an ID can't exist so it's not found.
+func pathID(w http.ResponseWriter, r *http.Request, param, name string) (groupID, id int64, ok bool) {
+	groupID, ok = group.FromRequest(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, param), 10, 64)
+	if err != nil {
+		problem.Write(w, r, problem.New(problem.CodeNotFound, name+" does not exist"))
+		return 0, 0, false
+	}
+	return groupID, id, true
+}
+
+// currentUser gets the authenticated user. A problem is written if there
+// isn't one, which means the router isn't behind authentication.
+func currentUser(w http.ResponseWriter, r *http.Request) (user.User, bool) {
+	current, ok := user.FromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Internal(fmt.Errorf("no authenticated user in request context")))
+		return user.User{}, false
+	}
+	return current, true
+}
+
+// decodeRequest decodes and validates a request into v. A problem is written
+// if the request is invalid.
+func decodeRequest(logger *zap.Logger, w http.ResponseWriter, r *http.Request, validate *validator.Validate, v interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Info("Failed to read request body", zap.Error(err))
+		problem.Write(w, r, problem.Internal(err))
+		return false
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, v); err != nil {
+		logger.Info("Failed to unmarshal request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Request body is invalid JSON", err))
+		return false
+	}
+	if err := validate.Struct(v); err != nil {
+		logger.Info("Invalid request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Invalid request body", err))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,314 @@
+package guardian
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/meeting"
+	"github.com/nick96/cubapi/member"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/progress"
+	"github.com/nick96/cubapi/security"
+	"github.com/nick96/cubapi/tracing"
+	"github.com/nick96/cubapi/user"
+)
+
+// invitationLifetime is how long an invitation can be accepted for.
+const invitationLifetime = 14 * 24 * time.Hour
+
+// tokenBytes is how many random bytes invitation tokens have.
+const tokenBytes = 32
+
+// ProgressReader reads the badge progress of members. It's implemented by
+// progress.ProgressService.
+type ProgressReader interface {
+	MemberProgress(ctx context.Context, groupID, memberID int64) ([]progress.Progress, security.ClientError)
+}
+
+// AttendanceReader reads how often members attend meetings. It's implemented
+// by meeting.MeetingService.
+type AttendanceReader interface {
+	MemberRate(ctx context.Context, groupID, memberID int64, filter meeting.Filter) (meeting.Rate, security.ClientError)
+}
+
+type GuardianService struct {
+	store      GuardianStorer
+	progress   ProgressReader
+	attendance AttendanceReader
+	// location is the time zone dates are in, it decides when today is.
+	location *time.Location
+}
+
+// NewGuardianService creates a GuardianService that stores guardians and
+// invitations in the store. Guardians see their children's badge progress
+// and attendance as read by progress and attendance. Dates, like a child's
+// date of birth, are in the given location.
+func NewGuardianService(store GuardianStorer, progress ProgressReader, attendance AttendanceReader, location *time.Location) GuardianService {
+	return GuardianService{store: store, progress: progress, attendance: attendance, location: location}
+}
+
+// Invite invites the user with the email, as the user with invitedBy, to
+// become the guardian of the members of the group with the consents. The
+// returned invitation has the token that accepts it, which isn't kept.
+func (s GuardianService) Invite(ctx context.Context, groupID, invitedBy int64, email string, memberIDs []int64, consents Consents) (Invitation, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "GuardianService.Invite")
+	defer span.End()
+
+	seen := make(map[int64]bool, len(memberIDs))
+	for _, id := range memberIDs {
+		if seen[id] {
+			return Invitation{}, problem.Invalid("member %d is given more than once", id)
+		}
+		seen[id] = true
+	}
+	token, err := newToken()
+	if err != nil {
+		span.RecordError(err)
+		return Invitation{}, security.NewClientError("failed to create invitation token", err)
+	}
+	invitation := Invitation{
+		GroupId:   groupID,
+		Email:     email,
+		MemberIds: pq.Int64Array(memberIDs),
+		Consents:  consents,
+		TokenHash: hashToken(token),
+		InvitedBy: &invitedBy,
+		ExpiresAt: time.Now().Add(invitationLifetime),
+	}
+	added, err := s.store.AddInvitation(ctx, invitation)
+	if err != nil {
+		span.RecordError(err)
+		return Invitation{}, storeError("failed to add invitation", err)
+	}
+	invitationsCreated.Inc()
+	added.Token = token
+	return added, nil
+}
+
+// ListInvitations lists the invitations of the group that haven't been
+// accepted, including those that have expired.
+func (s GuardianService) ListInvitations(ctx context.Context, groupID int64) ([]Invitation, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "GuardianService.ListInvitations")
+	defer span.End()
+
+	invitations, err := s.store.ListInvitations(ctx, groupID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError("failed to list invitations", err)
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation deletes the invitation of the group with the given ID so
+// it can't be accepted. Guardians who already accepted it are kept.
+func (s GuardianService) RevokeInvitation(ctx context.Context, groupID, id int64) security.ClientError {
+	ctx, span := tracing.Start(ctx, "GuardianService.RevokeInvitation")
+	defer span.End()
+
+	if err := s.store.DeleteInvitation(ctx, groupID, id); err != nil {
+		span.RecordError(err)
+		return storeError(fmt.Sprintf("failed to delete invitation %d", id), err)
+	}
+	return nil
+}
+
+// Accept accepts the invitation with the token as the user, who must have
+// the email it was sent to, making them the guardian of its members. Their
+// children are listed.
+func (s GuardianService) Accept(ctx context.Context, u user.User, token string) ([]Child, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "GuardianService.Accept")
+	defer span.End()
+	// The children listed include the ones the invitation just added.
+	ctx = db.WithPrimary(ctx)
+
+	if err := s.store.AcceptInvitation(ctx, u.GroupId, u.Id, u.Email, hashToken(token)); err != nil {
+		span.RecordError(err)
+		return nil, storeError("failed to accept invitation", err)
+	}
+	invitationsAccepted.Inc()
+	return s.Children(ctx, u.GroupId, u.Id)
+}
+
+// ListGuardians lists the guardians of the member of the group.
+func (s GuardianService) ListGuardians(ctx context.Context, groupID, memberID int64) ([]Guardian, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "GuardianService.ListGuardians")
+	defer span.End()
+
+	exists, err := s.store.MemberExists(ctx, groupID, memberID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError(fmt.Sprintf("failed to check member %d exists", memberID), err)
+	} else if !exists {
+		return nil, problem.NewError(problem.CodeNotFound, fmt.Sprintf("member %d does not exist", memberID), ErrNoSuchMember)
+	}
+	guardians, err := s.store.ListGuardians(ctx, groupID, memberID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError(fmt.Sprintf("failed to list guardians of member %d", memberID), err)
+	}
+	return guardians, nil
+}
+
+// SetConsents replaces what the user may change about the member of the
+// group they are the guardian of.
+func (s GuardianService) SetConsents(ctx context.Context, groupID, memberID, userID int64, consents Consents) (Guardian, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "GuardianService.SetConsents")
+	defer span.End()
+
+	guardian, err := s.store.SetConsents(ctx, groupID, memberID, userID, consents)
+	if err != nil {
+		span.RecordError(err)
+		return Guardian{}, storeError(fmt.Sprintf("failed to set consents of guardian %d", userID), err)
+	}
+	return guardian, nil
+}
+
+// RemoveGuardian stops the user being the guardian of the member of the
+// group.
+func (s GuardianService) RemoveGuardian(ctx context.Context, groupID, memberID, userID int64) security.ClientError {
+	ctx, span := tracing.Start(ctx, "GuardianService.RemoveGuardian")
+	defer span.End()
+
+	if err := s.store.RemoveGuardian(ctx, groupID, memberID, userID); err != nil {
+		span.RecordError(err)
+		return storeError(fmt.Sprintf("failed to remove guardian %d of member %d", userID, memberID), err)
+	}
+	return nil
+}
+
+// Children lists the children of the user in the group.
+func (s GuardianService) Children(ctx context.Context, groupID, userID int64) ([]Child, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "GuardianService.Children")
+	defer span.End()
+
+	children, err := s.store.ListChildren(ctx, groupID, userID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError(fmt.Sprintf("failed to list children of user %d", userID), err)
+	}
+	return children, nil
+}
+
+// Child gets the child of the user in the group. Members who aren't the
+// user's children don't exist as far as the user is concerned.
+func (s GuardianService) Child(ctx context.Context, groupID, userID, memberID int64) (Child, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "GuardianService.Child")
+	defer span.End()
+
+	child, found, err := s.store.GetChild(ctx, groupID, userID, memberID)
+	if err != nil {
+		span.RecordError(err)
+		return Child{}, security.NewClientError(fmt.Sprintf("failed to get child %d", memberID), err)
+	} else if !found {
+		return Child{}, problem.NewError(problem.CodeNotFound, fmt.Sprintf("child %d does not exist", memberID), ErrNoSuchChild)
+	}
+	return child, nil
+}
+
+// ChildProgress gets the badge progress of the child of the user.
+func (s GuardianService) ChildProgress(ctx context.Context, groupID, userID, memberID int64) ([]progress.Progress, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "GuardianService.ChildProgress")
+	defer span.End()
+
+	if _, err := s.Child(ctx, groupID, userID, memberID); err != nil {
+		return nil, err
+	}
+	return s.progress.MemberProgress(ctx, groupID, memberID)
+}
+
+// ChildAttendance gets how often the child of the user attended meetings
+// between the dates of the filter.
+func (s GuardianService) ChildAttendance(ctx context.Context, groupID, userID, memberID int64, filter meeting.Filter) (meeting.Rate, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "GuardianService.ChildAttendance")
+	defer span.End()
+
+	if _, err := s.Child(ctx, groupID, userID, memberID); err != nil {
+		return meeting.Rate{}, err
+	}
+	return s.attendance.MemberRate(ctx, groupID, memberID, filter)
+}
+
+// UpdateContacts replaces the emergency contacts of the child of the user,
+// who must have consent to.
+func (s GuardianService) UpdateContacts(ctx context.Context, groupID, userID, memberID int64, contacts member.EmergencyContacts) (Child, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "GuardianService.UpdateContacts")
+	defer span.End()
+	ctx = db.WithPrimary(ctx)
+
+	child, clientErr := s.Child(ctx, groupID, userID, memberID)
+	if clientErr != nil {
+		return Child{}, clientErr
+	} else if !child.EditContacts {
+		return Child{}, problem.NewError(problem.CodeForbidden, "you don't have consent to change the emergency contacts", ErrNoConsent)
+	}
+	if contacts == nil {
+		contacts = member.EmergencyContacts{}
+	}
+	if err := s.store.UpdateContacts(ctx, groupID, userID, memberID, contacts); err != nil {
+		span.RecordError(err)
+		return Child{}, storeError(fmt.Sprintf("failed to update contacts of child %d", memberID), err)
+	}
+	return s.Child(ctx, groupID, userID, memberID)
+}
+
+// UpdateDetails corrects the details of the child of the user, who must have
+// consent to.
+func (s GuardianService) UpdateDetails(ctx context.Context, groupID, userID, memberID int64, details Details) (Child, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "GuardianService.UpdateDetails")
+	defer span.End()
+	ctx = db.WithPrimary(ctx)
+
+	child, clientErr := s.Child(ctx, groupID, userID, memberID)
+	if clientErr != nil {
+		return Child{}, clientErr
+	} else if !child.EditDetails {
+		return Child{}, problem.NewError(problem.CodeForbidden, "you don't have consent to change the details", ErrNoConsent)
+	}
+	if today := date.Today(s.location); details.DateOfBirth.After(today) {
+		return Child{}, problem.Invalid("date of birth must not be in the future")
+	}
+	if err := s.store.UpdateDetails(ctx, groupID, userID, memberID, details); err != nil {
+		span.RecordError(err)
+		return Child{}, storeError(fmt.Sprintf("failed to update details of child %d", memberID), err)
+	}
+	return s.Child(ctx, groupID, userID, memberID)
+}
+
+// newToken creates a random token to accept an invitation with.
+func newToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken hashes an invitation token to be stored or looked up.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// storeError converts errors from the store to client errors.
+func storeError(message string, err error) security.ClientError {
+	switch {
+	case errors.Is(err, ErrNoSuchMember):
+		return problem.NewError(problem.CodeValidationFailed, "a member does not exist in the group", err)
+	case errors.Is(err, ErrNoSuchGuardian):
+		return problem.NewError(problem.CodeNotFound, "the user is not a guardian of the member", err)
+	case errors.Is(err, ErrNoSuchInvitation):
+		return problem.NewError(problem.CodeNotFound, "the invitation does not exist, has expired, or is for someone else", err)
+	case errors.Is(err, ErrNoConsent):
+		return problem.NewError(problem.CodeForbidden, "you don't have consent to make the change", err)
+	}
+	return security.NewClientError(message, err)
+}
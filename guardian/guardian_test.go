@@ -0,0 +1,291 @@
+package guardian
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/member"
+	"github.com/nick96/cubapi/openapi/openapitest"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/user"
+	"github.com/nick96/cubapi/user/usertest"
+	"go.uber.org/zap"
+)
+
+// Users requests are made as in tests. The outsider has the parent's email
+// but is in the other group.
+var (
+	leader      = user.User{Id: 10, GroupId: testGroupID, Email: "raksha@example.com", FirstName: "Raksha", Roles: []string{user.RoleLeader}}
+	parent      = user.User{Id: 11, GroupId: testGroupID, Email: "messua@example.com", FirstName: "Messua"}
+	otherParent = user.User{Id: 12, GroupId: testGroupID, Email: "buldeo@example.com", FirstName: "Buldeo"}
+	outsider    = user.User{Id: 20, GroupId: otherGroupID, Email: "messua@example.com", FirstName: "Messua", Roles: []string{user.RoleLeader}}
+)
+
+// Members of the groups: mowgli and akela are in the test group and otherCub
+// in the other group.
+const (
+	mowgli   = 1
+	akela    = 2
+	otherCub = 3
+)
+
+// newTestStore creates a store with the members and users of the test and
+// other groups.
+func newTestStore() *mockGuardianStore {
+	store := newMockGuardianStore()
+	born := date.Of(time.Date(2012, time.May, 1, 0, 0, 0, 0, time.UTC))
+	store.members[mowgli] = mockMember{testGroupID, "Mowgli", "Jungle", born, group.SectionCubs, member.EmergencyContacts{}}
+	store.members[akela] = mockMember{testGroupID, "Akela", "Wolf", born, group.SectionCubs, member.EmergencyContacts{}}
+	store.members[otherCub] = mockMember{otherGroupID, "Tabaqui", "Jackal", born, group.SectionCubs, member.EmergencyContacts{}}
+	for _, u := range []user.User{leader, parent, otherParent, outsider} {
+		store.users[u.Id] = u
+	}
+	return store
+}
+
+// newTestRouter creates a router whose requests are made as the user.
+func newTestRouter(store GuardianStorer, reader *mockReader, u user.User) chi.Router {
+	router := chi.NewRouter()
+	router.Use(usertest.As(u))
+	service := NewGuardianService(store, reader, reader, time.UTC)
+	router.Route("/guardian", NewGuardianRouter(zap.NewNop(), service, user.RequireRole(user.RoleAdmin, user.RoleLeader)))
+	return router
+}
+
+// expectStatus fails the test unless the response has the status and, for
+// problems, the code.
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int, code problem.Code) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("Expected status code %d, got %d: %s", status, w.Code, w.Body.String())
+	}
+	if code == "" {
+		return
+	}
+	var p problem.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("Failed to decode problem %s: %v", w.Body.String(), err)
+	}
+	if p.Code != code {
+		t.Fatalf("Expected problem code %s, got %s", code, p.Code)
+	}
+}
+
+func TestInvitationFlow(t *testing.T) {
+	store := newTestStore()
+	reader := &mockReader{}
+	asLeader := newTestRouter(store, reader, leader)
+	asParent := newTestRouter(store, reader, parent)
+
+	var invitation Invitation
+	body := fmt.Sprintf(`{"email": "Messua@Example.com", "memberIds": [%d], "consents": {"editContacts": true}}`, mowgli)
+	expectStatus(t, openapitest.Do(t, asLeader, "POST", "/guardian/invitation", body, &invitation), http.StatusCreated, "")
+	if invitation.Token == "" {
+		t.Fatal("Expected the invitation to have a token")
+	}
+	if stored := store.invitations[invitation.Id]; stored.TokenHash == invitation.Token || stored.TokenHash != hashToken(invitation.Token) {
+		t.Fatal("Expected only the hash of the token to be stored")
+	}
+	if invitation.InvitedBy == nil || *invitation.InvitedBy != leader.Id {
+		t.Fatalf("Expected the invitation to be made by %d, got %v", leader.Id, invitation.InvitedBy)
+	}
+
+	var invitations []Invitation
+	expectStatus(t, openapitest.Do(t, asLeader, "GET", "/guardian/invitation", "", &invitations), http.StatusOK, "")
+	if len(invitations) != 1 || invitations[0].Token != "" {
+		t.Fatalf("Expected the invitation to be listed without its token, got %+v", invitations)
+	}
+
+	var children []Child
+	expectStatus(t, openapitest.Do(t, asParent, "GET", "/guardian/children", "", &children), http.StatusOK, "")
+	if len(children) != 0 {
+		t.Fatalf("Expected no children before accepting, got %+v", children)
+	}
+
+	accept := fmt.Sprintf(`{"token": %q}`, invitation.Token)
+	asOther := newTestRouter(store, reader, otherParent)
+	expectStatus(t, openapitest.Do(t, asOther, "POST", "/guardian/invitation/accept", accept, nil), http.StatusNotFound, problem.CodeNotFound)
+	asOutsider := newTestRouter(store, reader, outsider)
+	expectStatus(t, openapitest.Do(t, asOutsider, "POST", "/guardian/invitation/accept", accept, nil), http.StatusNotFound, problem.CodeNotFound)
+
+	expectStatus(t, openapitest.Do(t, asParent, "POST", "/guardian/invitation/accept", accept, &children), http.StatusOK, "")
+	if len(children) != 1 || children[0].Id != mowgli || !children[0].EditContacts || children[0].EditDetails {
+		t.Fatalf("Expected to be the guardian of %d with consent to edit contacts, got %+v", mowgli, children)
+	}
+	expectStatus(t, openapitest.Do(t, asParent, "POST", "/guardian/invitation/accept", accept, nil), http.StatusNotFound, problem.CodeNotFound)
+
+	expectStatus(t, openapitest.Do(t, asLeader, "GET", "/guardian/invitation", "", &invitations), http.StatusOK, "")
+	if len(invitations) != 0 {
+		t.Fatalf("Expected accepted invitations not to be listed, got %+v", invitations)
+	}
+	var guardians []Guardian
+	expectStatus(t, openapitest.Do(t, asLeader, "GET", fmt.Sprintf("/guardian/member/%d", mowgli), "", &guardians), http.StatusOK, "")
+	if len(guardians) != 1 || guardians[0].UserId != parent.Id || guardians[0].Email != parent.Email {
+		t.Fatalf("Expected %d to be the guardian of %d, got %+v", parent.Id, mowgli, guardians)
+	}
+}
+
+func TestInvitationRejected(t *testing.T) {
+	store := newTestStore()
+	reader := &mockReader{}
+	asLeader := newTestRouter(store, reader, leader)
+
+	expired := Invitation{
+		Id:        1,
+		GroupId:   testGroupID,
+		Email:     parent.Email,
+		MemberIds: []int64{mowgli},
+		TokenHash: hashToken("expired"),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	store.invitations[expired.Id] = expired
+	asParent := newTestRouter(store, reader, parent)
+	expectStatus(t, openapitest.Do(t, asParent, "POST", "/guardian/invitation/accept", `{"token": "expired"}`, nil), http.StatusNotFound, problem.CodeNotFound)
+	expectStatus(t, openapitest.Do(t, asParent, "POST", "/guardian/invitation/accept", `{"token": "unknown"}`, nil), http.StatusNotFound, problem.CodeNotFound)
+	expectStatus(t, openapitest.Do(t, asParent, "POST", "/guardian/invitation/accept", `{}`, nil), http.StatusBadRequest, problem.CodeValidationFailed)
+
+	testCases := []struct {
+		name string
+		body string
+	}{
+		{"other-group-member", fmt.Sprintf(`{"email": "messua@example.com", "memberIds": [%d]}`, otherCub)},
+		{"missing-member", `{"email": "messua@example.com", "memberIds": [9]}`},
+		{"duplicate-member", fmt.Sprintf(`{"email": "messua@example.com", "memberIds": [%d, %d]}`, mowgli, mowgli)},
+		{"no-members", `{"email": "messua@example.com", "memberIds": []}`},
+		{"invalid-email", fmt.Sprintf(`{"email": "messua", "memberIds": [%d]}`, mowgli)},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, openapitest.Do(t, asLeader, "POST", "/guardian/invitation", tt.body, nil), http.StatusBadRequest, problem.CodeValidationFailed)
+		})
+	}
+
+	body := fmt.Sprintf(`{"email": "messua@example.com", "memberIds": [%d]}`, mowgli)
+	expectStatus(t, openapitest.Do(t, asParent, "POST", "/guardian/invitation", body, nil), http.StatusForbidden, "")
+	expectStatus(t, openapitest.Do(t, asParent, "GET", "/guardian/invitation", "", nil), http.StatusForbidden, "")
+	expectStatus(t, openapitest.Do(t, asParent, "GET", fmt.Sprintf("/guardian/member/%d", mowgli), "", nil), http.StatusForbidden, "")
+}
+
+func TestRevokeInvitation(t *testing.T) {
+	store := newTestStore()
+	reader := &mockReader{}
+	asLeader := newTestRouter(store, reader, leader)
+
+	var invitation Invitation
+	body := fmt.Sprintf(`{"email": "messua@example.com", "memberIds": [%d]}`, mowgli)
+	expectStatus(t, openapitest.Do(t, asLeader, "POST", "/guardian/invitation", body, &invitation), http.StatusCreated, "")
+	path := fmt.Sprintf("/guardian/invitation/%d", invitation.Id)
+
+	asOutsider := newTestRouter(store, reader, outsider)
+	expectStatus(t, openapitest.Do(t, asOutsider, "DELETE", path, "", nil), http.StatusNotFound, problem.CodeNotFound)
+	expectStatus(t, openapitest.Do(t, asLeader, "DELETE", path, "", nil), http.StatusNoContent, "")
+	expectStatus(t, openapitest.Do(t, asLeader, "DELETE", path, "", nil), http.StatusNotFound, problem.CodeNotFound)
+
+	asParent := newTestRouter(store, reader, parent)
+	accept := fmt.Sprintf(`{"token": %q}`, invitation.Token)
+	expectStatus(t, openapitest.Do(t, asParent, "POST", "/guardian/invitation/accept", accept, nil), http.StatusNotFound, problem.CodeNotFound)
+}
+
+func TestChildrenAreScoped(t *testing.T) {
+	store := newTestStore()
+	store.guardians[guardianship{parent.Id, mowgli}] = Consents{}
+	store.guardians[guardianship{otherParent.Id, akela}] = Consents{}
+	// A guardianship across groups must never be visible.
+	store.guardians[guardianship{parent.Id, otherCub}] = Consents{EditContacts: true}
+	reader := &mockReader{}
+	asParent := newTestRouter(store, reader, parent)
+
+	var children []Child
+	expectStatus(t, openapitest.Do(t, asParent, "GET", "/guardian/children", "", &children), http.StatusOK, "")
+	if len(children) != 1 || children[0].Id != mowgli {
+		t.Fatalf("Expected only %d to be listed, got %+v", mowgli, children)
+	}
+
+	var child Child
+	expectStatus(t, openapitest.Do(t, asParent, "GET", fmt.Sprintf("/guardian/children/%d", mowgli), "", &child), http.StatusOK, "")
+	if child.FirstName != "Mowgli" {
+		t.Fatalf("Expected to get Mowgli, got %+v", child)
+	}
+	expectStatus(t, openapitest.Do(t, asParent, "GET", fmt.Sprintf("/guardian/children/%d/progress", mowgli), "", nil), http.StatusOK, "")
+	var rate struct {
+		MemberId int64 `json:"memberId"`
+	}
+	expectStatus(t, openapitest.Do(t, asParent, "GET", fmt.Sprintf("/guardian/children/%d/attendance?from=2021-01-01", mowgli), "", &rate), http.StatusOK, "")
+	if rate.MemberId != mowgli {
+		t.Fatalf("Expected the attendance of %d, got %+v", mowgli, rate)
+	}
+
+	for _, id := range []int64{akela, otherCub, 9} {
+		for _, path := range []string{"", "/progress", "/attendance"} {
+			p := fmt.Sprintf("/guardian/children/%d%s", id, path)
+			expectStatus(t, openapitest.Do(t, asParent, "GET", p, "", nil), http.StatusNotFound, problem.CodeNotFound)
+		}
+		p := fmt.Sprintf("/guardian/children/%d/contacts", id)
+		expectStatus(t, openapitest.Do(t, asParent, "PUT", p, `{"emergencyContacts": []}`, nil), http.StatusNotFound, problem.CodeNotFound)
+	}
+	if len(reader.read) != 2 || reader.read[0] != mowgli || reader.read[1] != mowgli {
+		t.Fatalf("Expected only the progress and attendance of %d to be read, got %v", mowgli, reader.read)
+	}
+
+	asOutsider := newTestRouter(store, reader, outsider)
+	expectStatus(t, openapitest.Do(t, asOutsider, "GET", "/guardian/children", "", &children), http.StatusOK, "")
+	if len(children) != 0 {
+		t.Fatalf("Expected the outsider to have no children, got %+v", children)
+	}
+	expectStatus(t, openapitest.Do(t, asOutsider, "GET", fmt.Sprintf("/guardian/member/%d", mowgli), "", nil), http.StatusNotFound, problem.CodeNotFound)
+}
+
+func TestConsents(t *testing.T) {
+	store := newTestStore()
+	store.guardians[guardianship{parent.Id, mowgli}] = Consents{}
+	reader := &mockReader{}
+	asLeader := newTestRouter(store, reader, leader)
+	asParent := newTestRouter(store, reader, parent)
+
+	contactsPath := fmt.Sprintf("/guardian/children/%d/contacts", mowgli)
+	detailsPath := fmt.Sprintf("/guardian/children/%d/details", mowgli)
+	consentsPath := fmt.Sprintf("/guardian/member/%d/guardian/%d", mowgli, parent.Id)
+	contacts := `{"emergencyContacts": [{"name": "Messua", "relationship": "Mother", "phone": "0400 000 000"}]}`
+	details := `{"firstName": "Nathoo", "lastName": "Jungle", "dateOfBirth": "2012-05-02"}`
+
+	expectStatus(t, openapitest.Do(t, asParent, "PUT", contactsPath, contacts, nil), http.StatusForbidden, problem.CodeForbidden)
+	expectStatus(t, openapitest.Do(t, asParent, "PUT", detailsPath, details, nil), http.StatusForbidden, problem.CodeForbidden)
+	expectStatus(t, openapitest.Do(t, asParent, "PUT", consentsPath, `{"editContacts": true}`, nil), http.StatusForbidden, "")
+
+	asOutsider := newTestRouter(store, reader, outsider)
+	expectStatus(t, openapitest.Do(t, asOutsider, "PUT", consentsPath, `{"editContacts": true}`, nil), http.StatusNotFound, problem.CodeNotFound)
+
+	var guardian Guardian
+	expectStatus(t, openapitest.Do(t, asLeader, "PUT", consentsPath, `{"editContacts": true}`, &guardian), http.StatusOK, "")
+	if !guardian.EditContacts || guardian.EditDetails {
+		t.Fatalf("Expected consent to edit contacts only, got %+v", guardian.Consents)
+	}
+	var child Child
+	expectStatus(t, openapitest.Do(t, asParent, "PUT", contactsPath, contacts, &child), http.StatusOK, "")
+	if len(child.EmergencyContacts) != 1 || child.EmergencyContacts[0].Name != "Messua" {
+		t.Fatalf("Expected the contacts to be replaced, got %+v", child.EmergencyContacts)
+	}
+	expectStatus(t, openapitest.Do(t, asParent, "PUT", detailsPath, details, nil), http.StatusForbidden, problem.CodeForbidden)
+
+	expectStatus(t, openapitest.Do(t, asLeader, "PUT", consentsPath, `{"editDetails": true}`, nil), http.StatusOK, "")
+	expectStatus(t, openapitest.Do(t, asParent, "PUT", contactsPath, contacts, nil), http.StatusForbidden, problem.CodeForbidden)
+	future := `{"firstName": "Nathoo", "lastName": "Jungle", "dateOfBirth": "2999-01-01"}`
+	expectStatus(t, openapitest.Do(t, asParent, "PUT", detailsPath, future, nil), http.StatusBadRequest, problem.CodeValidationFailed)
+	expectStatus(t, openapitest.Do(t, asParent, "PUT", detailsPath, details, &child), http.StatusOK, "")
+	if child.FirstName != "Nathoo" || child.DateOfBirth != date.Of(time.Date(2012, time.May, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected the details to be corrected, got %+v", child)
+	}
+
+	removePath := fmt.Sprintf("/guardian/member/%d/guardian/%d", mowgli, parent.Id)
+	expectStatus(t, openapitest.Do(t, asOutsider, "DELETE", removePath, "", nil), http.StatusNotFound, problem.CodeNotFound)
+	expectStatus(t, openapitest.Do(t, asLeader, "DELETE", removePath, "", nil), http.StatusNoContent, "")
+	expectStatus(t, openapitest.Do(t, asLeader, "DELETE", removePath, "", nil), http.StatusNotFound, problem.CodeNotFound)
+	expectStatus(t, openapitest.Do(t, asParent, "GET", fmt.Sprintf("/guardian/children/%d", mowgli), "", nil), http.StatusNotFound, problem.CodeNotFound)
+}
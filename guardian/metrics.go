@@ -0,0 +1,17 @@
+package guardian
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	invitationsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "autocrat_guardian_invitations_created_total",
+		Help: "Number of guardian invitations created.",
+	})
+	invitationsAccepted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "autocrat_guardian_invitations_accepted_total",
+		Help: "Number of guardian invitations accepted.",
+	})
+)
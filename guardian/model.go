@@ -0,0 +1,80 @@
+package guardian
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/member"
+)
+
+// Consents are what a guardian may change about their child. Guardians can
+// always see everything about their children, but only change it with
+// consent from a leader.
+type Consents struct {
+	// EditContacts lets the guardian replace the child's emergency
+	// contacts.
+	EditContacts bool `json:"editContacts" db:"edit_contacts"`
+	// EditDetails lets the guardian correct the child's name and date of
+	// birth.
+	EditDetails bool `json:"editDetails" db:"edit_details"`
+}
+
+// Guardian is a user who is the parent or guardian of a member of the same
+// group.
+type Guardian struct {
+	UserId    int64  `json:"userId" db:"user_id"`
+	MemberId  int64  `json:"memberId" db:"member_id"`
+	Email     string `json:"email" db:"email"`
+	FirstName string `json:"firstName" db:"firstname"`
+	LastName  string `json:"lastName" db:"lastname"`
+	Consents  `json:"consents"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// Child is a member as their guardian sees them, with what the guardian may
+// change about them.
+type Child struct {
+	Id                int64                    `json:"id" db:"id"`
+	FirstName         string                   `json:"firstName" db:"firstname"`
+	LastName          string                   `json:"lastName" db:"lastname"`
+	DateOfBirth       date.Date                `json:"dateOfBirth" db:"date_of_birth"`
+	Section           string                   `json:"section" db:"section"`
+	Patrol            string                   `json:"patrol" db:"patrol"`
+	Status            string                   `json:"status" db:"status"`
+	EmergencyContacts member.EmergencyContacts `json:"emergencyContacts" db:"emergency_contacts"`
+	Consents          `json:"consents"`
+}
+
+// Details are the details of a child a guardian can correct with consent.
+type Details struct {
+	FirstName   string
+	LastName    string
+	DateOfBirth date.Date
+}
+
+// Invitation invites the user with an email address to become the guardian
+// of members. It's accepted with a token that is only ever given to the
+// leader who made the invitation, to pass on to the guardian.
+type Invitation struct {
+	Id int64 `json:"id" db:"id"`
+	// GroupId is the ID of the group of the members. It's implied by the
+	// caller's group so it isn't exposed.
+	GroupId   int64         `json:"-" db:"group_id"`
+	Email     string        `json:"email" db:"email"`
+	MemberIds pq.Int64Array `json:"memberIds" db:"member_ids"`
+	Consents  `json:"consents"`
+	// TokenHash is the SHA-256 hash of the token, so the tokens of stored
+	// invitations can't be used by anyone who reads them.
+	TokenHash string `json:"-" db:"token_hash"`
+	// Token accepts the invitation. It's only set when the invitation is
+	// made.
+	Token string `json:"token,omitempty" db:"-"`
+	// InvitedBy is the ID of the user who made the invitation, if they
+	// still exist.
+	InvitedBy  *int64     `json:"invitedBy" db:"invited_by"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+	ExpiresAt  time.Time  `json:"expiresAt" db:"expires_at"`
+	AcceptedAt *time.Time `json:"acceptedAt" db:"accepted_at"`
+	AcceptedBy *int64     `json:"acceptedBy" db:"accepted_by"`
+}
@@ -0,0 +1,190 @@
+package guardian
+
+import (
+	"github.com/nick96/cubapi/meeting"
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/progress"
+	"github.com/nick96/cubapi/user"
+)
+
+// DescribeGuardianRouter describes the operations of NewGuardianRouter.
+func DescribeGuardianRouter(r *openapi.Router) {
+	invitationID := openapi.PathParam("invitationID", "The ID of the invitation.", openapi.Integer())
+	memberID := openapi.PathParam("memberID", "The ID of the member.", openapi.Integer())
+	childID := openapi.PathParam("memberID", "The ID of the member who is the caller's child.", openapi.Integer())
+	userID := openapi.PathParam("userID", "The ID of the guardian's user.", openapi.Integer())
+	day := &openapi.Schema{Type: "string", Format: "date"}
+	denied := map[string]*openapi.Response{
+		"403": r.Problem("The request isn't authenticated, the user doesn't have the required role, or the CSRF token is missing."),
+		"429": r.Problem("The client has made too many requests."),
+		"500": r.Problem("The request couldn't be completed."),
+	}
+	responses := func(responses map[string]*openapi.Response) map[string]*openapi.Response {
+		for status, response := range denied {
+			responses[status] = response
+		}
+		return responses
+	}
+
+	r.Post("/invitation", &openapi.Operation{
+		OperationID: "inviteGuardian",
+		Summary:     "Invite someone to become the guardian of members",
+		Description: "Only leaders and admins can invite guardians. The response is the only time the token that accepts the invitation is given, the leader passes it on to the guardian. Invitations expire after 14 days.",
+		Tags:        []string{"guardian"},
+		Security:    user.Authenticated,
+		RequestBody: r.JSONBody(InvitationRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"201": r.JSON("The invitation with its token.", InvitationResponse{}),
+			"400": r.Problem("The request body is invalid, or a member is given twice or doesn't exist in the group."),
+		}),
+	})
+	r.Get("/invitation", &openapi.Operation{
+		OperationID: "listGuardianInvitations",
+		Summary:     "List invitations that haven't been accepted",
+		Description: "Only leaders and admins can list invitations. Expired invitations are included, tokens aren't.",
+		Tags:        []string{"guardian"},
+		Security:    user.Authenticated,
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The invitations, newest first.", []Invitation{}),
+		}),
+	})
+	r.Delete("/invitation/{invitationID}", &openapi.Operation{
+		OperationID: "revokeGuardianInvitation",
+		Summary:     "Revoke an invitation",
+		Description: "Only leaders and admins can revoke invitations. Guardians who already accepted it are kept.",
+		Tags:        []string{"guardian"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{invitationID},
+		Responses: responses(map[string]*openapi.Response{
+			"204": openapi.Empty("The invitation has been revoked."),
+			"404": r.Problem("The invitation doesn't exist in the group."),
+		}),
+	})
+	r.Post("/invitation/accept", &openapi.Operation{
+		OperationID: "acceptGuardianInvitation",
+		Summary:     "Accept an invitation",
+		Description: "The caller becomes the guardian of the invitation's members. The invitation must have been sent to the caller's email and can only be accepted once.",
+		Tags:        []string{"guardian"},
+		Security:    user.Authenticated,
+		RequestBody: r.JSONBody(AcceptRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The caller's children, ordered by name.", []Child{}),
+			"400": r.Problem("The request body is invalid."),
+			"404": r.Problem("The invitation doesn't exist, has expired, has been accepted or is for someone else."),
+		}),
+	})
+	r.Get("/member/{memberID}", &openapi.Operation{
+		OperationID: "listGuardians",
+		Summary:     "List the guardians of a member",
+		Description: "Only leaders and admins can list guardians.",
+		Tags:        []string{"guardian"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{memberID},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The member's guardians, ordered by name.", []Guardian{}),
+			"404": r.Problem("The member doesn't exist in the group."),
+		}),
+	})
+	r.Put("/member/{memberID}/guardian/{userID}", &openapi.Operation{
+		OperationID: "setGuardianConsents",
+		Summary:     "Replace what a guardian may change about a member",
+		Description: "Only leaders and admins can give consent.",
+		Tags:        []string{"guardian"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{memberID, userID},
+		RequestBody: r.JSONBody(ConsentsRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The guardian.", GuardianResponse{}),
+			"400": r.Problem("The request body is invalid."),
+			"404": r.Problem("The user isn't a guardian of the member."),
+		}),
+	})
+	r.Delete("/member/{memberID}/guardian/{userID}", &openapi.Operation{
+		OperationID: "removeGuardian",
+		Summary:     "Stop a user being a guardian of a member",
+		Description: "Only leaders and admins can remove guardians.",
+		Tags:        []string{"guardian"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{memberID, userID},
+		Responses: responses(map[string]*openapi.Response{
+			"204": openapi.Empty("The user is no longer a guardian of the member."),
+			"404": r.Problem("The user isn't a guardian of the member."),
+		}),
+	})
+	r.Get("/children", &openapi.Operation{
+		OperationID: "listChildren",
+		Summary:     "List the caller's children",
+		Description: "The members the caller is the guardian of.",
+		Tags:        []string{"guardian"},
+		Security:    user.Authenticated,
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The caller's children, ordered by name.", []Child{}),
+		}),
+	})
+	r.Get("/children/{memberID}", &openapi.Operation{
+		OperationID: "getChild",
+		Summary:     "Get a child of the caller",
+		Tags:        []string{"guardian"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{childID},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The child.", ChildResponse{}),
+			"404": r.Problem("The member isn't the caller's child."),
+		}),
+	})
+	r.Get("/children/{memberID}/progress", &openapi.Operation{
+		OperationID: "getChildProgress",
+		Summary:     "Get a child's badge progress",
+		Tags:        []string{"guardian"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{childID},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The child's progress towards every badge they've started.", []progress.Progress{}),
+			"404": r.Problem("The member isn't the caller's child."),
+		}),
+	})
+	r.Get("/children/{memberID}/attendance", &openapi.Operation{
+		OperationID: "getChildAttendance",
+		Summary:     "Get how often a child attended meetings",
+		Tags:        []string{"guardian"},
+		Security:    user.Authenticated,
+		Parameters: []openapi.Parameter{
+			childID,
+			{Name: "from", In: "query", Description: "The first date of the range, a year before the last by default.", Schema: day},
+			{Name: "to", In: "query", Description: "The last date of the range, today by default.", Schema: day},
+		},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The child's attendance.", meeting.RateResponse{}),
+			"400": r.Problem("The range of dates is invalid."),
+			"404": r.Problem("The member isn't the caller's child."),
+		}),
+	})
+	r.Put("/children/{memberID}/contacts", &openapi.Operation{
+		OperationID: "updateChildContacts",
+		Summary:     "Replace a child's emergency contacts",
+		Description: "The caller must have consent to change the child's emergency contacts.",
+		Tags:        []string{"guardian"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{childID},
+		RequestBody: r.JSONBody(ContactsRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The updated child.", ChildResponse{}),
+			"400": r.Problem("The request body is invalid."),
+			"404": r.Problem("The member isn't the caller's child."),
+		}),
+	})
+	r.Put("/children/{memberID}/details", &openapi.Operation{
+		OperationID: "updateChildDetails",
+		Summary:     "Correct a child's name and date of birth",
+		Description: "The caller must have consent to change the child's details.",
+		Tags:        []string{"guardian"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{childID},
+		RequestBody: r.JSONBody(DetailsRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The updated child.", ChildResponse{}),
+			"400": r.Problem("The request body is invalid or the date of birth is in the future."),
+			"404": r.Problem("The member isn't the caller's child."),
+		}),
+	})
+}
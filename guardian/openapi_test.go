@@ -0,0 +1,67 @@
+package guardian
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/openapi/openapitest"
+)
+
+// TestOpenAPIContract checks that the handlers behave as the OpenAPI document
+// says they do. If this fails either the handlers or DescribeGuardianRouter
+// need updating.
+func TestOpenAPIContract(t *testing.T) {
+	// The leader is also the guardian of mowgli, with consent to change
+	// everything, and has an invitation to become the guardian of akela.
+	store := newTestStore()
+	store.guardians[guardianship{leader.Id, mowgli}] = Consents{EditContacts: true, EditDetails: true}
+	store.guardians[guardianship{parent.Id, mowgli}] = Consents{}
+	store.invitations[1] = Invitation{
+		Id:        1,
+		GroupId:   testGroupID,
+		Email:     leader.Email,
+		MemberIds: []int64{akela},
+		TokenHash: hashToken("token"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	router := newTestRouter(store, &mockReader{}, leader)
+
+	doc := openapi.New("autocrat", "test")
+	doc.Route("/guardian", DescribeGuardianRouter)
+	if err := doc.CheckRoutes(router); err != nil {
+		t.Fatal(err)
+	}
+
+	contacts := `{"emergencyContacts": [{"name": "Messua", "relationship": "Mother", "phone": "0400 000 000"}]}`
+	details := `{"firstName": "Mowgli", "lastName": "Jungle", "dateOfBirth": "2012-05-01"}`
+	openapitest.Run(t, doc, router, []openapitest.Case{
+		{Name: "invite", Method: "POST", Pattern: "/guardian/invitation", Body: `{"email": "messua@example.com", "memberIds": [1]}`, Status: http.StatusCreated},
+		{Name: "invite-invalid", Method: "POST", Pattern: "/guardian/invitation", Body: `{"email": "messua"}`, Invalid: true, Status: http.StatusBadRequest},
+		{Name: "invite-missing-member", Method: "POST", Pattern: "/guardian/invitation", Body: `{"email": "messua@example.com", "memberIds": [9]}`, Status: http.StatusBadRequest},
+		{Name: "list-invitations", Method: "GET", Pattern: "/guardian/invitation", Status: http.StatusOK},
+		{Name: "accept", Method: "POST", Pattern: "/guardian/invitation/accept", Body: `{"token": "token"}`, Status: http.StatusOK},
+		{Name: "accept-again", Method: "POST", Pattern: "/guardian/invitation/accept", Body: `{"token": "token"}`, Status: http.StatusNotFound},
+		{Name: "accept-invalid", Method: "POST", Pattern: "/guardian/invitation/accept", Body: `{}`, Invalid: true, Status: http.StatusBadRequest},
+		{Name: "revoke", Method: "DELETE", Pattern: "/guardian/invitation/{invitationID}", Path: "/guardian/invitation/2", Status: http.StatusNoContent},
+		{Name: "revoke-missing", Method: "DELETE", Pattern: "/guardian/invitation/{invitationID}", Path: "/guardian/invitation/9", Status: http.StatusNotFound},
+		{Name: "list-guardians", Method: "GET", Pattern: "/guardian/member/{memberID}", Path: "/guardian/member/1", Status: http.StatusOK},
+		{Name: "list-guardians-missing", Method: "GET", Pattern: "/guardian/member/{memberID}", Path: "/guardian/member/9", Status: http.StatusNotFound},
+		{Name: "consents", Method: "PUT", Pattern: "/guardian/member/{memberID}/guardian/{userID}", Path: "/guardian/member/1/guardian/11", Body: `{"editContacts": true}`, Status: http.StatusOK},
+		{Name: "consents-missing", Method: "PUT", Pattern: "/guardian/member/{memberID}/guardian/{userID}", Path: "/guardian/member/2/guardian/11", Body: `{}`, Status: http.StatusNotFound},
+		{Name: "children", Method: "GET", Pattern: "/guardian/children", Status: http.StatusOK},
+		{Name: "child", Method: "GET", Pattern: "/guardian/children/{memberID}", Path: "/guardian/children/1", Status: http.StatusOK},
+		{Name: "child-missing", Method: "GET", Pattern: "/guardian/children/{memberID}", Path: "/guardian/children/3", Status: http.StatusNotFound},
+		{Name: "progress", Method: "GET", Pattern: "/guardian/children/{memberID}/progress", Path: "/guardian/children/1/progress", Status: http.StatusOK},
+		{Name: "progress-missing", Method: "GET", Pattern: "/guardian/children/{memberID}/progress", Path: "/guardian/children/3/progress", Status: http.StatusNotFound},
+		{Name: "attendance", Method: "GET", Pattern: "/guardian/children/{memberID}/attendance", Path: "/guardian/children/1/attendance?from=2021-01-01", Status: http.StatusOK},
+		{Name: "attendance-invalid", Method: "GET", Pattern: "/guardian/children/{memberID}/attendance", Path: "/guardian/children/1/attendance?from=yesterday", Status: http.StatusBadRequest},
+		{Name: "contacts", Method: "PUT", Pattern: "/guardian/children/{memberID}/contacts", Path: "/guardian/children/1/contacts", Body: contacts, Status: http.StatusOK},
+		{Name: "contacts-missing", Method: "PUT", Pattern: "/guardian/children/{memberID}/contacts", Path: "/guardian/children/3/contacts", Body: contacts, Status: http.StatusNotFound},
+		{Name: "details", Method: "PUT", Pattern: "/guardian/children/{memberID}/details", Path: "/guardian/children/1/details", Body: details, Status: http.StatusOK},
+		{Name: "details-invalid", Method: "PUT", Pattern: "/guardian/children/{memberID}/details", Path: "/guardian/children/1/details", Body: `{"firstName": "Mowgli"}`, Invalid: true, Status: http.StatusBadRequest},
+		{Name: "remove", Method: "DELETE", Pattern: "/guardian/member/{memberID}/guardian/{userID}", Path: "/guardian/member/1/guardian/11", Status: http.StatusNoContent},
+		{Name: "remove-missing", Method: "DELETE", Pattern: "/guardian/member/{memberID}/guardian/{userID}", Path: "/guardian/member/1/guardian/11", Status: http.StatusNotFound},
+	})
+}
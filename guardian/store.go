@@ -0,0 +1,322 @@
+package guardian
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/member"
+)
+
+var (
+	// ErrNoSuchMember is returned when a member doesn't exist in the group.
+	ErrNoSuchMember = errors.New("member does not exist")
+	// ErrNoSuchChild is returned when a member isn't the child of the user.
+	ErrNoSuchChild = errors.New("child does not exist")
+	// ErrNoSuchGuardian is returned when a user isn't the guardian of a
+	// member.
+	ErrNoSuchGuardian = errors.New("guardian does not exist")
+	// ErrNoSuchInvitation is returned when an invitation doesn't exist or
+	// can't be accepted, because it has expired, has already been accepted
+	// or is for someone else.
+	ErrNoSuchInvitation = errors.New("invitation does not exist")
+	// ErrNoConsent is returned when a guardian changes something about
+	// their child they haven't been given consent to.
+	ErrNoConsent = errors.New("guardian does not have consent")
+)
+
+// GuardianStorer is an interface that must be implemented by things that
+// store guardians and invitations. Everything is scoped to a group, and a
+// guardian only ever sees their own children.
+type GuardianStorer interface {
+	// MemberExists reports whether the member exists in the group.
+	MemberExists(ctx context.Context, groupID, memberID int64) (bool, error)
+	ListGuardians(ctx context.Context, groupID, memberID int64) ([]Guardian, error)
+	SetConsents(ctx context.Context, groupID, memberID, userID int64, consents Consents) (Guardian, error)
+	RemoveGuardian(ctx context.Context, groupID, memberID, userID int64) error
+	// AddInvitation adds the invitation unless any of its members aren't
+	// in its group.
+	AddInvitation(ctx context.Context, invitation Invitation) (Invitation, error)
+	// ListInvitations lists the invitations of the group that haven't been
+	// accepted.
+	ListInvitations(ctx context.Context, groupID int64) ([]Invitation, error)
+	DeleteInvitation(ctx context.Context, groupID, id int64) error
+	// AcceptInvitation accepts the unexpired invitation of the group to the
+	// email with the token's hash, making the user the guardian of its
+	// members that are still in the group.
+	AcceptInvitation(ctx context.Context, groupID, userID int64, email, tokenHash string) error
+	GetChild(ctx context.Context, groupID, userID, memberID int64) (Child, bool, error)
+	ListChildren(ctx context.Context, groupID, userID int64) ([]Child, error)
+	// UpdateContacts replaces the emergency contacts of the user's child if
+	// they have consent to.
+	UpdateContacts(ctx context.Context, groupID, userID, memberID int64, contacts member.EmergencyContacts) error
+	// UpdateDetails corrects the details of the user's child if they have
+	// consent to.
+	UpdateDetails(ctx context.Context, groupID, userID, memberID int64, details Details) error
+}
+
+// GuardianStore is a store for guardians and invitations. It implements the
+// GuardianStorer interface.
+type GuardianStore struct {
+	cluster *db.Cluster
+}
+
+// NewStore creates a new store from the given cluster. Reads go to a replica
+// unless the primary is forced with db.WithPrimary.
+func NewStore(cluster *db.Cluster) GuardianStorer {
+	return GuardianStore{cluster}
+}
+
+// MemberExists reports whether the member exists in the group.
+func (s GuardianStore) MemberExists(ctx context.Context, groupID, memberID int64) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM autocrat.members WHERE group_id = $1 AND id = $2);`
+	if err := s.cluster.Reader(ctx).Named("guardian.member_exists").QueryRowx(ctx, query, groupID, memberID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check member %d exists: %w", memberID, err)
+	}
+	return exists, nil
+}
+
+// guardianColumns selects guardians with the details of their user. The
+// guardians must be joined as g, their members as m and their users as u.
+const guardianColumns = `g.user_id, g.member_id, u.email, u.firstname, u.lastname, g.edit_contacts, g.edit_details, g.created_at`
+
+// ListGuardians lists the guardians of the member of the group, ordered by
+// name.
+func (s GuardianStore) ListGuardians(ctx context.Context, groupID, memberID int64) ([]Guardian, error) {
+	guardians := []Guardian{}
+	query := `
+	SELECT ` + guardianColumns + `
+	FROM autocrat.guardians g
+	JOIN autocrat.members m ON m.id = g.member_id
+	JOIN autocrat.users u ON u.id = g.user_id
+	WHERE m.group_id = $1 AND u.group_id = $1 AND g.member_id = $2
+	ORDER BY u.lastname, u.firstname, u.id;
+	`
+	if err := s.cluster.Reader(ctx).Named("guardian.list_guardians").Select(ctx, &guardians, query, groupID, memberID); err != nil {
+		return nil, fmt.Errorf("failed to list guardians of member %d: %w", memberID, err)
+	}
+	return guardians, nil
+}
+
+// SetConsents replaces what the guardian may change about the member of the
+// group and returns the guardian as they were stored.
+func (s GuardianStore) SetConsents(ctx context.Context, groupID, memberID, userID int64, consents Consents) (Guardian, error) {
+	var guardian Guardian
+	query := `
+	UPDATE autocrat.guardians g
+	SET edit_contacts = $4, edit_details = $5
+	FROM autocrat.members m, autocrat.users u
+	WHERE m.id = g.member_id AND u.id = g.user_id
+		AND m.group_id = $1 AND u.group_id = $1 AND g.member_id = $2 AND g.user_id = $3
+	RETURNING ` + guardianColumns + `;
+	`
+	err := s.cluster.Primary().Named("guardian.set_consents").
+		QueryRowx(ctx, query, groupID, memberID, userID, consents.EditContacts, consents.EditDetails).
+		StructScan(&guardian)
+	if err == sql.ErrNoRows {
+		return Guardian{}, fmt.Errorf("failed to set consents of guardian %d: %w", userID, ErrNoSuchGuardian)
+	} else if err != nil {
+		return Guardian{}, fmt.Errorf("failed to set consents of guardian %d: %w", userID, err)
+	}
+	return guardian, nil
+}
+
+// RemoveGuardian stops the user being the guardian of the member of the
+// group.
+func (s GuardianStore) RemoveGuardian(ctx context.Context, groupID, memberID, userID int64) error {
+	query := `
+	DELETE FROM autocrat.guardians g
+	USING autocrat.members m
+	WHERE m.id = g.member_id AND m.group_id = $1 AND g.member_id = $2 AND g.user_id = $3;
+	`
+	result, err := s.cluster.Primary().Named("guardian.remove_guardian").Exec(ctx, query, groupID, memberID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove guardian %d of member %d: %w", userID, memberID, err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to remove guardian %d of member %d: %w", userID, memberID, err)
+	}
+	if removed == 0 {
+		return fmt.Errorf("failed to remove guardian %d of member %d: %w", userID, memberID, ErrNoSuchGuardian)
+	}
+	return nil
+}
+
+// AddInvitation adds the invitation and returns it as it was stored. The
+// members are checked to be in the group in the same statement. The members
+// must be distinct.
+func (s GuardianStore) AddInvitation(ctx context.Context, invitation Invitation) (Invitation, error) {
+	var added Invitation
+	query := `
+	WITH valid AS (
+		SELECT count(*) = cardinality($3::INTEGER[]) AS ok
+		FROM autocrat.members
+		WHERE group_id = $1::INTEGER AND id = ANY($3::INTEGER[])
+	)
+	INSERT INTO autocrat.guardian_invitations
+		(group_id, email, member_ids, edit_contacts, edit_details, token_hash, invited_by, expires_at)
+	SELECT $1::INTEGER, $2::TEXT, $3::INTEGER[], $4::BOOLEAN, $5::BOOLEAN, $6::TEXT, $7::INTEGER, $8::TIMESTAMPTZ
+	FROM valid WHERE valid.ok
+	RETURNING *;
+	`
+	err := s.cluster.Primary().Named("guardian.add_invitation").
+		QueryRowx(ctx, query, invitation.GroupId, invitation.Email, invitation.MemberIds,
+			invitation.EditContacts, invitation.EditDetails, invitation.TokenHash, invitation.InvitedBy, invitation.ExpiresAt).
+		StructScan(&added)
+	if err == sql.ErrNoRows {
+		return Invitation{}, fmt.Errorf("failed to insert invitation into store: %w", ErrNoSuchMember)
+	} else if err != nil {
+		return Invitation{}, fmt.Errorf("failed to insert invitation into store: %w", err)
+	}
+	return added, nil
+}
+
+// ListInvitations lists the invitations of the group that haven't been
+// accepted, newest first.
+func (s GuardianStore) ListInvitations(ctx context.Context, groupID int64) ([]Invitation, error) {
+	invitations := []Invitation{}
+	query := `
+	SELECT * FROM autocrat.guardian_invitations
+	WHERE group_id = $1 AND accepted_at IS NULL
+	ORDER BY created_at DESC, id DESC;
+	`
+	if err := s.cluster.Reader(ctx).Named("guardian.list_invitations").Select(ctx, &invitations, query, groupID); err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// DeleteInvitation deletes the invitation of the group with the given ID.
+func (s GuardianStore) DeleteInvitation(ctx context.Context, groupID, id int64) error {
+	query := `DELETE FROM autocrat.guardian_invitations WHERE group_id = $1 AND id = $2;`
+	result, err := s.cluster.Primary().Named("guardian.delete_invitation").Exec(ctx, query, groupID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete invitation %d: %w", id, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete invitation %d: %w", id, err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("failed to delete invitation %d: %w", id, ErrNoSuchInvitation)
+	}
+	return nil
+}
+
+// AcceptInvitation accepts the invitation with the token's hash, which must
+// be to the user's email in their group, unaccepted and unexpired. The user
+// becomes the guardian of its members with its consents, replacing the
+// consents they already had.
+func (s GuardianStore) AcceptInvitation(ctx context.Context, groupID, userID int64, email, tokenHash string) error {
+	var accepted bool
+	query := `
+	WITH invitation AS (
+		UPDATE autocrat.guardian_invitations
+		SET accepted_at = now(), accepted_by = $2::INTEGER
+		WHERE group_id = $1::INTEGER AND token_hash = $4::TEXT AND lower(email) = lower($3::TEXT)
+			AND accepted_at IS NULL AND expires_at > now()
+		RETURNING member_ids, edit_contacts, edit_details
+	), linked AS (
+		INSERT INTO autocrat.guardians (user_id, member_id, edit_contacts, edit_details)
+		SELECT $2::INTEGER, m.id, i.edit_contacts, i.edit_details
+		FROM invitation i JOIN autocrat.members m ON m.id = ANY(i.member_ids)
+		WHERE m.group_id = $1::INTEGER
+		ON CONFLICT (user_id, member_id) DO UPDATE
+		SET edit_contacts = EXCLUDED.edit_contacts, edit_details = EXCLUDED.edit_details
+	)
+	SELECT EXISTS (SELECT 1 FROM invitation);
+	`
+	err := s.cluster.Primary().Named("guardian.accept_invitation").QueryRowx(ctx, query, groupID, userID, email, tokenHash).Scan(&accepted)
+	if err != nil {
+		return fmt.Errorf("failed to accept invitation: %w", err)
+	} else if !accepted {
+		return fmt.Errorf("failed to accept invitation: %w", ErrNoSuchInvitation)
+	}
+	return nil
+}
+
+// childColumns selects children with what their guardian may change. The
+// guardians must be joined as g and their members as m.
+const childColumns = `m.id, m.firstname, m.lastname, m.date_of_birth, m.section, m.patrol, m.status, m.emergency_contacts, g.edit_contacts, g.edit_details`
+
+// GetChild gets the member of the group the user is the guardian of.
+func (s GuardianStore) GetChild(ctx context.Context, groupID, userID, memberID int64) (child Child, found bool, err error) {
+	query := `
+	SELECT ` + childColumns + `
+	FROM autocrat.guardians g
+	JOIN autocrat.members m ON m.id = g.member_id
+	JOIN autocrat.users u ON u.id = g.user_id
+	WHERE m.group_id = $1 AND u.group_id = $1 AND g.user_id = $2 AND g.member_id = $3;
+	`
+	err = s.cluster.Reader(ctx).Named("guardian.get_child").QueryRowx(ctx, query, groupID, userID, memberID).StructScan(&child)
+	if err == sql.ErrNoRows {
+		return Child{}, false, nil
+	} else if err != nil {
+		return Child{}, false, fmt.Errorf("could not get child %d: %w", memberID, err)
+	}
+	return child, true, nil
+}
+
+// ListChildren lists the members of the group the user is the guardian of,
+// ordered by name.
+func (s GuardianStore) ListChildren(ctx context.Context, groupID, userID int64) ([]Child, error) {
+	children := []Child{}
+	query := `
+	SELECT ` + childColumns + `
+	FROM autocrat.guardians g
+	JOIN autocrat.members m ON m.id = g.member_id
+	JOIN autocrat.users u ON u.id = g.user_id
+	WHERE m.group_id = $1 AND u.group_id = $1 AND g.user_id = $2
+	ORDER BY m.lastname, m.firstname, m.id;
+	`
+	if err := s.cluster.Reader(ctx).Named("guardian.list_children").Select(ctx, &children, query, groupID, userID); err != nil {
+		return nil, fmt.Errorf("failed to list children of user %d: %w", userID, err)
+	}
+	return children, nil
+}
+
+// UpdateContacts replaces the emergency contacts of the user's child. The
+// consent is checked in the same statement so it can't be withdrawn in
+// between.
+func (s GuardianStore) UpdateContacts(ctx context.Context, groupID, userID, memberID int64, contacts member.EmergencyContacts) error {
+	query := `
+	UPDATE autocrat.members m
+	SET emergency_contacts = $4, updated_at = now()
+	FROM autocrat.guardians g
+	WHERE g.member_id = m.id AND m.group_id = $1 AND g.user_id = $2 AND m.id = $3 AND g.edit_contacts;
+	`
+	return checkConsented(s.cluster.Primary().Named("guardian.update_contacts").Exec(ctx, query, groupID, userID, memberID, contacts))
+}
+
+// UpdateDetails corrects the details of the user's child. The consent is
+// checked in the same statement so it can't be withdrawn in between.
+func (s GuardianStore) UpdateDetails(ctx context.Context, groupID, userID, memberID int64, details Details) error {
+	query := `
+	UPDATE autocrat.members m
+	SET firstname = $4, lastname = $5, date_of_birth = $6, updated_at = now()
+	FROM autocrat.guardians g
+	WHERE g.member_id = m.id AND m.group_id = $1 AND g.user_id = $2 AND m.id = $3 AND g.edit_details;
+	`
+	return checkConsented(s.cluster.Primary().Named("guardian.update_details").
+		Exec(ctx, query, groupID, userID, memberID, details.FirstName, details.LastName, details.DateOfBirth))
+}
+
+// checkConsented checks a guardian's change to their child was made, which
+// it isn't without consent.
+func checkConsented(result sql.Result, err error) error {
+	if err != nil {
+		return fmt.Errorf("failed to update child: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update child: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("failed to update child: %w", ErrNoConsent)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package guardian
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/db/dbtest"
+	"go.uber.org/zap"
+)
+
+func TestStoreRoutesReads(t *testing.T) {
+	primary := dbtest.NewRecorder(t.Name() + "/primary")
+	replica := dbtest.NewRecorder(t.Name() + "/replica")
+	cluster := db.NewCluster(zap.NewNop(), primary.DB, replica.DB)
+	cluster.CheckLag = func(ctx context.Context, replica *db.DB) (time.Duration, error) {
+		return 0, nil
+	}
+	cluster.CheckReplicas(context.Background())
+	store := NewStore(cluster)
+	ctx := context.Background()
+
+	if _, err := store.ListInvitations(ctx, testGroupID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ListChildren(ctx, testGroupID, parent.Id); err != nil {
+		t.Fatal(err)
+	}
+	if queries := replica.Queries(); len(queries) != 2 || len(primary.Queries()) != 0 {
+		t.Fatalf("Expected reads to go to the replica, got %d on the replica and %d on the primary", len(queries), len(primary.Queries()))
+	}
+
+	replica.Reset()
+	if err := store.DeleteInvitation(ctx, testGroupID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ListChildren(db.WithPrimary(ctx), testGroupID, parent.Id); err != nil {
+		t.Fatal(err)
+	}
+	queries := primary.Queries()
+	if len(queries) != 2 || len(replica.Queries()) != 0 {
+		t.Fatalf("Expected writes and forced reads to go to the primary, got %d on the primary and %d on the replica", len(queries), len(replica.Queries()))
+	}
+	if !strings.Contains(queries[0], "DELETE FROM autocrat.guardian_invitations") || !strings.Contains(queries[1], "FROM autocrat.guardians") {
+		t.Errorf("Expected the delete then the forced read on the primary, got %q", queries)
+	}
+}
@@ -0,0 +1,233 @@
+package guardian
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/meeting"
+	"github.com/nick96/cubapi/member"
+	"github.com/nick96/cubapi/progress"
+	"github.com/nick96/cubapi/security"
+	"github.com/nick96/cubapi/user"
+)
+
+// Groups members and users belong to in tests.
+const (
+	testGroupID  = 1
+	otherGroupID = 2
+)
+
+// mockMember is a member of a group.
+type mockMember struct {
+	groupID     int64
+	firstName   string
+	lastName    string
+	dateOfBirth date.Date
+	section     string
+	contacts    member.EmergencyContacts
+}
+
+// guardianship identifies a user being the guardian of a member.
+type guardianship struct {
+	userID, memberID int64
+}
+
+// mockGuardianStore stores guardians and invitations in memory.
+type mockGuardianStore struct {
+	members     map[int64]mockMember
+	users       map[int64]user.User
+	guardians   map[guardianship]Consents
+	invitations map[int64]Invitation
+}
+
+func newMockGuardianStore() *mockGuardianStore {
+	return &mockGuardianStore{
+		members:     make(map[int64]mockMember),
+		users:       make(map[int64]user.User),
+		guardians:   make(map[guardianship]Consents),
+		invitations: make(map[int64]Invitation),
+	}
+}
+
+// inGroup reports whether both the member and the user are in the group.
+func (s *mockGuardianStore) inGroup(groupID int64, key guardianship) bool {
+	m, ok := s.members[key.memberID]
+	u, found := s.users[key.userID]
+	return ok && found && m.groupID == groupID && u.GroupId == groupID
+}
+
+func (s *mockGuardianStore) MemberExists(ctx context.Context, groupID, memberID int64) (bool, error) {
+	m, ok := s.members[memberID]
+	return ok && m.groupID == groupID, nil
+}
+
+func (s *mockGuardianStore) ListGuardians(ctx context.Context, groupID, memberID int64) ([]Guardian, error) {
+	guardians := []Guardian{}
+	for key := range s.guardians {
+		if key.memberID == memberID && s.inGroup(groupID, key) {
+			guardians = append(guardians, s.guardian(key))
+		}
+	}
+	sort.Slice(guardians, func(i, j int) bool { return guardians[i].UserId < guardians[j].UserId })
+	return guardians, nil
+}
+
+func (s *mockGuardianStore) guardian(key guardianship) Guardian {
+	u := s.users[key.userID]
+	return Guardian{
+		UserId:    key.userID,
+		MemberId:  key.memberID,
+		Email:     u.Email,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Consents:  s.guardians[key],
+	}
+}
+
+func (s *mockGuardianStore) SetConsents(ctx context.Context, groupID, memberID, userID int64, consents Consents) (Guardian, error) {
+	key := guardianship{userID, memberID}
+	if _, ok := s.guardians[key]; !ok || !s.inGroup(groupID, key) {
+		return Guardian{}, ErrNoSuchGuardian
+	}
+	s.guardians[key] = consents
+	return s.guardian(key), nil
+}
+
+func (s *mockGuardianStore) RemoveGuardian(ctx context.Context, groupID, memberID, userID int64) error {
+	key := guardianship{userID, memberID}
+	if m, ok := s.members[memberID]; !ok || m.groupID != groupID {
+		return ErrNoSuchGuardian
+	} else if _, ok := s.guardians[key]; !ok {
+		return ErrNoSuchGuardian
+	}
+	delete(s.guardians, key)
+	return nil
+}
+
+func (s *mockGuardianStore) AddInvitation(ctx context.Context, invitation Invitation) (Invitation, error) {
+	for _, id := range invitation.MemberIds {
+		if m, ok := s.members[id]; !ok || m.groupID != invitation.GroupId {
+			return Invitation{}, ErrNoSuchMember
+		}
+	}
+	invitation.Id = int64(len(s.invitations) + 1)
+	for s.invitations[invitation.Id].Id != 0 {
+		invitation.Id++
+	}
+	invitation.CreatedAt = time.Now()
+	s.invitations[invitation.Id] = invitation
+	return invitation, nil
+}
+
+func (s *mockGuardianStore) ListInvitations(ctx context.Context, groupID int64) ([]Invitation, error) {
+	invitations := []Invitation{}
+	for _, invitation := range s.invitations {
+		if invitation.GroupId == groupID && invitation.AcceptedAt == nil {
+			invitations = append(invitations, invitation)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].Id > invitations[j].Id })
+	return invitations, nil
+}
+
+func (s *mockGuardianStore) DeleteInvitation(ctx context.Context, groupID, id int64) error {
+	if invitation, ok := s.invitations[id]; !ok || invitation.GroupId != groupID {
+		return ErrNoSuchInvitation
+	}
+	delete(s.invitations, id)
+	return nil
+}
+
+func (s *mockGuardianStore) AcceptInvitation(ctx context.Context, groupID, userID int64, email, tokenHash string) error {
+	for id, invitation := range s.invitations {
+		if invitation.GroupId != groupID || invitation.TokenHash != tokenHash || !strings.EqualFold(invitation.Email, email) ||
+			invitation.AcceptedAt != nil || !invitation.ExpiresAt.After(time.Now()) {
+			continue
+		}
+		now := time.Now()
+		invitation.AcceptedAt = &now
+		invitation.AcceptedBy = &userID
+		s.invitations[id] = invitation
+		for _, memberID := range invitation.MemberIds {
+			if m, ok := s.members[memberID]; ok && m.groupID == groupID {
+				s.guardians[guardianship{userID, memberID}] = invitation.Consents
+			}
+		}
+		return nil
+	}
+	return ErrNoSuchInvitation
+}
+
+func (s *mockGuardianStore) child(key guardianship) Child {
+	m := s.members[key.memberID]
+	return Child{
+		Id:                key.memberID,
+		FirstName:         m.firstName,
+		LastName:          m.lastName,
+		DateOfBirth:       m.dateOfBirth,
+		Section:           m.section,
+		Status:            "active",
+		EmergencyContacts: m.contacts,
+		Consents:          s.guardians[key],
+	}
+}
+
+func (s *mockGuardianStore) GetChild(ctx context.Context, groupID, userID, memberID int64) (Child, bool, error) {
+	key := guardianship{userID, memberID}
+	if _, ok := s.guardians[key]; !ok || !s.inGroup(groupID, key) {
+		return Child{}, false, nil
+	}
+	return s.child(key), true, nil
+}
+
+func (s *mockGuardianStore) ListChildren(ctx context.Context, groupID, userID int64) ([]Child, error) {
+	children := []Child{}
+	for key := range s.guardians {
+		if key.userID == userID && s.inGroup(groupID, key) {
+			children = append(children, s.child(key))
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Id < children[j].Id })
+	return children, nil
+}
+
+func (s *mockGuardianStore) UpdateContacts(ctx context.Context, groupID, userID, memberID int64, contacts member.EmergencyContacts) error {
+	key := guardianship{userID, memberID}
+	if consents, ok := s.guardians[key]; !ok || !s.inGroup(groupID, key) || !consents.EditContacts {
+		return ErrNoConsent
+	}
+	m := s.members[memberID]
+	m.contacts = contacts
+	s.members[memberID] = m
+	return nil
+}
+
+func (s *mockGuardianStore) UpdateDetails(ctx context.Context, groupID, userID, memberID int64, details Details) error {
+	key := guardianship{userID, memberID}
+	if consents, ok := s.guardians[key]; !ok || !s.inGroup(groupID, key) || !consents.EditDetails {
+		return ErrNoConsent
+	}
+	m := s.members[memberID]
+	m.firstName, m.lastName, m.dateOfBirth = details.FirstName, details.LastName, details.DateOfBirth
+	s.members[memberID] = m
+	return nil
+}
+
+// mockReader reads the progress and attendance of any member, recording
+// which members were read.
+type mockReader struct {
+	read []int64
+}
+
+func (r *mockReader) MemberProgress(ctx context.Context, groupID, memberID int64) ([]progress.Progress, security.ClientError) {
+	r.read = append(r.read, memberID)
+	return []progress.Progress{{MemberId: memberID, BadgeKey: "outdoors", Name: "Outdoors", Kind: "oas"}}, nil
+}
+
+func (r *mockReader) MemberRate(ctx context.Context, groupID, memberID int64, filter meeting.Filter) (meeting.Rate, security.ClientError) {
+	r.read = append(r.read, memberID)
+	return meeting.Rate{MemberId: memberID, Meetings: 4, Present: 3, Absent: 1, Rate: 0.75}, nil
+}
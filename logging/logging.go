@@ -0,0 +1,95 @@
+// Package logging scopes loggers to requests so every log line written while
+// serving a request can be correlated with it.
+//
+// The middleware that starts serving a request creates a scope with NewContext
+// and anything that learns more about the request, like who is making it, adds
+// to the scope with AddFields. Loggers built with Logger or FromContext include
+// the scope's fields along with the trace and span IDs.
+package logging
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nick96/cubapi/tracing"
+	"go.uber.org/zap"
+)
+
+type scopeKey struct{}
+
+// scope holds the fields of a request. It is shared by everything handling the
+// request so fields added deep in a handler are seen by middleware that logs
+// once the handler has returned.
+type scope struct {
+	mu     sync.Mutex
+	fields []zap.Field
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger = zap.NewNop()
+)
+
+// SetDefault sets the logger FromContext builds on.
+func SetDefault(logger *zap.Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = logger
+}
+
+// Default returns the logger FromContext builds on. Until SetDefault is called
+// this logger discards everything.
+func Default() *zap.Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+// NewContext returns a copy of the context with a new scope holding the given
+// fields. Fields from any enclosing scope are inherited.
+func NewContext(ctx context.Context, fields ...zap.Field) context.Context {
+	s := &scope{fields: append(scopeFields(ctx), fields...)}
+	return context.WithValue(ctx, scopeKey{}, s)
+}
+
+// AddFields adds fields to the scope in the context. They are included in
+// every logger built from the scope afterwards, including those of callers
+// further up the stack. It does nothing if the context has no scope.
+func AddFields(ctx context.Context, fields ...zap.Field) {
+	s, ok := ctx.Value(scopeKey{}).(*scope)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fields = append(s.fields, fields...)
+}
+
+// Fields returns the fields of the scope in the context along with the trace
+// and span IDs.
+func Fields(ctx context.Context) []zap.Field {
+	return append(scopeFields(ctx), tracing.LogFields(ctx)...)
+}
+
+func scopeFields(ctx context.Context) []zap.Field {
+	s, ok := ctx.Value(scopeKey{}).(*scope)
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Copy so appending to the result can't race with AddFields.
+	return append([]zap.Field(nil), s.fields...)
+}
+
+// Logger returns the logger with the fields of the context added to every log
+// line.
+func Logger(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	return logger.With(Fields(ctx)...)
+}
+
+// FromContext returns the default logger with the fields of the context added
+// to every log line.
+func FromContext(ctx context.Context) *zap.Logger {
+	return Logger(ctx, Default())
+}
@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAddFieldsIsSeenByEnclosingScope(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	ctx := NewContext(context.Background(), zap.String("requestID", "abc"))
+
+	// Handlers get a derived context but add to the same scope.
+	handlerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	AddFields(handlerCtx, zap.Int64("userID", 42))
+
+	Logger(ctx, zap.New(core)).Info("Received request")
+	fields := logs.All()[0].ContextMap()
+	if fields["requestID"] != "abc" || fields["userID"] != int64(42) {
+		t.Fatalf("Expected request and user fields, got %v", fields)
+	}
+}
+
+func TestNestedScopeInheritsFields(t *testing.T) {
+	ctx := NewContext(context.Background(), zap.String("requestID", "abc"))
+	nested := NewContext(ctx, zap.String("route", "/user"))
+	AddFields(nested, zap.String("only", "nested"))
+
+	if got := len(Fields(ctx)); got != 1 {
+		t.Errorf("Expected the outer scope to be unaffected, got %d fields", got)
+	}
+	if got := len(Fields(nested)); got != 3 {
+		t.Errorf("Expected the nested scope to inherit fields, got %d fields", got)
+	}
+}
+
+func TestFromContextWithoutScope(t *testing.T) {
+	AddFields(context.Background(), zap.String("ignored", "true"))
+	if fields := Fields(context.Background()); len(fields) != 0 {
+		t.Fatalf("Expected no fields, got %v", fields)
+	}
+	if FromContext(context.Background()) == nil {
+		t.Fatal("Expected the default logger")
+	}
+}
@@ -0,0 +1,450 @@
+package meeting
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/user"
+	"go.uber.org/zap"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// MeetingRequest creates or replaces a meeting.
+type MeetingRequest struct {
+	Section  string    `json:"section" validate:"oneof=joeys cubs scouts venturers rovers"`
+	HeldOn   date.Date `json:"heldOn" validate:"required"`
+	Location string    `json:"location,omitempty" validate:"max=256"`
+	Program  string    `json:"program,omitempty" validate:"max=4096"`
+}
+
+// meeting converts the request to a meeting of the group.
+func (m MeetingRequest) meeting(groupID int64) Meeting {
+	return Meeting{
+		GroupId:  groupID,
+		Section:  m.Section,
+		HeldOn:   m.HeldOn,
+		Location: m.Location,
+		Program:  m.Program,
+	}
+}
+
+// MarkRequest marks the attendance of a member.
+type MarkRequest struct {
+	Status string `json:"status" validate:"oneof=present absent apologies late"`
+}
+
+// MemberMark marks the attendance of the member with the ID.
+type MemberMark struct {
+	MemberId int64  `json:"memberId" validate:"required"`
+	Status   string `json:"status" validate:"oneof=present absent apologies late"`
+}
+
+// BulkMarkRequest marks the attendance of many members.
+type BulkMarkRequest struct {
+	// Status, if given, is the status of every active member of the
+	// meeting's section whose attendance isn't given.
+	Status     string       `json:"status,omitempty" validate:"omitempty,oneof=present absent apologies late"`
+	Attendance []MemberMark `json:"attendance" validate:"max=500,dive"`
+}
+
+// RequirementsRequest replaces the badge requirements a meeting meets.
+type RequirementsRequest struct {
+	Requirements Requirements `json:"requirements" validate:"max=64,dive"`
+}
+
+type MeetingResponse Meeting
+
+func (m MeetingResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type MeetingDetailResponse MeetingDetail
+
+func (m MeetingDetailResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type AttendanceResponse Attendance
+
+func (a AttendanceResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type RateResponse Rate
+
+func (rate RateResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type SectionRatesResponse SectionRates
+
+func (s SectionRatesResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// NewMeetingRouter creates a router for the meetings of the caller's group
+// and attendance at them. It must be behind authentication, which decides the
+// group and who marks attendance. Ranges of dates are given by the from and
+// to query parameters and default to the year up to today.
+//
+// GET /: List meetings in a range of dates, optionally of the section query
+// parameter.
+// POST /: Add a meeting.
+// GET /{meetingID}: Get a meeting with its attendance.
+// PUT /{meetingID}: Replace the details of a meeting.
+// DELETE /{meetingID}: Delete a meeting and its attendance.
+// PUT /{meetingID}/requirements: Replace the badge requirements a meeting
+// meets, crediting the members who attended it with pending completions.
+// POST /{meetingID}/attendance: Mark the attendance of many members, or a
+// whole section, at a meeting.
+// PUT /{meetingID}/attendance/{memberID}: Mark the attendance of a member at
+// a meeting.
+// GET /attendance/member/{memberID}: Get how often a member attended
+// meetings in a range of dates.
+// GET /attendance/section/{section}: Get how often the members of a section
+// attended meetings in a range of dates.
+func NewMeetingRouter(logger *zap.Logger, service MeetingService) func(chi.Router) {
+	validate := problem.NewValidator()
+	date.RegisterValidation(validate)
+	return func(r chi.Router) {
+		r.Get("/", listMeetings(logger, service))
+		r.Post("/", newMeeting(logger, validate, service))
+		r.Get("/{meetingID}", getMeeting(logger, service))
+		r.Put("/{meetingID}", updateMeeting(logger, validate, service))
+		r.Delete("/{meetingID}", deleteMeeting(logger, service))
+		r.Put("/{meetingID}/requirements", setRequirements(logger, validate, service))
+		r.Post("/{meetingID}/attendance", markAttendance(logger, validate, service))
+		r.Put("/{meetingID}/attendance/{memberID}", markMember(logger, validate, service))
+		r.Get("/attendance/member/{memberID}", memberRate(logger, service))
+		r.Get("/attendance/section/{section}", sectionRates(logger, service))
+	}
+}
+
+func listMeetings(logger *zap.Logger, service MeetingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := group.FromRequest(w, r)
+		if !ok {
+			return
+		}
+		filter, ok := dateRange(w, r)
+		if !ok {
+			return
+		}
+		filter.Section = r.URL.Query().Get("section")
+		meetings, err := service.ListMeetings(r.Context(), groupID, filter)
+		if err != nil {
+			logger.Info("Failed to list meetings", zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, meetings)
+	}
+}
+
+func newMeeting(logger *zap.Logger, validate *validator.Validate, service MeetingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := group.FromRequest(w, r)
+		if !ok {
+			return
+		}
+		var request MeetingRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		meeting, err := service.NewMeeting(r.Context(), request.meeting(groupID))
+		if err != nil {
+			logger.Info("Failed to create meeting", zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Debug("Created meeting", zap.Int64("meetingID", meeting.Id))
+		render.Status(r, http.StatusCreated)
+		render.Render(w, r, MeetingResponse(meeting))
+	}
+}
+
+func getMeeting(logger *zap.Logger, service MeetingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "meetingID", "Meeting")
+		if !ok {
+			return
+		}
+		meeting, err := service.GetMeeting(r.Context(), groupID, id)
+		if err != nil {
+			logger.Info("Failed to get meeting", zap.Int64("meetingID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, MeetingDetailResponse(meeting))
+	}
+}
+
+func updateMeeting(logger *zap.Logger, validate *validator.Validate, service MeetingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "meetingID", "Meeting")
+		if !ok {
+			return
+		}
+		var request MeetingRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		meeting := request.meeting(groupID)
+		meeting.Id = id
+		updated, err := service.UpdateMeeting(r.Context(), meeting)
+		if err != nil {
+			logger.Info("Failed to update meeting", zap.Int64("meetingID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, MeetingResponse(updated))
+	}
+}
+
+func deleteMeeting(logger *zap.Logger, service MeetingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "meetingID", "Meeting")
+		if !ok {
+			return
+		}
+		if err := service.DeleteMeeting(r.Context(), groupID, id); err != nil {
+			logger.Info("Failed to delete meeting", zap.Int64("meetingID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Deleted meeting", zap.Int64("meetingID", id))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func setRequirements(logger *zap.Logger, validate *validator.Validate, service MeetingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "meetingID", "Meeting")
+		if !ok {
+			return
+		}
+		current, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+		var request RequirementsRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		if request.Requirements == nil {
+			request.Requirements = Requirements{}
+		}
+		updated, err := service.SetRequirements(r.Context(), groupID, id, current.Id, request.Requirements)
+		if err != nil {
+			logger.Info("Failed to set meeting requirements", zap.Int64("meetingID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Debug("Set meeting requirements", zap.Int64("meetingID", id), zap.Int("requirements", len(updated.Requirements)))
+		render.Render(w, r, MeetingResponse(updated))
+	}
+}
+
+func markAttendance(logger *zap.Logger, validate *validator.Validate, service MeetingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "meetingID", "Meeting")
+		if !ok {
+			return
+		}
+		current, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+		var request BulkMarkRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		attendance := make([]Attendance, 0, len(request.Attendance))
+		for _, mark := range request.Attendance {
+			attendance = append(attendance, Attendance{MemberId: mark.MemberId, Status: mark.Status})
+		}
+		marked, err := service.MarkAttendance(r.Context(), groupID, id, current.Id, attendance, request.Status)
+		if err != nil {
+			logger.Info("Failed to mark attendance", zap.Int64("meetingID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Debug("Marked attendance", zap.Int64("meetingID", id), zap.Int("members", len(marked)))
+		render.JSON(w, r, marked)
+	}
+}
+
+func markMember(logger *zap.Logger, validate *validator.Validate, service MeetingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "meetingID", "Meeting")
+		if !ok {
+			return
+		}
+		memberID, err := strconv.ParseInt(chi.URLParam(r, "memberID"), 10, 64)
+		if err != nil {
+			problem.Write(w, r, problem.New(problem.CodeNotFound, "Member does not exist"))
+			return
+		}
+		current, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+		var request MarkRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		marked, clientErr := service.MarkAttendance(r.Context(), groupID, id, current.Id, []Attendance{{MemberId: memberID, Status: request.Status}}, "")
+		if clientErr != nil {
+			logger.Info("Failed to mark attendance", zap.Int64("meetingID", id), zap.Int64("memberID", memberID), zap.Error(clientErr))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, clientErr))
+			return
+		}
+		render.Render(w, r, AttendanceResponse(marked[0]))
+	}
+}
+
+func memberRate(logger *zap.Logger, service MeetingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, memberID, ok := pathID(w, r, "memberID", "Member")
+		if !ok {
+			return
+		}
+		filter, ok := dateRange(w, r)
+		if !ok {
+			return
+		}
+		rate, err := service.MemberRate(r.Context(), groupID, memberID, filter)
+		if err != nil {
+			logger.Info("Failed to get attendance rate", zap.Int64("memberID", memberID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, RateResponse(rate))
+	}
+}
+
+func sectionRates(logger *zap.Logger, service MeetingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := group.FromRequest(w, r)
+		if !ok {
+			return
+		}
+		filter, ok := dateRange(w, r)
+		if !ok {
+			return
+		}
+		filter.Section = chi.URLParam(r, "section")
+		if !contains(group.Sections, filter.Section) {
+			problem.Write(w, r, problem.New(problem.CodeNotFound, "Section does not exist"))
+			return
+		}
+		rates, err := service.SectionRates(r.Context(), groupID, filter)
+		if err != nil {
+			logger.Info("Failed to get attendance rates", zap.String("section", filter.Section), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, SectionRatesResponse(rates))
+	}
+}
+
+// dateRange parses the from and to query parameters into a filter. Either
+// can be left out. A problem is written if they aren't dates.
+func dateRange(w http.ResponseWriter, r *http.Request) (Filter, bool) {
+	var filter Filter
+	for _, param := range []struct {
+		name string
+		d    *date.Date
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := r.URL.Query().Get(param.name)
+		if value == "" {
+			continue
+		}
+		d, err := date.Parse(value)
+		if err != nil {
+			problem.Write(w, r, problem.New(problem.CodeValidationFailed, param.name+" must be a date formatted as YYYY-MM-DD"))
+			return Filter{}, false
+		}
+		*param.d = d
+	}
+	return filter, true
+}
+
+// pathID gets the caller's group and parses the ID in the path parameter.
+// Anything that isn't an ID can't exist so it's not found.
+func pathID(w http.ResponseWriter, r *http.Request, param, name string) (groupID, id int64, ok bool) {
+	groupID, ok = group.FromRequest(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, param), 10, 64)
+	if err != nil {
+		problem.Write(w, r, problem.New(problem.CodeNotFound, name+" does not exist"))
+		return 0, 0, false
+	}
+	return groupID, id, true
+}
+
+// currentUser gets the authenticated user, who is recorded as having marked
+// attendance. A problem is written if there isn't one, which means the router
+// isn't behind authentication.
+func currentUser(w http.ResponseWriter, r *http.Request) (user.User, bool) {
+	current, ok := user.FromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Internal(fmt.Errorf("no authenticated user in request context")))
+		return user.User{}, false
+	}
+	return current, true
+}
+
+// decodeRequest decodes and validates a request into v. A problem is written
+// if the request is invalid.
+func decodeRequest(logger *zap.Logger, w http.ResponseWriter, r *http.Request, validate *validator.Validate, v interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Info("Failed to read request body", zap.Error(err))
+		problem.Write(w, r, problem.Internal(err))
+		return false
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, v); err != nil {
+		logger.Info("Failed to unmarshal request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Request body is invalid JSON", err))
+		return false
+	}
+	if err := validate.Struct(v); err != nil {
+		logger.Info("Invalid request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Invalid request body", err))
+		return false
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
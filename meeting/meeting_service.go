@@ -0,0 +1,352 @@
+package meeting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/progress"
+	"github.com/nick96/cubapi/security"
+	"github.com/nick96/cubapi/tracing"
+)
+
+// defaultRange is how many days before the end of a range of dates it starts
+// if it isn't given.
+const defaultRange = 365
+
+// Crediter credits members who attend meetings with the badge requirements
+// the meetings meet. It's implemented by progress.ProgressService.
+type Crediter interface {
+	// CheckRequirement checks the requirement of the badge with the key
+	// can be credited.
+	CheckRequirement(ctx context.Context, key, requirementID string) security.ClientError
+	// CreditMeeting makes what attending the meeting credits members with
+	// match the credit, withdrawing what it no longer does.
+	CreditMeeting(ctx context.Context, credit progress.MeetingCredit) security.ClientError
+}
+
+type MeetingService struct {
+	store    MeetingStorer
+	crediter Crediter
+	// location is the time zone dates are in, it decides when today is.
+	location *time.Location
+}
+
+// NewMeetingService creates a MeetingService that stores meetings and
+// attendance in the store and credits members who attend meetings with the
+// crediter. Dates, like when a meeting is held, are in the given location.
+func NewMeetingService(store MeetingStorer, crediter Crediter, location *time.Location) MeetingService {
+	return MeetingService{store: store, crediter: crediter, location: location}
+}
+
+// GetMeeting gets the meeting of the group with the given ID and its
+// attendance.
+func (s MeetingService) GetMeeting(ctx context.Context, groupID, id int64) (MeetingDetail, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "MeetingService.GetMeeting")
+	defer span.End()
+
+	meeting, clientErr := s.getMeeting(ctx, groupID, id)
+	if clientErr != nil {
+		return MeetingDetail{}, clientErr
+	}
+	attendance, err := s.store.ListAttendance(ctx, groupID, id)
+	if err != nil {
+		span.RecordError(err)
+		return MeetingDetail{}, security.NewClientError(fmt.Sprintf("failed to list attendance of meeting %d", id), err)
+	}
+	return MeetingDetail{Meeting: meeting, Attendance: attendance}, nil
+}
+
+func (s MeetingService) getMeeting(ctx context.Context, groupID, id int64) (Meeting, security.ClientError) {
+	meeting, found, err := s.store.GetMeeting(ctx, groupID, id)
+	if err != nil {
+		return Meeting{}, security.NewClientError(fmt.Sprintf("failed to get meeting %d", id), err)
+	} else if !found {
+		return Meeting{}, problem.NewError(problem.CodeNotFound, fmt.Sprintf("meeting %d does not exist", id), ErrNoSuchMeeting)
+	}
+	return meeting, nil
+}
+
+// ListMeetings lists the meetings of the group matching the filter. The
+// filter's dates default to the year up to today.
+func (s MeetingService) ListMeetings(ctx context.Context, groupID int64, filter Filter) ([]Meeting, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "MeetingService.ListMeetings")
+	defer span.End()
+
+	filter, clientErr := s.dates(filter)
+	if clientErr != nil {
+		return nil, clientErr
+	}
+	meetings, err := s.store.ListMeetings(ctx, groupID, filter)
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError("failed to list meetings", err)
+	}
+	return meetings, nil
+}
+
+// NewMeeting adds a meeting to the meeting's group. It meets no
+// requirements until they are set.
+func (s MeetingService) NewMeeting(ctx context.Context, meeting Meeting) (Meeting, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "MeetingService.NewMeeting")
+	defer span.End()
+
+	meeting.Requirements = Requirements{}
+	added, err := s.store.AddMeeting(ctx, meeting)
+	if err != nil {
+		span.RecordError(err)
+		return Meeting{}, storeError("failed to add meeting", err)
+	}
+	return added, nil
+}
+
+// UpdateMeeting replaces the details of the meeting with the meeting's ID in
+// the meeting's group. Its requirements and the attendance already marked
+// are kept.
+func (s MeetingService) UpdateMeeting(ctx context.Context, meeting Meeting) (Meeting, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "MeetingService.UpdateMeeting")
+	defer span.End()
+
+	updated, err := s.store.UpdateMeeting(ctx, meeting)
+	if err != nil {
+		span.RecordError(err)
+		return Meeting{}, storeError(fmt.Sprintf("failed to update meeting %d", meeting.Id), err)
+	}
+	return updated, nil
+}
+
+// SetRequirements replaces the requirements the meeting of the group meets
+// and credits the members who attended it with them, as recorded by the user
+// with recordedBy. Credit for requirements it no longer meets is withdrawn.
+func (s MeetingService) SetRequirements(ctx context.Context, groupID, id, recordedBy int64, requirements Requirements) (Meeting, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "MeetingService.SetRequirements")
+	defer span.End()
+	// Crediting reads back the attendance and credit just written.
+	ctx = db.WithPrimary(ctx)
+
+	seen := make(map[RequirementRef]bool, len(requirements))
+	for _, requirement := range requirements {
+		if seen[requirement] {
+			return Meeting{}, problem.Invalid("requirement %s of badge %s is given more than once", requirement.RequirementId, requirement.BadgeKey)
+		}
+		seen[requirement] = true
+		if err := s.crediter.CheckRequirement(ctx, requirement.BadgeKey, requirement.RequirementId); err != nil {
+			return Meeting{}, err
+		}
+	}
+	updated, err := s.store.SetRequirements(ctx, groupID, id, requirements)
+	if err != nil {
+		span.RecordError(err)
+		return Meeting{}, storeError(fmt.Sprintf("failed to set requirements of meeting %d", id), err)
+	}
+	if err := s.credit(ctx, updated, recordedBy); err != nil {
+		return Meeting{}, err
+	}
+	return updated, nil
+}
+
+// credit credits the members who attended the meeting, present or late,
+// with its requirements, as recorded by the user with recordedBy, and
+// withdraws the credit of everyone else.
+func (s MeetingService) credit(ctx context.Context, meeting Meeting, recordedBy int64) security.ClientError {
+	attendance, err := s.store.ListAttendance(ctx, meeting.GroupId, meeting.Id)
+	if err != nil {
+		return security.NewClientError(fmt.Sprintf("failed to list attendance of meeting %d", meeting.Id), err)
+	}
+	credit := progress.MeetingCredit{
+		GroupId:    meeting.GroupId,
+		MeetingId:  meeting.Id,
+		HeldOn:     meeting.HeldOn,
+		RecordedBy: recordedBy,
+		Notes:      fmt.Sprintf("Attended the %s meeting on %s", meeting.Section, meeting.HeldOn),
+	}
+	for _, a := range attendance {
+		if a.Status != StatusPresent && a.Status != StatusLate {
+			continue
+		}
+		for _, requirement := range meeting.Requirements {
+			credit.Credits = append(credit.Credits, progress.Credit{
+				MemberId:      a.MemberId,
+				BadgeKey:      requirement.BadgeKey,
+				RequirementId: requirement.RequirementId,
+			})
+		}
+	}
+	return s.crediter.CreditMeeting(ctx, credit)
+}
+
+// DeleteMeeting deletes the meeting of the group with the given ID and its
+// attendance. The credit of members who attended it is withdrawn first.
+func (s MeetingService) DeleteMeeting(ctx context.Context, groupID, id int64) security.ClientError {
+	ctx, span := tracing.Start(ctx, "MeetingService.DeleteMeeting")
+	defer span.End()
+	ctx = db.WithPrimary(ctx)
+
+	meeting, clientErr := s.getMeeting(ctx, groupID, id)
+	if clientErr != nil {
+		return clientErr
+	}
+	meeting.Requirements = nil
+	if err := s.credit(ctx, meeting, 0); err != nil {
+		return err
+	}
+	if err := s.store.DeleteMeeting(ctx, groupID, id); err != nil {
+		span.RecordError(err)
+		return storeError(fmt.Sprintf("failed to delete meeting %d", id), err)
+	}
+	return nil
+}
+
+// MarkAttendance marks the attendance of members at the meeting of the group
+// as recorded by the user with recordedBy. If status isn't empty every active
+// member of the meeting's section whose attendance isn't given is marked with
+// it, so a whole section can be marked at once. Attendance can't be marked
+// before the meeting is held. Members are then credited with the meeting's
+// requirements, or have their credit withdrawn, to match their attendance.
+func (s MeetingService) MarkAttendance(ctx context.Context, groupID, meetingID, recordedBy int64, attendance []Attendance, status string) ([]Attendance, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "MeetingService.MarkAttendance")
+	defer span.End()
+	// Crediting reads back the attendance just marked.
+	ctx = db.WithPrimary(ctx)
+
+	meeting, clientErr := s.getMeeting(ctx, groupID, meetingID)
+	if clientErr != nil {
+		return nil, clientErr
+	}
+	if today := date.Today(s.location); meeting.HeldOn.After(today) {
+		return nil, problem.Invalid("attendance can't be marked before the meeting on %s", meeting.HeldOn)
+	}
+	marked := make(map[int64]bool, len(attendance))
+	for _, a := range attendance {
+		if marked[a.MemberId] {
+			return nil, problem.Invalid("the attendance of member %d is given more than once", a.MemberId)
+		}
+		marked[a.MemberId] = true
+	}
+	if status != "" {
+		members, err := s.store.ActiveMembers(ctx, groupID, meeting.Section)
+		if err != nil {
+			span.RecordError(err)
+			return nil, security.NewClientError(fmt.Sprintf("failed to list members of %s", meeting.Section), err)
+		}
+		for _, id := range members {
+			if !marked[id] {
+				attendance = append(attendance, Attendance{MemberId: id, Status: status})
+			}
+		}
+	}
+	if len(attendance) == 0 {
+		return []Attendance{}, nil
+	}
+	for i := range attendance {
+		attendance[i].MeetingId = meetingID
+		attendance[i].RecordedBy = &recordedBy
+	}
+	saved, err := s.store.MarkAttendance(ctx, groupID, meetingID, attendance)
+	if err != nil {
+		span.RecordError(err)
+		return nil, storeError(fmt.Sprintf("failed to mark attendance at meeting %d", meetingID), err)
+	}
+	for _, a := range saved {
+		attendanceMarked.WithLabelValues(a.Status).Inc()
+	}
+	if err := s.credit(ctx, meeting, recordedBy); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// MemberRate computes how often the member of the group attended meetings
+// between the dates of the filter, which default to the year up to today.
+func (s MeetingService) MemberRate(ctx context.Context, groupID, memberID int64, filter Filter) (Rate, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "MeetingService.MemberRate")
+	defer span.End()
+
+	filter, clientErr := s.dates(Filter{From: filter.From, To: filter.To})
+	if clientErr != nil {
+		return Rate{}, clientErr
+	}
+	rates, err := s.store.ListRates(ctx, groupID, memberID, filter)
+	if err != nil {
+		span.RecordError(err)
+		return Rate{}, security.NewClientError(fmt.Sprintf("failed to count attendance of member %d", memberID), err)
+	} else if len(rates) == 0 {
+		return Rate{}, problem.NewError(problem.CodeNotFound, fmt.Sprintf("member %d does not exist", memberID), ErrNoSuchMember)
+	}
+	return rates[0].computed(), nil
+}
+
+// SectionRates computes how often the active members of the section of the
+// group attended meetings between the dates of the filter, which default to
+// the year up to today.
+func (s MeetingService) SectionRates(ctx context.Context, groupID int64, filter Filter) (SectionRates, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "MeetingService.SectionRates")
+	defer span.End()
+
+	filter, clientErr := s.dates(filter)
+	if clientErr != nil {
+		return SectionRates{}, clientErr
+	}
+	meetings, err := s.store.ListMeetings(ctx, groupID, filter)
+	if err != nil {
+		span.RecordError(err)
+		return SectionRates{}, security.NewClientError(fmt.Sprintf("failed to list meetings of %s", filter.Section), err)
+	}
+	rates, err := s.store.ListRates(ctx, groupID, 0, filter)
+	if err != nil {
+		span.RecordError(err)
+		return SectionRates{}, security.NewClientError(fmt.Sprintf("failed to count attendance of %s", filter.Section), err)
+	}
+	section := SectionRates{Section: filter.Section, From: filter.From, To: filter.To, Meetings: len(meetings), Members: rates}
+	expected, attended := 0, 0
+	for i := range rates {
+		rates[i] = rates[i].computed()
+		expected += rates[i].Meetings
+		attended += rates[i].Present + rates[i].Late
+	}
+	if expected > 0 {
+		section.Rate = float64(attended) / float64(expected)
+	}
+	return section, nil
+}
+
+// computed fills in the fields of the rate computed from the counts.
+func (r Rate) computed() Rate {
+	r.Unmarked = r.Meetings - r.Present - r.Late - r.Absent - r.Apologies
+	if r.Meetings > 0 {
+		r.Rate = float64(r.Present+r.Late) / float64(r.Meetings)
+	}
+	return r
+}
+
+// dates fills in the default dates of the filter and checks they're in
+// order.
+func (s MeetingService) dates(filter Filter) (Filter, security.ClientError) {
+	if filter.To.IsZero() {
+		filter.To = date.Today(s.location)
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.AddDays(-defaultRange)
+	}
+	if filter.To.Before(filter.From) {
+		return Filter{}, problem.Invalid("from %s must not be after to %s", filter.From, filter.To)
+	}
+	return filter, nil
+}
+
+// storeError converts errors from the store to client errors.
+func storeError(message string, err error) security.ClientError {
+	switch {
+	case errors.Is(err, ErrNoSuchMeeting):
+		return problem.NewError(problem.CodeNotFound, "meeting does not exist", err)
+	case errors.Is(err, ErrNoSuchMember):
+		return problem.NewError(problem.CodeValidationFailed, "a member does not exist in the group", err)
+	case errors.Is(err, ErrNoSuchSection):
+		return problem.NewError(problem.CodeValidationFailed, "the group does not have the section", err)
+	}
+	return security.NewClientError(message, err)
+}
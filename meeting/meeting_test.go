@@ -0,0 +1,399 @@
+package meeting
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nick96/cubapi/badge"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/openapi/openapitest"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/progress"
+	"github.com/nick96/cubapi/user"
+	"github.com/nick96/cubapi/user/usertest"
+	"go.uber.org/zap"
+)
+
+// Users requests are made as in tests.
+var (
+	leader      = user.User{Id: 10, GroupId: testGroupID, Roles: []string{user.RoleLeader}}
+	otherLeader = user.User{Id: 20, GroupId: otherGroupID, Roles: []string{user.RoleLeader}}
+)
+
+// Members of the groups: mowgli, akela and the inactive hathi are cubs of the
+// test group, kaa a scout of it and otherCub a cub of the other group.
+const (
+	mowgli   = 1
+	akela    = 2
+	hathi    = 3
+	kaa      = 4
+	otherCub = 5
+)
+
+const cubMeeting = `{"section": "cubs", "heldOn": "2021-03-01", "location": "Hall", "program": "Knots"}`
+
+// newTestStore creates a store with the members of the test and other
+// groups.
+func newTestStore() *mockMeetingStore {
+	store := newMockMeetingStore()
+	store.members[mowgli] = mockMember{testGroupID, group.SectionCubs, false, date.Date{}}
+	store.members[akela] = mockMember{testGroupID, group.SectionCubs, false, date.Date{}}
+	store.members[hathi] = mockMember{testGroupID, group.SectionCubs, true, date.Date{}}
+	store.members[kaa] = mockMember{testGroupID, group.SectionScouts, false, date.Date{}}
+	store.members[otherCub] = mockMember{otherGroupID, group.SectionCubs, false, date.Date{}}
+	return store
+}
+
+// Badge requirements meetings meet in tests.
+var (
+	knots   = RequirementRef{BadgeKey: "outdoors", RequirementId: "knots"}
+	promise = RequirementRef{BadgeKey: "membership", RequirementId: "promise"}
+)
+
+const knotsAndPromise = `{"requirements": [{"badgeKey": "outdoors", "requirementId": "knots"}, {"badgeKey": "membership", "requirementId": "promise"}]}`
+
+// newTestRouter creates a router whose requests are made as the user.
+func newTestRouter(store MeetingStorer, crediter Crediter, u user.User) chi.Router {
+	router := chi.NewRouter()
+	router.Use(usertest.As(u))
+	router.Route("/meeting", NewMeetingRouter(zap.NewNop(), NewMeetingService(store, crediter, time.UTC)))
+	return router
+}
+
+func TestMeetingLifecycle(t *testing.T) {
+	router := newTestRouter(newTestStore(), newMockCrediter(), leader)
+
+	var created Meeting
+	if w := openapitest.Do(t, router, "POST", "/meeting", cubMeeting, &created); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if created.Id == 0 || created.Section != group.SectionCubs || created.HeldOn.String() != "2021-03-01" || created.Program != "Knots" {
+		t.Errorf("Expected the meeting to be created, got %+v", created)
+	}
+
+	var updated Meeting
+	if w := openapitest.Do(t, router, "PUT", "/meeting/1", strings.Replace(cubMeeting, "Knots", "Fire lighting", 1), &updated); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if updated.Program != "Fire lighting" {
+		t.Errorf("Expected the program to be updated, got %+v", updated)
+	}
+
+	var listed []Meeting
+	openapitest.Do(t, router, "GET", "/meeting?from=2021-01-01&to=2021-12-31&section=cubs", "", &listed)
+	if len(listed) != 1 || listed[0].Id != 1 {
+		t.Errorf("Expected the meeting to be listed, got %+v", listed)
+	}
+	openapitest.Do(t, router, "GET", "/meeting?from=2021-03-02&to=2021-12-31", "", &listed)
+	if len(listed) != 0 {
+		t.Errorf("Expected meetings outside the range not to be listed, got %+v", listed)
+	}
+
+	if w := openapitest.Do(t, router, "DELETE", "/meeting/1", "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := openapitest.Do(t, router, "GET", "/meeting/1", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted meeting not to be found, got %d", w.Code)
+	}
+}
+
+func TestMarkSection(t *testing.T) {
+	store := newTestStore()
+	router := newTestRouter(store, newMockCrediter(), leader)
+	openapitest.Do(t, router, "POST", "/meeting", cubMeeting, nil)
+
+	// Every active cub not given is present, and Kaa is visiting.
+	body := `{"status": "present", "attendance": [{"memberId": 2, "status": "apologies"}, {"memberId": 4, "status": "late"}]}`
+	var marked []Attendance
+	if w := openapitest.Do(t, router, "POST", "/meeting/1/attendance", body, &marked); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var detail MeetingDetail
+	openapitest.Do(t, router, "GET", "/meeting/1", "", &detail)
+	want := map[int64]string{mowgli: StatusPresent, akela: StatusApologies, kaa: StatusLate}
+	if len(detail.Attendance) != len(want) {
+		t.Fatalf("Expected the attendance of %d members, got %+v", len(want), detail.Attendance)
+	}
+	for _, a := range detail.Attendance {
+		if a.Status != want[a.MemberId] || a.RecordedBy == nil || *a.RecordedBy != leader.Id {
+			t.Errorf("Expected member %d to be %s by the leader, got %+v", a.MemberId, want[a.MemberId], a)
+		}
+	}
+
+	// Correcting a member replaces their attendance.
+	var corrected Attendance
+	if w := openapitest.Do(t, router, "PUT", "/meeting/1/attendance/2", `{"status": "present"}`, &corrected); w.Code != http.StatusOK || corrected.Status != StatusPresent {
+		t.Errorf("Expected Akela to be corrected to present, got %d: %+v", w.Code, corrected)
+	}
+	openapitest.Do(t, router, "GET", "/meeting/1", "", &detail)
+	if len(detail.Attendance) != 3 {
+		t.Errorf("Expected correcting not to add attendance, got %+v", detail.Attendance)
+	}
+}
+
+func TestInvalidAttendance(t *testing.T) {
+	store := newTestStore()
+	router := newTestRouter(store, newMockCrediter(), leader)
+	openapitest.Do(t, router, "POST", "/meeting", cubMeeting, nil)
+	tomorrow := date.Today(time.UTC).AddDays(1).String()
+	openapitest.Do(t, router, "POST", "/meeting", strings.Replace(cubMeeting, "2021-03-01", tomorrow, 1), nil)
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   problem.Code
+	}{
+		{"unknown-status", "PUT", "/meeting/1/attendance/1", `{"status": "asleep"}`, problem.CodeValidationFailed},
+		{"twice", "POST", "/meeting/1/attendance", `{"attendance": [{"memberId": 1, "status": "present"}, {"memberId": 1, "status": "late"}]}`, problem.CodeValidationFailed},
+		{"missing-member", "PUT", "/meeting/1/attendance/9", `{"status": "present"}`, problem.CodeValidationFailed},
+		{"other-group-member", "POST", "/meeting/1/attendance", `{"attendance": [{"memberId": 1, "status": "present"}, {"memberId": 5, "status": "present"}]}`, problem.CodeValidationFailed},
+		{"not-held-yet", "PUT", "/meeting/2/attendance/1", `{"status": "present"}`, problem.CodeValidationFailed},
+		{"missing-meeting", "PUT", "/meeting/9/attendance/1", `{"status": "present"}`, problem.CodeNotFound},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp problem.Problem
+			if w := openapitest.Do(t, router, tt.method, tt.path, tt.body, &resp); resp.Code != tt.code {
+				t.Errorf("Expected %s, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+		})
+	}
+	if len(store.attendance) != 0 {
+		t.Errorf("Expected invalid requests not to mark attendance, got %+v", store.attendance)
+	}
+}
+
+func TestAttendanceRates(t *testing.T) {
+	store := newTestStore()
+	router := newTestRouter(store, newMockCrediter(), leader)
+	for _, day := range []string{"2021-03-01", "2021-03-08", "2021-03-15", "2021-03-22"} {
+		openapitest.Do(t, router, "POST", "/meeting", strings.Replace(cubMeeting, "2021-03-01", day, 1), nil)
+	}
+	scouts := `{"section": "scouts", "heldOn": "2021-03-02"}`
+	openapitest.Do(t, router, "POST", "/meeting", scouts, nil)
+
+	openapitest.Do(t, router, "POST", "/meeting/1/attendance", `{"status": "present"}`, nil)
+	openapitest.Do(t, router, "POST", "/meeting/2/attendance", `{"status": "absent", "attendance": [{"memberId": 1, "status": "late"}]}`, nil)
+	openapitest.Do(t, router, "POST", "/meeting/3/attendance", `{"attendance": [{"memberId": 1, "status": "apologies"}]}`, nil)
+	// Mowgli visits the scouts.
+	openapitest.Do(t, router, "PUT", "/meeting/5/attendance/1", `{"status": "present"}`, nil)
+
+	var rate Rate
+	if w := openapitest.Do(t, router, "GET", "/meeting/attendance/member/1?from=2021-03-01&to=2021-03-31", "", &rate); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	want := Rate{MemberId: mowgli, Section: group.SectionCubs, Meetings: 5, Present: 2, Late: 1, Apologies: 1, Unmarked: 1, Rate: 0.6}
+	if rate != want {
+		t.Errorf("Expected %+v, got %+v", want, rate)
+	}
+	openapitest.Do(t, router, "GET", "/meeting/attendance/member/1?from=2021-03-08&to=2021-03-14", "", &rate)
+	if rate.Meetings != 1 || rate.Late != 1 || rate.Rate != 1 {
+		t.Errorf("Expected only the meeting in the range to count, got %+v", rate)
+	}
+
+	var section SectionRates
+	if w := openapitest.Do(t, router, "GET", "/meeting/attendance/section/cubs?from=2021-03-01&to=2021-03-31", "", &section); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if section.Meetings != 4 || len(section.Members) != 2 {
+		t.Fatalf("Expected four meetings of the active cubs, got %+v", section)
+	}
+	// Mowgli attended 3 of 5 and Akela 1 of 4.
+	if akelaRate := section.Members[1]; akelaRate.MemberId != akela || akelaRate.Present != 1 || akelaRate.Absent != 1 || akelaRate.Unmarked != 2 {
+		t.Errorf("Expected Akela to be present once and absent once, got %+v", akelaRate)
+	}
+	if section.Rate != 4.0/9.0 {
+		t.Errorf("Expected the section's rate to be 4/9, got %v", section.Rate)
+	}
+
+	var resp problem.Problem
+	if w := openapitest.Do(t, router, "GET", "/meeting/attendance/section/cubs?from=2021-04-01&to=2021-03-01", "", &resp); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a backwards range to be invalid, got %d: %+v", w.Code, resp)
+	}
+	if w := openapitest.Do(t, router, "GET", "/meeting/attendance/section/cubs?from=1/3/2021", "", &resp); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a malformed date to be invalid, got %d: %+v", w.Code, resp)
+	}
+	if w := openapitest.Do(t, router, "GET", "/meeting/attendance/section/wolves", "", &resp); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a missing section not to be found, got %d: %+v", w.Code, resp)
+	}
+}
+
+func TestAttendanceRatesOnlyExpectMeetingsWhileActive(t *testing.T) {
+	store := newTestStore()
+	const bagheera = 6
+	store.members[bagheera] = mockMember{testGroupID, group.SectionCubs, false, date.Of(time.Date(2021, time.March, 10, 0, 0, 0, 0, time.UTC))}
+	router := newTestRouter(store, newMockCrediter(), leader)
+	for _, day := range []string{"2021-03-01", "2021-03-08", "2021-03-15", "2021-03-22"} {
+		openapitest.Do(t, router, "POST", "/meeting", strings.Replace(cubMeeting, "2021-03-01", day, 1), nil)
+	}
+	openapitest.Do(t, router, "PUT", "/meeting/3/attendance/6", `{"status": "present"}`, nil)
+	openapitest.Do(t, router, "PUT", "/meeting/1/attendance/3", `{"status": "present"}`, nil)
+
+	var rate Rate
+	openapitest.Do(t, router, "GET", "/meeting/attendance/member/6?from=2021-03-01&to=2021-03-31", "", &rate)
+	if rate.Meetings != 2 || rate.Present != 1 || rate.Unmarked != 1 || rate.Rate != 0.5 {
+		t.Errorf("Expected Bagheera only to be expected at meetings after joining, got %+v", rate)
+	}
+	// Hathi is inactive so is only expected where their attendance was marked.
+	openapitest.Do(t, router, "GET", "/meeting/attendance/member/3?from=2021-03-01&to=2021-03-31", "", &rate)
+	if rate.Meetings != 1 || rate.Present != 1 || rate.Rate != 1 {
+		t.Errorf("Expected an inactive member only to be expected where marked, got %+v", rate)
+	}
+}
+
+func TestMeetingsAreScopedToGroup(t *testing.T) {
+	store := newTestStore()
+	crediter := newMockCrediter(knots)
+	router, other := newTestRouter(store, crediter, leader), newTestRouter(store, crediter, otherLeader)
+	openapitest.Do(t, router, "POST", "/meeting", cubMeeting, nil)
+	openapitest.Do(t, router, "PUT", "/meeting/1/requirements", `{"requirements": [{"badgeKey": "outdoors", "requirementId": "knots"}]}`, nil)
+	openapitest.Do(t, router, "POST", "/meeting/1/attendance", `{"status": "present"}`, nil)
+
+	var listed []Meeting
+	openapitest.Do(t, other, "GET", "/meeting?from=2021-01-01", "", &listed)
+	if len(listed) != 0 {
+		t.Errorf("Expected another group not to list the meeting, got %+v", listed)
+	}
+	for _, tt := range []struct{ method, path, body string }{
+		{"GET", "/meeting/1", ""},
+		{"PUT", "/meeting/1", cubMeeting},
+		{"DELETE", "/meeting/1", ""},
+		{"PUT", "/meeting/1/requirements", `{"requirements": []}`},
+		{"POST", "/meeting/1/attendance", `{"status": "absent"}`},
+		{"PUT", "/meeting/1/attendance/5", `{"status": "absent"}`},
+		{"GET", "/meeting/attendance/member/1", ""},
+	} {
+		if w := openapitest.Do(t, other, tt.method, tt.path, tt.body, nil); w.Code != http.StatusNotFound {
+			t.Errorf("Expected %s %s from another group not to be found, got %d: %s", tt.method, tt.path, w.Code, w.Body.String())
+		}
+	}
+
+	var section SectionRates
+	openapitest.Do(t, other, "GET", "/meeting/attendance/section/cubs?from=2021-01-01", "", &section)
+	if section.Meetings != 0 || len(section.Members) != 1 || section.Members[0].MemberId != otherCub || section.Members[0].Meetings != 0 {
+		t.Errorf("Expected only the other group's cub without meetings, got %+v", section)
+	}
+	var detail MeetingDetail
+	openapitest.Do(t, router, "GET", "/meeting/1", "", &detail)
+	if len(detail.Attendance) != 2 || detail.Attendance[0].Status != StatusPresent {
+		t.Errorf("Expected the attendance to be unchanged by another group, got %+v", detail.Attendance)
+	}
+	if credit := crediter.credits[1]; len(credit.Credits) != 2 || credit.GroupId != testGroupID {
+		t.Errorf("Expected the credit to be unchanged by another group, got %+v", credit)
+	}
+}
+
+func TestMeetingCredits(t *testing.T) {
+	store := newTestStore()
+	crediter := newMockCrediter(knots, promise)
+	router := newTestRouter(store, crediter, leader)
+	openapitest.Do(t, router, "POST", "/meeting", cubMeeting, nil)
+	openapitest.Do(t, router, "POST", "/meeting/1/attendance", `{"attendance": [{"memberId": 1, "status": "present"}, {"memberId": 2, "status": "absent"}]}`, nil)
+	if len(crediter.credits) != 0 {
+		t.Fatalf("Expected a meeting without requirements not to credit anyone, got %+v", crediter.credits)
+	}
+
+	// Setting the requirements retroactively credits those who attended.
+	var meeting Meeting
+	if w := openapitest.Do(t, router, "PUT", "/meeting/1/requirements", knotsAndPromise, &meeting); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(meeting.Requirements) != 2 || meeting.Requirements[0] != knots || meeting.Requirements[1] != promise {
+		t.Errorf("Expected the meeting to meet knots and the promise, got %+v", meeting.Requirements)
+	}
+	credit := crediter.credits[1]
+	want := []progress.Credit{{MemberId: mowgli, BadgeKey: "outdoors", RequirementId: "knots"}, {MemberId: mowgli, BadgeKey: "membership", RequirementId: "promise"}}
+	if !reflect.DeepEqual(credit.Credits, want) {
+		t.Errorf("Expected Mowgli to be credited with both requirements, got %+v", credit.Credits)
+	}
+	if credit.GroupId != testGroupID || credit.RecordedBy != leader.Id || credit.HeldOn.String() != "2021-03-01" || credit.Notes == "" {
+		t.Errorf("Expected the credit to be recorded by the leader on the day of the meeting, got %+v", credit)
+	}
+
+	// Correcting attendance moves the credit.
+	openapitest.Do(t, router, "PUT", "/meeting/1/attendance/1", `{"status": "absent"}`, nil)
+	openapitest.Do(t, router, "PUT", "/meeting/1/attendance/2", `{"status": "late"}`, nil)
+	want = []progress.Credit{{MemberId: akela, BadgeKey: "outdoors", RequirementId: "knots"}, {MemberId: akela, BadgeKey: "membership", RequirementId: "promise"}}
+	if credit := crediter.credits[1]; !reflect.DeepEqual(credit.Credits, want) {
+		t.Errorf("Expected only Akela to be credited, got %+v", credit.Credits)
+	}
+
+	// Editing the requirements withdraws what the meeting no longer meets.
+	openapitest.Do(t, router, "PUT", "/meeting/1/requirements", `{"requirements": [{"badgeKey": "membership", "requirementId": "promise"}]}`, nil)
+	want = []progress.Credit{{MemberId: akela, BadgeKey: "membership", RequirementId: "promise"}}
+	if credit := crediter.credits[1]; !reflect.DeepEqual(credit.Credits, want) {
+		t.Errorf("Expected Akela to only be credited with the promise, got %+v", credit.Credits)
+	}
+
+	// Replacing the details of the meeting keeps its requirements.
+	openapitest.Do(t, router, "PUT", "/meeting/1", cubMeeting, &meeting)
+	if len(meeting.Requirements) != 1 || meeting.Requirements[0] != promise {
+		t.Errorf("Expected updating the meeting to keep its requirements, got %+v", meeting.Requirements)
+	}
+
+	if w := openapitest.Do(t, router, "DELETE", "/meeting/1", "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if len(crediter.credits) != 0 {
+		t.Errorf("Expected deleting the meeting to withdraw its credit, got %+v", crediter.credits)
+	}
+}
+
+func TestRequirementsMustBeLeaves(t *testing.T) {
+	store := newTestStore()
+	crediter := newCatalogueCrediter(badge.Badge{Id: 1, Key: "outdoors", Version: 1, Requirements: badge.Requirements{
+		{Id: "knots", Description: "Tie 2 of the following", Choose: 2, Requirements: []badge.Requirement{
+			{Id: "reef", Description: "Tie a reef knot"},
+			{Id: "sheet-bend", Description: "Tie a sheet bend"},
+			{Id: "clove-hitch", Description: "Tie a clove hitch"},
+		}},
+	}})
+	router := newTestRouter(store, crediter, leader)
+	openapitest.Do(t, router, "POST", "/meeting", cubMeeting, nil)
+
+	var resp problem.Problem
+	if w := openapitest.Do(t, router, "PUT", "/meeting/1/requirements", `{"requirements": [{"badgeKey": "outdoors", "requirementId": "knots"}]}`, &resp); resp.Code != problem.CodeValidationFailed {
+		t.Errorf("Expected mapping the meeting to a requirement made up of others to fail with %s, got %d: %s", problem.CodeValidationFailed, w.Code, w.Body.String())
+	}
+	if w := openapitest.Do(t, router, "PUT", "/meeting/1/requirements", `{"requirements": [{"badgeKey": "outdoors", "requirementId": "reef"}]}`, nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected mapping the meeting to one of its requirements to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if requirements := store.meetings[1].Requirements; len(requirements) != 1 || requirements[0].RequirementId != "reef" {
+		t.Errorf("Expected the meeting to be mapped to the reef knot, got %+v", requirements)
+	}
+}
+
+func TestInvalidRequirements(t *testing.T) {
+	store := newTestStore()
+	crediter := newMockCrediter(knots)
+	router := newTestRouter(store, crediter, leader)
+	openapitest.Do(t, router, "POST", "/meeting", cubMeeting, nil)
+	openapitest.Do(t, router, "PUT", "/meeting/1/requirements", `{"requirements": [{"badgeKey": "outdoors", "requirementId": "knots"}]}`, nil)
+
+	testCases := []struct {
+		name string
+		body string
+	}{
+		{"unknown", knotsAndPromise},
+		{"twice", `{"requirements": [{"badgeKey": "outdoors", "requirementId": "knots"}, {"badgeKey": "outdoors", "requirementId": "knots"}]}`},
+		{"missing-key", `{"requirements": [{"requirementId": "knots"}]}`},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp problem.Problem
+			if w := openapitest.Do(t, router, "PUT", "/meeting/1/requirements", tt.body, &resp); resp.Code != problem.CodeValidationFailed {
+				t.Errorf("Expected %s, got %d: %s", problem.CodeValidationFailed, w.Code, w.Body.String())
+			}
+		})
+	}
+	if requirements := store.meetings[1].Requirements; len(requirements) != 1 || requirements[0] != knots {
+		t.Errorf("Expected invalid requests not to change the requirements, got %+v", requirements)
+	}
+}
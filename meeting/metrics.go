@@ -0,0 +1,11 @@
+package meeting
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var attendanceMarked = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "autocrat_meeting_attendance_marked_total",
+	Help: "Number of times a member's attendance at a meeting was marked.",
+}, []string{"status"})
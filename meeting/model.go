@@ -0,0 +1,139 @@
+package meeting
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nick96/cubapi/date"
+)
+
+// Statuses of a member's attendance at a meeting.
+const (
+	StatusPresent = "present"
+	StatusAbsent  = "absent"
+	// StatusApologies members were absent but said they would be
+	// beforehand.
+	StatusApologies = "apologies"
+	// StatusLate members were present but arrived late.
+	StatusLate = "late"
+)
+
+// Statuses are the statuses attendance can have.
+var Statuses = []string{StatusPresent, StatusAbsent, StatusApologies, StatusLate}
+
+// Meeting is a meeting of a section of a group.
+type Meeting struct {
+	Id int64 `json:"id" db:"id"`
+	// GroupId is the ID of the group of the meeting. It's implied by the
+	// caller's group so it isn't exposed.
+	GroupId int64 `json:"-" db:"group_id"`
+	// Section is the kind of section of the group that meets, one of
+	// group.Sections.
+	Section  string    `json:"section" db:"section"`
+	HeldOn   date.Date `json:"heldOn" db:"held_on"`
+	Location string    `json:"location" db:"location"`
+	// Program is what the section does at the meeting.
+	Program string `json:"program" db:"program"`
+	// Requirements are the badge requirements doing the program meets.
+	// Members who attend are credited with them.
+	Requirements Requirements `json:"requirements" db:"requirements"`
+	CreatedAt    time.Time    `json:"createdAt" db:"created_at"`
+	UpdatedAt    time.Time    `json:"updatedAt" db:"updated_at"`
+}
+
+// RequirementRef refers to a requirement of a badge. Members are credited
+// with the requirement with the ID in the version of the badge they work
+// towards.
+type RequirementRef struct {
+	BadgeKey      string `json:"badgeKey" validate:"required,max=64"`
+	RequirementId string `json:"requirementId" validate:"required,max=64"`
+}
+
+// Requirements are the requirements a meeting meets. They are stored as a
+// JSONB column.
+type Requirements []RequirementRef
+
+// Scan scans a JSONB column.
+func (r *Requirements) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		*r = Requirements{}
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into requirements", src)
+	}
+	return json.Unmarshal(data, r)
+}
+
+// Value stores the requirements in a JSONB column.
+func (r Requirements) Value() (driver.Value, error) {
+	if r == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Attendance is whether a member attended a meeting. Members of other
+// sections can attend too, e.g. when visiting before moving up.
+type Attendance struct {
+	MeetingId int64  `json:"meetingId" db:"meeting_id"`
+	MemberId  int64  `json:"memberId" db:"member_id"`
+	Status    string `json:"status" db:"status"`
+	// RecordedBy is the ID of the user who last marked the attendance, if
+	// they still exist.
+	RecordedBy *int64    `json:"recordedBy" db:"recorded_by"`
+	RecordedAt time.Time `json:"recordedAt" db:"recorded_at"`
+}
+
+// MeetingDetail is a meeting with its attendance.
+type MeetingDetail struct {
+	Meeting
+	Attendance []Attendance `json:"attendance"`
+}
+
+// Rate is how often a member attended meetings between two dates. A member
+// is expected at the meetings of their section and at any meeting their
+// attendance is marked for.
+type Rate struct {
+	MemberId  int64  `json:"memberId" db:"member_id"`
+	FirstName string `json:"firstName" db:"firstname"`
+	LastName  string `json:"lastName" db:"lastname"`
+	Section   string `json:"section" db:"section"`
+	// Meetings is how many meetings the member was expected at.
+	Meetings  int `json:"meetings" db:"meetings"`
+	Present   int `json:"present" db:"present"`
+	Late      int `json:"late" db:"late"`
+	Absent    int `json:"absent" db:"absent"`
+	Apologies int `json:"apologies" db:"apologies"`
+	// Unmarked is how many meetings the member's attendance wasn't marked
+	// at.
+	Unmarked int `json:"unmarked" db:"-"`
+	// Rate is the fraction of the meetings the member was present or late
+	// at, zero if there weren't any.
+	Rate float64 `json:"rate" db:"-"`
+}
+
+// SectionRates is how often the members of a section attended meetings
+// between two dates.
+type SectionRates struct {
+	Section string    `json:"section"`
+	From    date.Date `json:"from"`
+	To      date.Date `json:"to"`
+	// Meetings is how many meetings the section held.
+	Meetings int `json:"meetings"`
+	// Rate is the fraction of the meetings members were expected at that
+	// they were present or late at.
+	Rate    float64 `json:"rate"`
+	Members []Rate  `json:"members"`
+}
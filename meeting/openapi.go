@@ -0,0 +1,159 @@
+package meeting
+
+import (
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/user"
+)
+
+// DescribeMeetingRouter describes the operations of NewMeetingRouter.
+func DescribeMeetingRouter(r *openapi.Router) {
+	meetingID := openapi.PathParam("meetingID", "The ID of the meeting.", openapi.Integer())
+	memberID := openapi.PathParam("memberID", "The ID of the member.", openapi.Integer())
+	section := openapi.PathParam("section", "The kind of section.", openapi.Enum(group.Sections))
+	day := &openapi.Schema{Type: "string", Format: "date"}
+	from := openapi.Parameter{Name: "from", In: "query", Description: "The first date of the range, a year before the last by default.", Schema: day}
+	to := openapi.Parameter{Name: "to", In: "query", Description: "The last date of the range, today by default.", Schema: day}
+	denied := map[string]*openapi.Response{
+		"403": r.Problem("The request isn't authenticated, the user isn't a leader or admin, or the CSRF token is missing."),
+		"429": r.Problem("The client has made too many requests."),
+		"500": r.Problem("The request couldn't be completed."),
+	}
+	responses := func(responses map[string]*openapi.Response) map[string]*openapi.Response {
+		for status, response := range denied {
+			responses[status] = response
+		}
+		return responses
+	}
+
+	r.Get("/", &openapi.Operation{
+		OperationID: "listMeetings",
+		Summary:     "List meetings",
+		Tags:        []string{"meeting"},
+		Security:    user.Authenticated,
+		Parameters: []openapi.Parameter{
+			{Name: "section", In: "query", Description: "Only list meetings of the section.", Schema: openapi.Enum(group.Sections)},
+			from, to,
+		},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The meetings held in the range, oldest first.", []Meeting{}),
+			"400": r.Problem("The range of dates is invalid."),
+		}),
+	})
+	r.Post("/", &openapi.Operation{
+		OperationID: "createMeeting",
+		Summary:     "Add a meeting",
+		Tags:        []string{"meeting"},
+		Security:    user.Authenticated,
+		RequestBody: r.JSONBody(MeetingRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"201": r.JSON("The added meeting.", MeetingResponse{}),
+			"400": r.Problem("The request body is invalid or the group doesn't have the section."),
+		}),
+	})
+	r.Get("/{meetingID}", &openapi.Operation{
+		OperationID: "getMeeting",
+		Summary:     "Get a meeting",
+		Description: "The meeting with the attendance marked at it.",
+		Tags:        []string{"meeting"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{meetingID},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The meeting.", MeetingDetailResponse{}),
+			"404": r.Problem("The meeting doesn't exist in the group."),
+		}),
+	})
+	r.Put("/{meetingID}", &openapi.Operation{
+		OperationID: "updateMeeting",
+		Summary:     "Replace the details of a meeting",
+		Description: "The requirements the meeting meets and the attendance already marked are kept.",
+		Tags:        []string{"meeting"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{meetingID},
+		RequestBody: r.JSONBody(MeetingRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The updated meeting.", MeetingResponse{}),
+			"400": r.Problem("The request body is invalid or the group doesn't have the section."),
+			"404": r.Problem("The meeting doesn't exist in the group."),
+		}),
+	})
+	r.Delete("/{meetingID}", &openapi.Operation{
+		OperationID: "deleteMeeting",
+		Summary:     "Delete a meeting",
+		Description: "The attendance marked at the meeting is deleted too. Pending completions members were credited with for attending it are withdrawn.",
+		Tags:        []string{"meeting"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{meetingID},
+		Responses: responses(map[string]*openapi.Response{
+			"204": openapi.Empty("The meeting has been deleted."),
+			"404": r.Problem("The meeting doesn't exist in the group."),
+		}),
+	})
+	r.Put("/{meetingID}/requirements", &openapi.Operation{
+		OperationID: "setMeetingRequirements",
+		Summary:     "Replace the badge requirements a meeting meets",
+		Description: "Members marked present or late are credited with a pending completion of each requirement for a leader to sign off. Pending completions of requirements the meeting no longer meets, or of members no longer marked as attending, are withdrawn. Marking attendance credits members the same way.",
+		Tags:        []string{"meeting"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{meetingID},
+		RequestBody: r.JSONBody(RequirementsRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The updated meeting.", MeetingResponse{}),
+			"400": r.Problem("The request body is invalid, a requirement is given twice, or a badge or requirement doesn't exist or is retired."),
+			"404": r.Problem("The meeting doesn't exist in the group."),
+		}),
+	})
+	r.Post("/{meetingID}/attendance", &openapi.Operation{
+		OperationID: "markAttendance",
+		Summary:     "Mark the attendance of many members",
+		Description: "If a status is given every active member of the meeting's section whose attendance isn't given is marked with it. Either every member's attendance is marked or none is. Members are credited with, or have withdrawn, pending completions of the requirements the meeting meets to match their attendance.",
+		Tags:        []string{"meeting"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{meetingID},
+		RequestBody: r.JSONBody(BulkMarkRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The attendance marked.", []Attendance{}),
+			"400": r.Problem("The request body is invalid, a member is given twice or doesn't exist in the group, or the meeting hasn't been held yet."),
+			"404": r.Problem("The meeting doesn't exist in the group."),
+		}),
+	})
+	r.Put("/{meetingID}/attendance/{memberID}", &openapi.Operation{
+		OperationID: "markMemberAttendance",
+		Summary:     "Mark the attendance of a member",
+		Tags:        []string{"meeting"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{meetingID, memberID},
+		RequestBody: r.JSONBody(MarkRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The attendance marked.", AttendanceResponse{}),
+			"400": r.Problem("The request body is invalid, the member doesn't exist in the group, or the meeting hasn't been held yet."),
+			"404": r.Problem("The meeting doesn't exist in the group."),
+		}),
+	})
+	r.Get("/attendance/member/{memberID}", &openapi.Operation{
+		OperationID: "getMemberAttendance",
+		Summary:     "Get how often a member attended meetings",
+		Description: "A member is expected at the meetings of their section and any meeting their attendance was marked at.",
+		Tags:        []string{"meeting"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{memberID, from, to},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The member's attendance.", RateResponse{}),
+			"400": r.Problem("The range of dates is invalid."),
+			"404": r.Problem("The member doesn't exist in the group."),
+		}),
+	})
+	r.Get("/attendance/section/{section}", &openapi.Operation{
+		OperationID: "getSectionAttendance",
+		Summary:     "Get how often the members of a section attended meetings",
+		Description: "The attendance of each active member of the section and of the section as a whole.",
+		Tags:        []string{"meeting"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{section, from, to},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The section's attendance with its members ordered by name.", SectionRatesResponse{}),
+			"400": r.Problem("The range of dates is invalid."),
+			"404": r.Problem("The section doesn't exist."),
+		}),
+	})
+}
@@ -0,0 +1,46 @@
+package meeting
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/openapi/openapitest"
+)
+
+// TestOpenAPIContract checks that the handlers behave as the OpenAPI document
+// says they do. If this fails either the handlers or DescribeMeetingRouter
+// need updating.
+func TestOpenAPIContract(t *testing.T) {
+	router := newTestRouter(newTestStore(), newMockCrediter(knots), leader)
+
+	doc := openapi.New("autocrat", "test")
+	doc.Route("/meeting", DescribeMeetingRouter)
+	if err := doc.CheckRoutes(router); err != nil {
+		t.Fatal(err)
+	}
+
+	openapitest.Run(t, doc, router, []openapitest.Case{
+		{Name: "create", Method: "POST", Pattern: "/meeting", Body: cubMeeting, Status: http.StatusCreated},
+		{Name: "create-invalid", Method: "POST", Pattern: "/meeting", Body: `{"section": "wolves"}`, Invalid: true, Status: http.StatusBadRequest},
+		{Name: "list", Method: "GET", Pattern: "/meeting", Path: "/meeting?section=cubs&from=2021-01-01", Status: http.StatusOK},
+		{Name: "list-invalid", Method: "GET", Pattern: "/meeting", Path: "/meeting?from=2021-01-01&to=2020-01-01", Status: http.StatusBadRequest},
+		{Name: "get", Method: "GET", Pattern: "/meeting/{meetingID}", Path: "/meeting/1", Status: http.StatusOK},
+		{Name: "get-missing", Method: "GET", Pattern: "/meeting/{meetingID}", Path: "/meeting/9", Status: http.StatusNotFound},
+		{Name: "update", Method: "PUT", Pattern: "/meeting/{meetingID}", Path: "/meeting/1", Body: cubMeeting, Status: http.StatusOK},
+		{Name: "update-missing", Method: "PUT", Pattern: "/meeting/{meetingID}", Path: "/meeting/9", Body: cubMeeting, Status: http.StatusNotFound},
+		{Name: "requirements", Method: "PUT", Pattern: "/meeting/{meetingID}/requirements", Path: "/meeting/1/requirements", Body: `{"requirements": [{"badgeKey": "outdoors", "requirementId": "knots"}]}`, Status: http.StatusOK},
+		{Name: "requirements-unknown", Method: "PUT", Pattern: "/meeting/{meetingID}/requirements", Path: "/meeting/1/requirements", Body: `{"requirements": [{"badgeKey": "outdoors", "requirementId": "fire"}]}`, Status: http.StatusBadRequest},
+		{Name: "requirements-missing", Method: "PUT", Pattern: "/meeting/{meetingID}/requirements", Path: "/meeting/9/requirements", Body: `{"requirements": []}`, Status: http.StatusNotFound},
+		{Name: "mark", Method: "POST", Pattern: "/meeting/{meetingID}/attendance", Path: "/meeting/1/attendance", Body: `{"status": "present", "attendance": [{"memberId": 2, "status": "absent"}]}`, Status: http.StatusOK},
+		{Name: "mark-missing-member", Method: "POST", Pattern: "/meeting/{meetingID}/attendance", Path: "/meeting/1/attendance", Body: `{"attendance": [{"memberId": 9, "status": "absent"}]}`, Status: http.StatusBadRequest},
+		{Name: "mark-member", Method: "PUT", Pattern: "/meeting/{meetingID}/attendance/{memberID}", Path: "/meeting/1/attendance/2", Body: `{"status": "late"}`, Status: http.StatusOK},
+		{Name: "mark-member-missing-meeting", Method: "PUT", Pattern: "/meeting/{meetingID}/attendance/{memberID}", Path: "/meeting/9/attendance/2", Body: `{"status": "late"}`, Status: http.StatusNotFound},
+		{Name: "member-rate", Method: "GET", Pattern: "/meeting/attendance/member/{memberID}", Path: "/meeting/attendance/member/1?from=2021-01-01", Status: http.StatusOK},
+		{Name: "member-rate-missing", Method: "GET", Pattern: "/meeting/attendance/member/{memberID}", Path: "/meeting/attendance/member/9", Status: http.StatusNotFound},
+		{Name: "section-rates", Method: "GET", Pattern: "/meeting/attendance/section/{section}", Path: "/meeting/attendance/section/cubs?from=2021-01-01", Status: http.StatusOK},
+		{Name: "section-rates-missing", Method: "GET", Pattern: "/meeting/attendance/section/{section}", Path: "/meeting/attendance/section/wolves", Status: http.StatusNotFound},
+		{Name: "delete", Method: "DELETE", Pattern: "/meeting/{meetingID}", Path: "/meeting/1", Status: http.StatusNoContent},
+		{Name: "delete-missing", Method: "DELETE", Pattern: "/meeting/{meetingID}", Path: "/meeting/1", Status: http.StatusNotFound},
+	})
+}
@@ -0,0 +1,296 @@
+package meeting
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/db"
+)
+
+var (
+	// ErrNoSuchMeeting is returned when a meeting doesn't exist.
+	ErrNoSuchMeeting = errors.New("meeting does not exist")
+	// ErrNoSuchMember is returned when marking the attendance of a member
+	// who doesn't exist in the meeting's group.
+	ErrNoSuchMember = errors.New("member does not exist")
+	// ErrNoSuchSection is returned when a section meets that the group
+	// doesn't have.
+	ErrNoSuchSection = errors.New("section does not exist")
+)
+
+// foreignKeyViolation is the Postgres error code of foreign key violations,
+// see https://www.postgresql.org/docs/current/errcodes-appendix.html.
+const foreignKeyViolation = "23503"
+
+// Filter restricts the meetings listed and the attendance rates computed.
+// Empty fields match every meeting.
+type Filter struct {
+	Section string
+	From    date.Date
+	To      date.Date
+}
+
+// MeetingStorer is an interface that must be implemented by things that store
+// meetings and attendance. Everything is scoped to a group.
+type MeetingStorer interface {
+	GetMeeting(ctx context.Context, groupID, id int64) (Meeting, bool, error)
+	ListMeetings(ctx context.Context, groupID int64, filter Filter) ([]Meeting, error)
+	AddMeeting(ctx context.Context, meeting Meeting) (Meeting, error)
+	// UpdateMeeting replaces the details of the meeting except its
+	// requirements.
+	UpdateMeeting(ctx context.Context, meeting Meeting) (Meeting, error)
+	SetRequirements(ctx context.Context, groupID, id int64, requirements Requirements) (Meeting, error)
+	DeleteMeeting(ctx context.Context, groupID, id int64) error
+	// ActiveMembers lists the IDs of the active members of the section of
+	// the group.
+	ActiveMembers(ctx context.Context, groupID int64, section string) ([]int64, error)
+	ListAttendance(ctx context.Context, groupID, meetingID int64) ([]Attendance, error)
+	// MarkAttendance marks the attendance of members at the meeting of the
+	// group, replacing what was marked before. Either every member's
+	// attendance is marked or, if any of them aren't in the group, none
+	// are.
+	MarkAttendance(ctx context.Context, groupID, meetingID int64, attendance []Attendance) ([]Attendance, error)
+	// ListRates counts the attendance of members of the group at meetings
+	// between the dates of the filter. Only active members of its section
+	// are counted if the filter has one; memberID restricts it to the
+	// member if it isn't zero.
+	ListRates(ctx context.Context, groupID, memberID int64, filter Filter) ([]Rate, error)
+}
+
+// MeetingStore is a store for meetings and attendance. It implements the
+// MeetingStorer interface.
+type MeetingStore struct {
+	cluster *db.Cluster
+}
+
+// NewStore creates a new store from the given cluster. Reads go to a replica
+// unless the primary is forced with db.WithPrimary.
+func NewStore(cluster *db.Cluster) MeetingStorer {
+	return MeetingStore{cluster}
+}
+
+// GetMeeting gets the meeting of the group with the given ID.
+func (s MeetingStore) GetMeeting(ctx context.Context, groupID, id int64) (meeting Meeting, found bool, err error) {
+	query := `SELECT * FROM autocrat.meetings WHERE group_id = $1 AND id = $2;`
+	err = s.cluster.Reader(ctx).Named("meeting.get_meeting").QueryRowx(ctx, query, groupID, id).StructScan(&meeting)
+	if err == sql.ErrNoRows {
+		return Meeting{}, false, nil
+	} else if err != nil {
+		return Meeting{}, false, fmt.Errorf("could not get meeting %d: %w", id, err)
+	}
+	return meeting, true, nil
+}
+
+// ListMeetings lists the meetings of the group matching the filter, oldest
+// first.
+func (s MeetingStore) ListMeetings(ctx context.Context, groupID int64, filter Filter) ([]Meeting, error) {
+	meetings := []Meeting{}
+	query := `
+	SELECT * FROM autocrat.meetings
+	WHERE group_id = $1 AND ($2 = '' OR section = $2) AND held_on >= $3 AND held_on <= $4
+	ORDER BY held_on, section, id;
+	`
+	err := s.cluster.Reader(ctx).Named("meeting.list_meetings").Select(ctx, &meetings, query, groupID, filter.Section, filter.From, filter.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list meetings: %w", err)
+	}
+	return meetings, nil
+}
+
+// AddMeeting adds the meeting and returns it as it was stored.
+func (s MeetingStore) AddMeeting(ctx context.Context, meeting Meeting) (Meeting, error) {
+	var added Meeting
+	query := `
+	INSERT INTO autocrat.meetings (group_id, section, held_on, location, program, requirements)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING *;
+	`
+	err := s.cluster.Primary().Named("meeting.add_meeting").
+		QueryRowx(ctx, query, meeting.GroupId, meeting.Section, meeting.HeldOn, meeting.Location, meeting.Program, meeting.Requirements).
+		StructScan(&added)
+	if err != nil {
+		return Meeting{}, fmt.Errorf("failed to insert meeting into store: %w", constraintError(err))
+	}
+	return added, nil
+}
+
+// UpdateMeeting replaces the details of the meeting of the group with the
+// meeting's ID, except its requirements, and returns it as it was stored.
+func (s MeetingStore) UpdateMeeting(ctx context.Context, meeting Meeting) (Meeting, error) {
+	var updated Meeting
+	query := `
+	UPDATE autocrat.meetings
+	SET section = $3, held_on = $4, location = $5, program = $6, updated_at = now()
+	WHERE group_id = $1 AND id = $2
+	RETURNING *;
+	`
+	err := s.cluster.Primary().Named("meeting.update_meeting").
+		QueryRowx(ctx, query, meeting.GroupId, meeting.Id, meeting.Section, meeting.HeldOn, meeting.Location, meeting.Program).
+		StructScan(&updated)
+	if err == sql.ErrNoRows {
+		return Meeting{}, fmt.Errorf("failed to update meeting %d: %w", meeting.Id, ErrNoSuchMeeting)
+	} else if err != nil {
+		return Meeting{}, fmt.Errorf("failed to update meeting %d: %w", meeting.Id, constraintError(err))
+	}
+	return updated, nil
+}
+
+// SetRequirements replaces the requirements of the meeting of the group and
+// returns it as it was stored.
+func (s MeetingStore) SetRequirements(ctx context.Context, groupID, id int64, requirements Requirements) (Meeting, error) {
+	var updated Meeting
+	query := `
+	UPDATE autocrat.meetings SET requirements = $3, updated_at = now()
+	WHERE group_id = $1 AND id = $2
+	RETURNING *;
+	`
+	err := s.cluster.Primary().Named("meeting.set_requirements").QueryRowx(ctx, query, groupID, id, requirements).StructScan(&updated)
+	if err == sql.ErrNoRows {
+		return Meeting{}, fmt.Errorf("failed to set requirements of meeting %d: %w", id, ErrNoSuchMeeting)
+	} else if err != nil {
+		return Meeting{}, fmt.Errorf("failed to set requirements of meeting %d: %w", id, err)
+	}
+	return updated, nil
+}
+
+// DeleteMeeting deletes the meeting of the group with the given ID and its
+// attendance.
+func (s MeetingStore) DeleteMeeting(ctx context.Context, groupID, id int64) error {
+	query := `DELETE FROM autocrat.meetings WHERE group_id = $1 AND id = $2;`
+	result, err := s.cluster.Primary().Named("meeting.delete_meeting").Exec(ctx, query, groupID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete meeting %d: %w", id, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete meeting %d: %w", id, err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("failed to delete meeting %d: %w", id, ErrNoSuchMeeting)
+	}
+	return nil
+}
+
+// ActiveMembers lists the IDs of the active members of the section of the
+// group.
+func (s MeetingStore) ActiveMembers(ctx context.Context, groupID int64, section string) ([]int64, error) {
+	ids := []int64{}
+	query := `SELECT id FROM autocrat.members WHERE group_id = $1 AND section = $2 AND status = 'active' ORDER BY id;`
+	if err := s.cluster.Reader(ctx).Named("meeting.active_members").Select(ctx, &ids, query, groupID, section); err != nil {
+		return nil, fmt.Errorf("failed to list members of %s: %w", section, err)
+	}
+	return ids, nil
+}
+
+// ListAttendance lists the attendance marked at the meeting of the group.
+func (s MeetingStore) ListAttendance(ctx context.Context, groupID, meetingID int64) ([]Attendance, error) {
+	attendance := []Attendance{}
+	query := `
+	SELECT a.*
+	FROM autocrat.attendance a JOIN autocrat.meetings mt ON mt.id = a.meeting_id
+	WHERE mt.group_id = $1 AND a.meeting_id = $2
+	ORDER BY a.member_id;
+	`
+	if err := s.cluster.Reader(ctx).Named("meeting.list_attendance").Select(ctx, &attendance, query, groupID, meetingID); err != nil {
+		return nil, fmt.Errorf("failed to list attendance of meeting %d: %w", meetingID, err)
+	}
+	return attendance, nil
+}
+
+// MarkAttendance marks the attendance of members at the meeting of the group.
+// Nothing is marked unless every member is in the group, which is checked in
+// the same statement so a member moving between groups can't slip through.
+// The members must be distinct.
+func (s MeetingStore) MarkAttendance(ctx context.Context, groupID, meetingID int64, attendance []Attendance) ([]Attendance, error) {
+	memberIDs := make([]int64, 0, len(attendance))
+	statuses := make([]string, 0, len(attendance))
+	var recordedBy *int64
+	for _, a := range attendance {
+		memberIDs = append(memberIDs, a.MemberId)
+		statuses = append(statuses, a.Status)
+		recordedBy = a.RecordedBy
+	}
+	marked := []Attendance{}
+	query := `
+	WITH marks AS (
+		SELECT * FROM unnest($3::INTEGER[], $4::TEXT[]) AS t(member_id, status)
+	), valid AS (
+		SELECT count(*) = cardinality($3::INTEGER[]) AS ok
+		FROM marks JOIN autocrat.members m ON m.id = marks.member_id
+		WHERE m.group_id = $1::INTEGER
+	)
+	INSERT INTO autocrat.attendance (meeting_id, member_id, status, recorded_by)
+	SELECT mt.id, marks.member_id, marks.status, $5::INTEGER
+	FROM marks, valid, autocrat.meetings mt
+	WHERE mt.group_id = $1::INTEGER AND mt.id = $2::INTEGER AND valid.ok
+	ON CONFLICT (meeting_id, member_id) DO UPDATE
+	SET status = EXCLUDED.status, recorded_by = EXCLUDED.recorded_by, recorded_at = now()
+	RETURNING *;
+	`
+	err := s.cluster.Primary().Named("meeting.mark_attendance").
+		Select(ctx, &marked, query, groupID, meetingID, pq.Array(memberIDs), pq.Array(statuses), recordedBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark attendance at meeting %d: %w", meetingID, err)
+	}
+	if len(marked) != len(attendance) {
+		return nil, fmt.Errorf("failed to mark attendance at meeting %d: %w", meetingID, ErrNoSuchMember)
+	}
+	return marked, nil
+}
+
+// ListRates counts the attendance of members of the group at meetings
+// between the dates of the filter, ordered by name. Members are expected at
+// the meetings of their section held while they were in it and active, and at
+// any meeting their attendance was marked at.
+func (s MeetingStore) ListRates(ctx context.Context, groupID, memberID int64, filter Filter) ([]Rate, error) {
+	rates := []Rate{}
+	query := `
+	WITH held AS (
+		SELECT id, section, held_on FROM autocrat.meetings
+		WHERE group_id = $1 AND held_on >= $2 AND held_on <= $3
+	), expected AS (
+		SELECT m.id AS member_id, h.id AS meeting_id
+		FROM autocrat.members m JOIN held h ON h.section = m.section
+		WHERE m.group_id = $1 AND h.held_on >= m.joined_on AND h.held_on >= m.section_since
+			AND CASE WHEN m.status = 'active' THEN h.held_on >= m.status_since ELSE h.held_on < m.status_since END
+		UNION
+		SELECT a.member_id, a.meeting_id
+		FROM autocrat.attendance a JOIN held h ON h.id = a.meeting_id
+	)
+	SELECT
+		m.id AS member_id, m.firstname, m.lastname, m.section,
+		count(e.meeting_id) AS meetings,
+		count(*) FILTER (WHERE a.status = 'present') AS present,
+		count(*) FILTER (WHERE a.status = 'late') AS late,
+		count(*) FILTER (WHERE a.status = 'absent') AS absent,
+		count(*) FILTER (WHERE a.status = 'apologies') AS apologies
+	FROM autocrat.members m
+	LEFT JOIN expected e ON e.member_id = m.id
+	LEFT JOIN autocrat.attendance a ON a.member_id = e.member_id AND a.meeting_id = e.meeting_id
+	WHERE m.group_id = $1
+		AND ($4 = '' OR (m.section = $4 AND m.status = 'active'))
+		AND ($5 = 0 OR m.id = $5)
+	GROUP BY m.id
+	ORDER BY m.lastname, m.firstname, m.id;
+	`
+	err := s.cluster.Reader(ctx).Named("meeting.list_rates").
+		Select(ctx, &rates, query, groupID, filter.From, filter.To, filter.Section, memberID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count attendance: %w", err)
+	}
+	return rates, nil
+}
+
+// constraintError converts violations of the section's constraint to the
+// store's errors.
+func constraintError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return fmt.Errorf("%w: %v", ErrNoSuchSection, err)
+	}
+	return err
+}
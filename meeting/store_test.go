@@ -0,0 +1,140 @@
+package meeting
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/db/dbtest"
+	"github.com/nick96/cubapi/db/migrate"
+	"github.com/nick96/cubapi/migrations"
+	"go.uber.org/zap"
+)
+
+// newPostgresStore creates a store backed by the database configured by the
+// same environment variables as the user store tests, with a group of its own
+// that has cubs and scouts sections. The test is skipped by -short.
+func newPostgresStore(t *testing.T) (MeetingStorer, *db.DB, int64) {
+	if testing.Short() {
+		t.Skip("Skipping store test against Postgres in short mode")
+	}
+	handle, err := db.NewConn(
+		zap.NewNop(),
+		os.Getenv("USER_DB_USER"),
+		os.Getenv("DB_PASS"),
+		os.Getenv("USER_DB_NAME"),
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_SSL_MODE"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { handle.Close() })
+	if err := migrate.NewMigrator(handle.DB.DB, zap.NewNop()).Apply(migrations.All...); err != nil {
+		t.Fatal(err)
+	}
+
+	var groupID int64
+	slug := fmt.Sprintf("meeting-store-%d", time.Now().UnixNano())
+	if err := handle.QueryRowx(`INSERT INTO autocrat.groups (name, slug) VALUES ($1, $1) RETURNING id;`, slug).Scan(&groupID); err != nil {
+		t.Fatal(err)
+	}
+	handle.MustExec(`INSERT INTO autocrat.sections (group_id, kind, name) VALUES ($1, 'cubs', 'Cubs'), ($1, 'scouts', 'Scouts');`, groupID)
+	t.Cleanup(func() {
+		handle.MustExec(`DELETE FROM autocrat.meetings WHERE group_id = $1;`, groupID)
+		handle.MustExec(`DELETE FROM autocrat.members WHERE group_id = $1;`, groupID)
+		handle.MustExec(`DELETE FROM autocrat.groups WHERE id = $1;`, groupID)
+	})
+	return NewStore(db.NewCluster(zap.NewNop(), handle)), handle, groupID
+}
+
+func march(day int) date.Date {
+	return date.Of(time.Date(2021, time.March, day, 0, 0, 0, 0, time.UTC))
+}
+
+func TestListRatesOnlyExpectsMeetingsWhileActiveInSection(t *testing.T) {
+	store, handle, groupID := newPostgresStore(t)
+	ctx := context.Background()
+
+	// Mowgli was a cub all month, Bagheera joined the cubs mid-month, Baloo
+	// moved to the cubs from the scouts mid-month and Hathi left the cubs
+	// mid-month.
+	addMember := func(name, section, status string, joinedOn, sectionSince, statusSince date.Date) (id int64) {
+		query := `
+		INSERT INTO autocrat.members (
+			group_id, firstname, lastname, date_of_birth, section, joined_on, status, section_since, status_since
+		)
+		VALUES ($1, $2, 'Jungle', '2012-01-01', $3, $4, $5, $6, $7)
+		RETURNING id;
+		`
+		if err := handle.QueryRowx(query, groupID, name, section, joinedOn, status, sectionSince, statusSince).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	mowgli := addMember("Mowgli", "cubs", "active", march(1), march(1), march(1))
+	bagheera := addMember("Bagheera", "cubs", "active", march(10), march(10), march(10))
+	baloo := addMember("Baloo", "cubs", "active", march(1), march(10), march(1))
+	hathi := addMember("Hathi", "cubs", "left", march(1), march(1), march(10))
+
+	for _, day := range []int{1, 8, 15, 22} {
+		if _, err := store.AddMeeting(ctx, Meeting{GroupId: groupID, Section: "cubs", HeldOn: march(day)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rates, err := store.ListRates(ctx, groupID, 0, Filter{From: march(1), To: march(31)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[int64]int{mowgli: 4, bagheera: 2, baloo: 2, hathi: 2}
+	if len(rates) != len(expected) {
+		t.Fatalf("Expected a rate for each member, got %+v", rates)
+	}
+	for _, rate := range rates {
+		if rate.Meetings != expected[rate.MemberId] {
+			t.Errorf("Expected %s at %d meetings, got %d", rate.FirstName, expected[rate.MemberId], rate.Meetings)
+		}
+	}
+}
+
+func TestStoreRoutesReads(t *testing.T) {
+	primary := dbtest.NewRecorder(t.Name() + "/primary")
+	replica := dbtest.NewRecorder(t.Name() + "/replica")
+	cluster := db.NewCluster(zap.NewNop(), primary.DB, replica.DB)
+	cluster.CheckLag = func(ctx context.Context, replica *db.DB) (time.Duration, error) {
+		return 0, nil
+	}
+	cluster.CheckReplicas(context.Background())
+	store := NewStore(cluster)
+	ctx := context.Background()
+
+	if _, err := store.ListMeetings(ctx, testGroupID, Filter{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ListRates(ctx, testGroupID, 0, Filter{}); err != nil {
+		t.Fatal(err)
+	}
+	if queries := replica.Queries(); len(queries) != 2 || len(primary.Queries()) != 0 {
+		t.Fatalf("Expected reads to go to the replica, got %d on the replica and %d on the primary", len(queries), len(primary.Queries()))
+	}
+
+	replica.Reset()
+	if err := store.DeleteMeeting(ctx, testGroupID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ListAttendance(db.WithPrimary(ctx), testGroupID, 1); err != nil {
+		t.Fatal(err)
+	}
+	queries := primary.Queries()
+	if len(queries) != 2 || len(replica.Queries()) != 0 {
+		t.Fatalf("Expected writes and forced reads to go to the primary, got %d on the primary and %d on the replica", len(queries), len(replica.Queries()))
+	}
+	if !strings.Contains(queries[0], "DELETE FROM autocrat.meetings") || !strings.Contains(queries[1], "FROM autocrat.attendance") {
+		t.Errorf("Expected the delete then the forced read on the primary, got %q", queries)
+	}
+}
@@ -0,0 +1,270 @@
+package meeting
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/nick96/cubapi/badge"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/progress"
+	"github.com/nick96/cubapi/security"
+)
+
+// Groups meetings belong to in tests.
+const (
+	testGroupID  = 1
+	otherGroupID = 2
+)
+
+// mockMember is a member of a group in a section. Members are only expected
+// at meetings of their section held on or after joinedOn.
+type mockMember struct {
+	groupID  int64
+	section  string
+	inactive bool
+	joinedOn date.Date
+}
+
+// attendanceKey identifies the attendance of a member at a meeting.
+type attendanceKey struct {
+	meetingID, memberID int64
+}
+
+// mockMeetingStore stores meetings and attendance in memory.
+type mockMeetingStore struct {
+	meetings   map[int64]Meeting
+	members    map[int64]mockMember
+	attendance map[attendanceKey]Attendance
+}
+
+func newMockMeetingStore() *mockMeetingStore {
+	return &mockMeetingStore{
+		meetings:   make(map[int64]Meeting),
+		members:    make(map[int64]mockMember),
+		attendance: make(map[attendanceKey]Attendance),
+	}
+}
+
+func (s *mockMeetingStore) GetMeeting(ctx context.Context, groupID, id int64) (Meeting, bool, error) {
+	meeting, ok := s.meetings[id]
+	if !ok || meeting.GroupId != groupID {
+		return Meeting{}, false, nil
+	}
+	return meeting, true, nil
+}
+
+// held lists the meetings of the group matching the filter, oldest first.
+func (s *mockMeetingStore) held(groupID int64, filter Filter) []Meeting {
+	meetings := []Meeting{}
+	for _, meeting := range s.meetings {
+		if meeting.GroupId == groupID && (filter.Section == "" || meeting.Section == filter.Section) &&
+			!meeting.HeldOn.Before(filter.From) && !meeting.HeldOn.After(filter.To) {
+			meetings = append(meetings, meeting)
+		}
+	}
+	sort.Slice(meetings, func(i, j int) bool {
+		if meetings[i].HeldOn != meetings[j].HeldOn {
+			return meetings[i].HeldOn.Before(meetings[j].HeldOn)
+		}
+		return meetings[i].Id < meetings[j].Id
+	})
+	return meetings
+}
+
+func (s *mockMeetingStore) ListMeetings(ctx context.Context, groupID int64, filter Filter) ([]Meeting, error) {
+	return s.held(groupID, filter), nil
+}
+
+func (s *mockMeetingStore) AddMeeting(ctx context.Context, meeting Meeting) (Meeting, error) {
+	meeting.Id = int64(len(s.meetings) + 1)
+	for s.meetings[meeting.Id].Id != 0 {
+		meeting.Id++
+	}
+	meeting.CreatedAt = time.Now()
+	meeting.UpdatedAt = meeting.CreatedAt
+	s.meetings[meeting.Id] = meeting
+	return meeting, nil
+}
+
+func (s *mockMeetingStore) UpdateMeeting(ctx context.Context, meeting Meeting) (Meeting, error) {
+	existing, ok := s.meetings[meeting.Id]
+	if !ok || existing.GroupId != meeting.GroupId {
+		return Meeting{}, ErrNoSuchMeeting
+	}
+	meeting.Requirements = existing.Requirements
+	meeting.CreatedAt = existing.CreatedAt
+	meeting.UpdatedAt = time.Now()
+	s.meetings[meeting.Id] = meeting
+	return meeting, nil
+}
+
+func (s *mockMeetingStore) SetRequirements(ctx context.Context, groupID, id int64, requirements Requirements) (Meeting, error) {
+	meeting, ok := s.meetings[id]
+	if !ok || meeting.GroupId != groupID {
+		return Meeting{}, ErrNoSuchMeeting
+	}
+	meeting.Requirements = requirements
+	meeting.UpdatedAt = time.Now()
+	s.meetings[id] = meeting
+	return meeting, nil
+}
+
+func (s *mockMeetingStore) DeleteMeeting(ctx context.Context, groupID, id int64) error {
+	if meeting, ok := s.meetings[id]; !ok || meeting.GroupId != groupID {
+		return ErrNoSuchMeeting
+	}
+	delete(s.meetings, id)
+	for key := range s.attendance {
+		if key.meetingID == id {
+			delete(s.attendance, key)
+		}
+	}
+	return nil
+}
+
+func (s *mockMeetingStore) ActiveMembers(ctx context.Context, groupID int64, section string) ([]int64, error) {
+	ids := []int64{}
+	for id, member := range s.members {
+		if member.groupID == groupID && member.section == section && !member.inactive {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (s *mockMeetingStore) ListAttendance(ctx context.Context, groupID, meetingID int64) ([]Attendance, error) {
+	attendance := []Attendance{}
+	if meeting, ok := s.meetings[meetingID]; !ok || meeting.GroupId != groupID {
+		return attendance, nil
+	}
+	for key, a := range s.attendance {
+		if key.meetingID == meetingID {
+			attendance = append(attendance, a)
+		}
+	}
+	sort.Slice(attendance, func(i, j int) bool { return attendance[i].MemberId < attendance[j].MemberId })
+	return attendance, nil
+}
+
+func (s *mockMeetingStore) MarkAttendance(ctx context.Context, groupID, meetingID int64, attendance []Attendance) ([]Attendance, error) {
+	if meeting, ok := s.meetings[meetingID]; !ok || meeting.GroupId != groupID {
+		return nil, ErrNoSuchMember
+	}
+	for _, a := range attendance {
+		if member, ok := s.members[a.MemberId]; !ok || member.groupID != groupID {
+			return nil, ErrNoSuchMember
+		}
+	}
+	marked := make([]Attendance, 0, len(attendance))
+	for _, a := range attendance {
+		a.RecordedAt = time.Now()
+		s.attendance[attendanceKey{meetingID, a.MemberId}] = a
+		marked = append(marked, a)
+	}
+	return marked, nil
+}
+
+func (s *mockMeetingStore) ListRates(ctx context.Context, groupID, memberID int64, filter Filter) ([]Rate, error) {
+	held := s.held(groupID, Filter{From: filter.From, To: filter.To})
+	rates := []Rate{}
+	for id, member := range s.members {
+		if member.groupID != groupID || (memberID != 0 && id != memberID) ||
+			(filter.Section != "" && (member.section != filter.Section || member.inactive)) {
+			continue
+		}
+		rate := Rate{MemberId: id, Section: member.section}
+		for _, meeting := range held {
+			a, marked := s.attendance[attendanceKey{meeting.Id, id}]
+			if !marked && (meeting.Section != member.section || member.inactive || meeting.HeldOn.Before(member.joinedOn)) {
+				continue
+			}
+			rate.Meetings++
+			switch a.Status {
+			case StatusPresent:
+				rate.Present++
+			case StatusLate:
+				rate.Late++
+			case StatusAbsent:
+				rate.Absent++
+			case StatusApologies:
+				rate.Apologies++
+			}
+		}
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].MemberId < rates[j].MemberId })
+	return rates, nil
+}
+
+// mockCrediter credits members with the requirements it knows, keeping the
+// latest credit of each meeting.
+type mockCrediter struct {
+	requirements map[RequirementRef]bool
+	credits      map[int64]progress.MeetingCredit
+}
+
+func newMockCrediter(requirements ...RequirementRef) *mockCrediter {
+	crediter := &mockCrediter{
+		requirements: make(map[RequirementRef]bool),
+		credits:      make(map[int64]progress.MeetingCredit),
+	}
+	for _, requirement := range requirements {
+		crediter.requirements[requirement] = true
+	}
+	return crediter
+}
+
+func (c *mockCrediter) CheckRequirement(ctx context.Context, key, requirementID string) security.ClientError {
+	if !c.requirements[RequirementRef{BadgeKey: key, RequirementId: requirementID}] {
+		return problem.Invalid("badge %s does not have requirement %s", key, requirementID)
+	}
+	return nil
+}
+
+func (c *mockCrediter) CreditMeeting(ctx context.Context, credit progress.MeetingCredit) security.ClientError {
+	if len(credit.Credits) == 0 {
+		delete(c.credits, credit.MeetingId)
+		return nil
+	}
+	c.credits[credit.MeetingId] = credit
+	return nil
+}
+
+// mockCatalogue is a catalogue of the latest version of badges by key.
+type mockCatalogue map[string]badge.Badge
+
+func (c mockCatalogue) GetBadge(ctx context.Context, key string) (badge.Badge, bool, error) {
+	b, ok := c[key]
+	return b, ok, nil
+}
+
+func (c mockCatalogue) GetVersionByID(ctx context.Context, id int64) (badge.Badge, bool, error) {
+	for _, b := range c {
+		if b.Id == id {
+			return b, true, nil
+		}
+	}
+	return badge.Badge{}, false, nil
+}
+
+// catalogueCrediter checks requirements against a catalogue the way progress
+// does, and credits members like mockCrediter.
+type catalogueCrediter struct {
+	*mockCrediter
+	progress progress.ProgressService
+}
+
+func newCatalogueCrediter(badges ...badge.Badge) catalogueCrediter {
+	catalogue := make(mockCatalogue, len(badges))
+	for _, b := range badges {
+		catalogue[b.Key] = b
+	}
+	return catalogueCrediter{newMockCrediter(), progress.NewProgressService(nil, catalogue, time.UTC)}
+}
+
+func (c catalogueCrediter) CheckRequirement(ctx context.Context, key, requirementID string) security.ClientError {
+	return c.progress.CheckRequirement(ctx, key, requirementID)
+}
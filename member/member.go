@@ -0,0 +1,294 @@
+package member
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/problem"
+	"go.uber.org/zap"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// CodeRosterTooLarge is the problem code of importing a roster larger than
+// maxRosterSize.
+const CodeRosterTooLarge problem.Code = "roster_too_large"
+
+func init() {
+	problem.Register(CodeRosterTooLarge, http.StatusRequestEntityTooLarge, "Roster too large")
+}
+
+// maxRosterSize is the largest roster that can be imported, far larger than
+// the roster of any group.
+const maxRosterSize = 5 << 20
+
+// MemberRequest creates or replaces a member.
+type MemberRequest struct {
+	FirstName   string    `json:"firstName" validate:"required,max=256"`
+	LastName    string    `json:"lastName" validate:"required,max=256"`
+	DateOfBirth date.Date `json:"dateOfBirth" validate:"required"`
+	Section     string    `json:"section" validate:"oneof=joeys cubs scouts venturers rovers"`
+	Patrol      string    `json:"patrol,omitempty" validate:"max=256"`
+	// JoinedOn defaults to today for new members and is left as it was
+	// when replacing a member.
+	JoinedOn date.Date `json:"joinedOn,omitempty"`
+	// Status defaults to active.
+	Status            string             `json:"status,omitempty" validate:"omitempty,oneof=active inactive left"`
+	EmergencyContacts []EmergencyContact `json:"emergencyContacts,omitempty" validate:"max=5,dive"`
+	// MembershipNumber is left as it was when replacing a member if it
+	// isn't given.
+	MembershipNumber string `json:"membershipNumber,omitempty" validate:"max=64"`
+	UserId           *int64 `json:"userId,omitempty"`
+}
+
+// member converts the request to a member of the group.
+func (m MemberRequest) member(groupID int64) Member {
+	return Member{
+		GroupId:           groupID,
+		FirstName:         m.FirstName,
+		LastName:          m.LastName,
+		DateOfBirth:       m.DateOfBirth,
+		Section:           m.Section,
+		Patrol:            m.Patrol,
+		JoinedOn:          m.JoinedOn,
+		Status:            m.Status,
+		EmergencyContacts: m.EmergencyContacts,
+		MembershipNumber:  m.MembershipNumber,
+		UserId:            m.UserId,
+	}
+}
+
+type MemberResponse Member
+
+func (m MemberResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// NewMemberRouter creates a router for the member endpoints of the caller's
+// group. Members are personal information of children so the router must
+// only be mounted behind authentication, which also decides the group.
+//
+// GET /: List members, optionally filtered by the section and status query
+// parameters.
+// POST /: Add a member.
+// GET /{memberID}: Get a member.
+// PUT /{memberID}: Replace the details of a member.
+// DELETE /{memberID}: Delete a member.
+// POST /import: Import a roster in CSV or XLSX, by content type. Columns are
+// mapped to fields by their headers or by column query parameters formatted
+// as field=header. The sheet of workbooks to import can be given by the sheet
+// query parameter. Nothing is written if dryRun is true.
+func NewMemberRouter(logger *zap.Logger, service MemberService) func(chi.Router) {
+	validate := problem.NewValidator()
+	date.RegisterValidation(validate)
+	return func(r chi.Router) {
+		r.Get("/", listMembers(logger, service))
+		r.Post("/", newMember(logger, validate, service))
+		r.Get("/{memberID}", getMember(logger, service))
+		r.Put("/{memberID}", updateMember(logger, validate, service))
+		r.Delete("/{memberID}", deleteMember(logger, service))
+		r.Post("/import", importRoster(logger, service))
+	}
+}
+
+func listMembers(logger *zap.Logger, service MemberService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := group.FromRequest(w, r)
+		if !ok {
+			return
+		}
+		filter := Filter{
+			Section: r.URL.Query().Get("section"),
+			Status:  r.URL.Query().Get("status"),
+		}
+		members, err := service.ListMembers(r.Context(), groupID, filter)
+		if err != nil {
+			logger.Error("Failed to list members", zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, members)
+	}
+}
+
+func newMember(logger *zap.Logger, validate *validator.Validate, service MemberService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := group.FromRequest(w, r)
+		if !ok {
+			return
+		}
+		request, ok := decodeRequest(logger, w, r, validate)
+		if !ok {
+			return
+		}
+		member, err := service.NewMember(r.Context(), request.member(groupID))
+		if err != nil {
+			logger.Info("Failed to add member", zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		membersCreated.Inc()
+		logger.Debug("Added member", zap.Int64("memberID", member.Id))
+		render.Status(r, http.StatusCreated)
+		render.Render(w, r, MemberResponse(member))
+	}
+}
+
+func getMember(logger *zap.Logger, service MemberService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := memberID(w, r)
+		if !ok {
+			return
+		}
+		member, err := service.GetMember(r.Context(), groupID, id)
+		if err != nil {
+			logger.Info("Failed to get member", zap.Int64("memberID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, MemberResponse(member))
+	}
+}
+
+func updateMember(logger *zap.Logger, validate *validator.Validate, service MemberService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := memberID(w, r)
+		if !ok {
+			return
+		}
+		request, ok := decodeRequest(logger, w, r, validate)
+		if !ok {
+			return
+		}
+		member := request.member(groupID)
+		member.Id = id
+		updated, err := service.UpdateMember(r.Context(), member)
+		if err != nil {
+			logger.Info("Failed to update member", zap.Int64("memberID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Debug("Updated member", zap.Int64("memberID", id))
+		render.Render(w, r, MemberResponse(updated))
+	}
+}
+
+func deleteMember(logger *zap.Logger, service MemberService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := memberID(w, r)
+		if !ok {
+			return
+		}
+		if err := service.DeleteMember(r.Context(), groupID, id); err != nil {
+			logger.Info("Failed to delete member", zap.Int64("memberID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Deleted member", zap.Int64("memberID", id))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func importRoster(logger *zap.Logger, service MemberService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := group.FromRequest(w, r)
+		if !ok {
+			return
+		}
+		query := r.URL.Query()
+		dryRun := false
+		if value := query.Get("dryRun"); value != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(value); err != nil {
+				problem.Write(w, r, problem.New(problem.CodeValidationFailed, "dryRun must be true or false"))
+				return
+			}
+		}
+		mapping, err := ParseColumnMapping(query["column"])
+		if err != nil {
+			problem.Write(w, r, problem.New(problem.CodeValidationFailed, err.Error()))
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRosterSize))
+		if err != nil {
+			logger.Info("Failed to read roster", zap.Error(err))
+			problem.Write(w, r, problem.New(CodeRosterTooLarge, fmt.Sprintf("Rosters must be at most %d MiB", maxRosterSize>>20)))
+			return
+		}
+		defer r.Body.Close()
+
+		roster, invalid := ParseRoster(body, RosterFormat(r.Header.Get("Content-Type"), body), query.Get("sheet"), mapping)
+		if invalid != nil {
+			logger.Info("Invalid roster", zap.Error(invalid))
+			problem.Write(w, r, invalid)
+			return
+		}
+		result, clientErr := service.ImportRoster(r.Context(), groupID, roster, dryRun)
+		if clientErr != nil {
+			logger.Info("Failed to import roster", zap.Error(clientErr))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, clientErr))
+			return
+		}
+		logger.Info("Imported roster",
+			zap.Bool("dryRun", dryRun),
+			zap.Int("created", result.Created),
+			zap.Int("updated", result.Updated),
+			zap.Int("unchanged", result.Unchanged),
+			zap.Int("skipped", result.Skipped),
+		)
+		render.JSON(w, r, result)
+	}
+}
+
+// memberID gets the caller's group and parses the member ID in the path.
+// Anything that isn't an ID can't be a member so it's not found.
+func memberID(w http.ResponseWriter, r *http.Request) (groupID, id int64, ok bool) {
+	groupID, ok = group.FromRequest(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "memberID"), 10, 64)
+	if err != nil {
+		problem.Write(w, r, problem.New(problem.CodeNotFound, "Member does not exist"))
+		return 0, 0, false
+	}
+	return groupID, id, true
+}
+
+// decodeRequest decodes and validates a member request. A problem is written
+// if the request is invalid.
+func decodeRequest(logger *zap.Logger, w http.ResponseWriter, r *http.Request, validate *validator.Validate) (MemberRequest, bool) {
+	var request MemberRequest
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Info("Failed to read request body", zap.Error(err))
+		problem.Write(w, r, problem.Internal(err))
+		return request, false
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		logger.Info("Failed to unmarshal member request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Member request body is invalid JSON", err))
+		return request, false
+	}
+	if err := validate.Struct(request); err != nil {
+		logger.Info("Invalid member request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Invalid request body", err))
+		return request, false
+	}
+	return request, true
+}
@@ -0,0 +1,342 @@
+package member
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/security"
+	"github.com/nick96/cubapi/tracing"
+)
+
+const (
+	// CodeUserAlreadyLinked is the problem code of linking a member to a
+	// user that is already linked to another member.
+	CodeUserAlreadyLinked problem.Code = "user_already_linked"
+	// CodeMembershipNumberTaken is the problem code of giving a member the
+	// membership number of another member of the group.
+	CodeMembershipNumberTaken problem.Code = "membership_number_taken"
+)
+
+func init() {
+	problem.Register(CodeUserAlreadyLinked, http.StatusConflict, "User already linked")
+	problem.Register(CodeMembershipNumberTaken, http.StatusConflict, "Membership number taken")
+}
+
+type MemberService struct {
+	store MemberStorer
+	// location is the time zone dates are in, it decides when today is.
+	location *time.Location
+}
+
+// NewMemberService creates a MemberService that stores members in the store.
+// Dates, like when a member joined, are in the given location.
+func NewMemberService(store MemberStorer, location *time.Location) MemberService {
+	return MemberService{store: store, location: location}
+}
+
+// GetMember gets the member of the group with the given ID.
+func (s MemberService) GetMember(ctx context.Context, groupID, id int64) (Member, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "MemberService.GetMember")
+	defer span.End()
+
+	member, found, err := s.store.GetMember(ctx, groupID, id)
+	if err != nil {
+		span.RecordError(err)
+		return Member{}, security.NewClientError(fmt.Sprintf("failed to get member %d", id), err)
+	} else if !found {
+		return Member{}, problem.NewError(problem.CodeNotFound, fmt.Sprintf("member %d does not exist", id), ErrNoSuchMember)
+	}
+	return member, nil
+}
+
+// ListMembers lists the members of the group matching the filter.
+func (s MemberService) ListMembers(ctx context.Context, groupID int64, filter Filter) ([]Member, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "MemberService.ListMembers")
+	defer span.End()
+
+	members, err := s.store.ListMembers(ctx, groupID, filter)
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError("failed to list members", err)
+	}
+	return members, nil
+}
+
+// NewMember adds a member to the member's group. Members join today and are
+// active unless told otherwise.
+func (s MemberService) NewMember(ctx context.Context, member Member) (Member, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "MemberService.NewMember")
+	defer span.End()
+
+	if member.JoinedOn.IsZero() {
+		member.JoinedOn = date.Today(s.location)
+	}
+	if err := s.check(&member); err != nil {
+		return Member{}, err
+	}
+	added, err := s.store.AddMember(ctx, member)
+	if err != nil {
+		span.RecordError(err)
+		return Member{}, storeError("failed to add member", err)
+	}
+	return added, nil
+}
+
+// UpdateMember replaces the details of the member with the member's ID in the
+// member's group. The join date and membership number are kept if they
+// aren't given.
+func (s MemberService) UpdateMember(ctx context.Context, member Member) (Member, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "MemberService.UpdateMember")
+	defer span.End()
+	ctx = db.WithPrimary(ctx)
+
+	if member.JoinedOn.IsZero() || member.MembershipNumber == "" {
+		existing, err := s.GetMember(ctx, member.GroupId, member.Id)
+		if err != nil {
+			return Member{}, err
+		}
+		if member.JoinedOn.IsZero() {
+			member.JoinedOn = existing.JoinedOn
+		}
+		if member.MembershipNumber == "" {
+			member.MembershipNumber = existing.MembershipNumber
+		}
+	}
+	if err := s.check(&member); err != nil {
+		return Member{}, err
+	}
+	updated, err := s.store.UpdateMember(ctx, member)
+	if err != nil {
+		span.RecordError(err)
+		return Member{}, storeError(fmt.Sprintf("failed to update member %d", member.Id), err)
+	}
+	return updated, nil
+}
+
+// DeleteMember deletes the member of the group with the given ID. Members who
+// have left should usually be kept with the left status so their records are
+// kept.
+func (s MemberService) DeleteMember(ctx context.Context, groupID, id int64) security.ClientError {
+	ctx, span := tracing.Start(ctx, "MemberService.DeleteMember")
+	defer span.End()
+
+	if err := s.store.DeleteMember(ctx, groupID, id); err != nil {
+		span.RecordError(err)
+		return storeError(fmt.Sprintf("failed to delete member %d", id), err)
+	}
+	return nil
+}
+
+// ImportRoster imports the rows of a roster into the group, matching them to
+// members by membership number. Members without a membership number are
+// matched by name and date of birth, so rosters can be imported by groups
+// that added their members by hand. Only the fields the roster has columns
+// for are changed and new members join today and are active unless the
+// roster says otherwise. Rows with errors, including rows that duplicate
+// others, are skipped and the rest are written together, so importing the
+// same roster again changes nothing. Nothing is written by a dry run.
+func (s MemberService) ImportRoster(ctx context.Context, groupID int64, roster Roster, dryRun bool) (ImportResult, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "MemberService.ImportRoster")
+	defer span.End()
+	if !dryRun {
+		// Rows are matched against the members as they are now so importing
+		// a roster straight after another doesn't add the same members twice.
+		ctx = db.WithPrimary(ctx)
+	}
+
+	members, err := s.store.ListMembers(ctx, groupID, Filter{})
+	if err != nil {
+		span.RecordError(err)
+		return ImportResult{}, security.NewClientError("failed to list members", err)
+	}
+	kinds, err := s.store.Sections(ctx, groupID)
+	if err != nil {
+		span.RecordError(err)
+		return ImportResult{}, security.NewClientError("failed to list sections", err)
+	}
+	sections := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		sections[kind] = true
+	}
+	byNumber := make(map[string]Member)
+	byName := make(map[string][]Member)
+	for _, member := range members {
+		if member.MembershipNumber != "" {
+			byNumber[member.MembershipNumber] = member
+		}
+		byName[nameKey(member)] = append(byName[nameKey(member)], member)
+	}
+
+	today := date.Today(s.location)
+	result := ImportResult{DryRun: dryRun, Rows: make([]RowResult, len(roster.Rows))}
+	parsed := make([]Member, len(roster.Rows))
+	numberRows := make(map[string][]int)
+	nameRows := make(map[string][]int)
+	for i, row := range roster.Rows {
+		member, errs := parseRosterRow(row, sections, today)
+		parsed[i] = member
+		result.Rows[i] = RowResult{Row: row.Row, MembershipNumber: row.Values[FieldMembershipNumber], Errors: errs}
+		if member.MembershipNumber != "" {
+			numberRows[member.MembershipNumber] = append(numberRows[member.MembershipNumber], row.Row)
+		}
+		if member.FirstName != "" && member.LastName != "" && !member.DateOfBirth.IsZero() {
+			nameRows[nameKey(member)] = append(nameRows[nameKey(member)], row.Row)
+		}
+	}
+
+	var writes []Member
+	var written []int
+	for i, member := range parsed {
+		row := &result.Rows[i]
+		if others := otherRows(numberRows[member.MembershipNumber], row.Row); member.MembershipNumber != "" && len(others) > 0 {
+			row.Errors = append(row.Errors, RowError{FieldMembershipNumber, "the membership number is also on " + rowList(others)})
+		}
+		if others := otherRows(nameRows[nameKey(member)], row.Row); len(others) > 0 {
+			row.Errors = append(row.Errors, RowError{Message: "a member with the same name and date of birth is also on " + rowList(others)})
+		}
+		if len(row.Errors) > 0 {
+			continue
+		}
+
+		existing, found := byNumber[member.MembershipNumber]
+		if !found {
+			for _, other := range byName[nameKey(member)] {
+				if other.MembershipNumber == "" {
+					existing, found = other, true
+					break
+				}
+			}
+		}
+		if !found && len(byName[nameKey(member)]) > 0 {
+			other := byName[nameKey(member)][0]
+			row.Errors = append(row.Errors, RowError{FieldMembershipNumber, fmt.Sprintf("member %d has the same name and date of birth but membership number %s", other.Id, other.MembershipNumber)})
+			continue
+		}
+
+		imported := Member{GroupId: groupID, JoinedOn: today, Status: StatusActive}
+		if found {
+			imported = existing
+		}
+		imported.MembershipNumber = member.MembershipNumber
+		imported.FirstName = member.FirstName
+		imported.LastName = member.LastName
+		imported.DateOfBirth = member.DateOfBirth
+		imported.Section = member.Section
+		if roster.Has(FieldPatrol) {
+			imported.Patrol = member.Patrol
+		}
+		if !member.JoinedOn.IsZero() {
+			imported.JoinedOn = member.JoinedOn
+		}
+		if member.Status != "" {
+			imported.Status = member.Status
+		}
+		if imported.JoinedOn.Before(imported.DateOfBirth) {
+			row.Errors = append(row.Errors, RowError{FieldJoinedOn, "must not be before the date of birth"})
+			continue
+		}
+
+		switch {
+		case !found:
+			row.Action = ActionCreated
+		case sameDetails(imported, existing):
+			row.Action = ActionUnchanged
+		default:
+			row.Action = ActionUpdated
+		}
+		if found {
+			id := existing.Id
+			row.MemberId = &id
+		}
+		if row.Action != ActionUnchanged {
+			writes = append(writes, imported)
+			written = append(written, i)
+		}
+	}
+
+	if !dryRun && len(writes) > 0 {
+		stored, err := s.store.ImportMembers(ctx, groupID, writes)
+		if err != nil {
+			span.RecordError(err)
+			return ImportResult{}, storeError("failed to import roster", err)
+		}
+		for j, i := range written {
+			id := stored[j].Id
+			result.Rows[i].MemberId = &id
+		}
+	}
+
+	for i := range result.Rows {
+		row := &result.Rows[i]
+		if len(row.Errors) > 0 {
+			row.Action = ActionSkipped
+		}
+		switch row.Action {
+		case ActionCreated:
+			result.Created++
+		case ActionUpdated:
+			result.Updated++
+		case ActionUnchanged:
+			result.Unchanged++
+		case ActionSkipped:
+			result.Skipped++
+		}
+		if !dryRun {
+			membersImported.WithLabelValues(row.Action).Inc()
+		}
+	}
+	return result, nil
+}
+
+// otherRows returns the row numbers other than the given row.
+func otherRows(rows []int, row int) []int {
+	var others []int
+	for _, other := range rows {
+		if other != row {
+			others = append(others, other)
+		}
+	}
+	return others
+}
+
+// check checks the parts of a member that request validation can't and fills
+// in defaults.
+func (s MemberService) check(member *Member) security.ClientError {
+	if member.Status == "" {
+		member.Status = StatusActive
+	}
+	if member.EmergencyContacts == nil {
+		member.EmergencyContacts = EmergencyContacts{}
+	}
+	today := date.Today(s.location)
+	if member.DateOfBirth.After(today) {
+		return problem.NewError(problem.CodeValidationFailed, "date of birth must not be in the future", fmt.Errorf("date of birth %s is after %s", member.DateOfBirth, today))
+	}
+	if member.JoinedOn.Before(member.DateOfBirth) {
+		return problem.NewError(problem.CodeValidationFailed, "join date must not be before the date of birth", fmt.Errorf("join date %s is before date of birth %s", member.JoinedOn, member.DateOfBirth))
+	}
+	return nil
+}
+
+// storeError converts errors from the store to client errors.
+func storeError(message string, err error) security.ClientError {
+	switch {
+	case errors.Is(err, ErrNoSuchMember):
+		return problem.NewError(problem.CodeNotFound, "member does not exist", err)
+	case errors.Is(err, ErrNoSuchUser):
+		return problem.NewError(problem.CodeValidationFailed, "linked user does not exist", err)
+	case errors.Is(err, ErrNoSuchSection):
+		return problem.NewError(problem.CodeValidationFailed, "the group does not have the section", err)
+	case errors.Is(err, ErrUserAlreadyLinked):
+		return problem.NewError(CodeUserAlreadyLinked, "user is already linked to another member", err)
+	case errors.Is(err, ErrMembershipNumberTaken):
+		return problem.NewError(CodeMembershipNumberTaken, "another member of the group has the membership number", err)
+	}
+	return security.NewClientError(message, err)
+}
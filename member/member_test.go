@@ -0,0 +1,388 @@
+package member
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/openapi/openapitest"
+	"github.com/nick96/cubapi/problem"
+	"go.uber.org/zap"
+)
+
+const validMember = `{
+	"firstName": "Mowgli",
+	"lastName": "Wolf",
+	"dateOfBirth": "2014-03-01",
+	"section": "cubs",
+	"patrol": "Red six",
+	"emergencyContacts": [{"name": "Raksha", "relationship": "Mother", "phone": "0400 000 000"}]
+}`
+
+// newTestRouter creates a router whose requests are made in the group.
+func newTestRouter(store MemberStorer, groupID int64) http.Handler {
+	router := chi.NewRouter()
+	router.Use(inGroup(groupID))
+	router.Route("/member", NewMemberRouter(zap.NewNop(), NewMemberService(store, time.UTC)))
+	return router
+}
+
+func TestMemberLifecycle(t *testing.T) {
+	router := newTestRouter(newMockMemberStore().addGroup(testGroupID), testGroupID)
+
+	var created Member
+	if w := openapitest.Do(t, router, "POST", "/member", validMember, &created); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if created.Id == 0 || created.Status != StatusActive || created.JoinedOn != date.Today(time.UTC) {
+		t.Errorf("Expected an active member who joined today, got %+v", created)
+	}
+	if len(created.EmergencyContacts) != 1 || created.EmergencyContacts[0].Name != "Raksha" {
+		t.Errorf("Expected the emergency contact, got %+v", created.EmergencyContacts)
+	}
+
+	update := strings.Replace(validMember, `"section": "cubs"`, `"section": "scouts", "status": "inactive", "joinedOn": "2020-01-01"`, 1)
+	var updated Member
+	if w := openapitest.Do(t, router, "PUT", "/member/1", update, &updated); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if updated.Section != group.SectionScouts || updated.Status != StatusInactive || updated.JoinedOn.String() != "2020-01-01" {
+		t.Errorf("Expected the member to be updated, got %+v", updated)
+	}
+
+	var listed []Member
+	openapitest.Do(t, router, "GET", "/member?section=scouts", "", &listed)
+	if len(listed) != 1 || listed[0].Id != 1 {
+		t.Errorf("Expected the member to be listed in scouts, got %+v", listed)
+	}
+	openapitest.Do(t, router, "GET", "/member?section=cubs", "", &listed)
+	if len(listed) != 0 {
+		t.Errorf("Expected no cubs, got %+v", listed)
+	}
+
+	if w := openapitest.Do(t, router, "DELETE", "/member/1", "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := openapitest.Do(t, router, "GET", "/member/1", "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected the deleted member not to be found, got %d", w.Code)
+	}
+}
+
+func TestUpdateKeepsJoinDate(t *testing.T) {
+	router := newTestRouter(newMockMemberStore().addGroup(testGroupID), testGroupID)
+	openapitest.Do(t, router, "POST", "/member", strings.Replace(validMember, `"section"`, `"joinedOn": "2021-02-03", "section"`, 1), nil)
+
+	var updated Member
+	openapitest.Do(t, router, "PUT", "/member/1", validMember, &updated)
+	if updated.JoinedOn.String() != "2021-02-03" {
+		t.Fatalf("Expected the join date to be kept, got %s", updated.JoinedOn)
+	}
+}
+
+func TestInvalidMembers(t *testing.T) {
+	tomorrow := date.Today(time.UTC).AddDays(1).String()
+	testCases := []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{"no-first-name", strings.Replace(validMember, `"Mowgli"`, `""`, 1), "firstName"},
+		{"unknown-section", strings.Replace(validMember, `"cubs"`, `"wolves"`, 1), "section"},
+		{"no-date-of-birth", strings.Replace(validMember, `"dateOfBirth": "2014-03-01",`, "", 1), "dateOfBirth"},
+		{"contact-without-phone", strings.Replace(validMember, `"phone": "0400 000 000"`, `"phone": ""`, 1), "emergencyContacts[0].phone"},
+		{"born-tomorrow", strings.Replace(validMember, "2014-03-01", tomorrow, 1), ""},
+		{"joined-before-born", strings.Replace(validMember, `"section"`, `"joinedOn": "2013-01-01", "section"`, 1), ""},
+		{"malformed-date", strings.Replace(validMember, "2014-03-01", "01/03/2014", 1), ""},
+	}
+	router := newTestRouter(newMockMemberStore().addGroup(testGroupID), testGroupID)
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp problem.Problem
+			w := openapitest.Do(t, router, "POST", "/member", tt.body, &resp)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+			}
+			if tt.field == "" {
+				return
+			}
+			if len(resp.Errors) != 1 || resp.Errors[0].Field != tt.field {
+				t.Errorf("Expected an error for %s, got %+v", tt.field, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestLinkUser(t *testing.T) {
+	router := newTestRouter(newMockMemberStore().addGroup(testGroupID, 7), testGroupID)
+	linked := strings.Replace(validMember, `"section"`, `"userId": 7, "section"`, 1)
+
+	var member Member
+	if w := openapitest.Do(t, router, "POST", "/member", linked, &member); w.Code != http.StatusCreated || member.UserId == nil || *member.UserId != 7 {
+		t.Fatalf("Expected the member to be linked to user 7, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp problem.Problem
+	if w := openapitest.Do(t, router, "POST", "/member", linked, &resp); w.Code != http.StatusConflict || resp.Code != CodeUserAlreadyLinked {
+		t.Errorf("Expected linking the user twice to conflict, got %d: %+v", w.Code, resp)
+	}
+	missing := strings.Replace(validMember, `"section"`, `"userId": 8, "section"`, 1)
+	if w := openapitest.Do(t, router, "POST", "/member", missing, &resp); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected linking a missing user to fail, got %d: %+v", w.Code, resp)
+	}
+}
+
+func TestMemberNotFound(t *testing.T) {
+	router := newTestRouter(newMockMemberStore().addGroup(testGroupID), testGroupID)
+	for _, path := range []string{"/member/1", "/member/not-an-id"} {
+		var resp problem.Problem
+		if w := openapitest.Do(t, router, "GET", path, "", &resp); w.Code != http.StatusNotFound || resp.Code != problem.CodeNotFound {
+			t.Errorf("Expected %s not to be found, got %d: %+v", path, w.Code, resp)
+		}
+	}
+	if w := openapitest.Do(t, router, "PUT", "/member/1", validMember, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected updating a missing member not to be found, got %d", w.Code)
+	}
+	if w := openapitest.Do(t, router, "DELETE", "/member/1", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected deleting a missing member not to be found, got %d", w.Code)
+	}
+}
+
+func TestMembersAreScopedToGroup(t *testing.T) {
+	store := newMockMemberStore().addGroup(testGroupID, 7).addGroup(otherGroupID, 8)
+	router, other := newTestRouter(store, testGroupID), newTestRouter(store, otherGroupID)
+
+	var member Member
+	if w := openapitest.Do(t, router, "POST", "/member", validMember, &member); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var listed []Member
+	openapitest.Do(t, other, "GET", "/member", "", &listed)
+	if len(listed) != 0 {
+		t.Errorf("Expected another group not to list the member, got %+v", listed)
+	}
+	path := "/member/" + strconv.FormatInt(member.Id, 10)
+	for _, tt := range []struct{ method, body string }{{"GET", ""}, {"PUT", validMember}, {"DELETE", ""}} {
+		if w := openapitest.Do(t, other, tt.method, path, tt.body, nil); w.Code != http.StatusNotFound {
+			t.Errorf("Expected %s from another group not to find the member, got %d: %s", tt.method, w.Code, w.Body.String())
+		}
+	}
+	var unchanged Member
+	if w := openapitest.Do(t, router, "GET", path, "", &unchanged); w.Code != http.StatusOK || unchanged.UpdatedAt != member.UpdatedAt {
+		t.Errorf("Expected the member to be unchanged by another group, got %d: %+v", w.Code, unchanged)
+	}
+
+	// Members can only be linked to users of their own group.
+	linked := strings.Replace(validMember, `"section"`, `"userId": 8, "section"`, 1)
+	var resp problem.Problem
+	if w := openapitest.Do(t, router, "POST", "/member", linked, &resp); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected linking a user of another group to fail, got %d: %+v", w.Code, resp)
+	}
+}
+
+func TestMemberSectionMustExistInGroup(t *testing.T) {
+	store := newMockMemberStore()
+	store.sections[testGroupID] = map[string]bool{group.SectionScouts: true}
+	router := newTestRouter(store, testGroupID)
+
+	var resp problem.Problem
+	if w := openapitest.Do(t, router, "POST", "/member", validMember, &resp); w.Code != http.StatusBadRequest || resp.Code != problem.CodeValidationFailed {
+		t.Errorf("Expected adding a member to a missing section to fail, got %d: %+v", w.Code, resp)
+	}
+}
+
+func TestUpdateKeepsMembershipNumber(t *testing.T) {
+	router := newTestRouter(newMockMemberStore().addGroup(testGroupID), testGroupID)
+	numbered := strings.Replace(validMember, `"section"`, `"membershipNumber": "1001", "section"`, 1)
+	openapitest.Do(t, router, "POST", "/member", numbered, nil)
+
+	var updated Member
+	openapitest.Do(t, router, "PUT", "/member/1", validMember, &updated)
+	if updated.MembershipNumber != "1001" {
+		t.Fatalf("Expected the membership number to be kept, got %q", updated.MembershipNumber)
+	}
+
+	var resp problem.Problem
+	if w := openapitest.Do(t, router, "POST", "/member", numbered, &resp); w.Code != http.StatusConflict || resp.Code != CodeMembershipNumberTaken {
+		t.Errorf("Expected adding a member with a taken membership number to conflict, got %d: %+v", w.Code, resp)
+	}
+}
+
+const roster = `Membership No,First Name,Surname,Date of Birth,Section,Six,Date Joined
+1001,Mowgli,Wolf,01/03/2014,Cub,Red,15/02/2021
+1002,Bagheera,Panther,2013-07-20,cubs,Black,
+1003,Baloo,Bear,20 July 2010,Scouts,,
+`
+
+// postRoster posts a roster to the import endpoint with the query.
+func postRoster(t *testing.T, router http.Handler, query, body string, v interface{}) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/member/import"+query, strings.NewReader(body))
+	r.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("Failed to decode %s: %v", w.Body.String(), err)
+		}
+	}
+	return w
+}
+
+func TestImportRoster(t *testing.T) {
+	store := newMockMemberStore().addGroup(testGroupID)
+	router := newTestRouter(store, testGroupID)
+
+	var result ImportResult
+	if w := postRoster(t, router, "?dryRun=true", roster, &result); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if !result.DryRun || result.Created != 3 || len(store.members) != 0 {
+		t.Fatalf("Expected a dry run to create nothing but report 3 members, got %+v with %d members", result, len(store.members))
+	}
+
+	postRoster(t, router, "", roster, &result)
+	if result.DryRun || result.Created != 3 || result.Skipped != 0 {
+		t.Fatalf("Expected 3 members to be created, got %+v", result)
+	}
+	if row := result.Rows[0]; row.Row != 2 || row.Action != ActionCreated || row.MemberId == nil {
+		t.Errorf("Expected the first row to create a member, got %+v", row)
+	}
+	var mowgli Member
+	openapitest.Do(t, router, "GET", "/member/"+strconv.FormatInt(*result.Rows[0].MemberId, 10), "", &mowgli)
+	if mowgli.MembershipNumber != "1001" || mowgli.Section != group.SectionCubs || mowgli.Patrol != "Red" ||
+		mowgli.DateOfBirth.String() != "2014-03-01" || mowgli.JoinedOn.String() != "2021-02-15" || mowgli.Status != StatusActive {
+		t.Errorf("Expected the member to be imported from the row, got %+v", mowgli)
+	}
+	var baloo Member
+	openapitest.Do(t, router, "GET", "/member/"+strconv.FormatInt(*result.Rows[2].MemberId, 10), "", &baloo)
+	if baloo.JoinedOn != date.Today(time.UTC) {
+		t.Errorf("Expected a member without a join date to join today, got %s", baloo.JoinedOn)
+	}
+
+	postRoster(t, router, "", roster, &result)
+	if result.Unchanged != 3 || result.Created+result.Updated+result.Skipped != 0 || len(store.members) != 3 {
+		t.Fatalf("Expected importing the roster again to change nothing, got %+v", result)
+	}
+
+	// Columns the roster doesn't have are left as they are.
+	moved := "Membership No,First Name,Surname,Date of Birth,Section\n1003,Baloo,Bear,2010-07-20,venturers\n"
+	postRoster(t, router, "", moved, &result)
+	if result.Updated != 1 || result.Rows[0].Action != ActionUpdated {
+		t.Fatalf("Expected the member to be updated, got %+v", result)
+	}
+	openapitest.Do(t, router, "GET", "/member/"+strconv.FormatInt(*result.Rows[0].MemberId, 10), "", &baloo)
+	if baloo.Section != group.SectionVenturers || baloo.JoinedOn != date.Today(time.UTC) || baloo.Status != StatusActive {
+		t.Errorf("Expected only the section to change, got %+v", baloo)
+	}
+}
+
+func TestImportRosterReportsRows(t *testing.T) {
+	store := newMockMemberStore().addGroup(testGroupID)
+	router := newTestRouter(store, testGroupID)
+
+	rows := `Membership No,First Name,Surname,Date of Birth,Section,Status
+1001,Mowgli,Wolf,2014-03-01,cubs,
+1001,Akela,Wolf,1990-01-01,cubs,
+1002,Mowgli,Wolf,2014-03-01,cubs,
+,Kaa,Python,2013-01-01,cubs,
+1004,Hathi,Elephant,yesterday,cubs,
+1005,Chil,Kite,2013-01-01,rovers moot,
+1006,Rikki,Mongoose,2013-01-01,cubs,asleep
+1007,Shere,Khan,2012-01-01,scouts,left
+`
+	var result ImportResult
+	if w := postRoster(t, router, "", rows, &result); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if result.Created != 1 || result.Skipped != 7 || len(store.members) != 1 {
+		t.Fatalf("Expected only the valid row to be imported, got %+v", result)
+	}
+
+	errors := map[int]string{2: FieldMembershipNumber, 3: FieldMembershipNumber, 5: FieldMembershipNumber, 6: FieldDateOfBirth, 7: FieldSection, 8: FieldStatus}
+	for _, row := range result.Rows {
+		if field, ok := errors[row.Row]; ok {
+			if row.Action != ActionSkipped || len(row.Errors) == 0 || row.Errors[0].Field != field {
+				t.Errorf("Expected row %d to be skipped for its %s, got %+v", row.Row, field, row)
+			}
+		}
+	}
+	if row := result.Rows[2]; row.Action != ActionSkipped || len(row.Errors) != 1 || row.Errors[0].Message != "a member with the same name and date of birth is also on row 2" {
+		t.Errorf("Expected row 4 to be reported as a duplicate of row 2, got %+v", row)
+	}
+	if row := result.Rows[7]; row.Action != ActionCreated {
+		t.Errorf("Expected row 9 to be created, got %+v", row)
+	}
+}
+
+func TestImportRosterMatchesByName(t *testing.T) {
+	store := newMockMemberStore().addGroup(testGroupID)
+	router := newTestRouter(store, testGroupID)
+	var added Member
+	openapitest.Do(t, router, "POST", "/member", validMember, &added)
+
+	var result ImportResult
+	postRoster(t, router, "", roster, &result)
+	if result.Created != 2 || result.Updated != 1 || *result.Rows[0].MemberId != added.Id {
+		t.Fatalf("Expected the member added by hand to be updated, got %+v", result)
+	}
+	var updated Member
+	openapitest.Do(t, router, "GET", "/member/"+strconv.FormatInt(added.Id, 10), "", &updated)
+	if updated.MembershipNumber != "1001" || updated.Patrol != "Red" || len(updated.EmergencyContacts) != 1 {
+		t.Errorf("Expected the membership number and patrol to be set and the rest kept, got %+v", updated)
+	}
+
+	// A member with the same name and date of birth but another membership
+	// number isn't the same member, but probably a mistake.
+	renumbered := strings.Replace(roster, "1001,", "2001,", 1)
+	postRoster(t, router, "", renumbered, &result)
+	if row := result.Rows[0]; row.Action != ActionSkipped || row.Errors[0].Field != FieldMembershipNumber {
+		t.Errorf("Expected the renumbered row to be skipped, got %+v", row)
+	}
+}
+
+func TestImportRosterIsScopedToGroup(t *testing.T) {
+	store := newMockMemberStore().addGroup(testGroupID).addGroup(otherGroupID)
+	router, other := newTestRouter(store, testGroupID), newTestRouter(store, otherGroupID)
+
+	var result ImportResult
+	postRoster(t, router, "", roster, &result)
+	postRoster(t, other, "", roster, &result)
+	if result.Created != 3 || len(store.members) != 6 {
+		t.Fatalf("Expected the other group to get its own members, got %+v", result)
+	}
+	var listed []Member
+	openapitest.Do(t, router, "GET", "/member", "", &listed)
+	if len(listed) != 3 {
+		t.Errorf("Expected 3 members in the group, got %+v", listed)
+	}
+}
+
+func TestImportRosterMapping(t *testing.T) {
+	router := newTestRouter(newMockMemberStore().addGroup(testGroupID), testGroupID)
+	renamed := strings.Replace(roster, "Membership No", "Reg", 1)
+
+	var resp problem.Problem
+	if w := postRoster(t, router, "", renamed, &resp); w.Code != http.StatusBadRequest || len(resp.Errors) != 1 || resp.Errors[0].Field != FieldMembershipNumber {
+		t.Fatalf("Expected the unmapped column to be reported, got %d: %+v", w.Code, resp)
+	}
+	var result ImportResult
+	if w := postRoster(t, router, "?column=membershipNumber%3DReg", renamed, &result); w.Code != http.StatusOK || result.Created != 3 {
+		t.Fatalf("Expected the mapped column to be imported, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := postRoster(t, router, "?column=membershipNumber", renamed, &resp); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid mapping to be rejected, got %d", w.Code)
+	}
+	if w := postRoster(t, router, "?dryRun=maybe", roster, &resp); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid dryRun to be rejected, got %d", w.Code)
+	}
+	if w := postRoster(t, router, "", strings.Repeat("x", maxRosterSize+1), &resp); w.Code != http.StatusRequestEntityTooLarge || resp.Code != CodeRosterTooLarge {
+		t.Errorf("Expected a large roster to be rejected, got %d: %+v", w.Code, resp)
+	}
+}
@@ -0,0 +1,17 @@
+package member
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	membersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "autocrat_members_created_total",
+		Help: "Number of members created.",
+	})
+	membersImported = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "autocrat_members_imported_total",
+		Help: "Number of roster rows imported, by whether the member was created, updated, unchanged or skipped.",
+	}, []string{"action"})
+)
@@ -0,0 +1,101 @@
+package member
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nick96/cubapi/date"
+)
+
+// Statuses of a member.
+const (
+	// StatusActive members are currently attending.
+	StatusActive = "active"
+	// StatusInactive members are still members but aren't attending, e.g.
+	// they're taking a break for a term.
+	StatusInactive = "inactive"
+	// StatusLeft members have left the group. They're kept for their
+	// records.
+	StatusLeft = "left"
+)
+
+// Statuses are the statuses a member can have.
+var Statuses = []string{StatusActive, StatusInactive, StatusLeft}
+
+// Member is a youth member of a group. Members are distinct from users, who
+// can sign in, but a member can be linked to a user of the same group, e.g.
+// an older scout who records their own progress.
+type Member struct {
+	Id int64 `json:"id" db:"id"`
+	// GroupId is the ID of the group the member belongs to. It's implied by
+	// the caller's group so it isn't exposed.
+	GroupId     int64     `json:"-" db:"group_id"`
+	FirstName   string    `json:"firstName" db:"firstname"`
+	LastName    string    `json:"lastName" db:"lastname"`
+	DateOfBirth date.Date `json:"dateOfBirth" db:"date_of_birth"`
+	// Section is the kind of section of the member's group the member
+	// belongs to, one of group.Sections.
+	Section string `json:"section" db:"section"`
+	// Patrol is the patrol, six or other small group within the section
+	// the member belongs to, if any.
+	Patrol            string            `json:"patrol" db:"patrol"`
+	JoinedOn          date.Date         `json:"joinedOn" db:"joined_on"`
+	Status            string            `json:"status" db:"status"`
+	EmergencyContacts EmergencyContacts `json:"emergencyContacts" db:"emergency_contacts"`
+	// SectionSince and StatusSince are when the member moved to their
+	// section and changed to their status. They're kept by the store so
+	// members are only expected at meetings they could have attended.
+	SectionSince date.Date `json:"-" db:"section_since"`
+	StatusSince  date.Date `json:"-" db:"status_since"`
+	// MembershipNumber is the member's number in the national membership
+	// system, if known. It's unique in the group and identifies the member
+	// when rosters are imported.
+	MembershipNumber string `json:"membershipNumber" db:"membership_number"`
+	// UserId is the ID of the user linked to the member, if any.
+	UserId    *int64    `json:"userId" db:"user_id"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// EmergencyContact is someone to contact if something happens to a member.
+type EmergencyContact struct {
+	Name         string `json:"name" validate:"required,max=256"`
+	Relationship string `json:"relationship" validate:"required,max=64"`
+	Phone        string `json:"phone" validate:"required,max=32"`
+	Email        string `json:"email,omitempty" validate:"omitempty,email"`
+}
+
+// EmergencyContacts are a member's emergency contacts in the order they should
+// be contacted. They are stored as a JSONB column.
+type EmergencyContacts []EmergencyContact
+
+// Scan scans a JSONB column.
+func (c *EmergencyContacts) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		*c = EmergencyContacts{}
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into emergency contacts", src)
+	}
+	return json.Unmarshal(data, c)
+}
+
+// Value stores the contacts in a JSONB column.
+func (c EmergencyContacts) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,108 @@
+package member
+
+import (
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/user"
+)
+
+// DescribeMemberRouter describes the operations of NewMemberRouter.
+func DescribeMemberRouter(r *openapi.Router) {
+	id := openapi.PathParam("memberID", "The ID of the member.", openapi.Integer())
+	denied := map[string]*openapi.Response{
+		"403": r.Problem("The request isn't authenticated, the user isn't a leader or admin, or the CSRF token is missing."),
+		"429": r.Problem("The client has made too many requests."),
+		"500": r.Problem("The request couldn't be completed."),
+	}
+	responses := func(responses map[string]*openapi.Response) map[string]*openapi.Response {
+		for status, response := range denied {
+			responses[status] = response
+		}
+		return responses
+	}
+
+	r.Get("/", &openapi.Operation{
+		OperationID: "listMembers",
+		Summary:     "List members",
+		Tags:        []string{"member"},
+		Security:    user.Authenticated,
+		Parameters: []openapi.Parameter{
+			{Name: "section", In: "query", Description: "Only list members of the section.", Schema: openapi.Enum(group.Sections)},
+			{Name: "status", In: "query", Description: "Only list members with the status.", Schema: openapi.Enum(Statuses)},
+		},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The members ordered by name.", []Member{}),
+		}),
+	})
+	r.Post("/", &openapi.Operation{
+		OperationID: "createMember",
+		Summary:     "Add a member",
+		Tags:        []string{"member"},
+		Security:    user.Authenticated,
+		RequestBody: r.JSONBody(MemberRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"201": r.JSON("The added member.", MemberResponse{}),
+			"400": r.Problem("The request body is invalid, the group doesn't have the section, or the linked user doesn't exist in the group."),
+			"409": r.Problem("The linked user is already linked to another member, or another member of the group has the membership number."),
+		}),
+	})
+	r.Get("/{memberID}", &openapi.Operation{
+		OperationID: "getMember",
+		Summary:     "Get a member",
+		Tags:        []string{"member"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{id},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The member.", MemberResponse{}),
+			"404": r.Problem("The member doesn't exist in the group."),
+		}),
+	})
+	r.Put("/{memberID}", &openapi.Operation{
+		OperationID: "updateMember",
+		Summary:     "Replace the details of a member",
+		Tags:        []string{"member"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{id},
+		RequestBody: r.JSONBody(MemberRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The updated member.", MemberResponse{}),
+			"400": r.Problem("The request body is invalid, the group doesn't have the section, or the linked user doesn't exist in the group."),
+			"404": r.Problem("The member doesn't exist in the group."),
+			"409": r.Problem("The linked user is already linked to another member, or another member of the group has the membership number."),
+		}),
+	})
+	r.Delete("/{memberID}", &openapi.Operation{
+		OperationID: "deleteMember",
+		Summary:     "Delete a member",
+		Description: "Members who have left should usually be given the left status instead so their records are kept.",
+		Tags:        []string{"member"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{id},
+		Responses: responses(map[string]*openapi.Response{
+			"204": openapi.Empty("The member has been deleted."),
+			"404": r.Problem("The member doesn't exist in the group."),
+		}),
+	})
+	roster := openapi.MediaType{Schema: &openapi.Schema{Type: "string", Format: "binary"}}
+	r.Post("/import", &openapi.Operation{
+		OperationID: "importRoster",
+		Summary:     "Import a roster",
+		Description: "The body is a roster in CSV or XLSX, such as an export of the national membership system, whose first row is the headers of its columns. " +
+			"Rows are matched to members by membership number, or by name and date of birth for members without one, and only the fields with columns are changed. " +
+			"Rows with errors are skipped and the rest are imported, so importing a roster again changes nothing.",
+		Tags:     []string{"member"},
+		Security: user.Authenticated,
+		Parameters: []openapi.Parameter{
+			{Name: "dryRun", In: "query", Description: "Report what would be imported without importing it if true.", Schema: &openapi.Schema{Type: "boolean"}},
+			{Name: "column", In: "query", Description: "Map a field to the header of its column, formatted as field=header, for columns whose headers aren't recognised. Can be repeated.", Schema: openapi.String()},
+			{Name: "sheet", In: "query", Description: "The sheet of a workbook to import, the first if not given.", Schema: openapi.String()},
+		},
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{"text/csv": roster, xlsxContentType: roster}},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("What was imported, or would be by a dry run, from each row.", ImportResult{}),
+			"400": r.Problem("The roster can't be read, its columns can't be mapped to fields, or it has too many rows."),
+			"409": r.Problem("Another import added a member with one of the membership numbers in the meantime."),
+			"413": r.Problem("The roster is too large."),
+		}),
+	})
+}
@@ -0,0 +1,47 @@
+package member
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/openapi/openapitest"
+	"go.uber.org/zap"
+)
+
+// TestOpenAPIContract checks that the handlers behave as the OpenAPI document
+// says they do. If this fails either the handlers or DescribeMemberRouter
+// need updating.
+func TestOpenAPIContract(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(inGroup(testGroupID))
+	router.Route("/member", NewMemberRouter(zap.NewNop(), NewMemberService(newMockMemberStore().addGroup(testGroupID, 7), time.UTC)))
+
+	doc := openapi.New("autocrat", "test")
+	doc.Route("/member", DescribeMemberRouter)
+	if err := doc.CheckRoutes(router); err != nil {
+		t.Fatal(err)
+	}
+
+	linked := strings.Replace(validMember, `"section"`, `"userId": 7, "section"`, 1)
+	openapitest.Run(t, doc, router, []openapitest.Case{
+		{Name: "create", Method: "POST", Pattern: "/member", Body: linked, Status: http.StatusCreated},
+		{Name: "create-invalid", Method: "POST", Pattern: "/member", Body: `{"firstName":""}`, Invalid: true, Status: http.StatusBadRequest},
+		{Name: "create-already-linked", Method: "POST", Pattern: "/member", Body: linked, Status: http.StatusConflict},
+		{Name: "list", Method: "GET", Pattern: "/member", Path: "/member?section=cubs", Status: http.StatusOK},
+		{Name: "get", Method: "GET", Pattern: "/member/{memberID}", Path: "/member/1", Status: http.StatusOK},
+		{Name: "get-missing", Method: "GET", Pattern: "/member/{memberID}", Path: "/member/2", Status: http.StatusNotFound},
+		{Name: "update", Method: "PUT", Pattern: "/member/{memberID}", Path: "/member/1", Body: validMember, Status: http.StatusOK},
+		{Name: "update-missing", Method: "PUT", Pattern: "/member/{memberID}", Path: "/member/2", Body: validMember, Status: http.StatusNotFound},
+		{Name: "delete", Method: "DELETE", Pattern: "/member/{memberID}", Path: "/member/1", Status: http.StatusNoContent},
+		{Name: "delete-missing", Method: "DELETE", Pattern: "/member/{memberID}", Path: "/member/1", Status: http.StatusNotFound},
+		{Name: "import", Method: "POST", Pattern: "/member/import", Path: "/member/import?dryRun=true", ContentType: "text/csv", Body: roster, Status: http.StatusOK},
+		{Name: "import-mapped", Method: "POST", Pattern: "/member/import", Path: "/member/import?column=section%3DUnit", ContentType: "text/csv", Body: strings.Replace(roster, "Section", "Unit", 1), Status: http.StatusOK},
+		{Name: "import-unmapped", Method: "POST", Pattern: "/member/import", ContentType: "text/csv", Body: strings.Replace(roster, "Section", "Unit", 1), Status: http.StatusBadRequest},
+		{Name: "import-invalid", Method: "POST", Pattern: "/member/import", ContentType: xlsxContentType, Body: "not a workbook", Status: http.StatusBadRequest},
+		{Name: "import-too-large", Method: "POST", Pattern: "/member/import", ContentType: "text/csv", Body: strings.Repeat("x", maxRosterSize+1), Status: http.StatusRequestEntityTooLarge},
+	})
+}
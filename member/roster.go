@@ -0,0 +1,438 @@
+package member
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/problem"
+)
+
+// Formats rosters are imported in.
+const (
+	RosterCSV  = "csv"
+	RosterXLSX = "xlsx"
+)
+
+// Fields of members a roster's columns are mapped to.
+const (
+	FieldMembershipNumber = "membershipNumber"
+	FieldFirstName        = "firstName"
+	FieldLastName         = "lastName"
+	FieldDateOfBirth      = "dateOfBirth"
+	FieldSection          = "section"
+	FieldPatrol           = "patrol"
+	FieldJoinedOn         = "joinedOn"
+	FieldStatus           = "status"
+)
+
+// RosterFields are the fields a roster's columns can be mapped to.
+var RosterFields = []string{
+	FieldMembershipNumber, FieldFirstName, FieldLastName, FieldDateOfBirth,
+	FieldSection, FieldPatrol, FieldJoinedOn, FieldStatus,
+}
+
+// requiredFields are the fields every roster must have a column for. The
+// others are left as they are for existing members and defaulted for new
+// ones.
+var requiredFields = []string{FieldMembershipNumber, FieldFirstName, FieldLastName, FieldDateOfBirth, FieldSection}
+
+// rosterHeaders are the headers, normalised, columns are mapped to fields by
+// when they aren't mapped explicitly. They cover the names used by common
+// membership system exports.
+var rosterHeaders = map[string][]string{
+	FieldMembershipNumber: {"membershipnumber", "membershipno", "membernumber", "memberno", "membershipid", "memberid", "registrationnumber", "regno"},
+	FieldFirstName:        {"firstname", "givenname", "forename"},
+	FieldLastName:         {"lastname", "surname", "familyname"},
+	FieldDateOfBirth:      {"dateofbirth", "dob", "birthdate", "birthday"},
+	FieldSection:          {"section"},
+	FieldPatrol:           {"patrol", "six", "lodge"},
+	FieldJoinedOn:         {"joinedon", "joined", "joindate", "datejoined", "startdate"},
+	FieldStatus:           {"status"},
+}
+
+// xlsxContentType is the content type of XLSX workbooks.
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// RosterFormat returns the format of a roster with the content type, or
+// sniffs it from the data if the content type isn't a roster's. XLSX
+// workbooks are zip archives and anything else is read as CSV.
+func RosterFormat(contentType string, data []byte) string {
+	switch strings.TrimSpace(strings.Split(contentType, ";")[0]) {
+	case xlsxContentType:
+		return RosterXLSX
+	case "text/csv":
+		return RosterCSV
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return RosterXLSX
+	}
+	return RosterCSV
+}
+
+// ParseColumnMapping parses mappings of fields to the headers of their
+// columns formatted as field=header.
+func ParseColumnMapping(mappings []string) (map[string]string, error) {
+	mapping := make(map[string]string, len(mappings))
+	for _, m := range mappings {
+		parts := strings.SplitN(m, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("column mapping %q must be formatted as field=header", m)
+		}
+		mapping[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return mapping, nil
+}
+
+// maxRosterRows is the most members a roster can have, far more than any
+// group.
+const maxRosterRows = 2000
+
+// Roster is a parsed roster: the values of the fields of each of its rows.
+type Roster struct {
+	// Fields are the fields the roster has columns for.
+	Fields []string
+	Rows   []RosterRow
+}
+
+// Has reports whether the roster has a column for the field.
+func (r Roster) Has(field string) bool {
+	for _, f := range r.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// RosterRow is a row of a roster with the value of each field, trimmed.
+type RosterRow struct {
+	// Row is the number of the row in the file, counting from 1, which is
+	// the header unless there are blank rows before it.
+	Row    int
+	Values map[string]string
+}
+
+// Actions an import takes with a row of a roster.
+const (
+	ActionCreated   = "created"
+	ActionUpdated   = "updated"
+	ActionUnchanged = "unchanged"
+	// ActionSkipped rows have errors so nothing was done with them.
+	ActionSkipped = "skipped"
+)
+
+// RowError is something wrong with a row of a roster.
+type RowError struct {
+	// Field is the field whose value is wrong, if it's about one field.
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// RowResult is what an import did, or would do, with a row of a roster.
+type RowResult struct {
+	Row              int    `json:"row"`
+	MembershipNumber string `json:"membershipNumber"`
+	// Action is one of created, updated, unchanged or skipped.
+	Action string `json:"action"`
+	// MemberId is the ID of the member the row is, unless it's skipped or
+	// would be created by a dry run.
+	MemberId *int64     `json:"memberId,omitempty"`
+	Errors   []RowError `json:"errors,omitempty"`
+}
+
+// ImportResult is what an import of a roster did, or would do if it's a dry
+// run, with each of its rows.
+type ImportResult struct {
+	DryRun    bool        `json:"dryRun"`
+	Created   int         `json:"created"`
+	Updated   int         `json:"updated"`
+	Unchanged int         `json:"unchanged"`
+	Skipped   int         `json:"skipped"`
+	Rows      []RowResult `json:"rows"`
+}
+
+// ParseRoster parses a roster in the given format, reading the named sheet of
+// XLSX workbooks or the first if it's empty. The first non-blank row is the
+// header. Columns are mapped to fields by the mapping, from field to header,
+// and the rest by their headers. Only problems with the roster as a whole are
+// returned, problems with its rows are found by the import.
+func ParseRoster(data []byte, format, sheet string, mapping map[string]string) (Roster, *problem.Problem) {
+	var rows []sheetRow
+	var err error
+	switch format {
+	case RosterXLSX:
+		rows, err = readXLSX(data, sheet)
+	default:
+		rows, err = readCSV(data)
+	}
+	if err != nil {
+		return Roster{}, problem.New(problem.CodeMalformedRequest, fmt.Sprintf("Roster can't be read: %v", err))
+	}
+	for len(rows) > 0 && blank(rows[0].cells) {
+		rows = rows[1:]
+	}
+	if len(rows) == 0 {
+		return Roster{}, problem.New(problem.CodeValidationFailed, "Roster is empty")
+	}
+
+	columns, p := mapColumns(rows[0].cells, mapping)
+	if p != nil {
+		return Roster{}, p
+	}
+	roster := Roster{Rows: []RosterRow{}}
+	for _, field := range RosterFields {
+		if _, ok := columns[field]; ok {
+			roster.Fields = append(roster.Fields, field)
+		}
+	}
+	for _, row := range rows[1:] {
+		if blank(row.cells) {
+			continue
+		}
+		values := make(map[string]string, len(columns))
+		for field, column := range columns {
+			if column < len(row.cells) {
+				values[field] = strings.TrimSpace(row.cells[column])
+			} else {
+				values[field] = ""
+			}
+		}
+		roster.Rows = append(roster.Rows, RosterRow{Row: row.number, Values: values})
+	}
+	if len(roster.Rows) > maxRosterRows {
+		return Roster{}, problem.New(problem.CodeValidationFailed, fmt.Sprintf("Rosters can have at most %d members", maxRosterRows))
+	}
+	return roster, nil
+}
+
+// mapColumns finds the column of each field in the header.
+func mapColumns(header []string, mapping map[string]string) (map[string]int, *problem.Problem) {
+	headers := make(map[string]int, len(header))
+	for i, h := range header {
+		if h := normaliseHeader(h); h != "" {
+			if _, ok := headers[h]; !ok {
+				headers[h] = i
+			}
+		}
+	}
+	columns := make(map[string]int)
+	var errs []problem.FieldError
+	fields := make([]string, 0, len(mapping))
+	for field := range mapping {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if _, ok := rosterHeaders[field]; !ok {
+			errs = append(errs, problem.FieldError{Field: field, Tag: "oneof", Message: "must be one of " + strings.Join(RosterFields, ", ")})
+			continue
+		}
+		column, ok := headers[normaliseHeader(mapping[field])]
+		if !ok {
+			errs = append(errs, problem.FieldError{Field: field, Tag: "column", Message: fmt.Sprintf("the roster has no %q column", mapping[field])})
+			continue
+		}
+		columns[field] = column
+	}
+	// Columns mapped explicitly aren't also mapped to other fields by their
+	// headers.
+	mapped := make(map[int]bool, len(columns))
+	for _, column := range columns {
+		mapped[column] = true
+	}
+	for _, field := range RosterFields {
+		if _, ok := mapping[field]; ok {
+			continue
+		}
+		for _, h := range rosterHeaders[field] {
+			if column, ok := headers[h]; ok && !mapped[column] {
+				columns[field] = column
+				break
+			}
+		}
+	}
+	for _, field := range requiredFields {
+		if _, ok := columns[field]; !ok && mapping[field] == "" {
+			errs = append(errs, problem.FieldError{Field: field, Tag: "required", Message: "no column is mapped to the field"})
+		}
+	}
+	if len(errs) > 0 {
+		p := problem.New(problem.CodeValidationFailed, "Roster columns can't be mapped to members")
+		p.Errors = errs
+		return nil, p
+	}
+	return columns, nil
+}
+
+// normaliseHeader lower cases a header and drops everything but letters and
+// digits, so "Date of Birth" and "date_of_birth" are the same.
+func normaliseHeader(header string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, header)
+}
+
+// blank reports whether every cell of a row is empty.
+func blank(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// readCSV reads the rows of a CSV file. Rows can have different numbers of
+// cells and a leading byte order mark, as spreadsheets write, is ignored.
+// Rows are numbered by record, as spreadsheets number them, so empty lines
+// and line breaks in quoted cells aren't counted.
+func readCSV(data []byte) ([]sheetRow, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	var rows []sheetRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+		rows = append(rows, sheetRow{len(rows) + 1, record})
+	}
+}
+
+// rosterDateLayouts are the layouts dates in rosters can have. Days come
+// before months as in Australia.
+var rosterDateLayouts = []string{"2006-01-02", "2/1/2006", "2-1-2006", "2.1.2006", "2 Jan 2006", "2 January 2006"}
+
+// excelEpoch is the day spreadsheet serial dates count from, allowing for
+// Excel treating 1900 as a leap year.
+var excelEpoch = date.Of(time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC))
+
+// parseRosterDate parses a date from a roster, either formatted or as the
+// serial number spreadsheets store dates as.
+func parseRosterDate(value string) (date.Date, error) {
+	for _, layout := range rosterDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return date.Of(t), nil
+		}
+	}
+	// Serial dates are whole days, which are only right from 61 (1900-03-01)
+	// on, up to 9999-12-31.
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial >= 61 && serial <= 2958465 && serial == math.Trunc(serial) {
+		return excelEpoch.AddDays(int(serial)), nil
+	}
+	return date.Date{}, fmt.Errorf("%q is not a date formatted as YYYY-MM-DD or DD/MM/YYYY", value)
+}
+
+// parseRosterRow parses and checks the values of a row of a roster. Optional
+// fields whose values are empty are left zero, as are fields the roster has no
+// column for.
+func parseRosterRow(row RosterRow, sections map[string]bool, today date.Date) (Member, []RowError) {
+	var member Member
+	var errs []RowError
+	fail := func(field, message string) {
+		errs = append(errs, RowError{Field: field, Message: message})
+	}
+	text := func(field string, max int) string {
+		value := row.Values[field]
+		if len(value) > max {
+			fail(field, fmt.Sprintf("must be at most %d characters", max))
+		}
+		return value
+	}
+	required := func(field string, max int) string {
+		value := text(field, max)
+		if value == "" {
+			fail(field, "is required")
+		}
+		return value
+	}
+
+	member.MembershipNumber = required(FieldMembershipNumber, 64)
+	member.FirstName = required(FieldFirstName, 256)
+	member.LastName = required(FieldLastName, 256)
+	if value := required(FieldDateOfBirth, 64); value != "" {
+		if dob, err := parseRosterDate(value); err != nil {
+			fail(FieldDateOfBirth, err.Error())
+		} else if dob.After(today) {
+			fail(FieldDateOfBirth, "must not be in the future")
+		} else {
+			member.DateOfBirth = dob
+		}
+	}
+	if value := required(FieldSection, 64); value != "" {
+		section := strings.ToLower(value)
+		if !sections[section] && sections[section+"s"] {
+			section += "s"
+		}
+		if sections[section] {
+			member.Section = section
+		} else {
+			fail(FieldSection, fmt.Sprintf("the group does not have the section %q", value))
+		}
+	}
+	member.Patrol = text(FieldPatrol, 256)
+	if value := row.Values[FieldJoinedOn]; value != "" {
+		if joinedOn, err := parseRosterDate(value); err != nil {
+			fail(FieldJoinedOn, err.Error())
+		} else {
+			member.JoinedOn = joinedOn
+		}
+	}
+	if value := strings.ToLower(row.Values[FieldStatus]); value != "" {
+		member.Status = value
+		valid := false
+		for _, status := range Statuses {
+			valid = valid || status == value
+		}
+		if !valid {
+			fail(FieldStatus, "must be one of "+strings.Join(Statuses, ", "))
+		}
+	}
+	return member, errs
+}
+
+// nameKey identifies members by their name and date of birth, which is how
+// rows are matched to members added before membership numbers were known.
+func nameKey(member Member) string {
+	return strings.ToLower(member.FirstName) + "\x00" + strings.ToLower(member.LastName) + "\x00" + member.DateOfBirth.String()
+}
+
+// sameDetails reports whether the members have the same details a roster
+// can set.
+func sameDetails(a, b Member) bool {
+	return a.MembershipNumber == b.MembershipNumber &&
+		a.FirstName == b.FirstName &&
+		a.LastName == b.LastName &&
+		a.DateOfBirth == b.DateOfBirth &&
+		a.Section == b.Section &&
+		a.Patrol == b.Patrol &&
+		a.JoinedOn == b.JoinedOn &&
+		a.Status == b.Status
+}
+
+// rowList lists row numbers for people, e.g. "row 3" or "rows 3 and 7".
+func rowList(rows []int) string {
+	numbers := make([]string, len(rows))
+	for i, row := range rows {
+		numbers[i] = strconv.Itoa(row)
+	}
+	if len(numbers) == 1 {
+		return "row " + numbers[0]
+	}
+	return "rows " + strings.Join(numbers[:len(numbers)-1], ", ") + " and " + numbers[len(numbers)-1]
+}
@@ -0,0 +1,180 @@
+package member
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/nick96/cubapi/problem"
+)
+
+// newWorkbook creates an XLSX workbook with a sheet named Roster, whose cells
+// are the given XML, after a sheet named Notes.
+func newWorkbook(t *testing.T, sheetData string, shared ...string) []byte {
+	var strings bytes.Buffer
+	for _, s := range shared {
+		strings.WriteString("<si><t>" + s + "</t></si>")
+	}
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+			<sheets><sheet name="Notes" sheetId="1" r:id="rId1"/><sheet name="Roster" sheetId="2" r:id="rId2"/></sheets>
+		</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId1" Type="worksheet" Target="worksheets/sheet1.xml"/>
+			<Relationship Id="rId2" Type="worksheet" Target="/xl/worksheets/sheet2.xml"/>
+		</Relationships>`,
+		"xl/sharedStrings.xml":     `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` + strings.String() + `</sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData/></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + sheetData + `</sheetData></worksheet>`,
+	}
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range parts {
+		f, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseRosterCSV(t *testing.T) {
+	data := "\xef\xbb\xbf\n" +
+		"Member No, Given Name,Family Name,DOB,Section,Notes\n" +
+		"1001,Mowgli,Wolf,01/03/2014,cubs,\"likes \"\"jungle\"\" games\"\n" +
+		",,,,\n" +
+		"1002, Bagheera ,Panther,2013-07-20,cubs\n"
+	roster, p := ParseRoster([]byte(data), RosterCSV, "", nil)
+	if p != nil {
+		t.Fatalf("Failed to parse roster: %v", p)
+	}
+	if len(roster.Fields) != 5 || roster.Has(FieldPatrol) {
+		t.Errorf("Expected the required fields, got %v", roster.Fields)
+	}
+	if len(roster.Rows) != 2 {
+		t.Fatalf("Expected blank rows to be skipped, got %+v", roster.Rows)
+	}
+	if row := roster.Rows[0]; row.Row != 2 || row.Values[FieldMembershipNumber] != "1001" || row.Values[FieldDateOfBirth] != "01/03/2014" {
+		t.Errorf("Expected the first member on row 2, got %+v", row)
+	}
+	if row := roster.Rows[1]; row.Row != 4 || row.Values[FieldFirstName] != "Bagheera" || row.Values[FieldSection] != "cubs" {
+		t.Errorf("Expected short rows to be read and values trimmed, got %+v", row)
+	}
+}
+
+func TestParseRosterXLSX(t *testing.T) {
+	// The date of birth is a serial date and the patrol is inline text. Row 3
+	// is left out, as spreadsheets do for empty rows, and B4 is empty.
+	sheet := `
+		<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c><c r="D1" t="s"><v>3</v></c><c r="E1" t="s"><v>4</v></c><c r="F1" t="s"><v>5</v></c></row>
+		<row r="2"><c r="A2"><v>1001</v></c><c r="B2" t="s"><v>6</v></c><c r="C2" t="s"><v>7</v></c><c r="D2"><v>41699</v></c><c r="E2" t="s"><v>8</v></c><c r="F2" t="inlineStr"><is><t>Red</t></is></c></row>
+		<row r="4"><c r="A4"><v>1002</v></c><c r="C4" t="s"><v>7</v></c></row>`
+	data := newWorkbook(t, sheet, "Membership Number", "First Name", "Last Name", "Date of Birth", "Section", "Six", "Mowgli", "Wolf", "cubs")
+
+	if _, p := ParseRoster(data, RosterXLSX, "", nil); p == nil {
+		t.Error("Expected the empty first sheet to have no header")
+	}
+	roster, p := ParseRoster(data, RosterXLSX, "Roster", nil)
+	if p != nil {
+		t.Fatalf("Failed to parse roster: %v", p)
+	}
+	if len(roster.Rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %+v", roster.Rows)
+	}
+	first := roster.Rows[0].Values
+	if first[FieldMembershipNumber] != "1001" || first[FieldFirstName] != "Mowgli" || first[FieldPatrol] != "Red" {
+		t.Errorf("Expected the cells of the first row, got %+v", first)
+	}
+	if dob, err := parseRosterDate(first[FieldDateOfBirth]); err != nil || dob.String() != "2014-03-01" {
+		t.Errorf("Expected the serial date to be 2014-03-01, got %s: %v", dob, err)
+	}
+	if row := roster.Rows[1]; row.Row != 4 || row.Values[FieldFirstName] != "" || row.Values[FieldLastName] != "Wolf" {
+		t.Errorf("Expected cells to be positioned by reference, got %+v", row)
+	}
+
+	if _, p := ParseRoster(data, RosterXLSX, "Missing", nil); p == nil || p.Code != problem.CodeMalformedRequest {
+		t.Errorf("Expected a missing sheet to be malformed, got %v", p)
+	}
+	if _, p := ParseRoster([]byte("not a workbook"), RosterXLSX, "", nil); p == nil || p.Code != problem.CodeMalformedRequest {
+		t.Errorf("Expected an invalid workbook to be malformed, got %v", p)
+	}
+}
+
+func TestParseRosterMapping(t *testing.T) {
+	data := []byte("ID,Name,Surname,Born,Unit,Six\n1001,Mowgli,Wolf,2014-03-01,cubs,Red\n")
+
+	_, p := ParseRoster(data, RosterCSV, "", nil)
+	if p == nil || len(p.Errors) != 4 {
+		t.Fatalf("Expected the 4 unrecognised required columns to be reported, got %+v", p)
+	}
+
+	mapping := map[string]string{
+		FieldMembershipNumber: "id",
+		FieldFirstName:        "Name",
+		FieldDateOfBirth:      "Born",
+		FieldSection:          "Unit",
+		FieldPatrol:           "Surname",
+	}
+	roster, p := ParseRoster(data, RosterCSV, "", mapping)
+	if p == nil || len(p.Errors) != 1 || p.Errors[0].Field != FieldLastName {
+		t.Fatalf("Expected the last name mapped elsewhere to be missing, got %+v", p)
+	}
+	delete(mapping, FieldPatrol)
+	if roster, p = ParseRoster(data, RosterCSV, "", mapping); p != nil {
+		t.Fatalf("Failed to parse roster: %+v", p)
+	}
+	if values := roster.Rows[0].Values; values[FieldMembershipNumber] != "1001" || values[FieldFirstName] != "Mowgli" || values[FieldPatrol] != "Red" {
+		t.Errorf("Expected the mapped columns, got %+v", values)
+	}
+
+	mapping["nickname"] = "Name"
+	mapping[FieldStatus] = "State"
+	if _, p := ParseRoster(data, RosterCSV, "", mapping); p == nil || len(p.Errors) != 2 {
+		t.Errorf("Expected the unknown field and missing column to be reported, got %+v", p)
+	}
+}
+
+func TestParseRosterDate(t *testing.T) {
+	for value, expected := range map[string]string{
+		"2014-03-01":   "2014-03-01",
+		"1/3/2014":     "2014-03-01",
+		"01-03-2014":   "2014-03-01",
+		"1 Mar 2014":   "2014-03-01",
+		"1 March 2014": "2014-03-01",
+		"41699":        "2014-03-01",
+		"61":           "1900-03-01",
+	} {
+		if d, err := parseRosterDate(value); err != nil || d.String() != expected {
+			t.Errorf("Expected %q to be %s, got %s: %v", value, expected, d, err)
+		}
+	}
+	for _, value := range []string{"", "yesterday", "3/31/2014", "41699.5", "1"} {
+		if _, err := parseRosterDate(value); err == nil {
+			t.Errorf("Expected %q not to be a date", value)
+		}
+	}
+}
+
+func TestRosterFormat(t *testing.T) {
+	workbook := []byte("PK\x03\x04rest of the archive")
+	for _, tt := range []struct {
+		contentType string
+		data        []byte
+		expected    string
+	}{
+		{xlsxContentType, nil, RosterXLSX},
+		{"text/csv; charset=utf-8", workbook, RosterCSV},
+		{"application/octet-stream", workbook, RosterXLSX},
+		{"", []byte("a,b\n"), RosterCSV},
+	} {
+		if format := RosterFormat(tt.contentType, tt.data); format != tt.expected {
+			t.Errorf("Expected %q to be %s, got %s", tt.contentType, tt.expected, format)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package member
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/nick96/cubapi/db"
+)
+
+var (
+	// ErrNoSuchMember is returned when a member doesn't exist.
+	ErrNoSuchMember = errors.New("member does not exist")
+	// ErrNoSuchUser is returned when linking a member to a user that doesn't
+	// exist in the member's group.
+	ErrNoSuchUser = errors.New("user does not exist")
+	// ErrNoSuchSection is returned when adding a member to a section their
+	// group doesn't have.
+	ErrNoSuchSection = errors.New("section does not exist")
+	// ErrUserAlreadyLinked is returned when linking a member to a user that
+	// is already linked to another member.
+	ErrUserAlreadyLinked = errors.New("user is already linked to a member")
+	// ErrMembershipNumberTaken is returned when another member of the group
+	// already has the membership number.
+	ErrMembershipNumberTaken = errors.New("membership number is taken")
+)
+
+// Postgres error codes of the constraint violations the store handles, see
+// https://www.postgresql.org/docs/current/errcodes-appendix.html.
+const (
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
+)
+
+// sectionConstraint is the foreign key from a member to the section of their
+// group.
+const sectionConstraint = "members_section_fkey"
+
+// membershipNumberConstraint is the unique index of membership numbers in a
+// group.
+const membershipNumberConstraint = "members_membership_number_idx"
+
+// Filter restricts the members listed. Empty fields match every member.
+type Filter struct {
+	Section string
+	Status  string
+}
+
+// MemberStorer is an interface that must be implemented by things that store
+// members. Everything is scoped to a group: members are added to and updated
+// in the member's group.
+type MemberStorer interface {
+	GetMember(ctx context.Context, groupID, id int64) (Member, bool, error)
+	ListMembers(ctx context.Context, groupID int64, filter Filter) ([]Member, error)
+	AddMember(ctx context.Context, member Member) (Member, error)
+	UpdateMember(ctx context.Context, member Member) (Member, error)
+	DeleteMember(ctx context.Context, groupID, id int64) error
+	// Sections lists the kinds of section the group has.
+	Sections(ctx context.Context, groupID int64) ([]string, error)
+	// ImportMembers updates the members with IDs and adds those without in
+	// one transaction, returning them as they were stored in the order they
+	// were given. Members without IDs whose membership number is already in
+	// the group update that member.
+	ImportMembers(ctx context.Context, groupID int64, members []Member) ([]Member, error)
+}
+
+// MemberStore is a store for members. It implements the MemberStorer
+// interface.
+type MemberStore struct {
+	cluster *db.Cluster
+}
+
+// NewStore creates a new store from the given cluster. Reads go to a replica
+// unless the primary is forced with db.WithPrimary.
+func NewStore(cluster *db.Cluster) MemberStorer {
+	return MemberStore{cluster}
+}
+
+// GetMember gets the member of the group with the given ID.
+func (s MemberStore) GetMember(ctx context.Context, groupID, id int64) (member Member, found bool, err error) {
+	query := `SELECT * FROM autocrat.members WHERE group_id = $1 AND id = $2;`
+	err = s.cluster.Reader(ctx).Named("member.get_member").QueryRowx(ctx, query, groupID, id).StructScan(&member)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Member{}, false, nil
+		}
+		return Member{}, false, fmt.Errorf("could not get member %d: %w", id, err)
+	}
+	return member, true, nil
+}
+
+// ListMembers lists the members of the group matching the filter ordered by
+// name.
+func (s MemberStore) ListMembers(ctx context.Context, groupID int64, filter Filter) ([]Member, error) {
+	members := []Member{}
+	query := `
+	SELECT * FROM autocrat.members
+	WHERE group_id = $1 AND ($2 = '' OR section = $2) AND ($3 = '' OR status = $3)
+	ORDER BY lastname, firstname, id;
+	`
+	if err := s.cluster.Reader(ctx).Named("member.list_members").Select(ctx, &members, query, groupID, filter.Section, filter.Status); err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+	return members, nil
+}
+
+// AddMember adds the member to the database and returns it as it was stored.
+func (s MemberStore) AddMember(ctx context.Context, member Member) (Member, error) {
+	if err := s.checkUser(ctx, member); err != nil {
+		return Member{}, fmt.Errorf("failed to insert member into store: %w", err)
+	}
+	var added Member
+	query := `
+	INSERT INTO autocrat.members (
+		group_id, firstname, lastname, date_of_birth, section, patrol, joined_on, status, emergency_contacts,
+		membership_number, user_id, section_since, status_since
+	)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $7, $7)
+	RETURNING *;
+	`
+	err := s.cluster.Primary().Named("member.add_member").
+		QueryRowx(ctx, query,
+			member.GroupId, member.FirstName, member.LastName, member.DateOfBirth, member.Section, member.Patrol,
+			member.JoinedOn, member.Status, member.EmergencyContacts, member.MembershipNumber, member.UserId,
+		).
+		StructScan(&added)
+	if err != nil {
+		return Member{}, fmt.Errorf("failed to insert member into store: %w", constraintError(err))
+	}
+	return added, nil
+}
+
+// UpdateMember replaces the details of the member of the group with the
+// member's ID and returns it as it was stored.
+func (s MemberStore) UpdateMember(ctx context.Context, member Member) (Member, error) {
+	if err := s.checkUser(ctx, member); err != nil {
+		return Member{}, fmt.Errorf("failed to update member %d: %w", member.Id, err)
+	}
+	var updated Member
+	query := `
+	UPDATE autocrat.members
+	SET firstname = $3, lastname = $4, date_of_birth = $5, section = $6, patrol = $7,
+		joined_on = $8, status = $9, emergency_contacts = $10, membership_number = $11, user_id = $12, updated_at = now(),
+		section_since = CASE WHEN section = $6 THEN section_since ELSE current_date END,
+		status_since = CASE WHEN status = $9 THEN status_since ELSE current_date END
+	WHERE group_id = $1 AND id = $2
+	RETURNING *;
+	`
+	err := s.cluster.Primary().Named("member.update_member").
+		QueryRowx(ctx, query,
+			member.GroupId, member.Id, member.FirstName, member.LastName, member.DateOfBirth, member.Section, member.Patrol,
+			member.JoinedOn, member.Status, member.EmergencyContacts, member.MembershipNumber, member.UserId,
+		).
+		StructScan(&updated)
+	if err == sql.ErrNoRows {
+		return Member{}, fmt.Errorf("failed to update member %d: %w", member.Id, ErrNoSuchMember)
+	} else if err != nil {
+		return Member{}, fmt.Errorf("failed to update member %d: %w", member.Id, constraintError(err))
+	}
+	return updated, nil
+}
+
+// DeleteMember deletes the member of the group with the given ID.
+func (s MemberStore) DeleteMember(ctx context.Context, groupID, id int64) error {
+	query := `DELETE FROM autocrat.members WHERE group_id = $1 AND id = $2;`
+	result, err := s.cluster.Primary().Named("member.delete_member").Exec(ctx, query, groupID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete member %d: %w", id, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete member %d: %w", id, err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("failed to delete member %d: %w", id, ErrNoSuchMember)
+	}
+	return nil
+}
+
+// Sections lists the kinds of section the group has.
+func (s MemberStore) Sections(ctx context.Context, groupID int64) ([]string, error) {
+	sections := []string{}
+	query := `SELECT kind FROM autocrat.sections WHERE group_id = $1 ORDER BY kind;`
+	if err := s.cluster.Reader(ctx).Named("member.sections").Select(ctx, &sections, query, groupID); err != nil {
+		return nil, fmt.Errorf("failed to list sections: %w", err)
+	}
+	return sections, nil
+}
+
+// importedMember is a member written by an import with its position in the
+// import.
+type importedMember struct {
+	Ord int `db:"ord"`
+	Member
+}
+
+// importArgs returns the members of an import as arrays of their fields, with
+// their positions in the import, for unnesting into rows.
+func importArgs(members []Member, positions []int) []interface{} {
+	var (
+		ords, ids                                         []int64
+		numbers, firstNames, lastNames, sections, patrols []string
+		statuses, datesOfBirth, joinedOn                  []string
+	)
+	for _, i := range positions {
+		m := members[i]
+		ords = append(ords, int64(i))
+		ids = append(ids, m.Id)
+		numbers = append(numbers, m.MembershipNumber)
+		firstNames = append(firstNames, m.FirstName)
+		lastNames = append(lastNames, m.LastName)
+		datesOfBirth = append(datesOfBirth, m.DateOfBirth.String())
+		sections = append(sections, m.Section)
+		patrols = append(patrols, m.Patrol)
+		joinedOn = append(joinedOn, m.JoinedOn.String())
+		statuses = append(statuses, m.Status)
+	}
+	return []interface{}{
+		pq.Array(ords), pq.Array(ids), pq.Array(numbers), pq.Array(firstNames), pq.Array(lastNames),
+		pq.Array(datesOfBirth), pq.Array(sections), pq.Array(patrols), pq.Array(joinedOn), pq.Array(statuses),
+	}
+}
+
+// ImportMembers writes the members of an import in a transaction so either
+// all of them are written or none are. Members with IDs are updated first so
+// membership numbers they give up or gain are settled before the others are
+// added or, if another import added them in the meantime, update the member
+// with their membership number. Emergency contacts and linked users are left
+// as they are.
+func (s MemberStore) ImportMembers(ctx context.Context, groupID int64, members []Member) ([]Member, error) {
+	var updates, additions []int
+	for i, m := range members {
+		if m.Id != 0 {
+			updates = append(updates, i)
+		} else {
+			additions = append(additions, i)
+		}
+	}
+	input := `
+	SELECT * FROM unnest(
+		$2::INTEGER[], $3::INTEGER[], $4::TEXT[], $5::TEXT[], $6::TEXT[], $7::DATE[], $8::TEXT[], $9::TEXT[],
+		$10::DATE[], $11::TEXT[]
+	) AS i (ord, id, membership_number, firstname, lastname, date_of_birth, section, patrol, joined_on, status)
+	`
+	// Numbers changed by the import are released first, so a member can take
+	// a number another member of the import gives up.
+	release := `
+	UPDATE autocrat.members m
+	SET membership_number = ''
+	FROM (` + input + `) i
+	WHERE m.id = i.id AND m.group_id = $1::INTEGER AND m.membership_number <> i.membership_number;
+	`
+	update := `
+	UPDATE autocrat.members m
+	SET membership_number = i.membership_number, firstname = i.firstname, lastname = i.lastname,
+		date_of_birth = i.date_of_birth, section = i.section, patrol = i.patrol, joined_on = i.joined_on,
+		status = i.status, updated_at = now(),
+		section_since = CASE WHEN m.section = i.section THEN m.section_since ELSE current_date END,
+		status_since = CASE WHEN m.status = i.status THEN m.status_since ELSE current_date END
+	FROM (` + input + `) i
+	WHERE m.id = i.id AND m.group_id = $1::INTEGER
+	RETURNING i.ord, m.*;
+	`
+	// Added members are given their IDs up front so they can be matched to
+	// their position in the import. Members that update another instead keep
+	// its ID and are matched by membership number.
+	add := `
+	WITH i AS (
+		SELECT *, nextval(pg_get_serial_sequence('autocrat.members', 'id')) AS new_id FROM (` + input + `) i
+	), added AS (
+		INSERT INTO autocrat.members AS m (
+			id, group_id, membership_number, firstname, lastname, date_of_birth, section, patrol, joined_on, status,
+			section_since, status_since
+		)
+		SELECT i.new_id, $1::INTEGER, i.membership_number, i.firstname, i.lastname, i.date_of_birth, i.section,
+			i.patrol, i.joined_on, i.status, i.joined_on, i.joined_on
+		FROM i
+		ON CONFLICT (group_id, membership_number) WHERE membership_number <> '' DO UPDATE
+		SET firstname = EXCLUDED.firstname, lastname = EXCLUDED.lastname, date_of_birth = EXCLUDED.date_of_birth,
+			section = EXCLUDED.section, patrol = EXCLUDED.patrol, joined_on = EXCLUDED.joined_on,
+			status = EXCLUDED.status, updated_at = now(),
+			section_since = CASE WHEN m.section = EXCLUDED.section THEN m.section_since ELSE current_date END,
+			status_since = CASE WHEN m.status = EXCLUDED.status THEN m.status_since ELSE current_date END
+		RETURNING m.*
+	)
+	SELECT i.ord, a.*
+	FROM i JOIN added a ON a.id = i.new_id OR (i.membership_number <> '' AND a.membership_number = i.membership_number);
+	`
+	written := make([]Member, len(members))
+	err := s.cluster.Primary().Transact(ctx, func(tx *db.Tx) error {
+		if len(updates) > 0 {
+			var updated []importedMember
+			args := append([]interface{}{groupID}, importArgs(members, updates)...)
+			if _, err := tx.Named("member.import_release").Exec(ctx, release, args...); err != nil {
+				return err
+			}
+			if err := tx.Named("member.import_update").Select(ctx, &updated, update, args...); err != nil {
+				return constraintError(err)
+			}
+			if len(updated) != len(updates) {
+				return ErrNoSuchMember
+			}
+			for _, m := range updated {
+				written[m.Ord] = m.Member
+			}
+		}
+		if len(additions) > 0 {
+			var added []importedMember
+			args := append([]interface{}{groupID}, importArgs(members, additions)...)
+			if err := tx.Named("member.import_add").Select(ctx, &added, add, args...); err != nil {
+				return constraintError(err)
+			}
+			if len(added) != len(additions) {
+				return fmt.Errorf("added %d of %d members", len(added), len(additions))
+			}
+			for _, m := range added {
+				written[m.Ord] = m.Member
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to import members: %w", err)
+	}
+	return written, nil
+}
+
+// checkUser checks the user the member is linked to, if any, is in the
+// member's group. The foreign key only checks the user exists.
+func (s MemberStore) checkUser(ctx context.Context, member Member) error {
+	if member.UserId == nil {
+		return nil
+	}
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM autocrat.users WHERE group_id = $1 AND id = $2);`
+	err := s.cluster.Reader(ctx).Named("member.check_user").QueryRowx(ctx, query, member.GroupId, *member.UserId).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check user %d: %w", *member.UserId, err)
+	}
+	if !exists {
+		return ErrNoSuchUser
+	}
+	return nil
+}
+
+// constraintError converts violations of the section, user link and
+// membership number constraints to the store's errors.
+func constraintError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch pqErr.Code {
+	case foreignKeyViolation:
+		if pqErr.Constraint == sectionConstraint {
+			return fmt.Errorf("%w: %v", ErrNoSuchSection, err)
+		}
+		return fmt.Errorf("%w: %v", ErrNoSuchUser, err)
+	case uniqueViolation:
+		if pqErr.Constraint == membershipNumberConstraint {
+			return fmt.Errorf("%w: %v", ErrMembershipNumberTaken, err)
+		}
+		return fmt.Errorf("%w: %v", ErrUserAlreadyLinked, err)
+	}
+	return err
+}
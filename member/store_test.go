@@ -0,0 +1,194 @@
+package member
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/db/dbtest"
+	"github.com/nick96/cubapi/db/migrate"
+	"github.com/nick96/cubapi/migrations"
+	"go.uber.org/zap"
+)
+
+// newPostgresStore creates a store backed by the database configured by the
+// same environment variables as the user store tests, with a group of its own
+// that has a cubs section. The test is skipped by -short.
+func newPostgresStore(t *testing.T) (MemberStore, int64) {
+	if testing.Short() {
+		t.Skip("Skipping store test against Postgres in short mode")
+	}
+	handle, err := db.NewConn(
+		zap.NewNop(),
+		os.Getenv("USER_DB_USER"),
+		os.Getenv("DB_PASS"),
+		os.Getenv("USER_DB_NAME"),
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_SSL_MODE"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { handle.Close() })
+	if err := migrate.NewMigrator(handle.DB.DB, zap.NewNop()).Apply(migrations.All...); err != nil {
+		t.Fatal(err)
+	}
+
+	var groupID int64
+	slug := fmt.Sprintf("member-store-%d", time.Now().UnixNano())
+	if err := handle.QueryRowx(`INSERT INTO autocrat.groups (name, slug) VALUES ($1, $1) RETURNING id;`, slug).Scan(&groupID); err != nil {
+		t.Fatal(err)
+	}
+	handle.MustExec(`INSERT INTO autocrat.sections (group_id, kind, name) VALUES ($1, 'cubs', 'Cubs');`, groupID)
+	t.Cleanup(func() {
+		handle.MustExec(`DELETE FROM autocrat.members WHERE group_id = $1;`, groupID)
+		handle.MustExec(`DELETE FROM autocrat.groups WHERE id = $1;`, groupID)
+	})
+	return NewStore(db.NewCluster(zap.NewNop(), handle)).(MemberStore), groupID
+}
+
+func newCub(first, number string) Member {
+	return Member{
+		FirstName:        first,
+		LastName:         "Wolf",
+		DateOfBirth:      date.Of(time.Date(2014, time.March, 1, 0, 0, 0, 0, time.UTC)),
+		Section:          "cubs",
+		JoinedOn:         date.Of(time.Date(2021, time.February, 1, 0, 0, 0, 0, time.UTC)),
+		Status:           StatusActive,
+		MembershipNumber: number,
+	}
+}
+
+func TestImportMembersIsRepeatable(t *testing.T) {
+	store, groupID := newPostgresStore(t)
+	ctx := context.Background()
+
+	roster := []Member{newCub("Mowgli", "1001"), newCub("Bagheera", ""), newCub("Baloo", "1002")}
+	first, err := store.ImportMembers(ctx, groupID, roster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, member := range first {
+		if member.Id == 0 || member.FirstName != roster[i].FirstName {
+			t.Fatalf("Expected the members in the order they were imported, got %+v", first)
+		}
+	}
+
+	// Importing the numbered members again without their IDs updates them.
+	roster[2].Patrol = "Red"
+	again, err := store.ImportMembers(ctx, groupID, []Member{roster[2], roster[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[0].Id != first[2].Id || again[0].Patrol != "Red" || again[1].Id != first[0].Id {
+		t.Fatalf("Expected the numbered members to be updated, got %+v", again)
+	}
+	members, err := store.ListMembers(ctx, groupID, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 3 {
+		t.Fatalf("Expected importing again not to add members, got %d", len(members))
+	}
+}
+
+func TestImportMembersGainsNumber(t *testing.T) {
+	store, groupID := newPostgresStore(t)
+	ctx := context.Background()
+
+	// Mowgli was added by hand without a number and Akela holds the number
+	// Mowgli is given, while Akela is given a new one.
+	mowgli, err := store.AddMember(ctx, withGroup(newCub("Mowgli", ""), groupID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	akela, err := store.AddMember(ctx, withGroup(newCub("Akela", "1001"), groupID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mowgli.MembershipNumber = "1001"
+	akela.MembershipNumber = "1002"
+	written, err := store.ImportMembers(ctx, groupID, []Member{mowgli, newCub("Baloo", "1003"), akela})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written[0].Id != mowgli.Id || written[0].MembershipNumber != "1001" {
+		t.Errorf("Expected Mowgli to gain Akela's number, got %+v", written[0])
+	}
+	if written[1].FirstName != "Baloo" || written[1].Id == mowgli.Id || written[1].Id == akela.Id {
+		t.Errorf("Expected Baloo to be added, got %+v", written[1])
+	}
+	if written[2].Id != akela.Id || written[2].MembershipNumber != "1002" {
+		t.Errorf("Expected Akela to get a new number, got %+v", written[2])
+	}
+
+	// The roster with numbers can then be imported again as is.
+	again, err := store.ImportMembers(ctx, groupID, []Member{newCub("Mowgli", "1001"), newCub("Akela", "1002")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[0].Id != mowgli.Id || again[1].Id != akela.Id {
+		t.Errorf("Expected the members to be matched by their new numbers, got %+v", again)
+	}
+}
+
+func withGroup(member Member, groupID int64) Member {
+	member.GroupId = groupID
+	return member
+}
+
+func TestImportMembersUpdatesFirstInTransaction(t *testing.T) {
+	handle := dbtest.NewRecorder(t.Name())
+	store := NewStore(db.NewCluster(zap.NewNop(), handle.DB))
+
+	// The recorder doesn't return any rows, so the update finds no member and
+	// the import is rolled back.
+	mowgli := withGroup(newCub("Mowgli", "1001"), testGroupID)
+	mowgli.Id = 1
+	_, err := store.ImportMembers(context.Background(), testGroupID, []Member{newCub("Baloo", ""), mowgli})
+	if !errors.Is(err, ErrNoSuchMember) {
+		t.Fatalf("Expected the missing member to fail the import, got %v", err)
+	}
+	queries := handle.Queries()
+	if len(queries) != 4 || queries[0] != "BEGIN" || queries[3] != "ROLLBACK" {
+		t.Fatalf("Expected the import to be rolled back, got %q", queries)
+	}
+	if !strings.Contains(queries[1], "SET membership_number = ''") || !strings.Contains(queries[2], "UPDATE autocrat.members") {
+		t.Errorf("Expected numbers to be released before members are updated, got %q", queries)
+	}
+}
+
+func TestUpdateMemberRecordsStatusChange(t *testing.T) {
+	store, groupID := newPostgresStore(t)
+	ctx := context.Background()
+
+	added, err := store.AddMember(ctx, withGroup(newCub("Mowgli", ""), groupID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.SectionSince != added.JoinedOn || added.StatusSince != added.JoinedOn {
+		t.Fatalf("Expected a new member to have been in their section and status since joining, got %+v", added)
+	}
+	added.Patrol = "Red"
+	unmoved, err := store.UpdateMember(ctx, added)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unmoved.SectionSince != added.SectionSince {
+		t.Errorf("Expected other changes to keep when the member joined their section, got %s", unmoved.SectionSince)
+	}
+	unmoved.Status = StatusLeft
+	left, err := store.UpdateMember(ctx, unmoved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left.StatusSince == added.StatusSince || left.SectionSince != added.SectionSince {
+		t.Errorf("Expected leaving to record when the member left, got %+v", left)
+	}
+}
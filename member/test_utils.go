@@ -0,0 +1,183 @@
+package member
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/nick96/cubapi/group"
+)
+
+// Groups members belong to in tests.
+const (
+	testGroupID  = 1
+	otherGroupID = 2
+)
+
+// mockMemberStore stores members in memory. users maps the IDs of the users
+// members can be linked to to their group and sections are the kinds of
+// section each group has.
+type mockMemberStore struct {
+	members  map[int64]Member
+	users    map[int64]int64
+	sections map[int64]map[string]bool
+}
+
+func newMockMemberStore() *mockMemberStore {
+	return &mockMemberStore{
+		members:  make(map[int64]Member),
+		users:    make(map[int64]int64),
+		sections: make(map[int64]map[string]bool),
+	}
+}
+
+// addGroup adds a group with every kind of section and the given users.
+func (s *mockMemberStore) addGroup(groupID int64, users ...int64) *mockMemberStore {
+	s.sections[groupID] = make(map[string]bool)
+	for _, section := range group.Sections {
+		s.sections[groupID][section] = true
+	}
+	for _, id := range users {
+		s.users[id] = groupID
+	}
+	return s
+}
+
+// inGroup is a middleware that makes requests in the group, as authentication
+// does.
+func inGroup(groupID int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(group.NewContext(r.Context(), groupID)))
+		})
+	}
+}
+
+func (s *mockMemberStore) GetMember(ctx context.Context, groupID, id int64) (Member, bool, error) {
+	member, ok := s.members[id]
+	if !ok || member.GroupId != groupID {
+		return Member{}, false, nil
+	}
+	return member, true, nil
+}
+
+func (s *mockMemberStore) ListMembers(ctx context.Context, groupID int64, filter Filter) ([]Member, error) {
+	members := []Member{}
+	for _, member := range s.members {
+		if member.GroupId == groupID && (filter.Section == "" || member.Section == filter.Section) && (filter.Status == "" || member.Status == filter.Status) {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Id < members[j].Id })
+	return members, nil
+}
+
+func (s *mockMemberStore) check(member Member) error {
+	if !s.sections[member.GroupId][member.Section] {
+		return ErrNoSuchSection
+	}
+	for _, other := range s.members {
+		if other.Id != member.Id && other.GroupId == member.GroupId && member.MembershipNumber != "" && other.MembershipNumber == member.MembershipNumber {
+			return ErrMembershipNumberTaken
+		}
+	}
+	if member.UserId == nil {
+		return nil
+	}
+	if userGroup, ok := s.users[*member.UserId]; !ok || userGroup != member.GroupId {
+		return ErrNoSuchUser
+	}
+	for _, other := range s.members {
+		if other.Id != member.Id && other.UserId != nil && *other.UserId == *member.UserId {
+			return ErrUserAlreadyLinked
+		}
+	}
+	return nil
+}
+
+func (s *mockMemberStore) AddMember(ctx context.Context, member Member) (Member, error) {
+	if err := s.check(member); err != nil {
+		return Member{}, err
+	}
+	member.Id = int64(len(s.members) + 1)
+	for s.members[member.Id].Id != 0 {
+		member.Id++
+	}
+	member.CreatedAt = time.Now()
+	member.UpdatedAt = member.CreatedAt
+	s.members[member.Id] = member
+	return member, nil
+}
+
+func (s *mockMemberStore) UpdateMember(ctx context.Context, member Member) (Member, error) {
+	existing, ok := s.members[member.Id]
+	if !ok || existing.GroupId != member.GroupId {
+		return Member{}, ErrNoSuchMember
+	}
+	if err := s.check(member); err != nil {
+		return Member{}, err
+	}
+	member.CreatedAt = existing.CreatedAt
+	member.UpdatedAt = time.Now()
+	s.members[member.Id] = member
+	return member, nil
+}
+
+func (s *mockMemberStore) DeleteMember(ctx context.Context, groupID, id int64) error {
+	if member, ok := s.members[id]; !ok || member.GroupId != groupID {
+		return ErrNoSuchMember
+	}
+	delete(s.members, id)
+	return nil
+}
+
+func (s *mockMemberStore) Sections(ctx context.Context, groupID int64) ([]string, error) {
+	sections := []string{}
+	for section := range s.sections[groupID] {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	return sections, nil
+}
+
+// ImportMembers writes the members one at a time, so unlike the store an
+// import that fails part way is partly written. Otherwise it writes them as
+// the store does: members with IDs are updated first, after the numbers they
+// change are released, and members without IDs whose number is taken update
+// the member with it.
+func (s *mockMemberStore) ImportMembers(ctx context.Context, groupID int64, members []Member) ([]Member, error) {
+	for _, member := range members {
+		if existing, ok := s.members[member.Id]; ok && existing.GroupId == groupID && existing.MembershipNumber != member.MembershipNumber {
+			existing.MembershipNumber = ""
+			s.members[member.Id] = existing
+		}
+	}
+	written := make([]Member, len(members))
+	for _, updates := range []bool{true, false} {
+		for i, member := range members {
+			if (member.Id != 0) != updates {
+				continue
+			}
+			member.GroupId = groupID
+			if member.Id == 0 && member.MembershipNumber != "" {
+				for _, other := range s.members {
+					if other.GroupId == groupID && other.MembershipNumber == member.MembershipNumber {
+						member.Id, member.UserId, member.EmergencyContacts = other.Id, other.UserId, other.EmergencyContacts
+					}
+				}
+			}
+			var err error
+			if member.Id == 0 {
+				member, err = s.AddMember(ctx, member)
+			} else {
+				member, err = s.UpdateMember(ctx, member)
+			}
+			if err != nil {
+				return nil, err
+			}
+			written[i] = member
+		}
+	}
+	return written, nil
+}
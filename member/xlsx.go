@@ -0,0 +1,233 @@
+package member
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxXLSXPart is the most a part of a workbook can decompress to, so small
+// files can't decompress to exhaust memory.
+const maxXLSXPart = 32 << 20
+
+// sheetRow is a row of a spreadsheet with its number, counting from 1.
+type sheetRow struct {
+	number int
+	cells  []string
+}
+
+// xlsxWorkbook is xl/workbook.xml, which lists the sheets.
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		// Attrs has the ID of the sheet's relationship, whose namespace
+		// differs between transitional and strict workbooks.
+		Attrs []xml.Attr `xml:",any,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// xlsxRelationships is xl/_rels/workbook.xml.rels, which has where each
+// sheet is.
+type xlsxRelationships struct {
+	Relationships []struct {
+		Id     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is text that may be split into runs of different formatting.
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	b.WriteString(t.Text)
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+// xlsxSharedStrings is xl/sharedStrings.xml, the text cells refer to by
+// index.
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+// xlsxWorksheet is a sheet of a workbook. Empty rows and cells can be left
+// out so they're positioned by their references.
+type xlsxWorksheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX reads the rows of the sheet of an XLSX workbook with the name, or
+// the first sheet if the name is empty. Cells are read as the text or number
+// they hold, their formatting is ignored, so dates are serial numbers.
+func readXLSX(data []byte, sheet string) ([]sheetRow, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not an XLSX workbook: %w", err)
+	}
+	parts := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		parts[f.Name] = f
+	}
+
+	var workbook xlsxWorkbook
+	if err := readXLSXPart(parts, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	var rels xlsxRelationships
+	if err := readXLSXPart(parts, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	relID := ""
+	for _, s := range workbook.Sheets {
+		if sheet == "" || s.Name == sheet {
+			for _, attr := range s.Attrs {
+				if attr.Name.Local == "id" {
+					relID = attr.Value
+				}
+			}
+			break
+		}
+	}
+	if relID == "" {
+		if sheet == "" {
+			return nil, errors.New("workbook has no sheets")
+		}
+		return nil, fmt.Errorf("workbook has no sheet named %q", sheet)
+	}
+	sheetPath := ""
+	for _, rel := range rels.Relationships {
+		if rel.Id == relID {
+			if strings.HasPrefix(rel.Target, "/") {
+				sheetPath = strings.TrimPrefix(rel.Target, "/")
+			} else {
+				sheetPath = path.Join("xl", rel.Target)
+			}
+		}
+	}
+	if sheetPath == "" {
+		return nil, fmt.Errorf("workbook has no part for sheet %s", relID)
+	}
+
+	var shared xlsxSharedStrings
+	if _, ok := parts["xl/sharedStrings.xml"]; ok {
+		if err := readXLSXPart(parts, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+	var worksheet xlsxWorksheet
+	if err := readXLSXPart(parts, sheetPath, &worksheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([]sheetRow, 0, len(worksheet.Rows))
+	previous := 0
+	for _, row := range worksheet.Rows {
+		number := row.Number
+		if number == 0 {
+			number = previous + 1
+		}
+		previous = number
+		var cells []string
+		for _, cell := range row.Cells {
+			column := len(cells)
+			if cell.Ref != "" {
+				if column, err = xlsxColumn(cell.Ref); err != nil {
+					return nil, err
+				}
+			}
+			var value string
+			switch cell.Type {
+			case "s":
+				i, err := strconv.Atoi(cell.Value)
+				if err != nil || i < 0 || i >= len(shared.Items) {
+					return nil, fmt.Errorf("cell %s refers to missing text %q", cell.Ref, cell.Value)
+				}
+				value = shared.Items[i].String()
+			case "inlineStr":
+				value = cell.Inline.String()
+			case "b":
+				value = "FALSE"
+				if cell.Value == "1" {
+					value = "TRUE"
+				}
+			default:
+				value = cell.Value
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+			}
+			cells[column] = value
+		}
+		rows = append(rows, sheetRow{number, cells})
+	}
+	return rows, nil
+}
+
+// readXLSXPart decodes the XML part of a workbook with the name into v.
+func readXLSXPart(parts map[string]*zip.File, name string, v interface{}) error {
+	f, ok := parts[name]
+	if !ok {
+		return fmt.Errorf("not an XLSX workbook: %s is missing", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(rc, maxXLSXPart+1))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if len(data) > maxXLSXPart {
+		return fmt.Errorf("%s is larger than %d MiB", name, maxXLSXPart>>20)
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// xlsxColumn gets the index of the column of a cell reference, e.g. 0 for A1
+// and 27 for AB3.
+func xlsxColumn(ref string) (int, error) {
+	column := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+		letters++
+	}
+	// XLSX has at most 16384 columns, XFD.
+	if letters == 0 || letters > 3 || column > 16384 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return column - 1, nil
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/cors"
+	"go.uber.org/zap"
+)
+
+// CORSPolicy is the cross-origin resource sharing policy for a group of
+// routes.
+type CORSPolicy struct {
+	// AllowedOrigins are the origins allowed to make cross-origin requests.
+	// An origin can use a wildcard in place of its subdomains to allow any
+	// subdomain, e.g. "https://*.nickspain.dev". A bare "*" is not allowed
+	// as it can't be used with credentials.
+	AllowedOrigins []string
+	// AllowedMethods are the methods allowed in cross-origin requests.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in cross-origin
+	// requests.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers that browsers make available
+	// to the requesting script.
+	ExposedHeaders []string
+	// AllowCredentials allows cookies to be sent with cross-origin requests.
+	AllowCredentials bool
+	// MaxAge is how long browsers can cache the result of a preflight
+	// request.
+	MaxAge time.Duration
+}
+
+// WithMethods returns a copy of the policy that allows the given methods. This
+// is used to narrow the policy for a specific route.
+func (p CORSPolicy) WithMethods(methods ...string) CORSPolicy {
+	p.AllowedMethods = methods
+	return p
+}
+
+// WithHeaders returns a copy of the policy that allows the given request
+// headers.
+func (p CORSPolicy) WithHeaders(headers ...string) CORSPolicy {
+	p.AllowedHeaders = headers
+	return p
+}
+
+// Validate checks that the allowed origins are well formed.
+func (p CORSPolicy) Validate() error {
+	for _, origin := range p.AllowedOrigins {
+		if _, err := parseOriginPattern(origin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// originPattern is an allowed origin. If wildcard is true then host is the
+// parent domain and any subdomain of it matches.
+type originPattern struct {
+	scheme   string
+	host     string
+	wildcard bool
+}
+
+func parseOriginPattern(origin string) (originPattern, error) {
+	if origin == "*" {
+		return originPattern{}, fmt.Errorf("origin '*' is not allowed, list the allowed origins instead")
+	}
+	u, err := url.Parse(strings.ToLower(strings.TrimSpace(origin)))
+	if err != nil {
+		return originPattern{}, fmt.Errorf("invalid origin %q: %w", origin, err)
+	}
+	if u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return originPattern{}, fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+	}
+
+	pattern := originPattern{scheme: u.Scheme, host: u.Host}
+	if strings.HasPrefix(u.Host, "*.") {
+		pattern.wildcard = true
+		pattern.host = strings.TrimPrefix(u.Host, "*.")
+	}
+	if strings.Contains(pattern.host, "*") {
+		return originPattern{}, fmt.Errorf("invalid origin %q, a wildcard can only replace the subdomains", origin)
+	}
+	return pattern, nil
+}
+
+func (p originPattern) matches(origin *url.URL) bool {
+	if origin.Scheme != p.scheme {
+		return false
+	}
+	host := strings.ToLower(origin.Host)
+	if p.wildcard {
+		return strings.HasSuffix(host, "."+p.host)
+	}
+	return host == p.host
+}
+
+// CORS is a middleware http handler that applies the given CORS policy. The
+// matched origin is echoed back in Access-Control-Allow-Origin (never "*")
+// with `Vary: Origin` so it can be used with credentials. Preflight requests
+// are answered without calling the next handler. The policy must be valid
+// (see CORSPolicy.Validate), otherwise this panics.
+func CORS(logger *zap.Logger, policy CORSPolicy) func(next http.Handler) http.Handler {
+	var patterns []originPattern
+	for _, origin := range policy.AllowedOrigins {
+		pattern, err := parseOriginPattern(origin)
+		if err != nil {
+			panic(err)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	allowOrigin := func(r *http.Request, origin string) bool {
+		u, err := url.Parse(origin)
+		if err == nil {
+			for _, pattern := range patterns {
+				if pattern.matches(u) {
+					return true
+				}
+			}
+		}
+		logger.Info("Rejected cross-origin request",
+			zap.String("origin", origin),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.EscapedPath()),
+		)
+		return false
+	}
+
+	return cors.New(cors.Options{
+		AllowOriginFunc:  allowOrigin,
+		AllowedMethods:   policy.AllowedMethods,
+		AllowedHeaders:   policy.AllowedHeaders,
+		ExposedHeaders:   policy.ExposedHeaders,
+		AllowCredentials: policy.AllowCredentials,
+		MaxAge:           int(policy.MaxAge.Seconds()),
+	}).Handler
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var testPolicy = CORSPolicy{
+	AllowedOrigins:   []string{"https://bagheera.nickspain.dev", "https://*.preview.nickspain.dev"},
+	AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+	AllowedHeaders:   []string{"Content-Type"},
+	ExposedHeaders:   []string{"X-Request-ID"},
+	AllowCredentials: true,
+	MaxAge:           10 * time.Minute,
+}
+
+func corsRequest(policy CORSPolicy, method, origin string, headers map[string]string) (*httptest.ResponseRecorder, bool) {
+	called := false
+	handler := CORS(zap.NewNop(), policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	r := httptest.NewRequest(method, "/user", nil)
+	r.Header.Set("Origin", origin)
+	for key, value := range headers {
+		r.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, called
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	testCases := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://bagheera.nickspain.dev", true},
+		{"https://pr-1.preview.nickspain.dev", true},
+		{"https://a.b.preview.nickspain.dev", true},
+		{"https://preview.nickspain.dev", false},
+		{"http://bagheera.nickspain.dev", false},
+		{"https://evilpreview.nickspain.dev", false},
+		{"https://bagheera.nickspain.dev.evil.com", false},
+		{"null", false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.origin, func(t *testing.T) {
+			w, called := corsRequest(testPolicy, http.MethodGet, tt.origin, nil)
+			if !called {
+				t.Fatal("Expected actual request to reach the handler")
+			}
+			allowOrigin := w.Header().Get("Access-Control-Allow-Origin")
+			if tt.allowed {
+				if allowOrigin != tt.origin {
+					t.Fatalf("Expected origin %s to be echoed, got %q", tt.origin, allowOrigin)
+				}
+				if w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+					t.Fatal("Expected credentials to be allowed")
+				}
+				if w.Header().Get("Access-Control-Expose-Headers") != "X-Request-Id" {
+					t.Fatalf("Expected X-Request-ID to be exposed, got %q", w.Header().Get("Access-Control-Expose-Headers"))
+				}
+			} else if allowOrigin != "" {
+				t.Fatalf("Expected origin %s to be rejected, got %q", tt.origin, allowOrigin)
+			}
+			if w.Header().Get("Vary") != "Origin" {
+				t.Fatalf("Expected Vary: Origin, got %q", w.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	origin := "https://bagheera.nickspain.dev"
+	w, called := corsRequest(testPolicy, http.MethodOptions, origin, map[string]string{
+		"Access-Control-Request-Method":  http.MethodPost,
+		"Access-Control-Request-Headers": "Content-Type",
+	})
+	if called {
+		t.Fatal("Expected preflight request not to reach the handler")
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != origin {
+		t.Fatalf("Expected origin to be echoed, got %q", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") != http.MethodPost {
+		t.Fatalf("Expected POST to be allowed, got %q", w.Header().Get("Access-Control-Allow-Methods"))
+	}
+	if w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Fatalf("Expected max age of 600, got %q", w.Header().Get("Access-Control-Max-Age"))
+	}
+}
+
+func TestCORSPreflightPerRouteMethods(t *testing.T) {
+	policy := testPolicy.WithMethods(http.MethodGet)
+	w, _ := corsRequest(policy, http.MethodOptions, "https://bagheera.nickspain.dev", map[string]string{
+		"Access-Control-Request-Method": http.MethodDelete,
+	})
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("Expected preflight for a method the route doesn't allow to be rejected")
+	}
+}
+
+func TestCORSPolicyValidate(t *testing.T) {
+	invalid := []string{"*", "bagheera.nickspain.dev", "https://bagheera.nickspain.dev/path", "https://bagheera.*.dev"}
+	for _, origin := range invalid {
+		policy := CORSPolicy{AllowedOrigins: []string{origin}}
+		if err := policy.Validate(); err == nil {
+			t.Errorf("Expected origin %q to be invalid", origin)
+		}
+	}
+	if err := testPolicy.Validate(); err != nil {
+		t.Errorf("Expected test policy to be valid: %v", err)
+	}
+}
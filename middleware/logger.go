@@ -5,18 +5,26 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/middleware"
+	"github.com/nick96/cubapi/logging"
 	"go.uber.org/zap"
 )
 
-// Logger is a middlware http handler that logs requests.
+// Logger is a middlware http handler that logs requests. It starts the
+// request's logging scope so the request ID and route pattern are included in
+// every log line written while serving it, see logging.FromContext.
 func Logger(logger *zap.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			receivedAt := time.Now()
 			dateReceived := receivedAt.Format("2006-01-02T15:0405-0700")
+			ctx := logging.NewContext(
+				r.Context(),
+				zap.String("requestID", middleware.GetReqID(r.Context())),
+				zap.String("route", matchRoute(r)),
+			)
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 			defer func() {
-				logger.Info(
+				logging.Logger(ctx, logger).Info(
 					"Received request",
 					zap.String("remoteHost", r.RemoteAddr),
 					zap.String("method", r.Method),
@@ -28,7 +36,7 @@ func Logger(logger *zap.Logger) func(next http.Handler) http.Handler {
 					zap.Duration("duration", time.Since(receivedAt)),
 				)
 			}()
-			next.ServeHTTP(ww, r)
+			next.ServeHTTP(ww, r.WithContext(ctx))
 		})
 	}
 }
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// unmatchedRoute is the route label used for requests that don't match a
+// route. Using the raw path would let clients create unbounded label values.
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests, by method, route pattern and status code.",
+	}, []string{"method", "route", "code"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "http_request_duration_seconds",
+		Help: "Latency of HTTP requests, by method and route pattern.",
+	}, []string{"method", "route"})
+	httpRequestsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests currently being served, by method and route pattern.",
+	}, []string{"method", "route"})
+)
+
+// Metrics is a middleware http handler that records request counts, latencies
+// and in flight requests for each chi route pattern.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := matchRoute(r)
+		httpRequestsInFlight.WithLabelValues(r.Method, route).Inc()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			httpRequestsInFlight.WithLabelValues(r.Method, route).Dec()
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+			httpRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// matchRoute finds the route pattern the request will be routed to. The
+// pattern isn't known until the request has been routed so it is looked up
+// ahead of time in order to track in flight requests.
+func matchRoute(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return unmatchedRoute
+	}
+	tctx := chi.NewRouteContext()
+	if !rctx.Routes.Match(tctx, r.Method, r.URL.Path) {
+		return unmatchedRoute
+	}
+	return tctx.RoutePattern()
+}
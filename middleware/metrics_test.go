@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsUsesRoutePattern(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(Metrics)
+	router.Route("/user", func(r chi.Router) {
+		r.Get("/{userID}", func(w http.ResponseWriter, r *http.Request) {
+			if inFlight := testutil.ToFloat64(httpRequestsInFlight.WithLabelValues(http.MethodGet, "/user/{userID}")); inFlight != 1 {
+				t.Errorf("Expected 1 request in flight, got %v", inFlight)
+			}
+			w.WriteHeader(http.StatusTeapot)
+		})
+	})
+
+	before := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/user/{userID}", "418"))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/user/1", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/user/2", nil))
+
+	if count := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/user/{userID}", "418")) - before; count != 2 {
+		t.Fatalf("Expected 2 requests to be counted against the route pattern, got %v", count)
+	}
+	if inFlight := testutil.ToFloat64(httpRequestsInFlight.WithLabelValues(http.MethodGet, "/user/{userID}")); inFlight != 0 {
+		t.Fatalf("Expected no requests in flight, got %v", inFlight)
+	}
+}
+
+func TestMetricsUnmatchedRoute(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(Metrics)
+	router.Get("/user", func(w http.ResponseWriter, r *http.Request) {})
+
+	before := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, unmatchedRoute, "404"))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/does/not/exist", nil))
+	if count := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")) - before; count != 1 {
+		t.Fatalf("Expected unmatched request to be counted as %s, got %v", unmatchedRoute, count)
+	}
+}
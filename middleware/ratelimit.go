@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nick96/cubapi/problem"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var httpRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_rate_limited_total",
+	Help: "Number of HTTP requests rejected by a rate limit, by limit name.",
+}, []string{"limit"})
+
+// RateLimit is a token bucket limit: clients can make up to Limit requests in a
+// burst, and the bucket refills at a rate of Limit requests per Period.
+type RateLimit struct {
+	Limit  int
+	Period time.Duration
+}
+
+// Enabled reports whether the limit restricts anything.
+func (l RateLimit) Enabled() bool {
+	return l.Limit > 0 && l.Period > 0
+}
+
+// rate returns the number of tokens added to the bucket per second.
+func (l RateLimit) rate() float64 {
+	return float64(l.Limit) / l.Period.Seconds()
+}
+
+// RateLimitResult is the outcome of taking a token from a bucket.
+type RateLimitResult struct {
+	// Allowed is true if a token was taken and the request can proceed.
+	Allowed bool
+	// Remaining is the number of whole tokens left in the bucket.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until a token is available, if the request
+	// wasn't allowed.
+	RetryAfter time.Duration
+}
+
+// newRateLimitResult describes the state of a bucket that has tokens left
+// after a request was allowed or denied.
+func newRateLimitResult(limit RateLimit, tokens float64, allowed bool) RateLimitResult {
+	rate := limit.rate()
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(limit.Limit) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return result
+}
+
+// RateLimitStore stores token buckets.
+type RateLimitStore interface {
+	// Take takes a token from the bucket with the given key, refilling it
+	// according to the limit first. New buckets start full.
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// period is the period of the bucket's limit, a bucket is always full
+	// once a period has passed since it was last updated.
+	period time.Duration
+}
+
+// MemoryRateLimitStore keeps token buckets in memory. Each replica of the
+// service has its own buckets so it's only suitable for a single replica.
+type MemoryRateLimitStore struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// memorySweepInterval is how often buckets that have refilled are removed from
+// a MemoryRateLimitStore. A full bucket is the same as no bucket so removing
+// them stops the store growing with every client ever seen.
+const memorySweepInterval = time.Minute
+
+// NewMemoryRateLimitStore creates an empty in-memory rate limit store.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Take takes a token from the bucket with the given key.
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Limit), updated: now, period: limit.Period}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Limit), b.tokens+now.Sub(b.updated).Seconds()*limit.rate())
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return newRateLimitResult(limit, b.tokens, allowed), nil
+}
+
+// sweep removes buckets that would have refilled by now.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memorySweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of buckets in the store.
+func (s *MemoryRateLimitStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+// KeyFunc identifies the client making a request. It returns false if it can't
+// identify the client.
+type KeyFunc func(r *http.Request) (string, bool)
+
+// KeyByIP identifies clients by their IP address. It should come after the
+// RealIP middleware if the service is behind a proxy.
+func KeyByIP(r *http.Request) (string, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if host == "" {
+		return "", false
+	}
+	return "ip:" + host, true
+}
+
+// KeyByUser identifies clients by the ID of the user making the request,
+// found by userID.
+func KeyByUser(userID func(r *http.Request) (string, bool)) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		id, ok := userID(r)
+		if !ok || id == "" {
+			return "", false
+		}
+		return "user:" + id, true
+	}
+}
+
+// FirstKey identifies clients by the first of the key functions that can
+// identify them. This is used to limit authenticated users by their ID and
+// everyone else by their IP address.
+func FirstKey(keyFuncs ...KeyFunc) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		for _, keyFunc := range keyFuncs {
+			if key, ok := keyFunc(r); ok {
+				return key, true
+			}
+		}
+		return "", false
+	}
+}
+
+// RateLimiter is a middleware http handler that limits the rate of requests
+// from each client, identified by key. Each limit has its own buckets so the
+// name must be unique. The standard RateLimit-* headers are set on every
+// response and requests over the limit are rejected with a 429 problem. If
+// the store fails the request is allowed, an outage of the store shouldn't
+// take the API down with it.
+func RateLimiter(logger *zap.Logger, store RateLimitStore, name string, limit RateLimit, key KeyFunc) func(next http.Handler) http.Handler {
+	policy := fmt.Sprintf("%d;w=%d", limit.Limit, int(limit.Period.Seconds()))
+	return func(next http.Handler) http.Handler {
+		if !limit.Enabled() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client, ok := key(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			result, err := store.Take(r.Context(), name+":"+client, limit)
+			if err != nil {
+				logger.Error("Failed to check rate limit, allowing request", zap.String("limit", name), zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", policy)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+			if !result.Allowed {
+				httpRateLimited.WithLabelValues(name).Inc()
+				logger.Info("Rate limited request", zap.String("limit", name), zap.String("client", client))
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				problem.Write(w, r, problem.New(
+					problem.CodeRateLimited,
+					fmt.Sprintf("Too many requests, try again in %d seconds", ceilSeconds(result.RetryAfter)),
+				))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ceilSeconds rounds the duration up to whole seconds, so clients that wait
+// that long are guaranteed to be allowed.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
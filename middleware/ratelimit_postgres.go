@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nick96/cubapi/db"
+)
+
+// PostgresRateLimitStore keeps token buckets in the autocrat.rate_limits
+// table so all replicas of the service share them.
+type PostgresRateLimitStore struct {
+	db *db.DB
+}
+
+// NewPostgresRateLimitStore creates a rate limit store backed by the database.
+func NewPostgresRateLimitStore(db *db.DB) PostgresRateLimitStore {
+	return PostgresRateLimitStore{db}
+}
+
+// takeQuery refills and takes a token from a bucket in a single statement, so
+// concurrent requests on different replicas can't both take the last token.
+// New buckets start full so the first request always takes a token. The
+// database's clock is used so replicas don't need synchronised clocks.
+// Whether a token was taken is stored on the row so it can be returned.
+const takeQuery = `
+INSERT INTO autocrat.rate_limits AS rl (key, tokens, allowed, updated_at)
+VALUES ($1, $2::FLOAT8 - 1, TRUE, statement_timestamp())
+ON CONFLICT (key) DO UPDATE SET
+      tokens = CASE
+          WHEN LEAST($2::FLOAT8, rl.tokens + EXTRACT(EPOCH FROM (statement_timestamp() - rl.updated_at)) * $3::FLOAT8) >= 1
+          THEN LEAST($2::FLOAT8, rl.tokens + EXTRACT(EPOCH FROM (statement_timestamp() - rl.updated_at)) * $3::FLOAT8) - 1
+          ELSE LEAST($2::FLOAT8, rl.tokens + EXTRACT(EPOCH FROM (statement_timestamp() - rl.updated_at)) * $3::FLOAT8)
+      END
+    , allowed = LEAST($2::FLOAT8, rl.tokens + EXTRACT(EPOCH FROM (statement_timestamp() - rl.updated_at)) * $3::FLOAT8) >= 1
+    , updated_at = statement_timestamp()
+RETURNING tokens, allowed;
+`
+
+// Take takes a token from the bucket with the given key.
+func (s PostgresRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	var (
+		tokens  float64
+		allowed bool
+	)
+	err := s.db.Named("rate_limit.take").
+		QueryRowx(ctx, takeQuery, key, limit.Limit, limit.rate()).
+		Scan(&tokens, &allowed)
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("failed to take rate limit token for %s: %w", key, err)
+	}
+	return newRateLimitResult(limit, tokens, allowed), nil
+}
+
+// Purge deletes buckets that haven't been used for longer than olderThan,
+// which should be the longest limit period. They'd be full so are the same as
+// no bucket.
+func (s PostgresRateLimitStore) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	result, err := s.db.Named("rate_limit.purge").Exec(ctx,
+		`DELETE FROM autocrat.rate_limits WHERE updated_at < statement_timestamp() - make_interval(secs => $1);`,
+		olderThan.Seconds(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge rate limits: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nick96/cubapi/problem"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestMemoryRateLimitStoreRefills(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	limit := RateLimit{Limit: 2, Period: 10 * time.Second}
+	ctx := context.Background()
+
+	for i, want := range []bool{true, true, false} {
+		result, _ := store.Take(ctx, "client", limit)
+		if result.Allowed != want {
+			t.Fatalf("Expected request %d allowed=%v, got %+v", i, want, result)
+		}
+	}
+	result, _ := store.Take(ctx, "client", limit)
+	if result.RetryAfter != 5*time.Second {
+		t.Fatalf("Expected to retry after 5s, got %s", result.RetryAfter)
+	}
+
+	now = now.Add(5 * time.Second)
+	if result, _ := store.Take(ctx, "client", limit); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("Expected a token to have refilled, got %+v", result)
+	}
+	if result, _ := store.Take(ctx, "other", limit); !result.Allowed || result.Remaining != 1 {
+		t.Fatalf("Expected other clients to have their own bucket, got %+v", result)
+	}
+
+	now = now.Add(time.Hour)
+	store.Take(ctx, "new", limit)
+	if store.Len() != 1 {
+		t.Fatalf("Expected refilled buckets to be swept, got %d buckets", store.Len())
+	}
+}
+
+func TestRateLimiterRejectsWithProblem(t *testing.T) {
+	handler := RateLimiter(zap.NewNop(), NewMemoryRateLimitStore(), "test", RateLimit{Limit: 1, Period: time.Minute}, KeyByIP)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the first request to be allowed, got %d", w.Code)
+	}
+	if w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("RateLimit-Remaining") != "0" || w.Header().Get("RateLimit-Policy") != "1;w=60" {
+		t.Errorf("Expected rate limit headers, got %v", w.Header())
+	}
+
+	before := testutil.ToFloat64(httpRateLimited.WithLabelValues("test"))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected to retry after 60 seconds, got %q", w.Header().Get("Retry-After"))
+	}
+	var resp problem.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != problem.CodeRateLimited {
+		t.Errorf("Expected a rate limited problem, got %s", w.Body.String())
+	}
+	if after := testutil.ToFloat64(httpRateLimited.WithLabelValues("test")); after != before+1 {
+		t.Errorf("Expected the rejection to be counted, got %v then %v", before, after)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.2:1234"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected a different client to be allowed, got %d", w.Code)
+	}
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store is down")
+}
+
+func TestRateLimiterFailsOpen(t *testing.T) {
+	handler := RateLimiter(zap.NewNop(), failingRateLimitStore{}, "test", RateLimit{Limit: 1, Period: time.Minute}, KeyByIP)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the request to be allowed when the store fails, got %d", w.Code)
+	}
+}
+
+func TestFirstKey(t *testing.T) {
+	key := FirstKey(
+		KeyByUser(func(r *http.Request) (string, bool) { return r.Header.Get("X-User"), true }),
+		KeyByIP,
+	)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if got, _ := key(r); got != "ip:192.0.2.1" {
+		t.Errorf("Expected to fall back to the IP, got %q", got)
+	}
+	r.Header.Set("X-User", "test@test.com")
+	if got, _ := key(r); got != "user:test@test.com" {
+		t.Errorf("Expected the user, got %q", got)
+	}
+}
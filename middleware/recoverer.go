@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var httpPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_panics_total",
+	Help: "Number of HTTP handlers that panicked, by route pattern.",
+}, []string{"route"})
+
+// Recoverer is a middleware http handler that recovers from panics in later
+// handlers. The panic and its stack are logged, and the client gets an
+// internal error problem rather than a dropped connection. It should come
+// after the Logger and Metrics middleware so they record the failed request.
+func Recoverer(logger *zap.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				// ErrAbortHandler is used to deliberately abort a response,
+				// the server handles it quietly.
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				route := panicRoute(r)
+				httpPanics.WithLabelValues(route).Inc()
+				err := fmt.Errorf("panic: %v", rec)
+				tracing.SpanFromContext(r.Context()).RecordError(err)
+				logging.Logger(r.Context(), logger).Error("Recovered from panic in handler",
+					zap.String("method", r.Method),
+					zap.String("uri", r.RequestURI),
+					zap.Any("panic", rec),
+					zap.ByteString("stack", debug.Stack()),
+				)
+
+				// If the handler already started its response the status
+				// can't be changed, all we can do is cut the response short.
+				if ww.Status() != 0 {
+					return
+				}
+				problem.Write(ww, r, problem.Internal(err))
+			}()
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
+
+// panicRoute returns the route pattern of a request that has been routed.
+func panicRoute(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return matchRoute(r)
+}
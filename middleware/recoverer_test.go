@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	chimiddleware "github.com/go-chi/chi/middleware"
+	"github.com/nick96/cubapi/problem"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestRecovererRespondsWithProblem(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(chimiddleware.RequestID)
+	router.Use(Recoverer(zap.NewNop()))
+	router.Get("/panics/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]string
+		m["boom"] = "nil map"
+	})
+
+	before := testutil.ToFloat64(httpPanics.WithLabelValues("/panics/{id}"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/panics/1", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status code %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	var resp problem.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Expected a problem response, got %s: %v", w.Body.String(), err)
+	}
+	if resp.Code != problem.CodeInternal || resp.RequestID == "" {
+		t.Errorf("Expected an internal error problem with the request ID, got %+v", resp)
+	}
+	if resp.Detail != "" {
+		t.Errorf("Expected the panic not to be revealed to the client, got %q", resp.Detail)
+	}
+	if after := testutil.ToFloat64(httpPanics.WithLabelValues("/panics/{id}")); after != before+1 {
+		t.Errorf("Expected the panic to be counted, got %v then %v", before, after)
+	}
+}
+
+func TestRecovererAfterResponseStarted(t *testing.T) {
+	handler := Recoverer(zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		panic("too late")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusAccepted || w.Body.String() != "partial" {
+		t.Fatalf("Expected the started response to be left alone, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestRecovererRepanicsAbortHandler(t *testing.T) {
+	handler := Recoverer(zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Fatalf("Expected ErrAbortHandler to be re-panicked, got %v", rec)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
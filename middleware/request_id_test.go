@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/nick96/cubapi/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestIDOnlyTrustsProxies(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotID string
+	handler := RequestID(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = middleware.GetReqID(r.Context())
+	}))
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		id         string
+		keep       bool
+	}{
+		{"trusted-range", "10.1.2.3:4567", "from-traefik", true},
+		{"trusted-ip", "192.0.2.7:4567", "from-traefik", true},
+		{"untrusted", "192.0.2.8:4567", "forged", false},
+		{"trusted-without-id", "10.1.2.3:4567", "", false},
+		{"trusted-invalid-id", "10.1.2.3:4567", "has spaces\n", false},
+		{"trusted-long-id", "10.1.2.3:4567", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header.Set(RequestIDHeader, tt.id)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if gotID == "" || w.Header().Get(RequestIDHeader) != gotID {
+				t.Fatalf("Expected the request ID %q to be echoed, got %q", gotID, w.Header().Get(RequestIDHeader))
+			}
+			if (gotID == tt.id) != tt.keep {
+				t.Errorf("Expected keep=%v for %q, got %q", tt.keep, tt.id, gotID)
+			}
+		})
+	}
+}
+
+func TestRealIPOnlyTrustsProxies(t *testing.T) {
+	trusted, _ := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	var gotAddr string
+	handler := RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAddr = r.RemoteAddr
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.1.2.3:4567"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if gotAddr != "198.51.100.1" {
+		t.Errorf("Expected the forwarded address from a trusted proxy, got %q", gotAddr)
+	}
+
+	r.RemoteAddr = "192.0.2.8:4567"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if gotAddr != "192.0.2.8:4567" {
+		t.Errorf("Expected the forwarded address from anyone else to be ignored, got %q", gotAddr)
+	}
+}
+
+func TestParseTrustedProxiesRejectsInvalid(t *testing.T) {
+	if _, err := ParseTrustedProxies([]string{"traefik"}); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestLoggerIncludesRequestFields(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	router := chi.NewRouter()
+	router.Use(RequestID(nil))
+	router.Use(Logger(zap.New(core)))
+	router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logging.AddFields(r.Context(), zap.Int64("userID", 42))
+		logging.Logger(r.Context(), zap.New(core)).Info("Handled")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/users/1", nil))
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("Expected handler and request log lines, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		fields := entry.ContextMap()
+		if fields["requestID"] != w.Header().Get(RequestIDHeader) || fields["route"] != "/users/{id}" || fields["userID"] != int64(42) {
+			t.Errorf("Expected request fields in %q, got %v", entry.Message, fields)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/nick96/cubapi/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingUsesRoutePattern(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.NewProvider("test", exporter)
+	previous := otel.GetTracerProvider()
+	tracing.SetDefault(provider)
+	defer tracing.SetDefault(previous)
+	defer provider.Shutdown(context.Background())
+
+	router := chi.NewRouter()
+	router.Use(Tracing())
+	router.Get("/user/{userID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest("GET", "/user/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /user/{userID}" {
+		t.Errorf("Expected the span to be named after the route pattern, got %q", span.Name)
+	}
+	if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the span to continue the remote trace, got %s", span.SpanContext.TraceID())
+	}
+	if span.Status.Code != codes.Error {
+		t.Errorf("Expected a server error to fail the span, got %+v", span.Status)
+	}
+	var route string
+	for _, attr := range span.Attributes {
+		if attr.Key == attribute.Key("http.route") {
+			route = attr.Value.AsString()
+		}
+	}
+	if route != "/user/{userID}" {
+		t.Errorf("Expected the route attribute, got %q", route)
+	}
+}
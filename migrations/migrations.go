@@ -0,0 +1,361 @@
+// Package migrations holds the migrations of the autocrat schema, so the
+// schema can be created by the server and by store tests alike.
+package migrations
+
+import (
+	"time"
+
+	"github.com/nick96/cubapi/db/migrate"
+)
+
+var (
+	// All is the migrations to apply to an existing database, in order.
+	All = []migrate.Migration{
+		{
+			Version: 1,
+			Date:    time.Date(2020, 04, 12, 12, 23, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+CREATE SCHEMA autocrat
+    CREATE TABLE users (
+          id           SERIAL       PRIMARY KEY
+        , email        VARCHAR(256) NOT NULL
+        , firstname    VARCHAR(256) NOT NULL
+        , lastname     VARCHAR(256) NOT NULL
+        , password     CHAR(60)     NOT NULL
+        , salt         CHAR(10)     NOT NULL
+    );
+`,
+			Description: "Initial schema.",
+		},
+		{
+			Version: 2,
+			Date:    time.Date(2020, 04, 12, 14, 38, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+ALTER TABLE autocrat.users
+    DROP COLUMN salt;
+`,
+			Description: "Remove salt column as we're using bcrypt which generates the salt as part of the hash.",
+		},
+		{
+			Version: 3,
+			Date:    time.Date(2026, 10, 19, 9, 0, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+ALTER TABLE autocrat.users
+      ADD COLUMN roles    TEXT[]  NOT NULL DEFAULT '{}'
+    , ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+`,
+			Description: "Add roles and a disabled flag to users so they can be administered.",
+		},
+		{
+			Version: 4,
+			Date:    time.Date(2026, 10, 19, 12, 0, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+CREATE UNLOGGED TABLE autocrat.rate_limits (
+      key        TEXT             PRIMARY KEY
+    , tokens     DOUBLE PRECISION NOT NULL
+    , allowed    BOOLEAN          NOT NULL
+    , updated_at TIMESTAMPTZ      NOT NULL
+);
+`,
+			Description: "Add token buckets for rate limiting shared between replicas. They're unlogged as losing them in a crash only resets the limits.",
+		},
+		{
+			Version: 5,
+			Date:    time.Date(2026, 10, 19, 14, 0, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+CREATE TABLE autocrat.members (
+      id                 SERIAL       PRIMARY KEY
+    , firstname          VARCHAR(256) NOT NULL
+    , lastname           VARCHAR(256) NOT NULL
+    , date_of_birth      DATE         NOT NULL
+    , section            VARCHAR(32)  NOT NULL
+    , patrol             VARCHAR(256) NOT NULL DEFAULT ''
+    , joined_on          DATE         NOT NULL
+    , status             VARCHAR(32)  NOT NULL DEFAULT 'active'
+    , emergency_contacts JSONB        NOT NULL DEFAULT '[]'
+    , user_id            INTEGER      UNIQUE REFERENCES autocrat.users (id) ON DELETE SET NULL
+    , created_at         TIMESTAMPTZ  NOT NULL DEFAULT now()
+    , updated_at         TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+CREATE INDEX members_section_status_idx ON autocrat.members (section, status);
+`,
+			Description: "Add youth members, optionally linked to the user they sign in as.",
+		},
+		{
+			Version: 6,
+			Date:    time.Date(2026, 10, 19, 16, 0, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+CREATE TABLE autocrat.groups (
+      id         SERIAL       PRIMARY KEY
+    , name       VARCHAR(256) NOT NULL
+    , slug       VARCHAR(64)  NOT NULL UNIQUE
+    , created_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+CREATE TABLE autocrat.sections (
+      id         SERIAL       PRIMARY KEY
+    , group_id   INTEGER      NOT NULL REFERENCES autocrat.groups (id) ON DELETE CASCADE
+    , kind       VARCHAR(32)  NOT NULL
+    , name       VARCHAR(256) NOT NULL
+    , created_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+    , UNIQUE (group_id, kind)
+);
+
+CREATE TABLE autocrat.section_leaders (
+      section_id INTEGER NOT NULL REFERENCES autocrat.sections (id) ON DELETE CASCADE
+    , user_id    INTEGER NOT NULL REFERENCES autocrat.users (id) ON DELETE CASCADE
+    , PRIMARY KEY (section_id, user_id)
+);
+
+-- Everything that already exists belongs to a default group, with a section
+-- for every section members are already in, so the group can be required.
+INSERT INTO autocrat.groups (name, slug) VALUES ('Default', 'default');
+
+ALTER TABLE autocrat.users ADD COLUMN group_id INTEGER REFERENCES autocrat.groups (id);
+UPDATE autocrat.users SET group_id = (SELECT id FROM autocrat.groups WHERE slug = 'default');
+ALTER TABLE autocrat.users ALTER COLUMN group_id SET NOT NULL;
+
+-- Emails are unique regardless of case, as users sign in and are invited by
+-- email. Existing users may share an email so list them rather than fail on
+-- the index with no clue which users to fix.
+DO $$
+DECLARE
+    shared TEXT;
+BEGIN
+    SELECT string_agg(email, ', ' ORDER BY email) INTO shared
+    FROM (SELECT lower(email) AS email FROM autocrat.users GROUP BY lower(email) HAVING count(*) > 1) duplicates;
+    IF shared IS NOT NULL THEN
+        RAISE EXCEPTION 'emails must be unique, ignoring case, but users share %', shared
+            USING HINT = 'Change the email of all but one of the users with each email, then migrate again.';
+    END IF;
+END
+$$;
+CREATE UNIQUE INDEX users_email_idx ON autocrat.users (lower(email));
+CREATE INDEX users_group_idx ON autocrat.users (group_id);
+
+INSERT INTO autocrat.sections (group_id, kind, name)
+SELECT DISTINCT g.id, m.section, initcap(m.section)
+FROM autocrat.members m, autocrat.groups g
+WHERE g.slug = 'default';
+
+ALTER TABLE autocrat.members ADD COLUMN group_id INTEGER REFERENCES autocrat.groups (id);
+UPDATE autocrat.members SET group_id = (SELECT id FROM autocrat.groups WHERE slug = 'default');
+ALTER TABLE autocrat.members
+      ALTER COLUMN group_id SET NOT NULL
+    , ADD CONSTRAINT members_section_fkey FOREIGN KEY (group_id, section) REFERENCES autocrat.sections (group_id, kind);
+DROP INDEX autocrat.members_section_status_idx;
+CREATE INDEX members_group_section_status_idx ON autocrat.members (group_id, section, status);
+`,
+			Description: "Add scout groups and their sections, and scope users and members to a group.",
+		},
+		{
+			Version: 7,
+			Date:    time.Date(2026, 10, 19, 18, 0, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+CREATE TABLE autocrat.badges (
+      id           SERIAL PRIMARY KEY
+    , key          VARCHAR(64)   NOT NULL
+    , version      INTEGER       NOT NULL
+    , kind         VARCHAR(32)   NOT NULL
+    , name         VARCHAR(256)  NOT NULL
+    , stage        INTEGER       NOT NULL DEFAULT 0
+    , description  TEXT          NOT NULL DEFAULT ''
+    , sections     VARCHAR(32)[] NOT NULL
+    , requirements JSONB         NOT NULL
+    , retired      BOOLEAN       NOT NULL DEFAULT false
+    , created_at   TIMESTAMPTZ   NOT NULL DEFAULT now()
+    , UNIQUE (key, version)
+);
+`,
+			Description: "Add the badge catalogue, keeping every version of each badge.",
+		},
+		{
+			Version: 8,
+			Date:    time.Date(2026, 10, 19, 20, 0, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+CREATE TABLE autocrat.completions (
+      id             SERIAL PRIMARY KEY
+    , group_id       INTEGER     NOT NULL REFERENCES autocrat.groups (id) ON DELETE CASCADE
+    , member_id      INTEGER     NOT NULL REFERENCES autocrat.members (id) ON DELETE CASCADE
+    , badge_id       INTEGER     NOT NULL REFERENCES autocrat.badges (id)
+    , requirement_id VARCHAR(64) NOT NULL
+    , completed_on   DATE        NOT NULL
+    , notes          TEXT        NOT NULL DEFAULT ''
+    , status         VARCHAR(32) NOT NULL DEFAULT 'pending'
+    , recorded_by    INTEGER     REFERENCES autocrat.users (id) ON DELETE SET NULL
+    , recorded_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+    , signed_off_by  INTEGER     REFERENCES autocrat.users (id) ON DELETE SET NULL
+    , signed_off_at  TIMESTAMPTZ
+    , UNIQUE (member_id, badge_id, requirement_id)
+);
+CREATE INDEX completions_group_member_idx ON autocrat.completions (group_id, member_id);
+
+-- Events are only ever added, they are the history of who did what.
+CREATE TABLE autocrat.completion_events (
+      id            SERIAL PRIMARY KEY
+    , completion_id INTEGER     NOT NULL REFERENCES autocrat.completions (id) ON DELETE CASCADE
+    , action        VARCHAR(32) NOT NULL
+    , user_id       INTEGER     REFERENCES autocrat.users (id) ON DELETE SET NULL
+    , notes         TEXT        NOT NULL DEFAULT ''
+    , created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX completion_events_completion_idx ON autocrat.completion_events (completion_id);
+
+CREATE TABLE autocrat.completion_attachments (
+      id            SERIAL PRIMARY KEY
+    , completion_id INTEGER      NOT NULL REFERENCES autocrat.completions (id) ON DELETE CASCADE
+    , filename      VARCHAR(256) NOT NULL
+    , content_type  VARCHAR(256) NOT NULL
+    , data          BYTEA        NOT NULL
+    , uploaded_by   INTEGER      REFERENCES autocrat.users (id) ON DELETE SET NULL
+    , created_at    TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+CREATE INDEX completion_attachments_completion_idx ON autocrat.completion_attachments (completion_id);
+`,
+			Description: "Add badge progress: completions of requirements, their sign off history and attachments.",
+		},
+		{
+			Version: 9,
+			Date:    time.Date(2026, 10, 19, 21, 0, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+CREATE TABLE autocrat.meetings (
+      id         SERIAL PRIMARY KEY
+    , group_id   INTEGER      NOT NULL REFERENCES autocrat.groups (id) ON DELETE CASCADE
+    , section    VARCHAR(32)  NOT NULL
+    , held_on    DATE         NOT NULL
+    , location   VARCHAR(256) NOT NULL DEFAULT ''
+    , program    TEXT         NOT NULL DEFAULT ''
+    , created_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+    , updated_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+    , CONSTRAINT meetings_section_fkey FOREIGN KEY (group_id, section) REFERENCES autocrat.sections (group_id, kind)
+);
+CREATE INDEX meetings_group_held_on_idx ON autocrat.meetings (group_id, held_on);
+
+CREATE TABLE autocrat.attendance (
+      meeting_id  INTEGER     NOT NULL REFERENCES autocrat.meetings (id) ON DELETE CASCADE
+    , member_id   INTEGER     NOT NULL REFERENCES autocrat.members (id) ON DELETE CASCADE
+    , status      VARCHAR(32) NOT NULL
+    , recorded_by INTEGER     REFERENCES autocrat.users (id) ON DELETE SET NULL
+    , recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    , PRIMARY KEY (meeting_id, member_id)
+);
+CREATE INDEX attendance_member_idx ON autocrat.attendance (member_id);
+`,
+			Description: "Add section meetings and the attendance of members at them.",
+		},
+		{
+			Version: 10,
+			Date:    time.Date(2026, 10, 19, 22, 0, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+ALTER TABLE autocrat.meetings ADD COLUMN requirements JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE autocrat.completions ADD COLUMN meeting_id INTEGER REFERENCES autocrat.meetings (id) ON DELETE SET NULL;
+CREATE INDEX completions_meeting_idx ON autocrat.completions (meeting_id);
+`,
+			Description: "Add the badge requirements meetings meet and the meeting that credited a completion.",
+		},
+		{
+			Version: 11,
+			Date:    time.Date(2026, 10, 19, 23, 0, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+CREATE TABLE autocrat.events (
+      id         SERIAL PRIMARY KEY
+    , group_id   INTEGER      NOT NULL REFERENCES autocrat.groups (id) ON DELETE CASCADE
+    , kind       VARCHAR(32)  NOT NULL
+    , name       VARCHAR(256) NOT NULL
+    , location   VARCHAR(256) NOT NULL DEFAULT ''
+    , starts_on  DATE         NOT NULL
+    , ends_on    DATE         NOT NULL
+    , distance   NUMERIC(8,2) NOT NULL DEFAULT 0
+    , notes      TEXT         NOT NULL DEFAULT ''
+    , created_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+    , updated_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+    , CHECK (ends_on >= starts_on)
+);
+CREATE INDEX events_group_ends_on_idx ON autocrat.events (group_id, ends_on);
+
+CREATE TABLE autocrat.event_participants (
+      event_id  INTEGER NOT NULL REFERENCES autocrat.events (id) ON DELETE CASCADE
+    , member_id INTEGER NOT NULL REFERENCES autocrat.members (id) ON DELETE CASCADE
+    , PRIMARY KEY (event_id, member_id)
+);
+CREATE INDEX event_participants_member_idx ON autocrat.event_participants (member_id);
+
+CREATE TABLE autocrat.event_leaders (
+      event_id INTEGER NOT NULL REFERENCES autocrat.events (id) ON DELETE CASCADE
+    , user_id  INTEGER NOT NULL REFERENCES autocrat.users (id) ON DELETE CASCADE
+    , PRIMARY KEY (event_id, user_id)
+);
+`,
+			Description: "Add events, like camps, hikes and paddles, with the members taking part and the users leading them.",
+		},
+		{
+			Version: 12,
+			Date:    time.Date(2026, 10, 19, 23, 30, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+CREATE TABLE autocrat.guardians (
+      user_id       INTEGER     NOT NULL REFERENCES autocrat.users (id) ON DELETE CASCADE
+    , member_id     INTEGER     NOT NULL REFERENCES autocrat.members (id) ON DELETE CASCADE
+    , edit_contacts BOOLEAN     NOT NULL DEFAULT FALSE
+    , edit_details  BOOLEAN     NOT NULL DEFAULT FALSE
+    , created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+    , PRIMARY KEY (user_id, member_id)
+);
+CREATE INDEX guardians_member_idx ON autocrat.guardians (member_id);
+
+CREATE TABLE autocrat.guardian_invitations (
+      id            SERIAL PRIMARY KEY
+    , group_id      INTEGER      NOT NULL REFERENCES autocrat.groups (id) ON DELETE CASCADE
+    , email         VARCHAR(256) NOT NULL
+    , member_ids    INTEGER[]    NOT NULL
+    , edit_contacts BOOLEAN      NOT NULL DEFAULT FALSE
+    , edit_details  BOOLEAN      NOT NULL DEFAULT FALSE
+    , token_hash    TEXT         NOT NULL UNIQUE
+    , invited_by    INTEGER      REFERENCES autocrat.users (id) ON DELETE SET NULL
+    , created_at    TIMESTAMPTZ  NOT NULL DEFAULT now()
+    , expires_at    TIMESTAMPTZ  NOT NULL
+    , accepted_at   TIMESTAMPTZ
+    , accepted_by   INTEGER      REFERENCES autocrat.users (id) ON DELETE SET NULL
+);
+CREATE INDEX guardian_invitations_group_idx ON autocrat.guardian_invitations (group_id);
+`,
+			Description: "Add guardians of members, with what they may change about them, and invitations to become a guardian accepted with a hashed token.",
+		},
+		{
+			Version: 13,
+			Date:    time.Date(2026, 10, 19, 23, 45, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+ALTER TABLE autocrat.members ADD COLUMN membership_number VARCHAR(64) NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX members_membership_number_idx ON autocrat.members (group_id, membership_number)
+    WHERE membership_number <> '';
+`,
+			Description: "Add the number members have in the national membership system, which identifies them when rosters are imported.",
+		},
+		{
+			Version: 14,
+			Date:    time.Date(2026, 10, 20, 9, 30, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+ALTER TABLE autocrat.groups ADD COLUMN self_sign_up BOOLEAN NOT NULL DEFAULT FALSE;
+`,
+			Description: "Let groups choose whether anyone can sign up to them. Existing groups are closed, so their users must be created by an admin.",
+		},
+		{
+			Version: 15,
+			Date:    time.Date(2026, 10, 20, 10, 15, 0, 0, time.FixedZone("Australia/Melbourne", 10)),
+			SQL: `
+ALTER TABLE autocrat.members
+      ADD COLUMN section_since DATE
+    , ADD COLUMN status_since  DATE;
+-- When members moved section or stopped being active wasn't recorded, so the
+-- best guesses are when they joined and when they were last changed.
+UPDATE autocrat.members
+SET section_since = joined_on
+  , status_since = CASE WHEN status = 'active' THEN joined_on ELSE updated_at::DATE END;
+ALTER TABLE autocrat.members
+      ALTER COLUMN section_since SET NOT NULL
+    , ALTER COLUMN status_since SET NOT NULL;
+`,
+			Description: "Record when members moved to their section and changed status, so they're only expected at meetings they could have attended.",
+		},
+	}
+)
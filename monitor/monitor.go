@@ -1,17 +1,46 @@
 package monitor
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
 	"github.com/jmoiron/sqlx"
+	"github.com/nick96/cubapi/db"
 	"go.uber.org/zap"
 )
 
-type component interface {
+const (
+	// DefaultCheckTimeout is the default amount of time a component has to
+	// complete its health check.
+	DefaultCheckTimeout = 2 * time.Second
+	// DefaultCacheTTL is the default amount of time the result of a health
+	// check is reused for. This stops frequent probes from hammering the
+	// components.
+	DefaultCacheTTL = 2 * time.Second
+
+	statusOk       = "ok"
+	statusError    = "error"
+	statusDraining = "draining"
+)
+
+// Component is a part of the system whose health can be checked. Subsystems
+// implement this to have their health reported by the health router.
+type Component interface {
+	// Name returns the name of the component. This should be unique.
 	Name() string
-	Check(logger *zap.Logger) map[string]interface{}
-	CheckOk(logger *zap.Logger) bool
+	// Check checks the health of the component. It returns details about the
+	// component's state and an error if the component is unhealthy. Checks
+	// must respect the context's deadline.
+	Check(ctx context.Context, logger *zap.Logger) (map[string]interface{}, error)
 }
 
+// DBComponent checks the health of a database connection pool.
 type DBComponent struct {
 	DB *sqlx.DB
 }
@@ -20,29 +49,243 @@ func (c DBComponent) Name() string {
 	return "db"
 }
 
-func (c DBComponent) Check(logger *zap.Logger) map[string]interface{} {
-	return map[string]interface{}{}
+// Check pings the database and reports the round trip latency along with the
+// connection pool stats.
+func (c DBComponent) Check(ctx context.Context, logger *zap.Logger) (map[string]interface{}, error) {
+	start := time.Now()
+	err := c.DB.PingContext(ctx)
+	latency := time.Since(start)
+
+	stats := c.DB.Stats()
+	details := map[string]interface{}{
+		"pingLatency":        latency.String(),
+		"maxOpenConnections": stats.MaxOpenConnections,
+		"openConnections":    stats.OpenConnections,
+		"inUse":              stats.InUse,
+		"idle":               stats.Idle,
+		"waitCount":          stats.WaitCount,
+		"waitDuration":       stats.WaitDuration.String(),
+		"maxIdleClosed":      stats.MaxIdleClosed,
+		"maxLifetimeClosed":  stats.MaxLifetimeClosed,
+	}
+	if err != nil {
+		logger.Error("Failed health check ping", zap.String("component", c.Name()), zap.Error(err))
+		return details, fmt.Errorf("failed to ping database: %w", err)
+	}
+	return details, nil
 }
 
-func (c DBComponent) CheckOk(logger *zap.Logger) bool {
-	var err error
-	for i := 0; i < 20; i++ {
-		if err = c.DB.Ping(); err == nil {
-			return true
+// ReplicasComponent reports the state of the read replicas in a cluster. It is
+// never unhealthy as reads fall back to the primary when no replica is
+// healthy.
+type ReplicasComponent struct {
+	Cluster *db.Cluster
+}
+
+func (c ReplicasComponent) Name() string {
+	return "dbReplicas"
+}
+
+// Check reports the last known status of each replica.
+func (c ReplicasComponent) Check(ctx context.Context, logger *zap.Logger) (map[string]interface{}, error) {
+	statuses := c.Cluster.ReplicaStatuses()
+	healthy := 0
+	for _, status := range statuses {
+		if status.Healthy {
+			healthy++
 		}
-		logger.Error("Failed health check ping", zap.Int("try", i), zap.String("component", c.Name()), zap.Error(err))
 	}
-	logger.Error(
-		"Failed health check",
-		zap.String("check", "CheckOK"),
-		zap.String("component", c.Name()),
-		zap.Error(err),
-	)
-	return false
+	return map[string]interface{}{
+		"replicas": statuses,
+		"healthy":  healthy,
+	}, nil
+}
+
+// ComponentStatus is the result of checking a single component.
+type ComponentStatus struct {
+	Status  string                 `json:"status"`
+	Latency string                 `json:"latency"`
+	Error   string                 `json:"error,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report is the result of checking all the components.
+type Report struct {
+	Status     string                     `json:"status"`
+	CheckedAt  time.Time                  `json:"checkedAt"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// Ok returns true if all the components are healthy.
+func (r Report) Ok() bool {
+	return r.Status == statusOk
+}
+
+// Checker checks the health of a set of components. All components are
+// checked concurrently, each with its own timeout, and the result is cached
+// for a short time.
+type Checker struct {
+	logger     *zap.Logger
+	components []Component
+
+	// Timeout is the amount of time each component has to complete its
+	// check.
+	Timeout time.Duration
+	// CacheTTL is the amount of time a report is reused for.
+	CacheTTL time.Duration
+
+	mu       sync.Mutex
+	cached   *Report
+	draining int32
+}
+
+// NewChecker creates a checker for the given components with the default
+// timeout and cache TTL.
+func NewChecker(logger *zap.Logger, components ...Component) *Checker {
+	return &Checker{
+		logger:     logger,
+		components: components,
+		Timeout:    DefaultCheckTimeout,
+		CacheTTL:   DefaultCacheTTL,
+	}
+}
+
+// Check returns the health of all the components. A cached report is returned
+// if one was made within the cache TTL.
+//
+// The report is shared with every caller waiting on it, so the components are
+// checked on a context that isn't cancelled with the caller's, bounded by
+// Timeout instead. A failed report isn't cached if the caller's context is done
+// by the time it's made, in case that's why it failed.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cached != nil && time.Since(c.cached.CheckedAt) < c.CacheTTL {
+		return *c.cached
+	}
+
+	checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.Timeout)
+	defer cancel()
+	report := c.check(checkCtx)
+	if report.Ok() || ctx.Err() == nil {
+		c.cached = &report
+	}
+	return report
+}
+
+// Drain marks the service as shutting down so readiness checks fail and load
+// balancers stop sending it new requests. Liveness is unaffected.
+func (c *Checker) Drain() {
+	atomic.StoreInt32(&c.draining, 1)
+}
+
+// Draining reports whether Drain has been called.
+func (c *Checker) Draining() bool {
+	return atomic.LoadInt32(&c.draining) == 1
+}
+
+func (c *Checker) check(ctx context.Context) Report {
+	report := Report{
+		Status:     statusOk,
+		CheckedAt:  time.Now(),
+		Components: make(map[string]ComponentStatus, len(c.components)),
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, component := range c.components {
+		wg.Add(1)
+		go func(component Component) {
+			defer wg.Done()
+			status := c.checkComponent(ctx, component)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[component.Name()] = status
+			if status.Status != statusOk {
+				report.Status = statusError
+			}
+		}(component)
+	}
+	wg.Wait()
+	return report
+}
+
+type checkResult struct {
+	details map[string]interface{}
+	err     error
+}
+
+func (c *Checker) checkComponent(ctx context.Context, component Component) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	// Run the check in its own goroutine so a check that ignores its context
+	// can't hold up the whole report.
+	done := make(chan checkResult, 1)
+	go func() {
+		details, err := component.Check(ctx, c.logger)
+		done <- checkResult{details, err}
+	}()
+
+	var result checkResult
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result.err = fmt.Errorf("health check timed out after %s: %w", c.Timeout, ctx.Err())
+	}
+
+	status := ComponentStatus{
+		Status:  statusOk,
+		Latency: time.Since(start).String(),
+		Details: result.details,
+	}
+	if result.err != nil {
+		c.logger.Error("Failed health check", zap.String("component", component.Name()), zap.Error(result.err))
+		status.Status = statusError
+		status.Error = result.err.Error()
+	}
+	return status
 }
 
-func NewHealthRouter(logger *zap.Logger, components ...component) func(chi.Router) {
+// Router returns the health endpoints for the checker.
+//
+// GET /: Detailed status of every component.
+// GET /live: Liveness, this is always ok if the service can respond.
+// GET /ready: Readiness, this is only ok if all components are healthy and the
+// service isn't draining.
+func (c *Checker) Router() func(chi.Router) {
 	return func(r chi.Router) {
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			report := c.Check(r.Context())
+			render.Status(r, reportStatusCode(report))
+			render.JSON(w, r, report)
+		})
+		r.Get("/live", func(w http.ResponseWriter, r *http.Request) {
+			render.JSON(w, r, map[string]string{"status": statusOk})
+		})
+		r.Get("/ready", func(w http.ResponseWriter, r *http.Request) {
+			if c.Draining() {
+				render.Status(r, http.StatusServiceUnavailable)
+				render.JSON(w, r, map[string]string{"status": statusDraining})
+				return
+			}
+			report := c.Check(r.Context())
+			render.Status(r, reportStatusCode(report))
+			render.JSON(w, r, map[string]string{"status": report.Status})
+		})
+	}
+}
 
+func reportStatusCode(report Report) int {
+	if report.Ok() {
+		return http.StatusOK
 	}
+	return http.StatusServiceUnavailable
+}
+
+// NewHealthRouter creates a router for the health endpoints of the given
+// components using the default timeout and cache TTL. See Checker.Router.
+func NewHealthRouter(logger *zap.Logger, components ...Component) func(chi.Router) {
+	return NewChecker(logger, components...).Router()
 }
@@ -0,0 +1,170 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+type fakeComponent struct {
+	name  string
+	err   error
+	delay time.Duration
+	calls int32
+}
+
+func (c *fakeComponent) Name() string {
+	return c.name
+}
+
+func (c *fakeComponent) Check(ctx context.Context, logger *zap.Logger) (map[string]interface{}, error) {
+	atomic.AddInt32(&c.calls, 1)
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return map[string]interface{}{"checked": true}, c.err
+}
+
+func serve(checker *Checker, path string) *httptest.ResponseRecorder {
+	router := chi.NewRouter()
+	router.Route("/healthz", checker.Router())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	healthy := &fakeComponent{name: "healthy"}
+	unhealthy := &fakeComponent{name: "unhealthy", err: errors.New("broken")}
+
+	testCases := []struct {
+		name           string
+		path           string
+		components     []Component
+		expectedStatus int
+	}{
+		{"live", "/healthz/live", []Component{unhealthy}, http.StatusOK},
+		{"ready-ok", "/healthz/ready", []Component{healthy}, http.StatusOK},
+		{"ready-error", "/healthz/ready", []Component{healthy, unhealthy}, http.StatusServiceUnavailable},
+		{"detailed-ok", "/healthz", []Component{healthy}, http.StatusOK},
+		{"detailed-error", "/healthz", []Component{healthy, unhealthy}, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(NewChecker(zap.NewNop(), tt.components...), tt.path)
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDetailedReport(t *testing.T) {
+	healthy := &fakeComponent{name: "healthy"}
+	unhealthy := &fakeComponent{name: "unhealthy", err: errors.New("broken")}
+	w := serve(NewChecker(zap.NewNop(), healthy, unhealthy), "/healthz")
+
+	var report Report
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != statusError {
+		t.Fatalf("Expected overall status %s, got %s", statusError, report.Status)
+	}
+	if status := report.Components["healthy"]; status.Status != statusOk || status.Details["checked"] != true {
+		t.Fatalf("Unexpected status for healthy component: %+v", status)
+	}
+	if status := report.Components["unhealthy"]; status.Status != statusError || status.Error != "broken" {
+		t.Fatalf("Unexpected status for unhealthy component: %+v", status)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	slow := &fakeComponent{name: "slow", delay: time.Second}
+	checker := NewChecker(zap.NewNop(), slow)
+	checker.Timeout = 10 * time.Millisecond
+
+	start := time.Now()
+	report := checker.Check(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("Expected check to time out quickly, took %s", elapsed)
+	}
+	if report.Ok() {
+		t.Fatal("Expected timed out check to be unhealthy")
+	}
+}
+
+func TestCheckCached(t *testing.T) {
+	component := &fakeComponent{name: "component"}
+	checker := NewChecker(zap.NewNop(), component)
+	checker.CacheTTL = time.Hour
+
+	checker.Check(context.Background())
+	checker.Check(context.Background())
+	if calls := atomic.LoadInt32(&component.calls); calls != 1 {
+		t.Fatalf("Expected component to be checked once, was checked %d times", calls)
+	}
+
+	checker.CacheTTL = 0
+	checker.Check(context.Background())
+	if calls := atomic.LoadInt32(&component.calls); calls != 2 {
+		t.Fatalf("Expected component to be checked again once the cache expired, was checked %d times", calls)
+	}
+}
+
+func TestCheckOutlivesCaller(t *testing.T) {
+	component := &fakeComponent{name: "component", delay: 20 * time.Millisecond}
+	checker := NewChecker(zap.NewNop(), component)
+	checker.CacheTTL = time.Hour
+
+	// The first caller gives up before the check is done, which mustn't fail
+	// the report for everyone else.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if report := checker.Check(ctx); !report.Ok() {
+		t.Fatalf("Expected the check not to be cut short by the caller, got %+v", report)
+	}
+	if report := checker.Check(context.Background()); !report.Ok() {
+		t.Fatalf("Expected the cached report to be healthy, got %+v", report)
+	}
+	if calls := atomic.LoadInt32(&component.calls); calls != 1 {
+		t.Fatalf("Expected component to be checked once, was checked %d times", calls)
+	}
+}
+
+func TestFailedCheckOfCancelledCallerNotCached(t *testing.T) {
+	unhealthy := &fakeComponent{name: "unhealthy", err: errors.New("broken")}
+	checker := NewChecker(zap.NewNop(), unhealthy)
+	checker.CacheTTL = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	checker.Check(ctx)
+	checker.Check(context.Background())
+	if calls := atomic.LoadInt32(&unhealthy.calls); calls != 2 {
+		t.Fatalf("Expected the failed report of a cancelled caller not to be cached, was checked %d times", calls)
+	}
+}
+
+func TestDrainingFailsReadiness(t *testing.T) {
+	checker := NewChecker(zap.NewNop(), &fakeComponent{name: "healthy"})
+	checker.Drain()
+
+	if w := serve(checker, "/healthz/ready"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected draining service not to be ready, got status code %d", w.Code)
+	}
+	if w := serve(checker, "/healthz/live"); w.Code != http.StatusOK {
+		t.Fatalf("Expected draining service to be live, got status code %d", w.Code)
+	}
+}
@@ -0,0 +1,271 @@
+// Package openapi describes the API as an OpenAPI 3 document.
+//
+// Operations are described next to the handlers that implement them, and
+// request and response schemas are derived from the Go types the handlers
+// encode and decode, including their validator tags, so the document can't
+// drift far from the code. Routers are described the same way they are
+// mounted with chi:
+//
+//	spec := openapi.New("autocrat", "1.0.0")
+//	spec.Route("/user", user.DescribeUserRouter)
+//
+// See CheckRoutes and CheckResponse for keeping the two in step in tests.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/nick96/cubapi/problem"
+)
+
+// Version is the version of the OpenAPI specification documents follow.
+const Version = "3.0.3"
+
+// JSONContentType is the content type of JSON request and response bodies.
+const JSONContentType = "application/json"
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+
+	// types are the Go types of the schemas in the components, by name, so
+	// two types with the same name can be told apart.
+	types map[string]reflect.Type
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations on a path, keyed by lower case HTTP method.
+type PathItem map[string]*Operation
+
+// Operation is a single method on a path.
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path, query, header or cookie parameter of an operation.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes the body of a request.
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// Response describes a response to an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]*Header   `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header describes a response header.
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// MediaType describes a body of a particular content type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the schemas and security schemes referred to by the
+// operations.
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes a way of authenticating.
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+// New creates an empty document for the given version of the API.
+func New(title, version string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   make(map[string]*PathItem),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: make(map[string]*SecurityScheme),
+		},
+		types: make(map[string]reflect.Type),
+	}
+}
+
+// Route describes the operations of a router mounted at the pattern.
+func (d *Document) Route(pattern string, describe func(r *Router)) {
+	describe(&Router{doc: d, prefix: joinPath("", pattern)})
+}
+
+// SecurityScheme adds a security scheme operations can require by name.
+func (d *Document) SecurityScheme(name string, scheme *SecurityScheme) {
+	d.Components.SecuritySchemes[name] = scheme
+}
+
+// Operation returns the operation for the method and path, if it has been
+// described.
+func (d *Document) Operation(method, path string) (*Operation, bool) {
+	item, ok := d.Paths[joinPath("", path)]
+	if !ok {
+		return nil, false
+	}
+	op, ok := (*item)[strings.ToLower(method)]
+	return op, ok
+}
+
+// Handler serves the document as JSON.
+func (d *Document) Handler() http.Handler {
+	body, err := json.MarshalIndent(d, "", "  ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			problem.Write(w, r, problem.Internal(err))
+			return
+		}
+		w.Header().Set("Content-Type", JSONContentType)
+		w.Write(body)
+	})
+}
+
+// Router describes the operations of a chi router.
+type Router struct {
+	doc    *Document
+	prefix string
+}
+
+// Route describes the operations of a sub-router mounted at the pattern.
+func (r *Router) Route(pattern string, describe func(r *Router)) {
+	describe(&Router{doc: r.doc, prefix: joinPath(r.prefix, pattern)})
+}
+
+// Method describes the operation for the method and pattern.
+func (r *Router) Method(method, pattern string, op *Operation) {
+	path := joinPath(r.prefix, pattern)
+	item, ok := r.doc.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		r.doc.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+}
+
+// Get describes a GET operation.
+func (r *Router) Get(pattern string, op *Operation) {
+	r.Method(http.MethodGet, pattern, op)
+}
+
+// Post describes a POST operation.
+func (r *Router) Post(pattern string, op *Operation) {
+	r.Method(http.MethodPost, pattern, op)
+}
+
+// Put describes a PUT operation.
+func (r *Router) Put(pattern string, op *Operation) {
+	r.Method(http.MethodPut, pattern, op)
+}
+
+// Patch describes a PATCH operation.
+func (r *Router) Patch(pattern string, op *Operation) {
+	r.Method(http.MethodPatch, pattern, op)
+}
+
+// Delete describes a DELETE operation.
+func (r *Router) Delete(pattern string, op *Operation) {
+	r.Method(http.MethodDelete, pattern, op)
+}
+
+// Schema returns a reference to the schema of the value's type, adding it to
+// the document's components.
+func (r *Router) Schema(v interface{}) *Schema {
+	return r.doc.schema(reflect.TypeOf(v))
+}
+
+// JSONBody describes a required JSON request body of the value's type.
+func (r *Router) JSONBody(v interface{}) *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content:  map[string]MediaType{JSONContentType: {Schema: r.Schema(v)}},
+	}
+}
+
+// JSON describes a JSON response of the value's type.
+func (r *Router) JSON(description string, v interface{}) *Response {
+	return &Response{
+		Description: description,
+		Content:     map[string]MediaType{JSONContentType: {Schema: r.Schema(v)}},
+	}
+}
+
+// Problem describes a problem+json error response, see the problem package.
+func (r *Router) Problem(description string) *Response {
+	return &Response{
+		Description: description,
+		Content:     map[string]MediaType{problem.ContentType: {Schema: r.Schema(problem.Problem{})}},
+	}
+}
+
+// Empty describes a response without a body.
+func Empty(description string) *Response {
+	return &Response{Description: description}
+}
+
+// PathParam describes a required path parameter.
+func PathParam(name, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "path", Description: description, Required: true, Schema: schema}
+}
+
+// operations returns the "METHOD path" of every operation in the document, sorted.
+func (d *Document) operations() []string {
+	var ops []string
+	for path, item := range d.Paths {
+		for method := range *item {
+			ops = append(ops, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// joinPath joins route patterns the way chi mounts them. Trailing slashes are
+// dropped as chi serves the root of a sub-router both with and without one.
+func joinPath(prefix, pattern string) string {
+	path := strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(pattern, "/")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
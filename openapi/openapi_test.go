@@ -0,0 +1,147 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+type testAddress struct {
+	Street string `json:"street"`
+}
+
+type testRequest struct {
+	Name      string            `json:"name" validate:"required,min=2,max=10"`
+	Email     string            `json:"email" validate:"email"`
+	Kind      string            `json:"kind" validate:"oneof=a b"`
+	Age       int               `json:"age,omitempty" validate:"omitempty,min=5"`
+	Tags      []string          `json:"tags" validate:"max=3"`
+	Born      time.Time         `json:"born"`
+	Address   *testAddress      `json:"address,omitempty"`
+	Extra     map[string]string `json:"extra,omitempty"`
+	Secret    string            `json:"-"`
+	unexposed string
+}
+
+func TestSchemaFromType(t *testing.T) {
+	doc := New("test", "1")
+	var r Router
+	r.doc = doc
+	ref := r.Schema(testRequest{})
+	if ref.Ref != "#/components/schemas/testRequest" {
+		t.Fatalf("Expected a reference to the component, got %+v", ref)
+	}
+
+	s := doc.Components.Schemas["testRequest"]
+	if !reflect.DeepEqual(s.Required, []string{"name", "email", "kind", "tags", "born"}) {
+		t.Errorf("Expected fields without omitempty to be required, got %v", s.Required)
+	}
+	if _, ok := s.Properties["Secret"]; ok || len(s.Properties) != 8 {
+		t.Errorf("Expected unencoded fields to be left out, got %v", s.Properties)
+	}
+	name := s.Properties["name"]
+	if *name.MinLength != 2 || *name.MaxLength != 10 {
+		t.Errorf("Expected length bounds from the validator tag, got %+v", name)
+	}
+	if s.Properties["email"].Format != "email" || s.Properties["born"].Format != "date-time" {
+		t.Errorf("Expected formats, got %+v and %+v", s.Properties["email"], s.Properties["born"])
+	}
+	if !reflect.DeepEqual(s.Properties["kind"].Enum, []interface{}{"a", "b"}) {
+		t.Errorf("Expected an enum, got %v", s.Properties["kind"].Enum)
+	}
+	if *s.Properties["age"].Minimum != 5 || *s.Properties["tags"].MaxItems != 3 {
+		t.Errorf("Expected value and size bounds, got %+v and %+v", s.Properties["age"], s.Properties["tags"])
+	}
+	if s.Properties["address"].Ref != "#/components/schemas/testAddress" {
+		t.Errorf("Expected nested structs to be referenced, got %+v", s.Properties["address"])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	doc := New("test", "1")
+	r := &Router{doc: doc}
+	schema := r.Schema(testRequest{})
+
+	valid := `{"name":"Bob","email":"bob@test.com","kind":"a","tags":null,"born":"2020-01-01T00:00:00Z","address":{"street":"Main"}}`
+	var value interface{}
+	json.Unmarshal([]byte(valid), &value)
+	if err := doc.Validate(schema, value); err != nil {
+		t.Fatalf("Expected %s to be valid: %v", valid, err)
+	}
+
+	testCases := map[string]string{
+		"missing":    `{"email":"bob@test.com","kind":"a","tags":[],"born":""}`,
+		"too-short":  `{"name":"B","email":"bob@test.com","kind":"a","tags":[],"born":""}`,
+		"enum":       `{"name":"Bob","email":"bob@test.com","kind":"c","tags":[],"born":""}`,
+		"type":       `{"name":1,"email":"bob@test.com","kind":"a","tags":[],"born":""}`,
+		"extra":      `{"name":"Bob","email":"bob@test.com","kind":"a","tags":[],"born":"","nickname":"B"}`,
+		"nested":     `{"name":"Bob","email":"bob@test.com","kind":"a","tags":[],"born":"","address":{}}`,
+		"items":      `{"name":"Bob","email":"bob@test.com","kind":"a","tags":[1],"born":""}`,
+		"not-email":  `{"name":"Bob","email":"bob","kind":"a","tags":[],"born":""}`,
+		"too-many":   `{"name":"Bob","email":"bob@test.com","kind":"a","tags":["a","b","c","d"],"born":""}`,
+		"not-object": `[]`,
+	}
+	for name, body := range testCases {
+		var value interface{}
+		json.Unmarshal([]byte(body), &value)
+		if err := doc.Validate(schema, value); err == nil {
+			t.Errorf("Expected %s to be invalid: %s", name, body)
+		}
+	}
+}
+
+func TestCheckRoutes(t *testing.T) {
+	router := chi.NewRouter()
+	router.Route("/things", func(r chi.Router) {
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	doc := New("test", "1")
+	doc.Route("/things", func(r *Router) {
+		r.Get("/", &Operation{OperationID: "listThings"})
+		r.Delete("/{id}", &Operation{OperationID: "deleteThing"})
+	})
+
+	err := doc.CheckRoutes(router)
+	if err == nil {
+		t.Fatal("Expected the routes not to match")
+	}
+	for _, want := range []string{"DELETE /things/{id} is described but not routed", "GET /things/{id} is routed but not described"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "GET /things ") {
+		t.Errorf("Expected the root of the sub-router to match, got %v", err)
+	}
+}
+
+func TestCheckRequestContentTypes(t *testing.T) {
+	doc := New("test", "1")
+	doc.Route("/things", func(r *Router) {
+		r.Post("/", &Operation{OperationID: "createThing", RequestBody: r.JSONBody(testAddress{})})
+		r.Post("/{id}/file", &Operation{
+			OperationID: "uploadFile",
+			RequestBody: &RequestBody{Required: true, Content: map[string]MediaType{"*/*": {Schema: &Schema{Type: "string", Format: "binary"}}}},
+		})
+	})
+
+	if err := doc.CheckRequest("POST", "/things", JSONContentType, []byte(`{"street":"Main"}`)); err != nil {
+		t.Errorf("Expected a JSON body matching the schema to be valid: %v", err)
+	}
+	if err := doc.CheckRequest("POST", "/things", JSONContentType, []byte(`{}`)); err == nil {
+		t.Error("Expected a JSON body not matching the schema to be invalid")
+	}
+	if err := doc.CheckRequest("POST", "/things", "text/plain", []byte(`Main`)); err == nil {
+		t.Error("Expected an undescribed content type to be invalid")
+	}
+	if err := doc.CheckRequest("POST", "/things/{id}/file", "image/png", []byte{0x89, 'P', 'N', 'G'}); err != nil {
+		t.Errorf("Expected any file to be accepted: %v", err)
+	}
+}
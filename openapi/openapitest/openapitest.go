@@ -0,0 +1,99 @@
+// Package openapitest checks that handlers behave as the OpenAPI document
+// describing them says they do.
+package openapitest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nick96/cubapi/openapi"
+)
+
+// Case is a request made to the handler and the status code it's expected to
+// respond with.
+type Case struct {
+	Name   string
+	Method string
+	// Pattern is the path of the operation in the document, e.g.
+	// "/member/{memberID}".
+	Pattern string
+	// Path is the path the request is made to, defaulting to Pattern.
+	Path string
+	// ContentType is the media type of Body, defaulting to JSON.
+	ContentType string
+	Body        string
+	// Invalid bodies are deliberately not what the document describes, so
+	// they aren't checked against it.
+	Invalid bool
+	// Header is added to the request.
+	Header http.Header
+	Status int
+}
+
+// Run makes the request of each case to the handler in a subtest. The request
+// must match the document unless its body is invalid, and the response must
+// have the expected status code and match the document.
+func Run(t *testing.T, doc *openapi.Document, handler http.Handler, cases []Case) {
+	t.Helper()
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			path, contentType := tt.Path, tt.ContentType
+			if path == "" {
+				path = tt.Pattern
+			}
+			if contentType == "" {
+				contentType = openapi.JSONContentType
+			}
+			if !tt.Invalid {
+				if err := doc.CheckRequest(tt.Method, tt.Pattern, contentType, []byte(tt.Body)); err != nil {
+					t.Fatalf("Test request doesn't match the document: %v", err)
+				}
+			}
+
+			r := httptest.NewRequest(tt.Method, path, strings.NewReader(tt.Body))
+			r.Header.Set("Content-Type", contentType)
+			for key, values := range tt.Header {
+				for _, value := range values {
+					r.Header.Add(key, value)
+				}
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.Status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.Status, resp.StatusCode, body)
+			}
+			if err := doc.CheckResponse(tt.Method, tt.Pattern, resp, body); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// Do makes a request with the body to the handler and decodes the response
+// into v unless it's nil. The body is JSON unless the header, which is added
+// to the request, sets another content type.
+func Do(t *testing.T, handler http.Handler, method, path, body string, v interface{}, header ...http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", openapi.JSONContentType)
+	for _, h := range header {
+		for key, values := range h {
+			r.Header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("Failed to decode %s: %v", w.Body.String(), err)
+		}
+	}
+	return w
+}
@@ -0,0 +1,284 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON schema, as far as OpenAPI supports them.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+}
+
+// Describer is implemented by types that describe their own schema, usually
+// because they have a custom JSON encoding.
+type Describer interface {
+	OpenAPISchema() *Schema
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	describerType  = reflect.TypeOf((*Describer)(nil)).Elem()
+)
+
+// String returns a schema for strings.
+func String() *Schema {
+	return &Schema{Type: "string"}
+}
+
+// Integer returns a schema for 64 bit integers.
+func Integer() *Schema {
+	return &Schema{Type: "integer", Format: "int64"}
+}
+
+// Enum returns a schema for strings that must be one of the values.
+func Enum(values []string) *Schema {
+	s := String()
+	for _, value := range values {
+		s.Enum = append(s.Enum, value)
+	}
+	return s
+}
+
+// schema returns the schema of the type. Named struct types are added to the
+// components and referred to, everything else is described inline.
+func (d *Document) schema(t reflect.Type) *Schema {
+	switch {
+	case t.Kind() != reflect.Ptr && t.Implements(describerType):
+		return reflect.Zero(t).Interface().(Describer).OpenAPISchema()
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := d.schema(t.Elem())
+		if s.Ref != "" {
+			// Siblings of $ref are ignored so nullable can't be set on it.
+			return s
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return Integer()
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return String()
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		// Nil slices and maps are encoded as null.
+		return &Schema{Type: "array", Items: d.schema(t.Elem()), Nullable: true}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem()), Nullable: true}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		return d.ref(t)
+	}
+	// Anything else (interfaces, custom marshalers) can be any JSON value.
+	return &Schema{}
+}
+
+// ref adds the named struct type to the components and returns a reference to
+// it. Types from different packages with the same name are told apart by
+// prefixing the package name.
+func (d *Document) ref(t reflect.Type) *Schema {
+	name := t.Name()
+	if existing, ok := d.types[name]; ok && existing != t {
+		pkg := t.PkgPath()
+		name = strings.Title(pkg[strings.LastIndex(pkg, "/")+1:]) + name
+	}
+	if _, ok := d.types[name]; !ok {
+		d.types[name] = t
+		// Reserve the name before describing the fields so recursive types
+		// refer to themselves rather than recursing forever.
+		d.Components.Schemas[name] = &Schema{}
+		*d.Components.Schemas[name] = *d.structSchema(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// structSchema describes the JSON encoding of a struct. Fields are named as
+// encoding/json names them and are required unless they are omitempty.
+// Validator tags add constraints, see applyValidation.
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+		// Documented types are exactly what is sent, anything extra is a
+		// mismatch between the spec and the code.
+		AdditionalProperties: false,
+	}
+	d.addFields(s, t)
+	return s
+}
+
+func (d *Document) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, omitempty, skip := jsonName(field)
+		if skip {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				d.addFields(s, embedded)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := d.schema(field.Type)
+		validate := field.Tag.Get("validate")
+		if property.Ref == "" {
+			applyValidation(property, field.Type, validate)
+		}
+		s.Properties[name] = property
+		if !omitempty && !hasTag(validate, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// jsonName returns the name of the field in its JSON encoding, whether it is
+// omitted when empty, and whether it is never encoded at all.
+func jsonName(field reflect.StructField) (name string, omitempty bool, skip bool) {
+	if field.PkgPath != "" && !field.Anonymous {
+		return "", false, true
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitempty = true
+		}
+	}
+	return parts[0], omitempty, false
+}
+
+// applyValidation adds the constraints of validator tags (see
+// gopkg.in/go-playground/validator.v9) that JSON schema can express.
+func applyValidation(s *Schema, t reflect.Type, validate string) {
+	for _, rule := range strings.Split(validate, ",") {
+		// Rules after dive apply to the elements of the field.
+		if rule == "dive" {
+			return
+		}
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "email":
+			s.Format = "email"
+		case "url", "uri":
+			s.Format = "uri"
+		case "uuid", "uuid4":
+			s.Format = "uuid"
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				s.Enum = append(s.Enum, enumValue(t, value))
+			}
+		case "min", "max", "len", "gte", "lte":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			setBound(s, name, n)
+		}
+	}
+}
+
+// setBound sets the length, size or value bound named by a validator rule.
+// The validator applies these to whatever the field holds, so the bound is
+// a length for strings, a size for arrays and a value for numbers.
+func setBound(s *Schema, rule string, n float64) {
+	lower := rule == "min" || rule == "gte" || rule == "len"
+	upper := rule == "max" || rule == "lte" || rule == "len"
+	count := int(n)
+	switch s.Type {
+	case "string":
+		if lower {
+			s.MinLength = &count
+		}
+		if upper {
+			s.MaxLength = &count
+		}
+	case "array":
+		if lower {
+			s.MinItems = &count
+		}
+		if upper {
+			s.MaxItems = &count
+		}
+	case "integer", "number":
+		if lower {
+			s.Minimum = &n
+		}
+		if upper {
+			s.Maximum = &n
+		}
+	}
+}
+
+func enumValue(t reflect.Type, value string) interface{} {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+func hasTag(tag, name string) bool {
+	for _, rule := range strings.Split(tag, ",") {
+		if rule == "dive" {
+			return false
+		}
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi"
+)
+
+// emailPattern is a loose check of the email format. The validator is the
+// authority on what is accepted, this only catches values that clearly
+// aren't emails.
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+$`)
+
+// Validate checks that the decoded JSON value (as decoded by encoding/json
+// into an interface{}) matches the schema. References are resolved against
+// the document's components.
+func (d *Document) Validate(schema *Schema, value interface{}) error {
+	var problems []string
+	d.validate(schema, value, "$", &problems)
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (d *Document) validate(schema *Schema, value interface{}, at string, problems *[]string) {
+	fail := func(format string, args ...interface{}) {
+		*problems = append(*problems, at+": "+fmt.Sprintf(format, args...))
+	}
+
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		resolved, ok := d.Components.Schemas[name]
+		if !ok {
+			fail("unknown schema %s", schema.Ref)
+			return
+		}
+		schema = resolved
+	}
+	if value == nil {
+		if !schema.Nullable && schema.Type != "" {
+			fail("is null")
+		}
+		return
+	}
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		fail("%v is not one of %v", value, schema.Enum)
+	}
+
+	switch schema.Type {
+	case "":
+		// Any value is allowed.
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("expected a boolean, got %T", value)
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			fail("expected a number, got %T", value)
+			return
+		}
+		if schema.Type == "integer" && n != float64(int64(n)) {
+			fail("expected an integer, got %v", n)
+		}
+		if schema.Minimum != nil && n < *schema.Minimum {
+			fail("%v is less than %v", n, *schema.Minimum)
+		}
+		if schema.Maximum != nil && n > *schema.Maximum {
+			fail("%v is more than %v", n, *schema.Maximum)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			fail("expected a string, got %T", value)
+			return
+		}
+		length := utf8.RuneCountInString(s)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			fail("is shorter than %d", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			fail("is longer than %d", *schema.MaxLength)
+		}
+		if schema.Format == "email" && !emailPattern.MatchString(s) {
+			fail("%q is not an email", s)
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			fail("expected an array, got %T", value)
+			return
+		}
+		if schema.MinItems != nil && len(items) < *schema.MinItems {
+			fail("has fewer than %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(items) > *schema.MaxItems {
+			fail("has more than %d items", *schema.MaxItems)
+		}
+		for i, item := range items {
+			d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", at, i), problems)
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			fail("expected an object, got %T", value)
+			return
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if !ok {
+				switch additional := schema.AdditionalProperties.(type) {
+				case *Schema:
+					property = additional
+				case bool:
+					if !additional {
+						fail("unexpected property %q", name)
+						continue
+					}
+				}
+			}
+			if property != nil {
+				d.validate(property, object[name], at+"."+name, problems)
+			}
+		}
+	}
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRoutes checks that every route of the router is described in the
+// document and that every operation in the document is routed. Routes with
+// an unmatched pattern, like mounted file servers, should be left out of the
+// router being checked.
+func (d *Document) CheckRoutes(routes chi.Routes) error {
+	routed := make(map[string]bool)
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		routed[method+" "+walkedPath(route)] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	described := make(map[string]bool)
+	for _, op := range d.operations() {
+		described[op] = true
+		if !routed[op] {
+			problems = append(problems, fmt.Sprintf("%s is described but not routed", op))
+		}
+	}
+	var undescribed []string
+	for op := range routed {
+		if !described[op] {
+			undescribed = append(undescribed, fmt.Sprintf("%s is routed but not described", op))
+		}
+	}
+	sort.Strings(undescribed)
+	problems = append(problems, undescribed...)
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// walkedPath converts a route reported by chi.Walk to a path. chi reports
+// routes of sub-routers with the wildcard they are mounted at, e.g.
+// "/user/*/me" for "/me" in a router mounted at "/user".
+func walkedPath(route string) string {
+	route = strings.Replace(route, "/*/", "/", -1)
+	return joinPath("", strings.TrimSuffix(route, "/*"))
+}
+
+// CheckRequest checks that a request body matches the operation's
+// description.
+func (d *Document) CheckRequest(method, path, contentType string, body []byte) error {
+	op, ok := d.Operation(method, path)
+	if !ok {
+		return fmt.Errorf("%s %s is not described", method, path)
+	}
+	if op.RequestBody == nil {
+		if len(body) > 0 {
+			return fmt.Errorf("%s %s is described without a request body", method, path)
+		}
+		return nil
+	}
+	return d.checkContent(op.RequestBody.Content, contentType, body)
+}
+
+// CheckResponse checks that a response matches the operation's description:
+// its status code must be described and its body must match the schema of
+// its content type.
+func (d *Document) CheckResponse(method, path string, resp *http.Response, body []byte) error {
+	op, ok := d.Operation(method, path)
+	if !ok {
+		return fmt.Errorf("%s %s is not described", method, path)
+	}
+	described, ok := op.Responses[fmt.Sprint(resp.StatusCode)]
+	if !ok {
+		return fmt.Errorf("%s %s responded with undescribed status %d: %s", method, path, resp.StatusCode, body)
+	}
+	if len(described.Content) == 0 {
+		if len(body) > 0 {
+			return fmt.Errorf("%s %s %d is described without a body, got %s", method, path, resp.StatusCode, body)
+		}
+		return nil
+	}
+	if err := d.checkContent(described.Content, resp.Header.Get("Content-Type"), body); err != nil {
+		return fmt.Errorf("%s %s %d: %w", method, path, resp.StatusCode, err)
+	}
+	return nil
+}
+
+// checkContent checks the body is of a described content type. Only JSON
+// bodies are checked against their schema, anything else, like a file, is
+// opaque. A described "*/*" content type accepts any content type.
+func (d *Document) checkContent(content map[string]MediaType, contentType string, body []byte) error {
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	described, ok := content[mediaType]
+	if !ok {
+		described, ok = content["*/*"]
+	}
+	if !ok {
+		return fmt.Errorf("content type %q is not described", contentType)
+	}
+	if !isJSON(mediaType) {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("body isn't JSON: %w", err)
+	}
+	return d.Validate(described.Schema, value)
+}
+
+// isJSON reports whether the media type is JSON, including structured
+// syntax suffixes like application/problem+json.
+func isJSON(mediaType string) bool {
+	return mediaType == JSONContentType || strings.HasSuffix(mediaType, "+json")
+}
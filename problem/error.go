@@ -0,0 +1,44 @@
+package problem
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error is an error caused by the request, with a code that tells clients
+// what was wrong. Its message is safe to show to clients, while the error it
+// wraps is only logged.
+type Error struct {
+	code    Code
+	message string
+	err     error
+}
+
+// NewError creates an error with the code and a message safe to show to
+// clients, caused by err.
+func NewError(code Code, message string, err error) Error {
+	return Error{code: code, message: message, err: err}
+}
+
+// Invalid creates an error for a request that can't be done, with the
+// formatted message.
+func Invalid(format string, args ...interface{}) Error {
+	message := fmt.Sprintf(format, args...)
+	return NewError(CodeValidationFailed, message, errors.New(message))
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.message, e.err)
+}
+
+func (e Error) SafeError() string {
+	return e.message
+}
+
+func (e Error) Unwrap() error {
+	return e.err
+}
+
+func (e Error) ProblemCode() Code {
+	return e.code
+}
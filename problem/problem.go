@@ -0,0 +1,195 @@
+// Package problem defines the error responses of the API. Errors are RFC 7807
+// problem details (application/problem+json) extended with a stable,
+// machine-readable code, the ID of the request that failed and, for invalid
+// requests, the fields that failed validation.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	chimiddleware "github.com/go-chi/chi/middleware"
+	"github.com/nick96/cubapi/security"
+)
+
+// ContentType is the media type of problem responses.
+const ContentType = "application/problem+json"
+
+// Code identifies the kind of a problem. Codes are part of the API so they
+// must never change once released; clients branch on them instead of on
+// messages.
+type Code string
+
+const (
+	CodeMalformedRequest     Code = "malformed_request"
+	CodeValidationFailed     Code = "validation_failed"
+	CodeAuthenticationFailed Code = "authentication_failed"
+	CodeForbidden            Code = "forbidden"
+	CodeInvalidCSRFToken     Code = "invalid_csrf_token"
+	CodeNotFound             Code = "not_found"
+	CodeMethodNotAllowed     Code = "method_not_allowed"
+	CodeUserAlreadyExists    Code = "user_already_exists"
+	CodeRateLimited          Code = "rate_limited"
+	CodeInternal             Code = "internal_error"
+)
+
+type codeInfo struct {
+	status int
+	title  string
+}
+
+var codes = map[Code]codeInfo{
+	CodeMalformedRequest:     {http.StatusBadRequest, "Malformed request"},
+	CodeValidationFailed:     {http.StatusBadRequest, "Validation failed"},
+	CodeAuthenticationFailed: {http.StatusForbidden, "Authentication failed"},
+	CodeForbidden:            {http.StatusForbidden, "Forbidden"},
+	CodeInvalidCSRFToken:     {http.StatusForbidden, "Missing or invalid CSRF token"},
+	CodeNotFound:             {http.StatusNotFound, "Not found"},
+	CodeMethodNotAllowed:     {http.StatusMethodNotAllowed, "Method not allowed"},
+	CodeUserAlreadyExists:    {http.StatusBadRequest, "User already exists"},
+	CodeRateLimited:          {http.StatusTooManyRequests, "Too many requests"},
+	CodeInternal:             {http.StatusInternalServerError, "Internal error"},
+}
+
+// Register registers a code with the status and title of its problems. It
+// should be called from an init function of the package defining the code.
+func Register(code Code, status int, title string) {
+	if _, ok := codes[code]; ok {
+		panic("problem: code " + string(code) + " registered twice")
+	}
+	codes[code] = codeInfo{status, title}
+}
+
+// Status returns the HTTP status of problems with the code.
+func (c Code) Status() int {
+	if info, ok := codes[c]; ok {
+		return info.status
+	}
+	return http.StatusInternalServerError
+}
+
+// Title returns the summary of problems with the code.
+func (c Code) Title() string {
+	if info, ok := codes[c]; ok {
+		return info.title
+	}
+	return http.StatusText(c.Status())
+}
+
+// Coder is implemented by errors that know which problem they are. FromError
+// uses it to pick the code of a problem.
+type Coder interface {
+	ProblemCode() Code
+}
+
+// FieldError describes why a field of the request is invalid.
+type FieldError struct {
+	// Field is the path to the field using its JSON name, e.g. "email".
+	Field string `json:"field"`
+	// Tag is the validation rule that failed, e.g. "required".
+	Tag string `json:"tag"`
+	// Param is the parameter of the rule, e.g. "6" for "min=6".
+	Param string `json:"param,omitempty"`
+	// Message describes the failure for people.
+	Message string `json:"message"`
+}
+
+// Problem is an error response.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      Code         `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+
+	cause error
+}
+
+// New creates a problem with the code's status and title.
+func New(code Code, detail string) *Problem {
+	return &Problem{
+		Type:   "/problems/" + string(code),
+		Title:  code.Title(),
+		Status: code.Status(),
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// FromError creates a problem from an error. If the error (or one it wraps)
+// is a Coder its code is used, otherwise the given code is. The detail is the
+// error's safe message if it is a security.ClientError and the code's title
+// otherwise, so internal details are never leaked to clients. The error is
+// kept as the cause of the problem.
+func FromError(code Code, err error) *Problem {
+	var coder Coder
+	if errors.As(err, &coder) {
+		code = coder.ProblemCode()
+	}
+	detail := code.Title()
+	var clientErr security.ClientError
+	if errors.As(err, &clientErr) {
+		detail = clientErr.SafeError()
+	}
+	p := New(code, detail)
+	p.cause = err
+	return p
+}
+
+// Internal creates an internal error problem. The error is kept as the cause
+// but never shown to clients.
+func Internal(err error) *Problem {
+	p := New(CodeInternal, "")
+	p.cause = err
+	return p
+}
+
+// Error returns the problem as a string, including its cause. This is suitable
+// for logging but not for returning to clients.
+func (p *Problem) Error() string {
+	message := string(p.Code)
+	if p.Detail != "" {
+		message += ": " + p.Detail
+	}
+	if p.cause != nil {
+		message += ": " + p.cause.Error()
+	}
+	return message
+}
+
+// Unwrap returns the error that caused the problem.
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+// Write writes the problem as the response to the request. The problem's
+// instance and request ID are set from the request.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	p.Instance = r.URL.Path
+	p.RequestID = chimiddleware.GetReqID(r.Context())
+	body, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	w.Write(body)
+}
+
+// NotFound responds with a not found problem. It can be used as a router's
+// NotFound handler.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, New(CodeNotFound, "No resource exists at this path"))
+}
+
+// MethodNotAllowed responds with a method not allowed problem. It can be used
+// as a router's MethodNotAllowed handler.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, New(CodeMethodNotAllowed, r.Method+" is not supported at this path"))
+}
@@ -0,0 +1,116 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	chimiddleware "github.com/go-chi/chi/middleware"
+	"github.com/nick96/cubapi/security"
+)
+
+type conflictError struct{}
+
+func (conflictError) Error() string {
+	return "conflict"
+}
+
+func (conflictError) ProblemCode() Code {
+	return CodeUserAlreadyExists
+}
+
+func write(t *testing.T, p *Problem) (*httptest.ResponseRecorder, Problem) {
+	r := httptest.NewRequest("POST", "/user", nil)
+	r = r.WithContext(context.WithValue(r.Context(), chimiddleware.RequestIDKey, "request-1"))
+	w := httptest.NewRecorder()
+	Write(w, r, p)
+
+	var written Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &written); err != nil {
+		t.Fatal(err)
+	}
+	return w, written
+}
+
+func TestWrite(t *testing.T) {
+	w, written := write(t, New(CodeForbidden, "Not yours"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != ContentType {
+		t.Errorf("Expected content type %s, got %s", ContentType, contentType)
+	}
+	if written.Code != CodeForbidden || written.Status != http.StatusForbidden || written.Detail != "Not yours" {
+		t.Errorf("Unexpected problem %+v", written)
+	}
+	if written.RequestID != "request-1" || written.Instance != "/user" {
+		t.Errorf("Expected problem to identify the request, got %+v", written)
+	}
+}
+
+func TestFromError(t *testing.T) {
+	testCases := []struct {
+		name           string
+		err            error
+		expectedCode   Code
+		expectedDetail string
+	}{
+		{"plain-error", errors.New("pq: connection refused"), CodeInternal, "Internal error"},
+		{"client-error", security.NewClientError("failed to create user", errors.New("pq: connection refused")), CodeInternal, "failed to create user"},
+		{"coder", conflictError{}, CodeUserAlreadyExists, "User already exists"},
+		{"wrapped-coder", fmt.Errorf("failed: %w", conflictError{}), CodeUserAlreadyExists, "User already exists"},
+		{"error", NewError(CodeNotFound, "member does not exist", errors.New("no rows")), CodeNotFound, "member does not exist"},
+		{"invalid", Invalid("within must be between 1 and %d", 3), CodeValidationFailed, "within must be between 1 and 3"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := FromError(CodeInternal, tt.err)
+			if p.Code != tt.expectedCode || p.Detail != tt.expectedDetail {
+				t.Fatalf("Expected %s with detail %q, got %s with detail %q", tt.expectedCode, tt.expectedDetail, p.Code, p.Detail)
+			}
+			if !errors.Is(p, tt.err) {
+				t.Fatal("Expected the problem to wrap the error")
+			}
+		})
+	}
+}
+
+func TestValidation(t *testing.T) {
+	type address struct {
+		Postcode string `json:"postcode" validate:"required"`
+	}
+	type request struct {
+		Email    string  `json:"email" validate:"required,email"`
+		Password string  `json:"password" validate:"min=6"`
+		Address  address `json:"address"`
+	}
+
+	err := NewValidator().Struct(request{Email: "not an email", Password: "short"})
+	p := Validation("Invalid request", err)
+	if p.Code != CodeValidationFailed || p.Status != http.StatusBadRequest {
+		t.Fatalf("Expected a validation problem, got %+v", p)
+	}
+
+	expected := map[string]FieldError{
+		"email":            {Field: "email", Tag: "email", Message: "must be a valid email address"},
+		"password":         {Field: "password", Tag: "min", Param: "6", Message: "must be at least 6 characters"},
+		"address.postcode": {Field: "address.postcode", Tag: "required", Message: "is required"},
+	}
+	if len(p.Errors) != len(expected) {
+		t.Fatalf("Expected %d field errors, got %+v", len(expected), p.Errors)
+	}
+	for _, fe := range p.Errors {
+		if expected[fe.Field] != fe {
+			t.Errorf("Expected field error %+v, got %+v", expected[fe.Field], fe)
+		}
+	}
+
+	if p := Validation("Invalid JSON", errors.New("unexpected EOF")); p.Code != CodeMalformedRequest {
+		t.Errorf("Expected non-validation errors to be malformed requests, got %s", p.Code)
+	}
+}
@@ -0,0 +1,89 @@
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// NewValidator creates a validator that names fields by their JSON name so
+// field errors refer to fields the way clients sent them.
+func NewValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(jsonName)
+	return validate
+}
+
+// jsonName returns the JSON name of a struct field.
+func jsonName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+// Validation creates a validation failed problem from the errors returned by
+// a validator. Any other error is treated as a malformed request.
+func Validation(detail string, err error) *Problem {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		p := New(CodeMalformedRequest, detail)
+		p.cause = err
+		return p
+	}
+	p := New(CodeValidationFailed, detail)
+	p.cause = err
+	for _, fe := range validationErrs {
+		p.Errors = append(p.Errors, FieldError{
+			Field:   fieldPath(fe),
+			Tag:     fe.Tag(),
+			Param:   fe.Param(),
+			Message: fieldMessage(fe),
+		})
+	}
+	return p
+}
+
+// fieldPath returns the path to the field without the name of the top level
+// struct, e.g. "address.postcode".
+func fieldPath(fe validator.FieldError) string {
+	namespace := fe.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return fe.Field()
+}
+
+// fieldMessage describes a validation failure for people. The value of the
+// field is deliberately left out as it may be a password.
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of %s", strings.Join(strings.Fields(fe.Param()), ", "))
+	}
+	if fe.Param() != "" {
+		return fmt.Sprintf("must satisfy %s=%s", fe.Tag(), fe.Param())
+	}
+	return fmt.Sprintf("must satisfy %s", fe.Tag())
+}
@@ -0,0 +1,21 @@
+package progress
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	completionsRecorded = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "autocrat_progress_completions_recorded_total",
+		Help: "Number of requirement completions recorded.",
+	})
+	completionsSignedOff = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "autocrat_progress_completions_signed_off_total",
+		Help: "Number of requirement completions signed off by leaders.",
+	})
+	completionsWithdrawn = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "autocrat_progress_completions_withdrawn_total",
+		Help: "Number of pending completions credited by attending a meeting that were withdrawn.",
+	})
+)
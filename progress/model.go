@@ -0,0 +1,139 @@
+package progress
+
+import (
+	"time"
+
+	"github.com/nick96/cubapi/date"
+)
+
+// Statuses of a completion.
+const (
+	// StatusPending completions are waiting for a leader to sign them off.
+	StatusPending = "pending"
+	// StatusSignedOff completions have been signed off by a leader and count
+	// towards the badge.
+	StatusSignedOff = "signed_off"
+)
+
+// Actions in the history of a completion.
+const (
+	// ActionRecorded is recording that a requirement was completed.
+	ActionRecorded = "recorded"
+	// ActionSignedOff is a leader signing off a completion.
+	ActionSignedOff = "signed_off"
+	// ActionRevoked is a leader withdrawing their sign off.
+	ActionRevoked = "revoked"
+	// ActionAttached is attaching evidence to a completion.
+	ActionAttached = "attached"
+)
+
+// Completion records a member completing a requirement of a version of a
+// badge. Only signed off completions count towards the badge.
+type Completion struct {
+	Id int64 `json:"id" db:"id"`
+	// GroupId is the ID of the group of the member. It's implied by the
+	// caller's group so it isn't exposed.
+	GroupId  int64 `json:"-" db:"group_id"`
+	MemberId int64 `json:"memberId" db:"member_id"`
+	// BadgeId is the ID of the version of the badge the requirement is of.
+	BadgeId       int64     `json:"badgeId" db:"badge_id"`
+	BadgeKey      string    `json:"badgeKey" db:"badge_key"`
+	BadgeVersion  int       `json:"badgeVersion" db:"badge_version"`
+	RequirementId string    `json:"requirementId" db:"requirement_id"`
+	CompletedOn   date.Date `json:"completedOn" db:"completed_on"`
+	// Notes are the evidence of the completion, e.g. what the member did.
+	Notes  string `json:"notes" db:"notes"`
+	Status string `json:"status" db:"status"`
+	// RecordedBy and SignedOffBy are the IDs of the users that recorded and
+	// signed off the completion.
+	RecordedBy  *int64     `json:"recordedBy" db:"recorded_by"`
+	RecordedAt  time.Time  `json:"recordedAt" db:"recorded_at"`
+	SignedOffBy *int64     `json:"signedOffBy" db:"signed_off_by"`
+	SignedOffAt *time.Time `json:"signedOffAt" db:"signed_off_at"`
+	// MeetingId is the ID of the meeting attending which credited the
+	// member with the requirement, if any.
+	MeetingId *int64 `json:"meetingId" db:"meeting_id"`
+}
+
+// Event is something done to a completion. Events are never changed so they
+// are the history of who recorded and signed off what. They are only removed
+// with their completion, which only happens to pending completions credited
+// by attending a meeting when the credit is withdrawn.
+type Event struct {
+	Id            int64  `json:"id" db:"id"`
+	CompletionId  int64  `json:"completionId" db:"completion_id"`
+	BadgeKey      string `json:"badgeKey" db:"badge_key"`
+	RequirementId string `json:"requirementId" db:"requirement_id"`
+	Action        string `json:"action" db:"action"`
+	// UserId is the ID of the user that did it.
+	UserId    *int64    `json:"userId" db:"user_id"`
+	Notes     string    `json:"notes" db:"notes"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// Attachment is a file of evidence attached to a completion, e.g. a photo.
+type Attachment struct {
+	Id           int64  `json:"id" db:"id"`
+	CompletionId int64  `json:"completionId" db:"completion_id"`
+	Filename     string `json:"filename" db:"filename"`
+	ContentType  string `json:"contentType" db:"content_type"`
+	Size         int64  `json:"size" db:"size"`
+	// Data is only loaded when the attachment is downloaded.
+	Data       []byte    `json:"-" db:"data"`
+	UploadedBy *int64    `json:"uploadedBy" db:"uploaded_by"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+}
+
+// CompletionDetail is a completion with its history and attachments.
+type CompletionDetail struct {
+	Completion
+	History     []Event      `json:"history"`
+	Attachments []Attachment `json:"attachments"`
+}
+
+// Progress is a member's progress towards a version of a badge.
+type Progress struct {
+	MemberId     int64  `json:"memberId"`
+	BadgeId      int64  `json:"badgeId"`
+	BadgeKey     string `json:"badgeKey"`
+	BadgeVersion int    `json:"badgeVersion"`
+	Name         string `json:"name"`
+	Kind         string `json:"kind"`
+	Stage        int    `json:"stage"`
+	// Complete is whether every requirement of the badge is met.
+	Complete     bool                  `json:"complete"`
+	Requirements []RequirementProgress `json:"requirements"`
+}
+
+// RequirementProgress is a member's progress towards a requirement of a
+// badge.
+type RequirementProgress struct {
+	Id          string `json:"id"`
+	Description string `json:"description"`
+	Choose      int    `json:"choose,omitempty"`
+	// Met is whether the requirement's completion is signed off, or enough
+	// of its requirements are met.
+	Met bool `json:"met"`
+	// Completion is the completion recorded for the requirement, if any.
+	Completion   *Completion           `json:"completion,omitempty"`
+	Requirements []RequirementProgress `json:"requirements,omitempty"`
+}
+
+// Credit credits a member with a requirement of a badge.
+type Credit struct {
+	MemberId      int64
+	BadgeKey      string
+	RequirementId string
+}
+
+// MeetingCredit is what attending a meeting credits members with.
+type MeetingCredit struct {
+	GroupId   int64
+	MeetingId int64
+	HeldOn    date.Date
+	// RecordedBy is the ID of the user completions are recorded by.
+	RecordedBy int64
+	// Notes are the notes of the completions recorded.
+	Notes   string
+	Credits []Credit
+}
@@ -0,0 +1,148 @@
+package progress
+
+import (
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/user"
+)
+
+// DescribeProgressRouter describes the operations of NewProgressRouter.
+func DescribeProgressRouter(r *openapi.Router) {
+	memberID := openapi.PathParam("memberID", "The ID of the member.", openapi.Integer())
+	key := openapi.PathParam("key", "The key of the badge.", openapi.String())
+	completionID := openapi.PathParam("completionID", "The ID of the completion.", openapi.Integer())
+	attachmentID := openapi.PathParam("attachmentID", "The ID of the attachment.", openapi.Integer())
+	denied := map[string]*openapi.Response{
+		"403": r.Problem("The request isn't authenticated, the user isn't a leader or admin, or the CSRF token is missing."),
+		"429": r.Problem("The client has made too many requests."),
+		"500": r.Problem("The request couldn't be completed."),
+	}
+	responses := func(responses map[string]*openapi.Response) map[string]*openapi.Response {
+		for status, response := range denied {
+			responses[status] = response
+		}
+		return responses
+	}
+	file := &openapi.Schema{Type: "string", Format: "binary"}
+
+	r.Get("/member/{memberID}", &openapi.Operation{
+		OperationID: "getMemberProgress",
+		Summary:     "Get a member's progress",
+		Description: "The member's progress towards every badge they've recorded completions for.",
+		Tags:        []string{"progress"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{memberID},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The progress ordered by badge key.", []Progress{}),
+			"404": r.Problem("The member doesn't exist in the group."),
+		}),
+	})
+	r.Get("/member/{memberID}/history", &openapi.Operation{
+		OperationID: "getMemberProgressHistory",
+		Summary:     "Get the history of a member's progress",
+		Description: "Who recorded, signed off, revoked and attached evidence to the member's completions and when.",
+		Tags:        []string{"progress"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{memberID},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The history, oldest first.", []Event{}),
+			"404": r.Problem("The member doesn't exist in the group."),
+		}),
+	})
+	r.Get("/member/{memberID}/badge/{key}", &openapi.Operation{
+		OperationID: "getBadgeProgress",
+		Summary:     "Get a member's progress towards a badge",
+		Description: "Progress is towards the version of the badge the member started, or the latest version if they haven't.",
+		Tags:        []string{"progress"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{memberID, key},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The progress with the requirement tree of the badge.", ProgressResponse{}),
+			"404": r.Problem("The member doesn't exist in the group or the badge doesn't exist."),
+		}),
+	})
+	r.Post("/member/{memberID}/badge/{key}", &openapi.Operation{
+		OperationID: "recordCompletion",
+		Summary:     "Record a member completing a requirement",
+		Description: "The completion is recorded against the version of the badge the member works towards and waits for a leader to sign it off.",
+		Tags:        []string{"progress"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{memberID, key},
+		RequestBody: r.JSONBody(CompletionRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"201": r.JSON("The completion.", CompletionResponse{}),
+			"400": r.Problem("The request body is invalid, the badge has no such requirement, is retired or isn't for the member's section."),
+			"404": r.Problem("The member doesn't exist in the group or the badge doesn't exist."),
+			"409": r.Problem("The requirement has already been recorded for the member."),
+		}),
+	})
+	r.Get("/completion/{completionID}", &openapi.Operation{
+		OperationID: "getCompletion",
+		Summary:     "Get a completion",
+		Tags:        []string{"progress"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{completionID},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The completion with its history and attachments.", CompletionDetailResponse{}),
+			"404": r.Problem("The completion doesn't exist in the group."),
+		}),
+	})
+	r.Post("/completion/{completionID}/sign-off", &openapi.Operation{
+		OperationID: "signOffCompletion",
+		Summary:     "Sign off a completion",
+		Description: "Admins can sign off any completion, leaders only those of members of the sections they lead.",
+		Tags:        []string{"progress"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{completionID},
+		RequestBody: r.JSONBody(SignOffRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The signed off completion.", CompletionResponse{}),
+			"400": r.Problem("The request body is invalid."),
+			"404": r.Problem("The completion doesn't exist in the group."),
+			"409": r.Problem("The completion is already signed off."),
+		}),
+	})
+	r.Post("/completion/{completionID}/revoke", &openapi.Operation{
+		OperationID: "revokeCompletionSignOff",
+		Summary:     "Withdraw the sign off of a completion",
+		Description: "The completion waits to be signed off again. The reason is kept in its history.",
+		Tags:        []string{"progress"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{completionID},
+		RequestBody: r.JSONBody(RevokeRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The completion.", CompletionResponse{}),
+			"400": r.Problem("The request body is invalid."),
+			"404": r.Problem("The completion doesn't exist in the group."),
+			"409": r.Problem("The completion isn't signed off."),
+		}),
+	})
+	r.Post("/completion/{completionID}/attachment", &openapi.Operation{
+		OperationID: "addCompletionAttachment",
+		Summary:     "Attach evidence to a completion",
+		Description: "The body is the file, of the request's content type.",
+		Tags:        []string{"progress"},
+		Security:    user.Authenticated,
+		Parameters: []openapi.Parameter{
+			completionID,
+			{Name: "filename", In: "query", Description: "Name of the file.", Required: true, Schema: openapi.String()},
+		},
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{"*/*": {Schema: file}}},
+		Responses: responses(map[string]*openapi.Response{
+			"201": r.JSON("The attachment.", AttachmentResponse{}),
+			"400": r.Problem("The file is empty or unnamed, or the completion has too many attachments."),
+			"404": r.Problem("The completion doesn't exist in the group."),
+			"413": r.Problem("The file is too large."),
+		}),
+	})
+	r.Get("/completion/{completionID}/attachment/{attachmentID}", &openapi.Operation{
+		OperationID: "getCompletionAttachment",
+		Summary:     "Download an attachment",
+		Tags:        []string{"progress"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{completionID, attachmentID},
+		Responses: responses(map[string]*openapi.Response{
+			"200": {Description: "The file, of the content type it was uploaded with.", Content: map[string]openapi.MediaType{"*/*": {Schema: file}}},
+			"404": r.Problem("The attachment doesn't exist."),
+		}),
+	})
+}
@@ -0,0 +1,47 @@
+package progress
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/openapi/openapitest"
+)
+
+// TestOpenAPIContract checks that the handlers behave as the OpenAPI document
+// says they do. If this fails either the handlers or DescribeProgressRouter
+// need updating.
+func TestOpenAPIContract(t *testing.T) {
+	store := newTestStore()
+	router := newTestRouter(store, cubLeader)
+
+	doc := openapi.New("autocrat", "test")
+	doc.Route("/progress", DescribeProgressRouter)
+	if err := doc.CheckRoutes(router); err != nil {
+		t.Fatal(err)
+	}
+
+	openapitest.Run(t, doc, router, []openapitest.Case{
+		{Name: "record", Method: "POST", Pattern: "/progress/member/{memberID}/badge/{key}", Path: "/progress/member/1/badge/oas-bushcraft-1", Body: `{"requirementId": "2.1", "notes": "Reef knot"}`, Status: http.StatusCreated},
+		{Name: "record-invalid", Method: "POST", Pattern: "/progress/member/{memberID}/badge/{key}", Path: "/progress/member/1/badge/oas-bushcraft-1", Body: `{"requirementId": ""}`, Invalid: true, Status: http.StatusBadRequest},
+		{Name: "record-again", Method: "POST", Pattern: "/progress/member/{memberID}/badge/{key}", Path: "/progress/member/1/badge/oas-bushcraft-1", Body: `{"requirementId": "2.1"}`, Status: http.StatusConflict},
+		{Name: "record-missing-badge", Method: "POST", Pattern: "/progress/member/{memberID}/badge/{key}", Path: "/progress/member/1/badge/oas-missing-1", Body: `{"requirementId": "1"}`, Status: http.StatusNotFound},
+		{Name: "sign-off", Method: "POST", Pattern: "/progress/completion/{completionID}/sign-off", Path: "/progress/completion/1/sign-off", Body: `{"notes": "Neat"}`, Status: http.StatusOK},
+		{Name: "sign-off-again", Method: "POST", Pattern: "/progress/completion/{completionID}/sign-off", Path: "/progress/completion/1/sign-off", Body: `{}`, Status: http.StatusConflict},
+		{Name: "sign-off-missing", Method: "POST", Pattern: "/progress/completion/{completionID}/sign-off", Path: "/progress/completion/9/sign-off", Body: `{}`, Status: http.StatusNotFound},
+		{Name: "revoke", Method: "POST", Pattern: "/progress/completion/{completionID}/revoke", Path: "/progress/completion/1/revoke", Body: `{"reason": "Mistake"}`, Status: http.StatusOK},
+		{Name: "revoke-pending", Method: "POST", Pattern: "/progress/completion/{completionID}/revoke", Path: "/progress/completion/1/revoke", Body: `{"reason": "Mistake"}`, Status: http.StatusConflict},
+		{Name: "attach", Method: "POST", Pattern: "/progress/completion/{completionID}/attachment", Path: "/progress/completion/1/attachment?filename=knot.jpg", ContentType: "image/jpeg", Body: "jpeg", Status: http.StatusCreated},
+		{Name: "attach-empty", Method: "POST", Pattern: "/progress/completion/{completionID}/attachment", Path: "/progress/completion/1/attachment?filename=knot.jpg", ContentType: "image/jpeg", Invalid: true, Status: http.StatusBadRequest},
+		{Name: "download", Method: "GET", Pattern: "/progress/completion/{completionID}/attachment/{attachmentID}", Path: "/progress/completion/1/attachment/1", Status: http.StatusOK},
+		{Name: "download-missing", Method: "GET", Pattern: "/progress/completion/{completionID}/attachment/{attachmentID}", Path: "/progress/completion/1/attachment/2", Status: http.StatusNotFound},
+		{Name: "completion", Method: "GET", Pattern: "/progress/completion/{completionID}", Path: "/progress/completion/1", Status: http.StatusOK},
+		{Name: "completion-missing", Method: "GET", Pattern: "/progress/completion/{completionID}", Path: "/progress/completion/9", Status: http.StatusNotFound},
+		{Name: "badge", Method: "GET", Pattern: "/progress/member/{memberID}/badge/{key}", Path: "/progress/member/1/badge/oas-bushcraft-1", Status: http.StatusOK},
+		{Name: "badge-missing-member", Method: "GET", Pattern: "/progress/member/{memberID}/badge/{key}", Path: "/progress/member/9/badge/oas-bushcraft-1", Status: http.StatusNotFound},
+		{Name: "member", Method: "GET", Pattern: "/progress/member/{memberID}", Path: "/progress/member/1", Status: http.StatusOK},
+		{Name: "member-missing", Method: "GET", Pattern: "/progress/member/{memberID}", Path: "/progress/member/9", Status: http.StatusNotFound},
+		{Name: "history", Method: "GET", Pattern: "/progress/member/{memberID}/history", Path: "/progress/member/1/history", Status: http.StatusOK},
+		{Name: "history-missing", Method: "GET", Pattern: "/progress/member/{memberID}/history", Path: "/progress/member/9/history", Status: http.StatusNotFound},
+	})
+}
@@ -0,0 +1,406 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/user"
+	"go.uber.org/zap"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// CodeAttachmentTooLarge is the problem code of uploading an attachment
+// larger than maxAttachmentSize.
+const CodeAttachmentTooLarge problem.Code = "attachment_too_large"
+
+func init() {
+	problem.Register(CodeAttachmentTooLarge, http.StatusRequestEntityTooLarge, "Attachment too large")
+}
+
+// maxAttachmentSize is the largest attachment that can be uploaded, enough
+// for a photo from a phone.
+const maxAttachmentSize = 5 << 20
+
+// CompletionRequest records a member completing a requirement.
+type CompletionRequest struct {
+	RequirementId string `json:"requirementId" validate:"required,max=64"`
+	// CompletedOn defaults to today.
+	CompletedOn date.Date `json:"completedOn,omitempty"`
+	// Notes are the evidence of the completion, e.g. what the member did.
+	Notes string `json:"notes,omitempty" validate:"max=4096"`
+}
+
+// SignOffRequest signs off a completion.
+type SignOffRequest struct {
+	Notes string `json:"notes,omitempty" validate:"max=4096"`
+}
+
+// RevokeRequest withdraws the sign off of a completion.
+type RevokeRequest struct {
+	Reason string `json:"reason" validate:"required,max=4096"`
+}
+
+type CompletionResponse Completion
+
+func (c CompletionResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type CompletionDetailResponse CompletionDetail
+
+func (c CompletionDetailResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type ProgressResponse Progress
+
+func (p ProgressResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type AttachmentResponse Attachment
+
+func (a AttachmentResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// NewProgressRouter creates a router for the badge progress of the members of
+// the caller's group. It must only be mounted behind authentication, which
+// decides the group and who records and signs off progress.
+//
+// GET /member/{memberID}: Get the member's progress towards every badge
+// they've started.
+// GET /member/{memberID}/history: List who recorded and signed off the
+// member's progress and when.
+// GET /member/{memberID}/badge/{key}: Get the member's progress towards a
+// badge.
+// POST /member/{memberID}/badge/{key}: Record the member completing a
+// requirement of a badge.
+// GET /completion/{completionID}: Get a completion with its history and
+// attachments.
+// POST /completion/{completionID}/sign-off: Sign off a completion.
+// POST /completion/{completionID}/revoke: Withdraw the sign off of a
+// completion.
+// POST /completion/{completionID}/attachment: Attach a file to a completion.
+// The body is the file, named by the filename query parameter.
+// GET /completion/{completionID}/attachment/{attachmentID}: Download an
+// attachment.
+func NewProgressRouter(logger *zap.Logger, service ProgressService) func(chi.Router) {
+	validate := problem.NewValidator()
+	date.RegisterValidation(validate)
+	return func(r chi.Router) {
+		r.Get("/member/{memberID}", memberProgress(logger, service))
+		r.Get("/member/{memberID}/history", memberHistory(logger, service))
+		r.Get("/member/{memberID}/badge/{key}", badgeProgress(logger, service))
+		r.Post("/member/{memberID}/badge/{key}", recordCompletion(logger, validate, service))
+		r.Get("/completion/{completionID}", getCompletion(logger, service))
+		r.Post("/completion/{completionID}/sign-off", signOff(logger, validate, service))
+		r.Post("/completion/{completionID}/revoke", revokeSignOff(logger, validate, service))
+		r.Post("/completion/{completionID}/attachment", addAttachment(logger, service))
+		r.Get("/completion/{completionID}/attachment/{attachmentID}", getAttachment(logger, service))
+	}
+}
+
+func memberProgress(logger *zap.Logger, service ProgressService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, memberID, ok := pathID(w, r, "memberID", "Member")
+		if !ok {
+			return
+		}
+		progress, err := service.MemberProgress(r.Context(), groupID, memberID)
+		if err != nil {
+			logger.Info("Failed to get member progress", zap.Int64("memberID", memberID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, progress)
+	}
+}
+
+func memberHistory(logger *zap.Logger, service ProgressService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, memberID, ok := pathID(w, r, "memberID", "Member")
+		if !ok {
+			return
+		}
+		events, err := service.History(r.Context(), groupID, memberID)
+		if err != nil {
+			logger.Info("Failed to get member history", zap.Int64("memberID", memberID), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, events)
+	}
+}
+
+func badgeProgress(logger *zap.Logger, service ProgressService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, memberID, ok := pathID(w, r, "memberID", "Member")
+		if !ok {
+			return
+		}
+		key := chi.URLParam(r, "key")
+		progress, err := service.BadgeProgress(r.Context(), groupID, memberID, key)
+		if err != nil {
+			logger.Info("Failed to get badge progress", zap.Int64("memberID", memberID), zap.String("key", key), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, ProgressResponse(progress))
+	}
+}
+
+func recordCompletion(logger *zap.Logger, validate *validator.Validate, service ProgressService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, memberID, ok := pathID(w, r, "memberID", "Member")
+		if !ok {
+			return
+		}
+		recorder, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+		var request CompletionRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		key := chi.URLParam(r, "key")
+		completion, err := service.RecordCompletion(r.Context(), key, Completion{
+			GroupId:       groupID,
+			MemberId:      memberID,
+			RequirementId: request.RequirementId,
+			CompletedOn:   request.CompletedOn,
+			Notes:         request.Notes,
+			RecordedBy:    &recorder.Id,
+		})
+		if err != nil {
+			logger.Info("Failed to record completion", zap.Int64("memberID", memberID), zap.String("key", key), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		completionsRecorded.Inc()
+		logger.Info("Recorded completion", zap.Int64("completionID", completion.Id))
+		render.Status(r, http.StatusCreated)
+		render.Render(w, r, CompletionResponse(completion))
+	}
+}
+
+func getCompletion(logger *zap.Logger, service ProgressService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "completionID", "Completion")
+		if !ok {
+			return
+		}
+		detail, err := service.GetCompletion(r.Context(), groupID, id)
+		if err != nil {
+			logger.Info("Failed to get completion", zap.Int64("completionID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.Render(w, r, CompletionDetailResponse(detail))
+	}
+}
+
+func signOff(logger *zap.Logger, validate *validator.Validate, service ProgressService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "completionID", "Completion")
+		if !ok {
+			return
+		}
+		leader, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+		var request SignOffRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		completion, err := service.SignOff(r.Context(), groupID, id, leader, request.Notes)
+		if err != nil {
+			logger.Info("Failed to sign off completion", zap.Int64("completionID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		completionsSignedOff.Inc()
+		logger.Info("Signed off completion", zap.Int64("completionID", id))
+		render.Render(w, r, CompletionResponse(completion))
+	}
+}
+
+func revokeSignOff(logger *zap.Logger, validate *validator.Validate, service ProgressService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "completionID", "Completion")
+		if !ok {
+			return
+		}
+		leader, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+		var request RevokeRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		completion, err := service.RevokeSignOff(r.Context(), groupID, id, leader, request.Reason)
+		if err != nil {
+			logger.Info("Failed to revoke sign off", zap.Int64("completionID", id), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		logger.Info("Revoked sign off", zap.Int64("completionID", id))
+		render.Render(w, r, CompletionResponse(completion))
+	}
+}
+
+func addAttachment(logger *zap.Logger, service ProgressService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, id, ok := pathID(w, r, "completionID", "Completion")
+		if !ok {
+			return
+		}
+		uploader, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+		// Only the base name is kept so the name can't be a path when
+		// the attachment is downloaded.
+		filename := path.Base(r.URL.Query().Get("filename"))
+		if filename == "." || filename == "/" || len(filename) > 256 {
+			problem.Write(w, r, problem.New(problem.CodeValidationFailed, "filename query parameter must name the file"))
+			return
+		}
+		contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			contentType = "application/octet-stream"
+		}
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxAttachmentSize))
+		if err != nil {
+			logger.Info("Failed to read attachment", zap.Error(err))
+			problem.Write(w, r, problem.New(CodeAttachmentTooLarge, fmt.Sprintf("Attachments must be at most %d MiB", maxAttachmentSize>>20)))
+			return
+		}
+		defer r.Body.Close()
+		if len(data) == 0 {
+			problem.Write(w, r, problem.New(problem.CodeValidationFailed, "Attachment is empty"))
+			return
+		}
+
+		attachment, clientErr := service.AddAttachment(r.Context(), groupID, Attachment{
+			CompletionId: id,
+			Filename:     filename,
+			ContentType:  contentType,
+			Data:         data,
+			UploadedBy:   &uploader.Id,
+		})
+		if clientErr != nil {
+			logger.Info("Failed to add attachment", zap.Int64("completionID", id), zap.Error(clientErr))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, clientErr))
+			return
+		}
+		logger.Info("Added attachment", zap.Int64("completionID", id), zap.Int64("attachmentID", attachment.Id))
+		render.Status(r, http.StatusCreated)
+		render.Render(w, r, AttachmentResponse(attachment))
+	}
+}
+
+func getAttachment(logger *zap.Logger, service ProgressService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, completionID, ok := pathID(w, r, "completionID", "Completion")
+		if !ok {
+			return
+		}
+		id, err := strconv.ParseInt(chi.URLParam(r, "attachmentID"), 10, 64)
+		if err != nil {
+			problem.Write(w, r, problem.New(problem.CodeNotFound, "Attachment does not exist"))
+			return
+		}
+		attachment, clientErr := service.GetAttachment(r.Context(), groupID, completionID, id)
+		if clientErr != nil {
+			logger.Info("Failed to get attachment", zap.Int64("attachmentID", id), zap.Error(clientErr))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, clientErr))
+			return
+		}
+		// Attachments are uploaded by users so they're always downloaded
+		// rather than displayed, and never sniffed as something else.
+		w.Header().Set("Content-Type", attachment.ContentType)
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})
+		if disposition == "" {
+			// The name can't be encoded, the client has to pick one.
+			disposition = "attachment"
+		}
+		w.Header().Set("Content-Disposition", disposition)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write(attachment.Data)
+	}
+}
+
+// pathID gets the caller's group and parses the ID in the path parameter.
+// Anything that isn't an ID can't exist so it's not found.
+func pathID(w http.ResponseWriter, r *http.Request, param, name string) (groupID, id int64, ok bool) {
+	groupID, ok = group.FromRequest(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, param), 10, 64)
+	if err != nil {
+		problem.Write(w, r, problem.New(problem.CodeNotFound, name+" does not exist"))
+		return 0, 0, false
+	}
+	return groupID, id, true
+}
+
+// currentUser gets the authenticated user, who is recorded as having done
+// what the request does. A problem is written if there isn't one, which means
+// the router isn't behind authentication.
+func currentUser(w http.ResponseWriter, r *http.Request) (user.User, bool) {
+	current, ok := user.FromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Internal(fmt.Errorf("no authenticated user in request context")))
+		return user.User{}, false
+	}
+	return current, true
+}
+
+// decodeRequest decodes and validates a request into v. A problem is written
+// if the request is invalid.
+func decodeRequest(logger *zap.Logger, w http.ResponseWriter, r *http.Request, validate *validator.Validate, v interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Info("Failed to read request body", zap.Error(err))
+		problem.Write(w, r, problem.Internal(err))
+		return false
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, v); err != nil {
+		logger.Info("Failed to unmarshal request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Request body is invalid JSON", err))
+		return false
+	}
+	if err := validate.Struct(v); err != nil {
+		logger.Info("Invalid request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Invalid request body", err))
+		return false
+	}
+	return true
+}
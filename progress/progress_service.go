@@ -0,0 +1,496 @@
+package progress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nick96/cubapi/badge"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/security"
+	"github.com/nick96/cubapi/tracing"
+	"github.com/nick96/cubapi/user"
+)
+
+// Problem codes of progress errors.
+const (
+	// CodeAlreadyRecorded is the problem code of recording a requirement
+	// the member already has a completion for.
+	CodeAlreadyRecorded problem.Code = "requirement_already_recorded"
+	// CodeAlreadySignedOff is the problem code of signing off a completion
+	// that is already signed off.
+	CodeAlreadySignedOff problem.Code = "completion_already_signed_off"
+	// CodeNotSignedOff is the problem code of revoking the sign off of a
+	// completion that isn't signed off.
+	CodeNotSignedOff problem.Code = "completion_not_signed_off"
+)
+
+func init() {
+	problem.Register(CodeAlreadyRecorded, http.StatusConflict, "Requirement already recorded")
+	problem.Register(CodeAlreadySignedOff, http.StatusConflict, "Completion already signed off")
+	problem.Register(CodeNotSignedOff, http.StatusConflict, "Completion not signed off")
+}
+
+// maxAttachments is how many attachments a completion can have.
+const maxAttachments = 10
+
+// Catalogue finds badges in the badge catalogue. It's implemented by
+// badge.BadgeStorer.
+type Catalogue interface {
+	GetBadge(ctx context.Context, key string) (badge.Badge, bool, error)
+	GetVersionByID(ctx context.Context, id int64) (badge.Badge, bool, error)
+}
+
+type ProgressService struct {
+	store     ProgressStorer
+	catalogue Catalogue
+	// location is the time zone dates are in, it decides when today is.
+	location *time.Location
+}
+
+// NewProgressService creates a ProgressService that stores progress in the
+// store against badges of the catalogue. Dates, like when a requirement was
+// completed, are in the given location.
+func NewProgressService(store ProgressStorer, catalogue Catalogue, location *time.Location) ProgressService {
+	return ProgressService{store: store, catalogue: catalogue, location: location}
+}
+
+// checkMember checks the member exists in the group and returns their
+// section.
+func (s ProgressService) checkMember(ctx context.Context, groupID, memberID int64) (string, security.ClientError) {
+	section, found, err := s.store.GetMemberSection(ctx, groupID, memberID)
+	if err != nil {
+		return "", security.NewClientError(fmt.Sprintf("failed to get member %d", memberID), err)
+	} else if !found {
+		return "", problem.NewError(problem.CodeNotFound, fmt.Sprintf("member %d does not exist", memberID), ErrNoSuchMember)
+	}
+	return section, nil
+}
+
+// version finds the version of the badge with the key the member works
+// towards: the version they started or, if they haven't, the latest. Members
+// keep working towards the version they started so edits to the catalogue
+// don't change what they've done.
+func (s ProgressService) version(ctx context.Context, groupID, memberID int64, key string) (b badge.Badge, started bool, clientErr security.ClientError) {
+	id, started, err := s.store.StartedVersion(ctx, groupID, memberID, key)
+	if err != nil {
+		return badge.Badge{}, false, security.NewClientError(fmt.Sprintf("failed to get progress towards badge %s", key), err)
+	}
+	var found bool
+	if started {
+		b, found, err = s.catalogue.GetVersionByID(ctx, id)
+	} else {
+		b, found, err = s.catalogue.GetBadge(ctx, key)
+	}
+	if err != nil {
+		return badge.Badge{}, false, security.NewClientError(fmt.Sprintf("failed to get badge %s", key), err)
+	} else if !found {
+		return badge.Badge{}, false, problem.NewError(problem.CodeNotFound, fmt.Sprintf("badge %s does not exist", key), badge.ErrNoSuchBadge)
+	}
+	return b, started, nil
+}
+
+// RecordCompletion records the member of the group completing a requirement
+// of the badge with the key, see checkLeaf. The completion waits for a leader to sign it
+// off. It's recorded against the version of the badge the member works
+// towards, see version.
+func (s ProgressService) RecordCompletion(ctx context.Context, key string, completion Completion) (Completion, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "ProgressService.RecordCompletion")
+	defer span.End()
+
+	section, clientErr := s.checkMember(ctx, completion.GroupId, completion.MemberId)
+	if clientErr != nil {
+		return Completion{}, clientErr
+	}
+	b, started, clientErr := s.version(ctx, completion.GroupId, completion.MemberId, key)
+	if clientErr != nil {
+		return Completion{}, clientErr
+	}
+	if !started {
+		if b.Retired {
+			return Completion{}, problem.Invalid("badge %s is retired", key)
+		}
+		if !contains(b.Sections, section) {
+			return Completion{}, problem.Invalid("badge %s isn't for %s", key, section)
+		}
+	}
+	if clientErr := checkLeaf(b, completion.RequirementId); clientErr != nil {
+		return Completion{}, clientErr
+	}
+	today := date.Today(s.location)
+	if completion.CompletedOn.IsZero() {
+		completion.CompletedOn = today
+	} else if completion.CompletedOn.After(today) {
+		return Completion{}, problem.Invalid("completion date must not be in the future")
+	}
+	completion.BadgeId = b.Id
+	completion.Status = StatusPending
+
+	added, err := s.store.AddCompletion(ctx, completion)
+	if err != nil {
+		span.RecordError(err)
+		return Completion{}, storeError("failed to record completion", err)
+	}
+	return added, nil
+}
+
+// CheckRequirement checks the latest version of the badge with the key is
+// not retired and has the requirement, and that the requirement can be
+// completed on its own, see checkLeaf. Only then can it be credited.
+func (s ProgressService) CheckRequirement(ctx context.Context, key, requirementID string) security.ClientError {
+	b, found, err := s.catalogue.GetBadge(ctx, key)
+	if err != nil {
+		return security.NewClientError(fmt.Sprintf("failed to get badge %s", key), err)
+	} else if !found {
+		return problem.Invalid("badge %s does not exist", key)
+	} else if b.Retired {
+		return problem.Invalid("badge %s is retired", key)
+	}
+	return checkLeaf(b, requirementID)
+}
+
+// checkLeaf checks the badge has the requirement and that it isn't made up of
+// other requirements. Those are met by completing their requirements, so
+// only requirements without any of their own can be completed.
+func checkLeaf(b badge.Badge, requirementID string) security.ClientError {
+	requirement, ok := b.Requirements.Find(requirementID)
+	if !ok {
+		return problem.Invalid("version %d of badge %s has no requirement %s", b.Version, b.Key, requirementID)
+	} else if len(requirement.Requirements) > 0 {
+		return problem.Invalid("requirement %s of badge %s is made up of other requirements, complete those instead", requirementID, b.Key)
+	}
+	return nil
+}
+
+// CreditMeeting makes the completions credited by attending the meeting
+// match the credits. Members are credited with a pending completion of each
+// requirement they haven't already recorded and can record, see
+// RecordCompletion; other credits are skipped. Pending completions credited
+// before that aren't credited any more, e.g. because the member's attendance
+// was corrected, are removed. Signed off ones are kept as a leader has
+// confirmed them.
+func (s ProgressService) CreditMeeting(ctx context.Context, credit MeetingCredit) security.ClientError {
+	ctx, span := tracing.Start(ctx, "ProgressService.CreditMeeting")
+	defer span.End()
+
+	credited, err := s.store.ListMeetingCompletions(ctx, credit.GroupId, credit.MeetingId)
+	if err != nil {
+		span.RecordError(err)
+		return security.NewClientError(fmt.Sprintf("failed to list completions credited by meeting %d", credit.MeetingId), err)
+	}
+	wanted := make(map[Credit]bool, len(credit.Credits))
+	for _, c := range credit.Credits {
+		wanted[c] = true
+	}
+	have := make(map[Credit]bool, len(credited))
+	for _, completion := range credited {
+		c := Credit{completion.MemberId, completion.BadgeKey, completion.RequirementId}
+		if wanted[c] || completion.Status != StatusPending {
+			have[c] = true
+			continue
+		}
+		err := s.store.DeletePendingCompletion(ctx, credit.GroupId, completion.Id)
+		if err != nil && !errors.Is(err, ErrStatusChanged) {
+			span.RecordError(err)
+			return security.NewClientError(fmt.Sprintf("failed to withdraw completion %d", completion.Id), err)
+		}
+		if err == nil {
+			completionsWithdrawn.Inc()
+		}
+	}
+
+	for _, c := range credit.Credits {
+		if have[c] {
+			continue
+		}
+		completion := Completion{
+			GroupId:       credit.GroupId,
+			MemberId:      c.MemberId,
+			RequirementId: c.RequirementId,
+			CompletedOn:   credit.HeldOn,
+			Notes:         credit.Notes,
+			RecordedBy:    &credit.RecordedBy,
+			MeetingId:     &credit.MeetingId,
+		}
+		_, clientErr := s.RecordCompletion(ctx, c.BadgeKey, completion)
+		var progressErr problem.Error
+		if errors.As(clientErr, &progressErr) {
+			// The member can't be credited, e.g. they've already
+			// recorded the requirement or the badge isn't for their
+			// section.
+			continue
+		} else if clientErr != nil {
+			return clientErr
+		}
+		completionsRecorded.Inc()
+	}
+	return nil
+}
+
+// GetCompletion gets the completion of the group with the given ID with its
+// history and attachments.
+func (s ProgressService) GetCompletion(ctx context.Context, groupID, id int64) (CompletionDetail, security.ClientError) {
+	completion, clientErr := s.getCompletion(ctx, groupID, id)
+	if clientErr != nil {
+		return CompletionDetail{}, clientErr
+	}
+	history, err := s.store.ListEvents(ctx, groupID, id)
+	if err != nil {
+		return CompletionDetail{}, security.NewClientError(fmt.Sprintf("failed to get history of completion %d", id), err)
+	}
+	attachments, err := s.store.ListAttachments(ctx, groupID, id)
+	if err != nil {
+		return CompletionDetail{}, security.NewClientError(fmt.Sprintf("failed to get attachments of completion %d", id), err)
+	}
+	return CompletionDetail{Completion: completion, History: history, Attachments: attachments}, nil
+}
+
+func (s ProgressService) getCompletion(ctx context.Context, groupID, id int64) (Completion, security.ClientError) {
+	completion, found, err := s.store.GetCompletion(ctx, groupID, id)
+	if err != nil {
+		return Completion{}, security.NewClientError(fmt.Sprintf("failed to get completion %d", id), err)
+	} else if !found {
+		return Completion{}, problem.NewError(problem.CodeNotFound, fmt.Sprintf("completion %d does not exist", id), ErrNoSuchCompletion)
+	}
+	return completion, nil
+}
+
+// checkLeader checks the user can sign off the completion: admins can sign
+// off anything, leaders only the members of the sections they lead.
+func (s ProgressService) checkLeader(ctx context.Context, completion Completion, leader user.User) security.ClientError {
+	if leader.HasRole(user.RoleAdmin) {
+		return nil
+	}
+	leads, err := s.store.LeadsSection(ctx, completion.GroupId, completion.MemberId, leader.Id)
+	if err != nil {
+		return security.NewClientError("failed to check the user leads the member's section", err)
+	}
+	if !leads {
+		message := "only leaders of the member's section can sign off their progress"
+		return problem.NewError(problem.CodeForbidden, message, errors.New(message))
+	}
+	return nil
+}
+
+// SignOff signs off the completion of the group with the given ID as the
+// leader.
+func (s ProgressService) SignOff(ctx context.Context, groupID, id int64, leader user.User, notes string) (Completion, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "ProgressService.SignOff")
+	defer span.End()
+
+	completion, clientErr := s.getCompletion(ctx, groupID, id)
+	if clientErr != nil {
+		return Completion{}, clientErr
+	}
+	if err := s.checkLeader(ctx, completion, leader); err != nil {
+		return Completion{}, err
+	}
+	signed, err := s.store.SetStatus(ctx, groupID, id, StatusPending, StatusSignedOff, Event{Action: ActionSignedOff, UserId: &leader.Id, Notes: notes})
+	if errors.Is(err, ErrStatusChanged) {
+		return Completion{}, problem.NewError(CodeAlreadySignedOff, fmt.Sprintf("completion %d is already signed off", id), err)
+	} else if err != nil {
+		span.RecordError(err)
+		return Completion{}, security.NewClientError(fmt.Sprintf("failed to sign off completion %d", id), err)
+	}
+	return signed, nil
+}
+
+// RevokeSignOff withdraws the sign off of the completion of the group with
+// the given ID, e.g. because it was signed off by mistake. The completion
+// waits to be signed off again and the reason is kept in its history.
+func (s ProgressService) RevokeSignOff(ctx context.Context, groupID, id int64, leader user.User, reason string) (Completion, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "ProgressService.RevokeSignOff")
+	defer span.End()
+
+	completion, clientErr := s.getCompletion(ctx, groupID, id)
+	if clientErr != nil {
+		return Completion{}, clientErr
+	}
+	if err := s.checkLeader(ctx, completion, leader); err != nil {
+		return Completion{}, err
+	}
+	revoked, err := s.store.SetStatus(ctx, groupID, id, StatusSignedOff, StatusPending, Event{Action: ActionRevoked, UserId: &leader.Id, Notes: reason})
+	if errors.Is(err, ErrStatusChanged) {
+		return Completion{}, problem.NewError(CodeNotSignedOff, fmt.Sprintf("completion %d isn't signed off", id), err)
+	} else if err != nil {
+		span.RecordError(err)
+		return Completion{}, security.NewClientError(fmt.Sprintf("failed to revoke sign off of completion %d", id), err)
+	}
+	return revoked, nil
+}
+
+// AddAttachment attaches evidence to the completion of the group with the
+// attachment's completion ID.
+func (s ProgressService) AddAttachment(ctx context.Context, groupID int64, attachment Attachment) (Attachment, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "ProgressService.AddAttachment")
+	defer span.End()
+
+	attachments, err := s.store.ListAttachments(ctx, groupID, attachment.CompletionId)
+	if err != nil {
+		return Attachment{}, security.NewClientError("failed to count attachments", err)
+	}
+	if len(attachments) >= maxAttachments {
+		return Attachment{}, problem.Invalid("completions can have at most %d attachments", maxAttachments)
+	}
+	added, err := s.store.AddAttachment(ctx, groupID, attachment)
+	if err != nil {
+		span.RecordError(err)
+		return Attachment{}, storeError("failed to add attachment", err)
+	}
+	return added, nil
+}
+
+// GetAttachment gets the attachment of the completion of the group with its
+// data.
+func (s ProgressService) GetAttachment(ctx context.Context, groupID, completionID, id int64) (Attachment, security.ClientError) {
+	attachment, found, err := s.store.GetAttachment(ctx, groupID, completionID, id)
+	if err != nil {
+		return Attachment{}, security.NewClientError(fmt.Sprintf("failed to get attachment %d", id), err)
+	} else if !found {
+		return Attachment{}, problem.NewError(problem.CodeNotFound, fmt.Sprintf("attachment %d does not exist", id), ErrNoSuchCompletion)
+	}
+	return attachment, nil
+}
+
+// BadgeProgress gets the progress of the member of the group towards the
+// badge with the key.
+func (s ProgressService) BadgeProgress(ctx context.Context, groupID, memberID int64, key string) (Progress, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "ProgressService.BadgeProgress")
+	defer span.End()
+
+	if _, err := s.checkMember(ctx, groupID, memberID); err != nil {
+		return Progress{}, err
+	}
+	b, _, clientErr := s.version(ctx, groupID, memberID, key)
+	if clientErr != nil {
+		return Progress{}, clientErr
+	}
+	completions, err := s.store.ListCompletions(ctx, groupID, memberID, key)
+	if err != nil {
+		span.RecordError(err)
+		return Progress{}, security.NewClientError(fmt.Sprintf("failed to list completions of member %d", memberID), err)
+	}
+	return Evaluate(memberID, b, completions), nil
+}
+
+// MemberProgress gets the progress of the member of the group towards every
+// badge they've recorded completions for.
+func (s ProgressService) MemberProgress(ctx context.Context, groupID, memberID int64) ([]Progress, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "ProgressService.MemberProgress")
+	defer span.End()
+
+	if _, err := s.checkMember(ctx, groupID, memberID); err != nil {
+		return nil, err
+	}
+	completions, err := s.store.ListCompletions(ctx, groupID, memberID, "")
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError(fmt.Sprintf("failed to list completions of member %d", memberID), err)
+	}
+	progress := []Progress{}
+	seen := make(map[int64]bool)
+	for _, completion := range completions {
+		if seen[completion.BadgeId] {
+			continue
+		}
+		seen[completion.BadgeId] = true
+		b, found, err := s.catalogue.GetVersionByID(ctx, completion.BadgeId)
+		if err != nil {
+			return nil, security.NewClientError(fmt.Sprintf("failed to get badge %s", completion.BadgeKey), err)
+		} else if !found {
+			return nil, security.NewClientError(fmt.Sprintf("failed to get badge %s", completion.BadgeKey), badge.ErrNoSuchBadge)
+		}
+		progress = append(progress, Evaluate(memberID, b, completions))
+	}
+	return progress, nil
+}
+
+// History lists who recorded, signed off and attached what to the
+// completions of the member of the group, oldest first.
+func (s ProgressService) History(ctx context.Context, groupID, memberID int64) ([]Event, security.ClientError) {
+	if _, err := s.checkMember(ctx, groupID, memberID); err != nil {
+		return nil, err
+	}
+	events, err := s.store.ListMemberEvents(ctx, groupID, memberID)
+	if err != nil {
+		return nil, security.NewClientError(fmt.Sprintf("failed to list history of member %d", memberID), err)
+	}
+	return events, nil
+}
+
+// Evaluate computes the member's progress towards the version of the badge
+// from their completions. Completions of other badges are ignored.
+func Evaluate(memberID int64, b badge.Badge, completions []Completion) Progress {
+	byRequirement := make(map[string]*Completion)
+	for i := range completions {
+		if completions[i].BadgeId == b.Id {
+			byRequirement[completions[i].RequirementId] = &completions[i]
+		}
+	}
+	requirements, met := requirementProgress(b.Requirements, byRequirement)
+	return Progress{
+		MemberId:     memberID,
+		BadgeId:      b.Id,
+		BadgeKey:     b.Key,
+		BadgeVersion: b.Version,
+		Name:         b.Name,
+		Kind:         b.Kind,
+		Stage:        b.Stage,
+		Complete:     len(b.Requirements) > 0 && met == len(b.Requirements),
+		Requirements: requirements,
+	}
+}
+
+// requirementProgress computes the progress towards the requirements and
+// how many of them are met. A requirement is met if its completion is signed
+// off, or if it has requirements of its own and enough of them are met.
+func requirementProgress(requirements []badge.Requirement, completions map[string]*Completion) ([]RequirementProgress, int) {
+	progress := make([]RequirementProgress, 0, len(requirements))
+	met := 0
+	for _, requirement := range requirements {
+		p := RequirementProgress{
+			Id:          requirement.Id,
+			Description: requirement.Description,
+			Choose:      requirement.Choose,
+			Completion:  completions[requirement.Id],
+		}
+		var childrenMet int
+		p.Requirements, childrenMet = requirementProgress(requirement.Requirements, completions)
+		needed := requirement.Choose
+		if needed == 0 {
+			needed = len(requirement.Requirements)
+		}
+		p.Met = (p.Completion != nil && p.Completion.Status == StatusSignedOff) ||
+			(len(requirement.Requirements) > 0 && childrenMet >= needed)
+		if p.Met {
+			met++
+		}
+		progress = append(progress, p)
+	}
+	return progress, met
+}
+
+// storeError converts errors from the store to client errors.
+func storeError(message string, err error) security.ClientError {
+	switch {
+	case errors.Is(err, ErrNoSuchMember):
+		return problem.NewError(problem.CodeNotFound, "member does not exist", err)
+	case errors.Is(err, ErrNoSuchCompletion):
+		return problem.NewError(problem.CodeNotFound, "completion does not exist", err)
+	case errors.Is(err, ErrAlreadyRecorded):
+		return problem.NewError(CodeAlreadyRecorded, "the requirement has already been recorded for the member", err)
+	}
+	return security.NewClientError(message, err)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
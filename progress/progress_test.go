@@ -0,0 +1,414 @@
+package progress
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nick96/cubapi/badge"
+	"github.com/nick96/cubapi/date"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/openapi/openapitest"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/user"
+	"github.com/nick96/cubapi/user/usertest"
+	"go.uber.org/zap"
+)
+
+// Users requests are made as in tests.
+var (
+	cubLeader   = user.User{Id: 10, GroupId: testGroupID, Roles: []string{user.RoleLeader}}
+	scoutLeader = user.User{Id: 11, GroupId: testGroupID, Roles: []string{user.RoleLeader}}
+	admin       = user.User{Id: 12, GroupId: testGroupID, Roles: []string{user.RoleAdmin}}
+	otherLeader = user.User{Id: 20, GroupId: otherGroupID, Roles: []string{user.RoleLeader}}
+)
+
+// Members of the groups: cub is a cub of the test group and otherCub a cub of
+// the other group.
+const (
+	cub      = 1
+	otherCub = 2
+)
+
+var bushcraft = badge.Badge{
+	Key:      "oas-bushcraft-1",
+	Kind:     badge.KindOAS,
+	Name:     "Bushcraft",
+	Stage:    1,
+	Sections: []string{group.SectionJoeys, group.SectionCubs},
+	Requirements: badge.Requirements{
+		{Id: "1", Description: "Help prepare for an activity"},
+		{Id: "2", Description: "Complete 2 of the following", Choose: 2, Requirements: []badge.Requirement{
+			{Id: "2.1", Description: "Tie a reef knot"},
+			{Id: "2.2", Description: "Tie a sheet bend"},
+			{Id: "2.3", Description: "Tie a clove hitch"},
+		}},
+	},
+}
+
+// newTestStore creates a store with the catalogue of the bushcraft badge,
+// the members and the leaders of the test group's sections.
+func newTestStore() *mockProgressStore {
+	catalogue := &mockCatalogue{}
+	catalogue.add(bushcraft)
+	store := newMockProgressStore(catalogue)
+	store.members[cub] = mockMember{testGroupID, group.SectionCubs}
+	store.members[otherCub] = mockMember{otherGroupID, group.SectionCubs}
+	store.leaders[cubLeader.Id] = group.SectionCubs
+	store.leaders[scoutLeader.Id] = group.SectionScouts
+	store.leaders[otherLeader.Id] = group.SectionCubs
+	return store
+}
+
+// newTestRouter creates a router whose requests are made as the user.
+func newTestRouter(store *mockProgressStore, u user.User) chi.Router {
+	router := chi.NewRouter()
+	router.Use(usertest.As(u))
+	router.Route("/progress", NewProgressRouter(zap.NewNop(), NewProgressService(store, store.catalogue, time.UTC)))
+	return router
+}
+
+// record records the cub completing the requirement of the bushcraft badge.
+func record(t *testing.T, router http.Handler, requirement string) Completion {
+	var completion Completion
+	body := `{"requirementId": "` + requirement + `", "notes": "Did it"}`
+	if w := openapitest.Do(t, router, "POST", "/progress/member/1/badge/oas-bushcraft-1", body, &completion); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	return completion
+}
+
+func signOffPath(id int64) string {
+	return "/progress/completion/" + itoa(id) + "/sign-off"
+}
+
+func itoa(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func TestRecordAndSignOff(t *testing.T) {
+	router := newTestRouter(newTestStore(), cubLeader)
+
+	completion := record(t, router, "1")
+	if completion.Status != StatusPending || completion.CompletedOn != date.Today(time.UTC) || *completion.RecordedBy != cubLeader.Id {
+		t.Errorf("Expected a pending completion recorded today by the leader, got %+v", completion)
+	}
+	var progress Progress
+	openapitest.Do(t, router, "GET", "/progress/member/1/badge/oas-bushcraft-1", "", &progress)
+	if progress.Requirements[0].Met || progress.Requirements[0].Completion == nil {
+		t.Errorf("Expected the requirement to be recorded but not met until signed off, got %+v", progress.Requirements[0])
+	}
+
+	var signed Completion
+	if w := openapitest.Do(t, router, "POST", signOffPath(completion.Id), `{"notes": "Well done"}`, &signed); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if signed.Status != StatusSignedOff || *signed.SignedOffBy != cubLeader.Id || signed.SignedOffAt == nil {
+		t.Errorf("Expected the completion to be signed off by the leader, got %+v", signed)
+	}
+
+	// Two of the three knots meet the second requirement.
+	for _, requirement := range []string{"2.1", "2.3"} {
+		openapitest.Do(t, router, "POST", signOffPath(record(t, router, requirement).Id), `{}`, nil)
+	}
+	openapitest.Do(t, router, "GET", "/progress/member/1/badge/oas-bushcraft-1", "", &progress)
+	if !progress.Complete || !progress.Requirements[1].Met || progress.Requirements[1].Requirements[1].Met {
+		t.Errorf("Expected the badge to be complete with 2.2 unmet, got %+v", progress)
+	}
+
+	var all []Progress
+	openapitest.Do(t, router, "GET", "/progress/member/1", "", &all)
+	if len(all) != 1 || !all[0].Complete {
+		t.Errorf("Expected the member's progress towards the badge, got %+v", all)
+	}
+
+	var history []Event
+	openapitest.Do(t, router, "GET", "/progress/member/1/history", "", &history)
+	if len(history) != 6 || history[1].Action != ActionSignedOff || *history[1].UserId != cubLeader.Id || history[1].Notes != "Well done" {
+		t.Errorf("Expected who recorded and signed off each requirement, got %+v", history)
+	}
+}
+
+func TestOnlySectionLeadersSignOff(t *testing.T) {
+	store := newTestStore()
+	completion := record(t, newTestRouter(store, cubLeader), "1")
+
+	var resp problem.Problem
+	if w := openapitest.Do(t, newTestRouter(store, scoutLeader), "POST", signOffPath(completion.Id), `{}`, &resp); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a leader of another section not to sign off, got %d: %+v", w.Code, resp)
+	}
+	if w := openapitest.Do(t, newTestRouter(store, admin), "POST", signOffPath(completion.Id), `{}`, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected an admin to sign off, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRevokeSignOff(t *testing.T) {
+	router := newTestRouter(newTestStore(), cubLeader)
+	completion := record(t, router, "1")
+	revokePath := "/progress/completion/" + itoa(completion.Id) + "/revoke"
+
+	var resp problem.Problem
+	if w := openapitest.Do(t, router, "POST", revokePath, `{"reason": "Mistake"}`, &resp); w.Code != http.StatusConflict || resp.Code != CodeNotSignedOff {
+		t.Errorf("Expected revoking a pending completion to conflict, got %d: %+v", w.Code, resp)
+	}
+	openapitest.Do(t, router, "POST", signOffPath(completion.Id), `{}`, nil)
+	if w := openapitest.Do(t, router, "POST", signOffPath(completion.Id), `{}`, &resp); w.Code != http.StatusConflict || resp.Code != CodeAlreadySignedOff {
+		t.Errorf("Expected signing off twice to conflict, got %d: %+v", w.Code, resp)
+	}
+	if w := openapitest.Do(t, router, "POST", revokePath, `{}`, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected revoking without a reason to fail, got %d", w.Code)
+	}
+
+	var revoked Completion
+	if w := openapitest.Do(t, router, "POST", revokePath, `{"reason": "Signed the wrong cub"}`, &revoked); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if revoked.Status != StatusPending || revoked.SignedOffBy != nil {
+		t.Errorf("Expected the completion to wait for sign off again, got %+v", revoked)
+	}
+	var detail CompletionDetail
+	openapitest.Do(t, router, "GET", "/progress/completion/"+itoa(completion.Id), "", &detail)
+	actions := []string{}
+	for _, event := range detail.History {
+		actions = append(actions, event.Action)
+	}
+	if strings.Join(actions, ",") != "recorded,signed_off,revoked" || detail.History[2].Notes != "Signed the wrong cub" {
+		t.Errorf("Expected the full history, got %+v", detail.History)
+	}
+}
+
+func TestProgressKeepsStartedVersion(t *testing.T) {
+	store := newTestStore()
+	store.members[3] = mockMember{testGroupID, group.SectionCubs}
+	router := newTestRouter(store, cubLeader)
+	record(t, router, "2.3")
+
+	edited := bushcraft
+	edited.Requirements = badge.Requirements{{Id: "1", Description: "Help plan an activity"}}
+	store.catalogue.add(edited)
+
+	var progress Progress
+	openapitest.Do(t, router, "GET", "/progress/member/1/badge/oas-bushcraft-1", "", &progress)
+	if progress.BadgeVersion != 1 || len(progress.Requirements) != 2 {
+		t.Errorf("Expected the member to keep working towards version 1, got %+v", progress)
+	}
+	record(t, router, "2.1")
+
+	// Members that haven't started work towards the latest version.
+	var completion Completion
+	if w := openapitest.Do(t, router, "POST", "/progress/member/3/badge/oas-bushcraft-1", `{"requirementId": "2.1"}`, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a requirement removed from the latest version to be invalid, got %d: %s", w.Code, w.Body.String())
+	}
+	openapitest.Do(t, router, "POST", "/progress/member/3/badge/oas-bushcraft-1", `{"requirementId": "1"}`, &completion)
+	if completion.BadgeVersion != 2 {
+		t.Errorf("Expected the latest version to be started, got %+v", completion)
+	}
+}
+
+func TestInvalidCompletions(t *testing.T) {
+	store := newTestStore()
+	store.members[3] = mockMember{testGroupID, group.SectionScouts}
+	retired := bushcraft
+	retired.Key, retired.Retired = "oas-retired-1", true
+	store.catalogue.add(retired)
+	router := newTestRouter(store, cubLeader)
+	record(t, router, "1")
+
+	tomorrow := date.Today(time.UTC).AddDays(1).String()
+	testCases := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"unknown-requirement", "/progress/member/1/badge/oas-bushcraft-1", `{"requirementId": "9"}`, http.StatusBadRequest},
+		{"no-requirement", "/progress/member/1/badge/oas-bushcraft-1", `{}`, http.StatusBadRequest},
+		{"parent", "/progress/member/1/badge/oas-bushcraft-1", `{"requirementId": "2"}`, http.StatusBadRequest},
+		{"future", "/progress/member/1/badge/oas-bushcraft-1", `{"requirementId": "2.1", "completedOn": "` + tomorrow + `"}`, http.StatusBadRequest},
+		{"already-recorded", "/progress/member/1/badge/oas-bushcraft-1", `{"requirementId": "1"}`, http.StatusConflict},
+		{"retired", "/progress/member/1/badge/oas-retired-1", `{"requirementId": "1"}`, http.StatusBadRequest},
+		{"other-section", "/progress/member/3/badge/oas-bushcraft-1", `{"requirementId": "1"}`, http.StatusBadRequest},
+		{"missing-badge", "/progress/member/1/badge/oas-missing-1", `{"requirementId": "1"}`, http.StatusNotFound},
+		{"missing-member", "/progress/member/9/badge/oas-bushcraft-1", `{"requirementId": "1"}`, http.StatusNotFound},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := openapitest.Do(t, router, "POST", tt.path, tt.body, nil); w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	router := newTestRouter(newTestStore(), cubLeader)
+	completion := record(t, router, "1")
+	attachmentPath := "/progress/completion/" + itoa(completion.Id) + "/attachment"
+
+	upload := func(filename string, data []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", attachmentPath+"?filename="+filename, bytes.NewReader(data))
+		r.Header.Set("Content-Type", "image/png")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := upload("..%2Fknot.png", []byte("png"))
+	var attachment Attachment
+	json.Unmarshal(w.Body.Bytes(), &attachment)
+	if w.Code != http.StatusCreated || attachment.Filename != "knot.png" || attachment.Size != 3 || attachment.ContentType != "image/png" {
+		t.Fatalf("Expected the attachment to be added without its path, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = openapitest.Do(t, router, "GET", attachmentPath+"/"+itoa(attachment.Id), "", nil)
+	if w.Body.String() != "png" || w.Header().Get("Content-Type") != "image/png" || w.Header().Get("Content-Disposition") != "attachment; filename=knot.png" {
+		t.Errorf("Expected the attachment to be downloaded, got %v: %s", w.Header(), w.Body.String())
+	}
+
+	if w := upload("large.png", make([]byte, maxAttachmentSize+1)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected a large attachment to be rejected, got %d", w.Code)
+	}
+	if w := upload("empty.png", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an empty attachment to be rejected, got %d", w.Code)
+	}
+	if w := upload("", []byte("png")); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unnamed attachment to be rejected, got %d", w.Code)
+	}
+
+	var detail CompletionDetail
+	openapitest.Do(t, router, "GET", "/progress/completion/"+itoa(completion.Id), "", &detail)
+	if len(detail.Attachments) != 1 || detail.History[len(detail.History)-1].Action != ActionAttached {
+		t.Errorf("Expected the attachment and its history, got %+v", detail)
+	}
+}
+
+func TestProgressIsScopedToGroup(t *testing.T) {
+	store := newTestStore()
+	router, other := newTestRouter(store, cubLeader), newTestRouter(store, otherLeader)
+	completion := record(t, router, "1")
+	upload := httptest.NewRequest("POST", "/progress/completion/1/attachment?filename=a.txt", strings.NewReader("a"))
+	router.ServeHTTP(httptest.NewRecorder(), upload)
+
+	for _, tt := range []struct{ method, path, body string }{
+		{"GET", "/progress/member/1", ""},
+		{"GET", "/progress/member/1/history", ""},
+		{"GET", "/progress/member/1/badge/oas-bushcraft-1", ""},
+		{"POST", "/progress/member/1/badge/oas-bushcraft-1", `{"requirementId": "2.1"}`},
+		{"GET", "/progress/completion/1", ""},
+		{"POST", "/progress/completion/1/sign-off", `{}`},
+		{"POST", "/progress/completion/1/attachment?filename=b.txt", "b"},
+		{"GET", "/progress/completion/1/attachment/1", ""},
+	} {
+		if w := openapitest.Do(t, other, tt.method, tt.path, tt.body, nil); w.Code != http.StatusNotFound {
+			t.Errorf("Expected %s %s from another group not to be found, got %d: %s", tt.method, tt.path, w.Code, w.Body.String())
+		}
+	}
+	if store.completions[completion.Id].Status != StatusPending || len(store.completions) != 1 || len(store.attachments) != 1 {
+		t.Errorf("Expected another group not to change progress, got %+v", store.completions)
+	}
+
+	// Completions of the other group's members can't be recorded either.
+	if w := openapitest.Do(t, router, "POST", "/progress/member/2/badge/oas-bushcraft-1", `{"requirementId": "1"}`, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a member of another group not to be found, got %d", w.Code)
+	}
+}
+
+func TestCreditMeeting(t *testing.T) {
+	store := newTestStore()
+	const scout = 3
+	store.members[scout] = mockMember{testGroupID, group.SectionScouts}
+	service := NewProgressService(store, store.catalogue, time.UTC)
+	router := newTestRouter(store, cubLeader)
+	ctx := context.Background()
+	// The cub has already recorded the reef knot themselves.
+	record(t, router, "2.1")
+
+	heldOn := date.Today(time.UTC).AddDays(-1)
+	credit := MeetingCredit{
+		GroupId:    testGroupID,
+		MeetingId:  7,
+		HeldOn:     heldOn,
+		RecordedBy: cubLeader.Id,
+		Notes:      "Attended knot night",
+		Credits: []Credit{
+			{cub, bushcraft.Key, "2.1"},
+			{cub, bushcraft.Key, "2.2"},
+			{scout, bushcraft.Key, "2.2"},
+		},
+	}
+	if err := service.CreditMeeting(ctx, credit); err != nil {
+		t.Fatalf("Failed to credit meeting: %v", err)
+	}
+	credited, _ := store.ListMeetingCompletions(ctx, testGroupID, 7)
+	if len(credited) != 1 || credited[0].RequirementId != "2.2" || credited[0].Status != StatusPending ||
+		credited[0].CompletedOn != heldOn || credited[0].Notes != "Attended knot night" {
+		t.Fatalf("Expected only the cub's sheet bend to be credited, got %+v", credited)
+	}
+
+	// Crediting again changes nothing.
+	if err := service.CreditMeeting(ctx, credit); err != nil {
+		t.Fatalf("Failed to credit meeting again: %v", err)
+	}
+	if again, _ := store.ListMeetingCompletions(ctx, testGroupID, 7); len(again) != 1 || again[0].Id != credited[0].Id {
+		t.Errorf("Expected crediting to be idempotent, got %+v", again)
+	}
+
+	// Withdrawing the credit removes the pending completion but not the
+	// one the cub recorded themselves.
+	credit.Credits = nil
+	if err := service.CreditMeeting(ctx, credit); err != nil {
+		t.Fatalf("Failed to withdraw credit: %v", err)
+	}
+	if withdrawn, _ := store.ListMeetingCompletions(ctx, testGroupID, 7); len(withdrawn) != 0 {
+		t.Errorf("Expected the credit to be withdrawn, got %+v", withdrawn)
+	}
+	if len(store.completions) != 1 {
+		t.Errorf("Expected the cub's own completion to be kept, got %+v", store.completions)
+	}
+}
+
+func TestCreditMeetingKeepsSignedOff(t *testing.T) {
+	store := newTestStore()
+	service := NewProgressService(store, store.catalogue, time.UTC)
+	router := newTestRouter(store, cubLeader)
+	ctx := context.Background()
+
+	credit := MeetingCredit{GroupId: testGroupID, MeetingId: 7, HeldOn: date.Today(time.UTC), RecordedBy: cubLeader.Id, Credits: []Credit{{cub, bushcraft.Key, "1"}}}
+	service.CreditMeeting(ctx, credit)
+	credited, _ := store.ListMeetingCompletions(ctx, testGroupID, 7)
+	if len(credited) != 1 {
+		t.Fatalf("Expected the cub to be credited, got %+v", credited)
+	}
+	openapitest.Do(t, router, "POST", signOffPath(credited[0].Id), `{}`, nil)
+
+	credit.Credits = nil
+	service.CreditMeeting(ctx, credit)
+	if kept, _ := store.ListMeetingCompletions(ctx, testGroupID, 7); len(kept) != 1 || kept[0].Status != StatusSignedOff {
+		t.Errorf("Expected the signed off completion to be kept, got %+v", kept)
+	}
+}
+
+func TestCheckRequirement(t *testing.T) {
+	store := newTestStore()
+	retired := bushcraft
+	retired.Key = "oas-bushcraft-old"
+	retired.Retired = true
+	store.catalogue.add(retired)
+	service := NewProgressService(store, store.catalogue, time.UTC)
+
+	if err := service.CheckRequirement(context.Background(), bushcraft.Key, "2.2"); err != nil {
+		t.Errorf("Expected the requirement to be creditable: %v", err)
+	}
+	for _, tt := range []struct{ key, requirement string }{{bushcraft.Key, "9"}, {bushcraft.Key, "2"}, {"oas-missing-1", "1"}, {retired.Key, "1"}} {
+		if err := service.CheckRequirement(context.Background(), tt.key, tt.requirement); err == nil {
+			t.Errorf("Expected requirement %s of %s not to be creditable", tt.requirement, tt.key)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package progress
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/nick96/cubapi/db"
+)
+
+var (
+	// ErrNoSuchMember is returned when a member doesn't exist in the group.
+	ErrNoSuchMember = errors.New("member does not exist")
+	// ErrNoSuchCompletion is returned when a completion doesn't exist in the
+	// group.
+	ErrNoSuchCompletion = errors.New("completion does not exist")
+	// ErrAlreadyRecorded is returned when recording a requirement the member
+	// already has a completion for.
+	ErrAlreadyRecorded = errors.New("requirement has already been recorded")
+	// ErrStatusChanged is returned when changing the status of a completion
+	// that no longer has the status it was expected to.
+	ErrStatusChanged = errors.New("completion status has changed")
+)
+
+// uniqueViolation is the Postgres error code of unique constraint violations,
+// see https://www.postgresql.org/docs/current/errcodes-appendix.html.
+const uniqueViolation = "23505"
+
+// completionColumns selects completions with the key and version of their
+// badge, from completions aliased as c and badges as b.
+const completionColumns = `c.*, b.key AS badge_key, b.version AS badge_version`
+
+// ProgressStorer is an interface that must be implemented by things that
+// store progress. Everything is scoped to a group.
+type ProgressStorer interface {
+	// GetMemberSection gets the section of the member of the group.
+	GetMemberSection(ctx context.Context, groupID, memberID int64) (string, bool, error)
+	// LeadsSection reports whether the user leads the section of the member.
+	LeadsSection(ctx context.Context, groupID, memberID, userID int64) (bool, error)
+	// StartedVersion gets the ID of the version of the badge with the key
+	// the member has recorded completions for, if any.
+	StartedVersion(ctx context.Context, groupID, memberID int64, key string) (int64, bool, error)
+	GetCompletion(ctx context.Context, groupID, id int64) (Completion, bool, error)
+	// ListCompletions lists the completions of the member, only those of
+	// the badge with the key unless it is empty.
+	ListCompletions(ctx context.Context, groupID, memberID int64, key string) ([]Completion, error)
+	// AddCompletion adds the completion and records it in its history.
+	AddCompletion(ctx context.Context, completion Completion) (Completion, error)
+	// ListMeetingCompletions lists the completions credited by attending
+	// the meeting.
+	ListMeetingCompletions(ctx context.Context, groupID, meetingID int64) ([]Completion, error)
+	// DeletePendingCompletion deletes the completion with its history if
+	// it's pending.
+	DeletePendingCompletion(ctx context.Context, groupID, id int64) error
+	// SetStatus changes the status of the completion from one status to
+	// another and records the event in its history.
+	SetStatus(ctx context.Context, groupID, id int64, from, to string, event Event) (Completion, error)
+	ListEvents(ctx context.Context, groupID, completionID int64) ([]Event, error)
+	// ListMemberEvents lists the history of every completion of the member.
+	ListMemberEvents(ctx context.Context, groupID, memberID int64) ([]Event, error)
+	// AddAttachment adds the attachment and records it in the history of its
+	// completion.
+	AddAttachment(ctx context.Context, groupID int64, attachment Attachment) (Attachment, error)
+	// ListAttachments lists the attachments of the completion without their
+	// data.
+	ListAttachments(ctx context.Context, groupID, completionID int64) ([]Attachment, error)
+	GetAttachment(ctx context.Context, groupID, completionID, id int64) (Attachment, bool, error)
+}
+
+// ProgressStore is a store for progress. It implements the ProgressStorer
+// interface.
+type ProgressStore struct {
+	cluster *db.Cluster
+}
+
+// NewStore creates a new store from the given cluster. Reads go to a replica
+// unless the primary is forced with db.WithPrimary.
+func NewStore(cluster *db.Cluster) ProgressStorer {
+	return ProgressStore{cluster}
+}
+
+// GetMemberSection gets the section of the member of the group.
+func (s ProgressStore) GetMemberSection(ctx context.Context, groupID, memberID int64) (string, bool, error) {
+	var section string
+	query := `SELECT section FROM autocrat.members WHERE group_id = $1 AND id = $2;`
+	err := s.cluster.Reader(ctx).Named("progress.get_member_section").QueryRowx(ctx, query, groupID, memberID).Scan(&section)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, fmt.Errorf("could not get member %d: %w", memberID, err)
+	}
+	return section, true, nil
+}
+
+// LeadsSection reports whether the user leads the section of the member.
+func (s ProgressStore) LeadsSection(ctx context.Context, groupID, memberID, userID int64) (bool, error) {
+	var leads bool
+	query := `
+	SELECT EXISTS (
+		SELECT 1
+		FROM autocrat.members m
+		JOIN autocrat.sections s ON s.group_id = m.group_id AND s.kind = m.section
+		JOIN autocrat.section_leaders l ON l.section_id = s.id
+		WHERE m.group_id = $1 AND m.id = $2 AND l.user_id = $3
+	);
+	`
+	if err := s.cluster.Reader(ctx).Named("progress.leads_section").QueryRowx(ctx, query, groupID, memberID, userID).Scan(&leads); err != nil {
+		return false, fmt.Errorf("failed to check user %d leads member %d: %w", userID, memberID, err)
+	}
+	return leads, nil
+}
+
+// StartedVersion gets the ID of the version of the badge with the key the
+// member has recorded completions for, if any.
+func (s ProgressStore) StartedVersion(ctx context.Context, groupID, memberID int64, key string) (int64, bool, error) {
+	var id int64
+	query := `
+	SELECT c.badge_id
+	FROM autocrat.completions c JOIN autocrat.badges b ON b.id = c.badge_id
+	WHERE c.group_id = $1 AND c.member_id = $2 AND b.key = $3
+	ORDER BY c.recorded_at
+	LIMIT 1;
+	`
+	err := s.cluster.Reader(ctx).Named("progress.started_version").QueryRowx(ctx, query, groupID, memberID, key).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, fmt.Errorf("failed to find the version of badge %s started by member %d: %w", key, memberID, err)
+	}
+	return id, true, nil
+}
+
+// GetCompletion gets the completion of the group with the given ID.
+func (s ProgressStore) GetCompletion(ctx context.Context, groupID, id int64) (completion Completion, found bool, err error) {
+	query := `
+	SELECT ` + completionColumns + `
+	FROM autocrat.completions c JOIN autocrat.badges b ON b.id = c.badge_id
+	WHERE c.group_id = $1 AND c.id = $2;
+	`
+	err = s.cluster.Reader(ctx).Named("progress.get_completion").QueryRowx(ctx, query, groupID, id).StructScan(&completion)
+	if err == sql.ErrNoRows {
+		return Completion{}, false, nil
+	} else if err != nil {
+		return Completion{}, false, fmt.Errorf("could not get completion %d: %w", id, err)
+	}
+	return completion, true, nil
+}
+
+// ListCompletions lists the completions of the member ordered by badge and
+// requirement.
+func (s ProgressStore) ListCompletions(ctx context.Context, groupID, memberID int64, key string) ([]Completion, error) {
+	completions := []Completion{}
+	query := `
+	SELECT ` + completionColumns + `
+	FROM autocrat.completions c JOIN autocrat.badges b ON b.id = c.badge_id
+	WHERE c.group_id = $1 AND c.member_id = $2 AND ($3 = '' OR b.key = $3)
+	ORDER BY b.key, c.requirement_id;
+	`
+	if err := s.cluster.Reader(ctx).Named("progress.list_completions").Select(ctx, &completions, query, groupID, memberID, key); err != nil {
+		return nil, fmt.Errorf("failed to list completions of member %d: %w", memberID, err)
+	}
+	return completions, nil
+}
+
+// AddCompletion adds the completion and records it in its history. The
+// completion's member must be in its group.
+func (s ProgressStore) AddCompletion(ctx context.Context, completion Completion) (Completion, error) {
+	var added Completion
+	query := `
+	WITH c AS (
+		INSERT INTO autocrat.completions (
+			group_id, member_id, badge_id, requirement_id, completed_on, notes, status, recorded_by, meeting_id
+		)
+		SELECT $1::INTEGER, $2::INTEGER, $3::INTEGER, $4::TEXT, $5::DATE, $6::TEXT, $7::TEXT, $8::INTEGER, $9::INTEGER
+		WHERE EXISTS (SELECT 1 FROM autocrat.members WHERE group_id = $1::INTEGER AND id = $2::INTEGER)
+		RETURNING *
+	), e AS (
+		INSERT INTO autocrat.completion_events (completion_id, action, user_id, notes)
+		SELECT id, '` + ActionRecorded + `', recorded_by, notes FROM c
+	)
+	SELECT ` + completionColumns + ` FROM c JOIN autocrat.badges b ON b.id = c.badge_id;
+	`
+	err := s.cluster.Primary().Named("progress.add_completion").
+		QueryRowx(ctx, query,
+			completion.GroupId, completion.MemberId, completion.BadgeId, completion.RequirementId,
+			completion.CompletedOn, completion.Notes, completion.Status, completion.RecordedBy, completion.MeetingId,
+		).
+		StructScan(&added)
+	var pqErr *pq.Error
+	if err == sql.ErrNoRows {
+		return Completion{}, fmt.Errorf("failed to add completion: %w", ErrNoSuchMember)
+	} else if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return Completion{}, fmt.Errorf("failed to add completion: %w: %v", ErrAlreadyRecorded, err)
+	} else if err != nil {
+		return Completion{}, fmt.Errorf("failed to add completion: %w", err)
+	}
+	return added, nil
+}
+
+// ListMeetingCompletions lists the completions of members of the group
+// credited by attending the meeting.
+func (s ProgressStore) ListMeetingCompletions(ctx context.Context, groupID, meetingID int64) ([]Completion, error) {
+	completions := []Completion{}
+	query := `
+	SELECT ` + completionColumns + `
+	FROM autocrat.completions c JOIN autocrat.badges b ON b.id = c.badge_id
+	WHERE c.group_id = $1 AND c.meeting_id = $2
+	ORDER BY c.member_id, b.key, c.requirement_id;
+	`
+	if err := s.cluster.Reader(ctx).Named("progress.list_meeting_completions").Select(ctx, &completions, query, groupID, meetingID); err != nil {
+		return nil, fmt.Errorf("failed to list completions credited by meeting %d: %w", meetingID, err)
+	}
+	return completions, nil
+}
+
+// DeletePendingCompletion deletes the completion of the group with the given
+// ID, and its history, if it's still pending.
+func (s ProgressStore) DeletePendingCompletion(ctx context.Context, groupID, id int64) error {
+	query := `DELETE FROM autocrat.completions WHERE group_id = $1 AND id = $2 AND status = '` + StatusPending + `';`
+	result, err := s.cluster.Primary().Named("progress.delete_pending_completion").Exec(ctx, query, groupID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete completion %d: %w", id, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete completion %d: %w", id, err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("failed to delete completion %d: %w", id, ErrStatusChanged)
+	}
+	return nil
+}
+
+// SetStatus changes the status of the completion from one status to another
+// and records the event in its history. Signing off records who signed off
+// and when, anything else clears it.
+func (s ProgressStore) SetStatus(ctx context.Context, groupID, id int64, from, to string, event Event) (Completion, error) {
+	var updated Completion
+	query := `
+	WITH c AS (
+		UPDATE autocrat.completions
+		SET status = $4::TEXT,
+			signed_off_by = CASE WHEN $4::TEXT = '` + StatusSignedOff + `' THEN $5::INTEGER END,
+			signed_off_at = CASE WHEN $4::TEXT = '` + StatusSignedOff + `' THEN now() END
+		WHERE group_id = $1 AND id = $2 AND status = $3::TEXT
+		RETURNING *
+	), e AS (
+		INSERT INTO autocrat.completion_events (completion_id, action, user_id, notes)
+		SELECT id, $6::TEXT, $5::INTEGER, $7::TEXT FROM c
+	)
+	SELECT ` + completionColumns + ` FROM c JOIN autocrat.badges b ON b.id = c.badge_id;
+	`
+	err := s.cluster.Primary().Named("progress.set_status").
+		QueryRowx(ctx, query, groupID, id, from, to, event.UserId, event.Action, event.Notes).
+		StructScan(&updated)
+	if err == sql.ErrNoRows {
+		return Completion{}, fmt.Errorf("failed to set status of completion %d: %w", id, ErrStatusChanged)
+	} else if err != nil {
+		return Completion{}, fmt.Errorf("failed to set status of completion %d: %w", id, err)
+	}
+	return updated, nil
+}
+
+// eventColumns selects events with the badge and requirement of their
+// completion, from completion_events aliased as e, completions as c and
+// badges as b.
+const eventColumns = `e.*, b.key AS badge_key, c.requirement_id`
+
+// ListEvents lists the history of the completion, oldest first.
+func (s ProgressStore) ListEvents(ctx context.Context, groupID, completionID int64) ([]Event, error) {
+	events := []Event{}
+	query := `
+	SELECT ` + eventColumns + `
+	FROM autocrat.completion_events e
+	JOIN autocrat.completions c ON c.id = e.completion_id
+	JOIN autocrat.badges b ON b.id = c.badge_id
+	WHERE c.group_id = $1 AND c.id = $2
+	ORDER BY e.created_at, e.id;
+	`
+	if err := s.cluster.Reader(ctx).Named("progress.list_events").Select(ctx, &events, query, groupID, completionID); err != nil {
+		return nil, fmt.Errorf("failed to list history of completion %d: %w", completionID, err)
+	}
+	return events, nil
+}
+
+// ListMemberEvents lists the history of every completion of the member,
+// oldest first.
+func (s ProgressStore) ListMemberEvents(ctx context.Context, groupID, memberID int64) ([]Event, error) {
+	events := []Event{}
+	query := `
+	SELECT ` + eventColumns + `
+	FROM autocrat.completion_events e
+	JOIN autocrat.completions c ON c.id = e.completion_id
+	JOIN autocrat.badges b ON b.id = c.badge_id
+	WHERE c.group_id = $1 AND c.member_id = $2
+	ORDER BY e.created_at, e.id;
+	`
+	if err := s.cluster.Reader(ctx).Named("progress.list_member_events").Select(ctx, &events, query, groupID, memberID); err != nil {
+		return nil, fmt.Errorf("failed to list history of member %d: %w", memberID, err)
+	}
+	return events, nil
+}
+
+// AddAttachment adds the attachment to the completion of the group and
+// records it in the completion's history.
+func (s ProgressStore) AddAttachment(ctx context.Context, groupID int64, attachment Attachment) (Attachment, error) {
+	var added Attachment
+	query := `
+	WITH a AS (
+		INSERT INTO autocrat.completion_attachments (completion_id, filename, content_type, data, uploaded_by)
+		SELECT $2::INTEGER, $3::TEXT, $4::TEXT, $5::BYTEA, $6::INTEGER
+		WHERE EXISTS (SELECT 1 FROM autocrat.completions WHERE group_id = $1::INTEGER AND id = $2::INTEGER)
+		RETURNING *
+	), e AS (
+		INSERT INTO autocrat.completion_events (completion_id, action, user_id, notes)
+		SELECT completion_id, '` + ActionAttached + `', uploaded_by, filename FROM a
+	)
+	SELECT id, completion_id, filename, content_type, octet_length(data) AS size, uploaded_by, created_at FROM a;
+	`
+	err := s.cluster.Primary().Named("progress.add_attachment").
+		QueryRowx(ctx, query,
+			groupID, attachment.CompletionId, attachment.Filename, attachment.ContentType, attachment.Data, attachment.UploadedBy,
+		).
+		StructScan(&added)
+	if err == sql.ErrNoRows {
+		return Attachment{}, fmt.Errorf("failed to add attachment: %w", ErrNoSuchCompletion)
+	} else if err != nil {
+		return Attachment{}, fmt.Errorf("failed to add attachment: %w", err)
+	}
+	return added, nil
+}
+
+// ListAttachments lists the attachments of the completion of the group,
+// oldest first, without their data.
+func (s ProgressStore) ListAttachments(ctx context.Context, groupID, completionID int64) ([]Attachment, error) {
+	attachments := []Attachment{}
+	query := `
+	SELECT a.id, a.completion_id, a.filename, a.content_type, octet_length(a.data) AS size, a.uploaded_by, a.created_at
+	FROM autocrat.completion_attachments a JOIN autocrat.completions c ON c.id = a.completion_id
+	WHERE c.group_id = $1 AND c.id = $2
+	ORDER BY a.id;
+	`
+	if err := s.cluster.Reader(ctx).Named("progress.list_attachments").Select(ctx, &attachments, query, groupID, completionID); err != nil {
+		return nil, fmt.Errorf("failed to list attachments of completion %d: %w", completionID, err)
+	}
+	return attachments, nil
+}
+
+// GetAttachment gets the attachment of the completion of the group with its
+// data.
+func (s ProgressStore) GetAttachment(ctx context.Context, groupID, completionID, id int64) (attachment Attachment, found bool, err error) {
+	query := `
+	SELECT a.*, octet_length(a.data) AS size
+	FROM autocrat.completion_attachments a JOIN autocrat.completions c ON c.id = a.completion_id
+	WHERE c.group_id = $1 AND c.id = $2 AND a.id = $3;
+	`
+	err = s.cluster.Reader(ctx).Named("progress.get_attachment").QueryRowx(ctx, query, groupID, completionID, id).StructScan(&attachment)
+	if err == sql.ErrNoRows {
+		return Attachment{}, false, nil
+	} else if err != nil {
+		return Attachment{}, false, fmt.Errorf("could not get attachment %d: %w", id, err)
+	}
+	return attachment, true, nil
+}
@@ -0,0 +1,260 @@
+package progress
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/nick96/cubapi/badge"
+)
+
+// Groups members belong to in tests.
+const (
+	testGroupID  = 1
+	otherGroupID = 2
+)
+
+// mockMember is a member of a group in a section.
+type mockMember struct {
+	groupID int64
+	section string
+}
+
+// mockCatalogue is a badge catalogue in memory.
+type mockCatalogue struct {
+	versions []badge.Badge
+}
+
+// add adds a version of a badge, numbered after the badge's latest.
+func (c *mockCatalogue) add(b badge.Badge) badge.Badge {
+	latest, _, _ := c.GetBadge(context.Background(), b.Key)
+	b.Id = int64(len(c.versions) + 1)
+	b.Version = latest.Version + 1
+	c.versions = append(c.versions, b)
+	return b
+}
+
+func (c *mockCatalogue) GetBadge(ctx context.Context, key string) (badge.Badge, bool, error) {
+	var latest badge.Badge
+	for _, b := range c.versions {
+		if b.Key == key && b.Version > latest.Version {
+			latest = b
+		}
+	}
+	return latest, latest.Version != 0, nil
+}
+
+func (c *mockCatalogue) GetVersionByID(ctx context.Context, id int64) (badge.Badge, bool, error) {
+	for _, b := range c.versions {
+		if b.Id == id {
+			return b, true, nil
+		}
+	}
+	return badge.Badge{}, false, nil
+}
+
+// mockProgressStore stores progress in memory. leaders maps the IDs of users
+// to the section they lead.
+type mockProgressStore struct {
+	catalogue   *mockCatalogue
+	members     map[int64]mockMember
+	leaders     map[int64]string
+	completions map[int64]Completion
+	events      []Event
+	attachments []Attachment
+}
+
+func newMockProgressStore(catalogue *mockCatalogue) *mockProgressStore {
+	return &mockProgressStore{
+		catalogue:   catalogue,
+		members:     make(map[int64]mockMember),
+		leaders:     make(map[int64]string),
+		completions: make(map[int64]Completion),
+	}
+}
+
+func (s *mockProgressStore) GetMemberSection(ctx context.Context, groupID, memberID int64) (string, bool, error) {
+	member, ok := s.members[memberID]
+	if !ok || member.groupID != groupID {
+		return "", false, nil
+	}
+	return member.section, true, nil
+}
+
+func (s *mockProgressStore) LeadsSection(ctx context.Context, groupID, memberID, userID int64) (bool, error) {
+	member, ok := s.members[memberID]
+	return ok && member.groupID == groupID && s.leaders[userID] == member.section, nil
+}
+
+func (s *mockProgressStore) StartedVersion(ctx context.Context, groupID, memberID int64, key string) (int64, bool, error) {
+	for _, completion := range s.sorted() {
+		if completion.GroupId == groupID && completion.MemberId == memberID && completion.BadgeKey == key {
+			return completion.BadgeId, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (s *mockProgressStore) GetCompletion(ctx context.Context, groupID, id int64) (Completion, bool, error) {
+	completion, ok := s.completions[id]
+	if !ok || completion.GroupId != groupID {
+		return Completion{}, false, nil
+	}
+	return completion, true, nil
+}
+
+// sorted returns the completions in the order they were recorded.
+func (s *mockProgressStore) sorted() []Completion {
+	completions := make([]Completion, 0, len(s.completions))
+	for _, completion := range s.completions {
+		completions = append(completions, completion)
+	}
+	sort.Slice(completions, func(i, j int) bool { return completions[i].Id < completions[j].Id })
+	return completions
+}
+
+func (s *mockProgressStore) ListCompletions(ctx context.Context, groupID, memberID int64, key string) ([]Completion, error) {
+	completions := []Completion{}
+	for _, completion := range s.sorted() {
+		if completion.GroupId == groupID && completion.MemberId == memberID && (key == "" || completion.BadgeKey == key) {
+			completions = append(completions, completion)
+		}
+	}
+	return completions, nil
+}
+
+func (s *mockProgressStore) AddCompletion(ctx context.Context, completion Completion) (Completion, error) {
+	if member, ok := s.members[completion.MemberId]; !ok || member.groupID != completion.GroupId {
+		return Completion{}, ErrNoSuchMember
+	}
+	for _, other := range s.completions {
+		if other.MemberId == completion.MemberId && other.BadgeId == completion.BadgeId && other.RequirementId == completion.RequirementId {
+			return Completion{}, ErrAlreadyRecorded
+		}
+	}
+	b, _, _ := s.catalogue.GetVersionByID(ctx, completion.BadgeId)
+	completion.Id = int64(len(s.completions) + 1)
+	for s.completions[completion.Id].Id != 0 {
+		completion.Id++
+	}
+	completion.BadgeKey = b.Key
+	completion.BadgeVersion = b.Version
+	completion.RecordedAt = time.Now()
+	s.completions[completion.Id] = completion
+	s.addEvent(completion, Event{Action: ActionRecorded, UserId: completion.RecordedBy, Notes: completion.Notes})
+	return completion, nil
+}
+
+func (s *mockProgressStore) ListMeetingCompletions(ctx context.Context, groupID, meetingID int64) ([]Completion, error) {
+	completions := []Completion{}
+	for _, completion := range s.completions {
+		if completion.GroupId == groupID && completion.MeetingId != nil && *completion.MeetingId == meetingID {
+			completions = append(completions, completion)
+		}
+	}
+	sort.Slice(completions, func(i, j int) bool { return completions[i].Id < completions[j].Id })
+	return completions, nil
+}
+
+func (s *mockProgressStore) DeletePendingCompletion(ctx context.Context, groupID, id int64) error {
+	completion, ok := s.completions[id]
+	if !ok || completion.GroupId != groupID || completion.Status != StatusPending {
+		return ErrStatusChanged
+	}
+	delete(s.completions, id)
+	events := s.events[:0]
+	for _, event := range s.events {
+		if event.CompletionId != id {
+			events = append(events, event)
+		}
+	}
+	s.events = events
+	return nil
+}
+
+func (s *mockProgressStore) addEvent(completion Completion, event Event) {
+	event.Id = int64(len(s.events) + 1)
+	event.CompletionId = completion.Id
+	event.BadgeKey = completion.BadgeKey
+	event.RequirementId = completion.RequirementId
+	event.CreatedAt = time.Now()
+	s.events = append(s.events, event)
+}
+
+func (s *mockProgressStore) SetStatus(ctx context.Context, groupID, id int64, from, to string, event Event) (Completion, error) {
+	completion, ok := s.completions[id]
+	if !ok || completion.GroupId != groupID || completion.Status != from {
+		return Completion{}, ErrStatusChanged
+	}
+	completion.Status = to
+	completion.SignedOffBy, completion.SignedOffAt = nil, nil
+	if to == StatusSignedOff {
+		now := time.Now()
+		completion.SignedOffBy, completion.SignedOffAt = event.UserId, &now
+	}
+	s.completions[id] = completion
+	s.addEvent(completion, event)
+	return completion, nil
+}
+
+func (s *mockProgressStore) ListEvents(ctx context.Context, groupID, completionID int64) ([]Event, error) {
+	events := []Event{}
+	if completion, ok := s.completions[completionID]; ok && completion.GroupId == groupID {
+		for _, event := range s.events {
+			if event.CompletionId == completionID {
+				events = append(events, event)
+			}
+		}
+	}
+	return events, nil
+}
+
+func (s *mockProgressStore) ListMemberEvents(ctx context.Context, groupID, memberID int64) ([]Event, error) {
+	events := []Event{}
+	for _, event := range s.events {
+		if completion := s.completions[event.CompletionId]; completion.GroupId == groupID && completion.MemberId == memberID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *mockProgressStore) AddAttachment(ctx context.Context, groupID int64, attachment Attachment) (Attachment, error) {
+	completion, ok := s.completions[attachment.CompletionId]
+	if !ok || completion.GroupId != groupID {
+		return Attachment{}, ErrNoSuchCompletion
+	}
+	attachment.Id = int64(len(s.attachments) + 1)
+	attachment.Size = int64(len(attachment.Data))
+	attachment.CreatedAt = time.Now()
+	s.attachments = append(s.attachments, attachment)
+	s.addEvent(completion, Event{Action: ActionAttached, UserId: attachment.UploadedBy, Notes: attachment.Filename})
+	attachment.Data = nil
+	return attachment, nil
+}
+
+func (s *mockProgressStore) ListAttachments(ctx context.Context, groupID, completionID int64) ([]Attachment, error) {
+	attachments := []Attachment{}
+	if completion, ok := s.completions[completionID]; ok && completion.GroupId == groupID {
+		for _, attachment := range s.attachments {
+			if attachment.CompletionId == completionID {
+				attachment.Data = nil
+				attachments = append(attachments, attachment)
+			}
+		}
+	}
+	return attachments, nil
+}
+
+func (s *mockProgressStore) GetAttachment(ctx context.Context, groupID, completionID, id int64) (Attachment, bool, error) {
+	completion, ok := s.completions[completionID]
+	if !ok || completion.GroupId != groupID {
+		return Attachment{}, false, nil
+	}
+	for _, attachment := range s.attachments {
+		if attachment.Id == id && attachment.CompletionId == completionID {
+			return attachment, true, nil
+		}
+	}
+	return Attachment{}, false, nil
+}
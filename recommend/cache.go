@@ -0,0 +1,77 @@
+package recommend
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Bounds of the caches of evaluated progress and badge versions. Evaluated
+// progress is only reused while the member's stamp is unchanged, so the TTL
+// just stops members who are no longer looked at holding memory.
+const (
+	memberCacheSize  = 10000
+	versionCacheSize = 1000
+	cacheTTL         = time.Hour
+)
+
+// lru is a cache of at most size entries that each expire ttl after they're
+// added. The least recently used entry is evicted to make room for another.
+type lru struct {
+	mu   sync.Mutex
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+	// order has the most recently used entry at the front.
+	order   *list.List
+	entries map[int64]*list.Element
+}
+
+type lruEntry struct {
+	key     int64
+	value   interface{}
+	expires time.Time
+}
+
+func newLRU(size int, ttl time.Duration) *lru {
+	return &lru{size: size, ttl: ttl, now: time.Now, order: list.New(), entries: make(map[int64]*list.Element)}
+}
+
+// get gets the value with the key if it's cached and hasn't expired.
+func (c *lru) get(key int64) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// add caches the value with the key, replacing any value it already has.
+func (c *lru) add(key int64, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *lru) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*lruEntry).key)
+}
@@ -0,0 +1,47 @@
+package recommend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newLRU(2, time.Hour)
+	cache.add(1, "Mowgli")
+	cache.add(2, "Akela")
+	if _, ok := cache.get(1); !ok {
+		t.Fatal("Expected Mowgli to be cached")
+	}
+	cache.add(3, "Baloo")
+	if _, ok := cache.get(2); ok {
+		t.Error("Expected Akela to be evicted as the least recently used")
+	}
+	for _, key := range []int64{1, 3} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("Expected %d to still be cached", key)
+		}
+	}
+	cache.add(3, "Bagheera")
+	if value, _ := cache.get(3); value != "Bagheera" || len(cache.entries) != 2 {
+		t.Errorf("Expected adding again to replace the value, got %v with %d entries", value, len(cache.entries))
+	}
+}
+
+func TestLRUExpiresEntries(t *testing.T) {
+	now := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	cache := newLRU(2, time.Hour)
+	cache.now = func() time.Time { return now }
+	cache.add(1, "Mowgli")
+
+	now = now.Add(59 * time.Minute)
+	if _, ok := cache.get(1); !ok {
+		t.Fatal("Expected Mowgli to be cached until the TTL")
+	}
+	now = now.Add(time.Minute)
+	if _, ok := cache.get(1); ok {
+		t.Error("Expected Mowgli to expire after the TTL")
+	}
+	if len(cache.entries) != 0 || cache.order.Len() != 0 {
+		t.Errorf("Expected the expired entry to be removed, got %d entries", len(cache.entries))
+	}
+}
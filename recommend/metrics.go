@@ -0,0 +1,17 @@
+package recommend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	recomputations = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "autocrat_recommend_recomputations_total",
+		Help: "Number of times a member's progress was evaluated because it changed.",
+	})
+	cacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "autocrat_recommend_cache_hits_total",
+		Help: "Number of times a member's evaluated progress was reused because it hadn't changed.",
+	})
+)
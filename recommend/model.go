@@ -0,0 +1,83 @@
+package recommend
+
+// Member is a member recommendations are made for.
+type Member struct {
+	Id int64 `json:"id" db:"id"`
+	// GroupId is the ID of the group of the member. It's implied by the
+	// caller's group so it isn't exposed.
+	GroupId   int64  `json:"-" db:"group_id"`
+	FirstName string `json:"firstName" db:"firstname"`
+	LastName  string `json:"lastName" db:"lastname"`
+	Section   string `json:"section" db:"section"`
+	// Stamp identifies the state of the member's progress: the ID of the
+	// latest event in the history of their completions and how many
+	// completions they have. Events are only added, and only pending
+	// completions are ever removed, so it changes whenever their progress
+	// does.
+	Stamp string `json:"-" db:"stamp"`
+}
+
+// NearComplete is a badge a member is close to completing.
+type NearComplete struct {
+	BadgeKey     string `json:"badgeKey"`
+	BadgeVersion int    `json:"badgeVersion"`
+	Name         string `json:"name"`
+	Kind         string `json:"kind"`
+	Stage        int    `json:"stage"`
+	// Remaining is the fewest requirements that still have to be signed
+	// off to complete the badge.
+	Remaining int `json:"remaining"`
+	// Open are the requirements that complete the badge with the fewest
+	// sign offs.
+	Open []OpenRequirement `json:"open"`
+}
+
+// OpenRequirement is a requirement that hasn't been met.
+type OpenRequirement struct {
+	Id          string `json:"id"`
+	Description string `json:"description"`
+}
+
+// MemberNearComplete is a member of a section and the badges they are close
+// to completing.
+type MemberNearComplete struct {
+	Member
+	Badges []NearComplete `json:"badges"`
+}
+
+// Activity is something a section could do, e.g. at a meeting, and the
+// requirements doing it meets.
+type Activity struct {
+	Name         string           `json:"name" validate:"required,max=256"`
+	Description  string           `json:"description,omitempty" validate:"max=1024"`
+	Requirements []RequirementRef `json:"requirements" validate:"min=1,max=64,dive"`
+}
+
+// RequirementRef refers to a requirement of a badge. Members meet the
+// requirement with the ID in the version of the badge they work towards.
+type RequirementRef struct {
+	BadgeKey      string `json:"badgeKey" validate:"required,max=64"`
+	RequirementId string `json:"requirementId" validate:"required,max=64"`
+}
+
+// RankedActivity is an activity and how much it would help the members of a
+// section.
+type RankedActivity struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Score is how many open requirements of members of the section the
+	// activity meets, counting each requirement of each member once.
+	Score int `json:"score"`
+	// Members is how many members it meets an open requirement of.
+	Members int `json:"members"`
+	// Completes is how many badges it would complete.
+	Completes    int                `json:"completes"`
+	Requirements []RequirementScore `json:"requirements"`
+}
+
+// RequirementScore is how many members of a section a requirement is open
+// for.
+type RequirementScore struct {
+	RequirementRef
+	Members int `json:"members"`
+}
@@ -0,0 +1,72 @@
+package recommend
+
+import (
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/user"
+)
+
+// DescribeRecommendRouter describes the operations of NewRecommendRouter.
+func DescribeRecommendRouter(r *openapi.Router) {
+	memberID := openapi.PathParam("memberID", "The ID of the member.", openapi.Integer())
+	section := openapi.PathParam("section", "The kind of section.", openapi.Enum(group.Sections))
+	minWithin, maxWithin := float64(1), float64(maxWithin)
+	within := openapi.Parameter{
+		Name:        "within",
+		In:          "query",
+		Description: "How many requirements from complete badges can be, one by default.",
+		Schema:      &openapi.Schema{Type: "integer", Minimum: &minWithin, Maximum: &maxWithin},
+	}
+	denied := map[string]*openapi.Response{
+		"403": r.Problem("The request isn't authenticated, the user isn't a leader or admin, or the CSRF token is missing."),
+		"429": r.Problem("The client has made too many requests."),
+		"500": r.Problem("The request couldn't be completed."),
+	}
+	responses := func(responses map[string]*openapi.Response) map[string]*openapi.Response {
+		for status, response := range denied {
+			responses[status] = response
+		}
+		return responses
+	}
+
+	r.Get("/member/{memberID}", &openapi.Operation{
+		OperationID: "recommendMemberBadges",
+		Summary:     "List a member's badges that are close to complete",
+		Description: "Each badge has the fewest requirements that still have to be signed off to complete it.",
+		Tags:        []string{"recommend"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{memberID, within},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The badges, closest to complete first.", []NearComplete{}),
+			"400": r.Problem("within is out of range."),
+			"404": r.Problem("The member doesn't exist in the group."),
+		}),
+	})
+	r.Get("/section/{section}", &openapi.Operation{
+		OperationID: "recommendSectionBadges",
+		Summary:     "List the badges members of a section are close to completing",
+		Description: "Active members of the section without any badges close to complete are left out.",
+		Tags:        []string{"recommend"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{section, within},
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The members ordered by name.", []MemberNearComplete{}),
+			"400": r.Problem("within is out of range."),
+			"404": r.Problem("The section doesn't exist."),
+		}),
+	})
+	r.Post("/section/{section}/activities", &openapi.Operation{
+		OperationID: "rankActivities",
+		Summary:     "Rank activities for a section",
+		Description: "Activities are scored by how many requirements they meet that active members of the section haven't met or recorded. Badges members haven't started count if they're for the section and not retired.",
+		Tags:        []string{"recommend"},
+		Security:    user.Authenticated,
+		Parameters:  []openapi.Parameter{section},
+		RequestBody: r.JSONBody(ActivitiesRequest{}),
+		Responses: responses(map[string]*openapi.Response{
+			"200": r.JSON("The activities, most helpful first.", []RankedActivity{}),
+			"400": r.Problem("The request body is invalid or refers to a badge that doesn't exist."),
+			"404": r.Problem("The section doesn't exist."),
+		}),
+	})
+}
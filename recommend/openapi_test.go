@@ -0,0 +1,39 @@
+package recommend
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/openapi/openapitest"
+	"github.com/nick96/cubapi/progress"
+)
+
+// TestOpenAPIContract checks that the handlers behave as the OpenAPI document
+// says they do. If this fails either the handlers or DescribeRecommendRouter
+// need updating.
+func TestOpenAPIContract(t *testing.T) {
+	store, catalogue := newTestStore()
+	store.complete(mowgli, catalogue.versions[0], "1", progress.StatusSignedOff)
+	store.complete(mowgli, catalogue.versions[0], "2.1", progress.StatusSignedOff)
+	router := newTestRouter(NewRecommendService(store, catalogue), testGroupID)
+
+	doc := openapi.New("autocrat", "test")
+	doc.Route("/recommend", DescribeRecommendRouter)
+	if err := doc.CheckRoutes(router); err != nil {
+		t.Fatal(err)
+	}
+
+	activities := `{"activities": [{"name": "Knots", "requirements": [{"badgeKey": "oas-bushcraft-1", "requirementId": "2.2"}]}]}`
+	openapitest.Run(t, doc, router, []openapitest.Case{
+		{Name: "member", Method: "GET", Pattern: "/recommend/member/{memberID}", Path: "/recommend/member/1?within=2", Status: http.StatusOK},
+		{Name: "member-within", Method: "GET", Pattern: "/recommend/member/{memberID}", Path: "/recommend/member/1?within=9", Status: http.StatusBadRequest},
+		{Name: "member-missing", Method: "GET", Pattern: "/recommend/member/{memberID}", Path: "/recommend/member/9", Status: http.StatusNotFound},
+		{Name: "section", Method: "GET", Pattern: "/recommend/section/{section}", Path: "/recommend/section/cubs", Status: http.StatusOK},
+		{Name: "section-missing", Method: "GET", Pattern: "/recommend/section/{section}", Path: "/recommend/section/wolves", Status: http.StatusNotFound},
+		{Name: "activities", Method: "POST", Pattern: "/recommend/section/{section}/activities", Path: "/recommend/section/cubs/activities", Body: activities, Status: http.StatusOK},
+		{Name: "activities-invalid", Method: "POST", Pattern: "/recommend/section/{section}/activities", Path: "/recommend/section/cubs/activities", Body: `{"activities": []}`, Invalid: true, Status: http.StatusBadRequest},
+		{Name: "activities-missing-badge", Method: "POST", Pattern: "/recommend/section/{section}/activities", Path: "/recommend/section/cubs/activities", Body: strings.Replace(activities, "bushcraft", "aquatics", 1), Status: http.StatusBadRequest},
+	})
+}
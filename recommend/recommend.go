@@ -0,0 +1,149 @@
+package recommend
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/problem"
+	"go.uber.org/zap"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// ActivitiesRequest lists activities to rank.
+type ActivitiesRequest struct {
+	Activities []Activity `json:"activities" validate:"min=1,max=100,dive"`
+}
+
+// NewRecommendRouter creates a router for recommendations. It must be behind
+// authentication, which decides the group.
+//
+// GET /member/{memberID}: List the badges the member has started that are
+// close to complete. The within query parameter is how many requirements
+// away they can be, one by default.
+// GET /section/{section}: List the members of the section with the badges
+// they've started that are close to complete, as above.
+// POST /section/{section}/activities: Rank activities by how many open
+// requirements of members of the section they meet.
+func NewRecommendRouter(logger *zap.Logger, service RecommendService) func(chi.Router) {
+	validate := problem.NewValidator()
+	return func(r chi.Router) {
+		r.Get("/member/{memberID}", memberNearComplete(logger, service))
+		r.Get("/section/{section}", sectionNearComplete(logger, service))
+		r.Post("/section/{section}/activities", rankActivities(logger, validate, service))
+	}
+}
+
+func memberNearComplete(logger *zap.Logger, service RecommendService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := group.FromRequest(w, r)
+		if !ok {
+			return
+		}
+		memberID, err := strconv.ParseInt(chi.URLParam(r, "memberID"), 10, 64)
+		if err != nil {
+			problem.Write(w, r, problem.New(problem.CodeNotFound, "Member does not exist"))
+			return
+		}
+		within, ok := withinParam(w, r)
+		if !ok {
+			return
+		}
+		badges, clientErr := service.MemberNearComplete(r.Context(), groupID, memberID, within)
+		if clientErr != nil {
+			logger.Info("Failed to recommend badges", zap.Int64("memberID", memberID), zap.Error(clientErr))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, clientErr))
+			return
+		}
+		render.JSON(w, r, badges)
+	}
+}
+
+func sectionNearComplete(logger *zap.Logger, service RecommendService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := group.FromRequest(w, r)
+		if !ok {
+			return
+		}
+		within, ok := withinParam(w, r)
+		if !ok {
+			return
+		}
+		section := chi.URLParam(r, "section")
+		members, err := service.SectionNearComplete(r.Context(), groupID, section, within)
+		if err != nil {
+			logger.Info("Failed to recommend badges", zap.String("section", section), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, members)
+	}
+}
+
+func rankActivities(logger *zap.Logger, validate *validator.Validate, service RecommendService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
+		groupID, ok := group.FromRequest(w, r)
+		if !ok {
+			return
+		}
+		var request ActivitiesRequest
+		if !decodeRequest(logger, w, r, validate, &request) {
+			return
+		}
+		section := chi.URLParam(r, "section")
+		ranked, err := service.RankActivities(r.Context(), groupID, section, request.Activities)
+		if err != nil {
+			logger.Info("Failed to rank activities", zap.String("section", section), zap.Error(err))
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, err))
+			return
+		}
+		render.JSON(w, r, ranked)
+	}
+}
+
+// withinParam parses the within query parameter, which defaults to one. A
+// problem is written if it isn't a number.
+func withinParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	param := r.URL.Query().Get("within")
+	if param == "" {
+		return 1, true
+	}
+	within, err := strconv.Atoi(param)
+	if err != nil {
+		problem.Write(w, r, problem.New(problem.CodeValidationFailed, "within must be a number"))
+		return 0, false
+	}
+	return within, true
+}
+
+// decodeRequest decodes and validates a request into v. A problem is written
+// if the request is invalid.
+func decodeRequest(logger *zap.Logger, w http.ResponseWriter, r *http.Request, validate *validator.Validate, v interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Info("Failed to read request body", zap.Error(err))
+		problem.Write(w, r, problem.Internal(err))
+		return false
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, v); err != nil {
+		logger.Info("Failed to unmarshal request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Request body is invalid JSON", err))
+		return false
+	}
+	if err := validate.Struct(v); err != nil {
+		logger.Info("Invalid request", zap.Error(err))
+		problem.Write(w, r, problem.Validation("Invalid request body", err))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,432 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/nick96/cubapi/badge"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/progress"
+	"github.com/nick96/cubapi/security"
+	"github.com/nick96/cubapi/tracing"
+)
+
+// ErrNoSuchMember is returned when recommending for a member that doesn't
+// exist.
+var ErrNoSuchMember = errors.New("member does not exist")
+
+// maxWithin is the most requirements away from completion a badge can be to
+// be recommended.
+const maxWithin = 5
+
+// Catalogue finds badges in the badge catalogue. It's implemented by
+// badge.BadgeStorer.
+type Catalogue interface {
+	GetVersionByID(ctx context.Context, id int64) (badge.Badge, bool, error)
+	ListBadges(ctx context.Context, filter badge.Filter) ([]badge.Badge, error)
+}
+
+// RecommendService recommends badges to work towards and activities to run
+// from the progress of members. Evaluating progress means walking every
+// badge a member has started, so it's cached and only recomputed for the
+// members whose progress changed since it was last evaluated. The cache
+// holds the members looked at most recently, see memberCacheSize.
+type RecommendService struct {
+	store     RecommendStorer
+	catalogue Catalogue
+	// members caches the memberState of members by ID and versions the
+	// badge.Badge of versions by ID.
+	members  *lru
+	versions *lru
+}
+
+// NewRecommendService creates a RecommendService that recommends from the
+// progress in the store towards badges of the catalogue.
+func NewRecommendService(store RecommendStorer, catalogue Catalogue) RecommendService {
+	return RecommendService{
+		store:     store,
+		catalogue: catalogue,
+		members:   newLRU(memberCacheSize, cacheTTL),
+		versions:  newLRU(versionCacheSize, cacheTTL),
+	}
+}
+
+// memberState is the evaluated progress of a member as of their stamp.
+type memberState struct {
+	stamp string
+	// progress is the member's progress towards each badge they've
+	// started by key.
+	progress map[string]progress.Progress
+	// completions are the member's completions of each badge they've
+	// started by key.
+	completions map[string][]progress.Completion
+	// badges are the versions of each badge they've started by key.
+	badges map[string]badge.Badge
+}
+
+// checkWithin checks how many requirements from completion badges can be is
+// within range.
+func checkWithin(within int) security.ClientError {
+	if within < 1 || within > maxWithin {
+		return problem.Invalid("within must be between 1 and %d", maxWithin)
+	}
+	return nil
+}
+
+// checkSection checks the section is a kind of section.
+func checkSection(section string) security.ClientError {
+	for _, s := range group.Sections {
+		if s == section {
+			return nil
+		}
+	}
+	return problem.NewError(problem.CodeNotFound, fmt.Sprintf("section %s does not exist", section), group.ErrNoSuchSection)
+}
+
+// version gets the version of a badge with the ID, from the cache if it's
+// been got before.
+func (s RecommendService) version(ctx context.Context, id int64) (badge.Badge, error) {
+	if cached, ok := s.versions.get(id); ok {
+		return cached.(badge.Badge), nil
+	}
+	b, found, err := s.catalogue.GetVersionByID(ctx, id)
+	if err != nil {
+		return badge.Badge{}, err
+	} else if !found {
+		return badge.Badge{}, fmt.Errorf("badge version %d: %w", id, badge.ErrNoSuchBadge)
+	}
+	s.versions.add(id, b)
+	return b, nil
+}
+
+// states gets the evaluated progress of the members of the group by ID. Only
+// members whose stamp differs from the one their cached progress was
+// evaluated at have their completions listed and evaluated again.
+func (s RecommendService) states(ctx context.Context, groupID int64, members []Member) (map[int64]memberState, error) {
+	states := make(map[int64]memberState, len(members))
+	var stale []int64
+	for _, member := range members {
+		if cached, ok := s.members.get(member.Id); ok && cached.(memberState).stamp == member.Stamp {
+			states[member.Id] = cached.(memberState)
+		} else {
+			stale = append(stale, member.Id)
+		}
+	}
+	cacheHits.Add(float64(len(members) - len(stale)))
+	if len(stale) == 0 {
+		return states, nil
+	}
+
+	completions, err := s.store.ListCompletions(ctx, groupID, stale)
+	if err != nil {
+		return nil, err
+	}
+	byMember := make(map[int64][]progress.Completion)
+	for _, completion := range completions {
+		byMember[completion.MemberId] = append(byMember[completion.MemberId], completion)
+	}
+	stamps := make(map[int64]string, len(members))
+	for _, member := range members {
+		stamps[member.Id] = member.Stamp
+	}
+	for _, id := range stale {
+		state := memberState{
+			stamp:       stamps[id],
+			progress:    make(map[string]progress.Progress),
+			completions: make(map[string][]progress.Completion),
+			badges:      make(map[string]badge.Badge),
+		}
+		for _, completion := range byMember[id] {
+			state.completions[completion.BadgeKey] = append(state.completions[completion.BadgeKey], completion)
+		}
+		for key, completions := range state.completions {
+			b, err := s.version(ctx, completions[0].BadgeId)
+			if err != nil {
+				return nil, err
+			}
+			state.badges[key] = b
+			state.progress[key] = progress.Evaluate(id, b, completions)
+		}
+		states[id] = state
+	}
+	for _, id := range stale {
+		s.members.add(id, states[id])
+	}
+	recomputations.Add(float64(len(stale)))
+	return states, nil
+}
+
+// MemberNearComplete lists the badges the member of the group has started
+// that are at most within requirements from being complete, closest first.
+func (s RecommendService) MemberNearComplete(ctx context.Context, groupID, memberID int64, within int) ([]NearComplete, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "RecommendService.MemberNearComplete")
+	defer span.End()
+
+	if err := checkWithin(within); err != nil {
+		return nil, err
+	}
+	member, found, err := s.store.GetMember(ctx, groupID, memberID)
+	if err != nil {
+		return nil, security.NewClientError(fmt.Sprintf("failed to get member %d", memberID), err)
+	} else if !found {
+		return nil, problem.NewError(problem.CodeNotFound, fmt.Sprintf("member %d does not exist", memberID), ErrNoSuchMember)
+	}
+	states, err := s.states(ctx, groupID, []Member{member})
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError(fmt.Sprintf("failed to evaluate progress of member %d", memberID), err)
+	}
+	return nearComplete(states[memberID], within), nil
+}
+
+// SectionNearComplete lists the active members of the section of the group
+// with the badges they've started that are at most within requirements from
+// being complete. Members without any are left out.
+func (s RecommendService) SectionNearComplete(ctx context.Context, groupID int64, section string, within int) ([]MemberNearComplete, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "RecommendService.SectionNearComplete")
+	defer span.End()
+
+	if err := checkSection(section); err != nil {
+		return nil, err
+	}
+	if err := checkWithin(within); err != nil {
+		return nil, err
+	}
+	members, err := s.store.ListSectionMembers(ctx, groupID, section)
+	if err != nil {
+		return nil, security.NewClientError(fmt.Sprintf("failed to list members of %s", section), err)
+	}
+	states, err := s.states(ctx, groupID, members)
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError(fmt.Sprintf("failed to evaluate progress of %s", section), err)
+	}
+	near := []MemberNearComplete{}
+	for _, member := range members {
+		if badges := nearComplete(states[member.Id], within); len(badges) > 0 {
+			near = append(near, MemberNearComplete{Member: member, Badges: badges})
+		}
+	}
+	return near, nil
+}
+
+// RankActivities ranks the activities by how much they would help the active
+// members of the section of the group, most first. Each activity is scored
+// by how many requirements it meets that members haven't met or recorded.
+// Members are scored against the version of each badge they've started or,
+// if they haven't, the latest if it's for the section and not retired.
+func (s RecommendService) RankActivities(ctx context.Context, groupID int64, section string, activities []Activity) ([]RankedActivity, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "RecommendService.RankActivities")
+	defer span.End()
+
+	if err := checkSection(section); err != nil {
+		return nil, err
+	}
+	badges, err := s.catalogue.ListBadges(ctx, badge.Filter{Retired: true})
+	if err != nil {
+		return nil, security.NewClientError("failed to list badges", err)
+	}
+	latest := make(map[string]badge.Badge, len(badges))
+	for _, b := range badges {
+		latest[b.Key] = b
+	}
+	for _, activity := range activities {
+		for _, ref := range activity.Requirements {
+			if _, ok := latest[ref.BadgeKey]; !ok {
+				return nil, problem.Invalid("activity %s refers to badge %s which does not exist", activity.Name, ref.BadgeKey)
+			}
+		}
+	}
+
+	members, err := s.store.ListSectionMembers(ctx, groupID, section)
+	if err != nil {
+		return nil, security.NewClientError(fmt.Sprintf("failed to list members of %s", section), err)
+	}
+	states, err := s.states(ctx, groupID, members)
+	if err != nil {
+		span.RecordError(err)
+		return nil, security.NewClientError(fmt.Sprintf("failed to evaluate progress of %s", section), err)
+	}
+
+	ranked := make([]RankedActivity, 0, len(activities))
+	for _, activity := range activities {
+		ranked = append(ranked, s.rank(activity, section, members, states, latest))
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Completes != b.Completes {
+			return a.Completes > b.Completes
+		}
+		if a.Members != b.Members {
+			return a.Members > b.Members
+		}
+		return a.Name < b.Name
+	})
+	return ranked, nil
+}
+
+// rank scores the activity for the members of the section.
+func (s RecommendService) rank(activity Activity, section string, members []Member, states map[int64]memberState, latest map[string]badge.Badge) RankedActivity {
+	ranked := RankedActivity{
+		Name:         activity.Name,
+		Description:  activity.Description,
+		Requirements: make([]RequirementScore, 0, len(activity.Requirements)),
+	}
+	// Requirements are grouped by badge, in the order the activity first
+	// lists them, so the badges completed can be counted. Requirements
+	// listed twice are only counted once.
+	byBadge := make(map[string][]int)
+	var keys []string
+	seen := make(map[RequirementRef]bool)
+	for _, ref := range activity.Requirements {
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		if _, ok := byBadge[ref.BadgeKey]; !ok {
+			keys = append(keys, ref.BadgeKey)
+		}
+		byBadge[ref.BadgeKey] = append(byBadge[ref.BadgeKey], len(ranked.Requirements))
+		ranked.Requirements = append(ranked.Requirements, RequirementScore{RequirementRef: ref})
+	}
+
+	for _, member := range members {
+		state := states[member.Id]
+		helped := false
+		for _, key := range keys {
+			p, started := state.progress[key]
+			b := state.badges[key]
+			if !started {
+				b = latest[key]
+				if b.Retired || !containsString(b.Sections, section) {
+					continue
+				}
+				p = progress.Evaluate(member.Id, b, nil)
+			}
+			if p.Complete {
+				continue
+			}
+			open := openRequirements(p.Requirements, make(map[string]bool))
+			completions := state.completions[key]
+			met := false
+			for _, i := range byBadge[key] {
+				id := ranked.Requirements[i].RequirementId
+				if !open[id] {
+					continue
+				}
+				ranked.Requirements[i].Members++
+				ranked.Score++
+				helped, met = true, true
+				completions = append(completions, progress.Completion{
+					MemberId:      member.Id,
+					BadgeId:       b.Id,
+					RequirementId: id,
+					Status:        progress.StatusSignedOff,
+				})
+			}
+			if met && progress.Evaluate(member.Id, b, completions).Complete {
+				ranked.Completes++
+			}
+		}
+		if helped {
+			ranked.Members++
+		}
+	}
+	return ranked
+}
+
+// openRequirements adds the IDs of the requirements that are open to open
+// and returns it. A requirement is open if neither it nor any requirement
+// it's part of is met and it has no completion recorded, signed off or not.
+func openRequirements(requirements []progress.RequirementProgress, open map[string]bool) map[string]bool {
+	for _, r := range requirements {
+		if r.Met {
+			continue
+		}
+		if r.Completion == nil {
+			open[r.Id] = true
+		}
+		openRequirements(r.Requirements, open)
+	}
+	return open
+}
+
+// nearComplete lists the started, incomplete badges in the state that are at
+// most within requirements from being complete, closest first.
+func nearComplete(state memberState, within int) []NearComplete {
+	near := []NearComplete{}
+	for _, p := range state.progress {
+		if p.Complete {
+			continue
+		}
+		n, open := remaining(p.Requirements, 0)
+		if n > within {
+			continue
+		}
+		near = append(near, NearComplete{
+			BadgeKey:     p.BadgeKey,
+			BadgeVersion: p.BadgeVersion,
+			Name:         p.Name,
+			Kind:         p.Kind,
+			Stage:        p.Stage,
+			Remaining:    n,
+			Open:         open,
+		})
+	}
+	sort.Slice(near, func(i, j int) bool {
+		if near[i].Remaining != near[j].Remaining {
+			return near[i].Remaining < near[j].Remaining
+		}
+		return near[i].BadgeKey < near[j].BadgeKey
+	})
+	return near
+}
+
+// remaining computes the fewest requirements that have to be signed off to
+// meet needed of the requirements, or all of them if needed is zero, and
+// which requirements those are. A met requirement needs none, one without
+// requirements of its own needs itself and any other needs the fewest to
+// meet enough of its requirements.
+func remaining(requirements []progress.RequirementProgress, needed int) (int, []OpenRequirement) {
+	type option struct {
+		n    int
+		open []OpenRequirement
+	}
+	options := make([]option, 0, len(requirements))
+	for _, r := range requirements {
+		switch {
+		case r.Met:
+			options = append(options, option{})
+		case len(r.Requirements) == 0:
+			options = append(options, option{1, []OpenRequirement{{r.Id, r.Description}}})
+		default:
+			n, open := remaining(r.Requirements, r.Choose)
+			options = append(options, option{n, open})
+		}
+	}
+	if needed == 0 || needed > len(options) {
+		needed = len(options)
+	}
+	sort.SliceStable(options, func(i, j int) bool { return options[i].n < options[j].n })
+	total, open := 0, []OpenRequirement{}
+	for _, o := range options[:needed] {
+		total += o.n
+		open = append(open, o.open...)
+	}
+	return total, open
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,300 @@
+package recommend
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/nick96/cubapi/badge"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/openapi/openapitest"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/progress"
+	"go.uber.org/zap"
+)
+
+// Members of the groups: mowgli and akela are cubs of the test group, hathi
+// a scout of it and otherCub a cub of the other group.
+const (
+	mowgli   = 1
+	akela    = 2
+	hathi    = 3
+	otherCub = 4
+)
+
+var bushcraft = badge.Badge{
+	Key:      "oas-bushcraft-1",
+	Kind:     badge.KindOAS,
+	Name:     "Bushcraft",
+	Stage:    1,
+	Sections: []string{group.SectionJoeys, group.SectionCubs},
+	Requirements: badge.Requirements{
+		{Id: "1", Description: "Help prepare for an activity"},
+		{Id: "2", Description: "Complete 2 of the following", Choose: 2, Requirements: []badge.Requirement{
+			{Id: "2.1", Description: "Tie a reef knot"},
+			{Id: "2.2", Description: "Tie a sheet bend"},
+			{Id: "2.3", Description: "Tie a clove hitch"},
+		}},
+	},
+}
+
+var camping = badge.Badge{
+	Key:      "oas-camping-1",
+	Kind:     badge.KindOAS,
+	Name:     "Camping",
+	Stage:    1,
+	Sections: []string{group.SectionCubs, group.SectionScouts},
+	Requirements: badge.Requirements{
+		{Id: "1", Description: "Pack for a camp"},
+		{Id: "2", Description: "Pitch a tent"},
+		{Id: "3", Description: "Cook a meal"},
+	},
+}
+
+// newTestStore creates a store with the members of the test and other
+// groups and a catalogue with the bushcraft and camping badges.
+func newTestStore() (*mockRecommendStore, *mockCatalogue) {
+	catalogue := &mockCatalogue{}
+	catalogue.add(bushcraft)
+	catalogue.add(camping)
+	store := newMockRecommendStore()
+	store.members[mowgli] = Member{Id: mowgli, GroupId: testGroupID, FirstName: "Mowgli", Section: group.SectionCubs}
+	store.members[akela] = Member{Id: akela, GroupId: testGroupID, FirstName: "Akela", Section: group.SectionCubs}
+	store.members[hathi] = Member{Id: hathi, GroupId: testGroupID, FirstName: "Hathi", Section: group.SectionScouts}
+	store.members[otherCub] = Member{Id: otherCub, GroupId: otherGroupID, FirstName: "Bagheera", Section: group.SectionCubs}
+	return store, catalogue
+}
+
+// newTestRouter creates a router whose requests are made in the group.
+func newTestRouter(service RecommendService, groupID int64) chi.Router {
+	router := chi.NewRouter()
+	router.Use(inGroup(groupID))
+	router.Route("/recommend", NewRecommendRouter(zap.NewNop(), service))
+	return router
+}
+
+func TestMemberNearComplete(t *testing.T) {
+	store, catalogue := newTestStore()
+	b, c := catalogue.versions[0], catalogue.versions[1]
+	store.complete(mowgli, b, "1", progress.StatusSignedOff)
+	store.complete(mowgli, b, "2.1", progress.StatusSignedOff)
+	// Pending completions don't count until they're signed off.
+	store.complete(mowgli, c, "1", progress.StatusPending)
+	router := newTestRouter(NewRecommendService(store, catalogue), testGroupID)
+
+	var near []NearComplete
+	if w := openapitest.Do(t, router, "GET", "/recommend/member/1", "", &near); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	want := []NearComplete{{
+		BadgeKey: bushcraft.Key, BadgeVersion: 1, Name: "Bushcraft", Kind: badge.KindOAS, Stage: 1,
+		Remaining: 1, Open: []OpenRequirement{{"2.2", "Tie a sheet bend"}},
+	}}
+	if !reflect.DeepEqual(near, want) {
+		t.Errorf("Expected bushcraft to be one requirement away, got %+v", near)
+	}
+
+	openapitest.Do(t, router, "GET", "/recommend/member/1?within=3", "", &near)
+	if len(near) != 2 || near[1].BadgeKey != camping.Key || near[1].Remaining != 3 {
+		t.Errorf("Expected camping to be three requirements away, got %+v", near)
+	}
+
+	// Completed badges aren't close to complete, they are complete.
+	store.complete(mowgli, b, "2.3", progress.StatusSignedOff)
+	openapitest.Do(t, router, "GET", "/recommend/member/1?within=3", "", &near)
+	if len(near) != 1 || near[0].BadgeKey != camping.Key {
+		t.Errorf("Expected only camping to be close to complete, got %+v", near)
+	}
+}
+
+func TestRemainingChoosesCheapestRequirements(t *testing.T) {
+	// Two of: a leaf, a branch needing two leaves and a branch needing one
+	// of two leaves, one of which is met.
+	requirements := []progress.RequirementProgress{
+		{Id: "2", Choose: 2, Requirements: []progress.RequirementProgress{
+			{Id: "2.1"},
+			{Id: "2.2", Requirements: []progress.RequirementProgress{{Id: "2.2.1"}, {Id: "2.2.2"}}},
+			{Id: "2.3", Choose: 1, Met: true, Requirements: []progress.RequirementProgress{{Id: "2.3.1", Met: true}, {Id: "2.3.2"}}},
+		}},
+	}
+	n, open := remaining(requirements, 0)
+	if n != 1 || len(open) != 1 || open[0].Id != "2.1" {
+		t.Errorf("Expected only 2.1 to remain, got %d: %+v", n, open)
+	}
+}
+
+func TestSectionNearComplete(t *testing.T) {
+	store, catalogue := newTestStore()
+	b := catalogue.versions[0]
+	store.complete(akela, b, "1", progress.StatusSignedOff)
+	store.complete(akela, b, "2.1", progress.StatusSignedOff)
+	store.complete(mowgli, b, "1", progress.StatusSignedOff)
+	router := newTestRouter(NewRecommendService(store, catalogue), testGroupID)
+
+	var near []MemberNearComplete
+	if w := openapitest.Do(t, router, "GET", "/recommend/section/cubs", "", &near); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(near) != 1 || near[0].Id != akela || len(near[0].Badges) != 1 {
+		t.Errorf("Expected only Akela to be close to a badge, got %+v", near)
+	}
+	openapitest.Do(t, router, "GET", "/recommend/section/cubs?within=2", "", &near)
+	if len(near) != 2 {
+		t.Errorf("Expected both cubs to be within two requirements, got %+v", near)
+	}
+}
+
+func TestOnlyChangedProgressIsRecomputed(t *testing.T) {
+	store, catalogue := newTestStore()
+	b := catalogue.versions[0]
+	store.complete(mowgli, b, "1", progress.StatusSignedOff)
+	store.complete(akela, b, "1", progress.StatusSignedOff)
+	router := newTestRouter(NewRecommendService(store, catalogue), testGroupID)
+
+	var near []MemberNearComplete
+	openapitest.Do(t, router, "GET", "/recommend/section/cubs", "", &near)
+	openapitest.Do(t, router, "GET", "/recommend/section/cubs", "", &near)
+	if len(near) != 0 {
+		t.Errorf("Expected no cubs to be close to a badge, got %+v", near)
+	}
+	if !reflect.DeepEqual(store.listed, [][]int64{{mowgli, akela}}) {
+		t.Fatalf("Expected unchanged progress not to be listed again, got %v", store.listed)
+	}
+
+	store.complete(akela, b, "2.1", progress.StatusSignedOff)
+	openapitest.Do(t, router, "GET", "/recommend/section/cubs", "", &near)
+	if !reflect.DeepEqual(store.listed, [][]int64{{mowgli, akela}, {akela}}) {
+		t.Fatalf("Expected only Akela's progress to be listed again, got %v", store.listed)
+	}
+	if len(near) != 1 || near[0].Id != akela {
+		t.Errorf("Expected Akela's new progress to be used, got %+v", near)
+	}
+}
+
+func TestRankActivities(t *testing.T) {
+	store, catalogue := newTestStore()
+	b := catalogue.versions[0]
+	store.complete(mowgli, b, "1", progress.StatusSignedOff)
+	store.complete(mowgli, b, "2.1", progress.StatusSignedOff)
+	// Akela has recorded the sheet bend so it isn't open for them.
+	store.complete(akela, b, "2.2", progress.StatusPending)
+	router := newTestRouter(NewRecommendService(store, catalogue), testGroupID)
+
+	body := `{"activities": [
+		{"name": "Camp", "requirements": [{"badgeKey": "oas-camping-1", "requirementId": "2"}, {"badgeKey": "oas-camping-1", "requirementId": "3"}]},
+		{"name": "Knots", "requirements": [{"badgeKey": "oas-bushcraft-1", "requirementId": "2.2"}, {"badgeKey": "oas-bushcraft-1", "requirementId": "2.3"}, {"badgeKey": "oas-bushcraft-1", "requirementId": "2.3"}]},
+		{"name": "Rest", "requirements": [{"badgeKey": "oas-bushcraft-1", "requirementId": "1"}]}
+	]}`
+	var ranked []RankedActivity
+	if w := openapitest.Do(t, router, "POST", "/recommend/section/cubs/activities", body, &ranked); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var names []string
+	for _, activity := range ranked {
+		names = append(names, activity.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Camp", "Knots", "Rest"}) {
+		t.Fatalf("Expected the activities in order of score, got %v", names)
+	}
+
+	// Both knots are open for Mowgli, which completes their bushcraft, but
+	// only the clove hitch is for Akela.
+	knots := ranked[1]
+	if knots.Score != 3 || knots.Members != 2 || knots.Completes != 1 {
+		t.Errorf("Expected knots to help both cubs and complete Mowgli's bushcraft, got %+v", knots)
+	}
+	if len(knots.Requirements) != 2 || knots.Requirements[0].Members != 1 || knots.Requirements[1].Members != 2 {
+		t.Errorf("Expected listing a requirement twice to count once, got %+v", knots.Requirements)
+	}
+	camp := ranked[0]
+	if camp.Score != 4 || camp.Members != 2 || camp.Completes != 0 {
+		t.Errorf("Expected camp to help both cubs with two requirements, got %+v", camp)
+	}
+	if rest := ranked[2]; rest.Score != 1 || rest.Completes != 0 {
+		t.Errorf("Expected rest to help only Akela, got %+v", rest)
+	}
+
+	// Once Mowgli's camping is nearly done camping completes it.
+	c := catalogue.versions[1]
+	store.complete(mowgli, c, "1", progress.StatusSignedOff)
+	openapitest.Do(t, router, "POST", "/recommend/section/cubs/activities", body, &ranked)
+	if ranked[0].Name != "Camp" || ranked[0].Completes != 1 {
+		t.Errorf("Expected camp to complete Mowgli's camping, got %+v", ranked[0])
+	}
+}
+
+func TestRankActivitiesSkipsBadgesNotForSection(t *testing.T) {
+	store, catalogue := newTestStore()
+	retired := camping
+	retired.Retired = true
+	catalogue.add(retired)
+	router := newTestRouter(NewRecommendService(store, catalogue), testGroupID)
+
+	body := `{"activities": [{"name": "Knots", "requirements": [{"badgeKey": "oas-bushcraft-1", "requirementId": "2.1"}]}, {"name": "Camp", "requirements": [{"badgeKey": "oas-camping-1", "requirementId": "1"}]}]}`
+	var ranked []RankedActivity
+	openapitest.Do(t, router, "POST", "/recommend/section/scouts/activities", body, &ranked)
+	for _, activity := range ranked {
+		if activity.Score != 0 {
+			t.Errorf("Expected scouts not to work towards cub or retired badges, got %+v", activity)
+		}
+	}
+}
+
+func TestInvalidRecommendations(t *testing.T) {
+	store, catalogue := newTestStore()
+	router := newTestRouter(NewRecommendService(store, catalogue), testGroupID)
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   problem.Code
+	}{
+		{"within-zero", "GET", "/recommend/member/1?within=0", "", problem.CodeValidationFailed},
+		{"within-too-far", "GET", "/recommend/section/cubs?within=6", "", problem.CodeValidationFailed},
+		{"within-not-number", "GET", "/recommend/member/1?within=one", "", problem.CodeValidationFailed},
+		{"missing-member", "GET", "/recommend/member/9", "", problem.CodeNotFound},
+		{"missing-section", "GET", "/recommend/section/wolves", "", problem.CodeNotFound},
+		{"no-activities", "POST", "/recommend/section/cubs/activities", `{"activities": []}`, problem.CodeValidationFailed},
+		{"no-requirements", "POST", "/recommend/section/cubs/activities", `{"activities": [{"name": "Nothing", "requirements": []}]}`, problem.CodeValidationFailed},
+		{"missing-badge", "POST", "/recommend/section/cubs/activities", `{"activities": [{"name": "Swim", "requirements": [{"badgeKey": "oas-aquatics-1", "requirementId": "1"}]}]}`, problem.CodeValidationFailed},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp problem.Problem
+			if w := openapitest.Do(t, router, tt.method, tt.path, tt.body, &resp); resp.Code != tt.code {
+				t.Errorf("Expected %s, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRecommendationsAreScopedToGroup(t *testing.T) {
+	store, catalogue := newTestStore()
+	b := catalogue.versions[0]
+	store.complete(otherCub, b, "1", progress.StatusSignedOff)
+	store.complete(otherCub, b, "2.1", progress.StatusSignedOff)
+	service := NewRecommendService(store, catalogue)
+	router, other := newTestRouter(service, testGroupID), newTestRouter(service, otherGroupID)
+
+	if w := openapitest.Do(t, router, "GET", "/recommend/member/4", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a member of another group not to be found, got %d: %s", w.Code, w.Body.String())
+	}
+	var near []MemberNearComplete
+	openapitest.Do(t, router, "GET", "/recommend/section/cubs", "", &near)
+	if len(near) != 0 {
+		t.Errorf("Expected members of another group not to be listed, got %+v", near)
+	}
+	openapitest.Do(t, other, "GET", "/recommend/section/cubs", "", &near)
+	if len(near) != 1 || near[0].Id != otherCub {
+		t.Errorf("Expected the other group to list its own member, got %+v", near)
+	}
+
+	body := `{"activities": [{"name": "Knots", "requirements": [{"badgeKey": "oas-bushcraft-1", "requirementId": "2.2"}]}]}`
+	var ranked []RankedActivity
+	openapitest.Do(t, router, "POST", "/recommend/section/cubs/activities", body, &ranked)
+	if len(ranked) != 1 || ranked[0].Completes != 0 || ranked[0].Members != 2 {
+		t.Errorf("Expected only members of the group to be ranked for, got %+v", ranked)
+	}
+}
@@ -0,0 +1,87 @@
+package recommend
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/progress"
+)
+
+// memberColumns selects members, aliased as m, with the stamp of their
+// progress.
+const memberColumns = `
+	m.id, m.group_id, m.firstname, m.lastname, m.section,
+	(
+		SELECT COALESCE(max(e.id), 0) || '/' || count(DISTINCT c.id)
+		FROM autocrat.completions c LEFT JOIN autocrat.completion_events e ON e.completion_id = c.id
+		WHERE c.member_id = m.id
+	) AS stamp`
+
+// RecommendStorer is an interface that must be implemented by things that
+// store what recommendations are made from. Everything is scoped to a group.
+type RecommendStorer interface {
+	GetMember(ctx context.Context, groupID, memberID int64) (Member, bool, error)
+	// ListSectionMembers lists the active members of the section of the
+	// group.
+	ListSectionMembers(ctx context.Context, groupID int64, section string) ([]Member, error)
+	// ListCompletions lists the completions of the members of the group.
+	ListCompletions(ctx context.Context, groupID int64, memberIDs []int64) ([]progress.Completion, error)
+}
+
+// RecommendStore is a store for what recommendations are made from. It
+// implements the RecommendStorer interface.
+type RecommendStore struct {
+	cluster *db.Cluster
+}
+
+// NewStore creates a new store from the given cluster. Reads go to a replica
+// unless the primary is forced with db.WithPrimary.
+func NewStore(cluster *db.Cluster) RecommendStorer {
+	return RecommendStore{cluster}
+}
+
+// GetMember gets the member of the group with the given ID.
+func (s RecommendStore) GetMember(ctx context.Context, groupID, memberID int64) (member Member, found bool, err error) {
+	query := `SELECT ` + memberColumns + ` FROM autocrat.members m WHERE m.group_id = $1 AND m.id = $2;`
+	err = s.cluster.Reader(ctx).Named("recommend.get_member").QueryRowx(ctx, query, groupID, memberID).StructScan(&member)
+	if err == sql.ErrNoRows {
+		return Member{}, false, nil
+	} else if err != nil {
+		return Member{}, false, fmt.Errorf("could not get member %d: %w", memberID, err)
+	}
+	return member, true, nil
+}
+
+// ListSectionMembers lists the active members of the section of the group
+// ordered by name.
+func (s RecommendStore) ListSectionMembers(ctx context.Context, groupID int64, section string) ([]Member, error) {
+	members := []Member{}
+	query := `
+	SELECT ` + memberColumns + `
+	FROM autocrat.members m
+	WHERE m.group_id = $1 AND m.section = $2 AND m.status = 'active'
+	ORDER BY m.lastname, m.firstname, m.id;
+	`
+	if err := s.cluster.Reader(ctx).Named("recommend.list_section_members").Select(ctx, &members, query, groupID, section); err != nil {
+		return nil, fmt.Errorf("failed to list members of %s: %w", section, err)
+	}
+	return members, nil
+}
+
+// ListCompletions lists the completions of the members of the group.
+func (s RecommendStore) ListCompletions(ctx context.Context, groupID int64, memberIDs []int64) ([]progress.Completion, error) {
+	completions := []progress.Completion{}
+	query := `
+	SELECT c.*, b.key AS badge_key, b.version AS badge_version
+	FROM autocrat.completions c JOIN autocrat.badges b ON b.id = c.badge_id
+	WHERE c.group_id = $1 AND c.member_id = ANY($2)
+	ORDER BY c.member_id, b.key, c.requirement_id;
+	`
+	if err := s.cluster.Reader(ctx).Named("recommend.list_completions").Select(ctx, &completions, query, groupID, pq.Array(memberIDs)); err != nil {
+		return nil, fmt.Errorf("failed to list completions: %w", err)
+	}
+	return completions, nil
+}
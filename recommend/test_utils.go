@@ -0,0 +1,140 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/nick96/cubapi/badge"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/progress"
+)
+
+// Groups members belong to in tests.
+const (
+	testGroupID  = 1
+	otherGroupID = 2
+)
+
+// mockCatalogue is a badge catalogue in memory.
+type mockCatalogue struct {
+	versions []badge.Badge
+}
+
+// add adds a version of a badge, numbered after the badge's latest.
+func (c *mockCatalogue) add(b badge.Badge) badge.Badge {
+	for _, v := range c.versions {
+		if v.Key == b.Key && v.Version > b.Version {
+			b.Version = v.Version
+		}
+	}
+	b.Id = int64(len(c.versions) + 1)
+	b.Version++
+	c.versions = append(c.versions, b)
+	return b
+}
+
+func (c *mockCatalogue) GetVersionByID(ctx context.Context, id int64) (badge.Badge, bool, error) {
+	for _, b := range c.versions {
+		if b.Id == id {
+			return b, true, nil
+		}
+	}
+	return badge.Badge{}, false, nil
+}
+
+func (c *mockCatalogue) ListBadges(ctx context.Context, filter badge.Filter) ([]badge.Badge, error) {
+	latest := make(map[string]badge.Badge)
+	for _, b := range c.versions {
+		if b.Version > latest[b.Key].Version {
+			latest[b.Key] = b
+		}
+	}
+	badges := []badge.Badge{}
+	for _, b := range latest {
+		if (filter.Kind == "" || b.Kind == filter.Kind) &&
+			(filter.Section == "" || containsString(b.Sections, filter.Section)) &&
+			(filter.Retired || !b.Retired) {
+			badges = append(badges, b)
+		}
+	}
+	sort.Slice(badges, func(i, j int) bool { return badges[i].Key < badges[j].Key })
+	return badges, nil
+}
+
+// mockRecommendStore stores members and their completions in memory. listed
+// records the members whose completions were listed by each call to
+// ListCompletions.
+type mockRecommendStore struct {
+	members     map[int64]Member
+	completions []progress.Completion
+	events      int64
+	listed      [][]int64
+}
+
+func newMockRecommendStore() *mockRecommendStore {
+	return &mockRecommendStore{members: make(map[int64]Member)}
+}
+
+// complete records the member completing the requirement of the version of
+// the badge with the status. Like recording progress does, it adds an event
+// which changes the member's stamp.
+func (s *mockRecommendStore) complete(memberID int64, b badge.Badge, requirementID, status string) {
+	member := s.members[memberID]
+	s.completions = append(s.completions, progress.Completion{
+		Id:            int64(len(s.completions) + 1),
+		GroupId:       member.GroupId,
+		MemberId:      memberID,
+		BadgeId:       b.Id,
+		BadgeKey:      b.Key,
+		BadgeVersion:  b.Version,
+		RequirementId: requirementID,
+		Status:        status,
+	})
+	s.events++
+	member.Stamp = fmt.Sprintf("%d/%d", s.events, len(s.completions))
+	s.members[memberID] = member
+}
+
+// inGroup is a middleware that makes requests in the group, as authentication
+// does.
+func inGroup(groupID int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(group.NewContext(r.Context(), groupID)))
+		})
+	}
+}
+
+func (s *mockRecommendStore) GetMember(ctx context.Context, groupID, memberID int64) (Member, bool, error) {
+	member, ok := s.members[memberID]
+	if !ok || member.GroupId != groupID {
+		return Member{}, false, nil
+	}
+	return member, true, nil
+}
+
+func (s *mockRecommendStore) ListSectionMembers(ctx context.Context, groupID int64, section string) ([]Member, error) {
+	members := []Member{}
+	for _, member := range s.members {
+		if member.GroupId == groupID && member.Section == section {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Id < members[j].Id })
+	return members, nil
+}
+
+func (s *mockRecommendStore) ListCompletions(ctx context.Context, groupID int64, memberIDs []int64) ([]progress.Completion, error) {
+	s.listed = append(s.listed, memberIDs)
+	completions := []progress.Completion{}
+	for _, completion := range s.completions {
+		for _, id := range memberIDs {
+			if completion.GroupId == groupID && completion.MemberId == id {
+				completions = append(completions, completion)
+			}
+		}
+	}
+	return completions, nil
+}
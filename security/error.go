@@ -37,3 +37,9 @@ func (e *clientError) Error() string {
 func (e *clientError) SafeError() string {
 	return e.Message
 }
+
+// Unwrap returns the cause of the error so it can be inspected with errors.Is
+// and errors.As.
+func (e *clientError) Unwrap() error {
+	return e.Cause
+}
@@ -2,19 +2,24 @@ package security
 
 import (
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	gojwt "github.com/dgrijalva/jwt-go"
 )
 
+// groupClaim is the private claim holding the ID of the token's group.
+const groupClaim = "grp"
+
 type JWT struct {
 	claims map[string]interface{}
 }
 
 type Token struct {
 	Email string
+	// GroupID is the ID of the scout group the token was issued in. Requests
+	// made with the token only see that group's data.
+	GroupID int64
 }
 
 func (j *JWT) Subject(subject string) *JWT {
@@ -37,7 +42,7 @@ func (j *JWT) Expiration(exp time.Time) *JWT {
 	if j.claims == nil {
 		j.claims = make(map[string]interface{})
 	}
-	j.claims["exp"] = strconv.FormatInt(exp.Unix(), 10)
+	j.claims["exp"] = exp.Unix()
 	return j
 }
 
@@ -58,6 +63,15 @@ func (j *JWT) Audience(audience string) *JWT {
 	return j
 }
 
+// Group sets the ID of the scout group the token is for.
+func (j *JWT) Group(id int64) *JWT {
+	if j.claims == nil {
+		j.claims = make(map[string]interface{})
+	}
+	j.claims[groupClaim] = id
+	return j
+}
+
 func (j *JWT) SignedToken(secret string) (string, error) {
 	token := gojwt.NewWithClaims(
 		gojwt.SigningMethodHS256,
@@ -79,8 +93,24 @@ func ValidateToken(token, secret string) (Token, error) {
 		return Token{}, fmt.Errorf("token parsing failed: %w", err)
 	}
 
-	if claims, ok := parsedToken.Claims.(jwt.MapClaims); ok && parsedToken.Valid {
-		return Token{Email: claims["aud"].(string)}, nil
+	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	if !ok || !parsedToken.Valid {
+		return Token{}, fmt.Errorf("token is not valid")
+	}
+	// jwt-go only checks the expiry if it's a number, so a token without one
+	// (or with a non-numeric one) would never expire.
+	if _, ok := claims["exp"].(float64); !ok {
+		return Token{}, fmt.Errorf("token has no numeric expiry")
+	}
+	email, ok := claims["aud"].(string)
+	if !ok || email == "" {
+		return Token{}, fmt.Errorf("token has no audience")
+	}
+	// Numeric claims are decoded as floats, so anything that isn't a whole,
+	// positive number can't be a group ID.
+	group, ok := claims[groupClaim].(float64)
+	if !ok || group < 1 || group != float64(int64(group)) {
+		return Token{}, fmt.Errorf("token has no group")
 	}
-	return Token{}, fmt.Errorf("token is not valid")
+	return Token{Email: email, GroupID: int64(group)}, nil
 }
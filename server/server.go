@@ -0,0 +1,164 @@
+// Package server runs HTTP servers with timeouts, optional TLS and graceful
+// shutdown.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultReadTimeout is the default maximum duration for reading an entire
+	// request, including the body.
+	DefaultReadTimeout = 10 * time.Second
+	// DefaultReadHeaderTimeout is the default maximum duration for reading
+	// request headers. Keeping it short protects against slowloris attacks.
+	DefaultReadHeaderTimeout = 5 * time.Second
+	// DefaultWriteTimeout is the default maximum duration before timing out
+	// writes of the response.
+	DefaultWriteTimeout = 30 * time.Second
+	// DefaultIdleTimeout is the default maximum amount of time to wait for the
+	// next request on a keep-alive connection.
+	DefaultIdleTimeout = 2 * time.Minute
+	// DefaultShutdownTimeout is the default amount of time in-flight requests
+	// have to complete when the server is shut down.
+	DefaultShutdownTimeout = 20 * time.Second
+)
+
+// Config configures a server.
+type Config struct {
+	// Addr is the address the server listens on.
+	Addr string
+	// ReadTimeout is the maximum duration for reading an entire request.
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout is the maximum duration for reading request headers.
+	ReadHeaderTimeout time.Duration
+	// WriteTimeout is the maximum duration before timing out writes of the
+	// response.
+	WriteTimeout time.Duration
+	// IdleTimeout is the maximum amount of time to wait for the next request
+	// on a keep-alive connection.
+	IdleTimeout time.Duration
+	// TLSCertFile and TLSKeyFile are the PEM encoded certificate and key to
+	// serve TLS with. If they're empty the server serves plain HTTP.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSReloadInterval is how often the certificate files are checked for
+	// changes.
+	TLSReloadInterval time.Duration
+}
+
+// DefaultConfig returns the default config for a server listening on addr.
+func DefaultConfig(addr string) Config {
+	return Config{
+		Addr:              addr,
+		ReadTimeout:       DefaultReadTimeout,
+		ReadHeaderTimeout: DefaultReadHeaderTimeout,
+		WriteTimeout:      DefaultWriteTimeout,
+		IdleTimeout:       DefaultIdleTimeout,
+		TLSReloadInterval: DefaultCertReloadInterval,
+	}
+}
+
+// TLS reports whether the server is configured to serve TLS.
+func (c Config) TLS() bool {
+	return c.TLSCertFile != "" || c.TLSKeyFile != ""
+}
+
+// Server is an HTTP server that can be shut down gracefully.
+type Server struct {
+	logger   *zap.Logger
+	name     string
+	config   Config
+	server   *http.Server
+	reloader *CertReloader
+}
+
+// New creates a server called name that serves handler. The name is only
+// used to identify the server in logs. If TLS is configured the certificate
+// is loaded straight away so a bad certificate is caught before serving.
+func New(logger *zap.Logger, name string, config Config, handler http.Handler) (*Server, error) {
+	logger = logger.With(zap.String("server", name))
+	s := &Server{
+		logger: logger,
+		name:   name,
+		config: config,
+		server: &http.Server{
+			Addr:              config.Addr,
+			Handler:           handler,
+			ReadTimeout:       config.ReadTimeout,
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+			ErrorLog:          zap.NewStdLog(logger),
+		},
+	}
+	if config.TLS() {
+		if config.TLSCertFile == "" || config.TLSKeyFile == "" {
+			return nil, fmt.Errorf("both a TLS certificate and key are required for server %s", name)
+		}
+		reloader, err := NewCertReloader(logger, config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.reloader = reloader
+		s.server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		}
+	}
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.config.Addr
+}
+
+// ListenAndServe listens on the configured address and serves requests until
+// the server is shut down. See Serve.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.config.Addr, err)
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves requests on the listener until the server is shut down, in
+// which case it returns nil. If TLS is configured the certificate is reloaded
+// whenever it changes until ctx is done.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	s.logger.Info("Starting server", zap.String("addr", listener.Addr().String()), zap.Bool("tls", s.reloader != nil))
+	var err error
+	if s.reloader != nil {
+		go s.reloader.Watch(ctx, s.config.TLSReloadInterval)
+		err = s.server.Serve(tls.NewListener(listener, s.server.TLSConfig))
+	} else {
+		err = s.server.Serve(listener)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops the server accepting new connections and waits for in-flight
+// requests to complete. If ctx is done first the remaining connections are
+// closed and the context's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.Info("Shutting down server")
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.logger.Warn("Server did not shut down cleanly, closing remaining connections", zap.Error(err))
+		s.server.Close()
+		return err
+	}
+	s.logger.Info("Server shut down")
+	return nil
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultCertReloadInterval is the default interval the certificate files are
+// checked for changes.
+const DefaultCertReloadInterval = time.Minute
+
+// CertReloader keeps a TLS certificate up to date with the files it was loaded
+// from so renewed certificates are served without a restart.
+type CertReloader struct {
+	logger   *zap.Logger
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader loads the certificate and key from the given files.
+func NewCertReloader(logger *zap.Logger, certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		logger:   logger,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// latestModTime returns the latest modification time of the certificate and
+// key files.
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, fmt.Errorf("failed to stat %s: %w", file, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Reload loads the certificate and key from their files. If loading fails the
+// previous certificate is kept.
+func (r *CertReloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// reloadIfChanged reloads the certificate if either of its files have been
+// modified since it was last loaded.
+func (r *CertReloader) reloadIfChanged() {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		r.logger.Error("Failed to check TLS certificate for changes", zap.Error(err))
+		return
+	}
+	r.mu.RLock()
+	changed := modTime.After(r.modTime)
+	r.mu.RUnlock()
+	if !changed {
+		return
+	}
+	if err := r.Reload(); err != nil {
+		r.logger.Error("Failed to reload TLS certificate, continuing to serve the previous one", zap.Error(err))
+		return
+	}
+	r.logger.Info("Reloaded TLS certificate", zap.String("certFile", r.certFile))
+}
+
+// Watch checks the certificate files for changes at the given interval until
+// ctx is done.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultCertReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reloadIfChanged()
+		}
+	}
+}
+
+// GetCertificate returns the current certificate. It is used as
+// tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
@@ -0,0 +1,218 @@
+// Package session manages the cookies used to authenticate browser sessions
+// and protects cookie authenticated requests from cross-site request forgery.
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/problem"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultCookieName is the default name of the session cookie.
+	DefaultCookieName = "jwt"
+	// DefaultCSRFCookieName is the default name of the cookie holding the
+	// CSRF token. It is readable by scripts so they can echo it back.
+	DefaultCSRFCookieName = "csrf_token"
+	// DefaultCSRFHeaderName is the default header that the CSRF token must be
+	// sent in.
+	DefaultCSRFHeaderName = "X-CSRF-Token"
+	// DefaultLifetime is the default lifetime of a session.
+	DefaultLifetime = 24 * time.Hour
+)
+
+// Config configures the session cookies.
+type Config struct {
+	// CookieName is the name of the cookie holding the session token.
+	CookieName string
+	// Domain is the domain the cookies are set for. If it's empty the
+	// cookies are only sent to the host that set them.
+	Domain string
+	// Path is the path the cookies are set for.
+	Path string
+	// Secure restricts the cookies to HTTPS.
+	Secure bool
+	// SameSite is the SameSite attribute of the cookies.
+	SameSite http.SameSite
+	// Lifetime is how long the cookies last.
+	Lifetime time.Duration
+	// CSRFCookieName is the name of the cookie holding the CSRF token.
+	CSRFCookieName string
+	// CSRFHeaderName is the header the CSRF token must be sent in.
+	CSRFHeaderName string
+}
+
+// DefaultConfig returns the default configuration. It is secure by default,
+// so local development over plain HTTP needs Secure turned off.
+func DefaultConfig() Config {
+	return Config{
+		CookieName:     DefaultCookieName,
+		Path:           "/",
+		Secure:         true,
+		SameSite:       http.SameSiteLaxMode,
+		Lifetime:       DefaultLifetime,
+		CSRFCookieName: DefaultCSRFCookieName,
+		CSRFHeaderName: DefaultCSRFHeaderName,
+	}
+}
+
+// Validate checks the config is usable and won't be rejected by browsers.
+func (c Config) Validate() error {
+	if c.CookieName == "" || c.CSRFCookieName == "" || c.CSRFHeaderName == "" {
+		return fmt.Errorf("session cookie names and CSRF header name must not be empty")
+	}
+	if c.CookieName == c.CSRFCookieName {
+		return fmt.Errorf("session cookie and CSRF cookie must have different names")
+	}
+	if c.Lifetime <= 0 {
+		return fmt.Errorf("session lifetime must be positive, got %s", c.Lifetime)
+	}
+	if c.SameSite == http.SameSiteNoneMode && !c.Secure {
+		return fmt.Errorf("SameSite=None cookies must be secure")
+	}
+	return nil
+}
+
+// ParseSameSite parses a SameSite attribute value ("lax", "strict" or "none").
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("invalid SameSite value %q, expected lax, strict or none", value)
+}
+
+// Manager sets and reads session cookies.
+type Manager struct {
+	logger *zap.Logger
+	config Config
+	secret []byte
+}
+
+// NewManager creates a session manager. The secret is used to derive CSRF
+// tokens from session tokens so it must be kept private.
+func NewManager(logger *zap.Logger, config Config, secret string) *Manager {
+	return &Manager{
+		logger: logger,
+		config: config,
+		secret: []byte(secret),
+	}
+}
+
+// Config returns the manager's configuration.
+func (m *Manager) Config() Config {
+	return m.config
+}
+
+func (m *Manager) cookie(name, value string, httpOnly bool, expires time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     m.config.Path,
+		Domain:   m.config.Domain,
+		Secure:   m.config.Secure,
+		HttpOnly: httpOnly,
+		SameSite: m.config.SameSite,
+		Expires:  expires,
+	}
+	if expires.Before(time.Now()) {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// Start sets the session and CSRF cookies for the given session token. The
+// CSRF token is returned so it can also be given to clients that can't read
+// the cookie (e.g. a frontend on a different domain).
+func (m *Manager) Start(w http.ResponseWriter, token string) string {
+	expires := time.Now().Add(m.config.Lifetime)
+	csrfToken := m.CSRFToken(token)
+	http.SetCookie(w, m.cookie(m.config.CookieName, token, true, expires))
+	http.SetCookie(w, m.cookie(m.config.CSRFCookieName, csrfToken, false, expires))
+	return csrfToken
+}
+
+// End clears the session and CSRF cookies.
+func (m *Manager) End(w http.ResponseWriter) {
+	http.SetCookie(w, m.cookie(m.config.CookieName, "", true, time.Unix(0, 0)))
+	http.SetCookie(w, m.cookie(m.config.CSRFCookieName, "", false, time.Unix(0, 0)))
+}
+
+// Token returns the session token of the request. The Authorization header
+// takes precedence over the session cookie. fromCookie is true if the token
+// came from the cookie, in which case state changing requests need CSRF
+// protection.
+func (m *Manager) Token(r *http.Request) (token string, fromCookie bool) {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")), false
+	}
+	if cookie, err := r.Cookie(m.config.CookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, true
+	}
+	return "", false
+}
+
+// CSRFToken derives the CSRF token for a session token. Deriving the token
+// (rather than generating a random one) ties it to the session so a token
+// planted by an attacker for another session is useless.
+func (m *Manager) CSRFToken(sessionToken string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte("csrf:"))
+	mac.Write([]byte(sessionToken))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidCSRFToken reports whether the CSRF token is valid for the session
+// token.
+func (m *Manager) ValidCSRFToken(sessionToken, csrfToken string) bool {
+	if csrfToken == "" {
+		return false
+	}
+	return hmac.Equal([]byte(m.CSRFToken(sessionToken)), []byte(csrfToken))
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// CSRF is a middleware http handler that rejects state changing requests
+// authenticated by the session cookie unless they carry the session's CSRF
+// token in the CSRF header. Requests authenticated by the Authorization header
+// aren't vulnerable to CSRF as browsers never add it automatically.
+func (m *Manager) CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, fromCookie := m.Token(r)
+		if fromCookie && !m.ValidCSRFToken(token, r.Header.Get(m.config.CSRFHeaderName)) {
+			logging.Logger(r.Context(), m.logger).Info("Rejected request with missing or invalid CSRF token",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.EscapedPath()),
+			)
+			problem.Write(w, r, problem.New(
+				problem.CodeInvalidCSRFToken,
+				fmt.Sprintf("State changing requests authenticated by the session cookie must send its CSRF token in the %s header", m.config.CSRFHeaderName),
+			))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
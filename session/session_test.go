@@ -0,0 +1,130 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestManager() *Manager {
+	config := DefaultConfig()
+	config.Domain = "bagheera.nickspain.dev"
+	return NewManager(zap.NewNop(), config, "secret")
+}
+
+func TestStartSetsCookies(t *testing.T) {
+	sessions := newTestManager()
+	w := httptest.NewRecorder()
+	csrfToken := sessions.Start(w, "token")
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 2 {
+		t.Fatalf("Expected 2 cookies, got %d", len(cookies))
+	}
+	sessionCookie, csrfCookie := cookies[0], cookies[1]
+	if sessionCookie.Name != DefaultCookieName || sessionCookie.Value != "token" {
+		t.Fatalf("Unexpected session cookie %s", sessionCookie)
+	}
+	if !sessionCookie.HttpOnly || !sessionCookie.Secure || sessionCookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("Expected session cookie to be HttpOnly, Secure and SameSite=Lax: %s", sessionCookie)
+	}
+	if sessionCookie.Domain != "bagheera.nickspain.dev" || sessionCookie.Path != "/" {
+		t.Fatalf("Unexpected session cookie domain or path: %s", sessionCookie)
+	}
+	if csrfCookie.Name != DefaultCSRFCookieName || csrfCookie.Value != csrfToken || csrfCookie.HttpOnly {
+		t.Fatalf("Expected CSRF cookie to hold the CSRF token and be readable by scripts: %s", csrfCookie)
+	}
+}
+
+func TestEndClearsCookies(t *testing.T) {
+	w := httptest.NewRecorder()
+	newTestManager().End(w)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Value != "" || cookie.MaxAge >= 0 {
+			t.Fatalf("Expected cookie %s to be cleared", cookie.Name)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	sessions := newTestManager()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if token, _ := sessions.Token(r); token != "" {
+		t.Fatalf("Expected no token, got %s", token)
+	}
+
+	r.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: "cookie-token"})
+	if token, fromCookie := sessions.Token(r); token != "cookie-token" || !fromCookie {
+		t.Fatalf("Expected token from cookie, got %s (from cookie: %t)", token, fromCookie)
+	}
+
+	r.Header.Set("Authorization", "Bearer header-token")
+	if token, fromCookie := sessions.Token(r); token != "header-token" || fromCookie {
+		t.Fatalf("Expected token from header, got %s (from cookie: %t)", token, fromCookie)
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	sessions := newTestManager()
+	handler := sessions.CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	validToken := sessions.CSRFToken("session")
+
+	testCases := []struct {
+		name           string
+		method         string
+		cookie         string
+		authorization  string
+		csrfHeader     string
+		expectedStatus int
+	}{
+		{"safe-method", http.MethodGet, "session", "", "", http.StatusOK},
+		{"no-session", http.MethodPost, "", "", "", http.StatusOK},
+		{"bearer-token", http.MethodPost, "session", "Bearer session", "", http.StatusOK},
+		{"cookie-with-token", http.MethodPost, "session", "", validToken, http.StatusOK},
+		{"cookie-without-token", http.MethodPost, "session", "", "", http.StatusForbidden},
+		{"cookie-with-wrong-token", http.MethodDelete, "session", "", sessions.CSRFToken("other"), http.StatusForbidden},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: tt.cookie})
+			}
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.csrfHeader != "" {
+				r.Header.Set(DefaultCSRFHeaderName, tt.csrfHeader)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	config := DefaultConfig()
+	config.Secure = false
+	config.SameSite = http.SameSiteNoneMode
+	if err := config.Validate(); err == nil {
+		t.Fatal("Expected insecure SameSite=None cookie config to be invalid")
+	}
+
+	config = DefaultConfig()
+	config.Lifetime = -time.Hour
+	if err := config.Validate(); err == nil {
+		t.Fatal("Expected negative lifetime to be invalid")
+	}
+
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("Expected default config to be valid: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	// ExporterNone disables exporting spans.
+	ExporterNone = "none"
+	// ExporterStdout writes spans to stdout as JSON lines.
+	ExporterStdout = "stdout"
+	// ExporterFile writes spans to a file as JSON lines.
+	ExporterFile = "file"
+	// ExporterOTLP sends spans to an OpenTelemetry collector over OTLP/HTTP.
+	ExporterOTLP = "otlp"
+
+	// DefaultOTLPEndpoint is the traces endpoint of a collector running
+	// locally with the default OTLP/HTTP port.
+	DefaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+)
+
+// NewExporter creates an exporter by name (see the Exporter* constants). The
+// target is the file path for the file exporter and the endpoint URL for the
+// OTLP exporter. A nil exporter is returned for ExporterNone.
+func NewExporter(ctx context.Context, name, target string) (sdktrace.SpanExporter, error) {
+	switch name {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return stdouttrace.New()
+	case ExporterFile:
+		return newFileExporter(target)
+	case ExporterOTLP:
+		if target == "" {
+			target = DefaultOTLPEndpoint
+		}
+		return otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(target))
+	}
+	return nil, fmt.Errorf("unknown trace exporter %q", name)
+}
+
+// fileExporter writes spans to a file, which is closed when the exporter is
+// shut down.
+type fileExporter struct {
+	*stdouttrace.Exporter
+	file *os.File
+}
+
+// newFileExporter creates an exporter that appends to the file at the given
+// path, creating it if required.
+func newFileExporter(path string) (*fileExporter, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file exporter requires a path")
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileExporter{Exporter: exporter, file: f}, nil
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	if err := e.Exporter.Shutdown(ctx); err != nil {
+		return err
+	}
+	return e.file.Close()
+}
@@ -0,0 +1,28 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// LogFields returns zap fields identifying the trace and span in the context
+// so log lines can be correlated with traces. No fields are returned if there
+// is no span in the context.
+func LogFields(ctx context.Context) []zap.Field {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("traceID", sc.TraceID().String()),
+		zap.String("spanID", sc.SpanID().String()),
+	}
+}
+
+// Logger returns the logger with the trace and span IDs in the context added to
+// every log line.
+func Logger(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	return logger.With(LogFields(ctx)...)
+}
@@ -0,0 +1,72 @@
+// Package tracing sets up distributed tracing with the OpenTelemetry SDK. Trace
+// context is propagated with W3C `traceparent` headers and spans can be
+// exported as JSON lines or to an OpenTelemetry collector over OTLP/HTTP.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer spans are started with.
+const instrumentationName = "github.com/nick96/cubapi"
+
+func init() {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// NewProvider creates a tracer provider for the service that exports spans,
+// in batches, to the given exporter. If the exporter is nil then spans are
+// created (so trace IDs still show up in logs) but never exported.
+func NewProvider(serviceName string, exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+// SetDefault sets the tracer provider used by the package level Start
+// function and by the HTTP instrumentation.
+func SetDefault(provider trace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+}
+
+// Span is an OpenTelemetry span whose RecordError also marks the span as
+// failed.
+type Span struct {
+	trace.Span
+}
+
+// RecordError records the error on the span and marks the span as failed. Nil
+// errors are ignored so this can be called unconditionally.
+func (s Span) RecordError(err error, opts ...trace.EventOption) {
+	if err == nil {
+		return
+	}
+	s.Span.RecordError(err, opts...)
+	s.Span.SetStatus(codes.Error, err.Error())
+}
+
+// Start starts a span as a child of the span (local or remote) in the context
+// using the default tracer provider. If there is no parent a new trace is
+// started. The returned context holds the new span.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, Span) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+	return ctx, Span{span}
+}
+
+// SpanFromContext returns the span in the context. If there isn't one then
+// the returned span does nothing.
+func SpanFromContext(ctx context.Context) Span {
+	return Span{trace.SpanFromContext(ctx)}
+}
@@ -0,0 +1,182 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useProvider sets the default tracer provider to one exporting to an
+// in-memory exporter for the duration of the test.
+func useProvider(t *testing.T) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewProvider("test", exporter)
+	previous := otel.GetTracerProvider()
+	SetDefault(provider)
+	t.Cleanup(func() {
+		SetDefault(previous)
+		provider.Shutdown(context.Background())
+	})
+	return provider, exporter
+}
+
+func TestSpansContinueRemoteTrace(t *testing.T) {
+	provider, exporter := useProvider(t)
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+
+	ctx, parent := Start(ctx, "parent", trace.WithSpanKind(trace.SpanKindServer))
+	_, child := Start(ctx, "child")
+	child.RecordError(errors.New("failed"))
+	child.End()
+	parent.RecordError(nil)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 0 {
+		t.Fatalf("Expected spans to be batched, got %d exported", len(spans))
+	}
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	spans = exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans to be exported, got %d", len(spans))
+	}
+	childData, parentData := spans[0], spans[1]
+	if parentData.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || childData.SpanContext.TraceID() != parentData.SpanContext.TraceID() {
+		t.Fatalf("Expected spans to continue the remote trace, got %s and %s", parentData.SpanContext.TraceID(), childData.SpanContext.TraceID())
+	}
+	if parentData.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected parent span to be a child of the remote span, got %s", parentData.Parent.SpanID())
+	}
+	if childData.Parent.SpanID() != parentData.SpanContext.SpanID() {
+		t.Errorf("Expected child span to be a child of the parent span")
+	}
+	if childData.Status.Code != codes.Error || childData.Status.Description != "failed" || len(childData.Events) != 1 {
+		t.Errorf("Expected child span to have recorded its error, got %+v", childData.Status)
+	}
+	if parentData.Status.Code != codes.Unset || len(parentData.Events) != 0 {
+		t.Errorf("Expected a nil error to be ignored, got %+v", parentData.Status)
+	}
+
+	out := http.Header{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(out))
+	expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + parentData.SpanContext.SpanID().String() + "-01"
+	if out.Get("traceparent") != expected {
+		t.Errorf("Expected injected traceparent to identify the parent span, got %s", out.Get("traceparent"))
+	}
+}
+
+func TestUnsampledRemoteTraceNotExported(t *testing.T) {
+	provider, exporter := useProvider(t)
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+	_, span := Start(ctx, "span")
+	span.End()
+	SpanFromContext(ctx).RecordError(errors.New("remote spans can't record errors"))
+
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Fatalf("Expected unsampled span not to be exported, got %d spans", len(spans))
+	}
+}
+
+func TestNoExporterStillHasTraceIDs(t *testing.T) {
+	provider := NewProvider("test", nil)
+	defer provider.Shutdown(context.Background())
+	ctx, span := provider.Tracer(instrumentationName).Start(context.Background(), "span")
+	defer span.End()
+	if !span.SpanContext().IsValid() {
+		t.Fatal("Expected span to have a valid span context")
+	}
+	if fields := LogFields(ctx); len(fields) != 2 {
+		t.Fatalf("Expected trace and span ID log fields, got %v", fields)
+	}
+	if fields := LogFields(context.Background()); len(fields) != 0 {
+		t.Fatalf("Expected no log fields without a span, got %v", fields)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exporter, err := NewExporter(context.Background(), ExporterFile, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := NewProvider("test", exporter)
+	_, span := provider.Tracer(instrumentationName).Start(context.Background(), "span")
+	span.End()
+	// Shutting down exports the remaining spans before closing the file.
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Name":"span"`) || !strings.Contains(string(data), span.SpanContext().TraceID().String()) {
+		t.Fatalf("Expected the span to be written to the file, got %s", data)
+	}
+
+	if _, err := NewExporter(context.Background(), ExporterFile, ""); err == nil {
+		t.Error("Expected the file exporter to require a path")
+	}
+	if _, err := NewExporter(context.Background(), "jaeger", ""); err == nil {
+		t.Error("Expected an unknown exporter to be rejected")
+	}
+	if exporter, err := NewExporter(context.Background(), ExporterNone, ""); exporter != nil || err != nil {
+		t.Errorf("Expected no exporter, got %v: %v", exporter, err)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		path        string
+		contentType string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer server.Close()
+
+	exporter, err := NewExporter(context.Background(), ExporterOTLP, server.URL+"/v1/traces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := NewProvider("test", exporter)
+	_, span := provider.Tracer(instrumentationName).Start(context.Background(), "span")
+	span.End()
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if path != "/v1/traces" || contentType != "application/x-protobuf" {
+		t.Fatalf("Expected spans to be sent to the collector, got %q (%s)", path, contentType)
+	}
+}
@@ -2,87 +2,26 @@ package user
 
 import (
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strings"
-	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
-	"github.com/nick96/cubapi/security"
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/session"
 	"go.uber.org/zap"
 	"gopkg.in/go-playground/validator.v9"
 )
 
-type ErrorResponse struct {
-	Status  int      `json:"-"`
-	Message string   `json:"message"`
-	Error   string   `json:"error,omitempty"`
-	Errors  []string `json:"errors,omitempty"`
-}
-
-func (e *ErrorResponse) Render(w http.ResponseWriter, r *http.Request) error {
-	render.Status(r, e.Status)
-	return nil
-}
-
-func FieldError(fe validator.FieldError) error {
-	// TODO: Make this more informative
-	var sb strings.Builder
-	fmt.Fprintf(&sb, "'%s' is not valid a valid value for '%s'", fe.Value(), fe.Field())
-	return fmt.Errorf(sb.String())
-}
-
-func ErrMalformedRequest(message string, err error) render.Renderer {
-	return &ErrorResponse{
-		Message: message,
-		Status:  http.StatusBadRequest,
-		Error:   err.Error(),
-	}
-}
-
-func ErrInvalidRequest(message string, errs []error) render.Renderer {
-	var errors []string
-	for _, err := range errs {
-		errors = append(errors, err.Error())
-	}
-
-	return &ErrorResponse{
-		Message: message,
-		Status:  http.StatusBadRequest,
-		Errors:  errors,
-	}
-}
-
-func ErrInternal(err error) render.Renderer {
-	return ErrInternalWithMessage("Internal error", err)
-}
-
-func ErrInternalWithMessage(message string, err error) render.Renderer {
-	return &ErrorResponse{
-		Message: message,
-		Status:  http.StatusInternalServerError,
-	}
-}
-
-func ErrForbidden(message string, err security.ClientError) render.Renderer {
-	var safeError string
-	if err != nil {
-		safeError = err.SafeError()
-	}
-	return &ErrorResponse{
-		Message: message,
-		Status:  http.StatusForbidden,
-		Error:   safeError,
-	}
-}
-
 // AuthResponse is a response to a successful authentication request. It
 // contains the `token` field which is the JWT token used on other endpoints
-// that require authentication.
+// that require authentication, and the `csrfToken` field which must be sent in
+// the CSRF header of state changing requests authenticated by the session
+// cookie.
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token     string `json:"token"`
+	CSRFToken string `json:"csrfToken"`
 }
 
 func (e *AuthResponse) Render(w http.ResponseWriter, r *http.Request) error {
@@ -93,17 +32,23 @@ func (e *AuthResponse) Render(w http.ResponseWriter, r *http.Request) error {
 // NewAuthRouter creates a router for the authentication endpoints.
 //
 // POST /: Authenticate a user using email and password, and return
-//     a JWT if correct.
-func NewAuthRouter(logger *zap.Logger, store UserStorer) func(chi.Router) {
-	validate := validator.New()
-	authService := AuthService{store}
+//     a JWT if correct. The JWT is also set as the session cookie.
+// DELETE /: Sign out by clearing the session cookie.
+//
+// Sign in attempts are passed through signInLimiter so credentials can't be
+// brute forced.
+func NewAuthRouter(logger *zap.Logger, authService AuthService, sessions *session.Manager, signInLimiter func(http.Handler) http.Handler) func(chi.Router) {
+	validate := NewValidator()
 	return func(r chi.Router) {
-		r.Post("/", signIn(logger, validate, authService))
+		r.With(signInLimiter).Post("/", signIn(logger, validate, authService, sessions))
+		r.With(sessions.CSRF).Delete("/", signOut(logger, sessions))
 	}
 }
 
+// NewValidator creates a validator for requests. Fields are named by their
+// JSON name in validation errors.
 func NewValidator() *validator.Validate {
-	return validator.New()
+	return problem.NewValidator()
 }
 
 type AuthnRequest struct {
@@ -111,27 +56,13 @@ type AuthnRequest struct {
 	Password string `json:"password" validate:"min=6,required"`
 }
 
-func writeError(status int, resp ErrorResponse, w http.ResponseWriter) error {
-	body, err := json.Marshal(resp)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return err
-	}
-	_, err = w.Write(body)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return err
-	}
-	w.WriteHeader(status)
-	return nil
-}
-
-func signIn(logger *zap.Logger, validate *validator.Validate, service AuthService) http.HandlerFunc {
+func signIn(logger *zap.Logger, validate *validator.Validate, service AuthService, sessions *session.Manager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.Logger(r.Context(), logger)
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
 			logger.Info("Failed to read request body", zap.Error(err))
-			render.Render(w, r, ErrInternal(err))
+			problem.Write(w, r, problem.Internal(err))
 			return
 		}
 		defer r.Body.Close()
@@ -140,68 +71,55 @@ func signIn(logger *zap.Logger, validate *validator.Validate, service AuthServic
 		err = json.Unmarshal(body, &request)
 		if err != nil {
 			logger.Info("Failed to unmarshal request", zap.Error(err), zap.ByteString("body", body))
-			resp := ErrMalformedRequest("Request body is invalid JSON", err)
-			render.Render(w, r, resp)
+			problem.Write(w, r, problem.Validation("Request body is invalid JSON", err))
 			return
 		}
 
 		err = validate.Struct(request)
 		if err != nil {
-			logger.Info("Received invalid request body", zap.Error(err), zap.Any("body", request))
-			var errs []error
-			for _, err := range err.(validator.ValidationErrors) {
-				errs = append(errs, FieldError(err))
-			}
-			resp := ErrInvalidRequest("Sign in request is not valid", errs)
-			render.Render(w, r, resp)
+			logger.Info("Received invalid request body", zap.Error(err), zap.String("email", request.Email))
+			problem.Write(w, r, problem.Validation("Sign in request is not valid", err))
 			return
 		}
 		logger.Info("Received sign in request", zap.String("email", request.Email))
 
-		user, authErr := service.AuthenticateUser(request.Email, request.Password)
+		user, authErr := service.AuthenticateUser(r.Context(), request.Email, request.Password)
 		if authErr != nil {
 			logger.Info("Authentication failed", zap.String("email", request.Email), zap.Error(authErr))
-			resp := ErrForbidden(
-				fmt.Sprintf("Could not authenticate user %s", request.Email),
-				authErr,
-			)
-			render.Render(w, r, resp)
+			signIns.WithLabelValues("failed").Inc()
+			problem.Write(w, r, problem.FromError(problem.CodeAuthenticationFailed, authErr))
 			return
 		}
 
 		logger.Info("Successfully authenticated user",
 			zap.String("email", user.Email),
 		)
+		signIns.WithLabelValues("succeeded").Inc()
+		logging.AddFields(r.Context(), zap.Int64("userID", user.Id))
 
-		token, tokenErr := service.GetToken(user)
-		if err != nil {
-			logger.Info("Failed to get auth token for user",
+		token, tokenErr := service.GetToken(r.Context(), user)
+		if tokenErr != nil {
+			logger.Error("Failed to get auth token for user",
 				zap.String("email", user.Email), zap.Error(tokenErr),
 			)
-			resp := ErrInternalWithMessage(
-				"Could not get authentication token for user",
-				fmt.Errorf("%s", tokenErr.SafeError()),
-			)
-			render.Render(w, r, resp)
+			problem.Write(w, r, problem.FromError(problem.CodeInternal, tokenErr))
 			return
 		}
 
 		logger.Info("Successfully retrieved auth token for user", zap.String("email", user.Email))
-		// Set the cookie header for use in web app
-		cookie := &http.Cookie{
-			Name:     "jwt",
-			Value:    token,
-			HttpOnly: true,
-			Path:     "/",
-			SameSite: http.SameSiteNoneMode,
-			Expires:  time.Now().Add(time.Hour * 24),
-			Secure:   false, // TODO: Set this to secure for prod
-			Domain:   "localhost.com",
-		}
-		http.SetCookie(w, cookie)
-		logger.Debug("Set cookie", zap.String("cookie", cookie.String()))
+		// Set the session cookie for use in web app
+		csrfToken := sessions.Start(w, token)
+		logger.Debug("Started session", zap.String("email", user.Email))
 
-		resp := &AuthResponse{Token: token}
+		resp := &AuthResponse{Token: token, CSRFToken: csrfToken}
 		render.Render(w, r, resp)
 	}
 }
+
+func signOut(logger *zap.Logger, sessions *session.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessions.End(w)
+		logger.Debug("Ended session")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
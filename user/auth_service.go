@@ -1,11 +1,13 @@
 package user
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/nick96/cubapi/security"
+	"github.com/nick96/cubapi/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -13,8 +15,32 @@ const (
 	passwordHashCost = bcrypt.DefaultCost
 )
 
+// DefaultTokenLifetime is how long tokens are valid for if AuthConfig doesn't
+// say otherwise.
+const DefaultTokenLifetime = 24 * time.Hour
+
+// AuthConfig configures how tokens are issued and validated.
+type AuthConfig struct {
+	// JWTSecret is the secret tokens are signed with.
+	JWTSecret string
+	// JWTIssuer is the issuer claim of issued tokens.
+	JWTIssuer string
+	// TokenLifetime is how long issued tokens are valid for.
+	TokenLifetime time.Duration
+}
+
 type AuthService struct {
-	store UserStorer
+	store  UserStorer
+	config AuthConfig
+}
+
+// NewAuthService creates an AuthService that looks up users in the store and
+// issues tokens as configured.
+func NewAuthService(store UserStorer, config AuthConfig) AuthService {
+	if config.TokenLifetime <= 0 {
+		config.TokenLifetime = DefaultTokenLifetime
+	}
+	return AuthService{store: store, config: config}
 }
 
 func ErrUserNotFound(message string, err error) security.ClientError {
@@ -24,25 +50,33 @@ func ErrUserNotFound(message string, err error) security.ClientError {
 // AuthenticateUser authenticates the user by the given email and password. If
 // all is well, the User entity is returned. Otherwise an error is returned.
 // This error is safe to return to the client.
-func (s AuthService) AuthenticateUser(email, password string) (User, security.ClientError) {
-	user, found, err := s.store.FindByEmail(email)
+func (s AuthService) AuthenticateUser(ctx context.Context, email, password string) (User, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "AuthService.AuthenticateUser")
+	defer span.End()
+
+	user, found, err := s.store.FindByEmail(ctx, email)
 	if err != nil {
+		span.RecordError(err)
 		return User{}, security.NewClientError(
 			"failed to retrieve user by email",
 			fmt.Errorf("failed to retrieve user by email: %w", err),
 		)
 	} else if !found {
+		span.SetAttributes(attribute.String("auth.result", "user_not_found"))
 		return User{}, ErrUserNotFound(
 			"username or password is incorrect",
 			fmt.Errorf("could not find user with email '%s'", email),
 		)
 	}
 
+	_, bcryptSpan := tracing.Start(ctx, "bcrypt.CompareHashAndPassword")
 	err = bcrypt.CompareHashAndPassword(
 		[]byte(user.Password),
 		[]byte(password),
 	)
+	bcryptSpan.End()
 	if err != nil {
+		span.SetAttributes(attribute.String("auth.result", "incorrect_password"))
 		// Specifically return an empty user here to prevent the real user being
 		// used if the error is not checked for some reason.
 		return User{}, security.NewClientError(
@@ -51,19 +85,40 @@ func (s AuthService) AuthenticateUser(email, password string) (User, security.Cl
 		)
 	}
 
+	// Only reveal the account is disabled to someone who knows the password.
+	if user.Disabled {
+		span.SetAttributes(attribute.String("auth.result", "disabled"))
+		return User{}, security.NewClientError(
+			"account is disabled",
+			fmt.Errorf("user with email '%s' is disabled", email),
+		)
+	}
+
+	span.SetAttributes(attribute.String("auth.result", "authenticated"))
 	return user, nil
 }
 
-// GetToken gets a new JWT token for a given user. The token expires in 24 hours.
-func (s AuthService) GetToken(user User) (string, security.ClientError) {
+// GetToken gets a new JWT token for a given user. The token expires after the
+// configured token lifetime.
+func (s AuthService) GetToken(ctx context.Context, user User) (string, security.ClientError) {
+	_, span := tracing.Start(ctx, "AuthService.GetToken")
+	defer span.End()
+
 	var jwt security.JWT
 	token, err := jwt.Subject(user.Email).
-		Issuer(os.Getenv("JWT_ISSUER")).
+		Issuer(s.config.JWTIssuer).
 		Audience(user.Email).
-		ExpireIn(24 * time.Hour).
-		SignedToken(os.Getenv("JWT_SECRET"))
+		Group(user.GroupId).
+		ExpireIn(s.config.TokenLifetime).
+		SignedToken(s.config.JWTSecret)
 	if err != nil {
+		span.RecordError(err)
 		return "", security.NewClientError("Failed to create authentication token", err)
 	}
 	return token, nil
 }
+
+// ValidateToken validates a JWT issued by GetToken and returns its claims.
+func (s AuthService) ValidateToken(token string) (security.Token, error) {
+	return security.ValidateToken(token, s.config.JWTSecret)
+}
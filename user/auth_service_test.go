@@ -1,8 +1,10 @@
 package user
 
 import (
+	"context"
 	"flag"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -34,8 +36,9 @@ func TestAuthenticateUser(t *testing.T) {
 		FirstName: "firstName",
 		LastName:  "lastName",
 		Password:  string(hashPassword),
+		GroupId:   testGroupID,
 	}
-	id, err := store.AddUser(user)
+	id, err := store.AddUser(context.Background(), user)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -80,7 +83,7 @@ func TestAuthenticateUser(t *testing.T) {
 
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
-			retUser, err := authService.AuthenticateUser(tt.email, tt.password)
+			retUser, err := authService.AuthenticateUser(context.Background(), tt.email, tt.password)
 			if tt.expectedErrMsg != "" {
 				if tt.expectedErrMsg != err.SafeError() {
 					t.Errorf("Expected error message %s, got %s: %v", tt.expectedErrMsg, err.SafeError(), err)
@@ -89,7 +92,7 @@ func TestAuthenticateUser(t *testing.T) {
 				t.Fatalf("Expected no error but got: %v", err)
 			}
 
-			if tt.expectedUser != retUser {
+			if !reflect.DeepEqual(tt.expectedUser, retUser) {
 				t.Errorf("Expected user %v, got %v", tt.expectedUser, retUser)
 			}
 		})
@@ -98,12 +101,6 @@ func TestAuthenticateUser(t *testing.T) {
 }
 
 func TestGetToken(t *testing.T) {
-	oldJwtSecret := os.Getenv("JWT_SECRET")
-	os.Setenv("JWT_SECRET", "secret")
-	defer func() {
-		os.Setenv("JWT_SECRET", oldJwtSecret)
-	}()
-
 	user := User{
 		Email:     "test@test.com",
 		FirstName: "test",
@@ -111,7 +108,7 @@ func TestGetToken(t *testing.T) {
 		Password:  "testpassword",
 	}
 
-	token, err := authService.GetToken(user)
+	token, err := authService.GetToken(context.Background(), user)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2,6 +2,7 @@ package user
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -24,8 +25,8 @@ func TestSignInNotExistantUser(t *testing.T) {
 
 	logger := zap.NewNop()
 	store := newMockUserStore()
-	service := AuthService{store}
-	handler := signIn(logger, NewValidator(), service)
+	service := NewAuthService(store, testAuthConfig)
+	handler := signIn(logger, NewValidator(), service, newTestSessions())
 
 	handler(w, req)
 
@@ -45,8 +46,8 @@ func TestSignInExistingUser(t *testing.T) {
 	w := httptest.NewRecorder()
 	logger := zap.NewNop()
 	store := newMockUserStore()
-	service := AuthService{store}
-	handler := signIn(logger, NewValidator(), service)
+	service := NewAuthService(store, testAuthConfig)
+	handler := signIn(logger, NewValidator(), service, newTestSessions())
 
 	hashedPw, _ := bcrypt.GenerateFromPassword([]byte("password"), security.PasswordCost)
 
@@ -55,8 +56,9 @@ func TestSignInExistingUser(t *testing.T) {
 		FirstName: "Bobby",
 		LastName:  "Tables",
 		Password:  string(hashedPw),
+		GroupId:   testGroupID,
 	}
-	store.AddUser(usr)
+	store.AddUser(context.Background(), usr)
 	handler(w, req)
 
 	resp := w.Result()
@@ -73,3 +75,34 @@ func TestSignInExistingUser(t *testing.T) {
 		t.Fatal("Expected token to not be an empty string")
 	}
 }
+
+func TestSessionCookieAuthenticatesUser(t *testing.T) {
+	logger := zap.NewNop()
+	store := newMockUserStore()
+	sessions := newTestSessions()
+	hashedPw, _ := bcrypt.GenerateFromPassword([]byte("password"), security.PasswordCost)
+	store.AddUser(context.Background(), User{
+		Email:     "test@test.com",
+		FirstName: "Bobby",
+		LastName:  "Tables",
+		Password:  string(hashedPw),
+		GroupId:   testGroupID,
+	})
+
+	content, _ := json.Marshal(AuthnRequest{Email: "test@test.com", Password: "password"})
+	w := httptest.NewRecorder()
+	signIn(logger, NewValidator(), NewAuthService(store, testAuthConfig), sessions)(w, httptest.NewRequest("POST", "/auth", bytes.NewReader(content)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	r := httptest.NewRequest("GET", "/user/me", nil)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	getAuthdUser(logger, NewUserService(store, mockGroupFinder{}), NewAuthService(store, testAuthConfig), sessions)(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected session cookie to authenticate the user, got status code %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,17 @@
+package user
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	signIns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "autocrat_sign_ins_total",
+		Help: "Number of sign in attempts, by result (succeeded or failed).",
+	}, []string{"result"})
+	usersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "autocrat_users_created_total",
+		Help: "Number of users created.",
+	})
+)
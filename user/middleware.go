@@ -0,0 +1,109 @@
+package user
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/logging"
+	"github.com/nick96/cubapi/problem"
+	"github.com/nick96/cubapi/security"
+	"github.com/nick96/cubapi/session"
+	"go.uber.org/zap"
+)
+
+// Authenticated is the OpenAPI security requirement of operations behind
+// Authenticate. The schemes are added by DescribeSecuritySchemes.
+var Authenticated = []map[string][]string{
+	{"bearer": {}},
+	{"session": {}},
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of the context holding the authenticated user.
+func NewContext(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// FromContext returns the authenticated user in the context, if there is one.
+func FromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(contextKey{}).(User)
+	return user, ok
+}
+
+// Authenticate is a middleware http handler that rejects requests without a
+// valid token for an enabled user. The user is available to later handlers
+// from FromContext and their group from group.IDFromContext.
+func Authenticate(logger *zap.Logger, service UserService, authService AuthService, sessions *session.Manager) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, p := authenticate(logging.Logger(r.Context(), logger), r, service, authService, sessions)
+			if p != nil {
+				problem.Write(w, r, p)
+				return
+			}
+			ctx := group.NewContext(NewContext(r.Context(), user), user.GroupId)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireRole is a middleware http handler that only allows users with at
+// least one of the roles. It must come after Authenticate.
+func RequireRole(roles ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := FromContext(r.Context())
+			if ok {
+				for _, role := range roles {
+					if user.HasRole(role) {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			problem.Write(w, r, problem.New(
+				problem.CodeForbidden,
+				"Requires one of the roles "+strings.Join(roles, ", "),
+			))
+		})
+	}
+}
+
+// authenticate finds the user the request's token was issued to. The user is
+// looked up in the token's group so a token can't be used in another group. A
+// problem is returned if there is no token, it isn't valid or the user is
+// disabled.
+func authenticate(logger *zap.Logger, r *http.Request, service UserService, authService AuthService, sessions *session.Manager) (User, *problem.Problem) {
+	jwt, fromCookie := sessions.Token(r)
+	logger.Debug("Retrieved JWT", zap.Bool("fromCookie", fromCookie))
+
+	if jwt == "" {
+		logger.Info("No JWT was provided")
+		return User{}, problem.New(problem.CodeAuthenticationFailed, "'jwt' cookie or Authorization header with bearer token is required")
+	}
+
+	token, err := authService.ValidateToken(jwt)
+	if err != nil {
+		logger.Info("JWT validation failed", zap.Error(err), zap.String("invalidJWT", jwt))
+		return User{}, problem.FromError(problem.CodeAuthenticationFailed, security.NewClientError("JWT validation failed", err))
+	}
+
+	user, isFound, err := service.store.GetUser(r.Context(), token.GroupID, token.Email)
+	if err != nil {
+		logger.Error("Failed to retrieve user from database", zap.String("email", token.Email), zap.Error(err))
+		return User{}, problem.Internal(err)
+	}
+	if !isFound {
+		logger.Info("Could not find user", zap.String("email", token.Email), zap.Int64("groupID", token.GroupID))
+		return User{}, problem.New(problem.CodeAuthenticationFailed, "Token is for a user that doesn't exist")
+	}
+	if user.Disabled {
+		logger.Info("Disabled user tried to use their token", zap.String("email", token.Email))
+		return User{}, problem.New(problem.CodeAuthenticationFailed, "Account is disabled")
+	}
+	logging.AddFields(r.Context(), zap.Int64("userID", user.Id), zap.Int64("groupID", user.GroupId))
+	return user, nil
+}
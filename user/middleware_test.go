@@ -0,0 +1,57 @@
+package user
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestAuthenticateAndRequireRole(t *testing.T) {
+	store := newMockUserStore()
+	store.AddUser(context.Background(), User{Email: "leader@test.com", Roles: []string{RoleLeader}, GroupId: testGroupID})
+	store.AddUser(context.Background(), User{Email: "parent@test.com", GroupId: testGroupID})
+	store.AddUser(context.Background(), User{Email: "gone@test.com", Roles: []string{RoleLeader}, Disabled: true, GroupId: testGroupID})
+	authService := NewAuthService(store, testAuthConfig)
+
+	var authenticated User
+	handler := Authenticate(zap.NewNop(), NewUserService(store, mockGroupFinder{}), authService, newTestSessions())(
+		RequireRole(RoleAdmin, RoleLeader)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authenticated, _ = FromContext(r.Context())
+		})),
+	)
+
+	testCases := []struct {
+		email  string
+		status int
+	}{
+		{"", http.StatusForbidden},
+		{"leader@test.com", http.StatusOK},
+		{"parent@test.com", http.StatusForbidden},
+		{"gone@test.com", http.StatusForbidden},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.email, func(t *testing.T) {
+			authenticated = User{}
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.email != "" {
+				user, _, _ := store.FindByEmail(context.Background(), tt.email)
+				token, err := authService.GetToken(context.Background(), user)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status == http.StatusOK && authenticated.Email != tt.email {
+				t.Errorf("Expected %s to be in the context, got %+v", tt.email, authenticated)
+			}
+		})
+	}
+}
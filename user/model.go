@@ -1,10 +1,40 @@
 package user
 
+import "github.com/lib/pq"
+
+const (
+	// RoleAdmin is the role of users that can administer the service.
+	RoleAdmin = "admin"
+	// RoleLeader is the role of users that lead a section.
+	RoleLeader = "leader"
+	// RoleProgram is the role of users that maintain the badge catalogue
+	// shared by every group.
+	RoleProgram = "program"
+)
+
+// Roles are the roles that can be granted to users.
+var Roles = []string{RoleAdmin, RoleLeader, RoleProgram}
+
 // User is a representation of a user entity.
 type User struct {
-	Id        int64  `json:"id,omitempty" db:"id"`
-	Email     string `json:"email" db:"email"`
-	FirstName string `json:"firstName" db:"firstname"`
-	LastName  string `json:"lastName" db:"lastname"`
-	Password  string `json:"-" db:"password"`
+	Id        int64          `json:"id,omitempty" db:"id"`
+	Email     string         `json:"email" db:"email"`
+	FirstName string         `json:"firstName" db:"firstname"`
+	LastName  string         `json:"lastName" db:"lastname"`
+	Password  string         `json:"-" db:"password"`
+	Roles     pq.StringArray `json:"roles" db:"roles"`
+	Disabled  bool           `json:"disabled" db:"disabled"`
+	// GroupId is the ID of the scout group the user belongs to. Users only
+	// ever see the data of their own group.
+	GroupId int64 `json:"groupId" db:"group_id"`
+}
+
+// HasRole reports whether the user has been granted the role.
+func (u User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
 }
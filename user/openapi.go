@@ -0,0 +1,82 @@
+package user
+
+import (
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/session"
+)
+
+// DescribeSecuritySchemes adds the ways users can authenticate to the
+// document: the token returned by sign in, either as a bearer token or in the
+// session cookie.
+func DescribeSecuritySchemes(doc *openapi.Document) {
+	doc.SecurityScheme("bearer", &openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "The token returned by signing in.",
+	})
+	doc.SecurityScheme("session", &openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "cookie",
+		Name:        session.DefaultCookieName,
+		Description: "The session cookie set by signing in. State changing requests must also send the CSRF token in the " + session.DefaultCSRFHeaderName + " header.",
+	})
+}
+
+// DescribeUserRouter describes the operations of NewUserRouter.
+func DescribeUserRouter(r *openapi.Router) {
+	r.Post("/", &openapi.Operation{
+		OperationID: "createUser",
+		Summary:     "Create a user",
+		Tags:        []string{"user"},
+		RequestBody: r.JSONBody(UserRequest{}),
+		Responses: map[string]*openapi.Response{
+			"201": r.JSON("The created user.", UserResponse{}),
+			"400": r.Problem("The request body is invalid, the group doesn't exist, or a user with the email already exists in any group."),
+			"403": r.Problem("The group doesn't allow signing up, or the request was authenticated by the session cookie without a valid CSRF token."),
+			"429": r.Problem("Too many users have been created by the client."),
+			"500": r.Problem("The user couldn't be created."),
+		},
+	})
+	r.Get("/me", &openapi.Operation{
+		OperationID: "getAuthenticatedUser",
+		Summary:     "Get the authenticated user",
+		Tags:        []string{"user"},
+		Security:    Authenticated,
+		Responses: map[string]*openapi.Response{
+			"200": r.JSON("The authenticated user.", UserResponse{}),
+			"403": r.Problem("The request isn't authenticated, the token is invalid or for another group, or the user is disabled."),
+			"429": r.Problem("The client has made too many requests."),
+			"500": r.Problem("The user couldn't be retrieved."),
+		},
+	})
+}
+
+// DescribeAuthRouter describes the operations of NewAuthRouter.
+func DescribeAuthRouter(r *openapi.Router) {
+	r.Post("/", &openapi.Operation{
+		OperationID: "signIn",
+		Summary:     "Sign in",
+		Description: "Authenticates a user by their email and password. The token is returned and set as the session cookie.",
+		Tags:        []string{"auth"},
+		RequestBody: r.JSONBody(AuthnRequest{}),
+		Responses: map[string]*openapi.Response{
+			"200": r.JSON("The user's token and the CSRF token of their session.", AuthResponse{}),
+			"400": r.Problem("The request body is invalid."),
+			"403": r.Problem("The email or password is wrong, or the user is disabled."),
+			"429": r.Problem("The client has made too many sign in attempts."),
+			"500": r.Problem("The user couldn't be signed in."),
+		},
+	})
+	r.Delete("/", &openapi.Operation{
+		OperationID: "signOut",
+		Summary:     "Sign out",
+		Description: "Clears the session cookie.",
+		Tags:        []string{"auth"},
+		Responses: map[string]*openapi.Response{
+			"204": openapi.Empty("The session has ended."),
+			"403": r.Problem("The request was authenticated by the session cookie without a valid CSRF token."),
+			"429": r.Problem("The client has made too many requests."),
+		},
+	})
+}
@@ -0,0 +1,75 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/nick96/cubapi/openapi"
+	"github.com/nick96/cubapi/openapi/openapitest"
+	"github.com/nick96/cubapi/session"
+	"go.uber.org/zap"
+)
+
+// TestOpenAPIContract checks that the handlers behave as the OpenAPI document
+// says they do. If this fails either the handlers or DescribeUserRouter and
+// DescribeAuthRouter need updating.
+func TestOpenAPIContract(t *testing.T) {
+	logger := zap.NewNop()
+	store := newMockUserStore()
+	userService := NewUserService(store, mockGroupFinder{})
+	authService := NewAuthService(store, testAuthConfig)
+	sessions := newTestSessions()
+
+	router := chi.NewRouter()
+	router.Route("/user", NewUserRouter(logger, userService, authService, sessions, noLimit))
+	router.Route("/auth", NewAuthRouter(logger, authService, sessions, noLimit))
+
+	doc := openapi.New("autocrat", "test")
+	DescribeSecuritySchemes(doc)
+	doc.Route("/user", DescribeUserRouter)
+	doc.Route("/auth", DescribeAuthRouter)
+
+	if err := doc.CheckRoutes(router); err != nil {
+		t.Fatal(err)
+	}
+
+	existing, err := userService.NewUser(context.Background(), User{Email: "existing@test.com", FirstName: "Bobby", LastName: "Tables", Password: "password", GroupId: testGroupID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := authService.GetToken(context.Background(), existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openapitest.Run(t, doc, router, []openapitest.Case{
+		{Name: "create-user", Method: "POST", Pattern: "/user", Body: `{"email":"new@test.com","firstName":"New","lastName":"User","password":"password","group":"1st-test"}`, Status: http.StatusCreated},
+		{Name: "create-user-unknown-group", Method: "POST", Pattern: "/user", Body: `{"email":"other@test.com","firstName":"New","lastName":"User","password":"password","group":"no-such-group"}`, Status: http.StatusBadRequest},
+		{Name: "create-user-closed-group", Method: "POST", Pattern: "/user", Body: `{"email":"closed@test.com","firstName":"New","lastName":"User","password":"password","group":"3rd-test"}`, Status: http.StatusForbidden},
+		{Name: "create-user-invalid", Method: "POST", Pattern: "/user", Body: `{"email":"new@test.com","lastName":"User","password":"pass"}`, Invalid: true, Status: http.StatusBadRequest},
+		{Name: "create-user-exists", Method: "POST", Pattern: "/user", Body: `{"email":"existing@test.com","firstName":"Bobby","lastName":"Tables","password":"password","group":"2nd-test"}`, Status: http.StatusBadRequest},
+		{Name: "create-user-without-csrf", Method: "POST", Pattern: "/user", Body: `{"email":"csrf@test.com","firstName":"New","lastName":"User","password":"password","group":"1st-test"}`, Header: cookie(token), Status: http.StatusForbidden},
+		{Name: "me", Method: "GET", Pattern: "/user/me", Header: bearer(token), Status: http.StatusOK},
+		{Name: "me-unauthenticated", Method: "GET", Pattern: "/user/me", Status: http.StatusForbidden},
+		{Name: "sign-in", Method: "POST", Pattern: "/auth", Body: `{"email":"existing@test.com","password":"password"}`, Status: http.StatusOK},
+		{Name: "sign-in-wrong-password", Method: "POST", Pattern: "/auth", Body: `{"email":"existing@test.com","password":"wrong password"}`, Status: http.StatusForbidden},
+		{Name: "sign-in-invalid", Method: "POST", Pattern: "/auth", Body: `{"email":"existing"}`, Invalid: true, Status: http.StatusBadRequest},
+		{Name: "sign-out", Method: "DELETE", Pattern: "/auth", Header: bearer(token), Status: http.StatusNoContent},
+		{Name: "sign-out-without-csrf", Method: "DELETE", Pattern: "/auth", Header: cookie(token), Status: http.StatusForbidden},
+	})
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatalf("Failed to encode the document: %v", err)
+	}
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func cookie(token string) http.Header {
+	return http.Header{"Cookie": {session.DefaultCookieName + "=" + token}}
+}
@@ -1,39 +1,52 @@
 package user
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 
-	"github.com/jmoiron/sqlx"
+	"github.com/nick96/cubapi/db"
 )
 
 var (
 	ErrNotImplemented = errors.New("Not Implemented")
+	// ErrNoSuchUser is returned when updating a user that doesn't exist.
+	ErrNoSuchUser = errors.New("user does not exist")
 )
 
 // UserStorer is an interface that must be implemented by things that store user
-// information.
+// information. Everything but FindByEmail is scoped to a group.
 type UserStorer interface {
-	FindByEmail(email string) (User, bool, error)
-	AddUser(user User) (int64, error)
+	FindByEmail(ctx context.Context, email string) (User, bool, error)
+	GetUser(ctx context.Context, groupID int64, email string) (User, bool, error)
+	AddUser(ctx context.Context, user User) (int64, error)
+	ListUsers(ctx context.Context, groupID int64) ([]User, error)
+	SetDisabled(ctx context.Context, groupID int64, email string, disabled bool) error
+	SetPassword(ctx context.Context, groupID int64, email, passwordHash string) error
+	GrantRole(ctx context.Context, groupID int64, email, role string) error
 }
 
 // UserStore is a store for users and their related information. It implements
 // the UserStorer interface.
 type UserStore struct {
-	db *sqlx.DB
+	cluster *db.Cluster
 }
 
-// NewStore creates a new store from the given sqlx db handle.
-func NewStore(db *sqlx.DB) UserStorer {
-	return UserStore{db}
+// NewStore creates a new store from the given cluster. Reads go to a replica
+// unless the primary is forced with db.WithPrimary.
+func NewStore(cluster *db.Cluster) UserStorer {
+	return UserStore{cluster}
 }
 
-// FindByEmail finds a user by their email.
-func (s UserStore) FindByEmail(email string) (user User, found bool, err error) {
-	query := `SELECT * FROM autocrat.users WHERE email = $1;`
-	err = s.db.QueryRowx(query, email).StructScan(&user)
+// FindByEmail finds a user by their email in any group. Emails are unique
+// across groups, ignoring case, so people can sign in without saying which
+// group they're in.
+// It must only be used to sign in and to check an email is available, use
+// GetUser for everything else.
+func (s UserStore) FindByEmail(ctx context.Context, email string) (user User, found bool, err error) {
+	query := `SELECT * FROM autocrat.users WHERE lower(email) = lower($1);`
+	err = s.cluster.Reader(ctx).Named("user.find_by_email").QueryRowx(ctx, query, email).StructScan(&user)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return User{}, false, nil
@@ -43,20 +56,87 @@ func (s UserStore) FindByEmail(email string) (user User, found bool, err error)
 	return user, true, nil
 }
 
+// GetUser gets the user with the given email in the group.
+func (s UserStore) GetUser(ctx context.Context, groupID int64, email string) (user User, found bool, err error) {
+	query := `SELECT * FROM autocrat.users WHERE group_id = $1 AND lower(email) = lower($2);`
+	err = s.cluster.Reader(ctx).Named("user.get_user").QueryRowx(ctx, query, groupID, email).StructScan(&user)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, false, nil
+		}
+		return User{}, false, fmt.Errorf("could not get user with email '%s': %w", email, err)
+	}
+	return user, true, nil
+}
+
 // AddUser adds the given user to the database and returns the ID of the
 // inserted user.
-func (s UserStore) AddUser(user User) (int64, error) {
+func (s UserStore) AddUser(ctx context.Context, user User) (int64, error) {
 	var id int64
 	query := `
-	INSERT INTO autocrat.users (id, email, firstname, lastname, password)
-	VALUES (DEFAULT, $1, $2, $3, $4) 
+	INSERT INTO autocrat.users (id, email, firstname, lastname, password, group_id)
+	VALUES (DEFAULT, $1, $2, $3, $4, $5) 
 	RETURNING id;
 	`
-	err := s.db.
-		QueryRow(query, user.Email, user.FirstName, user.LastName, user.Password).
+	err := s.cluster.Primary().Named("user.add_user").
+		QueryRowx(ctx, query, user.Email, user.FirstName, user.LastName, user.Password, user.GroupId).
 		Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert user into store: %w", err)
 	}
 	return id, nil
 }
+
+// ListUsers lists the users of the group ordered by ID.
+func (s UserStore) ListUsers(ctx context.Context, groupID int64) ([]User, error) {
+	var users []User
+	query := `SELECT * FROM autocrat.users WHERE group_id = $1 ORDER BY id;`
+	if err := s.cluster.Reader(ctx).Named("user.list_users").Select(ctx, &users, query, groupID); err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	return users, nil
+}
+
+// SetDisabled disables or re-enables the user with the given email in the
+// group.
+func (s UserStore) SetDisabled(ctx context.Context, groupID int64, email string, disabled bool) error {
+	query := `UPDATE autocrat.users SET disabled = $3 WHERE group_id = $1 AND lower(email) = lower($2);`
+	result, err := s.cluster.Primary().Named("user.set_disabled").Exec(ctx, query, groupID, email, disabled)
+	return checkUpdated(result, err, email)
+}
+
+// SetPassword replaces the password hash of the user with the given email in
+// the group.
+func (s UserStore) SetPassword(ctx context.Context, groupID int64, email, passwordHash string) error {
+	query := `UPDATE autocrat.users SET password = $3 WHERE group_id = $1 AND lower(email) = lower($2);`
+	result, err := s.cluster.Primary().Named("user.set_password").Exec(ctx, query, groupID, email, passwordHash)
+	return checkUpdated(result, err, email)
+}
+
+// GrantRole grants the role to the user with the given email in the group.
+// Granting a role the user already has is a no-op.
+func (s UserStore) GrantRole(ctx context.Context, groupID int64, email, role string) error {
+	query := `
+	UPDATE autocrat.users
+	SET roles = CASE WHEN $3 = ANY(roles) THEN roles ELSE array_append(roles, $3) END
+	WHERE group_id = $1 AND lower(email) = lower($2);
+	`
+	result, err := s.cluster.Primary().Named("user.grant_role").Exec(ctx, query, groupID, email, role)
+	return checkUpdated(result, err, email)
+}
+
+// checkUpdated checks an update of the user with the given email succeeded
+// and found the user.
+func checkUpdated(result sql.Result, err error, email string) error {
+	if err != nil {
+		return fmt.Errorf("failed to update user with email '%s': %w", email, err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update user with email '%s': %w", email, err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("failed to update user with email '%s': %w", email, ErrNoSuchUser)
+	}
+	return nil
+}
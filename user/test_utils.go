@@ -1,14 +1,23 @@
 package user
 
 import (
+	"context"
 	"log"
+	"net/http"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/session"
 	"go.uber.org/zap"
 )
 
 var authService AuthService
+
+// testAuthConfig is the auth config used by tests.
+var testAuthConfig = AuthConfig{JWTSecret: "secret", JWTIssuer: "test"}
 var store UserStorer
 
 type mockUserStore map[int64]User
@@ -17,19 +26,27 @@ func newMockUserStore() mockUserStore {
 	return make(map[int64]User)
 }
 
-func (s mockUserStore) FindByEmail(email string) (User, bool, error) {
+func (s mockUserStore) FindByEmail(ctx context.Context, email string) (User, bool, error) {
 	for _, user := range s {
-		if user.Email == email {
+		if strings.EqualFold(user.Email, email) {
 			return user, true, nil
 		}
 	}
 	return User{}, false, nil
 }
 
-func (s mockUserStore) AddUser(user User) (int64, error) {
+func (s mockUserStore) GetUser(ctx context.Context, groupID int64, email string) (User, bool, error) {
+	user, found, err := s.FindByEmail(ctx, email)
+	if !found || user.GroupId != groupID {
+		return User{}, false, err
+	}
+	return user, true, nil
+}
+
+func (s mockUserStore) AddUser(ctx context.Context, user User) (int64, error) {
 	nextID := int64(1)
 	for _, user := range s {
-		if user.Id > nextID {
+		if user.Id >= nextID {
 			nextID = user.Id + 1
 		}
 	}
@@ -38,6 +55,75 @@ func (s mockUserStore) AddUser(user User) (int64, error) {
 	return nextID, nil
 }
 
+func (s mockUserStore) ListUsers(ctx context.Context, groupID int64) ([]User, error) {
+	var users []User
+	for _, user := range s {
+		if user.GroupId == groupID {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Id < users[j].Id })
+	return users, nil
+}
+
+func (s mockUserStore) update(groupID int64, email string, f func(*User)) error {
+	for id, user := range s {
+		if user.GroupId == groupID && strings.EqualFold(user.Email, email) {
+			f(&user)
+			s[id] = user
+			return nil
+		}
+	}
+	return ErrNoSuchUser
+}
+
+func (s mockUserStore) SetDisabled(ctx context.Context, groupID int64, email string, disabled bool) error {
+	return s.update(groupID, email, func(user *User) { user.Disabled = disabled })
+}
+
+func (s mockUserStore) SetPassword(ctx context.Context, groupID int64, email, passwordHash string) error {
+	return s.update(groupID, email, func(user *User) { user.Password = passwordHash })
+}
+
+func (s mockUserStore) GrantRole(ctx context.Context, groupID int64, email, role string) error {
+	return s.update(groupID, email, func(user *User) {
+		if !user.HasRole(role) {
+			user.Roles = append(user.Roles, role)
+		}
+	})
+}
+
+// Groups users can join in tests, and a group closed to sign up.
+const (
+	testGroupID   = 1
+	otherGroupID  = 2
+	closedGroupID = 3
+)
+
+// mockGroupFinder finds the test groups.
+type mockGroupFinder struct{}
+
+func (mockGroupFinder) FindBySlug(ctx context.Context, slug string) (group.Group, bool, error) {
+	switch slug {
+	case "1st-test":
+		return group.Group{Id: testGroupID, Name: "1st Test", Slug: slug, SelfSignUp: true}, true, nil
+	case "2nd-test":
+		return group.Group{Id: otherGroupID, Name: "2nd Test", Slug: slug, SelfSignUp: true}, true, nil
+	case "3rd-test":
+		return group.Group{Id: closedGroupID, Name: "3rd Test", Slug: slug}, true, nil
+	}
+	return group.Group{}, false, nil
+}
+
+func newTestSessions() *session.Manager {
+	return session.NewManager(zap.NewNop(), session.DefaultConfig(), "secret")
+}
+
+// noLimit is a rate limiter that doesn't limit anything.
+func noLimit(next http.Handler) http.Handler {
+	return next
+}
+
 func getStore() UserStorer {
 	return store
 }
@@ -48,7 +134,7 @@ func getAuthService() AuthService {
 
 func withMockUserStorer() {
 	store = mockUserStore(make(map[int64]User))
-	authService = AuthService{store}
+	authService = NewAuthService(store, testAuthConfig)
 }
 
 func withUserStore() {
@@ -63,16 +149,16 @@ func withUserStore() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	store = UserStore{dbHandle}
-	authService = AuthService{store}
+	store = UserStore{db.NewCluster(zap.NewNop(), dbHandle)}
+	authService = NewAuthService(store, testAuthConfig)
 }
 
 func cleanStore() {
 	if _, ok := store.(UserStore); ok {
 		log.Printf("Deleting all rows in users table")
-		store.(UserStore).db.MustExec(`DELETE FROM users;`)
+		store.(UserStore).cluster.Primary().MustExec(`DELETE FROM users;`)
 	} else {
 		store = mockUserStore(make(map[int64]User))
-		authService = AuthService{store}
+		authService = NewAuthService(store, testAuthConfig)
 	}
 }
@@ -0,0 +1,91 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gojwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/chi"
+	chimiddleware "github.com/go-chi/chi/middleware"
+	"github.com/nick96/cubapi/middleware"
+	"github.com/nick96/cubapi/problem"
+	"go.uber.org/zap"
+)
+
+func signedToken(t *testing.T, method gojwt.SigningMethod, key interface{}, claims gojwt.MapClaims) string {
+	token, err := gojwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestMalformedTokensAreRejected(t *testing.T) {
+	logger := zap.NewNop()
+	store := newMockUserStore()
+	store.AddUser(context.Background(), User{Email: "test@test.com", FirstName: "Bobby", LastName: "Tables", GroupId: testGroupID})
+
+	router := chi.NewRouter()
+	router.Use(chimiddleware.RequestID)
+	router.Use(middleware.Recoverer(logger))
+	router.Route("/user", NewUserRouter(logger, NewUserService(store, mockGroupFinder{}), NewAuthService(store, testAuthConfig), newTestSessions(), noLimit))
+
+	secret := []byte(testAuthConfig.JWTSecret)
+	exp := time.Now().Add(time.Hour).Unix()
+	testCases := []struct {
+		name  string
+		token string
+	}{
+		{"garbage", "not.a.jwt"},
+		{"missing-aud", signedToken(t, gojwt.SigningMethodHS256, secret, gojwt.MapClaims{"sub": "test@test.com", "exp": exp})},
+		{"numeric-aud", signedToken(t, gojwt.SigningMethodHS256, secret, gojwt.MapClaims{"aud": 42, "exp": exp})},
+		{"array-aud", signedToken(t, gojwt.SigningMethodHS256, secret, gojwt.MapClaims{"aud": []string{"test@test.com"}, "exp": exp})},
+		{"missing-exp", signedToken(t, gojwt.SigningMethodHS256, secret, gojwt.MapClaims{"aud": "test@test.com"})},
+		{"string-exp", signedToken(t, gojwt.SigningMethodHS256, secret, gojwt.MapClaims{"aud": "test@test.com", "exp": "9999999999"})},
+		{"expired", signedToken(t, gojwt.SigningMethodHS256, secret, gojwt.MapClaims{"aud": "test@test.com", "exp": time.Now().Add(-time.Hour).Unix()})},
+		{"wrong-secret", signedToken(t, gojwt.SigningMethodHS256, []byte("other"), gojwt.MapClaims{"aud": "test@test.com", "exp": exp})},
+		{"missing-group", signedToken(t, gojwt.SigningMethodHS256, secret, gojwt.MapClaims{"aud": "test@test.com", "exp": exp})},
+		{"string-group", signedToken(t, gojwt.SigningMethodHS256, secret, gojwt.MapClaims{"aud": "test@test.com", "exp": exp, "grp": "1"})},
+		{"fractional-group", signedToken(t, gojwt.SigningMethodHS256, secret, gojwt.MapClaims{"aud": "test@test.com", "exp": exp, "grp": 1.5})},
+		{"other-group", signedToken(t, gojwt.SigningMethodHS256, secret, gojwt.MapClaims{"aud": "test@test.com", "exp": exp, "grp": otherGroupID})},
+		{"alg-none", signedToken(t, gojwt.SigningMethodNone, gojwt.UnsafeAllowNoneSignatureType, gojwt.MapClaims{"aud": "test@test.com", "exp": exp})},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/user/me", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+			}
+			var resp problem.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != problem.CodeAuthenticationFailed {
+				t.Fatalf("Expected code %s, got %s", problem.CodeAuthenticationFailed, resp.Code)
+			}
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		token, err := NewAuthService(store, testAuthConfig).GetToken(context.Background(), User{Email: "test@test.com", GroupId: testGroupID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "/user/me", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected a valid token to be accepted, got status code %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
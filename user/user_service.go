@@ -1,13 +1,41 @@
 package user
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"strings"
 
+	"github.com/nick96/cubapi/db"
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/problem"
 	"github.com/nick96/cubapi/security"
+	"github.com/nick96/cubapi/tracing"
 )
 
+// CodeSignUpClosed is the problem code of signing up to a group that doesn't
+// let anyone sign up to it.
+const CodeSignUpClosed problem.Code = "sign_up_closed"
+
+func init() {
+	problem.Register(CodeSignUpClosed, http.StatusForbidden, "Sign up closed")
+}
+
+// GroupFinder finds groups by their slug. It's implemented by
+// group.GroupStorer.
+type GroupFinder interface {
+	FindBySlug(ctx context.Context, slug string) (group.Group, bool, error)
+}
+
 type UserService struct {
-	store UserStorer
+	store  UserStorer
+	groups GroupFinder
+}
+
+// NewUserService creates a UserService that stores users in the store. Users
+// join groups found by groups.
+func NewUserService(store UserStorer, groups GroupFinder) UserService {
+	return UserService{store: store, groups: groups}
 }
 
 func (s UserService) hashPassword(password string) (string, error) {
@@ -26,17 +54,37 @@ func (e errUserAlreadyExists) SafeError() string {
 	return e.Error()
 }
 
-func (s UserService) NewUser(user User) (User, security.ClientError) {
+func (e errUserAlreadyExists) ProblemCode() problem.Code {
+	return problem.CodeUserAlreadyExists
+}
+
+// NewUser creates a user in the user's group. Emails are unique across
+// groups, see UserStorer.FindByEmail.
+func (s UserService) NewUser(ctx context.Context, user User) (User, security.ClientError) {
+	ctx, span := tracing.Start(ctx, "UserService.NewUser")
+	defer span.End()
+	// A replica may not have seen a user just created with the same email.
+	ctx = db.WithPrimary(ctx)
+
+	if user.GroupId == 0 {
+		return User{}, security.NewClientError("users must belong to a group", fmt.Errorf("user %s has no group", user.Email))
+	}
+
+	_, hashSpan := tracing.Start(ctx, "security.HashNewPassword")
 	hashedPassword, err := security.HashNewPassword(user.Password)
+	hashSpan.End()
 	if err != nil {
+		span.RecordError(err)
 		return User{}, security.NewClientError("failed to create new user", err)
 	}
-	if isAvailable, err := s.isEmailAvailable(user.Email); err != nil {
+	if isAvailable, err := s.isEmailAvailable(ctx, user.Email); err != nil {
+		span.RecordError(err)
 		return User{}, err
 	} else if isAvailable {
 		user.Password = hashedPassword
-		id, err := s.store.AddUser(user)
+		id, err := s.store.AddUser(ctx, user)
 		if err != nil {
+			span.RecordError(err)
 			return User{}, security.NewClientError("failed to create new user", err)
 		}
 		user.Id = id
@@ -45,8 +93,8 @@ func (s UserService) NewUser(user User) (User, security.ClientError) {
 	return User{}, errUserAlreadyExists{email: user.Email}
 }
 
-func (s UserService) isEmailAvailable(email string) (bool, security.ClientError) {
-	_, exists, err := s.store.FindByEmail(email)
+func (s UserService) isEmailAvailable(ctx context.Context, email string) (bool, security.ClientError) {
+	_, exists, err := s.store.FindByEmail(ctx, email)
 	if err != nil {
 		return false, security.NewClientError(
 			fmt.Sprintf("failed to check if user with email %s exists", email),
@@ -57,7 +105,136 @@ func (s UserService) isEmailAvailable(email string) (bool, security.ClientError)
 	return isAvailable, nil
 }
 
+type errNoSuchGroup struct {
+	slug string
+}
+
+func (e errNoSuchGroup) Error() string {
+	return fmt.Sprintf("group %s does not exist", e.slug)
+}
+
+func (e errNoSuchGroup) SafeError() string {
+	return e.Error()
+}
+
+func (e errNoSuchGroup) ProblemCode() problem.Code {
+	return problem.CodeValidationFailed
+}
+
+type errSignUpClosed struct {
+	slug string
+}
+
+func (e errSignUpClosed) Error() string {
+	return fmt.Sprintf("group %s is closed to sign up", e.slug)
+}
+
+func (e errSignUpClosed) SafeError() string {
+	return fmt.Sprintf("group %s doesn't allow signing up, ask an admin of the group to create your user", e.slug)
+}
+
+func (e errSignUpClosed) ProblemCode() problem.Code {
+	return CodeSignUpClosed
+}
+
+// SignUpGroupID finds the ID of the group with the given slug for a user
+// signing up to it. Only groups that allow self sign up can be joined this
+// way, users of other groups are created by their admins.
+func (s UserService) SignUpGroupID(ctx context.Context, slug string) (int64, security.ClientError) {
+	// Whether sign up is allowed has to be up to date, a group that was just
+	// closed mustn't be joined from a lagging replica.
+	g, found, err := s.groups.FindBySlug(db.WithPrimary(ctx), slug)
+	if err != nil {
+		return 0, security.NewClientError(fmt.Sprintf("failed to find group %s", slug), err)
+	} else if !found {
+		return 0, errNoSuchGroup{slug: slug}
+	} else if !g.SelfSignUp {
+		return 0, errSignUpClosed{slug: slug}
+	}
+	return g.Id, nil
+}
+
 func IsErrUserAlreadyExists(err error) bool {
 	_, ok := err.(errUserAlreadyExists)
 	return ok
 }
+
+// minPasswordLength is the minimum length of a password, matching the
+// validation of sign up requests.
+const minPasswordLength = 6
+
+// GetUser gets the user with the given email in the group.
+func (s UserService) GetUser(ctx context.Context, groupID int64, email string) (User, security.ClientError) {
+	user, found, err := s.store.GetUser(ctx, groupID, email)
+	if err != nil {
+		return User{}, security.NewClientError(fmt.Sprintf("failed to retrieve user %s", email), err)
+	} else if !found {
+		return User{}, security.NewClientError(
+			fmt.Sprintf("user %s does not exist", email),
+			fmt.Errorf("could not find user with email '%s': %w", email, ErrNoSuchUser),
+		)
+	}
+	return user, nil
+}
+
+// ListUsers lists the users of the group.
+func (s UserService) ListUsers(ctx context.Context, groupID int64) ([]User, security.ClientError) {
+	users, err := s.store.ListUsers(ctx, groupID)
+	if err != nil {
+		return nil, security.NewClientError("failed to list users", err)
+	}
+	return users, nil
+}
+
+// DisableUser stops the user with the given email in the group from signing
+// in.
+func (s UserService) DisableUser(ctx context.Context, groupID int64, email string) security.ClientError {
+	if err := s.store.SetDisabled(ctx, groupID, email, true); err != nil {
+		return security.NewClientError(fmt.Sprintf("failed to disable user %s", email), err)
+	}
+	return nil
+}
+
+// SetPassword replaces the password of the user with the given email in the
+// group.
+func (s UserService) SetPassword(ctx context.Context, groupID int64, email, password string) security.ClientError {
+	if len(password) < minPasswordLength {
+		return security.NewClientError(
+			fmt.Sprintf("password must be at least %d characters", minPasswordLength),
+			fmt.Errorf("password for %s is too short", email),
+		)
+	}
+	hashedPassword, err := security.HashNewPassword(password)
+	if err != nil {
+		return security.NewClientError("failed to set password", err)
+	}
+	if err := s.store.SetPassword(ctx, groupID, email, hashedPassword); err != nil {
+		return security.NewClientError(fmt.Sprintf("failed to set password of user %s", email), err)
+	}
+	return nil
+}
+
+// GrantRole grants the role to the user with the given email in the group. The
+// role must be one of Roles.
+func (s UserService) GrantRole(ctx context.Context, groupID int64, email, role string) security.ClientError {
+	if !IsRole(role) {
+		return security.NewClientError(
+			fmt.Sprintf("unknown role %s, expected one of %s", role, strings.Join(Roles, ", ")),
+			fmt.Errorf("unknown role %s", role),
+		)
+	}
+	if err := s.store.GrantRole(ctx, groupID, email, role); err != nil {
+		return security.NewClientError(fmt.Sprintf("failed to grant role %s to user %s", role, email), err)
+	}
+	return nil
+}
+
+// IsRole reports whether role is one of Roles.
+func IsRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
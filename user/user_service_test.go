@@ -0,0 +1,149 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newServiceWithUser(t *testing.T) (UserService, mockUserStore) {
+	store := newMockUserStore()
+	service := NewUserService(store, mockGroupFinder{})
+	_, err := service.NewUser(context.Background(), User{
+		Email:     "test@test.com",
+		FirstName: "Bobby",
+		LastName:  "Tables",
+		Password:  "password",
+		GroupId:   testGroupID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service, store
+}
+
+func TestGrantRole(t *testing.T) {
+	service, _ := newServiceWithUser(t)
+	ctx := context.Background()
+
+	if err := service.GrantRole(ctx, testGroupID, "test@test.com", RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	// Granting a role twice is a no-op.
+	if err := service.GrantRole(ctx, testGroupID, "test@test.com", RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	user, err := service.GetUser(ctx, testGroupID, "test@test.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.Roles) != 1 || !user.HasRole(RoleAdmin) {
+		t.Fatalf("Expected user to have the admin role once, got %v", user.Roles)
+	}
+
+	if err := service.GrantRole(ctx, testGroupID, "test@test.com", "superuser"); err == nil {
+		t.Fatal("Expected granting an unknown role to be an error")
+	}
+	if err := service.GrantRole(ctx, testGroupID, "missing@test.com", RoleAdmin); !errors.Is(err, ErrNoSuchUser) {
+		t.Fatalf("Expected granting a role to a missing user to be ErrNoSuchUser, got %v", err)
+	}
+}
+
+func TestSetPassword(t *testing.T) {
+	service, store := newServiceWithUser(t)
+	ctx := context.Background()
+
+	if err := service.SetPassword(ctx, testGroupID, "test@test.com", "short"); err == nil {
+		t.Fatal("Expected a short password to be rejected")
+	}
+	if err := service.SetPassword(ctx, testGroupID, "test@test.com", "new password"); err != nil {
+		t.Fatal(err)
+	}
+	user, _, _ := store.FindByEmail(ctx, "test@test.com")
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("new password")); err != nil {
+		t.Fatalf("Expected the new password to be stored hashed: %v", err)
+	}
+}
+
+func TestDisabledUserCannotAuthenticate(t *testing.T) {
+	service, store := newServiceWithUser(t)
+	ctx := context.Background()
+	authService := NewAuthService(store, testAuthConfig)
+
+	if err := service.DisableUser(ctx, testGroupID, "test@test.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authService.AuthenticateUser(ctx, "test@test.com", "password"); err == nil || err.SafeError() != "account is disabled" {
+		t.Fatalf("Expected disabled user not to be authenticated, got %v", err)
+	}
+	// The account being disabled is only revealed with the correct password.
+	if _, err := authService.AuthenticateUser(ctx, "test@test.com", "wrong password"); err == nil || err.SafeError() != "username or password is incorrect" {
+		t.Fatalf("Expected incorrect password error, got %v", err)
+	}
+
+	users, err := service.ListUsers(ctx, testGroupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || !users[0].Disabled {
+		t.Fatalf("Expected the listed user to be disabled, got %+v", users)
+	}
+}
+
+func TestUsersAreScopedToGroup(t *testing.T) {
+	service, _ := newServiceWithUser(t)
+	ctx := context.Background()
+
+	if _, err := service.GetUser(ctx, otherGroupID, "test@test.com"); !errors.Is(err, ErrNoSuchUser) {
+		t.Errorf("Expected the user not to be found in another group, got %v", err)
+	}
+	if users, err := service.ListUsers(ctx, otherGroupID); err != nil || len(users) != 0 {
+		t.Errorf("Expected no users in another group, got %+v: %v", users, err)
+	}
+	for name, err := range map[string]error{
+		"grant-role":   service.GrantRole(ctx, otherGroupID, "test@test.com", RoleAdmin),
+		"set-password": service.SetPassword(ctx, otherGroupID, "test@test.com", "new password"),
+		"disable":      service.DisableUser(ctx, otherGroupID, "test@test.com"),
+	} {
+		if !errors.Is(err, ErrNoSuchUser) {
+			t.Errorf("Expected %s in another group to be ErrNoSuchUser, got %v", name, err)
+		}
+	}
+	user, err := service.GetUser(ctx, testGroupID, "test@test.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.HasRole(RoleAdmin) || user.Disabled {
+		t.Errorf("Expected the user to be unchanged by another group, got %+v", user)
+	}
+
+	// Emails are unique across groups so people can sign in without saying
+	// which group they're in.
+	if _, err := service.NewUser(ctx, User{Email: "test@test.com", FirstName: "Other", LastName: "Tables", Password: "password", GroupId: otherGroupID}); !IsErrUserAlreadyExists(err) {
+		t.Errorf("Expected the email to be taken in every group, got %v", err)
+	}
+	if _, err := service.NewUser(ctx, User{Email: "Test@Test.com", FirstName: "Other", LastName: "Tables", Password: "password", GroupId: testGroupID}); !IsErrUserAlreadyExists(err) {
+		t.Errorf("Expected the email to be taken regardless of case, got %v", err)
+	}
+	if _, err := service.NewUser(ctx, User{Email: "new@test.com", FirstName: "No", LastName: "Group", Password: "password"}); err == nil {
+		t.Error("Expected a user without a group to be rejected")
+	}
+}
+
+func TestSignUpGroupID(t *testing.T) {
+	service := NewUserService(newMockUserStore(), mockGroupFinder{})
+	ctx := context.Background()
+	if id, err := service.SignUpGroupID(ctx, "1st-test"); err != nil || id != testGroupID {
+		t.Fatalf("Expected to sign up to group %d, got %d: %v", testGroupID, id, err)
+	}
+	if _, err := service.SignUpGroupID(ctx, "no-such-group"); !errors.As(err, &errNoSuchGroup{}) {
+		t.Errorf("Expected a missing group to be rejected, got %v", err)
+	}
+	// Users of closed groups are created by an admin, so nobody can sign up
+	// to a closed group to pre-register someone else's email in it.
+	if _, err := service.SignUpGroupID(ctx, "3rd-test"); !errors.As(err, &errSignUpClosed{}) {
+		t.Errorf("Expected a closed group to be rejected, got %v", err)
+	}
+}
@@ -2,17 +2,19 @@ package user
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/nick96/cubapi/problem"
 	"go.uber.org/zap"
 )
 
 func TestNewUserOk(t *testing.T) {
 	store := newMockUserStore()
-	service := UserService{store}
+	service := NewUserService(store, mockGroupFinder{})
 	logger := zap.NewNop()
 	handler := newUser(logger, service)
 
@@ -21,6 +23,7 @@ func TestNewUserOk(t *testing.T) {
 		FirstName: "firstName",
 		LastName:  "lastName",
 		Password:  "password",
+		Group:     "1st-test",
 	}
 	content, err := json.Marshal(requestBody)
 	if err != nil {
@@ -37,7 +40,7 @@ func TestNewUserOk(t *testing.T) {
 		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Result().StatusCode, string(content))
 	}
 
-	user, exists, _ := store.FindByEmail(requestBody.Email)
+	user, exists, _ := store.FindByEmail(context.Background(), requestBody.Email)
 	if !exists {
 		t.Fatalf("Expected user with email %s to have been created", requestBody.Email)
 	}
@@ -53,6 +56,10 @@ func TestNewUserOk(t *testing.T) {
 	if user.LastName != requestBody.LastName {
 		t.Fatalf("Expected last name %s, got %s", requestBody.LastName, user.LastName)
 	}
+
+	if user.GroupId != testGroupID {
+		t.Fatalf("Expected group %d, got %d", testGroupID, user.GroupId)
+	}
 }
 
 func TestNewUserInvalidRequest(t *testing.T) {
@@ -66,6 +73,7 @@ func TestNewUserInvalidRequest(t *testing.T) {
 				FirstName: "firstName",
 				LastName:  "lastName",
 				Password:  "password",
+				Group:     "1st-test",
 			},
 		},
 		{
@@ -74,6 +82,7 @@ func TestNewUserInvalidRequest(t *testing.T) {
 				Email:     "test@test.com",
 				LastName:  "lastName",
 				Password:  "password",
+				Group:     "1st-test",
 			},
 		},
 		{
@@ -82,6 +91,7 @@ func TestNewUserInvalidRequest(t *testing.T) {
 				Email:     "test@test.com",
 				FirstName: "firstName",
 				Password:  "password",
+				Group:     "1st-test",
 			},
 		},
 		{
@@ -90,6 +100,7 @@ func TestNewUserInvalidRequest(t *testing.T) {
 				Email:     "test@test.com",
 				FirstName: "firstName",
 				LastName:  "lastName",
+				Group:     "1st-test",
 			},
 		},
 		{
@@ -99,6 +110,7 @@ func TestNewUserInvalidRequest(t *testing.T) {
 				FirstName: "firstName",
 				LastName:  "lastName",
 				Password:  "pass",
+				Group:     "1st-test",
 			},
 		},
 		{
@@ -108,11 +120,31 @@ func TestNewUserInvalidRequest(t *testing.T) {
 				FirstName: "firstName",
 				LastName:  "lastName",
 				Password:  "password",
+				Group:     "1st-test",
+			},
+		},
+		{
+			name: "no-group",
+			requestBody: UserRequest{
+				Email:     "test@test.com",
+				FirstName: "firstName",
+				LastName:  "lastName",
+				Password:  "password",
+			},
+		},
+		{
+			name: "unknown-group",
+			requestBody: UserRequest{
+				Email:     "test@test.com",
+				FirstName: "firstName",
+				LastName:  "lastName",
+				Password:  "password",
+				Group:     "no-such-group",
 			},
 		},
 	}
 	store := newMockUserStore()
-	service := UserService{store}
+	service := NewUserService(store, mockGroupFinder{})
 	logger := zap.NewNop()
 	handler := newUser(logger, service)
 
@@ -128,3 +160,25 @@ func TestNewUserInvalidRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestNewUserInvalidRequestFieldErrors(t *testing.T) {
+	handler := newUser(zap.NewNop(), NewUserService(newMockUserStore(), mockGroupFinder{}))
+	body, _ := json.Marshal(UserRequest{Email: "test@test.com", LastName: "lastName", Password: "short", Group: "1st-test"})
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/", bytes.NewReader(body)))
+
+	var resp problem.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != problem.CodeValidationFailed {
+		t.Fatalf("Expected code %s, got %s", problem.CodeValidationFailed, resp.Code)
+	}
+	fields := make(map[string]string)
+	for _, fe := range resp.Errors {
+		fields[fe.Field] = fe.Tag
+	}
+	if fields["firstName"] != "required" || fields["password"] != "min" || len(fields) != 2 {
+		t.Fatalf("Expected firstName and password field errors, got %+v", resp.Errors)
+	}
+}
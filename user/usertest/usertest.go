@@ -0,0 +1,21 @@
+// Package usertest provides middleware for testing handlers that need a
+// signed in user, without signing in.
+package usertest
+
+import (
+	"net/http"
+
+	"github.com/nick96/cubapi/group"
+	"github.com/nick96/cubapi/user"
+)
+
+// As is a middleware that makes requests as the user in their group, as
+// authentication does.
+func As(u user.User) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := group.NewContext(user.NewContext(r.Context(), u), u.GroupId)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}